@@ -55,6 +55,12 @@ func AlertIDSiafileLowRedundancy(uid string) AlertID {
 	return AlertID(fmt.Sprintf("low-redundancy:%v", uid))
 }
 
+// AlertIDSiafileUploadDeadline uses a Siafile's UID to create a unique AlertID
+// for a missed upload deadline alert.
+func AlertIDSiafileUploadDeadline(uid string) AlertID {
+	return AlertID(fmt.Sprintf("upload-deadline:%v", uid))
+}
+
 type (
 	// Alerter is the interface implemented by all top-level modules. It's an
 	// interface that allows for asking a module about potential issues.
@@ -130,6 +130,10 @@ const (
 	// snapshot siafiles.
 	BackupRoot = "snapshots"
 
+	// TrashRoot is the name of the hidden directory that deleted files are
+	// moved to if the renter's trash is enabled.
+	TrashRoot = ".trash"
+
 	// CombinedChunksRoot is the name of the directory that contains combined
 	// chunks consisting of multiple partial chunks.
 	CombinedChunksRoot = "combinedchunks"
@@ -236,6 +240,13 @@ type Allowance struct {
 	Period      types.BlockHeight `json:"period"`
 	RenewWindow types.BlockHeight `json:"renewwindow"`
 
+	// RenewJitter spreads the renewal of contracts across the beginning of
+	// the renew window. Every contract is renewed at a fixed offset of up to
+	// RenewJitter blocks after it enters the renew window instead of all
+	// contracts being renewed right at the start of a new period. A value of 0
+	// disables the jitter.
+	RenewJitter types.BlockHeight `json:"renewjitter"`
+
 	// ExpectedStorage is the amount of data that we expect to have in a contract.
 	ExpectedStorage uint64 `json:"expectedstorage"`
 
@@ -320,34 +331,52 @@ type DirectoryInfo struct {
 	// The following fields are aggregate values of the siadir. These values are
 	// the totals of the siadir and any sub siadirs, or are calculated based on
 	// all the values in the subtree
-	AggregateHealth              float64   `json:"aggregatehealth"`
-	AggregateLastHealthCheckTime time.Time `json:"aggregatelasthealthchecktime"`
-	AggregateMaxHealth           float64   `json:"aggregatemaxhealth"`
-	AggregateMaxHealthPercentage float64   `json:"aggregatemaxhealthpercentage"`
-	AggregateMinRedundancy       float64   `json:"aggregateminredundancy"`
-	AggregateMostRecentModTime   time.Time `json:"aggregatemostrecentmodtime"`
-	AggregateNumFiles            uint64    `json:"aggregatenumfiles"`
-	AggregateNumStuckChunks      uint64    `json:"aggregatenumstuckchunks"`
-	AggregateNumSubDirs          uint64    `json:"aggregatenumsubdirs"`
-	AggregateSize                uint64    `json:"aggregatesize"`
-	AggregateStuckHealth         float64   `json:"aggregatestuckhealth"`
+	AggregateHealth               float64   `json:"aggregatehealth"`
+	AggregateLastHealthCheckTime  time.Time `json:"aggregatelasthealthchecktime"`
+	AggregateMaxHealth            float64   `json:"aggregatemaxhealth"`
+	AggregateMaxHealthPercentage  float64   `json:"aggregatemaxhealthpercentage"`
+	AggregateMinRedundancy        float64   `json:"aggregateminredundancy"`
+	AggregateMostRecentModTime    time.Time `json:"aggregatemostrecentmodtime"`
+	AggregateNumFiles             uint64    `json:"aggregatenumfiles"`
+	AggregateNumFilesMissingLocal uint64    `json:"aggregatenumfilesmissinglocal"`
+	AggregateNumFilesScrubFailed  uint64    `json:"aggregatenumfilesscrubfailed"`
+	AggregateNumOrphanedFiles     uint64    `json:"aggregatenumorphanedfiles"`
+	AggregateNumStuckChunks       uint64    `json:"aggregatenumstuckchunks"`
+	AggregateNumSubDirs           uint64    `json:"aggregatenumsubdirs"`
+	AggregateNumTaggedFiles       uint64    `json:"aggregatenumtaggedfiles"`
+	AggregateNumUniqueHosts       uint64    `json:"aggregatenumuniquehosts"` // approximate
+	AggregateNumUnfinishedFiles   uint64    `json:"aggregatenumunfinishedfiles"`
+	AggregateRepairSize           uint64    `json:"aggregaterepairsize"`
+	AggregateSize                 uint64    `json:"aggregatesize"`
+	AggregateStuckHealth          float64   `json:"aggregatestuckhealth"`
 
 	// The following fields are information specific to the siadir that is not
 	// an aggregate of the entire sub directory tree
-	Health              float64     `json:"health"`
-	LastHealthCheckTime time.Time   `json:"lasthealthchecktime"`
-	MaxHealthPercentage float64     `json:"maxhealthpercentage"`
-	MaxHealth           float64     `json:"maxhealth"`
-	MinRedundancy       float64     `json:"minredundancy"`
-	DirMode             os.FileMode `json:"mode,siamismatch"` // Field is called DirMode for fuse compatibility
-	MostRecentModTime   time.Time   `json:"mostrecentmodtime"`
-	NumFiles            uint64      `json:"numfiles"`
-	NumStuckChunks      uint64      `json:"numstuckchunks"`
-	NumSubDirs          uint64      `json:"numsubdirs"`
-	SiaPath             SiaPath     `json:"siapath"`
-	DirSize             uint64      `json:"size,siamismatch"` // Stays as 'size' in json for compatibility
-	StuckHealth         float64     `json:"stuckhealth"`
-	UID                 uint64      `json:"uid"`
+	DefaultDataPieces    int           `json:"defaultdatapieces"`
+	DefaultParityPieces  int           `json:"defaultparitypieces"`
+	Health               float64       `json:"health"`
+	LastHealthCheckTime  time.Time     `json:"lasthealthchecktime"`
+	MaxHealthPercentage  float64       `json:"maxhealthpercentage"`
+	MaxHealth            float64       `json:"maxhealth"`
+	MinRedundancy        float64       `json:"minredundancy"`
+	MinRedundancyTarget  float64       `json:"minredundancytarget"`
+	DirMode              os.FileMode   `json:"mode,siamismatch"` // Field is called DirMode for fuse compatibility
+	MostRecentModTime    time.Time     `json:"mostrecentmodtime"`
+	NumFiles             uint64        `json:"numfiles"`
+	NumFilesMissingLocal uint64        `json:"numfilesmissinglocal"`
+	NumFilesScrubFailed  uint64        `json:"numfilesscrubfailed"`
+	NumOrphanedFiles     uint64        `json:"numorphanedfiles"`
+	NumStuckChunks       uint64        `json:"numstuckchunks"`
+	NumSubDirs           uint64        `json:"numsubdirs"`
+	NumTaggedFiles       uint64        `json:"numtaggedfiles"`
+	NumUniqueHosts       uint64        `json:"numuniquehosts"` // approximate
+	NumUnfinishedFiles   uint64        `json:"numunfinishedfiles"`
+	RepairSize           uint64        `json:"repairsize"`
+	ScrubInterval        time.Duration `json:"scrubinterval"`
+	SiaPath              SiaPath       `json:"siapath"`
+	DirSize              uint64        `json:"size,siamismatch"` // Stays as 'size' in json for compatibility
+	StuckHealth          float64       `json:"stuckhealth"`
+	UID                  uint64        `json:"uid"`
 }
 
 // Name implements os.FileInfo.
@@ -388,6 +417,29 @@ type DownloadInfo struct {
 	TotalDataTransferred uint64    `json:"totaldatatransferred"` // Total amount of data transferred, including negotiation, etc.
 }
 
+// The following are the types of operations that can be returned by
+// ListInProgressOperations.
+const (
+	// OperationTypeBubble is a metadata bubble of a directory.
+	OperationTypeBubble = "bubble"
+	// OperationTypeDownload is a download that hasn't completed yet.
+	OperationTypeDownload = "download"
+	// OperationTypeRepair is the repair of a file that has been fully
+	// uploaded before.
+	OperationTypeRepair = "repair"
+	// OperationTypeUpload is the initial upload of a file.
+	OperationTypeUpload = "upload"
+)
+
+// RenterOperation describes an operation that the renter is currently working
+// on.
+type RenterOperation struct {
+	Type      string    `json:"type"`      // The type of the operation.
+	SiaPath   SiaPath   `json:"siapath"`   // The siapath the operation is working on.
+	StartTime time.Time `json:"starttime"` // The time when the operation was started.
+	Progress  float64   `json:"progress"`  // The progress of the operation between 0 and 1, or -1 if unknown.
+}
+
 // FileUploadParams contains the information used by the Renter to upload a
 // file.
 type FileUploadParams struct {
@@ -397,34 +449,244 @@ type FileUploadParams struct {
 	Force               bool
 	DisablePartialChunk bool
 	Repair              bool
+
+	// DryRun causes the upload to only be validated without creating the
+	// SiaFile or queuing any chunks.
+	DryRun bool
+
+	// Priority is the upload priority of the file. Chunks of files with a
+	// higher priority are uploaded first.
+	Priority int
+
+	// AllowLowRedundancy allows uploading the file with fewer contracts than
+	// required for the full redundancy as long as there are at least
+	// MinPieces contracts.
+	AllowLowRedundancy bool
+
+	// CipherKey is the key used to encrypt the file. If it is nil, a new key
+	// of type crypto.TypeDefaultRenter is generated.
+	CipherKey crypto.CipherKey
+
+	// PreferredHosts are the hosts the file's pieces should be stored on. If
+	// they can't store all the missing pieces of a chunk, the renter falls
+	// back to its other hosts.
+	PreferredHosts []types.SiaPublicKey
+
+	// Compression is the codec used to compress the file before it is erasure
+	// coded. By default files are uploaded uncompressed.
+	Compression CompressionCodec
+
+	// Deadline is the time by which the file should have reached its target
+	// redundancy. If it hasn't, an alert is registered. Chunks of files which
+	// are approaching their deadline are repaired first.
+	Deadline time.Time
+
+	// ReadOnly marks the file as read-only. Read-only files can't be deleted
+	// or renamed until the flag is cleared again.
+	ReadOnly bool
+}
+
+// CompressionCodec is the codec used to compress a file before uploading it.
+type CompressionCodec string
+
+const (
+	// CompressionNone indicates that a file is uploaded uncompressed.
+	CompressionNone CompressionCodec = ""
+
+	// CompressionGzip indicates that a file is compressed using gzip.
+	CompressionGzip CompressionCodec = "gzip"
+)
+
+// DirBubbleError describes a directory whose metadata failed to be updated by
+// the last bubble.
+type DirBubbleError struct {
+	SiaPath     SiaPath   `json:"siapath"`
+	Error       string    `json:"error"`       // The error of the last failed bubble.
+	Time        time.Time `json:"time"`        // The time of the last failed bubble.
+	NumFailures uint64    `json:"numfailures"` // The number of consecutive failed bubbles.
+}
+
+// BubbleQueueStats contains the number of directories in every state of the
+// renter's bubble queue.
+type BubbleQueueStats struct {
+	Active  uint64 `json:"active"`  // Directories which are being bubbled.
+	Pending uint64 `json:"pending"` // Directories which need to be bubbled again once their active bubble completes.
+	Delayed uint64 `json:"delayed"` // Directories with a debounced bubble scheduled.
+	Queued  uint64 `json:"queued"`  // Directories waiting for a bubble worker.
+}
+
+// InconsistencyType is the type of an Inconsistency in the renter's
+// filesystem.
+type InconsistencyType string
+
+const (
+	// InconsistencyMissingDirMetadata indicates a directory without a siadir
+	// metadata file.
+	InconsistencyMissingDirMetadata InconsistencyType = "missingdirmetadata"
+
+	// InconsistencyUnreadableDirMetadata indicates a directory whose siadir
+	// metadata can't be loaded.
+	InconsistencyUnreadableDirMetadata InconsistencyType = "unreadabledirmetadata"
+
+	// InconsistencyOrphanedFile indicates a siafile which has at least one
+	// parent directory without valid siadir metadata.
+	InconsistencyOrphanedFile InconsistencyType = "orphanedfile"
+
+	// InconsistencySizeMismatch indicates a directory whose aggregate size
+	// doesn't match the size of the siafiles within it.
+	InconsistencySizeMismatch InconsistencyType = "sizemismatch"
+
+	// InconsistencyMissingTrackedFile indicates a siafile whose tracked local
+	// file doesn't exist anymore.
+	InconsistencyMissingTrackedFile InconsistencyType = "missingtrackedfile"
+)
+
+// Inconsistency describes an inconsistency found while validating the
+// renter's filesystem.
+type Inconsistency struct {
+	SiaPath     SiaPath           `json:"siapath"`
+	Type        InconsistencyType `json:"type"`
+	Description string            `json:"description"`
+	Repaired    bool              `json:"repaired"` // Whether or not the inconsistency was repaired.
+}
+
+// DiscrepancyType is the type of a Discrepancy between the renter's records of
+// the files it tracks.
+type DiscrepancyType string
+
+const (
+	// DiscrepancyActiveUploadWithoutFile indicates a persisted active upload
+	// whose siafile doesn't exist.
+	DiscrepancyActiveUploadWithoutFile DiscrepancyType = "activeuploadwithoutfile"
+
+	// DiscrepancyContractIndexWithoutFile indicates an entry of the contract
+	// index whose siafile doesn't exist.
+	DiscrepancyContractIndexWithoutFile DiscrepancyType = "contractindexwithoutfile"
+)
+
+// Discrepancy describes an entry of the renter's tracking records which
+// doesn't match the siafiles on disk.
+type Discrepancy struct {
+	SiaPath     SiaPath         `json:"siapath"`
+	Type        DiscrepancyType `json:"type"`
+	Description string          `json:"description"`
+	Healed      bool            `json:"healed"` // Whether or not the tracking entry was dropped.
+}
+
+// HealthEvent is emitted by the renter whenever the aggregate health of a
+// directory crosses the repair threshold.
+type HealthEvent struct {
+	SiaPath     SiaPath   `json:"siapath"`
+	OldHealth   float64   `json:"oldhealth"`
+	NewHealth   float64   `json:"newhealth"`
+	NeedsRepair bool      `json:"needsrepair"` // Whether NewHealth is at or above the repair threshold.
+	Time        time.Time `json:"time"`
+}
+
+// UploadEstimate contains the resources an upload is expected to use.
+type UploadEstimate struct {
+	NumChunks    uint64         `json:"numchunks"`
+	NumSectors   uint64         `json:"numsectors"`
+	NumContracts int            `json:"numcontracts"` // The number of contracts the pieces of a chunk are spread across.
+	StorageCost  types.Currency `json:"storagecost"`  // The estimated cost of storing the sectors for a period.
+	UploadCost   types.Currency `json:"uploadcost"`   // The estimated cost of uploading the sectors.
 }
 
 // FileInfo provides information about a file.
 type FileInfo struct {
-	AccessTime       time.Time         `json:"accesstime"`
-	Available        bool              `json:"available"`
-	ChangeTime       time.Time         `json:"changetime"`
-	CipherType       string            `json:"ciphertype"`
-	CreateTime       time.Time         `json:"createtime"`
-	Expiration       types.BlockHeight `json:"expiration"`
-	Filesize         uint64            `json:"filesize"`
-	Health           float64           `json:"health"`
-	LocalPath        string            `json:"localpath"`
-	MaxHealth        float64           `json:"maxhealth"`
-	MaxHealthPercent float64           `json:"maxhealthpercent"`
-	ModificationTime time.Time         `json:"modtime,siamismatch"` // Stays as 'modtime' in json for compatibility
-	FileMode         os.FileMode       `json:"mode,siamismatch"`    // Field is called FileMode for fuse compatibility
-	NumStuckChunks   uint64            `json:"numstuckchunks"`
-	OnDisk           bool              `json:"ondisk"`
-	Recoverable      bool              `json:"recoverable"`
-	Redundancy       float64           `json:"redundancy"`
-	Renewing         bool              `json:"renewing"`
-	SiaPath          SiaPath           `json:"siapath"`
-	Stuck            bool              `json:"stuck"`
-	StuckHealth      float64           `json:"stuckhealth"`
-	UID              uint64            `json:"uid"`
-	UploadedBytes    uint64            `json:"uploadedbytes"`
-	UploadProgress   float64           `json:"uploadprogress"`
+	AccessTime          time.Time         `json:"accesstime"`
+	Available           bool              `json:"available"`
+	ChangeTime          time.Time         `json:"changetime"`
+	CipherType          string            `json:"ciphertype"`
+	Cold                bool              `json:"cold"`
+	Compression         CompressionCodec  `json:"compression"`
+	CreateTime          time.Time         `json:"createtime"`
+	EffectiveRedundancy float64           `json:"effectiveredundancy"`
+	Expiration          types.BlockHeight `json:"expiration"`
+	Filesize            uint64            `json:"filesize"`
+	Health              float64           `json:"health"`
+	LastScrubTime       time.Time         `json:"lastscrubtime"`
+	LastVerifiedTime    time.Time         `json:"lastverifiedtime"`
+	LocalPath           string            `json:"localpath"`
+	MaxHealth           float64           `json:"maxhealth"`
+	MaxHealthPercent    float64           `json:"maxhealthpercent"`
+	ModificationTime    time.Time         `json:"modtime,siamismatch"` // Stays as 'modtime' in json for compatibility
+	FileMode            os.FileMode       `json:"mode,siamismatch"`    // Field is called FileMode for fuse compatibility
+	NumStuckChunks      uint64            `json:"numstuckchunks"`
+	OnDisk              bool              `json:"ondisk"`
+	ReadOnly            bool              `json:"readonly"`
+	Recoverable         bool              `json:"recoverable"`
+	Redundancy          float64           `json:"redundancy"`
+	Renewing            bool              `json:"renewing"`
+	ScrubFailed         bool              `json:"scrubfailed"`
+	SiaPath             SiaPath           `json:"siapath"`
+	StoredSize          uint64            `json:"storedsize"` // Size of the file after compression.
+	Stuck               bool              `json:"stuck"`
+	StuckHealth         float64           `json:"stuckhealth"`
+	UID                 uint64            `json:"uid"`
+	UploadDeadline      time.Time         `json:"uploaddeadline"`
+	UploadRetries       uint64            `json:"uploadretries"`
+	UploadedBytes       uint64            `json:"uploadedbytes"`
+	UploadProgress      float64           `json:"uploadprogress"`
+	VerificationFailed  bool              `json:"verificationfailed"`
+}
+
+// DirUsage is the storage used by a directory and its subdirectories.
+// AggregateHostStorage is the number of bytes stored on hosts for the files of
+// the directory, including redundancy and padding.
+type DirUsage struct {
+	SiaPath              SiaPath `json:"siapath"`
+	AggregateSize        uint64  `json:"aggregatesize"`
+	AggregateNumPieces   uint64  `json:"aggregatenumpieces"`
+	AggregateHostStorage uint64  `json:"aggregatehoststorage"`
+}
+
+// FileOrDirInfo contains the information of a single file or directory as
+// returned by Stat. If IsDir is true, Dir is set. Otherwise File is set.
+type FileOrDirInfo struct {
+	IsDir bool          `json:"isdir"`
+	File  FileInfo      `json:"file"`
+	Dir   DirectoryInfo `json:"dir"`
+}
+
+// StuckChunkReason describes why a chunk is stuck.
+type StuckChunkReason string
+
+const (
+	// StuckReasonAllPiecesOffline indicates that the chunk can't be recovered
+	// because all the hosts storing its pieces are offline.
+	StuckReasonAllPiecesOffline StuckChunkReason = "all pieces offline"
+
+	// StuckReasonInsufficientPieces indicates that the chunk can't be
+	// recovered because not enough of its pieces are stored on good hosts.
+	StuckReasonInsufficientPieces StuckChunkReason = "insufficient pieces"
+
+	// StuckReasonNoGoodHosts indicates that the chunk can't be recovered
+	// because none of the hosts storing its pieces are good for renew.
+	StuckReasonNoGoodHosts StuckChunkReason = "no good hosts"
+
+	// StuckReasonNotEnoughHosts indicates that there are not enough online
+	// hosts that are good for upload to store the missing pieces of the chunk.
+	StuckReasonNotEnoughHosts StuckChunkReason = "not enough hosts"
+
+	// StuckReasonRepairFailed indicates that the chunk could be repaired in
+	// theory but previous repair attempts failed.
+	StuckReasonRepairFailed StuckChunkReason = "repair failed"
+)
+
+// StuckChunkInfo contains information about a single stuck chunk.
+type StuckChunkInfo struct {
+	SiaPath    SiaPath          `json:"siapath"`
+	ChunkIndex uint64           `json:"chunkindex"`
+	Reason     StuckChunkReason `json:"reason"`
+}
+
+// FileHostPieces contains the number of pieces of a file that are stored on a
+// single host.
+type FileHostPieces struct {
+	HostPublicKey types.SiaPublicKey `json:"hostpublickey"`
+	Offline       bool               `json:"offline"`
+	Pieces        int                `json:"pieces"`
 }
 
 // Name implements os.FileInfo.
@@ -509,6 +771,35 @@ type HostScoreBreakdown struct {
 	VersionAdjustment          float64 `json:"versionadjustment"`
 }
 
+// HostScore describes how the renter currently rates a host it has a contract
+// with when distributing pieces. It combines the hostdb's score breakdown with
+// the performance the renter observed while uploading to the host.
+type HostScore struct {
+	PublicKey      types.SiaPublicKey `json:"publickey"`
+	ScoreBreakdown HostScoreBreakdown `json:"scorebreakdown"`
+	GoodForUpload  bool               `json:"goodforupload"`
+
+	// UploadLatency is the duration of the most recent successful piece
+	// upload to the host. It is zero if no piece was uploaded to the host
+	// since startup.
+	UploadLatency time.Duration `json:"uploadlatency"`
+
+	// Upload failures and the resulting cooldown. Hosts on cooldown don't
+	// receive new pieces until the cooldown is over.
+	UploadConsecutiveFailures int           `json:"uploadconsecutivefailures"`
+	UploadOnCooldown          bool          `json:"uploadoncooldown"`
+	UploadCooldownRemaining   time.Duration `json:"uploadcooldownremaining"`
+}
+
+// HostThroughput is the upload throughput the renter measured for a host over
+// the recent past. Hosts without recent uploads have no samples and a
+// throughput of 0.
+type HostThroughput struct {
+	PublicKey  types.SiaPublicKey `json:"publickey"`
+	Throughput float64            `json:"throughput"` // bytes per second
+	Samples    int                `json:"samples"`
+}
+
 // MountInfo contains information about a mounted FUSE filesystem.
 type MountInfo struct {
 	MountPoint string  `json:"mountpoint"`
@@ -539,12 +830,45 @@ type RenterSettings struct {
 	MaxUploadSpeed   int64         `json:"maxuploadspeed"`
 	MaxDownloadSpeed int64         `json:"maxdownloadspeed"`
 	UploadsStatus    UploadsStatus `json:"uploadsstatus"`
+
+	// ChunkDeduplication enables the reuse of already uploaded chunks for new
+	// uploads with the same content, erasure code and cipher key.
+	ChunkDeduplication bool `json:"chunkdeduplication"`
+
+	// RepairThreshold is the health at which the renter starts repairing a
+	// file. Passing a value of 0 to SetSettings resets it to the default.
+	RepairThreshold float64 `json:"repairthreshold"`
 }
 
 // UploadsStatus contains information about the Renter's Uploads
 type UploadsStatus struct {
 	Paused       bool      `json:"paused"`
 	PauseEndTime time.Time `json:"pauseendtime"`
+
+	// RepairsPaused indicates whether the repairs were paused until they are
+	// resumed explicitly. In that case PauseEndTime is zero.
+	RepairsPaused bool `json:"repairspaused"`
+}
+
+// UploadRetryPolicy controls how the renter retries failed piece uploads. A
+// failed piece is first retried on the same host up to MaxAttemptsPerHost
+// attempts, waiting Backoff before the first retry and twice as long before
+// every further retry. Afterwards the piece is handed to a different host.
+type UploadRetryPolicy struct {
+	// MaxAttemptsPerHost is the number of times a piece is uploaded to the
+	// same host before a different host is selected. A value of 0 is treated
+	// like 1, which means that failed pieces are never retried on the same
+	// host.
+	MaxAttemptsPerHost int `json:"maxattemptsperhost"`
+
+	// Backoff is the time to wait before retrying a piece on the same host.
+	Backoff time.Duration `json:"backoff"`
+
+	// MaxHostReselections is the number of times failed pieces of a chunk are
+	// handed to a different host within a single repair. Once it is exceeded
+	// the repair of the chunk is given up and the chunk is marked as stuck. A
+	// value of 0 means that there is no limit.
+	MaxHostReselections int `json:"maxhostreselections"`
 }
 
 // HostDBScans represents a sortable slice of scans.
@@ -694,6 +1018,49 @@ type ContractorSpending struct {
 	PreviousSpending types.Currency `json:"previousspending"`
 }
 
+// SpendingTotals contains the money spent on a set of contracts by category.
+type SpendingTotals struct {
+	DownloadSpending types.Currency `json:"downloadspending"`
+	StorageSpending  types.Currency `json:"storagespending"`
+	UploadSpending   types.Currency `json:"uploadspending"`
+	// Fees are the sum of the ContractFee, TxnFee and SiafundFee of the
+	// contracts.
+	Fees types.Currency `json:"fees"`
+}
+
+// SpendingBreakdown contains the money the Contractor has spent on all of its
+// contracts, including expired and archived ones, and the subtotal of the
+// current billing period.
+type SpendingBreakdown struct {
+	Total         SpendingTotals `json:"total"`
+	CurrentPeriod SpendingTotals `json:"currentperiod"`
+}
+
+// ContractRecoveryStatus contains information about the progress of the
+// recovery of contracts from the renter's seed.
+type ContractRecoveryStatus struct {
+	// InProgress indicates whether the contractor is still scanning the
+	// blockchain or still has contracts which it is trying to recover.
+	InProgress bool `json:"inprogress"`
+	// ScanInProgress indicates whether the blockchain is currently being
+	// scanned for recoverable contracts.
+	ScanInProgress bool `json:"scaninprogress"`
+	// ScannedBlocks is the number of blocks scanned by the current scan.
+	ScannedBlocks types.BlockHeight `json:"scannedblocks"`
+	// IdentifiersMatched is the number of contract identifiers found on the
+	// blockchain that matched the renter's seed.
+	IdentifiersMatched uint64 `json:"identifiersmatched"`
+	// ContractsPending is the number of contracts that were found but not
+	// recovered yet.
+	ContractsPending uint64 `json:"contractspending"`
+	// ContractsRecovered is the number of contracts that were successfully
+	// recovered.
+	ContractsRecovered uint64 `json:"contractsrecovered"`
+	// BandwidthUsed is the number of bytes sent to and received from hosts
+	// while recovering contracts.
+	BandwidthUsed uint64 `json:"bandwidthused"`
+}
+
 // ContractorChurnStatus contains the current churn budgets for the Contractor's
 // churnLimiter and the aggregate churn for the current period.
 type ContractorChurnStatus struct {
@@ -731,6 +1098,9 @@ type Renter interface {
 	// CancelContract cancels a specific contract of the renter.
 	CancelContract(id types.FileContractID) error
 
+	// CancelUpload stops the upload of a file and optionally deletes it.
+	CancelUpload(siaPath SiaPath, deleteFile bool) error
+
 	// Contracts returns the staticContracts of the renter's hostContractor.
 	Contracts() []RenterContract
 
@@ -742,6 +1112,15 @@ type Renter interface {
 	// nil, the backup will be encrypted using the provided secret.
 	CreateBackup(dst string, secret []byte) error
 
+	// ExportMetadata writes the metadata of all files, including their
+	// encryption keys and the pieces stored on hosts, to w. Files which can't
+	// be exported are skipped and returned.
+	ExportMetadata(w io.Writer) ([]SiaPath, error)
+
+	// ImportMetadata recreates the files of an export created with
+	// ExportMetadata. Files which already exist are skipped.
+	ImportMetadata(r io.Reader) error
+
 	// LoadBackup loads the siafiles of a previously created backup into the
 	// renter. If the backup is encrypted, secret will be used to decrypt it.
 	// Otherwise the argument is ignored.
@@ -782,6 +1161,10 @@ type Renter interface {
 	// billing period.
 	PeriodSpending() (ContractorSpending, error)
 
+	// ContractEndHeights returns the end heights of the active contracts in
+	// ascending order.
+	ContractEndHeights() []types.BlockHeight
+
 	// RecoverableContracts returns the contracts that the contractor deems
 	// recoverable. That means they are not expired yet and also not part of the
 	// active contracts. Usually this should return an empty slice unless the host
@@ -792,9 +1175,31 @@ type Renter interface {
 	// contracts is in progress and if it is, the current progress of the scan.
 	RecoveryScanStatus() (bool, types.BlockHeight)
 
+	// RecoveryStatus returns information about the progress of the contract
+	// recovery.
+	RecoveryStatus() ContractRecoveryStatus
+
 	// RefreshedContract checks if the contract was previously refreshed
 	RefreshedContract(fcid types.FileContractID) bool
 
+	// FilesByHealth returns the files whose cached max health is within
+	// [minHealth, maxHealth], least healthy files first.
+	FilesByHealth(minHealth, maxHealth float64) ([]FileInfo, error)
+
+	// FileTags returns the tags of a file.
+	FileTags(siaPath SiaPath) (map[string]string, error)
+
+	// SetFileCold marks a file as cold or hot. Cold files are only repaired
+	// once their health drops below a higher threshold than regular files.
+	SetFileCold(siaPath SiaPath, cold bool) error
+
+	// SetReadOnly marks a file as read-only or writable. Read-only files
+	// can't be deleted or renamed but are still repaired.
+	SetReadOnly(siaPath SiaPath, readOnly bool) error
+
+	// SetFileTags replaces the tags of a file.
+	SetFileTags(siaPath SiaPath, tags map[string]string) error
+
 	// SetFileStuck sets the 'stuck' status of a file.
 	SetFileStuck(siaPath SiaPath, stuck bool) error
 
@@ -812,14 +1217,42 @@ type Renter interface {
 	// BackupsOnHost returns the backups stored on the specified host.
 	BackupsOnHost(hostKey types.SiaPublicKey) ([]UploadedBackup, error)
 
-	// DeleteFile deletes a file entry from the renter.
+	// DeleteFile deletes a file entry from the renter. If the trash is
+	// enabled, the file is moved to the trash instead.
 	DeleteFile(siaPath SiaPath) error
 
+	// RestoreFromTrash moves the most recently deleted version of a file from
+	// the trash back to its original location.
+	RestoreFromTrash(siaPath SiaPath) error
+
+	// SafeToDeleteSource returns whether a file reached the safe redundancy
+	// at which its local source can be deleted, together with the current
+	// redundancy of the file.
+	SafeToDeleteSource(siaPath SiaPath) (bool, float64, error)
+
+	// SetSafeRedundancy sets the redundancy a file needs to reach before its
+	// local source is considered safe to delete and whether local sources are
+	// deleted automatically once it is reached.
+	SetSafeRedundancy(redundancy float64, autoDelete bool) error
+
+	// SetTrashRetention sets the duration deleted files are kept in the
+	// trash. A retention of 0 disables the trash.
+	SetTrashRetention(retention time.Duration) error
+
 	// Download creates a download according to the parameters passed, including
 	// downloads of `offset` and `length` type. It returns a method to
 	// start the download.
 	Download(params RenterDownloadParameters) (DownloadID, func() error, error)
 
+	// DownloadRange downloads length bytes of a file starting at offset and
+	// writes them to w. Only the chunks overlapping the range are fetched and
+	// the length is clamped to the file size.
+	DownloadRange(siaPath SiaPath, offset, length uint64, w io.Writer) error
+
+	// DownloadToWriterAt downloads a whole file and writes its chunks to w at
+	// their offsets as soon as they are recovered.
+	DownloadToWriterAt(siaPath SiaPath, w io.WriterAt) error
+
 	// DownloadAsync creates a file download using the passed parameters without
 	// blocking until the download is finished. The download needs to be started
 	// using the method returned by DownloadAsync. DownloadAsync also accepts an
@@ -831,6 +1264,14 @@ type Renter interface {
 	// inclusive for before and after times.
 	ClearDownloadHistory(after, before time.Time) error
 
+	// DirBubbleErrors returns the directories whose metadata failed to be
+	// updated by the last bubble.
+	DirBubbleErrors() []DirBubbleError
+
+	// BubbleQueueStats returns the number of directories in every state of
+	// the bubble queue.
+	BubbleQueueStats() BubbleQueueStats
+
 	// DownloadByUID returns a download from the download history given its uid.
 	DownloadByUID(uid DownloadID) (DownloadInfo, bool)
 
@@ -840,11 +1281,44 @@ type Renter interface {
 	// File returns information on specific file queried by user
 	File(siaPath SiaPath) (FileInfo, error)
 
+	// DiskUsage returns the storage used by every directory, sorted by
+	// aggregate size in descending order.
+	DiskUsage() ([]DirUsage, error)
+
+	// Stat returns the cached information of the file or directory at
+	// siaPath without listing its parent.
+	Stat(siaPath SiaPath) (FileOrDirInfo, error)
+
+	// StuckChunks returns all the stuck chunks of the renter together with
+	// the reason they are stuck.
+	StuckChunks() ([]StuckChunkInfo, error)
+
+	// FileHostDistribution returns the number of pieces of a file that are
+	// stored on each host, sorted by the number of pieces in descending
+	// order.
+	FileHostDistribution(siaPath SiaPath) ([]FileHostPieces, error)
+
+	// FileRedundancyParams returns the number of data and parity pieces a
+	// file was uploaded with.
+	FileRedundancyParams(siaPath SiaPath) (dataPieces, parityPieces int, err error)
+
 	// FileList returns information on all of the files stored by the renter at the
 	// specified folder. The 'cached' argument specifies whether cached values
 	// should be returned or not.
 	FileList(siaPath SiaPath, recursive, cached bool) ([]FileInfo, error)
 
+	// Glob returns the SiaPaths of all the files and directories that match
+	// the glob pattern. '*' and '?' match within a single element of a
+	// SiaPath while '**' matches zero or more elements. A trailing '/' only
+	// matches directories.
+	Glob(pattern string) ([]SiaPath, error)
+
+	// FilesystemDigest returns a digest of the paths and uploaded pieces of
+	// all the renter's files. Since the pieces are encrypted, only renters
+	// sharing the same siafiles, e.g. restored from the same backup, return
+	// the same digest.
+	FilesystemDigest() (crypto.Hash, error)
+
 	// Filter returns the renter's hostdb's filterMode and filteredHosts
 	Filter() (FilterMode, map[string]types.SiaPublicKey, error)
 
@@ -854,6 +1328,23 @@ type Renter interface {
 	// Host provides the DB entry and score breakdown for the requested host.
 	Host(pk types.SiaPublicKey) (HostDBEntry, bool, error)
 
+	// OldestHealthCheckTime returns the siapath of the directory with the
+	// oldest LastHealthCheckTime and that time.
+	OldestHealthCheckTime() (SiaPath, time.Time, error)
+
+	// LastRootBubbleTime returns the time at which a bubble last successfully
+	// updated the metadata of the root directory.
+	LastRootBubbleTime() time.Time
+
+	// DiskWriteError returns whether the renter failed to persist the
+	// metadata of any file or directory during its last bubble. If it did,
+	// the reported health is still up-to-date but won't survive a restart.
+	DiskWriteError() bool
+
+	// ListInProgressOperations returns all the operations the renter is
+	// currently working on.
+	ListInProgressOperations() []RenterOperation
+
 	// InitialScanComplete returns a boolean indicating if the initial scan of the
 	// hostdb is completed.
 	InitialScanComplete() (bool, error)
@@ -868,6 +1359,30 @@ type Renter interface {
 	// RenameDir changes the path of a dir.
 	RenameDir(oldPath, newPath SiaPath) error
 
+	// Rename changes the path of a file or dir.
+	Rename(oldPath, newPath SiaPath) error
+
+	// ReEncode changes the erasure code of a file by downloading it and
+	// uploading it again using the new erasure code.
+	ReEncode(siaPath SiaPath, ec ErasureCoder) error
+
+	// RecalculateSizes recomputes the sizes of all directories from the
+	// siafiles on disk and returns the directories whose bubbled sizes
+	// diverged.
+	RecalculateSizes() ([]SiaPath, error)
+
+	// ReconcileTracking compares the renter's records of the tracked files
+	// with the siafiles on disk and returns the records without a siafile.
+	ReconcileTracking() ([]Discrepancy, error)
+
+	// HealTracking reconciles the tracking records like ReconcileTracking and
+	// drops the records without a siafile.
+	HealTracking() ([]Discrepancy, error)
+
+	// RepairFilesystem validates the filesystem like ValidateFilesystem and
+	// repairs the inconsistencies it can.
+	RepairFilesystem() ([]Inconsistency, error)
+
 	// EstimateHostScore will return the score for a host with the provided
 	// settings, assuming perfect age and uptime adjustments
 	EstimateHostScore(entry HostDBEntry, allowance Allowance) (HostScoreBreakdown, error)
@@ -876,12 +1391,63 @@ type Renter interface {
 	// hostdb's weighting algorithm.
 	ScoreBreakdown(entry HostDBEntry) (HostScoreBreakdown, error)
 
+	// HostScores returns the scores of the hosts the renter uploads pieces
+	// to.
+	HostScores() ([]HostScore, error)
+
+	// HostThroughput returns the recent upload throughput of the hosts the
+	// renter uploads pieces to.
+	HostThroughput() ([]HostThroughput, error)
+
 	// Settings returns the Renter's current settings.
 	Settings() (RenterSettings, error)
 
 	// SetSettings sets the Renter's settings.
 	SetSettings(RenterSettings) error
 
+	// SetDefaultRedundancy sets the number of data and parity pieces used for
+	// uploads that don't specify an erasure code.
+	SetDefaultRedundancy(dataPieces, parityPieces int) error
+
+	// SetRepairThreshold sets the health at which the renter starts repairing
+	// a file.
+	SetRepairThreshold(threshold float64) error
+
+	// SetMetadataWriteRate sets the maximum number of siafile metadata writes
+	// per second performed by the health scan. A rate of 0 removes the limit.
+	SetMetadataWriteRate(writesPerSecond uint64) error
+
+	// SetRepairSignalThrottleInterval sets the minimum amount of time between
+	// two signals sent to the repair or stuck loop by bubbles of the root
+	// directory. An interval of 0 resets it to the default.
+	SetRepairSignalThrottleInterval(interval time.Duration) error
+
+	// SetBubbleFileWorkers sets the number of threads used to calculate the
+	// metadata of the siafiles within a directory during a bubble. A value of
+	// 0 resets it to the default.
+	SetBubbleFileWorkers(numWorkers uint64) error
+
+	// SetUploadRetryPolicy sets the policy used to retry failed piece uploads.
+	SetUploadRetryPolicy(policy UploadRetryPolicy) error
+
+	// UploadRetryPolicy returns the policy used to retry failed piece uploads.
+	UploadRetryPolicy() UploadRetryPolicy
+
+	// SetRepairBandwidthLimit sets the maximum number of bytes uploaded by
+	// repairs per interval. A limit of 0 removes the limit.
+	SetRepairBandwidthLimit(bytesPerInterval uint64) error
+
+	// SetOrphanedFileExtensions sets the extensions of orphaned files which
+	// are removed when the directory metadata is updated.
+	SetOrphanedFileExtensions(extensions []string) error
+
+	// SetVerificationSampleRate sets the probability with which a file is
+	// verified after it was repaired.
+	SetVerificationSampleRate(rate float64) error
+
+	// SetUploadPriority sets the upload priority of a file.
+	SetUploadPriority(siaPath SiaPath, priority int) error
+
 	// SetFileTrackingPath sets the on-disk location of an uploaded file to a
 	// new value. Useful if files need to be moved on disk.
 	SetFileTrackingPath(siaPath SiaPath, newPath string) error
@@ -893,13 +1459,54 @@ type Renter interface {
 	// ResumeRepairsAndUploads resumes the renter's repairs and uploads
 	ResumeRepairsAndUploads() error
 
+	// PauseRepairs pauses the renter's repairs until ResumeRepairs is
+	// called. The paused state is persisted across restarts.
+	PauseRepairs() error
+
+	// ResumeRepairs resumes the repairs paused by PauseRepairs.
+	ResumeRepairs() error
+
 	// Streamer creates a io.ReadSeeker that can be used to stream downloads
 	// from the Sia network and also returns the fileName of the streamed
 	// resource.
 	Streamer(siapath SiaPath, disableLocalFetch bool) (string, Streamer, error)
 
-	// Upload uploads a file using the input parameters.
-	Upload(FileUploadParams) error
+	// SubscribeHealthEvents returns a channel which receives a HealthEvent
+	// whenever the health of a directory crosses the repair threshold. Events
+	// are dropped if the subscriber doesn't keep up.
+	SubscribeHealthEvents() <-chan HealthEvent
+
+	// UnsubscribeHealthEvents closes a channel returned by
+	// SubscribeHealthEvents.
+	UnsubscribeHealthEvents(<-chan HealthEvent)
+
+	// EstimatedUploadCompletion estimates the remaining time until a file
+	// reaches its target redundancy based on its recent upload rate.
+	EstimatedUploadCompletion(siaPath SiaPath) (time.Duration, error)
+
+	// OnUploadProgress registers a callback which is called with the number
+	// of uploaded and the number of desired bytes of a file whenever one of
+	// its chunks finishes uploading. The callback is removed once the file is
+	// fully uploaded or deleted.
+	OnUploadProgress(siaPath SiaPath, fn func(completed, total uint64)) error
+
+	// ValidateFilesystem walks the renter's filesystem and returns the
+	// inconsistencies it finds.
+	ValidateFilesystem() ([]Inconsistency, error)
+
+	// Upload uploads a file using the input parameters. It returns an
+	// estimate of the resources used by the upload.
+	Upload(FileUploadParams) (UploadEstimate, error)
+
+	// UploadDirectory recursively uploads all the files within the directory
+	// specified by the source of the input parameters. The erasure code of
+	// the parameters can be overridden for specific file extensions. The
+	// number of files that were queued for upload is returned.
+	UploadDirectory(up FileUploadParams, extensionCodes map[string]ErasureCoder) (uint64, error)
+
+	// UploadStream uploads the data read from reader to siaPath using the
+	// erasure code ec.
+	UploadStream(siaPath SiaPath, reader io.Reader, ec ErasureCoder) error
 
 	// UploadStreamFromReader reads from the provided reader until io.EOF is reached and
 	// upload the data to the Sia network.
@@ -913,6 +1520,32 @@ type Renter interface {
 
 	// DirList lists the directories in a siadir
 	DirList(siaPath SiaPath) ([]DirectoryInfo, error)
+
+	// DirectoriesBelowTarget returns the siapaths of all the directories
+	// whose aggregate min redundancy dropped below their min redundancy
+	// target.
+	DirectoriesBelowTarget() []SiaPath
+
+	// SetDirMinRedundancyTarget sets the min redundancy target of a
+	// directory. A target of 0 disables the target.
+	SetDirMinRedundancyTarget(siaPath SiaPath, target float64) error
+
+	// SetDirDefaultRedundancy sets the default erasure coding settings for
+	// uploads into a directory and its subdirectories. Setting both values
+	// to 0 removes the default.
+	SetDirDefaultRedundancy(siaPath SiaPath, dataPieces, parityPieces int) error
+
+	// SetDirScrubInterval sets the interval at which the files in a directory
+	// and its subdirectories are scrubbed. An interval of 0 removes the
+	// interval.
+	SetDirScrubInterval(siaPath SiaPath, interval time.Duration) error
+
+	// RelocateFilesDir moves the renter's filesystem to newPath.
+	RelocateFilesDir(newPath string) error
+
+	// RelocateFilesDirDryRun checks whether the renter's filesystem can be
+	// moved to newPath without moving it.
+	RelocateFilesDirDryRun(newPath string) error
 }
 
 // Streamer is the interface implemented by the Renter's streamer type which
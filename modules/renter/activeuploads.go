@@ -0,0 +1,199 @@
+package renter
+
+// activeuploads.go keeps track of the files which are currently being uploaded
+// and persists them. If the renter shuts down during an upload, the chunks of
+// these files are pushed back into the upload heap on startup instead of
+// waiting for the health loop to find the files again. The upload priority of
+// a file is stored in its metadata and therefore applies to the requeued
+// chunks as well.
+//
+// Changes to the active uploads are not saved right away. They are saved
+// periodically by threadedPersistActiveUploads and on shutdown, so an upload
+// which started right before a crash is only found again by the health loop.
+// The number of tracked uploads is limited to maxActiveUploads for the same
+// reason.
+
+import (
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+)
+
+// managedAddActiveUpload adds a file to the set of active uploads.
+func (r *Renter) managedAddActiveUpload(siaPath modules.SiaPath) {
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	if r.persist.ActiveUploads == nil {
+		r.persist.ActiveUploads = make(map[string]struct{})
+	}
+	if _, exists := r.persist.ActiveUploads[siaPath.String()]; exists {
+		return
+	}
+	if len(r.persist.ActiveUploads) >= maxActiveUploads {
+		r.log.Debugf("not tracking upload of %v, too many active uploads", siaPath)
+		return
+	}
+	r.persist.ActiveUploads[siaPath.String()] = struct{}{}
+	r.activeUploadsChanged = true
+}
+
+// managedRemoveActiveUpload removes a file from the set of active uploads.
+func (r *Renter) managedRemoveActiveUpload(siaPath string) {
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	if _, exists := r.persist.ActiveUploads[siaPath]; !exists {
+		return
+	}
+	delete(r.persist.ActiveUploads, siaPath)
+	r.activeUploadsChanged = true
+}
+
+// managedRemoveActiveUploadsDir removes all the files within a deleted
+// directory from the set of active uploads.
+func (r *Renter) managedRemoveActiveUploadsDir(siaPath modules.SiaPath) {
+	prefix := siaPath.String() + "/"
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	for sp := range r.persist.ActiveUploads {
+		if siaPath.IsRoot() || strings.HasPrefix(sp, prefix) {
+			delete(r.persist.ActiveUploads, sp)
+			r.activeUploadsChanged = true
+		}
+	}
+}
+
+// managedRenameActiveUploads updates the active uploads after the file or
+// directory at oldPath was renamed to newPath.
+func (r *Renter) managedRenameActiveUploads(oldPath, newPath modules.SiaPath) {
+	oldPrefix := oldPath.String() + "/"
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	for sp := range r.persist.ActiveUploads {
+		var renamed string
+		if sp == oldPath.String() {
+			renamed = newPath.String()
+		} else if strings.HasPrefix(sp, oldPrefix) {
+			renamed = newPath.String() + "/" + strings.TrimPrefix(sp, oldPrefix)
+		} else {
+			continue
+		}
+		delete(r.persist.ActiveUploads, sp)
+		r.persist.ActiveUploads[renamed] = struct{}{}
+		r.activeUploadsChanged = true
+	}
+}
+
+// managedActiveUploads returns the siapaths of the active uploads.
+func (r *Renter) managedActiveUploads() []string {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	siaPaths := make([]string, 0, len(r.persist.ActiveUploads))
+	for siaPath := range r.persist.ActiveUploads {
+		siaPaths = append(siaPaths, siaPath)
+	}
+	return siaPaths
+}
+
+// managedPersistActiveUploads saves the renter's persistence if the active
+// uploads changed since they were last saved.
+func (r *Renter) managedPersistActiveUploads() error {
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	if !r.activeUploadsChanged {
+		return nil
+	}
+	if err := r.saveSync(); err != nil {
+		return err
+	}
+	r.activeUploadsChanged = false
+	return nil
+}
+
+// threadedPersistActiveUploads periodically saves the changes to the active
+// uploads.
+func (r *Renter) threadedPersistActiveUploads() {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+	for {
+		select {
+		case <-r.tg.StopChan():
+			return
+		case <-time.After(activeUploadsPersistInterval):
+		}
+		if err := r.managedPersistActiveUploads(); err != nil {
+			r.log.Println("WARN: failed to persist active uploads:", err)
+		}
+	}
+}
+
+// managedUpdateActiveUpload removes a file from the active uploads once it is
+// fully uploaded or deleted. It is called whenever a chunk of the file
+// finished uploading.
+func (r *Renter) managedUpdateActiveUpload(entry *filesystem.FileNode) {
+	id := r.mu.RLock()
+	numActive := len(r.persist.ActiveUploads)
+	r.mu.RUnlock(id)
+	if numActive == 0 {
+		return
+	}
+	siaPath := r.staticFileSystem.FileSiaPath(entry).String()
+	id = r.mu.RLock()
+	_, active := r.persist.ActiveUploads[siaPath]
+	r.mu.RUnlock(id)
+	if !active {
+		return
+	}
+	if !entry.Deleted() {
+		progress, _, err := entry.UploadProgressAndBytes()
+		if err != nil {
+			r.log.Debugln("WARN: failed to get upload progress:", err)
+			return
+		}
+		if progress < 100 {
+			return
+		}
+	}
+	r.managedRemoveActiveUpload(siaPath)
+}
+
+// managedRequeueActiveUploads pushes the chunks of the files which were being
+// uploaded when the renter shut down back into the upload heap. Files which
+// don't exist anymore are dropped from the active uploads.
+func (r *Renter) managedRequeueActiveUploads() {
+	siaPaths := r.managedActiveUploads()
+	if len(siaPaths) == 0 {
+		return
+	}
+	hosts := r.managedRefreshHostsAndWorkers()
+	offline, goodForRenew, _ := r.managedContractUtilityMaps()
+	ranking := r.managedHostThroughputRanking()
+	for _, sp := range siaPaths {
+		siaPath, err := modules.NewSiaPath(sp)
+		var entry *filesystem.FileNode
+		if err == nil {
+			entry, err = r.staticFileSystem.OpenSiaFile(siaPath)
+		}
+		if err != nil {
+			r.log.Printf("Dropping active upload %v: %v", sp, err)
+			r.managedRemoveActiveUpload(sp)
+			continue
+		}
+		// Push the chunks directly instead of using callBuildAndPushChunks
+		// since the directory heap might not be initialized yet.
+		chunks := r.managedBuildUnfinishedChunks(entry, hosts, targetUnstuckChunks, offline, goodForRenew, ranking)
+		entry.Close()
+		for _, chunk := range chunks {
+			if !r.uploadHeap.managedPush(chunk) {
+				chunk.fileEntry.Close()
+			}
+		}
+	}
+	select {
+	case r.uploadHeap.newUploads <- struct{}{}:
+	default:
+	}
+}
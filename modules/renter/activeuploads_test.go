@@ -0,0 +1,114 @@
+package renter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestActiveUploads tests that active uploads are persisted across restarts
+// and that canceled uploads, renamed files and deleted files are tracked
+// correctly.
+func TestActiveUploads(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Upload two files. They should be tracked as active uploads.
+	var siaPaths []modules.SiaPath
+	for i := 0; i < 2; i++ {
+		source := filepath.Join(rt.dir, fmt.Sprintf("file%v", i))
+		if err := ioutil.WriteFile(source, fastrand.Bytes(100), 0600); err != nil {
+			t.Fatal(err)
+		}
+		siaPath, err := modules.NewSiaPath(fmt.Sprintf("file%v", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rt.renter.Upload(modules.FileUploadParams{Source: source, SiaPath: siaPath}); err != nil {
+			t.Fatal(err)
+		}
+		siaPaths = append(siaPaths, siaPath)
+	}
+	checkActiveUploads := func(expected ...modules.SiaPath) {
+		t.Helper()
+		active := rt.renter.managedActiveUploads()
+		sort.Strings(active)
+		expected = append([]modules.SiaPath{}, expected...)
+		sort.Slice(expected, func(i, j int) bool {
+			return expected[i].String() < expected[j].String()
+		})
+		if len(active) != len(expected) {
+			t.Fatalf("expected %v active uploads but got %v", len(expected), len(active))
+		}
+		for i, siaPath := range expected {
+			if active[i] != siaPath.String() {
+				t.Fatalf("expected active upload %v but got %v", siaPath, active[i])
+			}
+		}
+	}
+	checkActiveUploads(siaPaths...)
+
+	// Renaming a file should update its active upload.
+	renamed, err := modules.NewSiaPath("dir/renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RenameFile(siaPaths[1], renamed); err != nil {
+		t.Fatal(err)
+	}
+	siaPaths[1] = renamed
+	checkActiveUploads(siaPaths...)
+
+	// restart restarts the renter.
+	restart := func() {
+		t.Helper()
+		if err := rt.renter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		rt.renter, err = newRenterWithDependency(rt.gateway, rt.cs, rt.wallet, rt.tpool, filepath.Join(rt.dir, modules.RenterDir), &dependencies.DependencyDisableRepairAndHealthLoops{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The active uploads should survive a restart.
+	restart()
+	checkActiveUploads(siaPaths...)
+
+	// Canceling an upload should stop tracking it.
+	if err := rt.renter.CancelUpload(siaPaths[0], false); err != nil {
+		t.Fatal(err)
+	}
+	checkActiveUploads(siaPaths[1])
+
+	// Deleting the directory of the other file should stop tracking it as
+	// well.
+	if err := rt.renter.DeleteDir(modules.SiaPath{Path: "dir"}); err != nil {
+		t.Fatal(err)
+	}
+	checkActiveUploads()
+	restart()
+	checkActiveUploads()
+
+	// The number of active uploads is limited.
+	for i := 0; i < maxActiveUploads+1; i++ {
+		rt.renter.managedAddActiveUpload(modules.RandomSiaPath())
+	}
+	if n := len(rt.renter.managedActiveUploads()); n != maxActiveUploads {
+		t.Fatalf("expected %v active uploads but got %v", maxActiveUploads, n)
+	}
+}
@@ -0,0 +1,128 @@
+package renter
+
+import (
+	"container/heap"
+	"context"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+type (
+	// bubbleQueueItem is a directory waiting in the bubble queue. The
+	// priority of the item is the time it was queued at minus
+	// bubbleQueueDepthDelay for every level of its depth.
+	bubbleQueueItem struct {
+		siaPath  modules.SiaPath
+		priority time.Time
+	}
+
+	// bubbleQueueHeap is a min-heap of the directories in the bubble queue
+	// ordered by their priority.
+	bubbleQueueHeap []bubbleQueueItem
+)
+
+func (bqh bubbleQueueHeap) Len() int { return len(bqh) }
+func (bqh bubbleQueueHeap) Less(i, j int) bool {
+	if bqh[i].priority.Equal(bqh[j].priority) {
+		return bqh[i].siaPath.String() < bqh[j].siaPath.String()
+	}
+	return bqh[i].priority.Before(bqh[j].priority)
+}
+func (bqh bubbleQueueHeap) Swap(i, j int)       { bqh[i], bqh[j] = bqh[j], bqh[i] }
+func (bqh *bubbleQueueHeap) Push(x interface{}) { *bqh = append(*bqh, x.(bubbleQueueItem)) }
+func (bqh *bubbleQueueHeap) Pop() interface{} {
+	old := *bqh
+	n := len(old)
+	x := old[n-1]
+	*bqh = old[:n-1]
+	return x
+}
+
+// managedQueueBubble adds a directory to the bubble queue and wakes up a bubble
+// worker. A directory which is already queued is only queued once.
+func (r *Renter) managedQueueBubble(siaPath modules.SiaPath) {
+	r.bubbleUpdatesMu.Lock()
+	r.queueBubble(siaPath, time.Now())
+	r.bubbleUpdatesMu.Unlock()
+	r.signalBubbleWorkers()
+}
+
+// queueBubble adds a directory which was queued at queuedAt to the bubble
+// queue unless it is already queued. The caller needs to hold the
+// bubbleUpdatesMu.
+//
+// The queue prefers deeper directories. That way the children of a directory
+// are usually picked up before the directory itself, so the bubbles the
+// children queue for their parent collapse into a single one. Since the
+// preference is bounded to bubbleQueueDepthDelay per level, shallow
+// directories like the root can't be starved by a constant stream of bubbles
+// of deeper directories.
+func (r *Renter) queueBubble(siaPath modules.SiaPath, queuedAt time.Time) {
+	siaPathStr := siaPath.String()
+	if _, queued := r.bubbleQueue[siaPathStr]; queued {
+		return
+	}
+	depth := 0
+	if !siaPath.IsRoot() {
+		depth = strings.Count(siaPathStr, "/") + 1
+	}
+	r.bubbleQueue[siaPathStr] = siaPath
+	heap.Push(&r.bubbleQueueHeap, bubbleQueueItem{
+		siaPath:  siaPath,
+		priority: queuedAt.Add(-time.Duration(depth) * bubbleQueueDepthDelay),
+	})
+}
+
+// signalBubbleWorkers wakes up a bubble worker without blocking.
+func (r *Renter) signalBubbleWorkers() {
+	select {
+	case r.bubbleQueueChan <- struct{}{}:
+	default:
+	}
+}
+
+// managedNextQueuedBubble removes the directory with the highest priority from
+// the bubble queue and returns it.
+func (r *Renter) managedNextQueuedBubble() (modules.SiaPath, bool) {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	if r.bubbleQueueHeap.Len() == 0 {
+		return modules.SiaPath{}, false
+	}
+	next := heap.Pop(&r.bubbleQueueHeap).(bubbleQueueItem)
+	delete(r.bubbleQueue, next.siaPath.String())
+	return next.siaPath, true
+}
+
+// threadedBubbleWorker bubbles the directories of the bubble queue until the
+// renter is stopped. The renter runs numBubbleWorkers of these workers which
+// bounds the number of concurrent bubbles.
+func (r *Renter) threadedBubbleWorker() {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+	for {
+		siaPath, exists := r.managedNextQueuedBubble()
+		if !exists {
+			select {
+			case <-r.tg.StopChan():
+				return
+			case <-r.bubbleQueueChan:
+			}
+			continue
+		}
+		// Wake up another worker in case there is more work in the queue.
+		r.signalBubbleWorkers()
+		// Skip directories which didn't change since their last bubble. Their
+		// metadata is up-to-date and so is the metadata of their parents.
+		if r.managedBubbleUnchanged(siaPath) {
+			continue
+		}
+		if err := r.managedBubbleMetadata(context.Background(), siaPath); err != nil {
+			r.log.Debugln("WARN: error with bubbling metadata:", err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package renter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestNextQueuedBubble verifies that the bubble queue returns the deepest
+// directories first and that every directory is only queued once.
+func TestNextQueuedBubble(t *testing.T) {
+	r := &Renter{
+		bubbleQueue:     make(map[string]modules.SiaPath),
+		bubbleQueueChan: make(chan struct{}, 1),
+	}
+	siaPath := func(s string) modules.SiaPath {
+		sp, err := modules.NewSiaPath(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sp
+	}
+	queued := []modules.SiaPath{
+		modules.RootSiaPath(),
+		siaPath("a"),
+		siaPath("b/c"),
+		siaPath("a/b/c"),
+		siaPath("a/b"),
+		siaPath("a/b"),
+		siaPath("a/c"),
+	}
+	// Queue all directories at the same time so that the order doesn't
+	// depend on the time between the calls.
+	now := time.Now()
+	for _, sp := range queued {
+		r.queueBubble(sp, now)
+	}
+	expected := []modules.SiaPath{
+		siaPath("a/b/c"),
+		siaPath("a/b"),
+		siaPath("a/c"),
+		siaPath("b/c"),
+		siaPath("a"),
+		modules.RootSiaPath(),
+	}
+	for _, sp := range expected {
+		next, exists := r.managedNextQueuedBubble()
+		if !exists {
+			t.Fatal("queue is empty")
+		}
+		if !next.Equals(sp) {
+			t.Fatalf("expected %v but got %v", sp, next)
+		}
+	}
+	if next, exists := r.managedNextQueuedBubble(); exists {
+		t.Fatal("queue should be empty but returned", next)
+	}
+}
+
+// TestNextQueuedBubbleStarvation verifies that a directory which has been
+// waiting in the bubble queue for long enough is returned before deeper
+// directories which were queued later.
+func TestNextQueuedBubbleStarvation(t *testing.T) {
+	r := &Renter{
+		bubbleQueue:     make(map[string]modules.SiaPath),
+		bubbleQueueChan: make(chan struct{}, 1),
+	}
+	deep, err := modules.NewSiaPath("a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.queueBubble(modules.RootSiaPath(), now.Add(-3*bubbleQueueDepthDelay))
+	r.queueBubble(deep, now)
+	next, exists := r.managedNextQueuedBubble()
+	if !exists || !next.IsRoot() {
+		t.Fatal("expected the root to be returned first but got", next, exists)
+	}
+	next, exists = r.managedNextQueuedBubble()
+	if !exists || !next.Equals(deep) {
+		t.Fatal("expected the deep directory but got", next, exists)
+	}
+}
+
+// TestBubbleQueueReachesRoot verifies that a queued bubble of a nested
+// directory is propagated to the root by the bubble workers.
+func TestBubbleQueueReachesRoot(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a few files in nested directories.
+	var dirs []modules.SiaPath
+	for _, dir := range []string{"a/b/c", "a/b/d", "a/e"} {
+		dirSiaPath, err := modules.NewSiaPath(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		siaPath, err := dirSiaPath.Join("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsc, _ := siafile.NewRSCode(1, 1)
+		err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, dirSiaPath)
+	}
+
+	// Queue bubbles for the directories of the files. The root should
+	// eventually contain all of them.
+	for _, dir := range dirs {
+		rt.renter.callThreadedBubbleMetadata(dir)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		md, err := rt.renter.managedDirectoryMetadata(modules.RootSiaPath())
+		if err != nil {
+			return err
+		}
+		if md.AggregateNumFiles != uint64(len(dirs)) {
+			return fmt.Errorf("expected %v files but got %v", len(dirs), md.AggregateNumFiles)
+		}
+		if stats := rt.renter.BubbleQueueStats(); stats.Queued != 0 {
+			return fmt.Errorf("queue should be empty: %v", stats)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
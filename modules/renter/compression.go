@@ -0,0 +1,278 @@
+package renter
+
+// compression.go implements the optional compression of uploads. The source of
+// a compressed upload is compressed into a staging file within the renter's
+// persist dir before it is erasure coded, which means that all chunk math
+// operates on the compressed data. The source stays the local copy of the
+// SiaFile while the staging file is only used to upload the chunks and is
+// removed once the file is fully uploaded. Repairs of compressed files after
+// that download the data from the hosts. Downloads of compressed files fetch
+// the compressed data from the start of the file and decompress it on the
+// fly until the requested range was written.
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+)
+
+const (
+	// compressedUploadsDir is the directory within the renter's persist dir
+	// which contains the compressed copies of uploads.
+	compressedUploadsDir = "compressed"
+)
+
+var (
+	// ErrUnknownCompression is returned if an upload specifies a compression
+	// codec which isn't supported by the renter.
+	ErrUnknownCompression = errors.New("unknown compression codec")
+
+	// errCompressedStream is returned when trying to stream a compressed
+	// file. Compressed files can't be accessed at arbitrary offsets.
+	errCompressedStream = errors.New("compressed files can't be streamed")
+
+	// errCompressedReEncode is returned when trying to re-encode a compressed
+	// file.
+	errCompressedReEncode = errors.New("compressed files can't be re-encoded")
+)
+
+// validateCompression checks that the renter supports the codec.
+func validateCompression(codec modules.CompressionCodec) error {
+	switch codec {
+	case modules.CompressionNone, modules.CompressionGzip:
+		return nil
+	default:
+		return errors.AddContext(ErrUnknownCompression, fmt.Sprintf("'%v'", codec))
+	}
+}
+
+// newCompressor returns a writer which compresses the data written to it
+// using codec and writes the result to w. The writer needs to be closed to
+// flush the compressed data.
+func newCompressor(codec modules.CompressionCodec, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case modules.CompressionGzip:
+		return gzip.NewWriter(w), nil
+	default:
+		return nil, validateCompression(codec)
+	}
+}
+
+// newDecompressor returns a reader which decompresses the data read from r
+// using codec.
+func newDecompressor(codec modules.CompressionCodec, r io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case modules.CompressionGzip:
+		return gzip.NewReader(r)
+	default:
+		return nil, validateCompression(codec)
+	}
+}
+
+// compressedUploadPath returns the path of the staging file of a compressed
+// upload.
+func (r *Renter) compressedUploadPath(uid siafile.SiafileUID, codec modules.CompressionCodec) string {
+	return filepath.Join(r.persistDir, compressedUploadsDir, string(uid)+"."+string(codec))
+}
+
+// chunkDataPath returns the path of the file the erasure coded chunks of sf
+// can be read from. For compressed files this is the staging file of the
+// upload since the local copy isn't compressed.
+func (r *Renter) chunkDataPath(sf interface {
+	Compression() modules.CompressionCodec
+	LocalPath() string
+	UID() siafile.SiafileUID
+}) string {
+	if sf.Compression() == modules.CompressionNone {
+		return sf.LocalPath()
+	}
+	return r.compressedUploadPath(sf.UID(), sf.Compression())
+}
+
+// managedRemoveCompressedUpload removes the staging file of a compressed
+// upload once the file is fully uploaded. It is called whenever a chunk of
+// the file finished uploading.
+func (r *Renter) managedRemoveCompressedUpload(entry *filesystem.FileNode) {
+	codec := entry.Compression()
+	if codec == modules.CompressionNone {
+		return
+	}
+	path := r.compressedUploadPath(entry.UID(), codec)
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	if !entry.Deleted() {
+		progress, _, err := entry.UploadProgressAndBytes()
+		if err != nil {
+			r.log.Debugln("WARN: failed to get upload progress:", err)
+			return
+		}
+		if progress < 100 {
+			return
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		r.log.Println("WARN: failed to remove compressed copy of uploaded file:", err)
+	}
+}
+
+// countingWriter is an io.Writer which discards the data written to it and
+// only counts its length.
+type countingWriter struct {
+	n uint64
+}
+
+// Write implements io.Writer.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += uint64(len(p))
+	return len(p), nil
+}
+
+// compressedSize returns the size of the file at source after compressing it
+// using codec without writing the compressed data to disk.
+func compressedSize(source string, codec modules.CompressionCodec) (uint64, error) {
+	src, err := os.Open(source)
+	if err != nil {
+		return 0, errors.AddContext(err, "unable to open source file")
+	}
+	defer src.Close()
+	var cw countingWriter
+	w, err := newCompressor(codec, &cw)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return 0, errors.Compose(errors.AddContext(err, "unable to compress source file"), w.Close())
+	}
+	if err := w.Close(); err != nil {
+		return 0, errors.AddContext(err, "unable to compress source file")
+	}
+	return cw.n, nil
+}
+
+// managedCompressUploadSource compresses the file at source using codec into
+// a temporary file and returns the path and size of the compressed copy. The
+// caller is responsible for moving the copy to its compressedUploadPath or
+// removing it.
+func (r *Renter) managedCompressUploadSource(source string, codec modules.CompressionCodec) (_ string, _ uint64, err error) {
+	dir := filepath.Join(r.persistDir, compressedUploadsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, errors.AddContext(err, "unable to create directory for compressed uploads")
+	}
+	src, err := os.Open(source)
+	if err != nil {
+		return "", 0, errors.AddContext(err, "unable to open source file")
+	}
+	defer src.Close()
+	dst, err := ioutil.TempFile(dir, "*."+string(codec))
+	if err != nil {
+		return "", 0, errors.AddContext(err, "unable to create compressed file")
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Compose(err, os.Remove(dst.Name()))
+		}
+	}()
+
+	w, err := newCompressor(codec, dst)
+	if err != nil {
+		return "", 0, errors.Compose(err, dst.Close())
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return "", 0, errors.Compose(errors.AddContext(err, "unable to compress source file"), w.Close(), dst.Close())
+	}
+	if err := w.Close(); err != nil {
+		return "", 0, errors.Compose(errors.AddContext(err, "unable to compress source file"), dst.Close())
+	}
+	if err := dst.Sync(); err != nil {
+		return "", 0, errors.Compose(err, dst.Close())
+	}
+	fi, err := dst.Stat()
+	if err != nil {
+		return "", 0, errors.Compose(err, dst.Close())
+	}
+	if err := dst.Close(); err != nil {
+		return "", 0, err
+	}
+	return dst.Name(), uint64(fi.Size()), nil
+}
+
+// downloadDestinationDecompressor is a downloadDestination which expects the
+// compressed data of a file in order, starting at the beginning of the file.
+// It decompresses the data and writes the requested range of the decompressed
+// data to the underlying writer. Once the range was written, the download is
+// finished without fetching the remaining chunks.
+type downloadDestinationDecompressor struct {
+	*downloadDestinationWriter
+
+	closer io.Closer // optional, closed after decompressing
+	done   chan struct{}
+	err    error
+	pw     *io.PipeWriter
+
+	// finish is called once the requested range was written. It needs to be
+	// set before the download is started.
+	finish func()
+}
+
+// newDownloadDestinationDecompressor creates a downloadDestination which
+// decompresses the data written to it using codec and writes length bytes
+// starting at offset of the decompressed data to w. If closer is not nil, it is
+// closed together with the destination.
+func newDownloadDestinationDecompressor(codec modules.CompressionCodec, w io.Writer, closer io.Closer, offset, length uint64) *downloadDestinationDecompressor {
+	pr, pw := io.Pipe()
+	ddd := &downloadDestinationDecompressor{
+		downloadDestinationWriter: newDownloadDestinationWriter(pw),
+
+		closer: closer,
+		done:   make(chan struct{}),
+		pw:     pw,
+	}
+	go func() {
+		ddd.err = decompressRange(codec, pr, w, offset, length)
+		close(ddd.done)
+		// Finish the download asynchronously since finishing it closes the
+		// destination which waits for pending writes.
+		if ddd.err == nil && ddd.finish != nil {
+			go ddd.finish()
+		}
+		// Drain the remaining data to not block the download.
+		_, _ = io.Copy(ioutil.Discard, pr)
+	}()
+	return ddd
+}
+
+// decompressRange decompresses the data read from r using codec and writes
+// length bytes starting at offset of the decompressed data to w.
+func decompressRange(codec modules.CompressionCodec, r io.Reader, w io.Writer, offset, length uint64) error {
+	dr, err := newDecompressor(codec, r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	if _, err := io.CopyN(ioutil.Discard, dr, int64(offset)); err != nil {
+		return errors.AddContext(err, "unable to skip to offset")
+	}
+	_, err = io.CopyN(w, dr, int64(length))
+	return err
+}
+
+// Close closes the destination and waits for the decompression to finish.
+func (ddd *downloadDestinationDecompressor) Close() error {
+	err := errors.Compose(ddd.downloadDestinationWriter.Close(), ddd.pw.Close())
+	<-ddd.done
+	err = errors.Compose(err, errors.AddContext(ddd.err, "failed to decompress download"))
+	if ddd.closer != nil {
+		err = errors.Compose(err, ddd.closer.Close())
+	}
+	return err
+}
@@ -0,0 +1,281 @@
+package renter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+)
+
+// compressibleData returns n bytes of data which compresses well.
+func compressibleData(n int) []byte {
+	return bytes.Repeat([]byte("some log line that repeats\n"), n/27+1)[:n]
+}
+
+// TestDownloadDestinationDecompressor tests that the decompressing download
+// destination writes the requested range of the decompressed data even if the
+// chunks are written out of order.
+func TestDownloadDestinationDecompressor(t *testing.T) {
+	data := append(compressibleData(10000), fastrand.Bytes(100)...)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	// Flush the start of the data to be able to decompress it from the first
+	// chunk alone.
+	if _, err := w.Write(data[:100]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data[100:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	compressed := buf.Bytes()
+
+	// Split the compressed data into 2 chunks.
+	rsc, _ := siafile.NewRSCode(1, 1)
+	half := len(compressed) / 2
+	chunks := [][]byte{
+		append([]byte(nil), compressed[:half]...),
+		append([]byte(nil), compressed[half:]...),
+	}
+	pieces := make([][][]byte, len(chunks))
+	for i, chunk := range chunks {
+		var err error
+		pieces[i], err = rsc.Encode(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	offset, length := uint64(5000), uint64(5050)
+	var out bytes.Buffer
+	ddd := newDownloadDestinationDecompressor(modules.CompressionGzip, &out, nil, offset, length)
+
+	// Write the second chunk first.
+	errChan := make(chan error)
+	go func() {
+		errChan <- ddd.WritePieces(rsc, pieces[1], 0, int64(half), uint64(len(chunks[1])))
+	}()
+	if err := ddd.WritePieces(rsc, pieces[0], 0, 0, uint64(len(chunks[0]))); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	if err := ddd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data[offset:offset+length]) {
+		t.Fatal("decompressed data doesn't match")
+	}
+
+	// A range at the start of the file should finish the download after the
+	// first chunk.
+	out.Reset()
+	finished := make(chan struct{})
+	ddd = newDownloadDestinationDecompressor(modules.CompressionGzip, &out, nil, 0, 10)
+	ddd.finish = func() { close(finished) }
+	if err := ddd.WritePieces(rsc, pieces[0], 0, 0, uint64(len(chunks[0]))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("download wasn't finished")
+	}
+	if err := ddd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data[:10]) {
+		t.Fatal("decompressed data doesn't match")
+	}
+
+	// Writing invalid data should result in an error on close.
+	ddd = newDownloadDestinationDecompressor(modules.CompressionGzip, ioutil.Discard, nil, 0, 100)
+	invalid, err := rsc.Encode(fastrand.Bytes(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ddd.WritePieces(rsc, invalid, 0, 0, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := ddd.Close(); err == nil {
+		t.Fatal("expected decompression to fail")
+	}
+}
+
+// TestRenterUploadCompression tests uploading compressed files.
+func TestRenterUploadCompression(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a local file.
+	fileSize := 10000
+	source := filepath.Join(rt.dir, "file.log")
+	if err := ioutil.WriteFile(source, compressibleData(fileSize), 0600); err != nil {
+		t.Fatal(err)
+	}
+	params := modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     modules.RandomSiaPath(),
+		Compression: "unknown",
+	}
+
+	// Unknown codecs should be rejected.
+	if _, err := r.Upload(params); !errors.Contains(err, ErrUnknownCompression) {
+		t.Fatal("expected ErrUnknownCompression but got", err)
+	}
+
+	// A dry run shouldn't leave a compressed copy behind.
+	params.Compression = modules.CompressionGzip
+	params.DryRun = true
+	if _, err := r.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+	compressedDir := filepath.Join(r.persistDir, compressedUploadsDir)
+	if fis, err := ioutil.ReadDir(compressedDir); (err != nil && !os.IsNotExist(err)) || len(fis) != 0 {
+		t.Fatal("expected no compressed files", len(fis), err)
+	}
+
+	// Upload the file.
+	params.DryRun = false
+	if _, err := r.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := r.File(params.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Compression != modules.CompressionGzip {
+		t.Fatal("wrong compression", fi.Compression)
+	}
+	if fi.Filesize != uint64(fileSize) {
+		t.Fatal("wrong file size", fi.Filesize)
+	}
+	if fi.StoredSize == 0 || fi.StoredSize >= fi.Filesize {
+		t.Fatal("file wasn't compressed", fi.StoredSize)
+	}
+	if fi.LocalPath != source {
+		t.Fatal("source isn't the local path of the file", fi.LocalPath)
+	}
+
+	// The staging file should contain the compressed data.
+	entry, err := r.staticFileSystem.OpenSiaFile(params.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedPath := r.compressedUploadPath(entry.UID(), modules.CompressionGzip)
+	if err := entry.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := ioutil.ReadAll(gr)
+	if err := errors.Compose(err, f.Close()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, compressibleData(fileSize)) {
+		t.Fatal("compressed copy doesn't match source")
+	}
+
+	// Compressed files can't be streamed.
+	if _, _, err := r.Streamer(params.SiaPath, false); !errors.Contains(err, errCompressedStream) {
+		t.Fatal("expected errCompressedStream but got", err)
+	}
+
+	// Deleting the file removes the staging file but not the source.
+	if err := r.DeleteFile(params.SiaPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(compressedPath); !os.IsNotExist(err) {
+		t.Fatal("compressed copy wasn't removed", err)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Fatal("source was removed", err)
+	}
+
+	// A failed upload shouldn't leave a compressed copy behind either.
+	params.SiaPath = modules.RandomSiaPath()
+	if err := r.CreateDir(params.SiaPath, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Upload(params); err == nil {
+		t.Fatal("expected upload to a dir's siapath to fail")
+	}
+	if fis, err := ioutil.ReadDir(compressedDir); err != nil || len(fis) != 0 {
+		t.Fatal("expected no compressed files", len(fis), err)
+	}
+
+	// Removing a failed upload deletes the siafile and its staging file
+	// without moving it to the trash. Afterwards the upload can be retried.
+	params.SiaPath = modules.RandomSiaPath()
+	if _, err := r.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+	entry, err = r.staticFileSystem.OpenSiaFile(params.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedRemoveFailedUpload(params.SiaPath, entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.File(params.SiaPath); err == nil {
+		t.Fatal("siafile of failed upload wasn't removed")
+	}
+	if fis, err := ioutil.ReadDir(compressedDir); err != nil || len(fis) != 0 {
+		t.Fatal("expected no compressed files", len(fis), err)
+	}
+	if _, err := r.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+
+	// If compressing the source fails, a forced upload shouldn't delete the
+	// existing file. Replace the directory of the compressed copies with a
+	// file to make the compression fail.
+	if err := os.Rename(compressedDir, compressedDir+"_moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(compressedDir, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	params.Force = true
+	if _, err := r.Upload(params); err == nil {
+		t.Fatal("expected compression to fail")
+	}
+	if _, err := r.File(params.SiaPath); err != nil {
+		t.Fatal("existing file was deleted by failed upload", err)
+	}
+	if err := os.Remove(compressedDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(compressedDir+"_moved", compressedDir); err != nil {
+		t.Fatal(err)
+	}
+}
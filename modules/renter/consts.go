@@ -23,6 +23,19 @@ const (
 	AlertSiafileLowRedundancyThreshold = 0.75
 )
 
+const (
+	// AlertMSGSiafileUploadDeadline indicates that a file missed its upload
+	// deadline.
+	AlertMSGSiafileUploadDeadline = "The SiaFile mentioned in the 'Cause' didn't reach its target redundancy before its upload deadline"
+)
+
+// AlertCauseSiafileUploadDeadline creates a customized "cause" for a siafile
+// with a certain path which missed its upload deadline.
+func AlertCauseSiafileUploadDeadline(siaPath modules.SiaPath, deadline time.Time, redundancy, targetRedundancy float64) string {
+	siaPath, _ = siaPath.Rebase(modules.UserSiaPath(), modules.RootSiaPath())
+	return fmt.Sprintf("Siafile '%v' has a redundancy of %v instead of %v after its deadline %v", siaPath.String(), redundancy, targetRedundancy, deadline.Format(time.RFC3339))
+}
+
 // AlertCauseSiafileLowRedundancy creates a customized "cause" for a siafile
 // with a certain path and health.
 func AlertCauseSiafileLowRedundancy(siaPath modules.SiaPath, health float64) string {
@@ -30,6 +43,33 @@ func AlertCauseSiafileLowRedundancy(siaPath modules.SiaPath, health float64) str
 	return fmt.Sprintf("Siafile '%v' has a health of %v", siaPath.String(), health)
 }
 
+// healthEventBufferSize is the number of HealthEvents buffered for every
+// subscriber before new events are dropped.
+const healthEventBufferSize = 100
+
+// Limits on the siapaths of uploads. They keep the on-disk paths of the
+// siafiles within the limits of common filesystems.
+const (
+	// maxSiaPathDepth is the maximum number of directories a siafile can be
+	// nested in.
+	maxSiaPathDepth = 128
+
+	// maxSiaPathElementLength is the maximum length of a single element of a
+	// siapath on disk, including the siafile extension. It matches NAME_MAX
+	// on most filesystems.
+	maxSiaPathElementLength = 255
+
+	// maxSiaFileSysPathLength is the maximum length of the absolute on-disk
+	// path of a siafile. It matches PATH_MAX on Linux.
+	maxSiaFileSysPathLength = 4096
+
+	// maxFileTags is the maximum number of tags a file can have and
+	// maxFileTagLength is the maximum length of the key and value of a tag.
+	// Tags are stored in the siafile's metadata, so they need to be bounded.
+	maxFileTags      = 64
+	maxFileTagLength = 256
+)
+
 // Default redundancy parameters.
 var (
 	// DefaultDataPieces is the number of data pieces per erasure-coded chunk
@@ -55,6 +95,18 @@ var (
 		Standard: 0.25,
 		Testing:  0.25,
 	}).(float64)
+
+	// MinRepairThreshold and MaxRepairThreshold are the bounds of the repair
+	// threshold which can be set using SetRepairThreshold. Lower thresholds
+	// would cause repairs for every lost piece and higher thresholds would
+	// let files drift too close to being unrecoverable.
+	MinRepairThreshold = 0.05
+	MaxRepairThreshold = 0.75
+
+	// ColdRepairThreshold is the repair threshold of cold files. It is higher
+	// than MaxRepairThreshold to let archival files degrade further than
+	// regular files before spending bandwidth on their repair.
+	ColdRepairThreshold = 0.9
 )
 
 // Default memory usage parameters.
@@ -142,9 +194,138 @@ const (
 	// maxStuckChunksInHeap is the maximum number of stuck chunks that the stuck
 	// loop will try to keep in the uploadHeap
 	maxStuckChunksInHeap = 25
+
+	// defaultSafeRedundancy is the redundancy a file needs to reach before its
+	// local source is considered safe to delete if the user didn't set one.
+	defaultSafeRedundancy = 2.0
+
+	// maxHostThroughputSamples is the maximum number of recent uploads a worker
+	// keeps to measure the throughput of its host.
+	maxHostThroughputSamples = 100
+
+	// repairHostDiversity is the factor by which the number of hosts a repair
+	// chunk may use needs to exceed its missing pieces before slow hosts are
+	// removed from it. It prevents all the repairs from ending up on the few
+	// fastest hosts.
+	repairHostDiversity = 2
+
+	// slowHostThroughputRatio is the fraction of the median host throughput
+	// below which a host is considered slow for repairs.
+	slowHostThroughputRatio = 0.5
+
+	// maxBubbleErrors is the maximum number of directories for which the
+	// error of their last failed bubble is remembered.
+	maxBubbleErrors = 1000
+
+	// maxBubbleFileWorkers is the maximum number of threads that can be used
+	// to calculate the metadata of the siafiles within a directory during a
+	// bubble.
+	maxBubbleFileWorkers = 256
 )
 
 var (
+	// bubbleDebounceInterval is the minimum amount of time that needs to pass
+	// between two asynchronous bubbles of the same directory. Bubble requests
+	// that arrive within that window are coalesced into a single bubble which
+	// is executed once the window has passed.
+	bubbleDebounceInterval = build.Select(build.Var{
+		Dev:      time.Second,
+		Standard: 5 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// bubbleLastRunRetention is the amount of time the last bubble of a
+	// directory is remembered. Directories which weren't bubbled for that long
+	// are always recalculated by their next bubble.
+	bubbleLastRunRetention = build.Select(build.Var{
+		Dev:      10 * time.Minute,
+		Standard: time.Hour,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
+	// bubbleBackoffBase and bubbleBackoffMax are the bounds of the backoff
+	// applied to asynchronous bubbles of a directory whose previous bubbles
+	// failed. The backoff doubles with every consecutive failure.
+	bubbleBackoffBase = build.Select(build.Var{
+		Dev:      time.Second,
+		Standard: 5 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+	bubbleBackoffMax = build.Select(build.Var{
+		Dev:      5 * time.Minute,
+		Standard: time.Hour,
+		Testing:  3 * time.Second,
+	}).(time.Duration)
+
+	// bubbleModTimeResolution is the amount of time that needs to pass after
+	// a modification of a directory before the modification time can be used
+	// to skip bubbles. Filesystems don't update modification times with full
+	// precision which means that a modification right after a bubble might
+	// not result in a different modification time.
+	bubbleModTimeResolution = time.Second
+
+	// defaultRepairSignalThrottleInterval is the minimum amount of time that
+	// needs to pass between two repairNeeded or stuckChunkFound signals sent
+	// by bubbles of the root directory if no other interval was set with
+	// SetRepairSignalThrottleInterval. This prevents the repair and stuck
+	// loops from being woken up continuously while many directories are
+	// marginally unhealthy.
+	defaultRepairSignalThrottleInterval = build.Select(build.Var{
+		Dev:      5 * time.Second,
+		Standard: time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// maxActiveUploads is the maximum number of active uploads which are
+	// persisted to be requeued on startup.
+	maxActiveUploads = build.Select(build.Var{
+		Dev:      1000,
+		Standard: 10000,
+		Testing:  10,
+	}).(int)
+
+	// activeUploadsPersistInterval is the interval at which changes to the
+	// active uploads are saved.
+	activeUploadsPersistInterval = build.Select(build.Var{
+		Dev:      10 * time.Second,
+		Standard: time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// maxDedupChunks is the maximum number of chunks in the dedup index.
+	// Once the index is full, the oldest chunks are evicted.
+	maxDedupChunks = build.Select(build.Var{
+		Dev:      1000,
+		Standard: 100000,
+		Testing:  10,
+	}).(int)
+
+	// bubbleQueueDepthDelay is the amount of time a directory in the bubble
+	// queue is preferred over a directory which is one level less deep. It
+	// bounds how long deeper directories can delay the bubble of the root.
+	bubbleQueueDepthDelay = build.Select(build.Var{
+		Dev:      time.Second,
+		Standard: 5 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// numBubbleWorkers is the number of threads that bubble the directories
+	// of the bubble queue.
+	numBubbleWorkers = build.Select(build.Var{
+		Dev:      4,
+		Standard: 8,
+		Testing:  4,
+	}).(int)
+
+	// defaultBubbleFileWorkers is the number of threads that are used to
+	// calculate the metadata of the siafiles within a directory during a
+	// bubble if no other number was set with SetBubbleFileWorkers.
+	defaultBubbleFileWorkers = build.Select(build.Var{
+		Dev:      4,
+		Standard: 8,
+		Testing:  4,
+	}).(int)
+
 	// healthCheckInterval defines the maximum amount of time that should pass
 	// in between checking the health of a file or directory.
 	healthCheckInterval = build.Select(build.Var{
@@ -153,6 +334,87 @@ var (
 		Testing:  5 * time.Second,
 	}).(time.Duration)
 
+	// sizeRecalculationInterval is the amount of time between two full
+	// recalculations of the aggregate sizes of the directory tree.
+	sizeRecalculationInterval = build.Select(build.Var{
+		Dev:      1 * time.Hour,
+		Standard: 24 * time.Hour,
+		Testing:  1 * time.Minute,
+	}).(time.Duration)
+
+	// uploadDeadlineWindow is the amount of time before the upload deadline of
+	// a file at which the repair loop starts to prioritize the file's chunks.
+	uploadDeadlineWindow = build.Select(build.Var{
+		Dev:      10 * time.Minute,
+		Standard: 6 * time.Hour,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
+	// maxUploadRetryBackoff is the maximum amount of time a worker waits
+	// before retrying a failed piece upload on the same host. It caps the
+	// exponentially growing backoff of the upload retry policy.
+	maxUploadRetryBackoff = build.Select(build.Var{
+		Dev:      30 * time.Second,
+		Standard: 5 * time.Minute,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// hostThroughputWindow is the sliding window over which the upload
+	// throughput of a host is measured.
+	hostThroughputWindow = build.Select(build.Var{
+		Dev:      5 * time.Minute,
+		Standard: 30 * time.Minute,
+		Testing:  time.Minute,
+	}).(time.Duration)
+
+	// scrubCheckInterval is the amount of time between two walks of the
+	// directory tree looking for files which are due for a scrub.
+	scrubCheckInterval = build.Select(build.Var{
+		Dev:      1 * time.Minute,
+		Standard: 1 * time.Hour,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+
+	// repairBandwidthInterval is the interval the repair bandwidth limit set
+	// with SetRepairBandwidthLimit refers to.
+	repairBandwidthInterval = build.Select(build.Var{
+		Dev:      10 * time.Second,
+		Standard: time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
+	// uploadStallTimeout is the amount of time without progress after which
+	// an upload is considered to be stalled.
+	uploadStallTimeout = build.Select(build.Var{
+		Dev:      2 * time.Minute,
+		Standard: 10 * time.Minute,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+
+	// uploadSampleInterval is the minimum amount of time between two samples
+	// of the upload progress of a file which are taken for its upload rate.
+	uploadSampleInterval = build.Select(build.Var{
+		Dev:      time.Second,
+		Standard: 5 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// uploadRateExpiry is the amount of time without progress after which the
+	// upload rate of a file is removed.
+	uploadRateExpiry = build.Select(build.Var{
+		Dev:      10 * time.Minute,
+		Standard: time.Hour,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
+	// trashPurgeInterval is the amount of time between two checks for files
+	// which exceeded the trash retention.
+	trashPurgeInterval = build.Select(build.Var{
+		Dev:      10 * time.Minute,
+		Standard: 1 * time.Hour,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+
 	// healthLoopErrorSleepDuration indicates how long the health loop should
 	// sleep before retrying if there is an error preventing progress.
 	healthLoopErrorSleepDuration = build.Select(build.Var{
@@ -250,6 +512,14 @@ var (
 		Standard: 5 * time.Minute,
 		Testing:  5 * time.Second,
 	}).(time.Duration)
+
+	// reEncodeCheckInterval defines how often ReEncode checks whether the
+	// upload of the re-encoded file is done.
+	reEncodeCheckInterval = build.Select(build.Var{
+		Dev:      time.Second,
+		Standard: 10 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
 )
 
 // Constants that tune the worker swarm.
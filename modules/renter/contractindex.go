@@ -0,0 +1,124 @@
+package renter
+
+// contractindex.go implements the index of the files which store pieces on the
+// renter's contracts. The health of a file only changes if the utility of its
+// contracts changes, so the index allows the renter to bubble the directories
+// of the affected files as soon as a contract is archived or its GoodForRenew
+// utility flips instead of waiting for the next scheduled bubble.
+//
+// The index is keyed by the files and contains the public keys of the hosts
+// of their contracts since the siafiles reference their contracts by host
+// key. That way renaming a file only touches a single entry. It is not
+// persisted. Uploads and repairs add the hosts they upload pieces to and the
+// health loop adds all the hosts of the files it checks. Entries are removed
+// when a file is deleted and lazily when the index is used for files which
+// disappeared otherwise.
+
+import (
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// managedAddToContractIndex adds the provided hosts to the index entry of the
+// file at siaPath.
+func (r *Renter) managedAddToContractIndex(siaPath modules.SiaPath, hostKeys ...types.SiaPublicKey) {
+	r.contractIndexMu.Lock()
+	defer r.contractIndexMu.Unlock()
+	hosts, exists := r.contractIndex[siaPath]
+	if !exists {
+		hosts = make(map[string]struct{}, len(hostKeys))
+		r.contractIndex[siaPath] = hosts
+	}
+	for _, hpk := range hostKeys {
+		hosts[hpk.String()] = struct{}{}
+	}
+}
+
+// managedRenameInContractIndex updates the index after the file or directory
+// at oldPath was renamed to newPath.
+func (r *Renter) managedRenameInContractIndex(oldPath, newPath modules.SiaPath) {
+	r.contractIndexMu.Lock()
+	defer r.contractIndexMu.Unlock()
+
+	// If a file was renamed, only its entry needs to be moved.
+	if hosts, exists := r.contractIndex[oldPath]; exists {
+		delete(r.contractIndex, oldPath)
+		r.contractIndex[newPath] = hosts
+		return
+	}
+
+	// Otherwise move the entries of all the files within the directory.
+	oldPrefix := oldPath.String() + "/"
+	renamed := make(map[modules.SiaPath]map[string]struct{})
+	for siaPath, hosts := range r.contractIndex {
+		if !strings.HasPrefix(siaPath.String(), oldPrefix) {
+			continue
+		}
+		renamed[modules.SiaPath{Path: newPath.String() + "/" + strings.TrimPrefix(siaPath.String(), oldPrefix)}] = hosts
+		delete(r.contractIndex, siaPath)
+	}
+	for siaPath, hosts := range renamed {
+		r.contractIndex[siaPath] = hosts
+	}
+}
+
+// managedContractIndexFiles returns the files of the index which store pieces
+// on the contract with the provided host.
+func (r *Renter) managedContractIndexFiles(hostKey types.SiaPublicKey) []modules.SiaPath {
+	r.contractIndexMu.Lock()
+	defer r.contractIndexMu.Unlock()
+	var siaPaths []modules.SiaPath
+	for siaPath, hosts := range r.contractIndex {
+		if _, exists := hosts[hostKey.String()]; exists {
+			siaPaths = append(siaPaths, siaPath)
+		}
+	}
+	return siaPaths
+}
+
+// managedRemoveFromContractIndex removes a file from the index.
+func (r *Renter) managedRemoveFromContractIndex(siaPath modules.SiaPath) {
+	r.contractIndexMu.Lock()
+	defer r.contractIndexMu.Unlock()
+	delete(r.contractIndex, siaPath)
+}
+
+// callContractChanged is registered with the contractor and called whenever a
+// contract is archived or its GoodForRenew utility changes. The contractor
+// calls it synchronously, so the bubbles are triggered in a separate thread.
+func (r *Renter) callContractChanged(contract modules.RenterContract) {
+	go r.threadedBubbleContractFiles(contract.HostPublicKey)
+}
+
+// threadedBubbleContractFiles bubbles the directories of all the files which
+// store pieces on the contract with the provided host.
+func (r *Renter) threadedBubbleContractFiles(hostKey types.SiaPublicKey) {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+	dirs := make(map[modules.SiaPath]struct{})
+	for _, siaPath := range r.managedContractIndexFiles(hostKey) {
+		exists, err := r.staticFileSystem.FileExists(siaPath)
+		if err != nil {
+			r.log.Println("WARN: failed to check for indexed file:", err)
+			continue
+		}
+		if !exists {
+			r.managedRemoveFromContractIndex(siaPath)
+			continue
+		}
+		dirSiaPath, err := siaPath.Dir()
+		if err != nil {
+			r.log.Println("WARN: failed to get directory of indexed file:", err)
+			continue
+		}
+		dirs[dirSiaPath] = struct{}{}
+	}
+	for dirSiaPath := range dirs {
+		r.managedForgetBubbleRun(dirSiaPath)
+		go r.callThreadedBubbleMetadata(dirSiaPath)
+	}
+}
@@ -0,0 +1,107 @@
+package renter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestContractIndex tests that the contract index follows renames and that a
+// contract change bubbles the directories of the indexed files.
+func TestContractIndex(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file in a directory and index it.
+	dirSiaPath, err := modules.NewSiaPath("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err := dirSiaPath.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 0, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)}
+	r.managedAddToContractIndex(siaPath, hostKey)
+
+	// Renaming the directory updates the index.
+	newDirSiaPath, err := modules.NewSiaPath("newdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RenameDir(dirSiaPath, newDirSiaPath); err != nil {
+		t.Fatal(err)
+	}
+	newSiaPath, err := newDirSiaPath.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := r.managedContractIndexFiles(hostKey)
+	if len(files) != 1 || !files[0].Equals(newSiaPath) {
+		t.Fatal("index wasn't updated after renaming the directory", files)
+	}
+
+	// Renaming the file updates the index as well.
+	renamedSiaPath, err := newDirSiaPath.Join("renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RenameFile(newSiaPath, renamedSiaPath); err != nil {
+		t.Fatal(err)
+	}
+	files = r.managedContractIndexFiles(hostKey)
+	if len(files) != 1 || !files[0].Equals(renamedSiaPath) {
+		t.Fatal("index wasn't updated after renaming the file", files)
+	}
+	newSiaPath = renamedSiaPath
+
+	// A change of the contract bubbles the directory of the file.
+	r.bubbleUpdatesMu.Lock()
+	delete(r.bubbleLastRuns, newDirSiaPath.String())
+	r.bubbleUpdatesMu.Unlock()
+	r.callContractChanged(modules.RenterContract{HostPublicKey: hostKey})
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		r.bubbleUpdatesMu.Lock()
+		defer r.bubbleUpdatesMu.Unlock()
+		if _, bubbled := r.bubbleLastRuns[newDirSiaPath.String()]; !bubbled {
+			return fmt.Errorf("directory wasn't bubbled")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted files are removed from the index once the contract changes.
+	if err := r.managedDeleteFile(newSiaPath); err != nil {
+		t.Fatal(err)
+	}
+	r.threadedBubbleContractFiles(hostKey)
+	if files := r.managedContractIndexFiles(hostKey); len(files) != 0 {
+		t.Fatal("deleted file wasn't removed from the index", files)
+	}
+}
@@ -11,6 +11,7 @@ import (
 var (
 	errAllowanceNotSynced  = errors.New("you must be synced to set an allowance")
 	errAllowanceWindowSize = errors.New("renew window must be less than period")
+	errAllowanceJitterSize = errors.New("renew jitter must be less than half the renew window")
 
 	// ErrAllowanceZeroFunds is returned if the allowance funds are being set to
 	// zero when not cancelling the allowance
@@ -77,6 +78,8 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 		return ErrAllowanceZeroWindow
 	} else if a.RenewWindow >= a.Period {
 		return errAllowanceWindowSize
+	} else if a.RenewJitter > 0 && a.RenewJitter >= a.RenewWindow/2 {
+		return errAllowanceJitterSize
 	} else if a.ExpectedStorage == 0 {
 		return ErrAllowanceZeroExpectedStorage
 	} else if a.ExpectedUpload == 0 {
@@ -0,0 +1,228 @@
+package contractor
+
+import (
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// archive.go moves contracts which expired a long time ago from the in-memory
+// oldContracts map to an archive on disk. This keeps the memory usage of
+// long-running nodes bounded. Archived contracts are no longer returned by
+// OldContracts, and therefore no longer listed as expired contracts by the
+// API, but can still be looked up using OldContract and
+// HistoricContractsByHost. Their spending is still reported as previous
+// spending by PeriodSpending. The expired contracts of a host can be purged
+// from both memory and the archive once they are no longer needed.
+
+var (
+	// errZeroRetention is returned by SetOldContractRetention if the retention
+	// is 0 periods.
+	errZeroRetention = errors.New("old contracts need to be retained for at least one period")
+)
+
+// OldContract returns the expired contract with the given id. If the contract
+// was already moved to the archive, the archive is read from disk. Contracts
+// are added to the archive before they are removed from memory, so the archive
+// can be read without holding the lock.
+func (c *Contractor) OldContract(id types.FileContractID) (modules.RenterContract, bool) {
+	c.mu.RLock()
+	contract, ok := c.oldContracts[id]
+	c.mu.RUnlock()
+	if ok {
+		return contract, true
+	}
+	archived, err := c.persist.loadArchive()
+	if err != nil {
+		c.log.Println("WARN: failed to load the contract archive:", err)
+		return modules.RenterContract{}, false
+	}
+	for _, contract := range archived {
+		if contract.ID == id {
+			return contract, true
+		}
+	}
+	return modules.RenterContract{}, false
+}
+
+// HistoricContractsByHost returns the expired contracts with the given host,
+// including the ones which were already moved to the archive.
+func (c *Contractor) HistoricContractsByHost(pk types.SiaPublicKey) []modules.RenterContract {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var contracts []modules.RenterContract
+	for _, contract := range c.oldContracts {
+		if contract.HostPublicKey.Equals(pk) {
+			contracts = append(contracts, contract)
+		}
+	}
+	archived, err := c.persist.loadArchive()
+	if err != nil {
+		c.log.Println("WARN: failed to load the contract archive:", err)
+		return contracts
+	}
+	for _, contract := range archived {
+		if contract.HostPublicKey.Equals(pk) {
+			contracts = append(contracts, contract)
+		}
+	}
+	return contracts
+}
+
+// PurgeHistoricContracts removes the expired contracts with the given host
+// from memory and the archive and returns the number of purged contracts.
+// Contracts whose proof window hasn't closed yet or which started in the
+// current period are kept since they are still required for monitoring and
+// the spending reports. Contracts which were renewed into an active contract
+// are kept as well to preserve the renewal history of the active contract.
+func (c *Contractor) PurgeHistoricContracts(pk types.SiaPublicKey) (int, error) {
+	// The archive is updated without holding the lock, so make sure that it
+	// isn't updated concurrently.
+	c.archiveMu.Lock()
+	defer c.archiveMu.Unlock()
+
+	c.mu.RLock()
+	currentPeriod, blockHeight := c.currentPeriod, c.blockHeight
+	ancestors := c.renewalAncestors()
+	c.mu.RUnlock()
+	purgeable := func(contract modules.RenterContract) bool {
+		_, ancestor := ancestors[contract.ID]
+		return contract.HostPublicKey.Equals(pk) &&
+			contract.StartHeight < currentPeriod &&
+			windowEnd(contract) <= blockHeight &&
+			!ancestor
+	}
+
+	// Purge the archive first. If updating the archive fails, the contractor
+	// is left unchanged.
+	archived, err := c.persist.loadArchive()
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to load the contract archive")
+	}
+	var purged []types.FileContractID
+	remaining := archived[:0]
+	for _, contract := range archived {
+		if purgeable(contract) {
+			purged = append(purged, contract.ID)
+			continue
+		}
+		remaining = append(remaining, contract)
+	}
+	if len(purged) > 0 {
+		if err := c.persist.saveArchive(remaining); err != nil {
+			return 0, errors.AddContext(err, "failed to save the contract archive")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ancestors = c.renewalAncestors()
+	for id, contract := range c.oldContracts {
+		if purgeable(contract) {
+			purged = append(purged, id)
+			delete(c.oldContracts, id)
+		}
+	}
+	if len(purged) == 0 {
+		return 0, nil
+	}
+
+	// Drop the renewal links and double spend records of the purged contracts.
+	for _, id := range purged {
+		if newID, renewed := c.renewedTo[id]; renewed {
+			delete(c.renewedFrom, newID)
+			delete(c.renewedTo, id)
+		}
+		if oldID, renewed := c.renewedFrom[id]; renewed {
+			delete(c.renewedTo, oldID)
+			delete(c.renewedFrom, id)
+		}
+		delete(c.doubleSpentContracts, id)
+		c.log.Println("INFO: purged historic contract", id)
+	}
+	return len(purged), c.save()
+}
+
+// renewalAncestors returns the IDs of the contracts which were renewed into
+// one of the active contracts, either directly or through other renewals.
+func (c *Contractor) renewalAncestors() map[types.FileContractID]struct{} {
+	ancestors := make(map[types.FileContractID]struct{})
+	for _, id := range c.staticContracts.IDs() {
+		for oldID, renewed := c.renewedFrom[id]; renewed; oldID, renewed = c.renewedFrom[oldID] {
+			if _, exists := ancestors[oldID]; exists {
+				break
+			}
+			ancestors[oldID] = struct{}{}
+		}
+	}
+	return ancestors
+}
+
+// windowEnd returns the end of the proof window of a contract.
+func windowEnd(contract modules.RenterContract) types.BlockHeight {
+	if len(contract.Transaction.FileContractRevisions) == 0 {
+		return contract.EndHeight
+	}
+	return contract.Transaction.FileContractRevisions[0].NewWindowEnd
+}
+
+// SetOldContractRetention sets the number of allowance periods an expired
+// contract is kept in memory before it is moved to the archive.
+func (c *Contractor) SetOldContractRetention(periods uint64) error {
+	if periods == 0 {
+		return errZeroRetention
+	}
+	c.mu.Lock()
+	c.oldContractRetention = periods
+	err := c.save()
+	c.mu.Unlock()
+	if err != nil {
+		return errors.AddContext(err, "failed to save the contractor")
+	}
+	return c.managedPruneOldContracts()
+}
+
+// managedPruneOldContracts moves all the old contracts which expired more than
+// oldContractRetention allowance periods ago to the archive.
+func (c *Contractor) managedPruneOldContracts() error {
+	c.archiveMu.Lock()
+	defer c.archiveMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Without an allowance there is no period to base the retention on.
+	period := c.allowance.Period
+	if period == 0 {
+		return nil
+	}
+	retention := types.BlockHeight(c.oldContractRetention) * period
+	var pruned []modules.RenterContract
+	for _, contract := range c.oldContracts {
+		if contract.EndHeight+retention < c.blockHeight {
+			pruned = append(pruned, contract)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+
+	// Add the contracts to the archive before removing them from memory to
+	// avoid losing them if the renter crashes in between.
+	archived, err := c.persist.loadArchive()
+	if err != nil {
+		return errors.AddContext(err, "failed to load the contract archive")
+	}
+	if err := c.persist.saveArchive(append(archived, pruned...)); err != nil {
+		return errors.AddContext(err, "failed to save the contract archive")
+	}
+	for _, contract := range pruned {
+		delete(c.oldContracts, contract.ID)
+		if _, doubleSpent := c.doubleSpentContracts[contract.ID]; !doubleSpent {
+			c.archivedSpending = c.archivedSpending.Add(contract.ContractFee).Add(contract.TxnFee).
+				Add(contract.SiafundFee).Add(contract.DownloadSpending).Add(contract.UploadSpending).Add(contract.StorageSpending)
+		}
+		c.log.Println("INFO: moved old contract to the archive", contract.ID)
+	}
+	return c.save()
+}
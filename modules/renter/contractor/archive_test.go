@@ -0,0 +1,220 @@
+package contractor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/proto"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestPruneOldContracts tests that old contracts are moved to the archive once
+// they are older than the retention, that they can still be looked up and that
+// their spending is remembered.
+func TestPruneOldContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	dir := build.TempDir("contractor", t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	newContractor := func() *Contractor {
+		c := &Contractor{
+			persist:              NewPersist(dir),
+			log:                  persist.NewLogger(ioutil.Discard),
+			synced:               make(chan struct{}),
+			oldContracts:         make(map[types.FileContractID]modules.RenterContract),
+			renewedFrom:          make(map[types.FileContractID]types.FileContractID),
+			renewedTo:            make(map[types.FileContractID]types.FileContractID),
+			doubleSpentContracts: make(map[types.FileContractID]types.BlockHeight),
+			recoverableContracts: make(map[types.FileContractID]modules.RecoverableContract),
+		}
+		c.staticChurnLimiter = newChurnLimiter(c)
+		c.staticWatchdog = newWatchdog(c)
+		return c
+	}
+
+	// Create a contractor with a period of 10 blocks, a retention of 2
+	// periods and 2 old contracts. Only the first one is old enough to be
+	// archived.
+	c := newContractor()
+	c.allowance.Period = 10
+	c.blockHeight = 100
+	c.oldContractRetention = 2
+	oldest := modules.RenterContract{ID: types.FileContractID{1}, EndHeight: 50, ContractFee: types.NewCurrency64(1), UploadSpending: types.NewCurrency64(2)}
+	old := modules.RenterContract{ID: types.FileContractID{2}, EndHeight: 90, StorageSpending: types.NewCurrency64(4)}
+	c.oldContracts[oldest.ID] = oldest
+	c.oldContracts[old.ID] = old
+	if err := c.managedPruneOldContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.OldContracts()) != 1 || c.OldContracts()[0].ID != old.ID {
+		t.Fatal("wrong old contracts after pruning", c.OldContracts())
+	}
+	if !c.archivedSpending.Equals64(3) {
+		t.Fatal("wrong archived spending", c.archivedSpending)
+	}
+
+	// Both contracts should still be available through OldContract.
+	for _, id := range []types.FileContractID{oldest.ID, old.ID} {
+		if contract, ok := c.OldContract(id); !ok || contract.ID != id {
+			t.Fatal("contract not found", id)
+		}
+	}
+	if _, ok := c.OldContract(types.FileContractID{3}); ok {
+		t.Fatal("unknown contract shouldn't be found")
+	}
+
+	// A retention of 0 periods is invalid.
+	if err := c.SetOldContractRetention(0); !errors.Contains(err, errZeroRetention) {
+		t.Fatal("expected errZeroRetention but got", err)
+	}
+
+	// Reducing the retention should archive the second contract.
+	c.mu.Lock()
+	c.blockHeight = 101
+	c.mu.Unlock()
+	if err := c.SetOldContractRetention(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.OldContracts()) != 0 {
+		t.Fatal("all contracts should be archived", c.OldContracts())
+	}
+	archived, err := c.persist.loadArchive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 2 {
+		t.Fatalf("expected 2 archived contracts but got %v", len(archived))
+	}
+
+	// The retention should be persisted.
+	c = newContractor()
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.oldContractRetention != 1 {
+		t.Fatal("retention wasn't persisted", c.oldContractRetention)
+	}
+	if !c.archivedSpending.Equals64(7) {
+		t.Fatal("archived spending wasn't persisted", c.archivedSpending)
+	}
+	if _, ok := c.OldContract(old.ID); !ok {
+		t.Fatal("archived contract not found after reload")
+	}
+}
+
+// TestPurgeHistoricContracts tests listing and purging the historic contracts
+// of a host.
+func TestPurgeHistoricContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	dir := build.TempDir("contractor", t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := proto.NewContractSet(filepath.Join(dir, "contracts"), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	c := &Contractor{
+		staticContracts:      cs,
+		persist:              new(memPersist),
+		log:                  persist.NewLogger(ioutil.Discard),
+		oldContracts:         make(map[types.FileContractID]modules.RenterContract),
+		renewedFrom:          make(map[types.FileContractID]types.FileContractID),
+		renewedTo:            make(map[types.FileContractID]types.FileContractID),
+		doubleSpentContracts: make(map[types.FileContractID]types.BlockHeight),
+	}
+	c.staticChurnLimiter = newChurnLimiter(c)
+	c.staticWatchdog = newWatchdog(c)
+	c.blockHeight = 100
+	c.currentPeriod = 90
+
+	host := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{1}}
+	otherHost := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{2}}
+	withWindowEnd := func(contract modules.RenterContract, windowEnd types.BlockHeight) modules.RenterContract {
+		contract.Transaction.FileContractRevisions = []types.FileContractRevision{{NewWindowEnd: windowEnd}}
+		return contract
+	}
+	// An archived contract and an old contract whose windows closed, an old
+	// contract which is still within its window, one which started in the
+	// current period and one of another host.
+	archivedContract := withWindowEnd(modules.RenterContract{ID: types.FileContractID{1}, HostPublicKey: host, StartHeight: 10, EndHeight: 40}, 50)
+	expired := withWindowEnd(modules.RenterContract{ID: types.FileContractID{2}, HostPublicKey: host, StartHeight: 40, EndHeight: 80}, 90)
+	inWindow := withWindowEnd(modules.RenterContract{ID: types.FileContractID{3}, HostPublicKey: host, StartHeight: 50, EndHeight: 95}, 105)
+	currentPeriod := withWindowEnd(modules.RenterContract{ID: types.FileContractID{4}, HostPublicKey: host, StartHeight: 92, EndHeight: 95}, 96)
+	other := withWindowEnd(modules.RenterContract{ID: types.FileContractID{5}, HostPublicKey: otherHost, StartHeight: 40, EndHeight: 80}, 90)
+	if err := c.persist.saveArchive([]modules.RenterContract{archivedContract}); err != nil {
+		t.Fatal(err)
+	}
+	for _, contract := range []modules.RenterContract{expired, inWindow, currentPeriod, other} {
+		c.oldContracts[contract.ID] = contract
+	}
+	c.renewedFrom[expired.ID] = archivedContract.ID
+	c.renewedTo[archivedContract.ID] = expired.ID
+
+	// Add an old contract which was renewed into an active contract. It
+	// shouldn't be purged.
+	ancestor := withWindowEnd(modules.RenterContract{ID: types.FileContractID{6}, HostPublicKey: host, StartHeight: 40, EndHeight: 80}, 90)
+	c.oldContracts[ancestor.ID] = ancestor
+	revTxn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{{
+			ParentID: types.FileContractID{7},
+			UnlockConditions: types.UnlockConditions{
+				PublicKeys: []types.SiaPublicKey{{}, host},
+			},
+			NewWindowEnd:          200,
+			NewValidProofOutputs:  []types.SiacoinOutput{{}, {}},
+			NewMissedProofOutputs: []types.SiacoinOutput{{}, {}, {}},
+		}},
+	}
+	active, err := cs.InsertContract(modules.RecoverableContract{StartHeight: 80}, revTxn, nil, crypto.SecretKey{}, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.renewedFrom[active.ID] = ancestor.ID
+	c.renewedTo[ancestor.ID] = active.ID
+
+	if contracts := c.HistoricContractsByHost(host); len(contracts) != 5 {
+		t.Fatal("expected 5 historic contracts but got", len(contracts))
+	}
+	n, err := c.PurgeHistoricContracts(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatal("expected 2 purged contracts but got", n)
+	}
+	contracts := c.HistoricContractsByHost(host)
+	if len(contracts) != 3 {
+		t.Fatal("expected 3 remaining contracts but got", len(contracts))
+	}
+	for _, contract := range contracts {
+		if contract.ID != inWindow.ID && contract.ID != currentPeriod.ID && contract.ID != ancestor.ID {
+			t.Fatal("wrong contract remaining", contract.ID)
+		}
+	}
+	if len(c.renewedFrom) != 1 || len(c.renewedTo) != 1 || c.renewedFrom[active.ID] != ancestor.ID {
+		t.Fatal("wrong renewal links removed", c.renewedFrom, c.renewedTo)
+	}
+	if archived, err := c.persist.loadArchive(); err != nil || len(archived) != 0 {
+		t.Fatal("archive wasn't purged", archived, err)
+	}
+	if len(c.HistoricContractsByHost(otherHost)) != 1 {
+		t.Fatal("contract of other host shouldn't be purged")
+	}
+}
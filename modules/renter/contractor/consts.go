@@ -1,6 +1,8 @@
 package contractor
 
 import (
+	"time"
+
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -63,6 +65,24 @@ var (
 		Testing:  1,
 	}).(int)
 
+	// defaultOldContractRetention is the default number of allowance periods
+	// an expired contract is kept in memory before it is moved to the
+	// contractor's archive on disk.
+	defaultOldContractRetention = build.Select(build.Var{
+		Dev:      uint64(2),
+		Standard: uint64(6),
+		Testing:  uint64(1),
+	}).(uint64)
+
+	// recoveryRetryInterval is the interval at which the contractor retries
+	// to recover the known recoverable contracts independently of the
+	// contract maintenance.
+	recoveryRetryInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 10 * time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+
 	// oosRetryInterval is the time we wait for a host that ran out of storage to
 	// add more storage before trying to upload to it again.
 	oosRetryInterval = build.Select(build.Var{
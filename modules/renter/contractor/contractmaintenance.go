@@ -5,6 +5,7 @@ package contractor
 // contracts need to be renewed, and if contracts need to be blacklisted.
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -34,6 +35,17 @@ type (
 	}
 )
 
+// renewJitter returns the number of blocks by which the renewal of a contract
+// is delayed after the contract enters the renew window. The jitter is derived
+// from the contract's id to spread renewals evenly while making sure that the
+// renewal height of a contract doesn't change between maintenance runs.
+func renewJitter(id types.FileContractID, maxJitter types.BlockHeight) types.BlockHeight {
+	if maxJitter == 0 {
+		return 0
+	}
+	return types.BlockHeight(binary.LittleEndian.Uint64(id[:8])) % maxJitter
+}
+
 // callNotifyDoubleSpend is used by the watchdog to alert the contractor
 // whenever a monitored file contract input is double-spent. This function
 // marks down the host score, and marks the contract as !GoodForRenew and
@@ -85,10 +97,11 @@ func (c *Contractor) managedCheckForDuplicates() {
 
 			// Link the contracts to each other and then store the old contract
 			// in the record of historic contracts.
+			archived := oldSC.Metadata()
 			c.mu.Lock()
 			c.renewedFrom[newContract.ID] = oldContract.ID
 			c.renewedTo[oldContract.ID] = newContract.ID
-			c.oldContracts[oldContract.ID] = oldSC.Metadata()
+			c.oldContracts[oldContract.ID] = archived
 			c.pubKeysToContractID[string(newContract.HostPublicKey.Key)] = newContract.ID
 
 			// Save the contractor and delete the contract.
@@ -102,6 +115,7 @@ func (c *Contractor) managedCheckForDuplicates() {
 			}
 			c.mu.Unlock()
 			c.staticContracts.Delete(oldSC)
+			c.managedNotifyArchived(archived)
 
 			// Update the pubkeys map to contain the newest contract id.
 			//
@@ -739,7 +753,8 @@ func (c *Contractor) managedRenewContract(renewInstructions fileContractRenewal,
 	c.renewedFrom[newContract.ID] = id
 	c.renewedTo[id] = newContract.ID
 	// Store the contract in the record of historic contracts.
-	c.oldContracts[id] = oldContract.Metadata()
+	archived := oldContract.Metadata()
+	c.oldContracts[id] = archived
 	// Save the contractor.
 	err = c.save()
 	if err != nil {
@@ -748,6 +763,7 @@ func (c *Contractor) managedRenewContract(renewInstructions fileContractRenewal,
 	c.mu.Unlock()
 	// Delete the old contract.
 	c.staticContracts.Delete(oldContract)
+	c.managedNotifyArchived(archived)
 
 	// Signal to the watchdog that it should immediately post the last
 	// revision for this contract.
@@ -795,7 +811,32 @@ func (c *Contractor) callUpdateUtility(safeContract *proto.SafeContract, newUtil
 		c.staticChurnLimiter.callNotifyChurnedContract(contract)
 	}
 
-	return safeContract.UpdateUtility(newUtility)
+	if err := safeContract.UpdateUtility(newUtility); err != nil {
+		return err
+	}
+
+	// If the GoodForRenew utility changed, notify the callbacks.
+	if contract.Utility.GoodForRenew == newUtility.GoodForRenew {
+		return nil
+	}
+	c.mu.RLock()
+	callbacks := c.utilityCallbacks
+	c.mu.RUnlock()
+	updated := safeContract.Metadata()
+	for _, fn := range callbacks {
+		fn(updated)
+	}
+	return nil
+}
+
+// OnContractUtilityChanged registers a callback which is called with the
+// updated contract whenever the GoodForRenew utility of a contract changes.
+// The callbacks are called synchronously while the contract is acquired, so
+// they must not block on the contract.
+func (c *Contractor) OnContractUtilityChanged(fn func(modules.RenterContract)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.utilityCallbacks = append(c.utilityCallbacks, fn)
 }
 
 // threadedContractMaintenance checks the set of contracts that the contractor
@@ -931,8 +972,10 @@ func (c *Contractor) threadedContractMaintenance() {
 		// If the contract needs to be renewed because it is about to expire,
 		// calculate a spending for the contract that is proportional to how
 		// much money was spend on the contract throughout this billing cycle
-		// (which is now ending).
-		if blockHeight+allowance.RenewWindow >= contract.EndHeight && !c.staticDeps.Disrupt("disableRenew") {
+		// (which is now ending). The renewal is delayed by the contract's
+		// jitter to avoid renewing all contracts at the same time.
+		jitter := renewJitter(contract.ID, allowance.RenewJitter)
+		if blockHeight+allowance.RenewWindow >= contract.EndHeight+jitter && !c.staticDeps.Disrupt("disableRenew") {
 			renewAmount, err := c.managedEstimateRenewFundingRequirements(contract, blockHeight, allowance)
 			if err != nil {
 				c.log.Debugln("Contract skipped because there was an error estimating renew funding requirements", renewAmount, err)
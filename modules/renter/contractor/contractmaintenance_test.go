@@ -3,6 +3,8 @@ package contractor
 import (
 	"testing"
 
+	"gitlab.com/NebulousLabs/fastrand"
+
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
@@ -62,3 +64,31 @@ func TestCheckFormContractGouging(t *testing.T) {
 		t.Fatal("expecting price gouging check to fail")
 	}
 }
+
+// TestRenewJitter checks that the renew jitter is stable for a contract, stays
+// within the configured window and spreads contracts across it.
+func TestRenewJitter(t *testing.T) {
+	// Without a jitter window contracts aren't delayed.
+	var id types.FileContractID
+	fastrand.Read(id[:])
+	if jitter := renewJitter(id, 0); jitter != 0 {
+		t.Fatal("expected no jitter but got", jitter)
+	}
+
+	maxJitter := types.BlockHeight(10)
+	seen := make(map[types.BlockHeight]struct{})
+	for i := 0; i < 100; i++ {
+		fastrand.Read(id[:])
+		jitter := renewJitter(id, maxJitter)
+		if jitter >= maxJitter {
+			t.Fatalf("jitter %v exceeds the window of %v blocks", jitter, maxJitter)
+		}
+		if renewJitter(id, maxJitter) != jitter {
+			t.Fatal("jitter isn't deterministic")
+		}
+		seen[jitter] = struct{}{}
+	}
+	if len(seen) < 2 {
+		t.Fatal("contracts weren't spread across the jitter window", seen)
+	}
+}
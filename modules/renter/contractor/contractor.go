@@ -49,17 +49,46 @@ type Contractor struct {
 	interruptMaintenance chan struct{}
 	maintenanceLock      siasync.TryMutex
 
+	// recoveryWakeChan wakes up the recovery loop whenever new recoverable
+	// contracts are found.
+	recoveryWakeChan chan struct{}
+
 	// Only one thread should be scanning the blockchain for recoverable
 	// contracts at a time.
 	atomicScanInProgress     uint32
 	atomicRecoveryScanHeight int64
 
+	// Counters for reporting the progress of the contract recovery. They are
+	// reset whenever a new scan is started.
+	atomicRecoveryIdentifiersMatched uint64
+	atomicRecoveredContracts         uint64
+	atomicRecoveryBandwidth          uint64
+
 	allowance     modules.Allowance
 	blockHeight   types.BlockHeight
 	synced        chan struct{}
 	currentPeriod types.BlockHeight
 	lastChange    modules.ConsensusChangeID
 
+	// archiveCallbacks are called with every contract archived by
+	// managedArchiveContracts.
+	archiveCallbacks []func(modules.RenterContract)
+
+	// utilityCallbacks are called with every contract whose GoodForRenew
+	// utility changed.
+	utilityCallbacks []func(modules.RenterContract)
+
+	// oldContractRetention is the number of allowance periods an expired
+	// contract is kept in oldContracts before it is moved to the archive.
+	// archivedSpending is the total spending of the archived contracts which
+	// is still reported as previous spending by PeriodSpending.
+	oldContractRetention uint64
+	archivedSpending     types.Currency
+
+	// archiveMu serializes the updates of the contract archive. It needs to
+	// be acquired before mu.
+	archiveMu sync.Mutex
+
 	// recentRecoveryChange is the first ConsensusChange that was missed while
 	// trying to find recoverable contracts. This is where we need to start
 	// rescanning the blockchain for recoverable contracts the next time the wallet
@@ -77,10 +106,14 @@ type Contractor struct {
 	// renewedTo links the old contract's ID to the new contract's ID
 	// doubleSpentContracts keep track of all contracts that were double spent by
 	// either the renter or host.
+	// revertedContracts keeps track of all contracts whose formation
+	// transaction was reverted and hasn't been confirmed again yet, together
+	// with the height at which they were reverted.
 	staticContracts      *proto.ContractSet
 	oldContracts         map[types.FileContractID]modules.RenterContract
 	doubleSpentContracts map[types.FileContractID]types.BlockHeight
 	recoverableContracts map[types.FileContractID]modules.RecoverableContract
+	revertedContracts    map[types.FileContractID]types.BlockHeight
 	renewedFrom          map[types.FileContractID]types.FileContractID
 	renewedTo            map[types.FileContractID]types.FileContractID
 
@@ -169,6 +202,10 @@ func (c *Contractor) PeriodSpending() (modules.ContractorSpending, error) {
 		}
 	}
 
+	// Archived contracts expired at least one period ago so their spending
+	// is previous spending.
+	spending.PreviousSpending = spending.PreviousSpending.Add(c.archivedSpending)
+
 	// Calculate amount of spent money to get unspent money.
 	allSpending := spending.ContractFees
 	allSpending = allSpending.Add(spending.DownloadSpending)
@@ -181,6 +218,67 @@ func (c *Contractor) PeriodSpending() (modules.ContractorSpending, error) {
 	return spending, nil
 }
 
+// addSpending adds the spending of a contract to the totals.
+func addSpending(totals *modules.SpendingTotals, contract modules.RenterContract) {
+	totals.DownloadSpending = totals.DownloadSpending.Add(contract.DownloadSpending)
+	totals.StorageSpending = totals.StorageSpending.Add(contract.StorageSpending)
+	totals.UploadSpending = totals.UploadSpending.Add(contract.UploadSpending)
+	totals.Fees = totals.Fees.Add(contract.ContractFee).Add(contract.TxnFee).Add(contract.SiafundFee)
+}
+
+// SpendingBreakdown returns the money spent on the active, expired and
+// archived contracts of the contractor. Like PeriodSpending, the current
+// period includes all active contracts and the expired contracts which were
+// formed during the period. Double-spent contracts are ignored. A contract
+// which is in more than one of the sets while it is being archived or pruned
+// is only counted once.
+func (c *Contractor) SpendingBreakdown() (modules.SpendingBreakdown, error) {
+	// Load the archive before acquiring the lock to not block consensus
+	// updates while reading it from disk. Holding archiveMu prevents old
+	// contracts from being moved to the archive before the lock is acquired.
+	c.archiveMu.Lock()
+	defer c.archiveMu.Unlock()
+	archived, err := c.persist.loadArchive()
+	if err != nil {
+		return modules.SpendingBreakdown{}, errors.AddContext(err, "failed to load the contract archive")
+	}
+	activeContracts := c.staticContracts.ViewAll()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Expired contracts are counted first since a contract that is being
+	// archived is briefly part of both the active and the expired contracts.
+	var breakdown modules.SpendingBreakdown
+	counted := make(map[types.FileContractID]struct{})
+	count := func(contract modules.RenterContract) bool {
+		if _, doubleSpent := c.doubleSpentContracts[contract.ID]; doubleSpent {
+			return false
+		}
+		if _, exists := counted[contract.ID]; exists {
+			return false
+		}
+		counted[contract.ID] = struct{}{}
+		addSpending(&breakdown.Total, contract)
+		return true
+	}
+	for _, contract := range c.oldContracts {
+		if count(contract) && contract.StartHeight >= c.currentPeriod {
+			addSpending(&breakdown.CurrentPeriod, contract)
+		}
+	}
+	for _, contract := range activeContracts {
+		if count(contract) {
+			addSpending(&breakdown.CurrentPeriod, contract)
+		}
+	}
+	// Archived contracts expired at least one period ago so they never count
+	// towards the current period.
+	for _, contract := range archived {
+		count(contract)
+	}
+	return breakdown, nil
+}
+
 // CurrentPeriod returns the height at which the current allowance period
 // began.
 func (c *Contractor) CurrentPeriod() types.BlockHeight {
@@ -203,6 +301,24 @@ func (c *Contractor) RecoveryScanStatus() (bool, types.BlockHeight) {
 	return sip == 1, bh
 }
 
+// RecoveryStatus returns information about the progress of the contract
+// recovery.
+func (c *Contractor) RecoveryStatus() modules.ContractRecoveryStatus {
+	scanInProgress, scannedBlocks := c.RecoveryScanStatus()
+	c.mu.RLock()
+	pending := uint64(len(c.recoverableContracts))
+	c.mu.RUnlock()
+	return modules.ContractRecoveryStatus{
+		InProgress:         scanInProgress || pending > 0,
+		ScanInProgress:     scanInProgress,
+		ScannedBlocks:      scannedBlocks,
+		IdentifiersMatched: atomic.LoadUint64(&c.atomicRecoveryIdentifiersMatched),
+		ContractsPending:   pending,
+		ContractsRecovered: atomic.LoadUint64(&c.atomicRecoveredContracts),
+		BandwidthUsed:      atomic.LoadUint64(&c.atomicRecoveryBandwidth),
+	}
+}
+
 // RefreshedContract returns a bool indicating if the contract was a refreshed
 // contract. A refreshed contract refers to a contract that ran out of funds
 // prior to the end height and so was renewed with the host in the same period.
@@ -325,6 +441,8 @@ func contractorBlockingStartup(cs consensusSet, w wallet, tp transactionPool, hd
 		wallet:        w,
 
 		interruptMaintenance: make(chan struct{}),
+		recoveryWakeChan:     make(chan struct{}, 1),
+		oldContractRetention: defaultOldContractRetention,
 		synced:               make(chan struct{}),
 
 		staticContracts:      contractSet,
@@ -334,6 +452,7 @@ func contractorBlockingStartup(cs consensusSet, w wallet, tp transactionPool, hd
 		oldContracts:         make(map[types.FileContractID]modules.RenterContract),
 		doubleSpentContracts: make(map[types.FileContractID]types.BlockHeight),
 		recoverableContracts: make(map[types.FileContractID]modules.RecoverableContract),
+		revertedContracts:    make(map[types.FileContractID]types.BlockHeight),
 		pubKeysToContractID:  make(map[string]types.FileContractID),
 		renewing:             make(map[types.FileContractID]bool),
 		renewedFrom:          make(map[types.FileContractID]types.FileContractID),
@@ -422,6 +541,9 @@ func NewCustomContractor(cs consensusSet, w wallet, tp transactionPool, hdb host
 		return nil, errChan
 	}
 
+	// Retry recovering contracts independently of the consensus updates.
+	go c.threadedRecoverContractsLoop()
+
 	// non-blocking startup.
 	go func() {
 		// Subscribe to the consensus set in a separate goroutine.
@@ -462,6 +584,9 @@ func (c *Contractor) callInitRecoveryScan(scanStart modules.ConsensusChangeID) (
 	rs := proto.DeriveRenterSeed(s)
 	// Reset the scan progress before starting the scan.
 	atomic.StoreInt64(&c.atomicRecoveryScanHeight, 0)
+	atomic.StoreUint64(&c.atomicRecoveryIdentifiersMatched, 0)
+	atomic.StoreUint64(&c.atomicRecoveredContracts, 0)
+	atomic.StoreUint64(&c.atomicRecoveryBandwidth, 0)
 	// Create the scanner.
 	scanner := c.newRecoveryScanner(rs)
 	// Start the scan.
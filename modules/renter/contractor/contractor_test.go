@@ -4,11 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/proto"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
@@ -17,6 +22,7 @@ import (
 type newStub struct{}
 
 // consensus set stubs
+func (newStub) BlockAtHeight(types.BlockHeight) (types.Block, bool) { return types.Block{}, false }
 func (newStub) ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID, <-chan struct{}) error {
 	return nil
 }
@@ -122,6 +128,194 @@ func TestAllowance(t *testing.T) {
 	}
 }
 
+// TestRecoveryStatus tests the RecoveryStatus method.
+func TestRecoveryStatus(t *testing.T) {
+	c := &Contractor{
+		atomicRecoveryIdentifiersMatched: 3,
+		atomicRecoveredContracts:         1,
+		atomicRecoveryScanHeight:         10,
+		atomicScanInProgress:             1,
+		recoverableContracts: map[types.FileContractID]modules.RecoverableContract{
+			{1}: {},
+			{2}: {},
+		},
+	}
+	rs := c.RecoveryStatus()
+	if !rs.InProgress || !rs.ScanInProgress {
+		t.Fatal("recovery should be in progress", rs)
+	}
+	if rs.ScannedBlocks != 10 || rs.IdentifiersMatched != 3 || rs.ContractsRecovered != 1 || rs.ContractsPending != 2 {
+		t.Fatal("wrong recovery status", rs)
+	}
+
+	// Once the scan is done and all contracts are recovered, recovery is no
+	// longer in progress.
+	c.atomicScanInProgress = 0
+	c.recoverableContracts = make(map[types.FileContractID]modules.RecoverableContract)
+	rs = c.RecoveryStatus()
+	if rs.InProgress || rs.ScanInProgress || rs.ContractsPending != 0 {
+		t.Fatal("recovery shouldn't be in progress", rs)
+	}
+}
+
+// TestRecoverableContractsRetried tests that recoverable contracts which can't
+// be recovered right away are kept and persisted so that they are retried by
+// later maintenance runs, and that they are dropped once they expire.
+func TestRecoverableContractsRetried(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	_, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Add a recoverable contract with a host which isn't reachable.
+	c.mu.Lock()
+	rc := modules.RecoverableContract{
+		FileContract:  types.FileContract{WindowEnd: c.blockHeight + 2},
+		ID:            types.FileContractID{1},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("offline host")},
+	}
+	c.recoverableContracts[rc.ID] = rc
+	c.mu.Unlock()
+
+	// Recovery fails but the contract should still be pending. Hold the
+	// maintenance lock like threadedRecoverContractsLoop to not race it.
+	c.maintenanceLock.Lock()
+	c.callRecoverContracts()
+	c.maintenanceLock.Unlock()
+	c.mu.RLock()
+	_, pending := c.recoverableContracts[rc.ID]
+	c.mu.RUnlock()
+	if !pending {
+		t.Fatal("contract should still be pending after a failed recovery")
+	}
+
+	// The pending contract should have been persisted.
+	var data contractorPersist
+	if err := c.persist.load(&data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.RecoverableContracts) != 1 || data.RecoverableContracts[0].ID != rc.ID {
+		t.Fatal("pending contract wasn't persisted", data.RecoverableContracts)
+	}
+
+	// Once the contract's window has passed it shouldn't be retried anymore.
+	for i := 0; i < 2; i++ {
+		if _, err := m.AddBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.maintenanceLock.Lock()
+	c.callRecoverContracts()
+	c.maintenanceLock.Unlock()
+	c.mu.RLock()
+	_, pending = c.recoverableContracts[rc.ID]
+	c.mu.RUnlock()
+	if pending {
+		t.Fatal("expired contract should have been removed")
+	}
+}
+
+// TestRecoverContractsLoop tests that the recovery loop retries pending
+// recoverable contracts without waiting for new blocks.
+func TestRecoverContractsLoop(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	_, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Add a recoverable contract whose window already passed. The next
+	// recovery attempt should drop it.
+	c.mu.Lock()
+	rc := modules.RecoverableContract{
+		FileContract:  types.FileContract{WindowEnd: c.blockHeight},
+		ID:            types.FileContractID{1},
+		HostPublicKey: types.SiaPublicKey{Key: []byte("offline host")},
+	}
+	c.recoverableContracts[rc.ID] = rc
+	c.mu.Unlock()
+
+	err = build.Retry(50, recoveryRetryInterval/10, func() error {
+		c.mu.RLock()
+		_, pending := c.recoverableContracts[rc.ID]
+		c.mu.RUnlock()
+		if pending {
+			return errors.New("contract is still pending")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRecoverKnownContract tests that a recoverable contract which is already
+// part of the contract set is dropped without contacting its host.
+func TestRecoverKnownContract(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	_, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Block the recovery loop and add a contract to the contract set. Its host
+	// isn't in the hostdb, so contacting it would fail and keep the contract
+	// pending.
+	c.maintenanceLock.Lock()
+	defer c.maintenanceLock.Unlock()
+	host := types.SiaPublicKey{Key: []byte("unknown host")}
+	revTxn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{{
+			ParentID: types.FileContractID{1},
+			UnlockConditions: types.UnlockConditions{
+				PublicKeys: []types.SiaPublicKey{{}, host},
+			},
+			NewWindowEnd:          200,
+			NewValidProofOutputs:  []types.SiacoinOutput{{}, {}},
+			NewMissedProofOutputs: []types.SiacoinOutput{{}, {}, {}},
+		}},
+	}
+	contract, err := c.staticContracts.InsertContract(modules.RecoverableContract{}, revTxn, nil, crypto.SecretKey{}, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Find the same contract again.
+	c.mu.Lock()
+	rc := modules.RecoverableContract{
+		FileContract:  types.FileContract{WindowEnd: c.blockHeight + 10},
+		ID:            contract.ID,
+		HostPublicKey: host,
+	}
+	c.recoverableContracts[rc.ID] = rc
+	c.mu.Unlock()
+
+	// The contract should be dropped without contacting the host.
+	c.callRecoverContracts()
+	if rs := c.RecoveryStatus(); rs.ContractsPending != 0 || rs.ContractsRecovered != 0 {
+		t.Fatal("known contract should have been dropped", rs.ContractsPending, rs.ContractsRecovered)
+	}
+	if bandwidth := atomic.LoadUint64(&c.atomicRecoveryBandwidth); bandwidth != 0 {
+		t.Fatal("host shouldn't have been contacted", bandwidth)
+	}
+	if _, ok := c.staticContracts.View(contract.ID); !ok {
+		t.Fatal("known contract should still be in the contract set")
+	}
+}
+
 // stubHostDB mocks the hostDB dependency using zero-valued implementations of
 // its methods.
 type stubHostDB struct{}
@@ -375,6 +569,12 @@ func TestIntegrationSetAllowance(t *testing.T) {
 		t.Errorf("expected %q, got %q", errAllowanceWindowSize, err)
 	}
 	a.RenewWindow = 10
+	a.RenewJitter = 5
+	err = c.SetAllowance(a)
+	if err != errAllowanceJitterSize {
+		t.Errorf("expected %q, got %q", errAllowanceJitterSize, err)
+	}
+	a.RenewJitter = 4
 	err = c.SetAllowance(a)
 	if err != ErrAllowanceZeroExpectedStorage {
 		t.Errorf("expected %q, got %q", ErrAllowanceZeroExpectedStorage, err)
@@ -774,3 +974,88 @@ func TestWalletBridge(t *testing.T) {
 		t.Error("StartTransaction was not called on the shim")
 	}
 }
+
+// TestSpendingBreakdown tests that SpendingBreakdown adds up the spending of
+// expired and archived contracts and only counts contracts of the current
+// period towards its subtotal.
+func TestSpendingBreakdown(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	dir := build.TempDir("contractor", t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := proto.NewContractSet(filepath.Join(dir, "contracts"), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	c := &Contractor{
+		persist:              NewPersist(dir),
+		staticContracts:      cs,
+		oldContracts:         make(map[types.FileContractID]modules.RenterContract),
+		doubleSpentContracts: make(map[types.FileContractID]types.BlockHeight),
+		currentPeriod:        100,
+	}
+
+	// Create a contract from the current period, one from the previous
+	// period, a double-spent one and an archived one. The contract from the
+	// previous period is also in the archive as if the renter crashed while
+	// pruning it, which shouldn't count it twice.
+	newContract := func(id byte, startHeight types.BlockHeight) modules.RenterContract {
+		return modules.RenterContract{
+			ID:               types.FileContractID{id},
+			StartHeight:      startHeight,
+			DownloadSpending: types.NewCurrency64(1),
+			StorageSpending:  types.NewCurrency64(2),
+			UploadSpending:   types.NewCurrency64(3),
+			ContractFee:      types.NewCurrency64(4),
+			TxnFee:           types.NewCurrency64(5),
+			SiafundFee:       types.NewCurrency64(6),
+		}
+	}
+	current := newContract(1, 100)
+	previous := newContract(2, 50)
+	doubleSpent := newContract(3, 100)
+	archived := newContract(4, 0)
+	c.oldContracts[current.ID] = current
+	c.oldContracts[previous.ID] = previous
+	c.oldContracts[doubleSpent.ID] = doubleSpent
+	c.doubleSpentContracts[doubleSpent.ID] = 100
+	if err := c.persist.saveArchive([]modules.RenterContract{archived, previous}); err != nil {
+		t.Fatal(err)
+	}
+
+	breakdown, err := c.SpendingBreakdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTotals := func(totals modules.SpendingTotals, n uint64) {
+		t.Helper()
+		if !totals.DownloadSpending.Equals64(n) || !totals.StorageSpending.Equals64(2*n) || !totals.UploadSpending.Equals64(3*n) || !totals.Fees.Equals64(15*n) {
+			t.Fatalf("wrong totals for %v contracts: %+v", n, totals)
+		}
+	}
+	checkTotals(breakdown.Total, 3)
+	checkTotals(breakdown.CurrentPeriod, 1)
+}
+
+// TestContractEndHeights tests that contractEndHeights returns the end heights
+// of all contracts in ascending order.
+func TestContractEndHeights(t *testing.T) {
+	if len(contractEndHeights(nil)) != 0 {
+		t.Fatal("expected no end heights without contracts")
+	}
+	contracts := []modules.RenterContract{
+		{ID: types.FileContractID{1}, EndHeight: 300},
+		{ID: types.FileContractID{2}, EndHeight: 100},
+		{ID: types.FileContractID{3}, EndHeight: 300},
+		{ID: types.FileContractID{4}, EndHeight: 200},
+	}
+	expected := []types.BlockHeight{100, 200, 300, 300}
+	if endHeights := contractEndHeights(contracts); !reflect.DeepEqual(endHeights, expected) {
+		t.Fatalf("expected %v but got %v", expected, endHeights)
+	}
+}
@@ -1,6 +1,8 @@
 package contractor
 
 import (
+	"sort"
+
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
 
@@ -103,7 +105,7 @@ func (c *Contractor) MarkContractBad(id types.FileContractID) error {
 }
 
 // OldContracts returns the contracts formed by the contractor that have
-// expired
+// expired. Contracts which were moved to the archive are not included.
 func (c *Contractor) OldContracts() []modules.RenterContract {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -114,6 +116,27 @@ func (c *Contractor) OldContracts() []modules.RenterContract {
 	return contracts
 }
 
+// ContractEndHeights returns the end heights of the contractor's active
+// contracts in ascending order. This includes contracts which are about to be
+// renewed. Many contracts ending at the same height indicate that a lot of
+// data is at risk if the renewals at that height fail.
+func (c *Contractor) ContractEndHeights() []types.BlockHeight {
+	return contractEndHeights(c.staticContracts.ViewAll())
+}
+
+// contractEndHeights returns the sorted end heights of the provided
+// contracts.
+func contractEndHeights(contracts []modules.RenterContract) []types.BlockHeight {
+	endHeights := make([]types.BlockHeight, 0, len(contracts))
+	for _, contract := range contracts {
+		endHeights = append(endHeights, contract.EndHeight)
+	}
+	sort.Slice(endHeights, func(i, j int) bool {
+		return endHeights[i] < endHeights[j]
+	})
+	return endHeights
+}
+
 // RecoverableContracts returns the contracts that the contractor deems
 // recoverable. That means they are not expired yet and also not part of the
 // active contracts. Usually this should return an empty slice unless the host
@@ -1,6 +1,7 @@
 package contractor
 
 import (
+	"os"
 	"path/filepath"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
@@ -12,6 +13,7 @@ import (
 // interface possible makes it easier to mock these dependencies in testing.
 type (
 	consensusSet interface {
+		BlockAtHeight(types.BlockHeight) (types.Block, bool)
 		ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID, <-chan struct{}) error
 		Synced() bool
 		Unsubscribe(modules.ConsensusSetSubscriber)
@@ -75,6 +77,8 @@ type (
 	persister interface {
 		save(contractorPersist) error
 		load(*contractorPersist) error
+		saveArchive([]modules.RenterContract) error
+		loadArchive() ([]modules.RenterContract, error)
 	}
 )
 
@@ -106,7 +110,8 @@ func (ws *WalletBridge) Unlocked() (bool, error) { return ws.W.Unlocked() }
 // stdPersist implements the persister interface. The filename required by
 // these functions is internal to stdPersist.
 type stdPersist struct {
-	filename string
+	filename        string
+	archiveFilename string
 }
 
 var persistMeta = persist.Metadata{
@@ -114,6 +119,11 @@ var persistMeta = persist.Metadata{
 	Version: "1.3.1",
 }
 
+var archiveMeta = persist.Metadata{
+	Header:  "Contractor Archive",
+	Version: "1.4.2",
+}
+
 func (p *stdPersist) save(data contractorPersist) error {
 	return persist.SaveJSON(persistMeta, data, p.filename)
 }
@@ -122,9 +132,23 @@ func (p *stdPersist) load(data *contractorPersist) error {
 	return persist.LoadJSON(persistMeta, &data, p.filename)
 }
 
+func (p *stdPersist) saveArchive(contracts []modules.RenterContract) error {
+	return persist.SaveJSON(archiveMeta, contracts, p.archiveFilename)
+}
+
+func (p *stdPersist) loadArchive() ([]modules.RenterContract, error) {
+	var contracts []modules.RenterContract
+	err := persist.LoadJSON(archiveMeta, &contracts, p.archiveFilename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return contracts, err
+}
+
 // NewPersist create a new stdPersist.
 func NewPersist(dir string) *stdPersist {
 	return &stdPersist{
-		filename: filepath.Join(dir, "contractor.json"),
+		filename:        filepath.Join(dir, "contractor.json"),
+		archiveFilename: filepath.Join(dir, "contractor_archive.json"),
 	}
 }
@@ -3,6 +3,7 @@ package contractor
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
@@ -20,6 +21,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/modules/host"
 	"gitlab.com/NebulousLabs/Sia/modules/miner"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/hostdb"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/proto"
 	"gitlab.com/NebulousLabs/Sia/modules/transactionpool"
 	modWallet "gitlab.com/NebulousLabs/Sia/modules/wallet"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -809,3 +811,446 @@ func TestContractPresenceLeak(t *testing.T) {
 		t.Fatalf("Expected to get equal errors, got %q and %q.", errors[0], errors[1])
 	}
 }
+
+// TestRecoverContractsFromSeed tests that the contractor can recover a lost
+// contract by scanning a specific range of blocks.
+func TestRecoverContractsFromSeed(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok, err := c.hdb.Host(h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host while the maintenance is blocked. Reset
+	// the allowance afterwards to prevent the maintenance from forming
+	// another contract.
+	c.maintenanceLock.Lock()
+	c.mu.Lock()
+	c.allowance = modules.DefaultAllowance
+	startHeight := c.blockHeight
+	c.mu.Unlock()
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	c.mu.Lock()
+	c.allowance = modules.Allowance{}
+	c.mu.Unlock()
+	c.maintenanceLock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mine blocks until the formation transaction is confirmed.
+	err = build.Retry(50, 100*time.Millisecond, func() error {
+		if _, err := m.AddBlock(); err != nil {
+			return err
+		}
+		status, ok := c.ContractStatus(contract.ID)
+		if !ok || !status.ContractFound {
+			return errors.New("contract wasn't confirmed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.RLock()
+	endHeight := c.blockHeight
+	c.mu.RUnlock()
+
+	// lose the contract.
+	sc, ok := c.staticContracts.Acquire(contract.ID)
+	if !ok {
+		t.Fatal("contract not found")
+	}
+	c.staticContracts.Delete(sc)
+	c.mu.Lock()
+	delete(c.pubKeysToContractID, contract.HostPublicKey.String())
+	c.mu.Unlock()
+
+	// invalid ranges should be rejected.
+	seed, _, err := c.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RecoverContractsFromSeed(seed, endHeight, startHeight); err == nil {
+		t.Fatal("expected an error if startHeight > endHeight")
+	}
+	if err := c.RecoverContractsFromSeed(seed, startHeight, endHeight+1); err == nil {
+		t.Fatal("expected an error if endHeight is in the future")
+	}
+
+	// scanning with a different seed shouldn't find the contract.
+	var otherSeed modules.Seed
+	fastrand.Read(otherSeed[:])
+	if err := c.RecoverContractsFromSeed(otherSeed, startHeight, endHeight); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.staticContracts.View(contract.ID); ok {
+		t.Fatal("contract shouldn't have been recovered")
+	}
+
+	// scanning with the right seed should recover the contract.
+	if err := c.RecoverContractsFromSeed(seed, startHeight, endHeight); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.staticContracts.View(contract.ID); !ok {
+		t.Fatal("contract wasn't recovered")
+	}
+	if rs := c.RecoveryStatus(); rs.ContractsPending != 0 {
+		t.Fatal("there shouldn't be any pending contracts", rs.ContractsPending)
+	}
+}
+
+// TestPreviewRecovery tests that previewing a recovery finds lost contracts
+// without recovering them.
+func TestPreviewRecovery(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok, err := c.hdb.Host(h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host while the maintenance is blocked.
+	c.maintenanceLock.Lock()
+	c.mu.Lock()
+	c.allowance = modules.DefaultAllowance
+	startHeight := c.blockHeight
+	c.mu.Unlock()
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	c.mu.Lock()
+	c.allowance = modules.Allowance{}
+	c.mu.Unlock()
+	c.maintenanceLock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.RLock()
+	endHeight := c.blockHeight
+	c.mu.RUnlock()
+
+	// preview collects the contracts found in the range of blocks.
+	preview := func(seed modules.Seed) []modules.RecoverableContract {
+		var rcs []modules.RecoverableContract
+		for height := startHeight; height <= endHeight; height++ {
+			block, exists := c.cs.BlockAtHeight(height)
+			if !exists {
+				t.Fatalf("block at height %v not found", height)
+			}
+			rcs = append(rcs, c.PreviewRecovery(seed, block)...)
+		}
+		return rcs
+	}
+
+	// the contract is still known, so there is nothing to recover.
+	seed, _, err := c.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcs := preview(seed); len(rcs) != 0 {
+		t.Fatal("known contract shouldn't be recoverable", len(rcs))
+	}
+
+	// lose the contract.
+	sc, ok := c.staticContracts.Acquire(contract.ID)
+	if !ok {
+		t.Fatal("contract not found")
+	}
+	c.staticContracts.Delete(sc)
+	c.mu.Lock()
+	delete(c.pubKeysToContractID, contract.HostPublicKey.String())
+	c.mu.Unlock()
+
+	// a different seed shouldn't find the contract.
+	var otherSeed modules.Seed
+	fastrand.Read(otherSeed[:])
+	if rcs := preview(otherSeed); len(rcs) != 0 {
+		t.Fatal("contract shouldn't be found with a different seed", len(rcs))
+	}
+
+	// the right seed should find the contract but not recover it.
+	rcs := preview(seed)
+	if len(rcs) != 1 {
+		t.Fatal("expected 1 recoverable contract but got", len(rcs))
+	}
+	if rcs[0].ID != contract.ID || rcs[0].HostPublicKey.String() != contract.HostPublicKey.String() || rcs[0].WindowStart != contract.EndHeight {
+		t.Fatal("wrong recoverable contract", rcs[0].ID, rcs[0].HostPublicKey, rcs[0].WindowStart)
+	}
+	if _, ok := c.staticContracts.View(contract.ID); ok {
+		t.Fatal("contract shouldn't have been recovered")
+	}
+	if rs := c.RecoveryStatus(); rs.ContractsPending != 0 {
+		t.Fatal("there shouldn't be any pending contracts", rs.ContractsPending)
+	}
+}
+
+// formAndLoseContract forms a contract with the host, waits for it to be
+// mined and removes it from the contract set again. It returns the lost
+// contract and the height before it was formed.
+func formAndLoseContract(t *testing.T, c *Contractor, m modules.TestMiner, hostEntry modules.HostDBEntry) (modules.RenterContract, types.BlockHeight) {
+	// form a contract with the host while the maintenance is blocked.
+	c.maintenanceLock.Lock()
+	c.mu.Lock()
+	c.allowance = modules.DefaultAllowance
+	startHeight := c.blockHeight
+	c.mu.Unlock()
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	c.mu.Lock()
+	c.allowance = modules.Allowance{}
+	c.mu.Unlock()
+	c.maintenanceLock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mine the formation txn while the contract is still in the set. That way
+	// the contractor doesn't recover it on its own once it is lost. Keep mining until the watchdog saw the contract on-chain since the txn
+	// might not make it into the first block.
+	err = build.Retry(50, 100*time.Millisecond, func() error {
+		if _, err := m.AddBlock(); err != nil {
+			return err
+		}
+		status, ok := c.staticWatchdog.managedContractStatus(contract.ID)
+		if !ok || !status.ContractFound {
+			return errors.New("formation txn wasn't mined yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// block the maintenance and wait for any recovery scan it started to
+	// finish. Otherwise the scan might find the contract after it was lost and
+	// the contractor would recover it right away.
+	c.maintenanceLock.Lock()
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if scanning, _ := c.RecoveryScanStatus(); scanning {
+			return errors.New("recovery scan still in progress")
+		}
+		return nil
+	})
+	if err != nil {
+		c.maintenanceLock.Unlock()
+		t.Fatal(err)
+	}
+
+	// lose the contract.
+	sc, ok := c.staticContracts.Acquire(contract.ID)
+	if !ok {
+		c.maintenanceLock.Unlock()
+		t.Fatal("contract not found")
+	}
+	c.staticContracts.Delete(sc)
+	c.mu.Lock()
+	delete(c.pubKeysToContractID, contract.HostPublicKey.String())
+	c.mu.Unlock()
+	c.maintenanceLock.Unlock()
+	return contract, startHeight
+}
+
+// announceHostAddress announces the host under the provided address and waits
+// for the hostdb to pick it up.
+func announceHostAddress(t *testing.T, h modules.Host, c *Contractor, m modules.TestMiner, address modules.NetAddress) {
+	if err := h.AnnounceAddress(address); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	err := build.Retry(100, 100*time.Millisecond, func() error {
+		hostEntry, _, err := c.hdb.Host(h.PublicKey())
+		if err != nil {
+			return err
+		}
+		if hostEntry.NetAddress != address {
+			return errors.New("hostdb didn't update the host's address")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRecoverContractHostAddressChanged tests that contract recovery dials the
+// address a host announced most recently and skips blocked hosts.
+func TestRecoverContractHostAddressChanged(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok, err := c.hdb.Host(h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host and lose it.
+	contract, startHeight := formAndLoseContract(t, c, m, hostEntry)
+
+
+	// announce the host under a different address.
+	newAddress := modules.NetAddress(net.JoinHostPort("127.0.0.1", hostEntry.NetAddress.Port()))
+	if newAddress == hostEntry.NetAddress {
+		newAddress = modules.NetAddress(net.JoinHostPort("localhost", hostEntry.NetAddress.Port()))
+	}
+	announceHostAddress(t, h, c, m, newAddress)
+	c.mu.RLock()
+	endHeight := c.blockHeight
+	c.mu.RUnlock()
+
+	// block the host. The contract should be found but not recovered.
+	if err := c.hdb.SetFilterMode(modules.HostDBActivateBlacklist, []types.SiaPublicKey{h.PublicKey()}); err != nil {
+		t.Fatal(err)
+	}
+	seed, _, err := c.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RecoverContractsFromSeed(seed, startHeight, endHeight); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.staticContracts.View(contract.ID); ok {
+		t.Fatal("contract with blocked host shouldn't have been recovered")
+	}
+	c.mu.RLock()
+	rc, pending := c.recoverableContracts[contract.ID]
+	c.mu.RUnlock()
+	if !pending {
+		t.Fatal("contract with blocked host should still be pending")
+	}
+	renterSeed := proto.DeriveRenterSeed(seed)
+	if err := c.managedRecoverContract(rc, renterSeed.EphemeralRenterSeed(rc.WindowStart), endHeight); err != errRecoveryHostBlocked {
+		t.Fatal("expected errRecoveryHostBlocked but got", err)
+	}
+
+	// unblock the host. The next attempt should recover the contract using
+	// the new address.
+	if err := c.hdb.SetFilterMode(modules.HostDBDisableFilter, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.maintenanceLock.Lock()
+	c.managedRecoverContracts(renterSeed)
+	c.maintenanceLock.Unlock()
+	if _, ok := c.staticContracts.View(contract.ID); !ok {
+		t.Fatal("contract wasn't recovered")
+	}
+	if rs := c.RecoveryStatus(); rs.ContractsPending != 0 {
+		t.Fatal("there shouldn't be any pending contracts", rs.ContractsPending)
+	}
+}
+
+// TestRecoverContractHostOffline tests that a contract whose host is offline
+// during the first recovery attempt is recovered by a later retry once the
+// host is reachable again.
+func TestRecoverContractHostOffline(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// get the host's entry from the db
+	hostEntry, ok, err := c.hdb.Host(h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host and lose it.
+	contract, startHeight := formAndLoseContract(t, c, m, hostEntry)
+
+	// take the host offline by announcing it under an address nobody listens
+	// on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offlineAddress := modules.NetAddress(l.Addr().String())
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	announceHostAddress(t, h, c, m, offlineAddress)
+	c.mu.RLock()
+	endHeight := c.blockHeight
+	c.mu.RUnlock()
+
+	// the first attempt should find the contract but fail to recover it.
+	seed, _, err := c.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RecoverContractsFromSeed(seed, startHeight, endHeight); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.staticContracts.View(contract.ID); ok {
+		t.Fatal("contract with offline host shouldn't have been recovered")
+	}
+	if rs := c.RecoveryStatus(); rs.ContractsPending != 1 {
+		t.Fatal("contract with offline host should still be pending", rs.ContractsPending)
+	}
+
+	// bring the host back online. The recovery loop should retry and recover
+	// the contract.
+	announceHostAddress(t, h, c, m, hostEntry.NetAddress)
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if _, ok := c.staticContracts.View(contract.ID); !ok {
+			return errors.New("contract wasn't recovered")
+		}
+		if rs := c.RecoveryStatus(); rs.ContractsPending != 0 {
+			return fmt.Errorf("%v contracts still pending", rs.ContractsPending)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
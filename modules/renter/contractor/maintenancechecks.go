@@ -28,6 +28,22 @@ func (c *Contractor) badContractCheck(u modules.ContractUtility) (modules.Contra
 	return u, false
 }
 
+// revertedContractCheck checks whether the formation transaction of the
+// contract was reverted and not confirmed again. Such a contract no longer
+// exists on-chain so GoodForUpload and GoodForRenew need to be set to false.
+func (c *Contractor) revertedContractCheck(contract modules.RenterContract) (modules.ContractUtility, bool) {
+	c.mu.RLock()
+	_, reverted := c.revertedContracts[contract.ID]
+	c.mu.RUnlock()
+	u := contract.Utility
+	if reverted {
+		u.GoodForUpload = false
+		u.GoodForRenew = false
+		return u, true
+	}
+	return u, false
+}
+
 // checkHostScore checks host scorebreakdown against minimum accepted scores.
 // forceUpdate is true if the utility change must be taken.
 func (c *Contractor) checkHostScore(contract modules.RenterContract, sb modules.HostScoreBreakdown, minScoreGFR, minScoreGFU types.Currency) (modules.ContractUtility, utilityUpdateStatus) {
@@ -104,6 +120,7 @@ func (c *Contractor) criticalUtilityChecks(contract modules.RenterContract, host
 	c.mu.RLock()
 	blockHeight := c.blockHeight
 	renewWindow := c.allowance.RenewWindow
+	jitter := c.allowance.RenewJitter
 	period := c.allowance.Period
 	c.mu.RUnlock()
 
@@ -112,12 +129,17 @@ func (c *Contractor) criticalUtilityChecks(contract modules.RenterContract, host
 		return u, needsUpdate
 	}
 
+	u, needsUpdate = c.revertedContractCheck(contract)
+	if needsUpdate {
+		return u, needsUpdate
+	}
+
 	u, needsUpdate = c.offlineCheck(contract, host)
 	if needsUpdate {
 		return u, needsUpdate
 	}
 
-	u, needsUpdate = c.upForRenewalCheck(contract, renewWindow, blockHeight)
+	u, needsUpdate = c.upForRenewalCheck(contract, renewWindow, jitter, blockHeight)
 	if needsUpdate {
 		return u, needsUpdate
 	}
@@ -176,11 +198,11 @@ func (c *Contractor) offlineCheck(contract modules.RenterContract, host modules.
 // upForRenewalCheck checks if this contract is up for renewal.
 // Returns true if a check fails and the utility returned must be used to update
 // the contract state.
-func (c *Contractor) upForRenewalCheck(contract modules.RenterContract, renewWindow, blockHeight types.BlockHeight) (modules.ContractUtility, bool) {
+func (c *Contractor) upForRenewalCheck(contract modules.RenterContract, renewWindow, jitter, blockHeight types.BlockHeight) (modules.ContractUtility, bool) {
 	u := contract.Utility
 	// Contract should not be used for uploading if the time has come to
 	// renew the contract.
-	if blockHeight+renewWindow >= contract.EndHeight {
+	if blockHeight+renewWindow >= contract.EndHeight+renewJitter(contract.ID, jitter) {
 		if u.GoodForUpload {
 			c.log.Println("Marking contract as not good for upload because it is time to renew the contract", contract.ID)
 		}
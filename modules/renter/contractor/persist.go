@@ -21,10 +21,13 @@ type contractorPersist struct {
 	LastChange           modules.ConsensusChangeID       `json:"lastchange"`
 	RecentRecoveryChange modules.ConsensusChangeID       `json:"recentrecoverychange"`
 	OldContracts         []modules.RenterContract        `json:"oldcontracts"`
+	OldContractRetention uint64                          `json:"oldcontractretention"`
+	ArchivedSpending     types.Currency                  `json:"archivedspending"`
 	DoubleSpentContracts map[string]types.BlockHeight    `json:"doublespentcontracts"`
 	RecoverableContracts []modules.RecoverableContract   `json:"recoverablecontracts"`
 	RenewedFrom          map[string]types.FileContractID `json:"renewedfrom"`
 	RenewedTo            map[string]types.FileContractID `json:"renewedto"`
+	RevertedContracts    map[string]types.BlockHeight    `json:"revertedcontracts"`
 	Synced               bool                            `json:"synced"`
 
 	// Subsystem persistence:
@@ -45,10 +48,13 @@ func (c *Contractor) persistData() contractorPersist {
 		BlockHeight:          c.blockHeight,
 		CurrentPeriod:        c.currentPeriod,
 		LastChange:           c.lastChange,
+		OldContractRetention: c.oldContractRetention,
+		ArchivedSpending:     c.archivedSpending,
 		RecentRecoveryChange: c.recentRecoveryChange,
 		RenewedFrom:          make(map[string]types.FileContractID),
 		RenewedTo:            make(map[string]types.FileContractID),
 		DoubleSpentContracts: make(map[string]types.BlockHeight),
+		RevertedContracts:    make(map[string]types.BlockHeight),
 		Synced:               synced,
 	}
 	for k, v := range c.renewedFrom {
@@ -66,6 +72,9 @@ func (c *Contractor) persistData() contractorPersist {
 	for _, contract := range c.recoverableContracts {
 		data.RecoverableContracts = append(data.RecoverableContracts, contract)
 	}
+	for fcID, height := range c.revertedContracts {
+		data.RevertedContracts[fcID.String()] = height
+	}
 	data.ChurnLimiter = c.staticChurnLimiter.callPersistData()
 	data.WatchdogData = c.staticWatchdog.callPersistData()
 	return data
@@ -110,6 +119,11 @@ func (c *Contractor) load() error {
 		close(c.synced)
 	}
 	c.recentRecoveryChange = data.RecentRecoveryChange
+	c.oldContractRetention = data.OldContractRetention
+	if c.oldContractRetention == 0 {
+		c.oldContractRetention = defaultOldContractRetention
+	}
+	c.archivedSpending = data.ArchivedSpending
 	var fcid types.FileContractID
 	for k, v := range data.RenewedFrom {
 		if err := fcid.LoadString(k); err != nil {
@@ -132,6 +146,12 @@ func (c *Contractor) load() error {
 		}
 		c.doubleSpentContracts[fcid] = height
 	}
+	for fcIDString, height := range data.RevertedContracts {
+		if err := fcid.LoadString(fcIDString); err != nil {
+			return err
+		}
+		c.revertedContracts[fcid] = height
+	}
 	for _, contract := range data.RecoverableContracts {
 		c.recoverableContracts[contract.ID] = contract
 	}
@@ -16,10 +16,18 @@ import (
 )
 
 // memPersist implements the persister interface in-memory.
-type memPersist contractorPersist
+type memPersist struct {
+	data    contractorPersist
+	archive []modules.RenterContract
+}
 
-func (m *memPersist) save(data contractorPersist) error { *m = memPersist(data); return nil }
-func (m memPersist) load(data *contractorPersist) error { *data = contractorPersist(m); return nil }
+func (m *memPersist) save(data contractorPersist) error  { m.data = data; return nil }
+func (m *memPersist) load(data *contractorPersist) error { *data = m.data; return nil }
+func (m *memPersist) saveArchive(contracts []modules.RenterContract) error {
+	m.archive = contracts
+	return nil
+}
+func (m *memPersist) loadArchive() ([]modules.RenterContract, error) { return m.archive, nil }
 
 // TestSaveLoad tests that the contractor can save and load itself.
 func TestSaveLoad(t *testing.T) {
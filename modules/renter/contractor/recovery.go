@@ -1,8 +1,10 @@
 package contractor
 
 import (
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
@@ -13,6 +15,24 @@ import (
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
+var (
+	// errInvalidRecoveryRange is returned by RecoverContractsFromSeed if the
+	// provided range of blocks is invalid.
+	errInvalidRecoveryRange = errors.New("invalid range of blocks to scan for recoverable contracts")
+
+	// errRecoveryHostBlocked is returned if the host of a recoverable
+	// contract is blocked by the hostdb's filter.
+	errRecoveryHostBlocked = errors.New("can't recover contract with blocked host")
+
+	// errRecoveryHostNotAnnounced is returned if the host of a recoverable
+	// contract hasn't announced a net address.
+	errRecoveryHostNotAnnounced = errors.New("can't recover contract with host that isn't announced")
+
+	// errRecoveryHostUnknown is returned if the host of a recoverable contract
+	// isn't in the hostdb.
+	errRecoveryHostUnknown = errors.New("can't recover contract with unknown host")
+)
+
 // TODO If we already have an active contract with a host for
 // which we also have a recoverable contract, we might want to
 // handle that somehow. For now we probably want to ignore a
@@ -95,14 +115,50 @@ func (rs *recoveryScanner) ProcessConsensusChange(cc modules.ConsensusChange) {
 	rs.c.mu.Unlock()
 }
 
+// validFCIdentifier returns the host key of the first identifier that was
+// created using the provided seed.
+func (c *Contractor) validFCIdentifier(rs proto.EphemeralRenterSeed, txn types.Transaction, ids []fcIdentifier) (types.SiaPublicKey, bool) {
+	for _, id := range ids {
+		hostKey, valid, err := id.csi.IsValid(rs, txn, id.encryptedHostKey)
+		if err != nil && !errors.Contains(err, proto.ErrCSIDoesNotMatchSeed) {
+			c.log.Println("WARN: error validating the identifier:", err)
+			continue
+		}
+		if valid {
+			return hostKey, true
+		}
+	}
+	return types.SiaPublicKey{}, false
+}
+
 // findRecoverableContracts scans the block for contracts that could
 // potentially be recovered. We are not going to recover them right away though
 // since many of them could already be expired. Recovery happens periodically
 // in threadedContractMaintenance.
 func (c *Contractor) findRecoverableContracts(renterSeed proto.RenterSeed, b types.Block) {
+	rcs, matched := c.recoverableContractsInBlock(renterSeed, b)
+	atomic.AddUint64(&c.atomicRecoveryIdentifiersMatched, matched)
+	for _, rc := range rcs {
+		// Make sure we don't already track that contract as recoverable.
+		if _, known := c.recoverableContracts[rc.ID]; known {
+			continue
+		}
+		// Mark the contract for recovery and wake up the recovery loop.
+		c.recoverableContracts[rc.ID] = rc
+		select {
+		case c.recoveryWakeChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// recoverableContractsInBlock returns the contracts within the block which
+// were formed using renterSeed and which aren't in the contract set yet. It
+// also returns the number of contracts whose identifiers matched the seed.
+func (c *Contractor) recoverableContractsInBlock(renterSeed proto.RenterSeed, b types.Block) (rcs []modules.RecoverableContract, matched uint64) {
 	for _, txn := range b.Transactions {
-		// Check if the arbitrary data starts with the correct prefix.
-		csi, encryptedHostKey, hasIdentifier := hasFCIdentifier(txn)
+		// Check if the arbitrary data contains any known identifiers.
+		ids, hasIdentifier := hasFCIdentifier(txn)
 		if !hasIdentifier {
 			continue
 		}
@@ -117,15 +173,12 @@ func (c *Contractor) findRecoverableContracts(renterSeed proto.RenterSeed, b typ
 			// afterwards.
 			rs := renterSeed.EphemeralRenterSeed(fc.WindowStart)
 			defer fastrand.Read(rs[:])
-			// Validate the identifier.
-			hostKey, valid, err := csi.IsValid(rs, txn, encryptedHostKey)
-			if err != nil && !errors.Contains(err, proto.ErrCSIDoesNotMatchSeed) {
-				c.log.Println("WARN: error validating the identifier:", err)
-				continue
-			}
+			// Validate the identifiers.
+			hostKey, valid := c.validFCIdentifier(rs, txn, ids)
 			if !valid {
 				continue
 			}
+			matched++
 			// Make sure the contract belongs to us by comparing the unlock
 			// hash to what we would expect.
 			ourSK, ourPK := proto.GenerateKeyPair(rs, txn)
@@ -146,35 +199,71 @@ func (c *Contractor) findRecoverableContracts(renterSeed proto.RenterSeed, b typ
 			if known {
 				continue
 			}
-			// Make sure we don't already track that contract as recoverable.
-			_, known = c.recoverableContracts[fcid]
-			if known {
-				continue
-			}
-
-			// Mark the contract for recovery.
-			c.recoverableContracts[fcid] = modules.RecoverableContract{
+			rcs = append(rcs, modules.RecoverableContract{
 				FileContract:  fc,
 				ID:            fcid,
 				HostPublicKey: hostKey,
 				InputParentID: txn.SiacoinInputs[0].ParentID,
 				TxnFee:        txnFee,
 				StartHeight:   c.blockHeight - 1, // Assume that it takes 1 block to mine the contract
-			}
+			})
 		}
 	}
+	return rcs, matched
+}
+
+// PreviewRecovery returns the contracts within the block which were formed
+// using seed and which the contractor would attempt to recover. It performs
+// the same matching and validation as a recovery but doesn't contact any
+// hosts, which allows for checking what a recovery would do before spending
+// any bandwidth or money on it.
+func (c *Contractor) PreviewRecovery(seed modules.Seed, b types.Block) []modules.RecoverableContract {
+	if err := c.tg.Add(); err != nil {
+		return nil
+	}
+	defer c.tg.Done()
+	// Get the renter seed and wipe it once we are done with it.
+	renterSeed := proto.DeriveRenterSeed(seed)
+	defer fastrand.Read(renterSeed[:])
+
+	c.mu.RLock()
+	blockHeight := c.blockHeight
+	found, _ := c.recoverableContractsInBlock(renterSeed, b)
+	c.mu.RUnlock()
+
+	// Skip the contracts managedRecoverContracts wouldn't attempt to recover.
+	var rcs []modules.RecoverableContract
+	for _, rc := range found {
+		if blockHeight >= rc.WindowEnd {
+			continue
+		}
+		if _, exists := c.managedContractByPublicKey(rc.HostPublicKey); exists {
+			continue
+		}
+		rcs = append(rcs, rc)
+	}
+	return rcs
 }
 
 // managedRecoverContract recovers a single contract by contacting the host it
 // was formed with and retrieving the latest revision and sector roots.
 func (c *Contractor) managedRecoverContract(rc modules.RecoverableContract, rs proto.EphemeralRenterSeed, blockHeight types.BlockHeight) error {
-	// Get the corresponding host.
+	// Get the corresponding host. The recoverable contract only contains the
+	// host's public key so we need to dial the address the host most recently
+	// announced. Hosts which aren't announced or are blocked are skipped and
+	// retried by the next recovery attempt.
 	host, ok, err := c.hdb.Host(rc.HostPublicKey)
 	if err != nil {
 		return errors.AddContext(err, "error getting host from hostdb:")
 	}
 	if !ok {
-		return errors.New("Can't recover contract with unknown host")
+		return errRecoveryHostUnknown
+	}
+	if host.Filtered {
+		return errRecoveryHostBlocked
+	}
+	if host.NetAddress == "" {
+		return errRecoveryHostNotAnnounced
 	}
 	// Generate the secret key for the handshake and wipe it after using it.
 	sk, _ := proto.GenerateKeyPairWithOutputID(rs, rc.InputParentID)
@@ -184,7 +273,12 @@ func (c *Contractor) managedRecoverContract(rc modules.RecoverableContract, rs p
 	if err != nil {
 		return err
 	}
-	defer s.Close()
+	defer func() {
+		// Account for the bandwidth used by the recovery.
+		read, written := s.BandwidthUsed()
+		atomic.AddUint64(&c.atomicRecoveryBandwidth, read+written)
+		s.Close()
+	}()
 	// Get the most recent revision.
 	rev, sigs, err := s.Lock(rc.ID, sk)
 	if err != nil {
@@ -195,18 +289,21 @@ func (c *Contractor) managedRecoverContract(rc modules.RecoverableContract, rs p
 		FileContractRevisions: []types.FileContractRevision{rev},
 		TransactionSignatures: sigs,
 	}
-	// Get the merkle roots.
+	// Get the merkle roots. Downloading them is paid for with the contract's
+	// funds which is tracked as download spending of the contract.
 	var roots []crypto.Hash
+	downloadSpending := types.ZeroCurrency
 	if rev.NewFileSize > 0 {
 		// TODO Followup: take host max download batch size into account.
 		revTxn, roots, err = s.RecoverSectorRoots(rev, sk)
 		if err != nil {
 			return err
 		}
+		downloadSpending = rev.RenterFunds().Sub(revTxn.FileContractRevisions[0].RenterFunds())
 	}
 
 	// Insert the contract into the set.
-	contract, err := c.staticContracts.InsertContract(rc, revTxn, roots, sk)
+	contract, err := c.staticContracts.InsertContract(rc, revTxn, roots, sk, downloadSpending)
 	if err != nil {
 		return err
 	}
@@ -238,6 +335,52 @@ func (c *Contractor) managedRecoverContract(rc modules.RecoverableContract, rs p
 	return err
 }
 
+// RecoverContractsFromSeed scans the blocks between startHeight and endHeight
+// for contracts formed with seed and tries to recover them right away.
+// Contracts which can't be recovered yet are retried by the contract
+// maintenance like contracts found by a full recovery scan.
+func (c *Contractor) RecoverContractsFromSeed(seed modules.Seed, startHeight, endHeight types.BlockHeight) error {
+	if err := c.tg.Add(); err != nil {
+		return err
+	}
+	defer c.tg.Done()
+	c.mu.RLock()
+	blockHeight := c.blockHeight
+	c.mu.RUnlock()
+	if startHeight > endHeight {
+		return errors.AddContext(errInvalidRecoveryRange, "startHeight is greater than endHeight")
+	}
+	if endHeight > blockHeight {
+		return errors.AddContext(errInvalidRecoveryRange, fmt.Sprintf("endHeight is greater than the current blockheight %v", blockHeight))
+	}
+	// Get the renter seed and wipe it once we are done with it.
+	renterSeed := proto.DeriveRenterSeed(seed)
+	defer fastrand.Read(renterSeed[:])
+
+	// Scan the blocks for recoverable contracts.
+	for height := startHeight; height <= endHeight; height++ {
+		select {
+		case <-c.tg.StopChan():
+			return errors.New("contractor was stopped during the scan")
+		default:
+		}
+		block, exists := c.cs.BlockAtHeight(height)
+		if !exists {
+			return fmt.Errorf("block at height %v not found", height)
+		}
+		c.mu.Lock()
+		c.findRecoverableContracts(renterSeed, block)
+		c.mu.Unlock()
+	}
+
+	// Try to recover the contracts. Hold the maintenance lock to avoid
+	// recovering contracts at the same time as the contract maintenance.
+	c.maintenanceLock.Lock()
+	defer c.maintenanceLock.Unlock()
+	c.managedRecoverContracts(renterSeed)
+	return nil
+}
+
 // callRecoverContracts recovers known recoverable contracts.
 func (c *Contractor) callRecoverContracts() {
 	if c.staticDeps.Disrupt("DisableContractRecovery") {
@@ -252,6 +395,45 @@ func (c *Contractor) callRecoverContracts() {
 	// Get the renter seed and wipe it once we are done with it.
 	renterSeed := proto.DeriveRenterSeed(ws)
 	defer fastrand.Read(renterSeed[:])
+	c.managedRecoverContracts(renterSeed)
+}
+
+// threadedRecoverContractsLoop recovers the known recoverable contracts
+// whenever new ones are found and retries the recovery every
+// recoveryRetryInterval. Block processing only finds recoverable contracts, so
+// contacting the hosts never blocks consensus updates and failed recoveries are
+// retried even if no new blocks arrive.
+func (c *Contractor) threadedRecoverContractsLoop() {
+	if err := c.tg.Add(); err != nil {
+		return
+	}
+	defer c.tg.Done()
+	for {
+		select {
+		case <-c.tg.StopChan():
+			return
+		case <-c.recoveryWakeChan:
+		case <-time.After(recoveryRetryInterval):
+		}
+		c.mu.RLock()
+		pending := len(c.recoverableContracts)
+		c.mu.RUnlock()
+		if pending == 0 {
+			continue
+		}
+		// If the contract maintenance is running it will recover the
+		// contracts itself.
+		if !c.maintenanceLock.TryLock() {
+			continue
+		}
+		c.callRecoverContracts()
+		c.maintenanceLock.Unlock()
+	}
+}
+
+// managedRecoverContracts tries to recover the known recoverable contracts
+// using the provided renter seed.
+func (c *Contractor) managedRecoverContracts(renterSeed proto.RenterSeed) {
 	// Copy necessary fields to avoid having to hold the lock for too long.
 	c.mu.RLock()
 	blockHeight := c.blockHeight
@@ -277,6 +459,13 @@ func (c *Contractor) callRecoverContracts() {
 					blockHeight, rc.WindowEnd, rc.ID)
 				return
 			}
+			// No need to recover a contract that we already know about. This
+			// makes recovery idempotent if the same contract is found twice.
+			if _, known := c.staticContracts.View(rc.ID); known {
+				deleteContract[j] = true
+				c.log.Debugln("Not recovering contract since it is already in the contract set", rc.ID)
+				return
+			}
 			// Check if we already have an active contract with the host.
 			_, exists := c.managedContractByPublicKey(rc.HostPublicKey)
 			if exists {
@@ -302,6 +491,7 @@ func (c *Contractor) callRecoverContracts() {
 			}
 			// Recovery was successful.
 			deleteContract[j] = true
+			atomic.AddUint64(&c.atomicRecoveredContracts, 1)
 			c.log.Println("Successfully recovered contract", rc.ID)
 		}(i, recoverableContract)
 	}
@@ -317,7 +507,7 @@ func (c *Contractor) callRecoverContracts() {
 			c.log.Println("Deleted contract from recoverable contracts:", rc.ID)
 		}
 	}
-	err = c.save()
+	err := c.save()
 	if err != nil {
 		c.log.Println("Unable to save while recovering contracts:", err)
 	}
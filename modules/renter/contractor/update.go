@@ -9,27 +9,70 @@ import (
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
-// hasFCIdentifier checks the transaction for a ContractSignedIdentifier and
-// returns the first one it finds with a bool indicating if an identifier was
-// found.
-func hasFCIdentifier(txn types.Transaction) (proto.ContractSignedIdentifier, crypto.Ciphertext, bool) {
+// fcIdentifierVersions is the registry of known contract identifier formats.
+// New formats are added by registering their prefix together with a parser.
+// Older formats need to stay in the registry to be able to recover contracts
+// that were formed using them.
+var fcIdentifierVersions = []fcIdentifierVersion{
+	// The original format used PrefixNonSia to hide the identifier from
+	// the transaction pool's arbitrary data filter.
+	{prefix: modules.PrefixNonSia, parse: parseFCIdentifierV1},
+	{prefix: modules.PrefixFileContractIdentifier, parse: parseFCIdentifierV1},
+}
+
+type (
+	// fcIdentifier is a ContractSignedIdentifier together with the encrypted
+	// host key found in the arbitrary data of a transaction.
+	fcIdentifier struct {
+		csi              proto.ContractSignedIdentifier
+		encryptedHostKey crypto.Ciphertext
+	}
+
+	// fcIdentifierVersion is a known version of the contract identifier
+	// format. The parser is called for arbitrary data starting with the
+	// prefix.
+	fcIdentifierVersion struct {
+		prefix types.Specifier
+		parse  func(data []byte) (fcIdentifier, bool)
+	}
+)
+
+// parseFCIdentifierV1 parses an identifier which consists of the prefix, the
+// identifier and its signature followed by the encrypted host key.
+func parseFCIdentifierV1(data []byte) (fcIdentifier, bool) {
 	// We don't verify the host key here so we only need to make sure the
 	// identifier fits into the arbitrary data.
-	if len(txn.ArbitraryData) != 1 || len(txn.ArbitraryData[0]) < proto.FCSignedIdentiferSize {
-		return proto.ContractSignedIdentifier{}, nil, false
-	}
-	// Verify the prefix.
-	var prefix types.Specifier
-	copy(prefix[:], txn.ArbitraryData[0])
-	if prefix != modules.PrefixFileContractIdentifier &&
-		prefix != modules.PrefixNonSia {
-		return proto.ContractSignedIdentifier{}, nil, false
-	}
-	// We found an identifier.
-	var csi proto.ContractSignedIdentifier
-	n := copy(csi[:], txn.ArbitraryData[0])
-	hostKey := txn.ArbitraryData[0][n:]
-	return csi, hostKey, true
+	if len(data) < proto.FCSignedIdentiferSize {
+		return fcIdentifier{}, false
+	}
+	var id fcIdentifier
+	n := copy(id.csi[:], data)
+	id.encryptedHostKey = data[n:]
+	return id, true
+}
+
+// hasFCIdentifier checks the arbitrary data of the transaction for
+// ContractSignedIdentifiers of any known version and returns all of them in
+// the order they appear in, with a bool indicating if an identifier was found.
+func hasFCIdentifier(txn types.Transaction) ([]fcIdentifier, bool) {
+	var ids []fcIdentifier
+	for _, data := range txn.ArbitraryData {
+		if len(data) < types.SpecifierLen {
+			continue
+		}
+		var prefix types.Specifier
+		copy(prefix[:], data)
+		for _, version := range fcIdentifierVersions {
+			if prefix != version.prefix {
+				continue
+			}
+			if id, ok := version.parse(data); ok {
+				ids = append(ids, id)
+			}
+			break
+		}
+	}
+	return ids, len(ids) > 0
 }
 
 // managedArchiveContracts will figure out which contracts are no longer needed
@@ -43,24 +86,43 @@ func (c *Contractor) managedArchiveContracts() {
 	// Loop through the current set of contracts and migrate any expired ones to
 	// the set of old contracts.
 	var expired []types.FileContractID
+	var archived []modules.RenterContract
 	for _, contract := range c.staticContracts.ViewAll() {
 		// Check map of renewedTo in case renew code was interrupted before
 		// archiving old contract
 		c.mu.RLock()
 		_, renewed := c.renewedTo[contract.ID]
 		c.mu.RUnlock()
-		if currentHeight > contract.EndHeight || renewed {
+		// Contracts whose formation was reverted and not confirmed again
+		// within waitTime blocks won't be confirmed anymore since the
+		// watchdog double-spends their formation transaction.
+		c.mu.RLock()
+		revertHeight, reverted := c.revertedContracts[contract.ID]
+		c.mu.RUnlock()
+		unconfirmed := reverted && currentHeight > revertHeight+waitTime
+		if currentHeight > contract.EndHeight || renewed || unconfirmed {
 			id := contract.ID
 			c.mu.Lock()
 			c.oldContracts[id] = contract
 			c.mu.Unlock()
 			expired = append(expired, id)
+			archived = append(archived, contract)
 			c.log.Println("INFO: archived expired contract", id)
 		}
 	}
 
-	// Save.
+	// Forget about reverted contracts which are archived or no longer part of
+	// the contract set and save. This needs to happen before the expired
+	// contracts are deleted to not lose them if we crash in between.
 	c.mu.Lock()
+	for _, id := range expired {
+		delete(c.revertedContracts, id)
+	}
+	for fcid := range c.revertedContracts {
+		if _, exists := c.staticContracts.View(fcid); !exists {
+			delete(c.revertedContracts, fcid)
+		}
+	}
 	c.save()
 	c.mu.Unlock()
 
@@ -70,6 +132,79 @@ func (c *Contractor) managedArchiveContracts() {
 			c.staticContracts.Delete(sc)
 		}
 	}
+
+	// Move contracts which expired a long time ago to the archive.
+	if err := c.managedPruneOldContracts(); err != nil {
+		c.log.Println("WARN: failed to prune old contracts:", err)
+	}
+
+	c.managedNotifyArchived(archived...)
+}
+
+// managedNotifyArchived calls the archive callbacks with the final state of
+// the archived contracts. Every code path which adds a contract to the
+// oldContracts needs to call it after releasing the lock to allow the
+// callbacks to call back into the contractor.
+func (c *Contractor) managedNotifyArchived(contracts ...modules.RenterContract) {
+	c.mu.RLock()
+	callbacks := c.archiveCallbacks
+	c.mu.RUnlock()
+	for _, contract := range contracts {
+		for _, fn := range callbacks {
+			fn(contract)
+		}
+	}
+}
+
+// OnContractArchived registers a callback which is called with the final state
+// of every contract that is archived, either because it expired or because it
+// was renewed. The callbacks are called synchronously but without holding the
+// contractor's lock, so they can safely call methods of the contractor.
+func (c *Contractor) OnContractArchived(fn func(modules.RenterContract)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.archiveCallbacks = append(c.archiveCallbacks, fn)
+}
+
+// markRevertedContracts adds all the contracts of the contract set which were
+// formed in the reverted block b to the revertedContracts.
+func (c *Contractor) markRevertedContracts(b types.Block) {
+	for _, txn := range b.Transactions {
+		for i := range txn.FileContracts {
+			fcid := txn.FileContractID(uint64(i))
+			if _, exists := c.staticContracts.View(fcid); !exists {
+				continue
+			}
+			c.log.Println("Formation of contract was reverted:", fcid)
+			c.revertedContracts[fcid] = c.blockHeight
+		}
+	}
+}
+
+// unmarkRevertedContracts removes all the contracts which were formed in the
+// applied block b from the revertedContracts.
+func (c *Contractor) unmarkRevertedContracts(b types.Block) {
+	for _, txn := range b.Transactions {
+		for i := range txn.FileContracts {
+			delete(c.revertedContracts, txn.FileContractID(uint64(i)))
+		}
+	}
+}
+
+// managedMarkRevertedContractUtility marks a reverted contract as !GFU and
+// !GFR.
+func (c *Contractor) managedMarkRevertedContractUtility(fcid types.FileContractID) {
+	contract, exists := c.staticContracts.View(fcid)
+	if !exists {
+		return
+	}
+	u, needsUpdate := c.revertedContractCheck(contract)
+	if !needsUpdate || (!contract.Utility.GoodForUpload && !contract.Utility.GoodForRenew) {
+		return
+	}
+	if err := c.managedAcquireAndUpdateContractUtility(fcid, u); err != nil {
+		c.log.Println("Unable to update utility of reverted contract:", err)
+	}
 }
 
 // ProcessConsensusChange will be called by the consensus set every time there
@@ -96,11 +231,15 @@ func (c *Contractor) ProcessConsensusChange(cc modules.ConsensusChange) {
 		}
 		// Remove recoverable contracts found in reverted block.
 		c.removeRecoverableContracts(block)
+		// Remember the contracts which are no longer on-chain.
+		c.markRevertedContracts(block)
 	}
 	for _, block := range cc.AppliedBlocks {
 		if block.ID() != types.GenesisID {
 			c.blockHeight++
 		}
+		// Contracts which were reverted might be confirmed again.
+		c.unmarkRevertedContracts(block)
 		// Find lost contracts for recovery.
 		if haveSeed {
 			c.findRecoverableContracts(renterSeed, block)
@@ -155,8 +294,18 @@ func (c *Contractor) ProcessConsensusChange(cc modules.ConsensusChange) {
 	if err != nil {
 		c.log.Println("Unable to save while processing a consensus change:", err)
 	}
+	reverted := make([]types.FileContractID, 0, len(c.revertedContracts))
+	for fcid := range c.revertedContracts {
+		reverted = append(reverted, fcid)
+	}
 	c.mu.Unlock()
 
+	// Contracts which are not on-chain anymore shouldn't be used until they
+	// are confirmed again.
+	for _, fcid := range reverted {
+		c.managedMarkRevertedContractUtility(fcid)
+	}
+
 	// Add to churnLimiter budget.
 	numBlocksAdded := len(cc.AppliedBlocks) - len(cc.RevertedBlocks)
 	c.staticChurnLimiter.callBumpChurnBudget(numBlocksAdded, c.allowance.Period)
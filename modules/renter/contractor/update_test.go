@@ -1,6 +1,8 @@
 package contractor
 
 import (
+	"bytes"
+	"io/ioutil"
 	"testing"
 	"time"
 
@@ -10,6 +12,8 @@ import (
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/proto"
+	"gitlab.com/NebulousLabs/Sia/persist"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
@@ -214,3 +218,392 @@ func TestIntegrationRenewInvalidate(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestRevertedContractFormation tests that a contract is marked !GFU and !GFR
+// when the block containing its formation transaction is reverted and that it
+// is forgotten about once the block is applied again.
+func TestRevertedContractFormation(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// acquire the contract maintenance lock for the duration of the test. This
+	// prevents theadedContractMaintenance from running.
+	c.maintenanceLock.Lock()
+	defer c.maintenanceLock.Unlock()
+
+	// get the host's entry from the db
+	hostEntry, ok, err := c.hdb.Host(h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// set an allowance but don't use SetAllowance to avoid automatic contract
+	// formation.
+	c.mu.Lock()
+	c.allowance = modules.DefaultAllowance
+	c.mu.Unlock()
+
+	// form a contract with the host and mine the formation transaction.
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, ok := c.ContractUtility(contract.HostPublicKey)
+	if !ok || !u.GoodForUpload || !u.GoodForRenew {
+		t.Fatal("new contract should be GFU and GFR", u)
+	}
+
+	// revert the block. The contract should be marked as reverted.
+	c.ProcessConsensusChange(modules.ConsensusChange{RevertedBlocks: []types.Block{b}})
+	c.mu.RLock()
+	_, reverted := c.revertedContracts[contract.ID]
+	c.mu.RUnlock()
+	if !reverted {
+		t.Fatal("contract wasn't marked as reverted")
+	}
+	u, ok = c.ContractUtility(contract.HostPublicKey)
+	if !ok || u.GoodForUpload || u.GoodForRenew {
+		t.Fatal("reverted contract should be !GFU and !GFR", u)
+	}
+
+	// apply the block again. The contract is no longer reverted.
+	c.ProcessConsensusChange(modules.ConsensusChange{AppliedBlocks: []types.Block{b}})
+	c.mu.RLock()
+	_, reverted = c.revertedContracts[contract.ID]
+	c.mu.RUnlock()
+	if reverted {
+		t.Fatal("contract is still marked as reverted")
+	}
+}
+
+// TestRevertedContractCleanup tests that reverted contracts are persisted and
+// that contracts whose formation isn't confirmed again are archived.
+func TestRevertedContractCleanup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, m, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// acquire the contract maintenance lock for the duration of the test. This
+	// prevents theadedContractMaintenance from running.
+	c.maintenanceLock.Lock()
+	defer c.maintenanceLock.Unlock()
+
+	// get the host's entry from the db
+	hostEntry, ok, err := c.hdb.Host(h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// set an allowance but don't use SetAllowance to avoid automatic contract
+	// formation.
+	c.mu.Lock()
+	c.allowance = modules.DefaultAllowance
+	c.mu.Unlock()
+
+	// form a contract, mine the formation transaction and revert the block.
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ProcessConsensusChange(modules.ConsensusChange{RevertedBlocks: []types.Block{b}})
+	c.mu.RLock()
+	revertHeight, reverted := c.revertedContracts[contract.ID]
+	c.mu.RUnlock()
+	if !reverted {
+		t.Fatal("contract wasn't marked as reverted")
+	}
+
+	// the reverted contracts should be persisted.
+	var data contractorPersist
+	if err := c.persist.load(&data); err != nil {
+		t.Fatal(err)
+	}
+	height, reverted := data.RevertedContracts[contract.ID.String()]
+	if !reverted || height != revertHeight {
+		t.Fatal("reverted contract wasn't persisted", reverted, height, revertHeight)
+	}
+
+	// the contract is kept until the watchdog would have double-spent its
+	// formation transaction.
+	c.mu.Lock()
+	c.blockHeight = revertHeight + waitTime
+	c.mu.Unlock()
+	c.managedArchiveContracts()
+	if _, exists := c.staticContracts.View(contract.ID); !exists {
+		t.Fatal("reverted contract was archived too early")
+	}
+
+	// afterwards it is archived and forgotten about.
+	c.mu.Lock()
+	c.blockHeight = revertHeight + waitTime + 1
+	c.mu.Unlock()
+	c.managedArchiveContracts()
+	if _, exists := c.staticContracts.View(contract.ID); exists {
+		t.Fatal("unconfirmed contract wasn't archived")
+	}
+	if _, exists := c.OldContract(contract.ID); !exists {
+		t.Fatal("unconfirmed contract isn't an old contract")
+	}
+	c.mu.RLock()
+	_, reverted = c.revertedContracts[contract.ID]
+	c.mu.RUnlock()
+	if reverted {
+		t.Fatal("archived contract is still marked as reverted")
+	}
+}
+
+// TestOnContractArchived tests that the archive callbacks are called for
+// renewed and expired contracts and that they can call back into the
+// contractor.
+func TestOnContractArchived(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// acquire the contract maintenance lock for the duration of the test. This
+	// prevents theadedContractMaintenance from running.
+	c.maintenanceLock.Lock()
+	defer c.maintenanceLock.Unlock()
+
+	hostEntry, ok, err := c.hdb.Host(h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+	c.mu.Lock()
+	c.allowance = modules.DefaultAllowance
+	c.mu.Unlock()
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Register a callback which calls back into the contractor.
+	var archived []modules.RenterContract
+	c.OnContractArchived(func(rc modules.RenterContract) {
+		c.OnContractArchived(func(modules.RenterContract) {})
+		archived = append(archived, rc)
+	})
+
+	// Nothing is archived before the contract expires.
+	c.managedArchiveContracts()
+	if len(archived) != 0 {
+		t.Fatal("callback called for active contract")
+	}
+
+	// Renew the contract. The old contract is archived by the renewal.
+	err = c.managedAcquireAndUpdateContractUtility(contract.ID, modules.ContractUtility{GoodForRenew: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.RLock()
+	allowance, blockHeight := c.allowance, c.blockHeight
+	c.mu.RUnlock()
+	renewal := fileContractRenewal{id: contract.ID, amount: types.SiacoinPrecision.Mul64(50)}
+	if _, err := c.managedRenewContract(renewal, blockHeight, allowance, blockHeight, blockHeight+200); err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 1 || archived[0].ID != contract.ID {
+		t.Fatal("callback wasn't called for the renewed contract", archived)
+	}
+	if _, ok := c.OldContract(contract.ID); !ok {
+		t.Fatal("renewed contract wasn't archived")
+	}
+	contracts := c.Contracts()
+	if len(contracts) != 1 {
+		t.Fatal("expected 1 contract after renewal but got", len(contracts))
+	}
+	renewed := contracts[0]
+
+	// Expire the renewed contract.
+	c.mu.Lock()
+	c.blockHeight = renewed.EndHeight + 1
+	c.mu.Unlock()
+	c.managedArchiveContracts()
+	if len(archived) != 2 || archived[1].ID != renewed.ID {
+		t.Fatal("callback wasn't called for the expired contract", archived)
+	}
+	if _, ok := c.OldContract(renewed.ID); !ok {
+		t.Fatal("contract wasn't archived")
+	}
+}
+
+// TestOnContractUtilityChanged tests that the utility callbacks are only called
+// if the GoodForRenew utility of a contract changes.
+func TestOnContractUtilityChanged(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	defer c.Close()
+
+	// acquire the contract maintenance lock for the duration of the test. This
+	// prevents theadedContractMaintenance from running.
+	c.maintenanceLock.Lock()
+	defer c.maintenanceLock.Unlock()
+
+	hostEntry, ok, err := c.hdb.Host(h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+	c.mu.Lock()
+	c.allowance = modules.DefaultAllowance
+	c.mu.Unlock()
+	_, contract, err := c.managedNewContract(hostEntry, types.SiacoinPrecision.Mul64(50), c.blockHeight+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goodUtility := modules.ContractUtility{GoodForUpload: true, GoodForRenew: true}
+	if err := c.managedAcquireAndUpdateContractUtility(contract.ID, goodUtility); err != nil {
+		t.Fatal(err)
+	}
+
+	var changed []modules.RenterContract
+	c.OnContractUtilityChanged(func(rc modules.RenterContract) {
+		changed = append(changed, rc)
+	})
+
+	// Updating the utility without changing GoodForRenew doesn't call the
+	// callback.
+	goodUtility.GoodForUpload = false
+	if err := c.managedAcquireAndUpdateContractUtility(contract.ID, goodUtility); err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 {
+		t.Fatal("callback called without GoodForRenew change", changed)
+	}
+
+	// Marking the contract bad calls the callback with the updated contract.
+	if err := c.MarkContractBad(contract.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 1 || changed[0].ID != contract.ID {
+		t.Fatal("callback wasn't called for the changed contract", changed)
+	}
+	if changed[0].Utility.GoodForRenew {
+		t.Fatal("callback was called with the old utility")
+	}
+}
+
+// TestHasFCIdentifierMixedVersions tests that identifiers of all known
+// versions are found in the arbitrary data of a transaction and that the
+// identifier created with our seed is recognized among them.
+func TestHasFCIdentifierMixedVersions(t *testing.T) {
+	c := &Contractor{
+		log: persist.NewLogger(ioutil.Discard),
+	}
+	txn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID(crypto.Hash{1})}},
+	}
+	hostKey := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       fastrand.Bytes(crypto.PublicKeySize),
+	}
+	var seed proto.RenterSeed
+	fastrand.Read(seed[:])
+	rs := seed.EphemeralRenterSeed(0)
+	csi, encryptedHostKey := proto.PrefixedSignedIdentifier(rs, txn, hostKey)
+
+	// Create identifiers of a different seed for both versions.
+	var otherSeed proto.RenterSeed
+	fastrand.Read(otherSeed[:])
+	otherCSI, otherHostKey := proto.PrefixedSignedIdentifier(otherSeed.EphemeralRenterSeed(0), txn, hostKey)
+	otherV1 := append(otherCSI[:], otherHostKey...)
+	otherV2 := append([]byte(nil), otherV1...)
+	copy(otherV2, modules.PrefixFileContractIdentifier[:])
+
+	// Create our identifier with the newer prefix.
+	ours := append(csi[:], encryptedHostKey...)
+	copy(ours, modules.PrefixFileContractIdentifier[:])
+
+	// Mix the identifiers with data that isn't an identifier.
+	txn.ArbitraryData = [][]byte{
+		append(modules.PrefixHostAnnouncement[:], fastrand.Bytes(100)...),
+		otherV1,
+		modules.PrefixNonSia[:],
+		fastrand.Bytes(8),
+		ours,
+		otherV2,
+	}
+	ids, found := hasFCIdentifier(txn)
+	if !found || len(ids) != 3 {
+		t.Fatalf("expected 3 identifiers but got %v", len(ids))
+	}
+	for i, data := range [][]byte{otherV1, ours, otherV2} {
+		if !bytes.Equal(ids[i].csi[:], data[:proto.FCSignedIdentiferSize]) {
+			t.Fatal("wrong identifier", i)
+		}
+		if !bytes.Equal(ids[i].encryptedHostKey, data[proto.FCSignedIdentiferSize:]) {
+			t.Fatal("wrong host key", i)
+		}
+	}
+	hk, valid := c.validFCIdentifier(rs, txn, ids)
+	if !valid {
+		t.Fatal("our identifier wasn't recognized")
+	}
+	if !hk.Equals(hostKey) {
+		t.Fatal("wrong host key was decrypted")
+	}
+
+	// Without our identifier nothing should be recognized.
+	txn.ArbitraryData = [][]byte{otherV1, otherV2}
+	ids, found = hasFCIdentifier(txn)
+	if !found || len(ids) != 2 {
+		t.Fatalf("expected 2 identifiers but got %v", len(ids))
+	}
+	if _, valid := c.validFCIdentifier(rs, txn, ids); valid {
+		t.Fatal("identifier of other seed shouldn't be valid")
+	}
+
+	// A transaction without identifiers.
+	txn.ArbitraryData = [][]byte{modules.PrefixHostAnnouncement[:]}
+	if _, found := hasFCIdentifier(txn); found {
+		t.Fatal("no identifier should have been found")
+	}
+}
@@ -0,0 +1,169 @@
+package renter
+
+// dedup.go implements the deduplication of chunks at upload time. If enabled,
+// the renter remembers the pieces of every chunk it finished uploading under a
+// key derived from the chunk's content, erasure code and cipher key. When a new
+// file is uploaded, chunks which match a known key are added to the file by
+// referencing the existing pieces instead of uploading them again.
+//
+// Since the pieces are encrypted, a chunk can only be reused by a file which
+// uses the same cipher key as the file the chunk was originally uploaded for,
+// e.g. by providing the same key through FileUploadParams.CipherKey. The key of
+// every piece is also derived from the index of its chunk, so encrypted chunks
+// can only be reused at the same index. Unencrypted chunks can be reused at any
+// index. The index is kept in memory, holds at most maxDedupChunks chunks and
+// is lost when the renter restarts.
+
+import (
+	"io"
+	"os"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+)
+
+// dedupChunkKey returns the key under which a chunk is stored in the dedup
+// index. dataHash is the hash of the chunk's logical data. The chunk index is
+// only part of the key if the pieces of the chunk are encrypted since the
+// piece keys are derived from it.
+func dedupChunkKey(ec modules.ErasureCoder, key crypto.CipherKey, chunkIndex uint64, dataHash crypto.Hash) crypto.Hash {
+	if key.Type() == crypto.TypePlain {
+		return crypto.HashAll(ec.Identifier(), key.Type(), dataHash)
+	}
+	return crypto.HashAll(ec.Identifier(), key.Type(), key.Key(), chunkIndex, dataHash)
+}
+
+// dedupChunkLength returns the length of the logical data of a chunk.
+func dedupChunkLength(entry *filesystem.FileNode, chunkIndex uint64) uint64 {
+	offset := chunkIndex * entry.ChunkSize()
+	if offset+entry.ChunkSize() > entry.Size() {
+		return entry.Size() - offset
+	}
+	return entry.ChunkSize()
+}
+
+// dedupChunkEligible returns whether a chunk of a file can be deduplicated.
+// Partial chunks are not stored like regular chunks and are therefore
+// excluded.
+func dedupChunkEligible(entry *filesystem.FileNode, chunkIndex uint64) bool {
+	return !entry.IsIncludedPartialChunk(chunkIndex) && !entry.IsIncompletePartialChunk(chunkIndex)
+}
+
+// managedChunkDeduplication returns whether chunk deduplication is enabled.
+func (r *Renter) managedChunkDeduplication() bool {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	return r.persist.ChunkDeduplication
+}
+
+// managedDedupKeyFromPieces computes the dedup key of a chunk from its
+// unencrypted physical pieces. An empty hash is returned if deduplication is
+// disabled or the chunk can't be deduplicated.
+func (r *Renter) managedDedupKeyFromPieces(chunk *unfinishedUploadChunk) crypto.Hash {
+	if !r.managedChunkDeduplication() || !dedupChunkEligible(chunk.fileEntry, chunk.index) {
+		return crypto.Hash{}
+	}
+	// Recover the logical data from the physical pieces to hash it. Work on
+	// a copy of the slice to avoid modifying the chunk's pieces.
+	pieces := append([][]byte(nil), chunk.physicalChunkData...)
+	n := dedupChunkLength(chunk.fileEntry, chunk.index)
+	h := crypto.NewHash()
+	if err := chunk.fileEntry.ErasureCode().Recover(pieces, n, h); err != nil {
+		r.log.Debugf("failed to compute dedup key of chunk %v of %v: %v", chunk.index, chunk.staticSiaPath, err)
+		return crypto.Hash{}
+	}
+	var dataHash crypto.Hash
+	copy(dataHash[:], h.Sum(nil))
+	return dedupChunkKey(chunk.fileEntry.ErasureCode(), chunk.fileEntry.MasterKey(), chunk.index, dataHash)
+}
+
+// managedAddDedupChunk adds the pieces of a fully uploaded chunk to the dedup
+// index.
+func (r *Renter) managedAddDedupChunk(entry *filesystem.FileNode, chunkIndex uint64, key crypto.Hash) {
+	if key == (crypto.Hash{}) {
+		return
+	}
+	pieces, err := entry.Pieces(chunkIndex)
+	if err != nil {
+		r.log.Debugf("failed to get pieces of chunk %v for dedup index: %v", chunkIndex, err)
+		return
+	}
+	// Only chunks with all of their pieces uploaded are reused.
+	for _, pieceSet := range pieces {
+		if len(pieceSet) == 0 {
+			return
+		}
+	}
+	r.dedupChunksMu.Lock()
+	defer r.dedupChunksMu.Unlock()
+	if _, exists := r.dedupChunks[key]; !exists {
+		r.dedupChunkKeys = append(r.dedupChunkKeys, key)
+	}
+	r.dedupChunks[key] = pieces
+	// Evict the oldest chunks if the index is full.
+	for len(r.dedupChunkKeys) > maxDedupChunks {
+		delete(r.dedupChunks, r.dedupChunkKeys[0])
+		r.dedupChunkKeys = r.dedupChunkKeys[1:]
+	}
+}
+
+// managedDeduplicateChunks adds the pieces of already uploaded chunks to the
+// chunks of entry which have the same content. The source file is read to
+// compute the dedup keys. The number of deduplicated chunks is returned.
+func (r *Renter) managedDeduplicateChunks(entry *filesystem.FileNode, source string) (int, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return 0, errors.AddContext(err, "unable to open the source file")
+	}
+	defer f.Close()
+
+	ec := entry.ErasureCode()
+	key := entry.MasterKey()
+	deduplicated := 0
+	for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+		if !dedupChunkEligible(entry, chunkIndex) {
+			continue
+		}
+		// Hash the logical data of the chunk.
+		n := dedupChunkLength(entry, chunkIndex)
+		if _, err := f.Seek(int64(chunkIndex*entry.ChunkSize()), io.SeekStart); err != nil {
+			return deduplicated, errors.AddContext(err, "unable to seek to chunk")
+		}
+		h := crypto.NewHash()
+		if _, err := io.CopyN(h, f, int64(n)); err != nil {
+			return deduplicated, errors.AddContext(err, "unable to read chunk")
+		}
+		var dataHash crypto.Hash
+		copy(dataHash[:], h.Sum(nil))
+
+		// Look up the chunk in the dedup index.
+		r.dedupChunksMu.Lock()
+		pieces, exists := r.dedupChunks[dedupChunkKey(ec, key, chunkIndex, dataHash)]
+		r.dedupChunksMu.Unlock()
+		if !exists {
+			continue
+		}
+		if err := addDedupPieces(entry, chunkIndex, pieces); err != nil {
+			return deduplicated, errors.AddContext(err, "unable to add deduplicated pieces")
+		}
+		deduplicated++
+	}
+	return deduplicated, nil
+}
+
+// addDedupPieces adds the pieces of a deduplicated chunk to a chunk of entry.
+func addDedupPieces(entry *filesystem.FileNode, chunkIndex uint64, pieces [][]siafile.Piece) error {
+	for pieceIndex, pieceSet := range pieces {
+		for _, piece := range pieceSet {
+			err := entry.AddPiece(piece.HostPubKey, chunkIndex, uint64(pieceIndex), piece.MerkleRoot)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
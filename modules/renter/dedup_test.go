@@ -0,0 +1,205 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestChunkDeduplication tests that an upload reuses the pieces of an already
+// uploaded chunk with the same content and cipher key.
+func TestChunkDeduplication(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Enable deduplication.
+	settings, err := r.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.ChunkDeduplication = true
+	if err := r.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file.
+	data := fastrand.Bytes(100)
+	source := filepath.Join(rt.dir, "file")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	key := crypto.GenerateSiaKey(crypto.TypeDefaultRenter)
+	params := modules.FileUploadParams{
+		Source:              source,
+		SiaPath:             modules.RandomSiaPath(),
+		CipherKey:           key,
+		DisablePartialChunk: true,
+	}
+	if _, err := r.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(params.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+
+	// The dedup key computed from the encoded pieces should match the one
+	// computed from the source.
+	dataPieces, _, err := readDataPieces(bytes.NewReader(data), entry.ErasureCode(), entry.PieceSize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	physicalData, err := entry.ErasureCode().EncodeShards(dataPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dedupKey := dedupChunkKey(entry.ErasureCode(), key, 0, crypto.HashBytes(data))
+	uc := &unfinishedUploadChunk{
+		fileEntry:         entry,
+		index:             0,
+		physicalChunkData: physicalData,
+	}
+	if k := r.managedDedupKeyFromPieces(uc); k != dedupKey {
+		t.Fatal("dedup keys don't match")
+	}
+
+	// Pretend that the chunk was fully uploaded and add it to the index.
+	for pieceIndex := 0; pieceIndex < entry.ErasureCode().NumPieces(); pieceIndex++ {
+		hpk := types.SiaPublicKey{Key: fastrand.Bytes(32)}
+		if err := entry.AddPiece(hpk, 0, uint64(pieceIndex), crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.managedAddDedupChunk(entry, 0, dedupKey)
+	pieces, err := entry.Pieces(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload the same data again. The chunk should be deduplicated.
+	params.SiaPath = modules.RandomSiaPath()
+	if _, err := r.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+	entry2, err := r.staticFileSystem.OpenSiaFile(params.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry2.Close()
+	pieces2, err := entry2.Pieces(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pieces, pieces2) {
+		t.Fatal("chunk wasn't deduplicated")
+	}
+
+	// Upload the same data with a different key. The chunk shouldn't be
+	// deduplicated.
+	params.SiaPath = modules.RandomSiaPath()
+	params.CipherKey = crypto.GenerateSiaKey(crypto.TypeDefaultRenter)
+	if _, err := r.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+	entry3, err := r.staticFileSystem.OpenSiaFile(params.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry3.Close()
+	pieces3, err := entry3.Pieces(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pieceSet := range pieces3 {
+		if len(pieceSet) != 0 {
+			t.Fatal("chunk shouldn't have been deduplicated")
+		}
+	}
+}
+
+// TestDedupChunkKey tests that the chunk index is only part of the dedup key
+// of encrypted chunks.
+func TestDedupChunkKey(t *testing.T) {
+	ec, _ := siafile.NewRSSubCode(10, 20, crypto.SegmentSize)
+	dataHash := crypto.HashBytes(fastrand.Bytes(100))
+	key := crypto.GenerateSiaKey(crypto.TypeDefaultRenter)
+	if dedupChunkKey(ec, key, 0, dataHash) == dedupChunkKey(ec, key, 1, dataHash) {
+		t.Fatal("encrypted chunks at different indices shouldn't share a key")
+	}
+	plainKey := crypto.GenerateSiaKey(crypto.TypePlain)
+	if dedupChunkKey(ec, plainKey, 0, dataHash) != dedupChunkKey(ec, plainKey, 1, dataHash) {
+		t.Fatal("unencrypted chunks at different indices should share a key")
+	}
+}
+
+// TestDedupChunkEviction tests that the dedup index evicts the oldest chunks
+// once it is full.
+func TestDedupChunkEviction(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file with a fully uploaded chunk.
+	rsc, _ := siafile.NewRSCode(1, 1)
+	siaPath := modules.RandomSiaPath()
+	err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	for pieceIndex := uint64(0); pieceIndex < 2; pieceIndex++ {
+		hpk := types.SiaPublicKey{Key: fastrand.Bytes(32)}
+		if err := entry.AddPiece(hpk, 0, pieceIndex, crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Add more chunks than the index can hold.
+	var keys []crypto.Hash
+	for i := 0; i < maxDedupChunks+5; i++ {
+		key := crypto.HashObject(i)
+		keys = append(keys, key)
+		r.managedAddDedupChunk(entry, 0, key)
+	}
+	r.dedupChunksMu.Lock()
+	defer r.dedupChunksMu.Unlock()
+	if len(r.dedupChunks) != maxDedupChunks || len(r.dedupChunkKeys) != maxDedupChunks {
+		t.Fatalf("expected %v chunks but got %v", maxDedupChunks, len(r.dedupChunks))
+	}
+	for i, key := range keys {
+		_, exists := r.dedupChunks[key]
+		if evicted := i < 5; exists == evicted {
+			t.Fatalf("chunk %v: exists %v evicted %v", i, exists, evicted)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package renter
+
+// digest.go computes a digest of the renter's filesystem. The digest of a file
+// is the hash of its SiaPath, its size and the Merkle roots of its pieces. The
+// digest of the filesystem is the hash of the digests of all the files sorted
+// by their SiaPaths. The digest is independent of the order in which the files
+// were uploaded and of the hosts storing them. Since the Merkle roots are
+// computed over the encrypted and erasure coded pieces, the same file uploaded
+// twice with a different cipher key or erasure code results in a different
+// digest. Two renters therefore only end up with the same digest if they share
+// the same siafiles, e.g. a renter and a restored backup of it.
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+)
+
+// FilesystemDigest returns a digest of the paths and uploaded pieces of all the
+// files of the renter.
+func (r *Renter) FilesystemDigest() (crypto.Hash, error) {
+	if err := r.tg.Add(); err != nil {
+		return crypto.Hash{}, err
+	}
+	defer r.tg.Done()
+
+	// Gather the SiaPaths of all the files and sort them to get a canonical
+	// ordering.
+	var siaPaths []modules.SiaPath
+	if err := r.managedDigestSiaPaths(modules.RootSiaPath(), &siaPaths); err != nil {
+		return crypto.Hash{}, err
+	}
+	sort.Slice(siaPaths, func(i, j int) bool {
+		return siaPaths[i].String() < siaPaths[j].String()
+	})
+
+	// Compute the digests of the files.
+	digests := make([]crypto.Hash, 0, len(siaPaths))
+	for _, siaPath := range siaPaths {
+		entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+		if err != nil {
+			return crypto.Hash{}, errors.AddContext(err, "failed to open file "+siaPath.String())
+		}
+		digest, err := fileDigest(siaPath, entry)
+		entry.Close()
+		if err != nil {
+			return crypto.Hash{}, errors.AddContext(err, "failed to compute digest of file "+siaPath.String())
+		}
+		digests = append(digests, digest)
+	}
+	return crypto.HashObject(digests), nil
+}
+
+// fileDigest returns the digest of a file. For every piece the Merkle root of
+// the first host storing it is used since all hosts store the same data. Pieces
+// which haven't been uploaded yet contribute an empty hash.
+func fileDigest(siaPath modules.SiaPath, entry *filesystem.FileNode) (crypto.Hash, error) {
+	roots := make([]crypto.Hash, 0, entry.NumChunks()*uint64(entry.ErasureCode().NumPieces()))
+	for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+		pieces, err := entry.Pieces(chunkIndex)
+		if err != nil {
+			return crypto.Hash{}, err
+		}
+		for _, pieceSet := range pieces {
+			var root crypto.Hash
+			if len(pieceSet) > 0 {
+				root = pieceSet[0].MerkleRoot
+			}
+			roots = append(roots, root)
+		}
+	}
+	return crypto.HashAll(siaPath.String(), entry.Size(), roots), nil
+}
+
+// managedDigestSiaPaths adds the SiaPaths of all the files within the
+// directory at siaPath and its subdirectories to siaPaths.
+func (r *Renter) managedDigestSiaPaths(siaPath modules.SiaPath, siaPaths *[]modules.SiaPath) error {
+	fileinfos, err := r.staticFileSystem.ReadDir(siaPath)
+	if err != nil {
+		return errors.AddContext(err, "failed to read directory "+siaPath.String())
+	}
+	for _, fi := range fileinfos {
+		// Check to make sure renter hasn't been shutdown
+		select {
+		case <-r.tg.StopChan():
+			return errors.New("renter shutdown before digest was complete")
+		default:
+		}
+
+		// Only consider directories and siafiles.
+		name := fi.Name()
+		if !fi.IsDir() {
+			if filepath.Ext(name) != modules.SiaFileExtension {
+				continue
+			}
+			name = strings.TrimSuffix(name, modules.SiaFileExtension)
+		}
+		childPath, err := siaPath.Join(name)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			*siaPaths = append(*siaPaths, childPath)
+			continue
+		}
+		if err := r.managedDigestSiaPaths(childPath, siaPaths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
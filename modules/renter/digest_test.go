@@ -0,0 +1,91 @@
+package renter
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestFilesystemDigest tests that FilesystemDigest returns the same digest for
+// renters storing the same files and a different one if the files differ.
+func TestFilesystemDigest(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create two renters.
+	rt1, err := newRenterTesterWithDependency(filepath.Join(t.Name(), "1"), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt1.Close()
+	rt2, err := newRenterTesterWithDependency(filepath.Join(t.Name(), "2"), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt2.Close()
+
+	// Empty filesystems should have the same digest.
+	digestsEqual := func() bool {
+		d1, err := rt1.renter.FilesystemDigest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d2, err := rt2.renter.FilesystemDigest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d1 == d2
+	}
+	if !digestsEqual() {
+		t.Fatal("digests of empty filesystems don't match")
+	}
+
+	// Create the same files on both renters but in a different order.
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hpk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{1}}
+	paths := []string{"a", "dir/b", "dir/sub/c"}
+	addFile := func(rt *renterTester, path string, root crypto.Hash) {
+		siaPath, err := modules.NewSiaPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer entry.Close()
+		if err := entry.AddPiece(hpk, 0, 0, root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range paths {
+		addFile(rt1, paths[i], crypto.HashObject(paths[i]))
+		addFile(rt2, paths[len(paths)-1-i], crypto.HashObject(paths[len(paths)-1-i]))
+	}
+	if !digestsEqual() {
+		t.Fatal("digests of identical filesystems don't match")
+	}
+
+	// Adding a file with different contents to each renter should change the
+	// digest.
+	addFile(rt1, "d", crypto.Hash{1})
+	addFile(rt2, "d", crypto.Hash{2})
+	if digestsEqual() {
+		t.Fatal("digests of different filesystems match")
+	}
+}
@@ -276,6 +276,6 @@ func (r *Renter) managedPushUnexploredDirectory(siaPath modules.SiaPath) error {
 	}
 
 	// Push unexplored directory onto heap.
-	r.directoryHeap.managedPushDirectory(siaPath, metadata.AggregateHealth, metadata.Health, false)
+	r.directoryHeap.managedPushDirectory(siaPath, metadata.AggregateRepairHealth, metadata.RepairHealth, false)
 	return nil
 }
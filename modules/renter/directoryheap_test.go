@@ -22,6 +22,8 @@ func (r *Renter) updateSiaDirHealth(siaPath modules.SiaPath, health, aggregateHe
 	}
 	metadata.Health = health
 	metadata.AggregateHealth = aggregateHealth
+	metadata.RepairHealth = health
+	metadata.AggregateRepairHealth = aggregateHealth
 	err = siaDir.UpdateMetadata(metadata)
 	if err != nil {
 		return err
@@ -2,11 +2,23 @@ package renter
 
 import (
 	"os"
+	"sort"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/errors"
 )
 
+var (
+	// errInvalidMinRedundancyTarget is returned if the user tries to set a
+	// negative min redundancy target for a directory.
+	errInvalidMinRedundancyTarget = errors.New("min redundancy target can't be negative")
+
+	// errInvalidScrubInterval is returned if the user tries to set a negative
+	// scrub interval for a directory.
+	errInvalidScrubInterval = errors.New("scrub interval can't be negative")
+)
+
 // CreateDir creates a directory for the renter
 func (r *Renter) CreateDir(siaPath modules.SiaPath, mode os.FileMode) error {
 	err := r.tg.Add()
@@ -14,17 +26,32 @@ func (r *Renter) CreateDir(siaPath modules.SiaPath, mode os.FileMode) error {
 		return err
 	}
 	defer r.tg.Done()
+	if err := checkTrashPath(siaPath); err != nil {
+		return err
+	}
 	return r.staticFileSystem.NewSiaDir(siaPath, mode)
 }
 
 // DeleteDir removes a directory from the renter and deletes all its sub
-// directories and files
+// directories and files. If the trash is enabled, the directory is moved to
+// the trash instead. Directories which are already in the trash are always
+// deleted.
 func (r *Renter) DeleteDir(siaPath modules.SiaPath) error {
 	if err := r.tg.Add(); err != nil {
 		return err
 	}
 	defer r.tg.Done()
-	return r.staticFileSystem.DeleteDir(siaPath)
+	if err := r.managedCheckDirReadOnly(siaPath); err != nil {
+		return err
+	}
+	if r.managedTrashRetention() > 0 && !siaPath.IsRoot() && !isTrashPath(siaPath) {
+		return r.managedMoveDirToTrash(siaPath)
+	}
+	if err := r.staticFileSystem.DeleteDir(siaPath); err != nil {
+		return err
+	}
+	r.managedRemoveActiveUploadsDir(siaPath)
+	return nil
 }
 
 // DirList lists the directories in a siadir
@@ -34,7 +61,38 @@ func (r *Renter) DirList(siaPath modules.SiaPath) ([]modules.DirectoryInfo, erro
 	}
 	defer r.tg.Done()
 	_, dis, err := r.staticFileSystem.CachedList(siaPath, false)
-	return dis, err
+	if err != nil {
+		return nil, err
+	}
+	// Hide the trash unless it is listed explicitly.
+	if !isTrashPath(siaPath) {
+		dis = filterTrashDirs(dis)
+	}
+	return dis, nil
+}
+
+// DirectoriesBelowTarget returns the siapaths of all the directories whose
+// aggregate min redundancy dropped below their min redundancy target.
+func (r *Renter) DirectoriesBelowTarget() []modules.SiaPath {
+	if err := r.tg.Add(); err != nil {
+		return nil
+	}
+	defer r.tg.Done()
+	_, dis, err := r.staticFileSystem.CachedList(modules.RootSiaPath(), true)
+	if err != nil {
+		r.log.Println("WARN: unable to list directories:", err)
+		return nil
+	}
+	var siaPaths []modules.SiaPath
+	for _, di := range filterTrashDirs(dis) {
+		if di.MinRedundancyTarget > 0 && di.AggregateMinRedundancy < di.MinRedundancyTarget {
+			siaPaths = append(siaPaths, di.SiaPath)
+		}
+	}
+	sort.Slice(siaPaths, func(i, j int) bool {
+		return siaPaths[i].String() < siaPaths[j].String()
+	})
+	return siaPaths
 }
 
 // RenameDir takes an existing directory and changes the path. The original
@@ -50,5 +108,93 @@ func (r *Renter) RenameDir(oldPath, newPath modules.SiaPath) error {
 	if newPath.IsRoot() {
 		return errors.New("cannot rename a file to the root directory")
 	}
-	return r.staticFileSystem.RenameDir(oldPath, newPath)
+	if err := checkTrashPath(newPath); err != nil {
+		return err
+	}
+	return r.managedRenameDir(oldPath, newPath)
+}
+
+// managedRenameDir renames a directory without checking whether the new path
+// is within the trash.
+func (r *Renter) managedRenameDir(oldPath, newPath modules.SiaPath) error {
+	if err := r.managedCheckDirReadOnly(oldPath); err != nil {
+		return err
+	}
+	err := r.staticFileSystem.RenameDir(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+	r.managedRenameInContractIndex(oldPath, newPath)
+	r.managedRenameActiveUploads(oldPath, newPath)
+	// Update the metadata of the old and new parent directories to reflect
+	// the move.
+	oldParent, err := oldPath.Dir()
+	if err != nil {
+		return err
+	}
+	newParent, err := newPath.Dir()
+	if err != nil {
+		return err
+	}
+	go r.callThreadedBubbleMetadata(oldParent)
+	go r.callThreadedBubbleMetadata(newParent)
+	return nil
+}
+
+// SetDirMinRedundancyTarget sets the min redundancy target of a directory. A
+// target of 0 disables the target.
+func (r *Renter) SetDirMinRedundancyTarget(siaPath modules.SiaPath, target float64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if target < 0 {
+		return errInvalidMinRedundancyTarget
+	}
+	dir, err := r.staticFileSystem.OpenSiaDir(siaPath)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.SetMinRedundancyTarget(target)
+}
+
+// SetDirDefaultRedundancy sets the default erasure coding settings for uploads
+// into a directory and its subdirectories. Setting both values to 0 removes
+// the default and uploads fall back to the default of the nearest ancestor.
+func (r *Renter) SetDirDefaultRedundancy(siaPath modules.SiaPath, dataPieces, parityPieces int) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if dataPieces != 0 || parityPieces != 0 {
+		if err := r.managedCheckDefaultRedundancy(dataPieces, parityPieces); err != nil {
+			return err
+		}
+	}
+	dir, err := r.staticFileSystem.OpenSiaDir(siaPath)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.SetDefaultRedundancy(dataPieces, parityPieces)
+}
+
+// SetDirScrubInterval sets the interval at which the files in a directory and
+// its subdirectories are scrubbed. Setting the interval to 0 removes it and the
+// files fall back to the interval of the nearest ancestor.
+func (r *Renter) SetDirScrubInterval(siaPath modules.SiaPath, interval time.Duration) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if interval < 0 {
+		return errInvalidScrubInterval
+	}
+	dir, err := r.staticFileSystem.OpenSiaDir(siaPath)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.SetScrubInterval(interval)
 }
@@ -280,12 +280,24 @@ func compareDirectoryInfoAndMetadata(di modules.DirectoryInfo, siaDir *filesyste
 	if md.AggregateNumFiles != di.AggregateNumFiles {
 		return fmt.Errorf("AggregateNumFiles not equal, %v and %v", md.AggregateNumFiles, di.AggregateNumFiles)
 	}
+	if md.AggregateNumFilesMissingLocal != di.AggregateNumFilesMissingLocal {
+		return fmt.Errorf("AggregateNumFilesMissingLocal not equal, %v and %v", md.AggregateNumFilesMissingLocal, di.AggregateNumFilesMissingLocal)
+	}
+	if md.AggregateNumTaggedFiles != di.AggregateNumTaggedFiles {
+		return fmt.Errorf("AggregateNumTaggedFiles not equal, %v and %v", md.AggregateNumTaggedFiles, di.AggregateNumTaggedFiles)
+	}
+	if md.AggregateNumOrphanedFiles != di.AggregateNumOrphanedFiles {
+		return fmt.Errorf("AggregateNumOrphanedFiles not equal, %v and %v", md.AggregateNumOrphanedFiles, di.AggregateNumOrphanedFiles)
+	}
 	if md.AggregateNumStuckChunks != di.AggregateNumStuckChunks {
 		return fmt.Errorf("AggregateNumStuckChunks not equal, %v and %v", md.AggregateNumStuckChunks, di.AggregateNumStuckChunks)
 	}
 	if md.AggregateNumSubDirs != di.AggregateNumSubDirs {
 		return fmt.Errorf("AggregateNumSubDirs not equal, %v and %v", md.AggregateNumSubDirs, di.AggregateNumSubDirs)
 	}
+	if md.AggregateNumUnfinishedFiles != di.AggregateNumUnfinishedFiles {
+		return fmt.Errorf("AggregateNumUnfinishedFiles not equal, %v and %v", md.AggregateNumUnfinishedFiles, di.AggregateNumUnfinishedFiles)
+	}
 	if md.AggregateSize != di.AggregateSize {
 		return fmt.Errorf("AggregateSizes not equal, %v and %v", md.AggregateSize, di.AggregateSize)
 	}
@@ -316,12 +328,24 @@ func compareDirectoryInfoAndMetadata(di modules.DirectoryInfo, siaDir *filesyste
 	if md.NumFiles != di.NumFiles {
 		return fmt.Errorf("NumFiles not equal, %v and %v", md.NumFiles, di.NumFiles)
 	}
+	if md.NumFilesMissingLocal != di.NumFilesMissingLocal {
+		return fmt.Errorf("NumFilesMissingLocal not equal, %v and %v", md.NumFilesMissingLocal, di.NumFilesMissingLocal)
+	}
+	if md.NumTaggedFiles != di.NumTaggedFiles {
+		return fmt.Errorf("NumTaggedFiles not equal, %v and %v", md.NumTaggedFiles, di.NumTaggedFiles)
+	}
+	if md.NumOrphanedFiles != di.NumOrphanedFiles {
+		return fmt.Errorf("NumOrphanedFiles not equal, %v and %v", md.NumOrphanedFiles, di.NumOrphanedFiles)
+	}
 	if md.NumStuckChunks != di.NumStuckChunks {
 		return fmt.Errorf("NumStuckChunks not equal, %v and %v", md.NumStuckChunks, di.NumStuckChunks)
 	}
 	if md.NumSubDirs != di.NumSubDirs {
 		return fmt.Errorf("NumSubDirs not equal, %v and %v", md.NumSubDirs, di.NumSubDirs)
 	}
+	if md.NumUnfinishedFiles != di.NumUnfinishedFiles {
+		return fmt.Errorf("NumUnfinishedFiles not equal, %v and %v", md.NumUnfinishedFiles, di.NumUnfinishedFiles)
+	}
 	if md.Size != di.DirSize {
 		return fmt.Errorf("Sizes not equal, %v and %v", md.Size, di.DirSize)
 	}
@@ -330,3 +354,164 @@ func compareDirectoryInfoAndMetadata(di modules.DirectoryInfo, siaDir *filesyste
 	}
 	return nil
 }
+
+// TestDirectoriesBelowTarget tests that the renter reports the directories
+// whose aggregate min redundancy dropped below their target.
+func TestDirectoriesBelowTarget(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create two directories with a min redundancy of 1.5.
+	foo, err := modules.NewSiaPath("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar, err := modules.NewSiaPath("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range []modules.SiaPath{foo, bar} {
+		if err := rt.renter.CreateDir(siaPath, modules.DefaultDirPerm); err != nil {
+			t.Fatal(err)
+		}
+		md := siadir.Metadata{AggregateMinRedundancy: 1.5, MinRedundancy: 1.5}
+		if err := rt.renter.staticFileSystem.UpdateDirMetadata(siaPath, md); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without targets no directory should be reported.
+	if dirs := rt.renter.DirectoriesBelowTarget(); len(dirs) != 0 {
+		t.Fatal("expected no directories below target", dirs)
+	}
+
+	// A negative target is invalid.
+	if err := rt.renter.SetDirMinRedundancyTarget(foo, -1); err != errInvalidMinRedundancyTarget {
+		t.Fatal("expected errInvalidMinRedundancyTarget, got", err)
+	}
+
+	// Set a target above the min redundancy for foo and below it for bar.
+	if err := rt.renter.SetDirMinRedundancyTarget(foo, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.SetDirMinRedundancyTarget(bar, 1); err != nil {
+		t.Fatal(err)
+	}
+	dirs := rt.renter.DirectoriesBelowTarget()
+	if len(dirs) != 1 || !dirs[0].Equals(foo) {
+		t.Fatal("expected only foo to be below target", dirs)
+	}
+
+	// Updating the metadata, as done by bubble, shouldn't reset the target.
+	md := siadir.Metadata{AggregateMinRedundancy: 0.5, MinRedundancy: 0.5}
+	if err := rt.renter.staticFileSystem.UpdateDirMetadata(bar, md); err != nil {
+		t.Fatal(err)
+	}
+	dirs = rt.renter.DirectoriesBelowTarget()
+	if len(dirs) != 2 || !dirs[0].Equals(bar) || !dirs[1].Equals(foo) {
+		t.Fatal("expected bar and foo to be below target", dirs)
+	}
+}
+
+// TestDirDefaultRedundancy tests that uploads use the default redundancy of
+// the nearest ancestor directory which has one set.
+func TestDirDefaultRedundancy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create the directory important/sub.
+	important, err := modules.NewSiaPath("important")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := important.Join("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir(sub, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// checkErasureCode checks the erasure code used for an upload to siaPath.
+	checkErasureCode := func(siaPath modules.SiaPath, dataPieces, parityPieces int) {
+		t.Helper()
+		ec, err := rt.renter.managedDefaultErasureCode(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ec.MinPieces() != dataPieces || ec.NumPieces() != dataPieces+parityPieces {
+			t.Fatalf("expected %v-of-%v but got %v-of-%v", dataPieces, dataPieces+parityPieces, ec.MinPieces(), ec.NumPieces())
+		}
+	}
+	file, err := sub.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := modules.NewSiaPath("important/missing/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := modules.NewSiaPath("other/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without any directory defaults the renter's default is used.
+	checkErasureCode(file, DefaultDataPieces, DefaultParityPieces)
+
+	// Invalid settings should be rejected.
+	if err := rt.renter.SetDirDefaultRedundancy(important, 0, 1); err != errInvalidRedundancy {
+		t.Fatal("expected errInvalidRedundancy but got", err)
+	}
+	if err := rt.renter.SetDirDefaultRedundancy(important, 1, 0); err != errInvalidRedundancy {
+		t.Fatal("expected errInvalidRedundancy but got", err)
+	}
+
+	// Set a default on important. Uploads into the subtree should use it,
+	// even into directories that don't exist yet.
+	if err := rt.renter.SetDirDefaultRedundancy(important, 2, 8); err != nil {
+		t.Fatal(err)
+	}
+	checkErasureCode(file, 2, 8)
+	checkErasureCode(missing, 2, 8)
+	checkErasureCode(other, DefaultDataPieces, DefaultParityPieces)
+
+	// The nearest ancestor takes precedence.
+	if err := rt.renter.SetDirDefaultRedundancy(sub, 3, 4); err != nil {
+		t.Fatal(err)
+	}
+	checkErasureCode(file, 3, 4)
+	checkErasureCode(missing, 2, 8)
+
+	// Updating the metadata, as done by bubble, shouldn't reset the default.
+	if err := rt.renter.staticFileSystem.UpdateDirMetadata(sub, siadir.Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	di, err := rt.renter.staticFileSystem.DirInfo(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if di.DefaultDataPieces != 3 || di.DefaultParityPieces != 4 {
+		t.Fatal("default redundancy was reset", di.DefaultDataPieces, di.DefaultParityPieces)
+	}
+
+	// Clearing the default falls back to the parent.
+	if err := rt.renter.SetDirDefaultRedundancy(sub, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	checkErasureCode(file, 2, 8)
+}
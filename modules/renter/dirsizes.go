@@ -0,0 +1,116 @@
+package renter
+
+// dirsizes.go implements a full recalculation of the sizes of the directory
+// tree. Bubbling only recomputes the directories along the path of an update
+// and trusts the cached aggregate sizes of their subdirectories, so an
+// aggregate size which drifted, e.g. because files were deleted out of band,
+// would never be corrected otherwise.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+)
+
+// RecalculateSizes recomputes the size and aggregate size of every directory
+// from the siafiles on disk. Directories whose metadata diverged from the
+// recomputed values are logged, queued for a bubble and returned.
+func (r *Renter) RecalculateSizes() ([]modules.SiaPath, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	var diverged []modules.SiaPath
+	_, err := r.managedRecalculateDirSize(modules.RootSiaPath(), &diverged)
+	return diverged, err
+}
+
+// managedRecalculateDirSize recomputes the sizes of a directory and its
+// subtree and returns the aggregate size of the directory. The subdirectories
+// are recomputed first so that corrections are propagated to the root.
+func (r *Renter) managedRecalculateDirSize(siaPath modules.SiaPath, diverged *[]modules.SiaPath) (uint64, error) {
+	select {
+	case <-r.tg.StopChan():
+		return 0, errors.New("renter shut down before the size recalculation finished")
+	default:
+	}
+	fis, err := ioutil.ReadDir(siaPath.SiaDirSysPath(r.staticFileSystem.Root()))
+	if err != nil {
+		return 0, errors.AddContext(err, fmt.Sprintf("failed to read directory %v", siaPath))
+	}
+	var size, aggregateSize uint64
+	for _, fi := range fis {
+		ext := filepath.Ext(fi.Name())
+		if !fi.IsDir() && ext != modules.SiaFileExtension {
+			continue
+		}
+		childSiaPath, err := siaPath.Join(strings.TrimSuffix(fi.Name(), modules.SiaFileExtension))
+		if err != nil {
+			return 0, err
+		}
+		if fi.IsDir() {
+			childSize, err := r.managedRecalculateDirSize(childSiaPath, diverged)
+			if err != nil {
+				return 0, err
+			}
+			aggregateSize += childSize
+			continue
+		}
+		sf, err := r.staticFileSystem.OpenSiaFile(childSiaPath)
+		if errors.Contains(err, filesystem.ErrNotExist) {
+			// The file was deleted after the directory was read.
+			continue
+		}
+		if err != nil {
+			return 0, errors.AddContext(err, fmt.Sprintf("failed to open %v", childSiaPath))
+		}
+		size += sf.Size()
+		sf.Close()
+	}
+	aggregateSize += size
+
+	// Compare the recomputed sizes to the bubbled ones.
+	md, err := r.managedLoadDirMetadata(siaPath)
+	if err != nil {
+		return 0, errors.AddContext(err, fmt.Sprintf("failed to load metadata of %v", siaPath))
+	}
+	if md.Size == size && md.AggregateSize == aggregateSize {
+		return aggregateSize, nil
+	}
+	r.log.Printf("WARN: size of %v diverged: bubbled size %v and aggregate size %v but recomputed %v and %v", siaPath, md.Size, md.AggregateSize, size, aggregateSize)
+	*diverged = append(*diverged, siaPath)
+	// Correct the metadata with a bubble instead of writing it directly to
+	// avoid racing with the bubbles of the directory. The bubble can't be
+	// skipped since the directory itself might be unchanged.
+	r.managedForgetBubbleRun(siaPath)
+	r.managedQueueBubble(siaPath)
+	return aggregateSize, nil
+}
+
+// threadedRecalculateSizes periodically recalculates the sizes of the
+// directory tree to catch drift in the bubbled metadata.
+func (r *Renter) threadedRecalculateSizes() {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+	for {
+		select {
+		case <-r.tg.StopChan():
+			return
+		case <-time.After(sizeRecalculationInterval):
+		}
+		// The diverged directories are already logged by the recalculation.
+		var diverged []modules.SiaPath
+		if _, err := r.managedRecalculateDirSize(modules.RootSiaPath(), &diverged); err != nil {
+			r.log.Println("WARN: failed to recalculate directory sizes:", err)
+		}
+	}
+}
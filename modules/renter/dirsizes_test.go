@@ -0,0 +1,112 @@
+package renter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestRecalculateSizes tests that RecalculateSizes detects and corrects
+// directories whose bubbled sizes drifted.
+func TestRecalculateSizes(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file in a nested directory and bubble it to the root.
+	dirSiaPath, err := modules.NewSiaPath("a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileSiaPath, err := dirSiaPath.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	fileSize := uint64(100)
+	err = r.staticFileSystem.NewSiaFile(fileSiaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), fileSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parentSiaPath, err := dirSiaPath.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedBubbleMetadata(context.Background(), dirSiaPath); err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if stats := r.BubbleQueueStats(); stats != (modules.BubbleQueueStats{}) {
+			return fmt.Errorf("bubbles haven't finished: %v", stats)
+		}
+		md, err := r.managedDirectoryMetadata(modules.RootSiaPath())
+		if err != nil {
+			return err
+		}
+		if md.AggregateSize != fileSize {
+			return fmt.Errorf("expected root size %v but got %v", fileSize, md.AggregateSize)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without any drift no directory should be reported.
+	diverged, err := r.RecalculateSizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diverged) != 0 {
+		t.Fatal("expected no diverged directories but got", diverged)
+	}
+
+	// Corrupt the aggregate size of the parent directory.
+	md, err := r.managedDirectoryMetadata(parentSiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md.AggregateSize += 1000
+	if err := r.staticFileSystem.UpdateDirMetadata(parentSiaPath, md); err != nil {
+		t.Fatal(err)
+	}
+
+	// The parent should be reported and corrected.
+	diverged, err = r.RecalculateSizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diverged) != 1 || !diverged[0].Equals(parentSiaPath) {
+		t.Fatal("expected the parent to diverge but got", diverged)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		for _, siaPath := range []modules.SiaPath{dirSiaPath, parentSiaPath, modules.RootSiaPath()} {
+			md, err := r.managedDirectoryMetadata(siaPath)
+			if err != nil {
+				return err
+			}
+			if md.AggregateSize != fileSize {
+				return fmt.Errorf("wrong aggregate size for %v: expected %v but got %v", siaPath, fileSize, md.AggregateSize)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,67 @@
+package renter
+
+// diskusage.go implements a du-style report of the storage used by the
+// directories of the renter. The aggregate size of a directory is taken from
+// its metadata while the number of pieces and the storage used on hosts are
+// summed up from the cached uploaded bytes of the files in its subtree.
+
+import (
+	"sort"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// DiskUsage returns the storage used by every directory, sorted by aggregate
+// size in descending order.
+func (r *Renter) DiskUsage() ([]modules.DirUsage, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	files, dirs, err := r.staticFileSystem.CachedList(modules.RootSiaPath(), true)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to list directories")
+	}
+	return diskUsage(files, dirs), nil
+}
+
+// diskUsage computes the usage of the provided directories from the provided
+// files.
+func diskUsage(files []modules.FileInfo, dirs []modules.DirectoryInfo) []modules.DirUsage {
+	usage := make(map[modules.SiaPath]*modules.DirUsage, len(dirs))
+	for _, di := range dirs {
+		usage[di.SiaPath] = &modules.DirUsage{
+			SiaPath:       di.SiaPath,
+			AggregateSize: di.AggregateSize,
+		}
+	}
+
+	// Add the pieces of every file to all of its ancestors.
+	for _, fi := range files {
+		dir, err := fi.SiaPath.Dir()
+		for err == nil {
+			if du, exists := usage[dir]; exists {
+				du.AggregateNumPieces += fi.UploadedBytes / modules.SectorSize
+				du.AggregateHostStorage += fi.UploadedBytes
+			}
+			if dir.IsRoot() {
+				break
+			}
+			dir, err = dir.Dir()
+		}
+	}
+
+	dus := make([]modules.DirUsage, 0, len(usage))
+	for _, du := range usage {
+		dus = append(dus, *du)
+	}
+	sort.Slice(dus, func(i, j int) bool {
+		if dus[i].AggregateSize != dus[j].AggregateSize {
+			return dus[i].AggregateSize > dus[j].AggregateSize
+		}
+		return dus[i].SiaPath.String() < dus[j].SiaPath.String()
+	})
+	return dus
+}
@@ -0,0 +1,114 @@
+package renter
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestDiskUsageAggregation probes the aggregation of diskUsage.
+func TestDiskUsageAggregation(t *testing.T) {
+	siaPath := func(path string) modules.SiaPath {
+		sp, err := modules.NewSiaPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sp
+	}
+	root, a, ab, c := modules.RootSiaPath(), siaPath("a"), siaPath("a/b"), siaPath("c")
+	dirs := []modules.DirectoryInfo{
+		{SiaPath: root, AggregateSize: 300},
+		{SiaPath: a, AggregateSize: 200},
+		{SiaPath: ab, AggregateSize: 100},
+		{SiaPath: c, AggregateSize: 0},
+	}
+	files := []modules.FileInfo{
+		{SiaPath: siaPath("file"), UploadedBytes: modules.SectorSize},
+		{SiaPath: siaPath("a/file"), UploadedBytes: 2 * modules.SectorSize},
+		{SiaPath: siaPath("a/b/file"), UploadedBytes: 3 * modules.SectorSize},
+	}
+	dus := diskUsage(files, dirs)
+
+	// The directories are sorted by size.
+	expected := []modules.DirUsage{
+		{SiaPath: root, AggregateSize: 300, AggregateNumPieces: 6, AggregateHostStorage: 6 * modules.SectorSize},
+		{SiaPath: a, AggregateSize: 200, AggregateNumPieces: 5, AggregateHostStorage: 5 * modules.SectorSize},
+		{SiaPath: ab, AggregateSize: 100, AggregateNumPieces: 3, AggregateHostStorage: 3 * modules.SectorSize},
+		{SiaPath: c},
+	}
+	if len(dus) != len(expected) {
+		t.Fatalf("expected %v directories but got %v", len(expected), len(dus))
+	}
+	for i := range expected {
+		if dus[i] != expected[i] {
+			t.Errorf("expected %v but got %v", expected[i], dus[i])
+		}
+	}
+}
+
+// TestDiskUsage tests the DiskUsage report of the renter.
+func TestDiskUsage(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file in a directory and add a piece to it.
+	siaPath, err := modules.NewSiaPath("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.AddPiece(types.SiaPublicKey{}, 0, 0, crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	// Persist the cached uploaded bytes the way the health loop does.
+	if _, err := rt.renter.RefreshFileMetadata(siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The piece is accounted for in the directory and the root.
+	dus, err := rt.renter.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found int
+	for _, du := range dus {
+		if !du.SiaPath.Equals(dirSiaPath) && !du.SiaPath.IsRoot() {
+			continue
+		}
+		found++
+		if du.AggregateNumPieces != 1 || du.AggregateHostStorage != modules.SectorSize {
+			t.Fatal("piece wasn't accounted for", du)
+		}
+	}
+	if found != 2 {
+		t.Fatal("expected the directory and the root but found", found)
+	}
+}
@@ -33,6 +33,7 @@ type (
 		chunksRemaining uint64        // Number of chunks whose downloads are incomplete.
 		completeChan    chan struct{} // Closed once the download is complete.
 		err             error         // Only set if there was an error which prevented the download from completing.
+		finishedEarly   bool          // Set if the download was completed before all of its chunks were recovered.
 
 		// downloadCompleteFunc is a slice of functions which are called when
 		// completeChan is closed.
@@ -97,7 +98,11 @@ func (d *download) managedFail(err error) {
 	if complete && d.err != nil {
 		return
 	} else if complete && d.err == nil {
-		d.r.log.Critical("download is marked as completed without error, but then managedFail was called with err:", err)
+		// Chunks which were still in progress when the download finished
+		// early fail to write to the closed destination.
+		if !d.finishedEarly {
+			d.r.log.Critical("download is marked as completed without error, but then managedFail was called with err:", err)
+		}
 		return
 	}
 
@@ -106,6 +111,19 @@ func (d *download) managedFail(err error) {
 	d.markComplete()
 }
 
+// managedFinish marks the download as complete without an error before all of
+// its chunks were recovered. This is used by destinations which received all
+// the data they need. Chunks which weren't fetched yet are skipped.
+func (d *download) managedFinish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.staticComplete() {
+		return
+	}
+	d.finishedEarly = true
+	d.markComplete()
+}
+
 // markComplete is a helper method which closes the completeChan and and
 // executes the downloadCompleteFuncs. The completeChan should always be closed
 // using this method.
@@ -236,6 +254,163 @@ func (r *Renter) DownloadAsync(p modules.RenterDownloadParameters, f func(error)
 	}, d.managedCancel, nil
 }
 
+// DownloadRange downloads length bytes of the file at siaPath starting at
+// offset and writes them to w. Only the chunks which overlap the range are
+// fetched. If the range exceeds the end of the file, length is clamped to the
+// file size. DownloadRange blocks until the download is finished.
+func (r *Renter) DownloadRange(siaPath modules.SiaPath, offset, length uint64, w io.Writer) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+
+	// Clamp the length to the end of the file.
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return err
+	}
+	size := entry.LogicalSize()
+	entry.Close()
+	if offset > size || (offset == size && length > 0) {
+		return fmt.Errorf("offset %v is beyond the end of the file (%v bytes)", offset, size)
+	}
+	if length > size-offset {
+		length = size - offset
+	}
+	// Nothing to download. This also prevents managedDownload from
+	// interpreting the 0 length as the whole file.
+	if length == 0 {
+		return nil
+	}
+
+	d, err := r.managedDownload(modules.RenterDownloadParameters{
+		Httpwriter: w,
+		Length:     length,
+		Offset:     offset,
+		SiaPath:    siaPath,
+	})
+	if err != nil {
+		return err
+	}
+	if err := d.Start(); err != nil {
+		return err
+	}
+	select {
+	case <-d.completeChan:
+		return d.Err()
+	case <-r.tg.StopChan():
+		return errors.New("download interrupted by shutdown")
+	}
+}
+
+// DownloadToWriterAt downloads the whole file at siaPath and writes it to w.
+// Chunks are written to their offsets as soon as they are recovered, so they
+// may arrive out of order. If w can be truncated, it is truncated to the size
+// of the file before the download starts. DownloadToWriterAt blocks until the
+// download is finished.
+func (r *Renter) DownloadToWriterAt(siaPath modules.SiaPath, w io.WriterAt) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	d, err := r.managedDownloadToWriterAt(siaPath, w)
+	if err != nil || d == nil {
+		return err
+	}
+	if err := d.Start(); err != nil {
+		return err
+	}
+	select {
+	case <-d.completeChan:
+		return d.Err()
+	case <-r.tg.StopChan():
+		return errors.New("download interrupted by shutdown")
+	}
+}
+
+// managedDownloadToWriterAt creates the download object for
+// DownloadToWriterAt. It returns a nil download if the file is empty and
+// there is nothing to download.
+func (r *Renter) managedDownloadToWriterAt(siaPath modules.SiaPath, w io.WriterAt) (*download, error) {
+	if w == nil {
+		return nil, errors.New("destination not supplied")
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+	defer entry.UpdateAccessTime()
+
+	// Make sure that the destination has the right size. Any data beyond the
+	// end of the file is removed and the regions that haven't been written
+	// yet are sparse until their chunks arrive.
+	size := entry.LogicalSize()
+	if t, ok := w.(interface{ Truncate(int64) error }); ok {
+		if err := t.Truncate(int64(size)); err != nil {
+			return nil, errors.AddContext(err, "failed to truncate destination")
+		}
+	}
+	// Nothing to download. This also prevents the download from being
+	// created with a length of 0.
+	if size == 0 {
+		return nil, nil
+	}
+
+	// Compressed files need to be decompressed sequentially.
+	var dw downloadDestination
+	length := size
+	compression := entry.Compression()
+	if compression != modules.CompressionNone {
+		length = entry.Size()
+		dw = newDownloadDestinationDecompressor(compression, NewSectionWriter(w, 0, int64(size)), nil, 0, size)
+	} else {
+		dw = &downloadDestinationFile{deps: r.deps, f: w, staticChunkSize: int64(entry.ChunkSize())}
+	}
+
+	snap, err := entry.Snapshot(siaPath)
+	if err != nil {
+		return nil, err
+	}
+	d, err := r.managedNewDownload(downloadParams{
+		destination:     dw,
+		destinationType: "writerat",
+		file:            snap,
+
+		latencyTarget: 25e3 * time.Millisecond, // TODO: high default until full latency support is added.
+		length:        length,
+		needsMemory:   true,
+		offset:        0,
+		overdrive:     3, // TODO: moderate default until full overdrive support is added.
+		priority:      5, // TODO: moderate default until full priority support is added.
+	})
+	if closer, ok := dw.(io.Closer); err != nil && ok {
+		return nil, errors.Compose(err, closer.Close())
+	} else if err != nil {
+		return nil, err
+	}
+	if ddd, ok := dw.(*downloadDestinationDecompressor); ok {
+		ddd.finish = d.managedFinish
+	}
+	// Decompression only fails after all the data was downloaded so the error
+	// needs to be reported as the error of the download.
+	d.OnComplete(func(_ error) error {
+		if closer, ok := dw.(io.Closer); ok {
+			err := closer.Close()
+			if err != nil && d.err == nil {
+				d.err = err
+			}
+			return err
+		}
+		return nil
+	})
+
+	r.downloadHistoryMu.Lock()
+	r.downloadHistory[d.UID()] = d
+	r.downloadHistoryMu.Unlock()
+	return d, nil
+}
+
 // managedDownload performs a file download using the passed parameters and
 // returns the download object and an error that indicates if the download
 // setup was successful.
@@ -262,25 +437,37 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (*download,
 	if p.Destination != "" && !filepath.IsAbs(p.Destination) {
 		return nil, errors.New("destination must be an absolute path")
 	}
-	if p.Offset == entry.Size() && entry.Size() != 0 {
+	// The offset and length refer to the data before compression.
+	size := entry.LogicalSize()
+	if p.Offset == size && size != 0 {
 		return nil, errors.New("offset equals filesize")
 	}
 	// Sentinel: if length == 0, download the entire file.
 	if p.Length == 0 {
-		if p.Offset > entry.Size() {
+		if p.Offset > size {
 			return nil, errors.New("offset cannot be greater than file size")
 		}
-		p.Length = entry.Size() - p.Offset
+		p.Length = size - p.Offset
 	}
 	// Check whether offset and length is valid.
-	if p.Offset < 0 || p.Offset+p.Length > entry.Size() {
-		return nil, fmt.Errorf("offset and length combination invalid, max byte is at index %d", entry.Size()-1)
+	if p.Offset < 0 || p.Offset+p.Length > size {
+		return nil, fmt.Errorf("offset and length combination invalid, max byte is at index %d", size-1)
 	}
 
-	// Instantiate the correct downloadWriter implementation.
+	// Instantiate the correct downloadWriter implementation. Compressed files
+	// are downloaded from the start of the file and decompressed on the fly
+	// until the requested range was written.
 	var dw downloadDestination
 	var destinationType string
-	if isHTTPResp {
+	offset, length := p.Offset, p.Length
+	compression := entry.Compression()
+	if compression != modules.CompressionNone {
+		offset, length = 0, entry.Size()
+	}
+	if isHTTPResp && compression != modules.CompressionNone {
+		dw = newDownloadDestinationDecompressor(compression, p.Httpwriter, nil, p.Offset, p.Length)
+		destinationType = "http stream"
+	} else if isHTTPResp {
 		dw = newDownloadDestinationWriter(p.Httpwriter)
 		destinationType = "http stream"
 	} else {
@@ -288,7 +475,11 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (*download,
 		if err != nil {
 			return nil, err
 		}
-		dw = &downloadDestinationFile{deps: r.deps, f: osFile, staticChunkSize: int64(entry.ChunkSize())}
+		if compression != modules.CompressionNone {
+			dw = newDownloadDestinationDecompressor(compression, osFile, osFile, p.Offset, p.Length)
+		} else {
+			dw = &downloadDestinationFile{deps: r.deps, f: osFile, closer: osFile, staticChunkSize: int64(entry.ChunkSize())}
+		}
 		destinationType = "file"
 	}
 
@@ -315,9 +506,9 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (*download,
 		file:              snap,
 
 		latencyTarget: 25e3 * time.Millisecond, // TODO: high default until full latency support is added.
-		length:        p.Length,
+		length:        length,
 		needsMemory:   true,
-		offset:        p.Offset,
+		offset:        offset,
 		overdrive:     3, // TODO: moderate default until full overdrive support is added.
 		priority:      5, // TODO: moderate default until full priority support is added.
 	})
@@ -327,12 +518,22 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (*download,
 	} else if err != nil {
 		return nil, err
 	}
+	// Compressed downloads finish once the requested range was decompressed.
+	if ddd, ok := dw.(*downloadDestinationDecompressor); ok {
+		ddd.finish = d.managedFinish
+	}
 
 	// Register some cleanup for when the download is done.
 	d.OnComplete(func(_ error) error {
 		// close the destination if possible.
 		if closer, ok := dw.(io.Closer); ok {
-			return closer.Close()
+			err := closer.Close()
+			// Decompression only fails after all the data was downloaded so
+			// the error needs to be reported as the error of the download.
+			if _, compressed := dw.(*downloadDestinationDecompressor); compressed && err != nil && d.err == nil {
+				d.err = err
+			}
+			return err
 		}
 		// sanity check that we close files.
 		if destinationType == "file" {
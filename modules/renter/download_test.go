@@ -1,11 +1,19 @@
 package renter
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
-	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/fastrand"
 
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
@@ -308,3 +316,152 @@ func checkDownloadHistory(downloads []modules.DownloadInfo, check []int64) bool
 	}
 	return true
 }
+
+// TestDownloadRange tests downloading ranges of a file that straddle chunk
+// boundaries and exceed the file size.
+func TestDownloadRange(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Upload a file of 2.5 chunks. Without hosts the chunks are fetched from
+	// the local file.
+	rsc, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunkSize := modules.SectorSize - crypto.TypeDefaultRenter.Overhead()
+	data := fastrand.Bytes(int(chunkSize * 5 / 2))
+	source := filepath.Join(rt.dir, "file")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	_, err = rt.renter.Upload(modules.FileUploadParams{
+		Source:              source,
+		SiaPath:             siaPath,
+		ErasureCode:         rsc,
+		DisablePartialChunk: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := uint64(len(data))
+	tests := []struct {
+		offset, length uint64
+		expected       []byte
+	}{
+		{0, 10, data[:10]},
+		{chunkSize - 5, 10, data[chunkSize-5 : chunkSize+5]},
+		{chunkSize / 2, 2 * chunkSize, data[chunkSize/2 : chunkSize/2+2*chunkSize]},
+		{size - 5, 100, data[size-5:]},
+		{0, size, data},
+		{10, 0, nil},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := rt.renter.DownloadRange(siaPath, test.offset, test.length, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.expected) {
+			t.Fatalf("%v %v: wrong data, got %v bytes but expected %v", test.offset, test.length, buf.Len(), len(test.expected))
+		}
+	}
+
+	// An offset beyond the end of the file should fail.
+	if err := rt.renter.DownloadRange(siaPath, size+1, 1, ioutil.Discard); err == nil {
+		t.Fatal("expected an error for an offset beyond the end of the file")
+	}
+}
+
+// TestDownloadToWriterAt tests downloading a file to an io.WriterAt whose
+// chunks are written out of order.
+func TestDownloadToWriterAt(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyPostponeWritePiecesRecovery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Upload a file of 3.5 chunks. Without hosts the chunks are fetched from
+	// the local file.
+	rsc, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunkSize := modules.SectorSize - crypto.TypeDefaultRenter.Overhead()
+	data := fastrand.Bytes(int(chunkSize * 7 / 2))
+	source := filepath.Join(rt.dir, "file")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	_, err = rt.renter.Upload(modules.FileUploadParams{
+		Source:              source,
+		SiaPath:             siaPath,
+		ErasureCode:         rsc,
+		DisablePartialChunk: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download to a new, sparse file.
+	dst := filepath.Join(rt.dir, "dst")
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DownloadToWriterAt(siaPath, f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatalf("wrong data, got %v bytes but expected %v", len(downloaded), len(data))
+	}
+
+	// Download to a file which is larger than the downloaded file. The
+	// remaining data should be truncated.
+	if err := ioutil.WriteFile(dst, fastrand.Bytes(2*len(data)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err = os.OpenFile(dst, os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DownloadToWriterAt(siaPath, f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err = ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatalf("wrong data, got %v bytes but expected %v", len(downloaded), len(data))
+	}
+
+	// Downloading to a nil destination should fail.
+	if err := rt.renter.DownloadToWriterAt(siaPath, nil); err == nil {
+		t.Fatal("expected an error for a nil destination")
+	}
+}
@@ -149,7 +149,7 @@ func (udc *unfinishedDownloadChunk) managedFinalizeRecovery() {
 	udc.download.mu.Lock()
 	defer udc.download.mu.Unlock()
 	udc.download.chunksRemaining--
-	if udc.download.chunksRemaining == 0 {
+	if udc.download.chunksRemaining == 0 && !udc.download.staticComplete() {
 		// Download is complete, send out a notification.
 		udc.download.markComplete()
 	}
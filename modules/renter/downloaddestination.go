@@ -19,7 +19,6 @@ package renter
 import (
 	"errors"
 	"io"
-	"os"
 	"sync"
 	"time"
 
@@ -116,16 +115,23 @@ func (dw *downloadDestinationBuffer) WritePieces(_ modules.ErasureCoder, pieces
 	return nil
 }
 
-// downloadDestinationFile wraps an os.File into a downloadDestination.
+// downloadDestinationFile wraps an io.WriterAt, like an os.File, into a
+// downloadDestination. Every chunk is written to its own offset as soon as it
+// is recovered, which means that chunks may be written out of order. If closer
+// is set, it is closed when the download is done.
 type downloadDestinationFile struct {
 	deps            modules.Dependencies
-	f               *os.File
+	f               io.WriterAt
+	closer          io.Closer
 	staticChunkSize int64
 }
 
 // Close implements the io.Closer interface for downloadDestinationFile.
 func (ddf *downloadDestinationFile) Close() error {
-	return ddf.f.Close()
+	if ddf.closer == nil {
+		return nil
+	}
+	return ddf.closer.Close()
 }
 
 // WritePieces will decode the pieces and write them to a file at the provided
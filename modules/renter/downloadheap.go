@@ -17,6 +17,8 @@ import (
 	"os"
 	"sync/atomic"
 	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
 )
 
 // downloadChunkHeap is a heap that is sorted first by file priority, then by
@@ -163,7 +165,7 @@ func (r *Renter) managedNextDownloadChunk() *unfinishedDownloadChunk {
 func (r *Renter) managedTryFetchChunkFromDisk(chunk *unfinishedDownloadChunk) bool {
 	// Get path at which we expect to find the file.
 	fileName := chunk.renterFile.SiaPath().Name()
-	localPath := chunk.renterFile.LocalPath()
+	localPath := r.chunkDataPath(chunk.renterFile)
 	if localPath == "" {
 		return false
 	}
@@ -287,9 +289,10 @@ LOOP:
 			// Check if we can serve the chunk from disk.
 			if !nextChunk.staticDisableDiskFetch && r.managedTryFetchChunkFromDisk(nextChunk) {
 				continue
-			} else if !nextChunk.staticDisableDiskFetch && nextChunk.renterFile.LocalPath() != "" {
+			} else if !nextChunk.staticDisableDiskFetch && nextChunk.renterFile.LocalPath() != "" && nextChunk.renterFile.Compression() == modules.CompressionNone {
 				// If the local path is set and we still weren't able to load
 				// the chunk from disk, set the localpath to "" for safety.
+				// Compressed files are never loaded from the local path.
 				entry, err := r.staticFileSystem.OpenSiaFile(nextChunk.renterFile.SiaPath())
 				if err == nil {
 					err = entry.SetLocalPath("")
@@ -481,6 +481,9 @@ func (r *Renter) Streamer(siaPath modules.SiaPath, disableLocalFetch bool) (stri
 		return "", nil, err
 	}
 	defer node.Close()
+	if node.Compression() != modules.CompressionNone {
+		return "", nil, errCompressedStream
+	}
 
 	// Create the streamer
 	snap, err := node.Snapshot(siaPath)
@@ -500,6 +503,10 @@ func (r *Renter) StreamerByNode(node *filesystem.FileNode, disableLocalFetch boo
 	}
 	defer r.tg.Done()
 
+	if node.Compression() != modules.CompressionNone {
+		return nil, errCompressedStream
+	}
+
 	// Grab the current SiaPath of the FileNode and then create a snapshot.
 	sp := r.staticFileSystem.FileSiaPath(node)
 	snap, err := node.Snapshot(sp)
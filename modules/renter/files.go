@@ -1,21 +1,56 @@
 package renter
 
 import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gitlab.com/NebulousLabs/errors"
+
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+)
+
+var (
+	// ErrInconsistentRedundancyParams is returned by FileRedundancyParams if
+	// the chunks of a file don't share the same erasure coding parameters.
+	ErrInconsistentRedundancyParams = errors.New("chunks of the file use different erasure coding parameters")
+
+	// ErrInvalidFileTags is returned by SetFileTags if there are too many
+	// tags or a tag has an empty or too long key or a too long value.
+	ErrInvalidFileTags = errors.New("invalid file tags")
+
+	// ErrInvalidHealthRange is returned by FilesByHealth if the min health is
+	// greater than the max health.
+	ErrInvalidHealthRange = errors.New("min health can't be greater than max health")
+
+	// ErrFileReadOnly is returned when trying to delete or rename a read-only
+	// file or a directory containing one.
+	ErrFileReadOnly = filesystem.ErrReadOnly
 )
 
 // DeleteFile removes a file entry from the renter and deletes its data from
-// the hosts it is stored on.
+// the hosts it is stored on. If the trash is enabled, the file is moved to the
+// trash instead. Files which are already in the trash are always deleted.
 func (r *Renter) DeleteFile(siaPath modules.SiaPath) error {
 	err := r.tg.Add()
 	if err != nil {
 		return err
 	}
 	defer r.tg.Done()
+	if err := r.managedCheckFileReadOnly(siaPath); err != nil {
+		return err
+	}
+	if r.managedTrashRetention() > 0 && !isTrashPath(siaPath) {
+		return r.managedMoveToTrash(siaPath)
+	}
+	return r.managedDeleteFile(siaPath)
+}
 
-	// Perform the delete operation.
-	err = r.staticFileSystem.DeleteFile(siaPath)
-	if err != nil {
+// managedDeleteFile permanently deletes a file without moving it to the trash.
+func (r *Renter) managedDeleteFile(siaPath modules.SiaPath) error {
+	if err := r.managedPurgeFile(siaPath); err != nil {
 		return err
 	}
 
@@ -35,6 +70,46 @@ func (r *Renter) DeleteFile(siaPath modules.SiaPath) error {
 	return nil
 }
 
+// managedPurgeFile permanently deletes a file and removes its compressed
+// staging copy, upload progress, active upload and contract index entry. It
+// doesn't update the metadata of the file's directory.
+func (r *Renter) managedPurgeFile(siaPath modules.SiaPath) error {
+	// Remember the staging file of a compressed upload to remove it
+	// afterwards. Also remember the UID to remove the upload progress of the
+	// file.
+	var compressedPath string
+	var uid siafile.SiafileUID
+	var opened bool
+	if entry, err := r.staticFileSystem.OpenSiaFile(siaPath); err == nil {
+		if entry.ReadOnly() {
+			entry.Close()
+			return ErrFileReadOnly
+		}
+		if codec := entry.Compression(); codec != modules.CompressionNone {
+			compressedPath = r.compressedUploadPath(entry.UID(), codec)
+		}
+		uid, opened = entry.UID(), true
+		entry.Close()
+	}
+
+	// Perform the delete operation.
+	err := r.staticFileSystem.DeleteFile(siaPath)
+	if err != nil {
+		return err
+	}
+	if compressedPath != "" {
+		if err := os.Remove(compressedPath); err != nil && !os.IsNotExist(err) {
+			r.log.Println("WARN: failed to remove compressed copy of deleted file:", err)
+		}
+	}
+	if opened {
+		r.managedRemoveUploadProgress(uid)
+	}
+	r.managedRemoveActiveUpload(siaPath.String())
+	r.managedRemoveFromContractIndex(siaPath)
+	return nil
+}
+
 // FileList returns all of the files that the renter has.
 func (r *Renter) FileList(siaPath modules.SiaPath, recursive, cached bool) ([]modules.FileInfo, error) {
 	if err := r.tg.Add(); err != nil {
@@ -52,9 +127,44 @@ func (r *Renter) FileList(siaPath modules.SiaPath, recursive, cached bool) ([]mo
 	if err != nil {
 		return nil, err
 	}
+	// Hide the trash unless it is listed explicitly.
+	if !isTrashPath(siaPath) {
+		fis = filterTrash(fis)
+	}
 	return fis, err
 }
 
+// FilesByHealth returns the files whose cached max health is within
+// [minHealth, maxHealth]. The files are sorted by their max health with the
+// least healthy files first. The cached health is updated by the health loop
+// so no health is recomputed for the listing.
+func (r *Renter) FilesByHealth(minHealth, maxHealth float64) ([]modules.FileInfo, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	if minHealth > maxHealth {
+		return nil, ErrInvalidHealthRange
+	}
+	fis, _, err := r.staticFileSystem.CachedList(modules.RootSiaPath(), true)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []modules.FileInfo
+	for _, fi := range filterTrash(fis) {
+		if fi.MaxHealth >= minHealth && fi.MaxHealth <= maxHealth {
+			filtered = append(filtered, fi)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].MaxHealth != filtered[j].MaxHealth {
+			return filtered[i].MaxHealth > filtered[j].MaxHealth
+		}
+		return filtered[i].SiaPath.String() < filtered[j].SiaPath.String()
+	})
+	return filtered, nil
+}
+
 // File returns file from siaPath queried by user.
 // Update based on FileList
 func (r *Renter) File(siaPath modules.SiaPath) (modules.FileInfo, error) {
@@ -70,6 +180,113 @@ func (r *Renter) File(siaPath modules.SiaPath) (modules.FileInfo, error) {
 	return fi, nil
 }
 
+// Stat returns the cached information of the file or directory at siaPath. A
+// file takes precedence over a directory with the same siapath. If neither
+// exists, filesystem.ErrNotExist is returned.
+func (r *Renter) Stat(siaPath modules.SiaPath) (modules.FileOrDirInfo, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.FileOrDirInfo{}, err
+	}
+	defer r.tg.Done()
+	if !siaPath.IsRoot() {
+		fi, err := r.staticFileSystem.CachedFileInfo(siaPath)
+		if err == nil {
+			return modules.FileOrDirInfo{File: fi}, nil
+		}
+		if !errors.Contains(err, filesystem.ErrNotExist) {
+			return modules.FileOrDirInfo{}, errors.AddContext(err, "failed to get file info")
+		}
+	}
+	dir, err := r.staticFileSystem.OpenSiaDir(siaPath)
+	if errors.Contains(err, filesystem.ErrNotExist) {
+		return modules.FileOrDirInfo{}, filesystem.ErrNotExist
+	}
+	if err != nil {
+		return modules.FileOrDirInfo{}, errors.AddContext(err, "failed to open dir")
+	}
+	defer dir.Close()
+	di, err := r.staticFileSystem.DirInfo(siaPath)
+	if err != nil {
+		return modules.FileOrDirInfo{}, errors.AddContext(err, "failed to get dir info")
+	}
+	return modules.FileOrDirInfo{IsDir: true, Dir: di}, nil
+}
+
+// FileHostDistribution returns the number of pieces of a file that are stored
+// on each host together with the host's offline status. The hosts are sorted by
+// the number of pieces in descending order.
+func (r *Renter) FileHostDistribution(siaPath modules.SiaPath) ([]modules.FileHostPieces, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+
+	// Count the pieces per host.
+	hosts := make(map[string]*modules.FileHostPieces)
+	for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+		pieces, err := entry.Pieces(chunkIndex)
+		if err != nil {
+			return nil, err
+		}
+		for _, pieceSet := range pieces {
+			for _, piece := range pieceSet {
+				hpk := piece.HostPubKey.String()
+				if _, exists := hosts[hpk]; !exists {
+					hosts[hpk] = &modules.FileHostPieces{HostPublicKey: piece.HostPubKey}
+				}
+				hosts[hpk].Pieces++
+			}
+		}
+	}
+
+	// Add the offline status and sort the hosts.
+	distribution := make([]modules.FileHostPieces, 0, len(hosts))
+	for _, host := range hosts {
+		host.Offline = r.hostContractor.IsOffline(host.HostPublicKey)
+		distribution = append(distribution, *host)
+	}
+	sort.Slice(distribution, func(i, j int) bool {
+		if distribution[i].Pieces != distribution[j].Pieces {
+			return distribution[i].Pieces > distribution[j].Pieces
+		}
+		return distribution[i].HostPublicKey.String() < distribution[j].HostPublicKey.String()
+	})
+	return distribution, nil
+}
+
+// FileRedundancyParams returns the number of data and parity pieces a file was
+// uploaded with. The parameters are checked against every chunk of the file and
+// ErrInconsistentRedundancyParams is returned if any chunk differs.
+func (r *Renter) FileRedundancyParams(siaPath modules.SiaPath) (dataPieces, parityPieces int, err error) {
+	if err := r.tg.Add(); err != nil {
+		return 0, 0, err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer entry.Close()
+
+	ec := entry.ErasureCode()
+	for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+		pieces, err := entry.Pieces(chunkIndex)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(pieces) != ec.NumPieces() {
+			err = fmt.Errorf("chunk %v has %v pieces but the file's erasure code has %v", chunkIndex, len(pieces), ec.NumPieces())
+			return 0, 0, errors.Compose(err, ErrInconsistentRedundancyParams)
+		}
+	}
+	return ec.MinPieces(), ec.NumPieces() - ec.MinPieces(), nil
+}
+
 // FileCached returns file from siaPath queried by user, using cached values for
 // health and redundancy.
 func (r *Renter) FileCached(siaPath modules.SiaPath) (modules.FileInfo, error) {
@@ -88,12 +305,26 @@ func (r *Renter) RenameFile(currentName, newName modules.SiaPath) error {
 		return err
 	}
 	defer r.tg.Done()
+	if err := checkTrashPath(newName); err != nil {
+		return err
+	}
+	if err := r.managedCheckFileReadOnly(currentName); err != nil {
+		return err
+	}
 
 	// Rename file
+	return r.managedRenameFile(currentName, newName)
+}
+
+// managedRenameFile renames a file without checking whether the new name is
+// within the trash.
+func (r *Renter) managedRenameFile(currentName, newName modules.SiaPath) error {
 	err := r.staticFileSystem.RenameFile(currentName, newName)
 	if err != nil {
 		return err
 	}
+	r.managedRenameInContractIndex(currentName, newName)
+	r.managedRenameActiveUploads(currentName, newName)
 	// Call callThreadedBubbleMetadata on the old directory to make sure the
 	// system metadata is updated to reflect the move
 	dirSiaPath, err := currentName.Dir()
@@ -104,6 +335,149 @@ func (r *Renter) RenameFile(currentName, newName modules.SiaPath) error {
 
 	// Call callThreadedBubbleMetadata on the new directory to make sure the
 	// system metadata is updated to reflect the move
+	newDirSiaPath, err := newName.Dir()
+	if err != nil {
+		return err
+	}
+	go r.callThreadedBubbleMetadata(newDirSiaPath)
+	return nil
+}
+
+// Rename moves the file or directory at oldPath to newPath. If a file or
+// directory already exists at newPath, filesystem.ErrExists is returned.
+func (r *Renter) Rename(oldPath, newPath modules.SiaPath) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	isFile, err := r.staticFileSystem.FileExists(oldPath)
+	if err != nil {
+		return errors.AddContext(err, "failed to check for file at "+oldPath.String())
+	}
+	if isFile {
+		return r.RenameFile(oldPath, newPath)
+	}
+	return r.RenameDir(oldPath, newPath)
+}
+
+// FileTags returns the tags of a file.
+func (r *Renter) FileTags(siaPath modules.SiaPath) (map[string]string, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+	return entry.Tags(), nil
+}
+
+// SetFileCold marks a file as cold or hot. Cold files are only repaired once
+// their health drops below ColdRepairThreshold.
+func (r *Renter) SetFileCold(siaPath modules.SiaPath, cold bool) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if err := entry.SetCold(cold); err != nil {
+		return errors.AddContext(err, "unable to set cold status")
+	}
+	// Update the health of the directory which depends on the cold status.
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		return err
+	}
+	go r.callThreadedBubbleMetadata(dirSiaPath)
+	return nil
+}
+
+// SetReadOnly marks a file as read-only or writable. Read-only files can't be
+// deleted or renamed but are still repaired.
+func (r *Renter) SetReadOnly(siaPath modules.SiaPath, readOnly bool) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	// Files in the trash can't be made read-only since they need to be
+	// purged eventually.
+	if err := checkTrashPath(siaPath); err != nil {
+		return err
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	return errors.AddContext(entry.SetReadOnly(readOnly), "unable to set read-only status")
+}
+
+// managedCheckFileReadOnly returns ErrFileReadOnly if the file at siaPath is
+// read-only or an error if the file can't be opened.
+func (r *Renter) managedCheckFileReadOnly(siaPath modules.SiaPath) error {
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if entry.ReadOnly() {
+		return ErrFileReadOnly
+	}
+	return nil
+}
+
+// managedCheckDirReadOnly returns ErrFileReadOnly if the directory at siaPath
+// contains a read-only file or an error if the directory can't be listed.
+func (r *Renter) managedCheckDirReadOnly(siaPath modules.SiaPath) error {
+	files, _, err := r.staticFileSystem.CachedList(siaPath, true)
+	if err != nil {
+		return errors.AddContext(err, "failed to list directory")
+	}
+	for _, fi := range files {
+		if fi.ReadOnly {
+			return errors.AddContext(ErrFileReadOnly, fi.SiaPath.String())
+		}
+	}
+	return nil
+}
+
+// SetFileTags replaces the tags of a file. Passing an empty map removes all
+// the tags.
+func (r *Renter) SetFileTags(siaPath modules.SiaPath, tags map[string]string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if len(tags) > maxFileTags {
+		return errors.AddContext(ErrInvalidFileTags, fmt.Sprintf("a file can't have more than %v tags", maxFileTags))
+	}
+	for k, v := range tags {
+		if k == "" {
+			return errors.AddContext(ErrInvalidFileTags, "tag keys can't be empty")
+		}
+		if len(k) > maxFileTagLength || len(v) > maxFileTagLength {
+			return errors.AddContext(ErrInvalidFileTags, fmt.Sprintf("tag keys and values can't be longer than %v bytes", maxFileTagLength))
+		}
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	if err := entry.SetTags(tags); err != nil {
+		return errors.AddContext(err, "unable to set file tags")
+	}
+	// Update the number of tagged files of the directory.
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		return err
+	}
 	go r.callThreadedBubbleMetadata(dirSiaPath)
 	return nil
 }
@@ -1,21 +1,28 @@
 package renter
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
 
+	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
 	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // newRenterTestFile creates a test file when the test has a renter so that the
@@ -402,6 +409,430 @@ func TestRenterRenameFile(t *testing.T) {
 	}
 }
 
+// TestRenterRename probes the Rename method of the renter for files and
+// directories.
+func TestRenterRename(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file within a directory and another empty directory.
+	//
+	// root/dir/file
+	// root/other/
+	dir, err := modules.NewSiaPath("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := modules.NewSiaPath("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := dir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(file, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir(other, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renaming something that doesn't exist should fail.
+	err = rt.renter.Rename(modules.RandomSiaPath(), modules.RandomSiaPath())
+	if !errors.Contains(err, filesystem.ErrNotExist) {
+		t.Fatalf("expected %v but got %v", filesystem.ErrNotExist, err)
+	}
+	// Renaming onto an existing directory should fail.
+	if err := rt.renter.Rename(dir, other); !errors.Contains(err, filesystem.ErrExists) {
+		t.Fatalf("expected %v but got %v", filesystem.ErrExists, err)
+	}
+
+	// Move the file into the other directory. The metadata of the new
+	// directory should be updated.
+	movedFile, err := other.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.Rename(file, movedFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.File(movedFile); err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		di, err := rt.renter.staticFileSystem.DirInfo(other)
+		if err != nil {
+			return err
+		}
+		if di.NumFiles != 1 {
+			return fmt.Errorf("expected 1 file in %v but got %v", other, di.NumFiles)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Move the other directory into the first one.
+	movedDir, err := dir.Join("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.Rename(other, movedDir); err != nil {
+		t.Fatal(err)
+	}
+	movedFile, err = movedDir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.File(movedFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.staticFileSystem.Stat(other); !os.IsNotExist(err) {
+		t.Fatal("old directory should be gone", err)
+	}
+}
+
+// TestFilesByHealth tests that FilesByHealth only returns the files within the
+// health range and sorts them by health.
+func TestFilesByHealth(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create 3 files without any uploaded pieces. Their initial health depends
+	// on the erasure coding: 1-of-3 results in a health of 1, 1-of-2 in 2
+	// and 2-of-3 in 3.
+	params := [][2]int{{1, 2}, {1, 1}, {2, 1}}
+	siaPaths := make([]modules.SiaPath, len(params))
+	for i, p := range params {
+		siaPaths[i] = modules.RandomSiaPath()
+		rsc, _ := siafile.NewRSCode(p[0], p[1])
+		err = rt.renter.staticFileSystem.NewSiaFile(siaPaths[i], "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		minHealth float64
+		maxHealth float64
+		expected  []modules.SiaPath
+	}{
+		{0, 10, []modules.SiaPath{siaPaths[2], siaPaths[1], siaPaths[0]}},
+		{1.5, 3, []modules.SiaPath{siaPaths[2], siaPaths[1]}},
+		{0, 1, []modules.SiaPath{siaPaths[0]}},
+		{4, 10, nil},
+	}
+	for _, test := range tests {
+		fis, err := rt.renter.FilesByHealth(test.minHealth, test.maxHealth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []modules.SiaPath
+		for _, fi := range fis {
+			got = append(got, fi.SiaPath)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Fatalf("[%v, %v]: expected %v but got %v", test.minHealth, test.maxHealth, test.expected, got)
+		}
+	}
+
+	// An empty range is invalid.
+	if _, err := rt.renter.FilesByHealth(2, 1); !errors.Contains(err, ErrInvalidHealthRange) {
+		t.Fatalf("expected %v but got %v", ErrInvalidHealthRange, err)
+	}
+}
+
+// TestSetFileCold tests marking a file as cold.
+func TestSetFileCold(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	siaPath := modules.RandomSiaPath()
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checkCold checks the cold status reported by the renter.
+	checkCold := func(cold bool) {
+		t.Helper()
+		fi, err := rt.renter.File(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Cold != cold {
+			t.Fatalf("expected cold to be %v", cold)
+		}
+		md, err := rt.renter.RefreshFileMetadata(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.Cold != cold {
+			t.Fatalf("expected bubbled cold to be %v", cold)
+		}
+	}
+	checkCold(false)
+	if err := rt.renter.SetFileCold(siaPath, true); err != nil {
+		t.Fatal(err)
+	}
+	checkCold(true)
+	if err := rt.renter.SetFileCold(siaPath, false); err != nil {
+		t.Fatal(err)
+	}
+	checkCold(false)
+	if err := rt.renter.SetFileCold(modules.RandomSiaPath(), true); err == nil {
+		t.Fatal("expected setting a missing file cold to fail")
+	}
+}
+
+// TestSetReadOnly tests that read-only files and their directories can't be
+// deleted or renamed.
+func TestSetReadOnly(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	dirSiaPath := modules.RandomSiaPath()
+	siaPath, err := dirSiaPath.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.SetReadOnly(siaPath, true); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := rt.renter.File(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ReadOnly {
+		t.Fatal("file should be read-only")
+	}
+
+	// Neither the file nor its directory can be deleted or renamed.
+	newSiaPath := modules.RandomSiaPath()
+	if err := rt.renter.DeleteFile(siaPath); !errors.Contains(err, ErrFileReadOnly) {
+		t.Fatal("expected ErrFileReadOnly but got", err)
+	}
+	if err := rt.renter.RenameFile(siaPath, newSiaPath); !errors.Contains(err, ErrFileReadOnly) {
+		t.Fatal("expected ErrFileReadOnly but got", err)
+	}
+	if err := rt.renter.DeleteDir(dirSiaPath); !errors.Contains(err, ErrFileReadOnly) {
+		t.Fatal("expected ErrFileReadOnly but got", err)
+	}
+	if err := rt.renter.RenameDir(dirSiaPath, newSiaPath); !errors.Contains(err, ErrFileReadOnly) {
+		t.Fatal("expected ErrFileReadOnly but got", err)
+	}
+
+	// Canceling the upload, re-encoding the file and deleting it through the
+	// filesystem directly are refused as well.
+	if err := rt.renter.CancelUpload(siaPath, true); !errors.Contains(err, ErrFileReadOnly) {
+		t.Fatal("expected ErrFileReadOnly but got", err)
+	}
+	if err := rt.renter.managedDeleteFile(siaPath); !errors.Contains(err, ErrFileReadOnly) {
+		t.Fatal("expected ErrFileReadOnly but got", err)
+	}
+	ec, _ := siafile.NewRSCode(2, 1)
+	if err := rt.renter.ReEncode(siaPath, ec); !errors.Contains(err, ErrFileReadOnly) {
+		t.Fatal("expected ErrFileReadOnly but got", err)
+	}
+	if err := rt.renter.staticFileSystem.DeleteFile(siaPath); !errors.Contains(err, filesystem.ErrReadOnly) {
+		t.Fatal("expected ErrReadOnly but got", err)
+	}
+	if err := rt.renter.staticFileSystem.RenameFile(siaPath, newSiaPath); !errors.Contains(err, filesystem.ErrReadOnly) {
+		t.Fatal("expected ErrReadOnly but got", err)
+	}
+	if _, err := rt.renter.File(siaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checking a directory which doesn't exist fails instead of passing.
+	if err := rt.renter.managedCheckDirReadOnly(modules.RandomSiaPath()); err == nil {
+		t.Fatal("expected checking a missing directory to fail")
+	}
+
+	// Once the flag is cleared, the file can be renamed and deleted.
+	if err := rt.renter.SetReadOnly(siaPath, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RenameFile(siaPath, newSiaPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DeleteFile(newSiaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// The siafile of a failed upload is removed even if it is read-only
+	// already.
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entry.SetReadOnly(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedRemoveFailedUpload(siaPath, entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.File(siaPath); err == nil {
+		t.Fatal("read-only siafile of failed upload wasn't removed")
+	}
+}
+
+// TestFileTags probes setting and getting the tags of a file.
+func TestFileTags(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file in a sub directory.
+	dir, err := modules.NewSiaPath("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err := dir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new file shouldn't have any tags.
+	tags, err := rt.renter.FileTags(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 0 {
+		t.Fatal("new file shouldn't have tags", tags)
+	}
+
+	// Invalid tags should be rejected.
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxFileTags; i++ {
+		tooMany[fmt.Sprint(i)] = ""
+	}
+	invalid := []map[string]string{
+		{"": "value"},
+		{strings.Repeat("k", maxFileTagLength+1): "value"},
+		{"key": strings.Repeat("v", maxFileTagLength+1)},
+		tooMany,
+	}
+	for _, tags := range invalid {
+		if err := rt.renter.SetFileTags(siaPath, tags); !errors.Contains(err, ErrInvalidFileTags) {
+			t.Fatalf("expected %v but got %v", ErrInvalidFileTags, err)
+		}
+	}
+
+	// Set some tags.
+	expected := map[string]string{"project": "alpha", "retention": "90d"}
+	if err := rt.renter.SetFileTags(siaPath, expected); err != nil {
+		t.Fatal(err)
+	}
+	tags, err = rt.renter.FileTags(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("expected tags %v but got %v", expected, tags)
+	}
+
+	// The tagged file should be counted by the bubble.
+	rt.renter.managedBubbleMetadata(context.Background(), dir)
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		di, err := rt.renter.staticFileSystem.DirInfo(modules.RootSiaPath())
+		if err != nil {
+			return err
+		}
+		if di.NumTaggedFiles != 0 || di.AggregateNumTaggedFiles != 1 {
+			return fmt.Errorf("wrong number of tagged files %v %v", di.NumTaggedFiles, di.AggregateNumTaggedFiles)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tags should survive a restart.
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rt.renter, err = newRenterWithDependency(rt.gateway, rt.cs, rt.wallet, rt.tpool, filepath.Join(rt.dir, modules.RenterDir), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err = rt.renter.FileTags(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("expected tags %v but got %v", expected, tags)
+	}
+
+	// Remove the tags again.
+	if err := rt.renter.SetFileTags(siaPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	tags, err = rt.renter.FileTags(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 0 {
+		t.Fatal("tags weren't removed", tags)
+	}
+}
+
 // TestRenterFileDir tests that the renter files are uploaded to the files
 // directory and not the root directory of the renter.
 func TestRenterFileDir(t *testing.T) {
@@ -441,7 +872,7 @@ func TestRenterFileDir(t *testing.T) {
 		SiaPath:     siaPath,
 		ErasureCode: ec,
 	}
-	err = rt.renter.Upload(params)
+	_, err = rt.renter.Upload(params)
 	if err != nil {
 		t.Fatal("failed to upload file:", err)
 	}
@@ -463,3 +894,163 @@ func TestRenterFileDir(t *testing.T) {
 		t.Fatal("No .sia file found on disk")
 	}
 }
+
+// TestRenterFileHostDistribution tests that FileHostDistribution reports the
+// number of pieces stored on each host.
+func TestRenterFileHostDistribution(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file and add 2 pieces on one host and 1 piece on another.
+	entry, err := rt.renter.newRenterTestFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	hpk1 := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)}
+	hpk2 := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)}
+	for pieceIndex, hpk := range []types.SiaPublicKey{hpk1, hpk1, hpk2} {
+		if err := entry.AddPiece(hpk, 0, uint64(pieceIndex), crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Check the distribution. The hosts are unknown to the hostdb and
+	// therefore offline.
+	distribution, err := rt.renter.FileHostDistribution(rt.renter.staticFileSystem.FileSiaPath(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(distribution) != 2 {
+		t.Fatalf("expected 2 hosts but got %v", len(distribution))
+	}
+	expected := []struct {
+		hpk    types.SiaPublicKey
+		pieces int
+	}{{hpk1, 2}, {hpk2, 1}}
+	for i, e := range expected {
+		if !distribution[i].HostPublicKey.Equals(e.hpk) {
+			t.Fatalf("%v: wrong host", i)
+		}
+		if distribution[i].Pieces != e.pieces {
+			t.Fatalf("%v: expected %v pieces but got %v", i, e.pieces, distribution[i].Pieces)
+		}
+		if !distribution[i].Offline {
+			t.Fatalf("%v: host should be offline", i)
+		}
+	}
+
+	// Unknown files should return an error.
+	if _, err := rt.renter.FileHostDistribution(modules.RandomSiaPath()); err == nil {
+		t.Fatal("expected an error for an unknown file")
+	}
+}
+
+// TestRenterFileRedundancyParams tests that FileRedundancyParams returns the
+// erasure coding parameters a file was created with.
+func TestRenterFileRedundancyParams(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file with a 2-of-5 erasure code.
+	siaPath := modules.RandomSiaPath()
+	rsc, err := siafile.NewRSCode(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 1000, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPieces, parityPieces, err := rt.renter.FileRedundancyParams(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataPieces != 2 || parityPieces != 3 {
+		t.Fatalf("expected 2-of-5 but got %v-of-%v", dataPieces, dataPieces+parityPieces)
+	}
+
+	// Unknown files should return an error.
+	if _, _, err := rt.renter.FileRedundancyParams(modules.RandomSiaPath()); err == nil {
+		t.Fatal("expected an error for an unknown file")
+	}
+}
+
+// TestStat tests looking up the information of single files and directories.
+func TestStat(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file within a dir.
+	dirPath, err := modules.NewSiaPath("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath, err := dirPath.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(filePath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stat the file.
+	info, err := rt.renter.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDir || !info.File.SiaPath.Equals(filePath) || info.File.Filesize != 100 {
+		t.Fatal("wrong file info", info.IsDir, info.File.SiaPath, info.File.Filesize)
+	}
+
+	// Stat the dir and the root.
+	for _, siaPath := range []modules.SiaPath{dirPath, modules.RootSiaPath()} {
+		info, err = rt.renter.Stat(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir || !info.Dir.SiaPath.Equals(siaPath) {
+			t.Fatal("wrong dir info", info.IsDir, info.Dir.SiaPath)
+		}
+	}
+
+	// Missing paths should return ErrNotExist, even if their parent doesn't
+	// exist either.
+	missingPath, err := dirPath.Join("missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missingNested, err := missingPath.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range []modules.SiaPath{missingPath, missingNested} {
+		if _, err := rt.renter.Stat(siaPath); err != filesystem.ErrNotExist {
+			t.Fatalf("%v: expected ErrNotExist but got %v", siaPath, err)
+		}
+	}
+}
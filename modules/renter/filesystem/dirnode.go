@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
@@ -134,6 +135,39 @@ func (n *DirNode) UpdateMetadata(md siadir.Metadata) error {
 	return sd.UpdateMetadata(md)
 }
 
+// SetDefaultRedundancy is a wrapper for SiaDir.SetDefaultRedundancy.
+func (n *DirNode) SetDefaultRedundancy(dataPieces, parityPieces int) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sd, err := n.siaDir()
+	if err != nil {
+		return err
+	}
+	return sd.SetDefaultRedundancy(dataPieces, parityPieces)
+}
+
+// SetMinRedundancyTarget is a wrapper for SiaDir.SetMinRedundancyTarget.
+func (n *DirNode) SetMinRedundancyTarget(target float64) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sd, err := n.siaDir()
+	if err != nil {
+		return err
+	}
+	return sd.SetMinRedundancyTarget(target)
+}
+
+// SetScrubInterval is a wrapper for SiaDir.SetScrubInterval.
+func (n *DirNode) SetScrubInterval(interval time.Duration) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sd, err := n.siaDir()
+	if err != nil {
+		return err
+	}
+	return sd.SetScrubInterval(interval)
+}
+
 // managedList returns the files and dirs within the SiaDir specified by siaPath.
 // offlineMap, goodForRenewMap and contractMap don't need to be provided if
 // 'cached' is set to 'true'.
@@ -253,11 +287,13 @@ func (n *DirNode) managedRecursiveList(recursive, cached bool, fileLoadChan chan
 		if err != nil {
 			return err
 		}
-		// Hand a copy to the worker. It will handle closing it.
-		dirLoadChan <- dir.managedCopy()
-		// Call managedList on the child if 'recursive' was specified.
+		// Call managedList on the child if 'recursive' was specified. It
+		// will take care of listing the child itself. Otherwise hand a copy
+		// to the worker which will handle closing it.
 		if recursive {
 			err = dir.managedRecursiveList(recursive, cached, fileLoadChan, dirLoadChan)
+		} else {
+			dirLoadChan <- dir.managedCopy()
 		}
 		dir.Close()
 		if err != nil {
@@ -496,13 +532,17 @@ func (n *DirNode) managedDelete() error {
 }
 
 // managedDeleteFile deletes the file with the given name from the directory.
-func (n *DirNode) managedDeleteFile(fileName string) error {
+// Read-only files are only deleted if force is true.
+func (n *DirNode) managedDeleteFile(fileName string, force bool) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
 	// Check if the file is open in memory. If it is delete it.
 	sf, exists := n.files[fileName]
 	if exists {
+		if !force && sf.ReadOnly() {
+			return ErrReadOnly
+		}
 		err := sf.managedDelete()
 		if err != nil {
 			return err
@@ -534,6 +574,14 @@ func (n *DirNode) managedDeleteFile(fileName string) error {
 		return ErrDeleteFileIsDir
 	}
 
+	// Refuse to delete the file if it is read-only. Files which can't be
+	// loaded are corrupt and can always be deleted.
+	if !force {
+		if fn, err := n.readonlyOpenFile(fileName); err == nil && fn.ReadOnly() {
+			return ErrReadOnly
+		}
+	}
+
 	// Otherwise simply delete the file.
 	err = os.Remove(sysPath)
 	return errors.AddContext(err, "unable to delete file")
@@ -550,33 +598,51 @@ func (n *DirNode) managedInfo(siaPath modules.SiaPath) (modules.DirectoryInfo, e
 	maxHealth := math.Max(metadata.Health, metadata.StuckHealth)
 	return modules.DirectoryInfo{
 		// Aggregate Fields
-		AggregateHealth:              metadata.AggregateHealth,
-		AggregateLastHealthCheckTime: metadata.AggregateLastHealthCheckTime,
-		AggregateMaxHealth:           aggregateMaxHealth,
-		AggregateMaxHealthPercentage: modules.HealthPercentage(aggregateMaxHealth),
-		AggregateMinRedundancy:       metadata.AggregateMinRedundancy,
-		AggregateMostRecentModTime:   metadata.AggregateModTime,
-		AggregateNumFiles:            metadata.AggregateNumFiles,
-		AggregateNumStuckChunks:      metadata.AggregateNumStuckChunks,
-		AggregateNumSubDirs:          metadata.AggregateNumSubDirs,
-		AggregateSize:                metadata.AggregateSize,
-		AggregateStuckHealth:         metadata.AggregateStuckHealth,
+		AggregateHealth:               metadata.AggregateHealth,
+		AggregateLastHealthCheckTime:  metadata.AggregateLastHealthCheckTime,
+		AggregateMaxHealth:            aggregateMaxHealth,
+		AggregateMaxHealthPercentage:  modules.HealthPercentage(aggregateMaxHealth),
+		AggregateMinRedundancy:        metadata.AggregateMinRedundancy,
+		AggregateMostRecentModTime:    metadata.AggregateModTime,
+		AggregateNumFiles:             metadata.AggregateNumFiles,
+		AggregateNumFilesMissingLocal: metadata.AggregateNumFilesMissingLocal,
+		AggregateNumFilesScrubFailed:  metadata.AggregateNumFilesScrubFailed,
+		AggregateNumOrphanedFiles:     metadata.AggregateNumOrphanedFiles,
+		AggregateNumStuckChunks:       metadata.AggregateNumStuckChunks,
+		AggregateNumSubDirs:           metadata.AggregateNumSubDirs,
+		AggregateNumTaggedFiles:       metadata.AggregateNumTaggedFiles,
+		AggregateNumUniqueHosts:       metadata.AggregateNumUniqueHosts,
+		AggregateNumUnfinishedFiles:   metadata.AggregateNumUnfinishedFiles,
+		AggregateRepairSize:           metadata.AggregateRepairSize,
+		AggregateSize:                 metadata.AggregateSize,
+		AggregateStuckHealth:          metadata.AggregateStuckHealth,
 
 		// SiaDir Fields
-		Health:              metadata.Health,
-		LastHealthCheckTime: metadata.LastHealthCheckTime,
-		MaxHealth:           maxHealth,
-		MaxHealthPercentage: modules.HealthPercentage(maxHealth),
-		MinRedundancy:       metadata.MinRedundancy,
-		DirMode:             metadata.Mode,
-		MostRecentModTime:   metadata.ModTime,
-		NumFiles:            metadata.NumFiles,
-		NumStuckChunks:      metadata.NumStuckChunks,
-		NumSubDirs:          metadata.NumSubDirs,
-		DirSize:             metadata.Size,
-		StuckHealth:         metadata.StuckHealth,
-		SiaPath:             siaPath,
-		UID:                 n.staticUID,
+		DefaultDataPieces:    metadata.DefaultDataPieces,
+		DefaultParityPieces:  metadata.DefaultParityPieces,
+		Health:               metadata.Health,
+		LastHealthCheckTime:  metadata.LastHealthCheckTime,
+		MaxHealth:            maxHealth,
+		MaxHealthPercentage:  modules.HealthPercentage(maxHealth),
+		MinRedundancy:        metadata.MinRedundancy,
+		MinRedundancyTarget:  metadata.MinRedundancyTarget,
+		DirMode:              metadata.Mode,
+		MostRecentModTime:    metadata.ModTime,
+		NumFiles:             metadata.NumFiles,
+		NumFilesMissingLocal: metadata.NumFilesMissingLocal,
+		NumFilesScrubFailed:  metadata.NumFilesScrubFailed,
+		NumOrphanedFiles:     metadata.NumOrphanedFiles,
+		NumStuckChunks:       metadata.NumStuckChunks,
+		NumSubDirs:           metadata.NumSubDirs,
+		NumTaggedFiles:       metadata.NumTaggedFiles,
+		NumUniqueHosts:       metadata.NumUniqueHosts,
+		NumUnfinishedFiles:   metadata.NumUnfinishedFiles,
+		RepairSize:           metadata.RepairSize,
+		ScrubInterval:        metadata.ScrubInterval,
+		DirSize:              metadata.Size,
+		StuckHealth:          metadata.StuckHealth,
+		SiaPath:              siaPath,
+		UID:                  n.staticUID,
 	}, nil
 }
 
@@ -616,15 +682,17 @@ func (n *DirNode) childFiles() []*FileNode {
 	return files
 }
 
-// managedNewSiaFile creates a new SiaFile in the directory.
-func (n *DirNode) managedNewSiaFile(fileName string, source string, ec modules.ErasureCoder, mk crypto.CipherKey, fileSize uint64, fileMode os.FileMode, disablePartialUpload bool) error {
+// managedNewSiaFile creates a new SiaFile in the directory. If codec is not
+// CompressionNone, the file is created for compressed data of logicalSize
+// bytes before compression.
+func (n *DirNode) managedNewSiaFile(fileName string, source string, ec modules.ErasureCoder, mk crypto.CipherKey, fileSize uint64, codec modules.CompressionCodec, logicalSize uint64, fileMode os.FileMode, disablePartialUpload bool) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	// Make sure we don't have a file or folder with that name already.
 	if exists := n.childExists(fileName); exists {
 		return ErrExists
 	}
-	_, err := siafile.New(filepath.Join(n.absPath(), fileName+modules.SiaFileExtension), source, n.staticWal, ec, mk, fileSize, fileMode, nil, disablePartialUpload)
+	_, err := siafile.NewCompressed(filepath.Join(n.absPath(), fileName+modules.SiaFileExtension), source, n.staticWal, ec, mk, fileSize, logicalSize, codec, fileMode, nil, disablePartialUpload)
 	return errors.AddContext(err, "NewSiaFile: failed to create file")
 }
 
@@ -94,29 +94,40 @@ func (n *FileNode) managedFileInfo(siaPath modules.SiaPath, offline map[string]b
 	}
 	maxHealth := math.Max(health, stuckHealth)
 	fileInfo := modules.FileInfo{
-		AccessTime:       n.AccessTime(),
-		Available:        redundancy >= 1,
-		ChangeTime:       n.ChangeTime(),
-		CipherType:       n.MasterKey().Type().String(),
-		CreateTime:       n.CreateTime(),
-		Expiration:       n.Expiration(contracts),
-		Filesize:         n.Size(),
-		Health:           health,
-		LocalPath:        localPath,
-		MaxHealth:        maxHealth,
-		MaxHealthPercent: modules.HealthPercentage(maxHealth),
-		ModificationTime: n.ModTime(),
-		NumStuckChunks:   numStuckChunks,
-		OnDisk:           onDisk,
-		Recoverable:      onDisk || redundancy >= 1,
-		Redundancy:       redundancy,
-		Renewing:         true,
-		SiaPath:          siaPath,
-		Stuck:            numStuckChunks > 0,
-		StuckHealth:      stuckHealth,
-		UID:              n.staticUID,
-		UploadedBytes:    uploadedBytes,
-		UploadProgress:   uploadProgress,
+		AccessTime:          n.AccessTime(),
+		Available:           redundancy >= 1,
+		ChangeTime:          n.ChangeTime(),
+		CipherType:          n.MasterKey().Type().String(),
+		Cold:                n.Cold(),
+		Compression:         n.Compression(),
+		CreateTime:          n.CreateTime(),
+		EffectiveRedundancy: n.Metadata().CachedEffectiveRedundancy,
+		Expiration:          n.Expiration(contracts),
+		Filesize:            n.LogicalSize(),
+		Health:              health,
+		LastScrubTime:       n.LastScrubTime(),
+		LastVerifiedTime:    n.LastVerifiedTime(),
+		LocalPath:           localPath,
+		MaxHealth:           maxHealth,
+		MaxHealthPercent:    modules.HealthPercentage(maxHealth),
+		ModificationTime:    n.ModTime(),
+		NumStuckChunks:      numStuckChunks,
+		OnDisk:              onDisk,
+		ReadOnly:            n.ReadOnly(),
+		Recoverable:         onDisk || redundancy >= 1,
+		Redundancy:          redundancy,
+		Renewing:            true,
+		ScrubFailed:         n.ScrubFailed(),
+		SiaPath:             siaPath,
+		StoredSize:          n.Size(),
+		Stuck:               numStuckChunks > 0,
+		StuckHealth:         stuckHealth,
+		UID:                 n.staticUID,
+		UploadDeadline:      n.UploadDeadline(),
+		UploadRetries:       n.UploadRetries(),
+		UploadedBytes:       uploadedBytes,
+		UploadProgress:      uploadProgress,
+		VerificationFailed:  n.VerificationFailed(),
 	}
 	return fileInfo, nil
 }
@@ -135,6 +146,10 @@ func (n *FileNode) managedRename(newName string, oldParent, newParent *DirNode)
 	}
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	// Read-only files can't be renamed.
+	if n.SiaFile.ReadOnly() {
+		return ErrReadOnly
+	}
 	// Check that newParent doesn't have a file or folder with that name
 	// already.
 	if exists := newParent.childExists(newName); exists {
@@ -161,6 +176,42 @@ func (n *FileNode) managedRename(newName string, oldParent, newParent *DirNode)
 	return err
 }
 
+// managedReplace replaces the file old with the fNode's underlying file. The
+// fNode is moved to the location of old and old is deleted atomically.
+func (n *FileNode) managedReplace(old *FileNode, parent, oldParent *DirNode) error {
+	// Lock the parents. If they are the same, only lock one.
+	if parent.staticUID == oldParent.staticUID {
+		parent.mu.Lock()
+		defer parent.mu.Unlock()
+	} else {
+		parent.mu.Lock()
+		defer parent.mu.Unlock()
+		oldParent.mu.Lock()
+		defer oldParent.mu.Unlock()
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	// Read-only files can't be replaced.
+	if old.SiaFile.ReadOnly() {
+		return ErrReadOnly
+	}
+	// Replace the file.
+	if err := n.SiaFile.Replace(old.SiaFile); err != nil {
+		return err
+	}
+	// Remove both files from their parents and add the file to the parent of
+	// the replaced file.
+	parent.removeFile(n)
+	oldParent.removeFile(old)
+	n.parent = oldParent
+	*n.name = *old.name
+	*n.path = *old.path
+	n.parent.files[*n.name] = n
+	return nil
+}
+
 // cachedFileInfo returns information on a siafile. As a performance
 // optimization, the fileInfo takes the maps returned by
 // renter.managedContractUtilityMaps for many files at once.
@@ -175,30 +226,45 @@ func (n *FileNode) staticCachedInfo(siaPath modules.SiaPath) (modules.FileInfo,
 		onDisk = err == nil
 	}
 	maxHealth := math.Max(md.CachedHealth, md.CachedStuckHealth)
+	logicalSize := md.FileSize
+	if md.Compression != modules.CompressionNone {
+		logicalSize = md.LogicalSize
+	}
 	fileInfo := modules.FileInfo{
-		AccessTime:       md.AccessTime,
-		Available:        md.CachedUserRedundancy >= 1,
-		ChangeTime:       md.ChangeTime,
-		CipherType:       md.StaticMasterKeyType.String(),
-		CreateTime:       md.CreateTime,
-		Expiration:       md.CachedExpiration,
-		Filesize:         uint64(md.FileSize),
-		Health:           md.CachedHealth,
-		LocalPath:        localPath,
-		MaxHealth:        maxHealth,
-		MaxHealthPercent: modules.HealthPercentage(maxHealth),
-		ModificationTime: md.ModTime,
-		NumStuckChunks:   md.NumStuckChunks,
-		OnDisk:           onDisk,
-		Recoverable:      onDisk || md.CachedUserRedundancy >= 1,
-		Redundancy:       md.CachedUserRedundancy,
-		Renewing:         true,
-		SiaPath:          siaPath,
-		Stuck:            md.NumStuckChunks > 0,
-		StuckHealth:      md.CachedStuckHealth,
-		UID:              n.staticUID,
-		UploadedBytes:    md.CachedUploadedBytes,
-		UploadProgress:   md.CachedUploadProgress,
+		AccessTime:          md.AccessTime,
+		Available:           md.CachedUserRedundancy >= 1,
+		ChangeTime:          md.ChangeTime,
+		CipherType:          md.StaticMasterKeyType.String(),
+		Cold:                md.Cold,
+		Compression:         md.Compression,
+		CreateTime:          md.CreateTime,
+		EffectiveRedundancy: md.CachedEffectiveRedundancy,
+		Expiration:          md.CachedExpiration,
+		Filesize:            uint64(logicalSize),
+		Health:              md.CachedHealth,
+		LastScrubTime:       md.LastScrubTime,
+		LastVerifiedTime:    md.LastVerifiedTime,
+		LocalPath:           localPath,
+		MaxHealth:           maxHealth,
+		MaxHealthPercent:    modules.HealthPercentage(maxHealth),
+		ModificationTime:    md.ModTime,
+		NumStuckChunks:      md.NumStuckChunks,
+		OnDisk:              onDisk,
+		ReadOnly:            md.ReadOnly,
+		Recoverable:         onDisk || md.CachedUserRedundancy >= 1,
+		Redundancy:          md.CachedUserRedundancy,
+		Renewing:            true,
+		ScrubFailed:         md.ScrubFailed,
+		SiaPath:             siaPath,
+		StoredSize:          uint64(md.FileSize),
+		Stuck:               md.NumStuckChunks > 0,
+		StuckHealth:         md.CachedStuckHealth,
+		UID:                 n.staticUID,
+		UploadDeadline:      md.UploadDeadline,
+		UploadRetries:       n.UploadRetries(),
+		UploadedBytes:       md.CachedUploadedBytes,
+		UploadProgress:      md.CachedUploadProgress,
+		VerificationFailed:  md.VerificationFailed,
 	}
 	return fileInfo, nil
 }
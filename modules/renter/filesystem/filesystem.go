@@ -31,6 +31,10 @@ var (
 	// ErrDeleteFileIsDir is returned when the file delete method is used but
 	// the filename corresponds to a directory
 	ErrDeleteFileIsDir = errors.New("cannot delete file, file is a directory")
+
+	// ErrReadOnly is returned when trying to delete, rename or replace a
+	// read-only file.
+	ErrReadOnly = errors.New("file is read-only")
 )
 
 type (
@@ -228,7 +232,13 @@ func (fs *FileSystem) DeleteDir(siaPath modules.SiaPath) error {
 // file of the same path can be created and the existing file can't be opened
 // until all instances of it are closed.
 func (fs *FileSystem) DeleteFile(siaPath modules.SiaPath) error {
-	return fs.managedDeleteFile(siaPath.String())
+	return fs.managedDeleteFile(siaPath.String(), false)
+}
+
+// ForceDeleteFile deletes a file like DeleteFile but also deletes it if it is
+// read-only. It is meant for removing files which couldn't be fully created.
+func (fs *FileSystem) ForceDeleteFile(siaPath modules.SiaPath) error {
+	return fs.managedDeleteFile(siaPath.String(), true)
 }
 
 // DirInfo returns the Directory Information of the siadir
@@ -301,7 +311,22 @@ func (fs *FileSystem) NewSiaFile(siaPath modules.SiaPath, source string, ec modu
 	if err := fs.NewSiaDir(dirSiaPath, fileMode); err != nil {
 		return errors.AddContext(err, fmt.Sprintf("failed to create SiaDir %v for SiaFile %v", dirSiaPath.String(), siaPath.String()))
 	}
-	return fs.managedNewSiaFile(siaPath.String(), source, ec, mk, fileSize, fileMode, disablePartialUpload)
+	return fs.managedNewSiaFile(siaPath.String(), source, ec, mk, fileSize, modules.CompressionNone, 0, fileMode, disablePartialUpload)
+}
+
+// NewCompressedSiaFile creates a SiaFile at the specified siaPath for data
+// which was compressed using codec. fileSize is the size of the compressed
+// data and logicalSize the size of the data before compression.
+func (fs *FileSystem) NewCompressedSiaFile(siaPath modules.SiaPath, source string, ec modules.ErasureCoder, mk crypto.CipherKey, fileSize, logicalSize uint64, codec modules.CompressionCodec, fileMode os.FileMode, disablePartialUpload bool) error {
+	// Create SiaDir for file.
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		return err
+	}
+	if err := fs.NewSiaDir(dirSiaPath, fileMode); err != nil {
+		return errors.AddContext(err, fmt.Sprintf("failed to create SiaDir %v for SiaFile %v", dirSiaPath.String(), siaPath.String()))
+	}
+	return fs.managedNewSiaFile(siaPath.String(), source, ec, mk, fileSize, codec, logicalSize, fileMode, disablePartialUpload)
 }
 
 // ReadDir is a wrapper of ioutil.ReadDir which takes a SiaPath as an argument
@@ -449,6 +474,52 @@ func (fs *FileSystem) RenameFile(oldSiaPath, newSiaPath modules.SiaPath) error {
 	return sf.managedRename(newSiaPath.Name(), oldDir, newDir)
 }
 
+// ReplaceFile replaces the file at siaPath with the file at replacementSiaPath.
+// The replacement is moved to siaPath and the original file is deleted within a
+// single atomic operation.
+func (fs *FileSystem) ReplaceFile(siaPath, replacementSiaPath modules.SiaPath) error {
+	// Open the file to replace and its parent.
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		return err
+	}
+	dir, err := fs.managedOpenSiaDir(dirSiaPath)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	sf, err := dir.managedOpenFile(siaPath.Name())
+	if err == ErrNotExist {
+		return ErrNotExist
+	}
+	if err != nil {
+		return errors.AddContext(err, "failed to open file to replace")
+	}
+	defer sf.Close()
+
+	// Open the replacement and its parent.
+	replacementDirSiaPath, err := replacementSiaPath.Dir()
+	if err != nil {
+		return err
+	}
+	replacementDir, err := fs.managedOpenSiaDir(replacementDirSiaPath)
+	if err != nil {
+		return err
+	}
+	defer replacementDir.Close()
+	replacement, err := replacementDir.managedOpenFile(replacementSiaPath.Name())
+	if err == ErrNotExist {
+		return ErrNotExist
+	}
+	if err != nil {
+		return errors.AddContext(err, "failed to open replacement file")
+	}
+	defer replacement.Close()
+
+	// Replace the file.
+	return replacement.managedReplace(sf, replacementDir, dir)
+}
+
 // RenameDir takes an existing directory and changes the path. The original
 // directory must exist, and there must not be any directory that already has
 // the replacement path.  All sia files within directory will also be renamed
@@ -503,7 +574,7 @@ func (fs *FileSystem) RenameDir(oldSiaPath, newSiaPath modules.SiaPath) error {
 
 // managedDeleteFile opens the parent folder of the file to delete and calls
 // managedDeleteFile on it.
-func (fs *FileSystem) managedDeleteFile(relPath string) error {
+func (fs *FileSystem) managedDeleteFile(relPath string, force bool) error {
 	// Open the folder that contains the file.
 	dirPath, fileName := filepath.Split(relPath)
 	var dir *DirNode
@@ -519,7 +590,7 @@ func (fs *FileSystem) managedDeleteFile(relPath string) error {
 		// loaded in memory.
 		defer dir.Close()
 	}
-	return dir.managedDeleteFile(fileName)
+	return dir.managedDeleteFile(fileName, force)
 }
 
 // managedDeleteDir opens the parent folder of the dir to delete and calls
@@ -620,7 +691,7 @@ func (fs *FileSystem) managedOpenFile(relPath string) (*FileNode, error) {
 
 // managedNewSiaFile opens the parent folder of the new SiaFile and calls
 // managedNewSiaFile on it.
-func (fs *FileSystem) managedNewSiaFile(relPath string, source string, ec modules.ErasureCoder, mk crypto.CipherKey, fileSize uint64, fileMode os.FileMode, disablePartialUpload bool) error {
+func (fs *FileSystem) managedNewSiaFile(relPath string, source string, ec modules.ErasureCoder, mk crypto.CipherKey, fileSize uint64, codec modules.CompressionCodec, logicalSize uint64, fileMode os.FileMode, disablePartialUpload bool) error {
 	// Open the folder that contains the file.
 	dirPath, fileName := filepath.Split(relPath)
 	var dir *DirNode
@@ -634,7 +705,7 @@ func (fs *FileSystem) managedNewSiaFile(relPath string, source string, ec module
 		}
 		defer dir.Close()
 	}
-	return dir.managedNewSiaFile(fileName, source, ec, mk, fileSize, fileMode, disablePartialUpload)
+	return dir.managedNewSiaFile(fileName, source, ec, mk, fileSize, codec, logicalSize, fileMode, disablePartialUpload)
 }
 
 // managedOpenSiaDir opens a SiaDir and adds it and all of its parents to the
@@ -649,3 +720,132 @@ func (fs *FileSystem) managedOpenSiaDir(siaPath modules.SiaPath) (*DirNode, erro
 	}
 	return dir, nil
 }
+
+// Relocate copies the FileSystem to newRoot and makes newRoot the root of the
+// FileSystem. All the open nodes are locked while the tree is copied, which
+// blocks any access to the FileSystem and guarantees that there are no
+// unapplied wal transactions referencing the old root. After the copy,
+// persistRoot is called to persist the new location. If it fails, the copy is
+// removed and the FileSystem stays at the old root. Otherwise the paths of the
+// open nodes are updated and the old tree is removed.
+func (fs *FileSystem) Relocate(newRoot string, persistRoot func(string) error) error {
+	// Never copy into an existing tree since the copy is removed on failure.
+	fis, err := ioutil.ReadDir(newRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(fis) > 0 {
+		return ErrExists
+	}
+	oldRoot, lockedNodes, files, dirs := fs.managedLockTree()
+	unlock := func() {
+		for _, file := range files {
+			file.Unlock()
+		}
+		for i := len(lockedNodes) - 1; i >= 0; i-- {
+			lockedNodes[i].mu.Unlock()
+		}
+	}
+
+	// Copy the tree and persist the new location.
+	if err := copyTree(oldRoot, newRoot); err != nil {
+		unlock()
+		return errors.Compose(errors.AddContext(err, "failed to copy filesystem"), os.RemoveAll(newRoot))
+	}
+	if err := persistRoot(newRoot); err != nil {
+		unlock()
+		return errors.Compose(errors.AddContext(err, "failed to persist new filesystem root"), os.RemoveAll(newRoot))
+	}
+
+	// Update the paths of the nodes in memory. The locked nodes are ordered
+	// from the root towards the leaves which means that the parent of a node
+	// is always updated before the node itself.
+	*fs.path = newRoot
+	for _, node := range lockedNodes[1:] {
+		*node.path = filepath.Join(*node.parent.path, *node.name)
+	}
+	for _, file := range files {
+		*file.path = *file.path + modules.SiaFileExtension
+		file.UnmanagedSetSiaFilePath(*file.path)
+	}
+	for _, dir := range dirs {
+		if *dir.lazySiaDir == nil {
+			continue // dir isn't loaded
+		}
+		(*dir.lazySiaDir).SetPath(*dir.path)
+	}
+	unlock()
+
+	// Remove the old tree. At this point the FileSystem already uses the new
+	// root so failing to do so is not fatal.
+	if err := os.RemoveAll(oldRoot); err != nil {
+		fs.staticLog.Printf("WARN: failed to remove old filesystem root %v: %v", oldRoot, err)
+	}
+	return nil
+}
+
+// managedLockTree locks the root and all the open nodes of the FileSystem and
+// returns the root path, the locked nodes in the order they were locked, the
+// open files and the open dirs including the root. The SiaFiles of the open
+// files are locked as well.
+func (fs *FileSystem) managedLockTree() (string, []*node, []*FileNode, []*DirNode) {
+	var lockedNodes []*node
+	var files []*FileNode
+	var dirs []*DirNode
+	dirsToLock := []*DirNode{&fs.DirNode}
+	for len(dirsToLock) > 0 {
+		// Get next dir.
+		d := dirsToLock[0]
+		dirsToLock = dirsToLock[1:]
+		// Lock the dir.
+		d.mu.Lock()
+		lockedNodes = append(lockedNodes, &d.node)
+		dirs = append(dirs, d)
+		// Lock the open files.
+		for _, file := range d.files {
+			file.mu.Lock()
+			file.Lock()
+			lockedNodes = append(lockedNodes, &file.node)
+			files = append(files, file)
+		}
+		// Add the open dirs to dirsToLock.
+		dirsToLock = append(dirsToLock, d.childDirs()...)
+	}
+	return fs.absPath(), lockedNodes, files, dirs
+}
+
+// copyTree copies the directory tree at src to dst. dst is created if it
+// doesn't exist yet. All copied files are synced to disk.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+// copyFile copies the file at src to dst and syncs it to disk.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.Compose(err, out.Close())
+	}
+	return errors.Compose(out.Sync(), out.Close())
+}
@@ -689,6 +689,97 @@ func TestRenameFile(t *testing.T) {
 	sf.Close()
 }
 
+// TestReplaceFile tests that a file can be replaced by another one.
+func TestReplaceFile(t *testing.T) {
+	if testing.Short() && !build.VLONG {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// Create filesystem.
+	root := filepath.Join(testDir(t.Name()), "fs-root")
+	fs := newTestFileSystem(root)
+	// Add a file and its replacement in another dir.
+	foo := newSiaPath("foo")
+	replacement := newSiaPath("bar/foo")
+	fs.AddTestSiaFile(foo)
+	fs.AddTestSiaFile(replacement)
+	sf, err := fs.OpenSiaFile(foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	sfReplacement, err := fs.OpenSiaFile(replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sfReplacement.Close()
+	// Replace the file.
+	if err := fs.ReplaceFile(foo, replacement); err != nil {
+		t.Fatal(err)
+	}
+	// The original file should be deleted and the replacement should be
+	// moved.
+	if !sf.Deleted() {
+		t.Fatal("original file wasn't deleted")
+	}
+	if _, err := fs.OpenSiaFile(replacement); err != ErrNotExist {
+		t.Fatal("expected ErrNotExist but got:", err)
+	}
+	sf2, err := fs.OpenSiaFile(foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf2.Close()
+	if sf2.UID() != sfReplacement.UID() {
+		t.Fatal("file wasn't replaced")
+	}
+	// The replacement should be on disk at the new location.
+	fs2 := newTestFileSystem(root)
+	sf3, err := fs2.OpenSiaFile(foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf3.Close()
+	if sf3.UID() != sfReplacement.UID() {
+		t.Fatal("file wasn't replaced on disk")
+	}
+	// Replacing a missing file should fail.
+	if err := fs.ReplaceFile(newSiaPath("missing"), foo); err != ErrNotExist {
+		t.Fatal("expected ErrNotExist but got:", err)
+	}
+	// Read-only files can't be replaced or deleted, neither while they are
+	// loaded nor when they are only on disk.
+	readOnly := newSiaPath("readonly")
+	replacement = newSiaPath("bar/readonly")
+	fs.AddTestSiaFile(readOnly)
+	fs.AddTestSiaFile(replacement)
+	sf4, err := fs.OpenSiaFile(readOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sf4.SetReadOnly(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.ReplaceFile(readOnly, replacement); err != ErrReadOnly {
+		t.Fatal("expected ErrReadOnly but got:", err)
+	}
+	if err := fs.DeleteFile(readOnly); err != ErrReadOnly {
+		t.Fatal("expected ErrReadOnly but got:", err)
+	}
+	sf4.Close()
+	fs3 := newTestFileSystem(root)
+	if err := fs3.DeleteFile(readOnly); err != ErrReadOnly {
+		t.Fatal("expected ErrReadOnly but got:", err)
+	}
+	// ForceDeleteFile ignores the read-only status.
+	if err := fs3.ForceDeleteFile(readOnly); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs3.OpenSiaFile(readOnly); err != ErrNotExist {
+		t.Fatal("expected ErrNotExist but got:", err)
+	}
+}
+
 // TestThreadedAccess tests rapidly opening and closing files and directories
 // from multiple threads to check the locking conventions.
 func TestThreadedAccess(t *testing.T) {
@@ -1756,3 +1847,35 @@ func TestFailedOpenFileFolder(t *testing.T) {
 		t.Fatal("Expected 0 files and folders but got", len(fs.files), len(fs.directories))
 	}
 }
+
+// TestRecursiveListNoDuplicates makes sure that a recursive listing contains
+// every directory exactly once.
+func TestRecursiveListNoDuplicates(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// Create filesystem with the dirs /a, /a/b and /c.
+	root := filepath.Join(testDir(t.Name()), "fs-root")
+	fs := newTestFileSystem(root)
+	for _, dir := range []string{"a/b", "c"} {
+		if err := fs.NewSiaDir(newSiaPath(dir), modules.DefaultDirPerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A recursive listing of the root should contain the root and the 3 dirs.
+	_, dis, err := fs.CachedList(modules.RootSiaPath(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[modules.SiaPath]struct{})
+	for _, di := range dis {
+		if _, exists := seen[di.SiaPath]; exists {
+			t.Fatal("directory listed twice", di.SiaPath)
+		}
+		seen[di.SiaPath] = struct{}{}
+	}
+	if len(dis) != 4 {
+		t.Fatal("expected 4 dirs but got", len(dis))
+	}
+}
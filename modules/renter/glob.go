@@ -0,0 +1,154 @@
+package renter
+
+// glob.go implements matching SiaPaths against glob patterns. A pattern is
+// split into segments at '/' and every segment is matched against one element
+// of a SiaPath with the following rules:
+//
+//   - '*' matches any sequence of characters within a single element.
+//   - '?' matches exactly one character within a single element.
+//   - '[...]' matches a character class and '\' escapes the following
+//     character, as defined by path.Match.
+//   - A segment consisting of only '**' matches zero or more elements, which
+//     means that "a/**" matches "a" itself as well as everything below it. If
+//     '**' is part of a longer segment it behaves like '*'.
+//
+// A leading '/' is ignored since patterns are always relative to the root
+// directory. A trailing '/' restricts the matches to directories. The root
+// directory itself is never returned and empty segments, e.g. in "a//b", are
+// not allowed.
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// ErrInvalidGlobPattern is returned by Glob if the provided pattern is
+	// malformed.
+	ErrInvalidGlobPattern = errors.New("invalid glob pattern")
+)
+
+// globSegments splits a glob pattern into its segments and returns whether
+// only directories should be matched.
+func globSegments(pattern string) ([]string, bool, error) {
+	pattern = strings.TrimPrefix(pattern, "/")
+	dirsOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return nil, false, errors.AddContext(ErrInvalidGlobPattern, "pattern is empty")
+	}
+	segments := strings.Split(pattern, "/")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, false, errors.AddContext(ErrInvalidGlobPattern, "pattern contains an empty segment")
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, false, errors.Compose(err, ErrInvalidGlobPattern)
+		}
+	}
+	return segments, dirsOnly, nil
+}
+
+// globMatch returns whether the elements of a SiaPath match the pattern
+// segments.
+func globMatch(pattern, elements []string) bool {
+	if len(pattern) == 0 {
+		return len(elements) == 0
+	}
+	if pattern[0] == "**" {
+		return globMatch(pattern[1:], elements) || (len(elements) > 0 && globMatch(pattern, elements[1:]))
+	}
+	if len(elements) == 0 {
+		return false
+	}
+	// The pattern was validated by globSegments so the error can be ignored.
+	ok, _ := path.Match(pattern[0], elements[0])
+	return ok && globMatch(pattern[1:], elements[1:])
+}
+
+// globMatchPrefix returns whether the elements of a directory's SiaPath could
+// be the prefix of a SiaPath that matches the pattern segments. It is used to
+// skip directories which can't contain any matches.
+func globMatchPrefix(pattern, elements []string) bool {
+	if len(elements) == 0 {
+		return true
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+	if pattern[0] == "**" {
+		return true
+	}
+	ok, _ := path.Match(pattern[0], elements[0])
+	return ok && globMatchPrefix(pattern[1:], elements[1:])
+}
+
+// Glob returns the SiaPaths of all the files and directories that match the
+// glob pattern, sorted by their string representation. See glob.go for a
+// description of the supported syntax.
+func (r *Renter) Glob(pattern string) ([]modules.SiaPath, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	segments, dirsOnly, err := globSegments(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matches []modules.SiaPath
+	err = r.managedGlobDir(modules.RootSiaPath(), nil, segments, dirsOnly, &matches)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].String() < matches[j].String()
+	})
+	return matches, nil
+}
+
+// managedGlobDir walks the directory at siaPath and adds all the files and
+// directories which match the pattern to matches. elements are the elements of
+// siaPath.
+func (r *Renter) managedGlobDir(siaPath modules.SiaPath, elements, pattern []string, dirsOnly bool, matches *[]modules.SiaPath) error {
+	fileinfos, err := r.staticFileSystem.ReadDir(siaPath)
+	if err != nil {
+		return errors.AddContext(err, "failed to read directory "+siaPath.String())
+	}
+	for _, fi := range fileinfos {
+		// Check to make sure renter hasn't been shutdown
+		select {
+		case <-r.tg.StopChan():
+			return errors.New("renter shutdown before glob was complete")
+		default:
+		}
+
+		// Only consider directories and siafiles.
+		name := fi.Name()
+		if !fi.IsDir() {
+			if dirsOnly || path.Ext(name) != modules.SiaFileExtension {
+				continue
+			}
+			name = strings.TrimSuffix(name, modules.SiaFileExtension)
+		}
+		childPath, err := siaPath.Join(name)
+		if err != nil {
+			return err
+		}
+		childElements := append(append([]string(nil), elements...), name)
+		if globMatch(pattern, childElements) {
+			*matches = append(*matches, childPath)
+		}
+		if fi.IsDir() && globMatchPrefix(pattern, childElements) {
+			err = r.managedGlobDir(childPath, childElements, pattern, dirsOnly, matches)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package renter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestGlobMatch tests matching SiaPath elements against glob patterns.
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/*", "a/b", true},
+		{"a/*", "a/b/c", false},
+		{"a/?", "a/b", true},
+		{"a/?", "a/bc", false},
+		{"a/b*", "a/bcd", true},
+		{"a/**", "a/b/c", true},
+		{"a/**", "a", true},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/b/c", true},
+		{"a/**/c", "a/b/d", false},
+		{"**/c", "a/b/c", true},
+		{"**", "a/b/c", true},
+		{"a/b**", "a/bc/d", false},
+		{"a/[bc]", "a/c", true},
+		{"a/\\*", "a/*", true},
+		{"a/\\*", "a/b", false},
+	}
+	for _, test := range tests {
+		segments, _, err := globSegments(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match := globMatch(segments, strings.Split(test.path, "/")); match != test.match {
+			t.Errorf("%v %v: expected %v but got %v", test.pattern, test.path, test.match, match)
+		}
+	}
+}
+
+// TestGlobSegments tests parsing glob patterns.
+func TestGlobSegments(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		segments []string
+		dirsOnly bool
+		err      bool
+	}{
+		{"a/b", []string{"a", "b"}, false, false},
+		{"/a/b", []string{"a", "b"}, false, false},
+		{"a/b/", []string{"a", "b"}, true, false},
+		{"/", nil, false, true},
+		{"", nil, false, true},
+		{"a//b", nil, false, true},
+		{"a/[", nil, false, true},
+	}
+	for _, test := range tests {
+		segments, dirsOnly, err := globSegments(test.pattern)
+		if test.err {
+			if !errors.Contains(err, ErrInvalidGlobPattern) {
+				t.Errorf("%v: expected ErrInvalidGlobPattern but got %v", test.pattern, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(segments, test.segments) || dirsOnly != test.dirsOnly {
+			t.Errorf("%v: expected %v %v but got %v %v", test.pattern, test.segments, test.dirsOnly, segments, dirsOnly)
+		}
+	}
+}
+
+// TestRenterGlob tests globbing the renter's filesystem.
+func TestRenterGlob(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create the following tree.
+	//
+	// glob/a.txt
+	// glob/backups/2023/jan/file1
+	// glob/backups/2023/feb/file2
+	// glob/backups/2024/file3
+	rsc, _ := siafile.NewRSCode(1, 1)
+	for _, file := range []string{"glob/a.txt", "glob/backups/2023/jan/file1", "glob/backups/2023/feb/file2", "glob/backups/2024/file3"} {
+		siaPath, err := modules.NewSiaPath(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		matches []string
+	}{
+		{"glob/backups/2023/*", []string{"glob/backups/2023/feb", "glob/backups/2023/jan"}},
+		{"glob/backups/2023/*/", []string{"glob/backups/2023/feb", "glob/backups/2023/jan"}},
+		{"glob/backups/**/file?", []string{"glob/backups/2023/feb/file2", "glob/backups/2023/jan/file1", "glob/backups/2024/file3"}},
+		{"/glob/backups/*/", []string{"glob/backups/2023", "glob/backups/2024"}},
+		{"glob/backups/2024/*/", nil},
+		{"glob/*.txt", []string{"glob/a.txt"}},
+		{"glob/backups/", []string{"glob/backups"}},
+		{"glob/nothing/*", nil},
+		{"glob/**", []string{
+			"glob",
+			"glob/a.txt",
+			"glob/backups",
+			"glob/backups/2023",
+			"glob/backups/2023/feb",
+			"glob/backups/2023/feb/file2",
+			"glob/backups/2023/jan",
+			"glob/backups/2023/jan/file1",
+			"glob/backups/2024",
+			"glob/backups/2024/file3",
+		}},
+	}
+	for _, test := range tests {
+		matches, err := rt.renter.Glob(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, match := range matches {
+			got = append(got, match.String())
+		}
+		if !reflect.DeepEqual(got, test.matches) {
+			t.Errorf("%v: expected %v but got %v", test.pattern, test.matches, got)
+		}
+	}
+
+	// Invalid patterns should return an error.
+	if _, err := rt.renter.Glob("glob//a.txt"); !errors.Contains(err, ErrInvalidGlobPattern) {
+		t.Fatal("expected ErrInvalidGlobPattern but got", err)
+	}
+}
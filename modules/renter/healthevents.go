@@ -0,0 +1,78 @@
+package renter
+
+// healthevents.go allows external subscribers to react to directories
+// crossing the repair threshold without polling the directory metadata. Events
+// are sent without blocking so a slow subscriber can never stall a bubble.
+
+import (
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// SubscribeHealthEvents returns a channel which receives a HealthEvent whenever
+// the aggregate health of a directory crosses the repair threshold. The channel
+// is closed when the renter shuts down.
+func (r *Renter) SubscribeHealthEvents() <-chan modules.HealthEvent {
+	c := make(chan modules.HealthEvent, healthEventBufferSize)
+	r.healthSubscribersMu.Lock()
+	defer r.healthSubscribersMu.Unlock()
+	select {
+	case <-r.tg.StopChan():
+		// Don't add new subscribers after shutdown.
+		close(c)
+		return c
+	default:
+	}
+	r.healthSubscribers[c] = struct{}{}
+	return c
+}
+
+// UnsubscribeHealthEvents removes a subscriber and closes its channel.
+func (r *Renter) UnsubscribeHealthEvents(sub <-chan modules.HealthEvent) {
+	r.healthSubscribersMu.Lock()
+	defer r.healthSubscribersMu.Unlock()
+	for c := range r.healthSubscribers {
+		if c == sub {
+			delete(r.healthSubscribers, c)
+			close(c)
+			return
+		}
+	}
+}
+
+// managedCloseHealthSubscribers closes the channels of all subscribers.
+func (r *Renter) managedCloseHealthSubscribers() {
+	r.healthSubscribersMu.Lock()
+	defer r.healthSubscribersMu.Unlock()
+	for c := range r.healthSubscribers {
+		close(c)
+	}
+	r.healthSubscribers = make(map[chan modules.HealthEvent]struct{})
+}
+
+// managedNotifyHealthChange sends a HealthEvent to all subscribers if the
+// change from oldHealth to newHealth crosses the repair threshold.
+func (r *Renter) managedNotifyHealthChange(siaPath modules.SiaPath, oldHealth, newHealth float64) {
+	threshold := r.managedRepairThreshold()
+	needsRepair := newHealth >= threshold
+	if (oldHealth >= threshold) == needsRepair {
+		return
+	}
+	event := modules.HealthEvent{
+		SiaPath:     siaPath,
+		OldHealth:   oldHealth,
+		NewHealth:   newHealth,
+		NeedsRepair: needsRepair,
+		Time:        time.Now(),
+	}
+	r.healthSubscribersMu.Lock()
+	defer r.healthSubscribersMu.Unlock()
+	for c := range r.healthSubscribers {
+		select {
+		case c <- event:
+		default:
+			r.log.Debugln("Dropping health event for slow subscriber:", siaPath)
+		}
+	}
+}
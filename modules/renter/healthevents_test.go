@@ -0,0 +1,92 @@
+package renter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestHealthEvents tests that subscribers are notified when a directory
+// crosses the repair threshold.
+func TestHealthEvents(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	sub := rt.renter.SubscribeHealthEvents()
+
+	// nextEvent returns the next event for dir.
+	nextEvent := func(dir modules.SiaPath) modules.HealthEvent {
+		for {
+			select {
+			case e := <-sub:
+				if e.SiaPath.Equals(dir) {
+					return e
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("no event received for", dir)
+			}
+		}
+	}
+
+	// Create an empty directory and bubble it. It is healthy so no event
+	// should be emitted.
+	dir := modules.RandomSiaPath()
+	if err := rt.renter.CreateDir(dir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a file which hasn't been uploaded to the directory. The directory
+	// should need a repair after the next bubble.
+	filePath, err := dir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.staticFileSystem.NewSiaFile(filePath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	e := nextEvent(dir)
+	if !e.NeedsRepair || e.NewHealth < RepairThreshold || e.OldHealth >= RepairThreshold {
+		t.Fatal("unexpected event", e)
+	}
+
+	// Delete the file. The directory should be healthy again.
+	if err := rt.renter.DeleteFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	e = nextEvent(dir)
+	if e.NeedsRepair || e.NewHealth >= RepairThreshold {
+		t.Fatal("unexpected event", e)
+	}
+
+	// After unsubscribing the channel should be closed.
+	rt.renter.UnsubscribeHealthEvents(sub)
+	for range sub {
+	}
+}
@@ -0,0 +1,58 @@
+package renter
+
+import (
+	"sort"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// HostScores returns the scores of the hosts in the worker pool. Pieces are
+// handed to all workers of hosts which are GoodForUpload and not on cooldown,
+// so the score breakdown together with the upload stats of a worker explain
+// why pieces end up on a host. The scores are sorted from best to worst.
+func (r *Renter) HostScores() ([]modules.HostScore, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+
+	r.staticWorkerPool.mu.RLock()
+	workers := make([]*worker, 0, len(r.staticWorkerPool.workers))
+	for _, w := range r.staticWorkerPool.workers {
+		workers = append(workers, w)
+	}
+	r.staticWorkerPool.mu.RUnlock()
+
+	scores := make([]modules.HostScore, 0, len(workers))
+	for _, w := range workers {
+		score := modules.HostScore{
+			PublicKey: w.staticHostPubKey,
+		}
+		// Hosts which are not in the hostdb keep a zero breakdown.
+		entry, exists, err := r.hostDB.Host(w.staticHostPubKey)
+		if exists && err == nil {
+			score.ScoreBreakdown, err = r.hostDB.ScoreBreakdown(entry)
+			if err != nil {
+				return nil, errors.AddContext(err, "unable to get score breakdown")
+			}
+		}
+		utility, exists := r.hostContractor.ContractUtility(w.staticHostPubKey)
+		score.GoodForUpload = exists && utility.GoodForUpload
+
+		w.mu.Lock()
+		score.UploadLatency = w.uploadRecentLatency
+		score.UploadConsecutiveFailures = w.uploadConsecutiveFailures
+		score.UploadOnCooldown, score.UploadCooldownRemaining = w.onUploadCooldown()
+		w.mu.Unlock()
+		if !score.UploadOnCooldown {
+			score.UploadCooldownRemaining = 0
+		}
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].ScoreBreakdown.Score.Cmp(scores[j].ScoreBreakdown.Score) > 0
+	})
+	return scores, nil
+}
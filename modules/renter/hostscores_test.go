@@ -0,0 +1,77 @@
+package renter
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestHostScores tests that HostScores reports the upload stats of the
+// workers.
+func TestHostScores(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Manually add two workers to the worker pool. One of them recently
+	// uploaded a piece and the other one is on cooldown.
+	good := &worker{
+		staticHostPubKey:    types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)},
+		uploadRecentLatency: time.Second,
+		killChan:            make(chan struct{}),
+		wakeChan:            make(chan struct{}, 1),
+	}
+	bad := &worker{
+		staticHostPubKey:          types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)},
+		uploadConsecutiveFailures: 3,
+		uploadRecentFailure:       time.Now(),
+		killChan:                  make(chan struct{}),
+		wakeChan:                  make(chan struct{}, 1),
+	}
+	rt.renter.staticWorkerPool.mu.Lock()
+	rt.renter.staticWorkerPool.workers[good.staticHostPubKey.String()] = good
+	rt.renter.staticWorkerPool.workers[bad.staticHostPubKey.String()] = bad
+	rt.renter.staticWorkerPool.mu.Unlock()
+
+	scores, err := rt.renter.HostScores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 2 {
+		t.Fatal("expected 2 scores but got", len(scores))
+	}
+	for _, score := range scores {
+		// The hosts don't have contracts.
+		if score.GoodForUpload {
+			t.Fatal("host shouldn't be GoodForUpload")
+		}
+		switch score.PublicKey.String() {
+		case good.staticHostPubKey.String():
+			if score.UploadLatency != time.Second {
+				t.Fatal("wrong latency", score.UploadLatency)
+			}
+			if score.UploadOnCooldown || score.UploadCooldownRemaining != 0 || score.UploadConsecutiveFailures != 0 {
+				t.Fatal("worker shouldn't be on cooldown", score)
+			}
+		case bad.staticHostPubKey.String():
+			if score.UploadLatency != 0 {
+				t.Fatal("wrong latency", score.UploadLatency)
+			}
+			if !score.UploadOnCooldown || score.UploadCooldownRemaining <= 0 || score.UploadConsecutiveFailures != 3 {
+				t.Fatal("worker should be on cooldown", score)
+			}
+		default:
+			t.Fatal("unknown host", score.PublicKey)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package renter
+
+// hostthroughput.go measures the upload throughput of the renter's hosts and
+// uses it to spread repairs towards faster hosts. Every worker keeps the
+// successful uploads of the last hostThroughputWindow. When a repair chunk is
+// built, hosts whose throughput is far below the median are removed from the
+// chunk's unused hosts, as long as enough hosts remain to keep the pieces
+// spread out. Hosts without recent uploads are never removed since their
+// throughput is unknown.
+
+import (
+	"sort"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// throughputSample is a single successful upload to a host.
+type throughputSample struct {
+	timestamp time.Time
+	bytes     uint64
+	duration  time.Duration
+}
+
+// recordUploadThroughput adds a successful upload to the worker's throughput
+// samples. The worker's mutex needs to be held.
+func (w *worker) recordUploadThroughput(bytes uint64, duration time.Duration, now time.Time) {
+	w.uploadThroughputSamples = append(w.uploadThroughputSamples, throughputSample{
+		timestamp: now,
+		bytes:     bytes,
+		duration:  duration,
+	})
+	if len(w.uploadThroughputSamples) > maxHostThroughputSamples {
+		w.uploadThroughputSamples = w.uploadThroughputSamples[len(w.uploadThroughputSamples)-maxHostThroughputSamples:]
+	}
+}
+
+// uploadThroughput returns the throughput of the worker's host in bytes per
+// second over the last hostThroughputWindow, together with the number of
+// samples it is based on. Samples outside of the window are dropped. The
+// worker's mutex needs to be held.
+func (w *worker) uploadThroughput(now time.Time) (float64, int) {
+	i := 0
+	for i < len(w.uploadThroughputSamples) && now.Sub(w.uploadThroughputSamples[i].timestamp) > hostThroughputWindow {
+		i++
+	}
+	w.uploadThroughputSamples = w.uploadThroughputSamples[i:]
+
+	var bytes uint64
+	var duration time.Duration
+	for _, sample := range w.uploadThroughputSamples {
+		bytes += sample.bytes
+		duration += sample.duration
+	}
+	if duration <= 0 {
+		return 0, len(w.uploadThroughputSamples)
+	}
+	return float64(bytes) / duration.Seconds(), len(w.uploadThroughputSamples)
+}
+
+// managedHostThroughputs returns the throughput of all the hosts in the worker
+// pool.
+func (r *Renter) managedHostThroughputs() []modules.HostThroughput {
+	r.staticWorkerPool.mu.RLock()
+	workers := make([]*worker, 0, len(r.staticWorkerPool.workers))
+	for _, w := range r.staticWorkerPool.workers {
+		workers = append(workers, w)
+	}
+	r.staticWorkerPool.mu.RUnlock()
+
+	now := time.Now()
+	throughputs := make([]modules.HostThroughput, 0, len(workers))
+	for _, w := range workers {
+		w.mu.Lock()
+		throughput, samples := w.uploadThroughput(now)
+		w.mu.Unlock()
+		throughputs = append(throughputs, modules.HostThroughput{
+			PublicKey:  w.staticHostPubKey,
+			Throughput: throughput,
+			Samples:    samples,
+		})
+	}
+	return throughputs
+}
+
+// HostThroughput returns the recent upload throughput of the hosts in the
+// worker pool, sorted from fastest to slowest.
+func (r *Renter) HostThroughput() ([]modules.HostThroughput, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	throughputs := r.managedHostThroughputs()
+	sort.Slice(throughputs, func(i, j int) bool {
+		return throughputs[i].Throughput > throughputs[j].Throughput
+	})
+	return throughputs, nil
+}
+
+// hostThroughputRanking ranks the hosts of the worker pool by their recent
+// upload throughput. It is computed once per heap build and shared by all the
+// chunks built for the heap.
+type hostThroughputRanking struct {
+	// slowHosts are the hosts whose throughput is below
+	// slowHostThroughputRatio times the median throughput, slowest first.
+	slowHosts []string
+}
+
+// newHostThroughputRanking ranks the hosts of the provided throughputs. Hosts
+// without samples are ignored since their throughput is unknown.
+func newHostThroughputRanking(throughputs []modules.HostThroughput) *hostThroughputRanking {
+	var measured []modules.HostThroughput
+	for _, ht := range throughputs {
+		if ht.Samples > 0 {
+			measured = append(measured, ht)
+		}
+	}
+	ranking := &hostThroughputRanking{}
+	if len(measured) == 0 {
+		return ranking
+	}
+	sort.Slice(measured, func(i, j int) bool {
+		return measured[i].Throughput < measured[j].Throughput
+	})
+	median := measured[len(measured)/2].Throughput
+	if len(measured)%2 == 0 {
+		median = (median + measured[len(measured)/2-1].Throughput) / 2
+	}
+	for _, ht := range measured {
+		if ht.Throughput >= slowHostThroughputRatio*median {
+			break
+		}
+		ranking.slowHosts = append(ranking.slowHosts, ht.PublicKey.String())
+	}
+	return ranking
+}
+
+// managedHostThroughputRanking ranks the hosts of the worker pool by their
+// recent upload throughput.
+func (r *Renter) managedHostThroughputRanking() *hostThroughputRanking {
+	return newHostThroughputRanking(r.managedHostThroughputs())
+}
+
+// removeSlowHosts removes the slow hosts of the ranking from unusedHosts,
+// slowest first. Hosts are only removed while more than repairHostDiversity
+// times missingPieces hosts remain. A nil ranking doesn't remove any hosts.
+func (ranking *hostThroughputRanking) removeSlowHosts(unusedHosts map[string]struct{}, missingPieces int) {
+	if ranking == nil {
+		return
+	}
+	minHosts := repairHostDiversity * missingPieces
+	for _, host := range ranking.slowHosts {
+		if len(unusedHosts) <= minHosts {
+			return
+		}
+		delete(unusedHosts, host)
+	}
+}
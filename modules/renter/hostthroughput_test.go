@@ -0,0 +1,101 @@
+package renter
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestUploadThroughput probes the throughput measurement of a worker.
+func TestUploadThroughput(t *testing.T) {
+	w := new(worker)
+	now := time.Now()
+	if throughput, samples := w.uploadThroughput(now); throughput != 0 || samples != 0 {
+		t.Fatal("worker without uploads should have no throughput", throughput, samples)
+	}
+
+	// An old sample falls out of the window.
+	w.recordUploadThroughput(1, time.Second, now.Add(-hostThroughputWindow-time.Second))
+	w.recordUploadThroughput(1000, time.Second, now)
+	w.recordUploadThroughput(3000, time.Second, now)
+	throughput, samples := w.uploadThroughput(now)
+	if samples != 2 || throughput != 2000 {
+		t.Fatal("wrong throughput", throughput, samples)
+	}
+
+	// The number of samples is limited.
+	for i := 0; i < 2*maxHostThroughputSamples; i++ {
+		w.recordUploadThroughput(1, time.Second, now)
+	}
+	if len(w.uploadThroughputSamples) != maxHostThroughputSamples {
+		t.Fatal("wrong number of samples", len(w.uploadThroughputSamples))
+	}
+}
+
+// TestRemoveSlowHosts probes the ranking of hosts by throughput and the
+// removal of slow hosts.
+func TestRemoveSlowHosts(t *testing.T) {
+	// Create 7 hosts with a median throughput of 100. Host 0 is slow, host 1
+	// is slower and host 6 wasn't measured.
+	hostThroughputs := []float64{40, 10, 100, 100, 100, 120, 0}
+	throughputs := make([]modules.HostThroughput, len(hostThroughputs))
+	for i, throughput := range hostThroughputs {
+		throughputs[i] = modules.HostThroughput{
+			PublicKey:  types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)},
+			Throughput: throughput,
+		}
+		if throughput > 0 {
+			throughputs[i].Samples = 1
+		}
+	}
+	unusedHosts := func() map[string]struct{} {
+		hosts := make(map[string]struct{})
+		for _, ht := range throughputs {
+			hosts[ht.PublicKey.String()] = struct{}{}
+		}
+		return hosts
+	}
+	isUnused := func(hosts map[string]struct{}, i int) bool {
+		_, unused := hosts[throughputs[i].PublicKey.String()]
+		return unused
+	}
+
+	// Only the measured hosts below half the median are slow, slowest first.
+	ranking := newHostThroughputRanking(throughputs)
+	if len(ranking.slowHosts) != 2 || ranking.slowHosts[0] != throughputs[1].PublicKey.String() || ranking.slowHosts[1] != throughputs[0].PublicKey.String() {
+		t.Fatal("wrong slow hosts", ranking.slowHosts)
+	}
+
+	// With a single missing piece, both slow hosts are removed.
+	hosts := unusedHosts()
+	ranking.removeSlowHosts(hosts, 1)
+	if len(hosts) != 5 || isUnused(hosts, 0) || isUnused(hosts, 1) || !isUnused(hosts, 6) {
+		t.Fatal("slow hosts weren't removed", len(hosts))
+	}
+
+	// With 3 missing pieces only the slowest host is removed to keep enough
+	// hosts for diversity.
+	hosts = unusedHosts()
+	ranking.removeSlowHosts(hosts, 3)
+	if len(hosts) != 6 || isUnused(hosts, 1) || !isUnused(hosts, 0) {
+		t.Fatal("wrong hosts removed", len(hosts))
+	}
+
+	// With 4 missing pieces, no host is removed.
+	hosts = unusedHosts()
+	ranking.removeSlowHosts(hosts, 4)
+	if len(hosts) != len(throughputs) {
+		t.Fatal("hosts were removed", len(hosts))
+	}
+
+	// Without a ranking no hosts are removed.
+	var noRanking *hostThroughputRanking
+	noRanking.removeSlowHosts(hosts, 1)
+	if len(hosts) != len(throughputs) {
+		t.Fatal("hosts were removed", len(hosts))
+	}
+}
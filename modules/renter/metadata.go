@@ -1,26 +1,39 @@
 package renter
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siadir"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // bubbleStatus indicates the status of a bubble being executed on a
 // directory
 type bubbleStatus int
 
+// bubbleLastRun contains the time at which the last bubble of a directory
+// completed and the modification time of the directory it was based on.
+type bubbleLastRun struct {
+	modTime time.Time
+	time    time.Time
+}
+
 // bubbleError, bubbleInit, bubbleActive, and bubblePending are the constants
 // used to determine the status of a bubble being executed on a directory
 const (
@@ -41,6 +54,7 @@ func (r *Renter) managedPrepareBubble(siaPath modules.SiaPath) bool {
 	status, ok := r.bubbleUpdates[siaPathStr]
 	if !ok {
 		r.bubbleUpdates[siaPathStr] = bubbleActive
+		r.bubbleStartTimes[siaPathStr] = time.Now()
 		return true
 	}
 	if status != bubbleActive && status != bubblePending {
@@ -52,29 +66,46 @@ func (r *Renter) managedPrepareBubble(siaPath modules.SiaPath) bool {
 
 // managedCalculateDirectoryMetadata calculates the new values for the
 // directory's metadata and tracks the value, either worst or best, for each to
-// be bubbled up
-func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (siadir.Metadata, error) {
+// be bubbled up. The calculation is aborted if ctx is canceled.
+func (r *Renter) managedCalculateDirectoryMetadata(ctx context.Context, siaPath modules.SiaPath) (siadir.Metadata, error) {
 	// Set default metadata values to start
 	metadata := siadir.Metadata{
-		AggregateHealth:              siadir.DefaultDirHealth,
-		AggregateLastHealthCheckTime: time.Now(),
-		AggregateMinRedundancy:       math.MaxFloat64,
-		AggregateModTime:             time.Time{},
-		AggregateNumFiles:            uint64(0),
-		AggregateNumStuckChunks:      uint64(0),
-		AggregateNumSubDirs:          uint64(0),
-		AggregateSize:                uint64(0),
-		AggregateStuckHealth:         siadir.DefaultDirHealth,
-
-		Health:              siadir.DefaultDirHealth,
-		LastHealthCheckTime: time.Now(),
-		MinRedundancy:       math.MaxFloat64,
-		ModTime:             time.Time{},
-		NumFiles:            uint64(0),
-		NumStuckChunks:      uint64(0),
-		NumSubDirs:          uint64(0),
-		Size:                uint64(0),
-		StuckHealth:         siadir.DefaultDirHealth,
+		AggregateHealth:               siadir.DefaultDirHealth,
+		AggregateHostSketch:           siadir.NewHostSketch(),
+		AggregateLastHealthCheckTime:  time.Time{},
+		AggregateMinRedundancy:        math.MaxFloat64,
+		AggregateModTime:              time.Time{},
+		AggregateNumFiles:             uint64(0),
+		AggregateNumFilesMissingLocal: uint64(0),
+		AggregateNumFilesScrubFailed:  uint64(0),
+		AggregateNumOrphanedFiles:     uint64(0),
+		AggregateNumStuckChunks:       uint64(0),
+		AggregateNumSubDirs:           uint64(0),
+		AggregateNumTaggedFiles:       uint64(0),
+		AggregateNumUniqueHosts:       uint64(0),
+		AggregateNumUnfinishedFiles:   uint64(0),
+		AggregateRepairHealth:         siadir.DefaultDirHealth,
+		AggregateRepairSize:           uint64(0),
+		AggregateSize:                 uint64(0),
+		AggregateStuckHealth:          siadir.DefaultDirHealth,
+
+		Health:               siadir.DefaultDirHealth,
+		LastHealthCheckTime:  time.Time{},
+		MinRedundancy:        math.MaxFloat64,
+		ModTime:              time.Time{},
+		NumFiles:             uint64(0),
+		NumFilesMissingLocal: uint64(0),
+		NumFilesScrubFailed:  uint64(0),
+		NumOrphanedFiles:     uint64(0),
+		NumStuckChunks:       uint64(0),
+		NumSubDirs:           uint64(0),
+		NumTaggedFiles:       uint64(0),
+		NumUniqueHosts:       uint64(0),
+		NumUnfinishedFiles:   uint64(0),
+		RepairHealth:         siadir.DefaultDirHealth,
+		RepairSize:           uint64(0),
+		Size:                 uint64(0),
+		StuckHealth:          siadir.DefaultDirHealth,
 	}
 	// Read directory
 	fileinfos, err := r.staticFileSystem.ReadDir(siaPath)
@@ -83,17 +114,32 @@ func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (sia
 		return siadir.Metadata{}, err
 	}
 
+	// The hosts of the siafiles within the directory. The hosts of the sub
+	// directories are merged into metadata.AggregateHostSketch.
+	hostSketch := siadir.NewHostSketch()
+
+	// Calculate the metadata of the siafiles within the directory in parallel.
+	fileMetadatas := r.managedCalculateFileMetadatas(ctx, siaPath, fileinfos)
+
+	// Track whether any siafiles or children were found. The
+	// LastHealthCheckTimes start out as zero and are set by the first file or
+	// child respectively.
+	var foundFile, foundChild bool
+
 	// Iterate over directory
 	for _, fi := range fileinfos {
-		// Check to make sure renter hasn't been shutdown
+		// Check to make sure renter hasn't been shutdown and the bubble wasn't
+		// canceled
 		select {
 		case <-r.tg.StopChan():
 			return siadir.Metadata{}, err
+		case <-ctx.Done():
+			return siadir.Metadata{}, ctx.Err()
 		default:
 		}
 
 		// Aggregate Fields
-		var aggregateHealth, aggregateStuckHealth, aggregateMinRedundancy float64
+		var aggregateHealth, aggregateRepairHealth, aggregateStuckHealth, aggregateMinRedundancy float64
 		var aggregateLastHealthCheckTime, aggregateModTime time.Time
 		var fileMetadata siafile.BubbledMetadata
 		ext := filepath.Ext(fi.Name())
@@ -106,9 +152,10 @@ func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (sia
 				r.log.Println("unable to join siapath with dirpath while calculating directory metadata:", err)
 				continue
 			}
-			fileMetadata, err = r.managedCalculateAndUpdateFileMetadata(fileSiaPath)
-			if err != nil {
-				r.log.Printf("failed to calculate file metadata %v: %v", fi.Name(), err)
+			var exists bool
+			fileMetadata, exists = fileMetadatas[fi.Name()]
+			if !exists {
+				// The error was already logged.
 				continue
 			}
 
@@ -122,8 +169,19 @@ func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (sia
 				r.staticAlerter.UnregisterAlert(modules.AlertIDSiafileLowRedundancy(uid))
 			}
 
+			// If the file didn't reach its target redundancy before its
+			// upload deadline, register an alert for the file.
+			if missedUploadDeadline(fileMetadata, time.Now()) {
+				r.staticAlerter.RegisterAlert(modules.AlertIDSiafileUploadDeadline(uid), AlertMSGSiafileUploadDeadline,
+					AlertCauseSiafileUploadDeadline(fileSiaPath, fileMetadata.UploadDeadline, fileMetadata.Redundancy, fileMetadata.TargetRedundancy),
+					modules.SeverityWarning)
+			} else {
+				r.staticAlerter.UnregisterAlert(modules.AlertIDSiafileUploadDeadline(uid))
+			}
+
 			// Record Values that compare against sub directories
 			aggregateHealth = fileMetadata.Health
+			aggregateRepairHealth = repairHealth(fileMetadata)
 			aggregateStuckHealth = fileMetadata.StuckHealth
 			aggregateMinRedundancy = fileMetadata.Redundancy
 			aggregateLastHealthCheckTime = fileMetadata.LastHealthCheckTime
@@ -132,13 +190,16 @@ func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (sia
 			// Update aggregate fields.
 			metadata.AggregateNumFiles++
 			metadata.AggregateNumStuckChunks += fileMetadata.NumStuckChunks
+			metadata.AggregateRepairSize += fileMetadata.RepairSize
 			metadata.AggregateSize += fileMetadata.Size
 
 			// Update siadir fields.
 			metadata.Health = math.Max(metadata.Health, fileMetadata.Health)
-			if fileMetadata.LastHealthCheckTime.Before(metadata.LastHealthCheckTime) {
+			metadata.RepairHealth = math.Max(metadata.RepairHealth, repairHealth(fileMetadata))
+			if !foundFile || fileMetadata.LastHealthCheckTime.Before(metadata.LastHealthCheckTime) {
 				metadata.LastHealthCheckTime = fileMetadata.LastHealthCheckTime
 			}
+			foundFile = true
 			if fileMetadata.Redundancy != -1 {
 				metadata.MinRedundancy = math.Min(metadata.MinRedundancy, fileMetadata.Redundancy)
 			}
@@ -146,7 +207,28 @@ func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (sia
 				metadata.ModTime = fileMetadata.ModTime
 			}
 			metadata.NumFiles++
+			for _, host := range fileMetadata.Hosts {
+				hostSketch.Add(host)
+				metadata.AggregateHostSketch.Add(host)
+			}
+			if fileMetadata.LocalFileMissing {
+				metadata.AggregateNumFilesMissingLocal++
+				metadata.NumFilesMissingLocal++
+			}
+			if fileMetadata.Tagged {
+				metadata.AggregateNumTaggedFiles++
+				metadata.NumTaggedFiles++
+			}
+			if fileMetadata.ScrubFailed {
+				metadata.AggregateNumFilesScrubFailed++
+				metadata.NumFilesScrubFailed++
+			}
 			metadata.NumStuckChunks += fileMetadata.NumStuckChunks
+			if fileMetadata.Redundancy != -1 && fileMetadata.Redundancy < 1 {
+				metadata.AggregateNumUnfinishedFiles++
+				metadata.NumUnfinishedFiles++
+			}
+			metadata.RepairSize += fileMetadata.RepairSize
 			metadata.Size += fileMetadata.Size
 			metadata.StuckHealth = math.Max(metadata.StuckHealth, fileMetadata.StuckHealth)
 		} else if fi.IsDir() {
@@ -160,8 +242,17 @@ func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (sia
 				return siadir.Metadata{}, err
 			}
 
+			// The trash only counts towards the size. Its health is
+			// ignored since trashed files are not repaired.
+			if isTrashPath(dirSiaPath) {
+				metadata.AggregateSize += dirMetadata.AggregateSize
+				metadata.NumSubDirs++
+				continue
+			}
+
 			// Record Values that compare against files
 			aggregateHealth = dirMetadata.AggregateHealth
+			aggregateRepairHealth = dirMetadata.AggregateRepairHealth
 			aggregateStuckHealth = dirMetadata.AggregateStuckHealth
 			aggregateMinRedundancy = dirMetadata.AggregateMinRedundancy
 			aggregateLastHealthCheckTime = dirMetadata.AggregateLastHealthCheckTime
@@ -169,40 +260,82 @@ func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (sia
 
 			// Update aggregate fields.
 			metadata.AggregateNumFiles += dirMetadata.AggregateNumFiles
+			metadata.AggregateNumFilesMissingLocal += dirMetadata.AggregateNumFilesMissingLocal
+			metadata.AggregateNumOrphanedFiles += dirMetadata.AggregateNumOrphanedFiles
+			metadata.AggregateNumTaggedFiles += dirMetadata.AggregateNumTaggedFiles
+			metadata.AggregateNumFilesScrubFailed += dirMetadata.AggregateNumFilesScrubFailed
+			metadata.AggregateHostSketch.Merge(dirMetadata.AggregateHostSketch)
 			metadata.AggregateNumStuckChunks += dirMetadata.AggregateNumStuckChunks
 			metadata.AggregateNumSubDirs += dirMetadata.AggregateNumSubDirs
+			metadata.AggregateNumUnfinishedFiles += dirMetadata.AggregateNumUnfinishedFiles
+			metadata.AggregateRepairSize += dirMetadata.AggregateRepairSize
 			metadata.AggregateSize += dirMetadata.AggregateSize
 
 			// Update siadir fields
 			metadata.NumSubDirs++
 		} else {
-			// Ignore everything that is not a SiaFile or a directory
+			// Everything that is not a SiaFile or a directory is either
+			// another file created by the renter or an orphaned file. Orphaned
+			// files are removed if their extension is configured to be
+			// cleaned up and reported otherwise.
+			if r.managedHandleOrphanedFile(siaPath, fi.Name()) {
+				metadata.AggregateNumOrphanedFiles++
+				metadata.NumOrphanedFiles++
+			}
 			continue
 		}
-		// Track the max value of AggregateHealth and Aggregate StuckHealth
+		// Track the max value of AggregateHealth, AggregateRepairHealth and
+		// AggregateStuckHealth
 		metadata.AggregateHealth = math.Max(metadata.AggregateHealth, aggregateHealth)
+		metadata.AggregateRepairHealth = math.Max(metadata.AggregateRepairHealth, aggregateRepairHealth)
 		metadata.AggregateStuckHealth = math.Max(metadata.AggregateStuckHealth, aggregateStuckHealth)
 		// Track the min value for AggregateMinRedundancy
 		if aggregateMinRedundancy != -1 {
 			metadata.AggregateMinRedundancy = math.Min(metadata.AggregateMinRedundancy, aggregateMinRedundancy)
 		}
 		// Update LastHealthCheckTime
-		if aggregateLastHealthCheckTime.Before(metadata.AggregateLastHealthCheckTime) {
+		if !foundChild || aggregateLastHealthCheckTime.Before(metadata.AggregateLastHealthCheckTime) {
 			metadata.AggregateLastHealthCheckTime = aggregateLastHealthCheckTime
 		}
+		foundChild = true
 		// Update ModTime
 		if aggregateModTime.After(metadata.AggregateModTime) {
 			metadata.AggregateModTime = aggregateModTime
 		}
 	}
-	// Sanity check on ModTime. If mod time is still zero it means there were no
-	// files or subdirectories. Set ModTime to now since we just updated this
-	// directory
-	if metadata.AggregateModTime.IsZero() {
-		metadata.AggregateModTime = time.Now()
+	// Sanity check on LastHealthCheckTime. Without any files or children
+	// there is nothing that could be stale, so the directory counts as checked
+	// just now.
+	if !foundChild {
+		metadata.AggregateLastHealthCheckTime = time.Now()
 	}
-	if metadata.ModTime.IsZero() {
-		metadata.ModTime = time.Now()
+	if !foundFile {
+		metadata.LastHealthCheckTime = time.Now()
+	}
+	// Sanity check on ModTime. If mod time is still zero it means there were no
+	// files or subdirectories. Keep the previous ModTime of the directory in
+	// that case to avoid the ModTime of empty directories changing with every
+	// bubble. The ModTime of a new directory is its creation time. If the
+	// directory contained files or subdirectories before, they were removed
+	// since and the ModTime is the time of that change.
+	if metadata.AggregateModTime.IsZero() || metadata.ModTime.IsZero() {
+		prevModTime, prevAggregateModTime := time.Now(), time.Now()
+		if md, err := r.managedLoadDirMetadata(siaPath); err == nil {
+			if !md.ModTime.IsZero() && md.NumFiles == 0 {
+				prevModTime = md.ModTime
+			}
+			if !md.AggregateModTime.IsZero() && md.AggregateNumFiles == 0 && md.NumSubDirs == 0 {
+				prevAggregateModTime = md.AggregateModTime
+			}
+		} else {
+			r.log.Printf("WARN: unable to load previous metadata of %v: %v", siaPath, err)
+		}
+		if metadata.AggregateModTime.IsZero() {
+			metadata.AggregateModTime = prevAggregateModTime
+		}
+		if metadata.ModTime.IsZero() {
+			metadata.ModTime = prevModTime
+		}
 	}
 	// Sanity check on Redundancy. If MinRedundancy is still math.MaxFloat64
 	// then set it to -1 to indicate an empty directory
@@ -212,14 +345,221 @@ func (r *Renter) managedCalculateDirectoryMetadata(siaPath modules.SiaPath) (sia
 	if metadata.MinRedundancy == math.MaxFloat64 {
 		metadata.MinRedundancy = -1
 	}
+	// Estimate the number of unique hosts.
+	metadata.AggregateNumUniqueHosts = metadata.AggregateHostSketch.Count()
+	metadata.NumUniqueHosts = hostSketch.Count()
 
 	return metadata, nil
 }
 
+// missedUploadDeadline returns whether a file has an upload deadline which
+// passed before the file reached its target redundancy.
+func missedUploadDeadline(md siafile.BubbledMetadata, now time.Time) bool {
+	if md.UploadDeadline.IsZero() || now.Before(md.UploadDeadline) {
+		return false
+	}
+	return md.Redundancy < md.TargetRedundancy
+}
+
+// repairHealth returns the health of a file as seen by the repair loop. It is
+// only used to decide which directories need repair, the reported health of
+// the file is left untouched. Pieces on hosts with a poor uptime count
+// fractionally and the health of a cold file is ignored until it reaches
+// ColdRepairThreshold. A file approaching its upload deadline which is missing
+// any redundancy is treated like a file at the minimum redundancy to get its
+// directory repaired before directories with recoverable files.
+func repairHealth(md siafile.BubbledMetadata) float64 {
+	health := effectiveHealth(md.Health, md.EffectiveRedundancy, md.TargetRedundancy)
+	if health > 0 && approachingUploadDeadline(md.UploadDeadline, time.Now()) {
+		return math.Max(health, 1)
+	}
+	if md.Cold && health < ColdRepairThreshold {
+		return 0
+	}
+	return health
+}
+
+// effectiveHealth returns the health of a file or chunk once its redundancy is
+// weighted by the uptime of its hosts. It is never better than health. A
+// health of 0 means that no pieces are missing, in which case there is nothing
+// to repair and health is returned as is.
+func effectiveHealth(health, effectiveRedundancy, targetRedundancy float64) float64 {
+	if health <= 0 || effectiveRedundancy < 0 || targetRedundancy <= 1 {
+		return health
+	}
+	return math.Max(health, 1-(effectiveRedundancy-1)/(targetRedundancy-1))
+}
+
+// managedCalculateFileMetadatas calculates and updates the metadata of all the
+// siafiles in fileinfos using up to managedBubbleFileWorkers threads. The returned
+// map maps the names of the siafiles to their metadata. Siafiles which
+// returned an error are not part of the map. The workers stop early if ctx is
+// canceled.
+func (r *Renter) managedCalculateFileMetadatas(ctx context.Context, siaPath modules.SiaPath, fileinfos []os.FileInfo) map[string]siafile.BubbledMetadata {
+	// Queue up the siafiles.
+	fileNames := make(chan string, len(fileinfos))
+	for _, fi := range fileinfos {
+		if filepath.Ext(fi.Name()) == modules.SiaFileExtension {
+			fileNames <- fi.Name()
+		}
+	}
+	close(fileNames)
+
+	// Build the contract and utility maps once for the whole directory instead
+	// of once per file.
+	offline, goodForRenew, uptime, contracts := r.managedFileMetadataMaps()
+
+	// Launch the workers.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	fileMetadatas := make(map[string]siafile.BubbledMetadata)
+	worker := func() {
+		defer wg.Done()
+		for fileName := range fileNames {
+			// Check to make sure renter hasn't been shutdown and the bubble
+			// wasn't canceled
+			select {
+			case <-r.tg.StopChan():
+				return
+			case <-ctx.Done():
+				return
+			default:
+			}
+			fName := strings.TrimSuffix(fileName, modules.SiaFileExtension)
+			fileSiaPath, err := siaPath.Join(fName)
+			if err != nil {
+				r.log.Println("unable to join siapath with dirpath while calculating directory metadata:", err)
+				continue
+			}
+			fileMetadata, err := r.managedCalculateAndUpdateFileMetadata(fileSiaPath, offline, goodForRenew, uptime, contracts)
+			if err != nil {
+				r.log.Printf("failed to calculate file metadata %v: %v", fileName, err)
+				continue
+			}
+			mu.Lock()
+			fileMetadatas[fileName] = fileMetadata
+			mu.Unlock()
+		}
+	}
+	numWorkers := r.managedBubbleFileWorkers()
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go worker()
+	}
+	wg.Wait()
+	return fileMetadatas
+}
+
+// managedFileMetadataMaps returns the contract and utility maps which are
+// required by managedCalculateAndUpdateFileMetadata.
+func (r *Renter) managedFileMetadataMaps() (offline, goodForRenew map[string]bool, uptime map[string]float64, contracts map[string]modules.RenterContract) {
+	offline, goodForRenew, contracts = r.managedContractUtilityMaps()
+	hostPublicKeys := make([]types.SiaPublicKey, 0, len(contracts))
+	for _, contract := range contracts {
+		hostPublicKeys = append(hostPublicKeys, contract.HostPublicKey)
+	}
+	uptime = r.managedHostUptimeMap(hostPublicKeys)
+	return
+}
+
+// RefreshFileMetadata recalculates the health metadata of a single file right
+// away instead of waiting for the next bubble. The parent directory of the
+// file is bubbled afterwards to update the directory metadata.
+func (r *Renter) RefreshFileMetadata(siaPath modules.SiaPath) (siafile.BubbledMetadata, error) {
+	if err := r.tg.Add(); err != nil {
+		return siafile.BubbledMetadata{}, err
+	}
+	defer r.tg.Done()
+	offline, goodForRenew, uptime, contracts := r.managedFileMetadataMaps()
+	md, err := r.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts)
+	if err != nil {
+		return siafile.BubbledMetadata{}, errors.AddContext(err, "failed to refresh the file's metadata")
+	}
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		return siafile.BubbledMetadata{}, err
+	}
+	go r.callThreadedBubbleMetadata(dirSiaPath)
+	return md, nil
+}
+
+// SetMetadataWriteRate sets the maximum number of siafile metadata writes per
+// second performed by the health scan. This prevents large scans from
+// saturating the disk. A rate of 0 removes the limit.
+func (r *Renter) SetMetadataWriteRate(writesPerSecond uint64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.MetadataWriteRate = writesPerSecond
+	return r.saveSync()
+}
+
+// SetBubbleFileWorkers sets the number of threads used to calculate the
+// metadata of the siafiles within a directory during a bubble. A value of 0
+// resets it to the default.
+func (r *Renter) SetBubbleFileWorkers(numWorkers uint64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if numWorkers > maxBubbleFileWorkers {
+		return fmt.Errorf("number of bubble file workers can't exceed %v", maxBubbleFileWorkers)
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.BubbleFileWorkers = numWorkers
+	return r.saveSync()
+}
+
+// managedBubbleFileWorkers returns the number of threads used to calculate the
+// metadata of the siafiles within a directory during a bubble.
+func (r *Renter) managedBubbleFileWorkers() int {
+	id := r.mu.RLock()
+	numWorkers := r.persist.BubbleFileWorkers
+	r.mu.RUnlock(id)
+	if numWorkers == 0 {
+		return defaultBubbleFileWorkers
+	}
+	return int(numWorkers)
+}
+
+// managedWaitForMetadataWrite blocks until the health scan is allowed to
+// persist the next siafile metadata according to the configured write rate.
+func (r *Renter) managedWaitForMetadataWrite() error {
+	id := r.mu.RLock()
+	rate := r.persist.MetadataWriteRate
+	r.mu.RUnlock(id)
+	if rate == 0 {
+		return nil
+	}
+
+	// Reserve the next free slot.
+	r.nextMetadataWriteMu.Lock()
+	now := time.Now()
+	if r.nextMetadataWrite.Before(now) {
+		r.nextMetadataWrite = now
+	}
+	wait := r.nextMetadataWrite.Sub(now)
+	r.nextMetadataWrite = r.nextMetadataWrite.Add(time.Second / time.Duration(rate))
+	r.nextMetadataWriteMu.Unlock()
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-r.tg.StopChan():
+		return errors.New("metadata write interrupted by stop call")
+	}
+}
+
 // managedCalculateAndUpdateFileMetadata calculates and returns the necessary
 // metadata information of a siafile that needs to be bubbled. The calculated
-// metadata information is also updated and saved to disk
-func (r *Renter) managedCalculateAndUpdateFileMetadata(siaPath modules.SiaPath) (siafile.BubbledMetadata, error) {
+// metadata information is also updated and saved to disk. The provided maps
+// are expected to be a snapshot of the renter's contracts and their utilities
+// which can be shared between multiple files.
+func (r *Renter) managedCalculateAndUpdateFileMetadata(siaPath modules.SiaPath, hostOfflineMap, hostGoodForRenewMap map[string]bool, uptimeMap map[string]float64, contracts map[string]modules.RenterContract) (siafile.BubbledMetadata, error) {
 	// Load the Siafile.
 	sf, err := r.staticFileSystem.OpenSiaFile(siaPath)
 	if err != nil {
@@ -227,35 +567,271 @@ func (r *Renter) managedCalculateAndUpdateFileMetadata(siaPath modules.SiaPath)
 	}
 	defer sf.Close()
 
-	// Get offline and goodforrenew maps
-	hostOfflineMap, hostGoodForRenewMap, _ := r.managedRenterContractsAndUtilities([]*filesystem.FileNode{sf})
-
-	// Calculate file health
-	health, stuckHealth, _, _, numStuckChunks := sf.Health(hostOfflineMap, hostGoodForRenewMap)
+	// Update the used hosts and the cached expiration of the siafile.
+	hostKeys := sf.HostPublicKeys()
+	if err := sf.UpdateUsedHosts(hostKeys); err != nil {
+		r.log.Debugln("WARN: Could not update used hosts:", err)
+	}
+	r.managedAddToContractIndex(siaPath, hostKeys...)
+	_ = sf.Expiration(contracts)
 
 	// Set the LastHealthCheckTime
 	sf.SetLastHealthCheckTime()
 
-	// Calculate file Redundancy and check if local file is missing and
-	// redundancy is less than one
-	redundancy, _, err := sf.Redundancy(hostOfflineMap, hostGoodForRenewMap)
-	if err != nil {
-		return siafile.BubbledMetadata{}, err
+	// If neither the file nor the utilities of its hosts changed since the
+	// last time the health was calculated, the cached values can be reused.
+	utilityHash := hostUtilityHash(hostKeys, hostOfflineMap, hostGoodForRenewMap, uptimeMap)
+	chm, cached := sf.CachedHealthMetadata(utilityHash)
+	if !cached {
+		chm, err = calculateHealthMetadata(sf, hostOfflineMap, hostGoodForRenewMap, uptimeMap)
+		if err != nil {
+			return siafile.BubbledMetadata{}, err
+		}
+		sf.SetCachedHealthUtilityHash(utilityHash)
+	}
+
+	// Delete the local file if the file is safe without it.
+	r.managedMaybeDeleteSource(siaPath, sf, chm.Redundancy)
+
+	// Check if local file is missing and redundancy is less than one. Files
+	// without a local path never had a local source, so it can't be missing.
+	var localFileMissing bool
+	if localPath := sf.LocalPath(); localPath != "" {
+		_, err = os.Stat(localPath)
+		localFileMissing = os.IsNotExist(err)
 	}
-	if _, err := os.Stat(sf.LocalPath()); os.IsNotExist(err) && redundancy < 1 {
+	if localFileMissing && chm.Redundancy < 1 {
 		r.log.Debugln("File not found on disk and possibly unrecoverable:", sf.LocalPath())
 	}
 
-	return siafile.BubbledMetadata{
-		Health:              health,
+	// The target redundancy is the redundancy of a fully repaired file.
+	ec := sf.ErasureCode()
+	targetRedundancy := float64(ec.NumPieces()) / float64(ec.MinPieces())
+
+	md := siafile.BubbledMetadata{
+		Cold:                sf.Cold(),
+		EffectiveRedundancy: chm.EffectiveRedundancy,
+		Health:              chm.Health,
+		Hosts:               chm.PieceHosts,
 		LastHealthCheckTime: sf.LastHealthCheckTime(),
+		LocalFileMissing:    localFileMissing,
 		ModTime:             sf.ModTime(),
-		NumStuckChunks:      numStuckChunks,
-		Redundancy:          redundancy,
+		NumStuckChunks:      sf.NumStuckChunks(),
+		Redundancy:          chm.Redundancy,
+		RepairSize:          chm.RepairSize,
+		ScrubFailed:         sf.ScrubFailed(),
 		Size:                sf.Size(),
-		StuckHealth:         stuckHealth,
+		StuckHealth:         chm.StuckHealth,
+		Tagged:              len(sf.Tags()) > 0,
+		TargetRedundancy:    targetRedundancy,
 		UID:                 sf.UID(),
-	}, sf.SaveMetadata()
+		UploadDeadline:      sf.UploadDeadline(),
+	}
+
+	// Save the metadata. If the file was deleted in the meantime there is
+	// nothing to report. Any other error means that the metadata can't be
+	// written to disk. In that case the computed metadata is returned anyway
+	// to keep reporting the health of the file.
+	if err := r.managedWaitForMetadataWrite(); err != nil {
+		return siafile.BubbledMetadata{}, err
+	}
+	err = sf.SaveMetadata()
+	if errors.Contains(err, siafile.ErrDeleted) {
+		r.managedRecordDiskWrite(sf.SiaFilePath(), nil)
+		return siafile.BubbledMetadata{}, err
+	}
+	r.managedRecordDiskWrite(sf.SiaFilePath(), err)
+	if err != nil {
+		r.log.Printf("WARN: failed to save the metadata of %v, reporting unpersisted metadata: %v", siaPath, err)
+	}
+	return md, nil
+}
+
+// calculateHealthMetadata calculates the health, redundancy, effective
+// redundancy, repair size and piece hosts of a siafile. This also updates the
+// cached values of the siafile in memory.
+func calculateHealthMetadata(sf *filesystem.FileNode, hostOfflineMap, hostGoodForRenewMap map[string]bool, uptimeMap map[string]float64) (siafile.CachedHealthMetadata, error) {
+	// Calculate file health
+	health, stuckHealth, _, _, _ := sf.Health(hostOfflineMap, hostGoodForRenewMap)
+
+	// Calculate file Redundancy
+	redundancy, _, err := sf.Redundancy(hostOfflineMap, hostGoodForRenewMap)
+	if err != nil {
+		return siafile.CachedHealthMetadata{}, err
+	}
+
+	// Calculate the effective redundancy of the file which weights the pieces
+	// by the uptime of the hosts storing them.
+	effectiveRedundancy, err := sf.EffectiveRedundancy(hostOfflineMap, hostGoodForRenewMap, uptimeMap)
+	if err != nil {
+		return siafile.CachedHealthMetadata{}, err
+	}
+
+	// Calculate the number of bytes that need to be uploaded to restore the
+	// full redundancy of the file.
+	repairSize, err := sf.RepairSize(hostOfflineMap, hostGoodForRenewMap)
+	if err != nil {
+		return siafile.CachedHealthMetadata{}, err
+	}
+
+	// Only the hosts which store pieces of the file count towards the unique
+	// hosts of the directory.
+	pieceHosts, err := sf.PieceHostPublicKeys()
+	if err != nil {
+		return siafile.CachedHealthMetadata{}, err
+	}
+	return siafile.CachedHealthMetadata{
+		EffectiveRedundancy: effectiveRedundancy,
+		Health:              health,
+		PieceHosts:          pieceHosts,
+		Redundancy:          redundancy,
+		RepairSize:          repairSize,
+		StuckHealth:         stuckHealth,
+	}, nil
+}
+
+// hostUtilityHash returns a hash of everything the health of a file stored on
+// the provided hosts depends on besides the file itself.
+func hostUtilityHash(hostKeys []types.SiaPublicKey, hostOfflineMap, hostGoodForRenewMap map[string]bool, uptimeMap map[string]float64) crypto.Hash {
+	h := crypto.NewHash()
+	for _, hostKey := range hostKeys {
+		key := hostKey.String()
+		offline, knownOffline := hostOfflineMap[key]
+		goodForRenew, knownGoodForRenew := hostGoodForRenewMap[key]
+		uptime, knownUptime := uptimeMap[key]
+		h.Write(encoding.MarshalAll(key, offline, knownOffline, goodForRenew, knownGoodForRenew, math.Float64bits(uptime), knownUptime))
+	}
+	var utilityHash crypto.Hash
+	h.Sum(utilityHash[:0])
+	return utilityHash
+}
+
+// managedRecordBubbleResult records the error of a failed bubble of a
+// directory. A successful bubble clears the recorded error. The errors are
+// persisted to be able to tell which directories fail to bubble after a
+// restart. At most maxBubbleErrors errors are kept, dropping the oldest ones.
+func (r *Renter) managedRecordBubbleResult(siaPath modules.SiaPath, err error) {
+	r.bubbleUpdatesMu.Lock()
+	siaPathStr := siaPath.String()
+	_, failed := r.bubbleErrors[siaPathStr]
+	if err == nil && !failed {
+		// Nothing changed.
+		r.bubbleUpdatesMu.Unlock()
+		return
+	}
+	if err == nil {
+		delete(r.bubbleErrors, siaPathStr)
+	} else {
+		bubbleErr := r.bubbleErrors[siaPathStr]
+		bubbleErr.SiaPath = siaPath
+		bubbleErr.Error = err.Error()
+		bubbleErr.Time = time.Now()
+		bubbleErr.NumFailures++
+		r.bubbleErrors[siaPathStr] = bubbleErr
+	}
+	for len(r.bubbleErrors) > maxBubbleErrors {
+		var oldest modules.DirBubbleError
+		for _, bubbleErr := range r.bubbleErrors {
+			if oldest.Time.IsZero() || bubbleErr.Time.Before(oldest.Time) {
+				oldest = bubbleErr
+			}
+		}
+		delete(r.bubbleErrors, oldest.SiaPath.String())
+	}
+	r.bubbleUpdatesMu.Unlock()
+
+	// Persist the errors. The errors are copied while holding the renter's
+	// lock to make sure that the most recent errors are saved last.
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.bubbleUpdatesMu.Lock()
+	r.persist.BubbleErrors = make(map[string]modules.DirBubbleError, len(r.bubbleErrors))
+	for siaPathStr, bubbleErr := range r.bubbleErrors {
+		r.persist.BubbleErrors[siaPathStr] = bubbleErr
+	}
+	r.bubbleUpdatesMu.Unlock()
+	if err := r.saveSync(); err != nil {
+		r.log.Println("WARN: failed to persist bubble errors:", err)
+	}
+}
+
+// LastRootBubbleTime returns the time at which a bubble last successfully
+// updated the metadata of the root directory.
+func (r *Renter) LastRootBubbleTime() time.Time {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	return r.lastRootBubbleTime
+}
+
+// managedUpdateLastRootBubbleTime sets the time of the last successful bubble
+// of the root directory to the current time.
+func (r *Renter) managedUpdateLastRootBubbleTime() {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	r.lastRootBubbleTime = time.Now()
+}
+
+// DiskWriteError returns whether the last attempt of a bubble to persist the
+// metadata of any file or directory failed.
+func (r *Renter) DiskWriteError() bool {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	return len(r.diskWriteErrors) > 0
+}
+
+// managedRecordDiskWrite records the result of an attempt to persist the
+// metadata at path to disk. A successful write only clears a previous failure
+// of the same path.
+func (r *Renter) managedRecordDiskWrite(path string, err error) {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	if err == nil {
+		delete(r.diskWriteErrors, path)
+		return
+	}
+	// Once the limit is reached, the failure is still reported through the
+	// other paths.
+	if len(r.diskWriteErrors) < maxBubbleErrors {
+		r.diskWriteErrors[path] = struct{}{}
+	}
+}
+
+// DirBubbleErrors returns the directories whose last bubble failed, sorted by
+// their siapath. A directory is removed from the list once a bubble succeeds.
+// The list survives restarts and is limited to the maxBubbleErrors most recent
+// errors.
+func (r *Renter) DirBubbleErrors() []modules.DirBubbleError {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	errs := make([]modules.DirBubbleError, 0, len(r.bubbleErrors))
+	for _, bubbleErr := range r.bubbleErrors {
+		errs = append(errs, bubbleErr)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].SiaPath.String() < errs[j].SiaPath.String()
+	})
+	return errs
+}
+
+// BubbleQueueStats returns the number of directories in every state of the
+// bubble queue. A growing number of pending directories indicates that the
+// bubbles can't keep up with the changes to the filesystem.
+func (r *Renter) BubbleQueueStats() modules.BubbleQueueStats {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	stats := modules.BubbleQueueStats{
+		Queued: uint64(len(r.bubbleQueue)),
+	}
+	for _, status := range r.bubbleUpdates {
+		switch status {
+		case bubbleActive:
+			stats.Active++
+		case bubblePending:
+			stats.Pending++
+		}
+	}
+	stats.Delayed = uint64(len(r.bubbleDelayed))
+	return stats
 }
 
 // managedCompleteBubbleUpdate completes the bubble update and updates and/or
@@ -264,16 +840,30 @@ func (r *Renter) managedCalculateAndUpdateFileMetadata(siaPath modules.SiaPath)
 // TODO: bubbleUpdatesMu is in violation of conventions, needs to be moved to
 // its own object to have its own mu.
 func (r *Renter) managedCompleteBubbleUpdate(siaPath modules.SiaPath) {
+	r.managedCompleteBubbleUpdateModTime(siaPath, time.Time{})
+}
+
+// managedCompleteBubbleUpdateModTime completes the bubble update like
+// managedCompleteBubbleUpdate and remembers the modification time of the
+// directory the bubble was based on. A zero modTime means that the next bubble
+// of the directory can't be skipped.
+func (r *Renter) managedCompleteBubbleUpdateModTime(siaPath modules.SiaPath, modTime time.Time) {
 	r.bubbleUpdatesMu.Lock()
 	defer r.bubbleUpdatesMu.Unlock()
 
 	// Check current status
 	siaPathStr := siaPath.String()
 	status, exists := r.bubbleUpdates[siaPathStr]
+	r.bubbleLastRuns[siaPathStr] = bubbleLastRun{
+		modTime: modTime,
+		time:    time.Now(),
+	}
+	r.pruneBubbleLastRuns()
 
 	// If the status is 'bubbleActive', delete the status and return.
 	if status == bubbleActive {
 		delete(r.bubbleUpdates, siaPathStr)
+		delete(r.bubbleStartTimes, siaPathStr)
 		return
 	}
 	// If the status is not 'bubbleActive', and the status is also not
@@ -282,21 +872,18 @@ func (r *Renter) managedCompleteBubbleUpdate(siaPath modules.SiaPath) {
 	if status != bubblePending {
 		build.Critical("invalid bubble status", status, exists)
 		delete(r.bubbleUpdates, siaPathStr) // Attempt to reset the corrupted state.
+		delete(r.bubbleStartTimes, siaPathStr)
 		return
 	}
-	// The status is bubblePending, switch the status to bubbleActive.
-	r.bubbleUpdates[siaPathStr] = bubbleActive
-
-	// Launch a thread to do another bubble on this directory, as there was a
-	// bubble pending waiting for the current bubble to complete.
-	err := r.tg.Add()
-	if err != nil {
-		return
-	}
-	go func() {
-		defer r.tg.Done()
-		r.managedPerformBubbleMetadata(siaPath)
-	}()
+	// The status is bubblePending. Queue another bubble of this directory, as
+	// there was a bubble pending waiting for the current bubble to complete.
+	// The directory might have changed after the modification time was read
+	// so the pending bubble must not be skipped.
+	r.bubbleLastRuns[siaPathStr] = bubbleLastRun{time: time.Now()}
+	delete(r.bubbleUpdates, siaPathStr)
+	delete(r.bubbleStartTimes, siaPathStr)
+	r.queueBubble(siaPath, time.Now())
+	r.signalBubbleWorkers()
 }
 
 // managedDirectoryMetadata reads the directory metadata and returns the bubble
@@ -347,7 +934,7 @@ func (r *Renter) managedDirectoryMetadata(siaPath modules.SiaPath) (siadir.Metad
 // managedUpdateLastHealthCheckTime updates the LastHealthCheckTime and
 // AggregateLastHealthCheckTime fields of the directory metadata by reading all
 // the subdirs of the directory.
-func (r *Renter) managedUpdateLastHealthCheckTime(siaPath modules.SiaPath) error {
+func (r *Renter) managedUpdateLastHealthCheckTime(ctx context.Context, siaPath modules.SiaPath) error {
 	// Open dir and fetch current metadata.
 	entry, err := r.staticFileSystem.OpenSiaDir(siaPath)
 	if err != nil {
@@ -371,10 +958,13 @@ func (r *Renter) managedUpdateLastHealthCheckTime(siaPath modules.SiaPath) error
 
 	// Iterate over directory
 	for _, fi := range fileinfos {
-		// Check to make sure renter hasn't been shutdown
+		// Check to make sure renter hasn't been shutdown and the bubble wasn't
+		// canceled
 		select {
 		case <-r.tg.StopChan():
 			return err
+		case <-ctx.Done():
+			return ctx.Err()
 		default:
 		}
 		// Check for SiaFiles and Directories
@@ -402,26 +992,195 @@ func (r *Renter) managedUpdateLastHealthCheckTime(siaPath modules.SiaPath) error
 	return entry.UpdateMetadata(metadata)
 }
 
-// callThreadedBubbleMetadata is the thread safe method used to call
-// managedBubbleMetadata when the call does not need to be blocking
+// callThreadedBubbleMetadata is the thread safe method used to bubble a
+// directory when the call does not need to be blocking. The directory is
+// added to the bubble queue which is processed by the bubble workers.
 func (r *Renter) callThreadedBubbleMetadata(siaPath modules.SiaPath) {
 	if err := r.tg.Add(); err != nil {
 		return
 	}
 	defer r.tg.Done()
-	if err := r.managedBubbleMetadata(siaPath); err != nil {
-		r.log.Debugln("WARN: error with bubbling metadata:", err)
+
+	// Debounce the bubble if the directory was bubbled recently.
+	delay, scheduled := r.managedDebounceBubble(siaPath)
+	if scheduled {
+		return
+	}
+	if delay > 0 {
+		select {
+		case <-r.tg.StopChan():
+			return
+		case <-time.After(delay):
+		}
+		r.bubbleUpdatesMu.Lock()
+		delete(r.bubbleDelayed, siaPath.String())
+		r.bubbleUpdatesMu.Unlock()
+	}
+	r.managedQueueBubble(siaPath)
+}
+
+// bubbleBackoff returns the amount of time an asynchronous bubble of a
+// directory is delayed after numFailures consecutive failed bubbles.
+func bubbleBackoff(numFailures uint64) time.Duration {
+	if numFailures == 0 {
+		return 0
+	}
+	backoff := bubbleBackoffBase
+	for i := uint64(1); i < numFailures && backoff < bubbleBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > bubbleBackoffMax {
+		backoff = bubbleBackoffMax
+	}
+	return backoff
+}
+
+// managedDebounceBubble checks whether an asynchronous bubble of a directory
+// needs to be delayed. If the directory was bubbled within the last
+// bubbleDebounceInterval, or if its last bubble failed within the backoff
+// returned by bubbleBackoff, the remaining time is returned and the bubble is
+// marked as delayed. If a delayed bubble is already scheduled for the
+// directory, 'true' is returned and the caller doesn't need to bubble at all
+// since the scheduled bubble will pick up the changes.
+func (r *Renter) managedDebounceBubble(siaPath modules.SiaPath) (time.Duration, bool) {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	siaPathStr := siaPath.String()
+	if _, delayed := r.bubbleDelayed[siaPathStr]; delayed {
+		return 0, true
+	}
+	var delay time.Duration
+	if lastRun, exists := r.bubbleLastRuns[siaPathStr]; exists {
+		sinceLastRun := time.Since(lastRun.time)
+		if sinceLastRun < bubbleDebounceInterval {
+			delay = bubbleDebounceInterval - sinceLastRun
+		}
+		// A bubble requested right after the last one completed might be
+		// caused by a change which happened before the modification time
+		// was read. Such a bubble must not be skipped.
+		if sinceLastRun < bubbleModTimeResolution {
+			lastRun.modTime = time.Time{}
+			r.bubbleLastRuns[siaPathStr] = lastRun
+		}
+	}
+	// Back off from directories which keep failing to bubble. The backoff is
+	// reset by the next successful bubble which clears the bubble error.
+	if bubbleErr, failed := r.bubbleErrors[siaPathStr]; failed {
+		backoff := bubbleBackoff(bubbleErr.NumFailures) - time.Since(bubbleErr.Time)
+		if backoff > delay {
+			delay = backoff
+		}
+	}
+	if delay <= 0 {
+		return 0, false
+	}
+	r.bubbleDelayed[siaPathStr] = struct{}{}
+	return delay, false
+}
+
+// pruneBubbleLastRuns removes the last runs of directories which haven't been
+// bubbled for bubbleLastRunRetention. The map is swept at most once per
+// bubbleLastRunRetention to keep the cost of completing a bubble low.
+func (r *Renter) pruneBubbleLastRuns() {
+	if time.Since(r.bubbleLastRunsPruned) < bubbleLastRunRetention {
+		return
+	}
+	for siaPathStr, lastRun := range r.bubbleLastRuns {
+		if time.Since(lastRun.time) >= bubbleLastRunRetention {
+			delete(r.bubbleLastRuns, siaPathStr)
+		}
+	}
+	r.bubbleLastRunsPruned = time.Now()
+}
+
+// managedDirModTime returns the most recent modification time of a directory,
+// the entries within it and the metadata files of its subdirectories. Every
+// change to a file or subdirectory which is relevant for the directory's
+// metadata results in a more recent modification time.
+func (r *Renter) managedDirModTime(siaPath modules.SiaPath) (time.Time, error) {
+	fi, err := r.staticFileSystem.Stat(siaPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	modTime := fi.ModTime()
+	fileinfos, err := r.staticFileSystem.ReadDir(siaPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, fi := range fileinfos {
+		// The directory's own metadata is written by its bubbles.
+		if fi.Name() == modules.SiaDirExtension {
+			continue
+		}
+		if fi.IsDir() {
+			dirSiaPath, err := siaPath.Join(fi.Name())
+			if err != nil {
+				return time.Time{}, err
+			}
+			mdPath := filepath.Join(r.staticFileSystem.DirPath(dirSiaPath), modules.SiaDirExtension)
+			if fi, err = os.Stat(mdPath); err != nil && !os.IsNotExist(err) {
+				return time.Time{}, err
+			} else if err != nil {
+				continue
+			}
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+// managedBubbleUnchanged returns 'true' if the directory hasn't been modified
+// since its last successful bubble. Modification times which are too recent to
+// be told apart from a following modification are never considered unchanged.
+func (r *Renter) managedBubbleUnchanged(siaPath modules.SiaPath) bool {
+	r.bubbleUpdatesMu.Lock()
+	lastRun, exists := r.bubbleLastRuns[siaPath.String()]
+	r.bubbleUpdatesMu.Unlock()
+	if !exists || lastRun.modTime.IsZero() || time.Since(lastRun.modTime) < bubbleModTimeResolution {
+		return false
+	}
+	modTime, err := r.managedDirModTime(siaPath)
+	return err == nil && modTime.Equal(lastRun.modTime)
+}
+
+// managedForgetBubbleRun makes sure that the next bubble of the directory is
+// not skipped. This is necessary for changes which affect the metadata of a
+// directory without modifying it on disk, e.g. changes to contracts.
+func (r *Renter) managedForgetBubbleRun(siaPath modules.SiaPath) {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	if lastRun, exists := r.bubbleLastRuns[siaPath.String()]; exists {
+		lastRun.modTime = time.Time{}
+		r.bubbleLastRuns[siaPath.String()] = lastRun
 	}
 }
 
 // managedPerformBubbleMetadata will bubble the metadata without checking the
-// bubble preparation.
-func (r *Renter) managedPerformBubbleMetadata(siaPath modules.SiaPath) (err error) {
+// bubble preparation. If ctx is canceled before the metadata was calculated,
+// the directory's metadata is left untouched.
+func (r *Renter) managedPerformBubbleMetadata(ctx context.Context, siaPath modules.SiaPath) (err error) {
 	// Make sure we call callThreadedBubbleMetadata on the parent once we are
 	// done.
 	defer func() error {
-		// Complete bubble
-		r.managedCompleteBubbleUpdate(siaPath)
+		// A canceled bubble didn't fail. It is completed without recording
+		// a result and without bubbling the parent.
+		if errors.Contains(err, context.Canceled) {
+			r.managedCompleteBubbleUpdate(siaPath)
+			return nil
+		}
+
+		// Remember whether the bubble failed and complete it. The
+		// modification time of the directory is only remembered for
+		// successful bubbles. It is read after the bubble since the bubble
+		// itself updates the metadata of the files within the directory.
+		r.managedRecordBubbleResult(siaPath, err)
+		var modTime time.Time
+		if err == nil {
+			modTime, _ = r.managedDirModTime(siaPath)
+		}
+		r.managedCompleteBubbleUpdateModTime(siaPath, modTime)
 
 		// Continue with parent dir if we aren't in the root dir already.
 		if siaPath.IsRoot() {
@@ -436,7 +1195,7 @@ func (r *Renter) managedPerformBubbleMetadata(siaPath modules.SiaPath) (err erro
 	}()
 
 	// Calculate the new metadata values of the directory
-	metadata, err := r.managedCalculateDirectoryMetadata(siaPath)
+	metadata, err := r.managedCalculateDirectoryMetadata(ctx, siaPath)
 	if err != nil {
 		e := fmt.Sprintf("could not calculate the metadata of directory %v", siaPath.String())
 		return errors.AddContext(err, e)
@@ -450,10 +1209,14 @@ func (r *Renter) managedPerformBubbleMetadata(siaPath modules.SiaPath) (err erro
 		err = errors.AddContext(err, e)
 	} else {
 		defer siaDir.Close()
+		oldMetadata, metadataErr := siaDir.Metadata()
 		err = siaDir.UpdateMetadata(metadata)
+		r.managedRecordDiskWrite(r.staticFileSystem.DirPath(siaPath), err)
 		if err != nil {
 			e := fmt.Sprintf("could not update the metadata of the directory %v", siaPath.String())
 			err = errors.AddContext(err, e)
+		} else if metadataErr == nil {
+			r.managedNotifyHealthChange(siaPath, oldMetadata.AggregateHealth, metadata.AggregateHealth)
 		}
 	}
 
@@ -461,19 +1224,17 @@ func (r *Renter) managedPerformBubbleMetadata(siaPath modules.SiaPath) (err erro
 	// need of repair or and stuck chunks and trigger the appropriate repair
 	// loop. This is only done at the root directory as the repair and stuck
 	// loops start at the root directory so there is no point triggering them
-	// until the root directory is updated
+	// until the root directory is updated. The signals are throttled to avoid
+	// waking up the loops continuously.
 	if siaPath.IsRoot() {
-		if metadata.AggregateHealth >= RepairThreshold {
-			select {
-			case r.uploadHeap.repairNeeded <- struct{}{}:
-			default:
-			}
+		if err == nil {
+			r.managedUpdateLastRootBubbleTime()
+		}
+		if metadata.AggregateRepairHealth >= r.managedRepairThreshold() {
+			r.uploadHeap.managedSignalRepairNeeded()
 		}
 		if metadata.AggregateNumStuckChunks > 0 {
-			select {
-			case r.uploadHeap.stuckChunkFound <- struct{}{}:
-			default:
-			}
+			r.uploadHeap.managedSignalStuckChunkFound()
 		}
 	}
 	return err
@@ -481,14 +1242,15 @@ func (r *Renter) managedPerformBubbleMetadata(siaPath modules.SiaPath) (err erro
 
 // managedBubbleMetadata calculates the updated values of a directory's metadata
 // and updates the siadir metadata on disk then calls callThreadedBubbleMetadata
-// on the parent directory so that it is only blocking for the current directory
-func (r *Renter) managedBubbleMetadata(siaPath modules.SiaPath) error {
+// on the parent directory so that it is only blocking for the current directory.
+// The bubble can be canceled through ctx without shutting down the renter.
+func (r *Renter) managedBubbleMetadata(ctx context.Context, siaPath modules.SiaPath) error {
 	// Check if bubble is needed
 	proceedWithBubble := r.managedPrepareBubble(siaPath)
 	if !proceedWithBubble {
 		// Update the AggregateLastHealthCheckTime even if we weren't able to
 		// bubble right away.
-		return r.managedUpdateLastHealthCheckTime(siaPath)
+		return r.managedUpdateLastHealthCheckTime(ctx, siaPath)
 	}
-	return r.managedPerformBubbleMetadata(siaPath)
+	return r.managedPerformBubbleMetadata(ctx, siaPath)
 }
@@ -0,0 +1,259 @@
+package renter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// metadataExportVersion is the version of the format written by
+	// ExportMetadata.
+	metadataExportVersion = "1.1"
+
+	// metadataExportVersionNoCompression is the version of the format before
+	// the compression of files was exported. It can still be imported.
+	metadataExportVersionNoCompression = "1.0"
+)
+
+var (
+	// errPartialChunkExport is returned by ExportMetadata if a file stores its
+	// last chunk in a combined chunk which can't be exported.
+	errPartialChunkExport = errors.New("can't export files with partial chunks")
+)
+
+type (
+	// metadataExportHeader is the header of a metadata export. It is followed
+	// by one exportedFile per file.
+	metadataExportHeader struct {
+		Version  string `json:"version"`
+		NumFiles uint64 `json:"numfiles"`
+	}
+
+	// exportedFile contains everything that is required to recreate a file
+	// from its pieces on the hosts.
+	exportedFile struct {
+		SiaPath    modules.SiaPath   `json:"siapath"`
+		FileSize   uint64            `json:"filesize"`
+		Mode       os.FileMode       `json:"mode"`
+		LocalPath  string            `json:"localpath"`
+		CipherType crypto.CipherType `json:"ciphertype"`
+		MasterKey  []byte            `json:"masterkey"`
+
+		// Compression is the codec the file was compressed with before
+		// uploading it and LogicalSize the size of the file before
+		// compression. FileSize is the size of the compressed data.
+		Compression modules.CompressionCodec `json:"compression"`
+		LogicalSize uint64                   `json:"logicalsize"`
+
+		ErasureCodeType modules.ErasureCoderType `json:"erasurecodetype"`
+		DataPieces      int                      `json:"datapieces"`
+		ParityPieces    int                      `json:"paritypieces"`
+
+		// Chunks contains the pieces of every chunk grouped by their piece
+		// index.
+		Chunks [][][]exportedPiece `json:"chunks"`
+	}
+
+	// exportedPiece is a piece of a chunk stored on a host.
+	exportedPiece struct {
+		HostPublicKey types.SiaPublicKey `json:"hostpublickey"`
+		MerkleRoot    crypto.Hash        `json:"merkleroot"`
+	}
+)
+
+// ExportMetadata writes the metadata of every file of the renter to w. The
+// export contains the erasure coding settings, the encryption keys and the
+// pieces stored on hosts, which is enough to recreate the files with
+// ImportMetadata. It doesn't contain the file data itself and doesn't include
+// the files in the trash. Files which store
+// their last chunk in a combined chunk and files which are deleted during the
+// export are skipped and returned.
+func (r *Renter) ExportMetadata(w io.Writer) ([]modules.SiaPath, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	fileInfos, _, err := r.staticFileSystem.CachedList(modules.RootSiaPath(), true)
+	if err != nil {
+		return nil, errors.AddContext(err, "unable to list files")
+	}
+	// Export the files first since the header needs to contain the number of
+	// exported files.
+	var skipped []modules.SiaPath
+	efs := make([]exportedFile, 0, len(fileInfos))
+	for _, fi := range filterTrash(fileInfos) {
+		ef, err := r.managedExportFile(fi.SiaPath)
+		if errors.Contains(err, errPartialChunkExport) || errors.Contains(err, filesystem.ErrNotExist) || errors.Contains(err, siafile.ErrDeleted) {
+			r.log.Debugf("skipping export of %v: %v", fi.SiaPath, err)
+			skipped = append(skipped, fi.SiaPath)
+			continue
+		}
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("unable to export %v", fi.SiaPath))
+		}
+		efs = append(efs, ef)
+	}
+	enc := json.NewEncoder(w)
+	err = enc.Encode(metadataExportHeader{
+		Version:  metadataExportVersion,
+		NumFiles: uint64(len(efs)),
+	})
+	if err != nil {
+		return nil, errors.AddContext(err, "unable to write export header")
+	}
+	for _, ef := range efs {
+		if err := enc.Encode(ef); err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("unable to write %v", ef.SiaPath))
+		}
+	}
+	return skipped, nil
+}
+
+// ImportMetadata recreates the files of an export created with ExportMetadata.
+// Files which already exist are skipped.
+func (r *Renter) ImportMetadata(rd io.Reader) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	dec := json.NewDecoder(rd)
+	var header metadataExportHeader
+	if err := dec.Decode(&header); err != nil {
+		return errors.AddContext(err, "unable to read export header")
+	}
+	if header.Version != metadataExportVersion && header.Version != metadataExportVersionNoCompression {
+		return fmt.Errorf("unknown export version %v", header.Version)
+	}
+	dirs := make(map[string]modules.SiaPath)
+	for i := uint64(0); i < header.NumFiles; i++ {
+		var ef exportedFile
+		if err := dec.Decode(&ef); err != nil {
+			return errors.AddContext(err, "unable to read exported file")
+		}
+		imported, err := r.managedImportFile(ef)
+		if err != nil {
+			return errors.AddContext(err, fmt.Sprintf("unable to import %v", ef.SiaPath))
+		}
+		if !imported {
+			continue
+		}
+		dir, err := ef.SiaPath.Dir()
+		if err != nil {
+			return err
+		}
+		dirs[dir.String()] = dir
+	}
+	// Update the metadata of the directories of the imported files.
+	for _, dir := range dirs {
+		go r.callThreadedBubbleMetadata(dir)
+	}
+	return nil
+}
+
+// managedExportFile creates the exportedFile for the file at siaPath.
+func (r *Renter) managedExportFile(siaPath modules.SiaPath) (exportedFile, error) {
+	node, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return exportedFile{}, err
+	}
+	defer node.Close()
+	snap, err := node.Snapshot(siaPath)
+	if err != nil {
+		return exportedFile{}, err
+	}
+	if len(snap.PartialChunks()) > 0 {
+		return exportedFile{}, errPartialChunkExport
+	}
+	ec := snap.ErasureCode()
+	mk := snap.MasterKey()
+	ef := exportedFile{
+		SiaPath:         siaPath,
+		FileSize:        snap.Size(),
+		Mode:            snap.Mode(),
+		LocalPath:       snap.LocalPath(),
+		CipherType:      mk.Type(),
+		MasterKey:       mk.Key(),
+		Compression:     snap.Compression(),
+		LogicalSize:     node.LogicalSize(),
+		ErasureCodeType: ec.Type(),
+		DataPieces:      ec.MinPieces(),
+		ParityPieces:    ec.NumPieces() - ec.MinPieces(),
+		Chunks:          make([][][]exportedPiece, snap.NumChunks()),
+	}
+	for chunkIndex := range ef.Chunks {
+		pieceSet := snap.Pieces(uint64(chunkIndex))
+		ef.Chunks[chunkIndex] = make([][]exportedPiece, len(pieceSet))
+		for pieceIndex, pieces := range pieceSet {
+			for _, piece := range pieces {
+				ef.Chunks[chunkIndex][pieceIndex] = append(ef.Chunks[chunkIndex][pieceIndex], exportedPiece{
+					HostPublicKey: piece.HostPubKey,
+					MerkleRoot:    piece.MerkleRoot,
+				})
+			}
+		}
+	}
+	return ef, nil
+}
+
+// managedImportFile recreates an exported file. The returned bool indicates
+// whether the file was created or skipped because it already exists. If the
+// file can't be recreated completely, it is deleted again.
+func (r *Renter) managedImportFile(ef exportedFile) (_ bool, err error) {
+	exists, err := r.staticFileSystem.FileExists(ef.SiaPath)
+	if err != nil {
+		return false, errors.AddContext(err, "unable to check for existing file")
+	}
+	if exists {
+		return false, nil
+	}
+	ec, err := siafile.NewErasureCoder(ef.ErasureCodeType, ef.DataPieces, ef.ParityPieces)
+	if err != nil {
+		return false, errors.AddContext(err, "unable to create erasure coder")
+	}
+	mk, err := crypto.NewSiaKey(ef.CipherType, ef.MasterKey)
+	if err != nil {
+		return false, errors.AddContext(err, "unable to create master key")
+	}
+	if ef.Compression == modules.CompressionNone {
+		err = r.staticFileSystem.NewSiaFile(ef.SiaPath, ef.LocalPath, ec, mk, ef.FileSize, ef.Mode, true)
+	} else {
+		err = r.staticFileSystem.NewCompressedSiaFile(ef.SiaPath, ef.LocalPath, ec, mk, ef.FileSize, ef.LogicalSize, ef.Compression, ef.Mode, true)
+	}
+	if err != nil {
+		return false, errors.AddContext(err, "unable to create siafile")
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Compose(err, r.staticFileSystem.DeleteFile(ef.SiaPath))
+		}
+	}()
+	node, err := r.staticFileSystem.OpenSiaFile(ef.SiaPath)
+	if err != nil {
+		return false, err
+	}
+	defer node.Close()
+	if uint64(len(ef.Chunks)) != node.NumChunks() {
+		return false, fmt.Errorf("export contains %v chunks but file has %v", len(ef.Chunks), node.NumChunks())
+	}
+	for chunkIndex, pieceSet := range ef.Chunks {
+		for pieceIndex, pieces := range pieceSet {
+			for _, piece := range pieces {
+				err := node.AddPiece(piece.HostPublicKey, uint64(chunkIndex), uint64(pieceIndex), piece.MerkleRoot)
+				if err != nil {
+					return false, errors.AddContext(err, "unable to add piece")
+				}
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,196 @@
+package renter
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestExportImportMetadata tests that files exported with ExportMetadata can be
+// recreated by ImportMetadata on another renter.
+func TestExportImportMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt2, err := newRenterTesterWithDependency(t.Name()+"2", &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt2.Close()
+
+	// Create a file with a few pieces.
+	siaPath, err := modules.NewSiaPath("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSSubCode(2, 3, crypto.SegmentSize)
+	fileSize := 3 * modules.SectorSize * uint64(rsc.MinPieces())
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), fileSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	for chunkIndex := uint64(0); chunkIndex < node.NumChunks(); chunkIndex++ {
+		for pieceIndex := uint64(0); pieceIndex < uint64(rsc.NumPieces()); pieceIndex++ {
+			hpk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)}
+			if err := node.AddPiece(hpk, chunkIndex, pieceIndex, crypto.HashBytes(fastrand.Bytes(16))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Export the metadata and import it into the second renter.
+	var buf bytes.Buffer
+	skipped, err := rt.renter.ExportMetadata(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 0 {
+		t.Fatal("no files should be skipped", skipped)
+	}
+	if err := rt2.renter.ImportMetadata(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	// The imported file should match the original.
+	node2, err := rt2.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node2.Close()
+	if node2.Size() != node.Size() || node2.NumChunks() != node.NumChunks() {
+		t.Fatal("size mismatch", node2.Size(), node.Size())
+	}
+	if !reflect.DeepEqual(node2.MasterKey(), node.MasterKey()) {
+		t.Fatal("master key mismatch")
+	}
+	ec, ec2 := node.ErasureCode(), node2.ErasureCode()
+	if ec2.Type() != ec.Type() || ec2.MinPieces() != ec.MinPieces() || ec2.NumPieces() != ec.NumPieces() {
+		t.Fatal("erasure code mismatch")
+	}
+	for chunkIndex := uint64(0); chunkIndex < node.NumChunks(); chunkIndex++ {
+		pieces, err := node.Pieces(chunkIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pieces2, err := node2.Pieces(chunkIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(pieces, pieces2) {
+			t.Fatal("pieces mismatch for chunk", chunkIndex)
+		}
+	}
+
+	// Importing again should skip the existing file.
+	if err := rt2.renter.ImportMetadata(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExportImportCompressedMetadata tests that the compression of a file
+// survives exporting and importing its metadata.
+func TestExportImportCompressedMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt2, err := newRenterTesterWithDependency(t.Name()+"2", &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt2.Close()
+
+	// Create a compressed file.
+	siaPath := modules.RandomSiaPath()
+	rsc, _ := siafile.NewRSCode(1, 1)
+	fileSize, logicalSize := modules.SectorSize, 3*modules.SectorSize
+	err = rt.renter.staticFileSystem.NewCompressedSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), fileSize, logicalSize, modules.CompressionGzip, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Export the metadata and import it into the second renter.
+	var buf bytes.Buffer
+	if _, err := rt.renter.ExportMetadata(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt2.renter.ImportMetadata(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	// The imported file should still be compressed.
+	node, err := rt2.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	if node.Compression() != modules.CompressionGzip {
+		t.Fatal("wrong compression", node.Compression())
+	}
+	if node.Size() != fileSize || node.LogicalSize() != logicalSize {
+		t.Fatal("size mismatch", node.Size(), node.LogicalSize())
+	}
+}
+
+// TestImportFileCleanup tests that a file which can't be imported completely
+// is deleted again.
+func TestImportFileCleanup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Import a file with too few chunks.
+	mk := crypto.GenerateSiaKey(crypto.TypeDefaultRenter)
+	rsc, _ := siafile.NewRSCode(1, 1)
+	ef := exportedFile{
+		SiaPath:         modules.RandomSiaPath(),
+		FileSize:        modules.SectorSize,
+		Mode:            persist.DefaultDiskPermissionsTest,
+		CipherType:      mk.Type(),
+		MasterKey:       mk.Key(),
+		ErasureCodeType: rsc.Type(),
+		DataPieces:      1,
+		ParityPieces:    1,
+	}
+	if _, err := rt.renter.managedImportFile(ef); err == nil {
+		t.Fatal("import should fail")
+	}
+	exists, err := rt.renter.staticFileSystem.FileExists(ef.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("partially imported file wasn't deleted")
+	}
+}
@@ -0,0 +1,123 @@
+package renter
+
+// operations.go provides a unified view of the work the renter is currently
+// performing. It only reads the state that is already tracked by the various
+// subsystems, which makes it cheap enough to be polled frequently.
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+)
+
+// ListInProgressOperations returns all the operations the renter is currently
+// working on, sorted from the oldest to the most recent one.
+func (r *Renter) ListInProgressOperations() []modules.RenterOperation {
+	var ops []modules.RenterOperation
+	ops = append(ops, r.managedBubbleOperations()...)
+	ops = append(ops, r.managedDownloadOperations()...)
+	ops = append(ops, r.managedUploadOperations()...)
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].StartTime.Before(ops[j].StartTime)
+	})
+	return ops
+}
+
+// managedBubbleOperations returns an operation for every bubble that is
+// currently active.
+func (r *Renter) managedBubbleOperations() []modules.RenterOperation {
+	r.bubbleUpdatesMu.Lock()
+	defer r.bubbleUpdatesMu.Unlock()
+	var ops []modules.RenterOperation
+	for siaPathStr, status := range r.bubbleUpdates {
+		if status != bubbleActive && status != bubblePending {
+			continue
+		}
+		ops = append(ops, modules.RenterOperation{
+			Type:      modules.OperationTypeBubble,
+			SiaPath:   modules.SiaPath{Path: siaPathStr},
+			StartTime: r.bubbleStartTimes[siaPathStr],
+			Progress:  -1,
+		})
+	}
+	return ops
+}
+
+// managedDownloadOperations returns an operation for every download in the
+// download history that hasn't completed yet.
+func (r *Renter) managedDownloadOperations() []modules.RenterOperation {
+	r.downloadHistoryMu.Lock()
+	defer r.downloadHistoryMu.Unlock()
+	var ops []modules.RenterOperation
+	for _, d := range r.downloadHistory {
+		if d.staticComplete() {
+			continue
+		}
+		progress := float64(1)
+		if d.staticLength > 0 {
+			progress = float64(atomic.LoadUint64(&d.atomicDataReceived)) / float64(d.staticLength)
+		}
+		ops = append(ops, modules.RenterOperation{
+			Type:      modules.OperationTypeDownload,
+			SiaPath:   d.staticSiaPath,
+			StartTime: d.staticStartTime,
+			Progress:  progress,
+		})
+	}
+	return ops
+}
+
+// managedUploadOperations returns an operation for every file that has chunks
+// in the upload heap or chunks that are currently being repaired. Files that
+// haven't been fully uploaded yet are reported as uploads, all other files as
+// repairs.
+func (r *Renter) managedUploadOperations() []modules.RenterOperation {
+	type fileOperation struct {
+		chunk     *unfinishedUploadChunk
+		completed int
+		needed    int
+		startTime time.Time
+	}
+	files := make(map[siafile.SiafileUID]*fileOperation)
+	for _, uc := range r.uploadHeap.managedChunks() {
+		uc.mu.Lock()
+		completed, needed := uc.piecesCompleted, uc.piecesNeeded
+		uc.mu.Unlock()
+
+		fo, exists := files[uc.id.fileUID]
+		if !exists {
+			fo = &fileOperation{
+				chunk:     uc,
+				startTime: uc.staticCreationTime,
+			}
+			files[uc.id.fileUID] = fo
+		}
+		fo.completed += completed
+		fo.needed += needed
+		if uc.staticCreationTime.Before(fo.startTime) {
+			fo.startTime = uc.staticCreationTime
+		}
+	}
+
+	ops := make([]modules.RenterOperation, 0, len(files))
+	for _, fo := range files {
+		opType := modules.OperationTypeRepair
+		if fo.chunk.fileEntry.Metadata().CachedUploadProgress < 100 {
+			opType = modules.OperationTypeUpload
+		}
+		progress := float64(1)
+		if fo.needed > 0 {
+			progress = float64(fo.completed) / float64(fo.needed)
+		}
+		ops = append(ops, modules.RenterOperation{
+			Type:      opType,
+			SiaPath:   r.staticFileSystem.FileSiaPath(fo.chunk.fileEntry),
+			StartTime: fo.startTime,
+			Progress:  progress,
+		})
+	}
+	return ops
+}
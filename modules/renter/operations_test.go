@@ -0,0 +1,93 @@
+package renter
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestListInProgressOperations tests that uploads and bubbles show up in the
+// list of in progress operations.
+func TestListInProgressOperations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a renter without the repair loop to make sure the upload stays
+	// in the heap.
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Without any work there should be no operations.
+	if ops := rt.renter.ListInProgressOperations(); len(ops) != 0 {
+		t.Fatal("expected no operations but got", ops)
+	}
+
+	// Start an upload. The renter tester doesn't have any workers, so the
+	// chunk is pushed to the heap manually.
+	uploadPath := modules.RandomSiaPath()
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.staticFileSystem.NewSiaFile(uploadPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(uploadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	nilMap := make(map[string]bool)
+	chunk, err := rt.renter.managedBuildUnfinishedChunk(sf, 0, make(map[string]struct{}), make(map[string]types.SiaPublicKey), false, nilMap, nilMap, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rt.renter.uploadHeap.managedPush(chunk) {
+		t.Fatal("chunk wasn't pushed to the heap")
+	}
+
+	// Start a bubble.
+	bubblePath := modules.RandomSiaPath()
+	if !rt.renter.managedPrepareBubble(bubblePath) {
+		t.Fatal("bubble wasn't started")
+	}
+
+	// Both operations should be listed.
+	var foundUpload, foundBubble bool
+	for _, op := range rt.renter.ListInProgressOperations() {
+		if op.Type == modules.OperationTypeUpload && op.SiaPath.Equals(uploadPath) {
+			foundUpload = true
+			if op.Progress != 0 {
+				t.Error("expected upload progress to be 0 but was", op.Progress)
+			}
+		}
+		if op.Type == modules.OperationTypeBubble && op.SiaPath.Equals(bubblePath) {
+			foundBubble = true
+			if op.StartTime.IsZero() {
+				t.Error("start time of bubble wasn't set")
+			}
+		}
+	}
+	if !foundUpload || !foundBubble {
+		t.Fatalf("upload found: %v, bubble found: %v", foundUpload, foundBubble)
+	}
+
+	// Complete the bubble. It should no longer be listed.
+	rt.renter.managedCompleteBubbleUpdate(bubblePath)
+	for _, op := range rt.renter.ListInProgressOperations() {
+		if op.Type == modules.OperationTypeBubble && op.SiaPath.Equals(bubblePath) {
+			t.Fatal("bubble still listed after completion")
+		}
+	}
+}
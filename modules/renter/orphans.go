@@ -0,0 +1,92 @@
+package renter
+
+// orphans.go handles orphaned files. An orphaned file is any file within the
+// renter's filesystem which is neither a directory, a siafile nor any other file
+// created by the renter, e.g. a leftover temporary file or a file copied into the
+// filesystem by the user. Orphaned files are counted in the directory metadata
+// while it is updated. If an orphaned file has one of the extensions set using
+// SetOrphanedFileExtensions it is removed instead.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// ErrInvalidOrphanedFileExtension is returned by SetOrphanedFileExtensions
+	// if an extension doesn't start with a '.', contains a path separator or
+	// belongs to a file created by the renter.
+	ErrInvalidOrphanedFileExtension = errors.New("invalid orphaned file extension")
+)
+
+// renterFileExtensions are the extensions of the files created by the renter
+// within its filesystem which are not orphaned.
+var renterFileExtensions = map[string]struct{}{
+	modules.SiaFileExtension:         {},
+	modules.SiaDirExtension:          {},
+	modules.PartialsSiaFileExtension: {},
+	modules.CombinedChunkExtension:   {},
+	modules.UnfinishedChunkExtension: {},
+	modules.ChunkMetadataExtension:   {},
+}
+
+// isOrphanedFile returns whether the file with the given name is an orphaned
+// file.
+func isOrphanedFile(name string) bool {
+	_, ok := renterFileExtensions[filepath.Ext(name)]
+	return !ok
+}
+
+// SetOrphanedFileExtensions sets the extensions of orphaned files which are
+// removed when the directory metadata is updated. Passing an empty slice
+// disables the removal of orphaned files.
+func (r *Renter) SetOrphanedFileExtensions(extensions []string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	for _, ext := range extensions {
+		if len(ext) < 2 || !strings.HasPrefix(ext, ".") || strings.ContainsAny(ext[1:], "./\\") {
+			return errors.AddContext(ErrInvalidOrphanedFileExtension, ext)
+		}
+		if !isOrphanedFile(ext) {
+			return errors.AddContext(ErrInvalidOrphanedFileExtension, ext+" is used by the renter")
+		}
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.OrphanedFileExtensions = append([]string(nil), extensions...)
+	return r.saveSync()
+}
+
+// managedHandleOrphanedFile checks whether the file with the given name in the
+// directory at siaPath is orphaned and removes it if its extension was set
+// using SetOrphanedFileExtensions. It returns true if the file is orphaned and
+// was not removed.
+func (r *Renter) managedHandleOrphanedFile(siaPath modules.SiaPath, name string) bool {
+	if !isOrphanedFile(name) {
+		return false
+	}
+	id := r.mu.RLock()
+	extensions := r.persist.OrphanedFileExtensions
+	r.mu.RUnlock(id)
+	ext := filepath.Ext(name)
+	for _, e := range extensions {
+		if e != ext {
+			continue
+		}
+		path := filepath.Join(r.staticFileSystem.DirPath(siaPath), name)
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			r.log.Println("WARN: failed to remove orphaned file", path, err)
+			return true
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package renter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestOrphanedFiles verifies that orphaned files are reported in the directory
+// metadata and removed if their extension was set using
+// SetOrphanedFileExtensions.
+func TestOrphanedFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create test renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a directory and place a couple of orphaned files in the root
+	// directory and the new directory.
+	subDir, err := modules.NewSiaPath("SubDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir(subDir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	rootDir := rt.renter.staticFileSystem.DirPath(modules.RootSiaPath())
+	orphans := []string{
+		filepath.Join(rootDir, "orphan.tmp"),
+		filepath.Join(rootDir, "orphan.bak"),
+		filepath.Join(rt.renter.staticFileSystem.DirPath(subDir), "orphan.tmp"),
+	}
+	for _, orphan := range orphans {
+		if err := ioutil.WriteFile(orphan, []byte("orphan"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// checkOrphans bubbles the metadata and checks the number of orphaned
+	// files in the root directory.
+	checkOrphans := func(num, aggregate uint64) error {
+		rt.renter.managedBubbleMetadata(context.Background(), subDir)
+		return build.Retry(100, 100*time.Millisecond, func() error {
+			dirInfo, err := rt.renter.staticFileSystem.DirInfo(modules.RootSiaPath())
+			if err != nil {
+				return err
+			}
+			if dirInfo.NumOrphanedFiles != num {
+				return fmt.Errorf("NumOrphanedFiles incorrect, got %v expected %v", dirInfo.NumOrphanedFiles, num)
+			}
+			if dirInfo.AggregateNumOrphanedFiles != aggregate {
+				return fmt.Errorf("AggregateNumOrphanedFiles incorrect, got %v expected %v", dirInfo.AggregateNumOrphanedFiles, aggregate)
+			}
+			return nil
+		})
+	}
+	if err := checkOrphans(2, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid extensions and the extensions of renter files should be
+	// rejected.
+	for _, ext := range []string{"", ".", "tmp", ".a/b", modules.SiaFileExtension, modules.SiaDirExtension} {
+		err := rt.renter.SetOrphanedFileExtensions([]string{ext})
+		if !errors.Contains(err, ErrInvalidOrphanedFileExtension) {
+			t.Fatalf("expected %v for extension %q but got %v", ErrInvalidOrphanedFileExtension, ext, err)
+		}
+	}
+
+	// Remove the .tmp files. Only the .bak file should be left.
+	if err := rt.renter.SetOrphanedFileExtensions([]string{".tmp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOrphans(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	for i, orphan := range orphans {
+		_, err := os.Stat(orphan)
+		if filepath.Ext(orphan) == ".tmp" && !os.IsNotExist(err) {
+			t.Fatalf("orphan %v should have been removed: %v", i, err)
+		} else if filepath.Ext(orphan) != ".tmp" && err != nil {
+			t.Fatalf("orphan %v shouldn't have been removed: %v", i, err)
+		}
+	}
+}
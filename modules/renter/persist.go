@@ -3,6 +3,7 @@ package renter
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/writeaheadlog"
@@ -61,6 +62,83 @@ type (
 		MaxUploadSpeed   int64
 		UploadedBackups  []modules.UploadedBackup
 		SyncedContracts  []types.FileContractID
+
+		// DefaultDataPieces and DefaultParityPieces are the erasure coding
+		// settings used for uploads that don't specify an erasure code. A
+		// value of 0 means the renter's built-in defaults are used.
+		DefaultDataPieces   int
+		DefaultParityPieces int
+
+		// ChunkDeduplication indicates whether new uploads reuse already
+		// uploaded chunks with the same content.
+		ChunkDeduplication bool
+
+		// RepairThreshold is the health at which the renter starts repairing
+		// a file. A value of 0 means the renter's built-in default is used.
+		RepairThreshold float64
+
+		// OrphanedFileExtensions are the extensions of orphaned files which
+		// are removed by the renter when it updates the directory metadata.
+		OrphanedFileExtensions []string
+
+		// VerificationSampleRate is the probability with which a file is
+		// verified after it was repaired.
+		VerificationSampleRate float64
+
+		// MetadataWriteRate is the maximum number of siafile metadata writes
+		// per second performed by the health scan. A value of 0 means that
+		// the writes are not limited.
+		MetadataWriteRate uint64
+
+		// BubbleFileWorkers is the number of threads used to calculate the
+		// metadata of the siafiles within a directory during a bubble. A
+		// value of 0 means that defaultBubbleFileWorkers is used.
+		BubbleFileWorkers uint64
+
+		// ActiveUploads contains the siapaths of the files which are
+		// currently being uploaded. Their chunks are requeued on startup.
+		ActiveUploads map[string]struct{}
+
+		// TrashRetention is the duration a deleted file is kept in the trash
+		// before it is permanently removed. A value of 0 disables the trash.
+		TrashRetention time.Duration
+
+		// RepairBandwidthLimit is the maximum number of bytes uploaded by
+		// repairs per repairBandwidthInterval. A value of 0 means that
+		// repairs are not limited.
+		RepairBandwidthLimit uint64
+
+		// FilesDir is the location of the renter's filesystem if it was
+		// relocated. An empty string means the filesystem is located in the
+		// persist dir.
+		FilesDir string
+
+		// RepairsPaused indicates whether the repairs were paused using
+		// PauseRepairs.
+		RepairsPaused bool
+
+		// RepairSignalThrottleInterval is the minimum amount of time between
+		// two signals sent to the repair or stuck loop by bubbles of the root
+		// directory. A value of 0 means that
+		// defaultRepairSignalThrottleInterval is used.
+		RepairSignalThrottleInterval time.Duration
+
+		// SafeRedundancy is the redundancy a file needs to reach before its
+		// local source is considered safe to delete. A value of 0 means that
+		// defaultSafeRedundancy is used.
+		SafeRedundancy float64
+
+		// AutoDeleteSources indicates whether local sources are deleted by
+		// the health loop once their file reached the safe redundancy.
+		AutoDeleteSources bool
+
+		// UploadRetryPolicy is the policy used to retry failed piece
+		// uploads.
+		UploadRetryPolicy modules.UploadRetryPolicy
+
+		// BubbleErrors contains the errors of the directories whose last
+		// bubble failed.
+		BubbleErrors map[string]modules.DirBubbleError
 	}
 )
 
@@ -109,6 +187,13 @@ func (r *Renter) managedLoadSettings() error {
 		return err
 	}
 
+	// Restore the bubble errors.
+	r.bubbleUpdatesMu.Lock()
+	for siaPathStr, bubbleErr := range r.persist.BubbleErrors {
+		r.bubbleErrors[siaPathStr] = bubbleErr
+	}
+	r.bubbleUpdatesMu.Unlock()
+
 	// Set the bandwidth limits on the contractor, which was already initialized
 	// without bandwidth limits.
 	return r.setBandwidthLimits(r.persist.MaxDownloadSpeed, r.persist.MaxUploadSpeed)
@@ -124,7 +209,7 @@ func (r *Renter) managedInitPersist() error {
 	// The directory is needed before the staticDirSet can be initialized
 	// because the wal needs the directory to be created and the staticDirSet
 	// needs the wal.
-	fsRoot := filepath.Join(r.persistDir, modules.FileSystemRoot)
+	fsRoot := loadFilesDir(r.persistDir)
 	err := os.MkdirAll(fsRoot, 0700)
 	if err != nil {
 		return err
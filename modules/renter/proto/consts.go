@@ -89,4 +89,8 @@ var (
 	// ErrBadHostVersion indicates that the host is using an older, incompatible
 	// version of the renter-host protocol.
 	ErrBadHostVersion = errors.New("Bad host version; host does not support required protocols")
+
+	// ErrBadSectorData indicates that the data of a downloaded sector doesn't
+	// match the requested Merkle root.
+	ErrBadSectorData = errors.New("host sent bad sector data")
 )
@@ -87,13 +87,14 @@ func (cs *ContractSet) IDs() []types.FileContractID {
 	return pks
 }
 
-// InsertContract inserts an existing contract into the set.
-func (cs *ContractSet) InsertContract(rc modules.RecoverableContract, revTxn types.Transaction, roots []crypto.Hash, sk crypto.SecretKey) (modules.RenterContract, error) {
+// InsertContract inserts an existing contract into the set. downloadSpending
+// is the amount that was spent on downloading the contract from the host.
+func (cs *ContractSet) InsertContract(rc modules.RecoverableContract, revTxn types.Transaction, roots []crypto.Hash, sk crypto.SecretKey, downloadSpending types.Currency) (modules.RenterContract, error) {
 	return cs.managedInsertContract(contractHeader{
 		Transaction:      revTxn,
 		SecretKey:        sk,
 		StartHeight:      rc.StartHeight,
-		DownloadSpending: types.NewCurrency64(1), // TODO set this
+		DownloadSpending: downloadSpending,
 		StorageSpending:  types.NewCurrency64(1), // TODO set this
 		UploadSpending:   types.NewCurrency64(1), // TODO set this
 		TotalCost:        types.NewCurrency64(1), // TODO set this
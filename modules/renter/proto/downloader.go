@@ -133,7 +133,7 @@ func (hd *Downloader) Download(root crypto.Hash, offset, length uint32) (_ modul
 	if uint64(len(sector)) != modules.SectorSize {
 		return modules.RenterContract{}, nil, errors.New("host did not send enough sector data")
 	} else if crypto.MerkleRoot(sector) != root {
-		return modules.RenterContract{}, nil, errors.New("host sent bad sector data")
+		return modules.RenterContract{}, nil, ErrBadSectorData
 	}
 
 	// update contract and metrics
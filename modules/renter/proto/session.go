@@ -9,6 +9,7 @@ import (
 	"net"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gitlab.com/NebulousLabs/errors"
@@ -37,6 +38,38 @@ type Session struct {
 	once        sync.Once
 }
 
+// countingConn is a net.Conn which counts the bytes read from and written to
+// the underlying connection.
+type countingConn struct {
+	net.Conn
+	atomicBytesRead    uint64
+	atomicBytesWritten uint64
+}
+
+// Read implements io.Reader.
+func (cc *countingConn) Read(b []byte) (int, error) {
+	n, err := cc.Conn.Read(b)
+	atomic.AddUint64(&cc.atomicBytesRead, uint64(n))
+	return n, err
+}
+
+// Write implements io.Writer.
+func (cc *countingConn) Write(b []byte) (int, error) {
+	n, err := cc.Conn.Write(b)
+	atomic.AddUint64(&cc.atomicBytesWritten, uint64(n))
+	return n, err
+}
+
+// BandwidthUsed returns the number of bytes read from and written to the host
+// over the course of the session.
+func (s *Session) BandwidthUsed() (read, written uint64) {
+	cc, ok := s.conn.(*countingConn)
+	if !ok {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&cc.atomicBytesRead), atomic.LoadUint64(&cc.atomicBytesWritten)
+}
+
 // writeRequest sends an encrypted RPC request to the host.
 func (s *Session) writeRequest(rpcID types.Specifier, req interface{}) error {
 	return modules.WriteRPCRequest(s.conn, s.aead, rpcID, req)
@@ -850,6 +883,8 @@ func (cs *ContractSet) managedNewSession(host modules.HostDBEntry, currentHeight
 		return nil, errors.AddContext(err, "unsuccessful dial when creating a new session")
 	}
 	conn := ratelimit.NewRLConn(c, cs.rl, cancel)
+	// Count the bandwidth used by the session.
+	conn = &countingConn{Conn: conn}
 
 	closeChan := make(chan struct{})
 	go func() {
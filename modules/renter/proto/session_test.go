@@ -1,6 +1,8 @@
 package proto
 
 import (
+	"io"
+	"net"
 	"reflect"
 	"testing"
 
@@ -248,3 +250,28 @@ func TestModifyLeafHashes(t *testing.T) {
 		})
 	}
 }
+
+// TestSessionBandwidthUsed tests that a session reports the bytes read from
+// and written to its connection.
+func TestSessionBandwidthUsed(t *testing.T) {
+	rConn, hConn := net.Pipe()
+	defer rConn.Close()
+	defer hConn.Close()
+	s := &Session{conn: &countingConn{Conn: rConn}}
+
+	// Write 10 bytes and read 5 bytes.
+	go func() {
+		buf := make([]byte, 10)
+		io.ReadFull(hConn, buf)
+		hConn.Write(buf[:5])
+	}()
+	if _, err := s.conn.Write(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(s.conn, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if read, written := s.BandwidthUsed(); read != 5 || written != 10 {
+		t.Fatalf("expected 5 bytes read and 10 written but got %v and %v", read, written)
+	}
+}
@@ -0,0 +1,110 @@
+package renter
+
+// reconciletracking.go implements a consistency check between the renter's
+// records of the files it tracks and the siafiles on disk. The siafiles are
+// the authoritative record of the tracked files. Next to them the renter
+// persists the set of active uploads and keeps the contract index in memory.
+// Both are keyed by siapath and can reference files which no longer exist,
+// e.g. if the renter crashed between deleting a file and updating the records.
+
+import (
+	"sort"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// ReconcileTracking compares the persisted active uploads and the contract
+// index with the siafiles on disk and returns the entries without a siafile.
+func (r *Renter) ReconcileTracking() ([]modules.Discrepancy, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	return r.managedReconcileTracking(false)
+}
+
+// HealTracking reconciles the tracking records like ReconcileTracking and
+// drops the entries without a siafile.
+func (r *Renter) HealTracking() ([]modules.Discrepancy, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	return r.managedReconcileTracking(true)
+}
+
+// managedReconcileTracking returns the tracking entries without a siafile. If
+// heal is set, the entries are dropped.
+func (r *Renter) managedReconcileTracking(heal bool) ([]modules.Discrepancy, error) {
+	var discrepancies []modules.Discrepancy
+
+	// Check the active uploads.
+	var healedActiveUploads bool
+	for _, sp := range r.managedActiveUploads() {
+		siaPath, err := modules.NewSiaPath(sp)
+		if err == nil {
+			exists, err := r.staticFileSystem.FileExists(siaPath)
+			if err != nil {
+				return nil, errors.AddContext(err, "failed to check for siafile of active upload")
+			}
+			if exists {
+				continue
+			}
+		} else {
+			siaPath = modules.SiaPath{Path: sp}
+		}
+		discrepancy := modules.Discrepancy{
+			SiaPath:     siaPath,
+			Type:        modules.DiscrepancyActiveUploadWithoutFile,
+			Description: "the file is tracked as an active upload but its siafile doesn't exist",
+		}
+		if heal {
+			r.managedRemoveActiveUpload(sp)
+			discrepancy.Healed = true
+			healedActiveUploads = true
+		}
+		discrepancies = append(discrepancies, discrepancy)
+	}
+	if healedActiveUploads {
+		if err := r.managedPersistActiveUploads(); err != nil {
+			return nil, errors.AddContext(err, "failed to persist the active uploads")
+		}
+	}
+
+	// Check the contract index.
+	r.contractIndexMu.Lock()
+	indexed := make([]modules.SiaPath, 0, len(r.contractIndex))
+	for siaPath := range r.contractIndex {
+		indexed = append(indexed, siaPath)
+	}
+	r.contractIndexMu.Unlock()
+	for _, siaPath := range indexed {
+		exists, err := r.staticFileSystem.FileExists(siaPath)
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to check for siafile of contract index entry")
+		}
+		if exists {
+			continue
+		}
+		discrepancy := modules.Discrepancy{
+			SiaPath:     siaPath,
+			Type:        modules.DiscrepancyContractIndexWithoutFile,
+			Description: "the file is part of the contract index but its siafile doesn't exist",
+		}
+		if heal {
+			r.managedRemoveFromContractIndex(siaPath)
+			discrepancy.Healed = true
+		}
+		discrepancies = append(discrepancies, discrepancy)
+	}
+
+	sort.Slice(discrepancies, func(i, j int) bool {
+		if discrepancies[i].Type != discrepancies[j].Type {
+			return discrepancies[i].Type < discrepancies[j].Type
+		}
+		return discrepancies[i].SiaPath.String() < discrepancies[j].SiaPath.String()
+	})
+	return discrepancies, nil
+}
@@ -0,0 +1,84 @@
+package renter
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestReconcileTracking tests that ReconcileTracking reports the active
+// uploads and contract index entries without a siafile and that HealTracking
+// drops them.
+func TestReconcileTracking(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Track an existing file and a file without a siafile.
+	existing, missing := modules.RandomSiaPath(), modules.RandomSiaPath()
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = r.staticFileSystem.NewSiaFile(existing, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hpk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)}
+	for _, siaPath := range []modules.SiaPath{existing, missing} {
+		r.managedAddActiveUpload(siaPath)
+		r.managedAddToContractIndex(siaPath, hpk)
+	}
+
+	// checkDiscrepancies checks that only the missing file is reported.
+	checkDiscrepancies := func(discrepancies []modules.Discrepancy, healed bool) {
+		t.Helper()
+		if len(discrepancies) != 2 {
+			t.Fatal("expected 2 discrepancies but got", discrepancies)
+		}
+		expected := []modules.DiscrepancyType{modules.DiscrepancyActiveUploadWithoutFile, modules.DiscrepancyContractIndexWithoutFile}
+		for i, d := range discrepancies {
+			if d.Type != expected[i] || !d.SiaPath.Equals(missing) || d.Healed != healed {
+				t.Fatal("wrong discrepancy", d)
+			}
+		}
+	}
+	discrepancies, err := r.ReconcileTracking()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDiscrepancies(discrepancies, false)
+
+	// Heal the tracking records. Only the entries of the missing file should
+	// be dropped.
+	discrepancies, err = r.HealTracking()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDiscrepancies(discrepancies, true)
+	activeUploads := r.managedActiveUploads()
+	if len(activeUploads) != 1 || activeUploads[0] != existing.String() {
+		t.Fatal("wrong active uploads", activeUploads)
+	}
+	if files := r.managedContractIndexFiles(hpk); len(files) != 1 || !files[0].Equals(existing) {
+		t.Fatal("wrong contract index files", files)
+	}
+	discrepancies, err = r.ReconcileTracking()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discrepancies) != 0 {
+		t.Fatal("expected no discrepancies but got", discrepancies)
+	}
+}
@@ -0,0 +1,241 @@
+package renter
+
+// reencode.go implements changing the erasure code of an existing file. The
+// file is downloaded and streamed into a new siafile with the new erasure code
+// next to the original one. Once the new file has reached at least the
+// redundancy of the original one, it atomically replaces the original file. If
+// anything goes wrong before that, the new file is deleted and the original
+// file is left untouched.
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+)
+
+var (
+	// ErrNilErasureCode is returned by ReEncode if no erasure code is
+	// provided.
+	ErrNilErasureCode = errors.New("erasure code can't be nil")
+
+	// ErrReEncodeInsufficientRedundancy is returned by ReEncode if the
+	// re-encoded file didn't reach the redundancy of the original file.
+	ErrReEncodeInsufficientRedundancy = errors.New("re-encoded file didn't reach the redundancy of the original file")
+)
+
+// reEncodeSettings are the settings of the original file which are carried
+// over to the re-encoded file once its upload finished.
+type reEncodeSettings struct {
+	cold         bool
+	deadline     time.Time
+	localModTime time.Time
+	localPath    string
+	mode         os.FileMode
+	priority     int
+	tags         map[string]string
+}
+
+// newReEncodeSettings returns the settings of the file which need to be carried
+// over to its re-encoded version.
+func newReEncodeSettings(entry *filesystem.FileNode) reEncodeSettings {
+	return reEncodeSettings{
+		cold:         entry.Cold(),
+		deadline:     entry.UploadDeadline(),
+		localModTime: entry.LocalModTime(),
+		localPath:    entry.LocalPath(),
+		mode:         entry.Mode(),
+		priority:     entry.UploadPriority(),
+		tags:         entry.Tags(),
+	}
+}
+
+// reEncodeSiaPath returns the SiaPath of a temporary file which is used while
+// re-encoding the file at siaPath.
+func reEncodeSiaPath(siaPath modules.SiaPath, suffix string) (modules.SiaPath, error) {
+	dir, err := siaPath.Dir()
+	if err != nil {
+		return modules.SiaPath{}, err
+	}
+	return dir.Join(fmt.Sprintf("%v.%v", siaPath.Name(), suffix))
+}
+
+// ReEncode changes the erasure code of the file at siaPath to ec. The file is
+// downloaded and uploaded again using the new erasure code. The call blocks
+// until the new file has reached at least the redundancy of the original file.
+func (r *Renter) ReEncode(siaPath modules.SiaPath, ec modules.ErasureCoder) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if ec == nil {
+		return ErrNilErasureCode
+	}
+
+	// Get the settings of the original file.
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return errors.AddContext(err, "failed to open file")
+	}
+	compression := entry.Compression()
+	oldEC := entry.ErasureCode()
+	size := entry.Size()
+	settings := newReEncodeSettings(entry)
+	preferredHosts := entry.PreferredHosts()
+	readOnly := entry.ReadOnly()
+	offline, goodForRenew, _ := r.managedContractUtilityMaps()
+	oldRedundancy, _, err := entry.Redundancy(offline, goodForRenew)
+	entry.Close()
+	if err != nil {
+		return errors.AddContext(err, "failed to get redundancy of file")
+	}
+	if oldEC.Identifier() == ec.Identifier() {
+		return nil // nothing to do
+	}
+	if compression != modules.CompressionNone {
+		return errCompressedReEncode
+	}
+	// Re-encoding replaces the original file which isn't allowed for read-only
+	// files.
+	if readOnly {
+		return ErrFileReadOnly
+	}
+
+	// Stream the data of the original file into the new file. The temporary
+	// file gets a random suffix to avoid colliding with existing files or
+	// with concurrent re-encodes of the same file.
+	newSiaPath, err := reEncodeSiaPath(siaPath, "reencode-"+hex.EncodeToString(fastrand.Bytes(8)))
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.DownloadRange(siaPath, 0, size, pw))
+	}()
+	err = r.managedUploadStreamFromReader(modules.FileUploadParams{
+		SiaPath:        newSiaPath,
+		ErasureCode:    ec,
+		PreferredHosts: preferredHosts,
+	}, pr, false)
+	pr.Close()
+	if err != nil {
+		// If a file already existed at newSiaPath it wasn't created by us and
+		// must not be deleted.
+		if errors.Contains(err, filesystem.ErrExists) {
+			return errors.AddContext(err, "failed to upload re-encoded file")
+		}
+		// Ignore ErrNotExist since the upload might have failed before the
+		// file was created.
+		if deleteErr := r.staticFileSystem.DeleteFile(newSiaPath); deleteErr != nil && !errors.Contains(deleteErr, filesystem.ErrNotExist) {
+			err = errors.Compose(err, deleteErr)
+		}
+		return errors.AddContext(err, "failed to upload re-encoded file")
+	}
+
+	// Wait for the upload to finish and replace the original file.
+	err = r.managedFinishReEncode(siaPath, newSiaPath, size, settings, math.Min(oldRedundancy, float64(ec.NumPieces())/float64(ec.MinPieces())))
+	if err != nil {
+		if deleteErr := r.staticFileSystem.DeleteFile(newSiaPath); deleteErr != nil {
+			err = errors.Compose(err, deleteErr)
+		}
+		return err
+	}
+
+	// The original file was replaced successfully. Update the metadata of the
+	// directory.
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		r.log.Printf("WARN: failed to get the directory of re-encoded file %v: %v", siaPath, err)
+		return nil
+	}
+	go r.callThreadedBubbleMetadata(dirSiaPath)
+	return nil
+}
+
+// managedFinishReEncode waits for the upload of the re-encoded file at
+// newSiaPath to finish. If the file reached the minimum redundancy, it
+// atomically replaces the original file at siaPath.
+func (r *Renter) managedFinishReEncode(siaPath, newSiaPath modules.SiaPath, size uint64, settings reEncodeSettings, minRedundancy float64) error {
+	entry, err := r.staticFileSystem.OpenSiaFile(newSiaPath)
+	if err != nil {
+		return errors.AddContext(err, "failed to open re-encoded file")
+	}
+	defer entry.Close()
+
+	// Wait until none of the file's chunks are being uploaded anymore.
+	for uploading := true; uploading; {
+		uploading = false
+		for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+			if r.uploadHeap.managedExists(uploadChunkID{fileUID: entry.UID(), index: chunkIndex}) {
+				uploading = true
+				break
+			}
+		}
+		if !uploading {
+			break
+		}
+		select {
+		case <-r.tg.StopChan():
+			return errors.New("renter shutdown before re-encoded file was uploaded")
+		case <-time.After(reEncodeCheckInterval):
+		}
+	}
+
+	// Check that the re-encoded file isn't less redundant than the original
+	// file.
+	if size > 0 {
+		offline, goodForRenew, _ := r.managedContractUtilityMaps()
+		redundancy, _, err := entry.Redundancy(offline, goodForRenew)
+		if err != nil {
+			return errors.AddContext(err, "failed to get redundancy of re-encoded file")
+		}
+		if redundancy < minRedundancy {
+			return errors.AddContext(ErrReEncodeInsufficientRedundancy, fmt.Sprintf("%v < %v", redundancy, minRedundancy))
+		}
+	}
+
+	// Carry over the settings of the original file.
+	if err := entry.SetLocalPath(settings.localPath); err != nil {
+		return errors.AddContext(err, "failed to set local path of re-encoded file")
+	}
+	if err := entry.SetLocalModTime(settings.localModTime); err != nil {
+		return errors.AddContext(err, "failed to set local modification time of re-encoded file")
+	}
+	if err := entry.SetUploadPriority(settings.priority); err != nil {
+		return errors.AddContext(err, "failed to set upload priority of re-encoded file")
+	}
+	if err := entry.SetUploadDeadline(settings.deadline); err != nil {
+		return errors.AddContext(err, "failed to set upload deadline of re-encoded file")
+	}
+	if err := entry.SetCold(settings.cold); err != nil {
+		return errors.AddContext(err, "failed to set cold status of re-encoded file")
+	}
+	if err := entry.SetMode(settings.mode); err != nil {
+		return errors.AddContext(err, "failed to set mode of re-encoded file")
+	}
+	if err := entry.SetTags(settings.tags); err != nil {
+		return errors.AddContext(err, "failed to set tags of re-encoded file")
+	}
+
+	// Replace the original file. The upload progress of the original file
+	// is removed since it was deleted.
+	original, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return errors.AddContext(err, "failed to open original file")
+	}
+	originalUID := original.UID()
+	original.Close()
+	if err := r.staticFileSystem.ReplaceFile(siaPath, newSiaPath); err != nil {
+		return errors.AddContext(err, "failed to replace original file")
+	}
+	r.managedRemoveUploadProgress(originalUID)
+	return nil
+}
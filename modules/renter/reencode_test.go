@@ -0,0 +1,185 @@
+package renter
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestReEncode tests the input validation of ReEncode and that a failed
+// re-encode leaves the original file untouched.
+func TestReEncode(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file.
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A nil erasure code is not allowed.
+	if err := rt.renter.ReEncode(siaPath, nil); !errors.Contains(err, ErrNilErasureCode) {
+		t.Fatal("expected ErrNilErasureCode but got", err)
+	}
+	// The file needs to exist.
+	if err := rt.renter.ReEncode(modules.RandomSiaPath(), ec); !errors.Contains(err, filesystem.ErrNotExist) {
+		t.Fatal("expected ErrNotExist but got", err)
+	}
+	// Re-encoding with the same erasure code is a no-op.
+	if err := rt.renter.ReEncode(siaPath, ec); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create an unrelated file at the path of the old fixed temporary file.
+	// It must survive a failed re-encode.
+	existingSiaPath, err := reEncodeSiaPath(siaPath, "reencode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.staticFileSystem.NewSiaFile(existingSiaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without any workers the upload of the re-encoded file fails.
+	newEC, err := siafile.NewRSCode(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.ReEncode(siaPath, newEC); err == nil {
+		t.Fatal("re-encode should fail without workers")
+	}
+
+	// The original file should be untouched and the re-encoded file should be
+	// gone.
+	entry, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if entry.ErasureCode().Identifier() != ec.Identifier() {
+		t.Fatal("erasure code of original file changed")
+	}
+	if exists, _ := rt.renter.staticFileSystem.FileExists(existingSiaPath); !exists {
+		t.Fatal("unrelated file was deleted")
+	}
+	dir, err := siaPath.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fis, err := rt.renter.FileList(dir, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 2 {
+		t.Fatal("re-encoded file wasn't deleted", len(fis))
+	}
+}
+
+// TestFinishReEncodeSettings tests that the settings of the original file
+// survive replacing it with the re-encoded file.
+func TestFinishReEncodeSettings(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create the original file and its re-encoded version.
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	newSiaPath, err := reEncodeSiaPath(siaPath, "reencode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sp := range []modules.SiaPath{siaPath, newSiaPath} {
+		err = rt.renter.staticFileSystem.NewSiaFile(sp, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 0, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Change the settings of the original file.
+	original, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Hour).Round(0)
+	tags := map[string]string{"foo": "bar"}
+	mode := os.FileMode(0640)
+	err = errors.Compose(
+		original.SetLocalPath("/tmp/source"),
+		original.SetUploadPriority(5),
+		original.SetUploadDeadline(deadline),
+		original.SetCold(true),
+		original.SetMode(mode),
+		original.SetTags(tags),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := newReEncodeSettings(original)
+	original.Close()
+
+	// Replace the original file.
+	if err := rt.renter.managedFinishReEncode(siaPath, newSiaPath, 0, settings, 0); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if entry.LocalPath() != "/tmp/source" {
+		t.Fatal("local path wasn't carried over", entry.LocalPath())
+	}
+	if entry.UploadPriority() != 5 {
+		t.Fatal("upload priority wasn't carried over", entry.UploadPriority())
+	}
+	if !entry.UploadDeadline().Equal(deadline) {
+		t.Fatal("upload deadline wasn't carried over", entry.UploadDeadline())
+	}
+	if !entry.Cold() {
+		t.Fatal("cold status wasn't carried over")
+	}
+	if entry.Mode() != mode {
+		t.Fatal("mode wasn't carried over", entry.Mode())
+	}
+	if !reflect.DeepEqual(entry.Tags(), tags) {
+		t.Fatal("tags weren't carried over", entry.Tags())
+	}
+}
@@ -0,0 +1,159 @@
+package renter
+
+// relocate.go implements moving the renter's filesystem to a new location,
+// e.g. to a larger disk. The filesystem is copied to the new location while all
+// access to it is blocked. Once the copy is complete, the new location is
+// persisted in the renter's settings and the old tree is removed. Since the
+// location is loaded before the filesystem is created on startup, a crash
+// during the relocation leaves the renter with either the old or the new
+// filesystem but never a mix of both.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/persist"
+)
+
+var (
+	// errRelocateRelativePath is returned if the filesystem is relocated to a
+	// relative path.
+	errRelocateRelativePath = errors.New("new location of the filesystem must be an absolute path")
+
+	// errRelocateIntoFilesDir is returned if the filesystem is relocated to a
+	// location within the current filesystem.
+	errRelocateIntoFilesDir = errors.New("new location of the filesystem can't be within the current filesystem")
+
+	// errRelocateNotEmpty is returned if the new location of the filesystem
+	// already contains files.
+	errRelocateNotEmpty = errors.New("new location of the filesystem must be empty")
+
+	// errRelocateNoSpace is returned if the disk of the new location doesn't
+	// have enough free space for the filesystem.
+	errRelocateNoSpace = errors.New("not enough free space at the new location of the filesystem")
+)
+
+// loadFilesDir returns the location of the renter's filesystem. If the
+// filesystem was never relocated or the settings can't be loaded, the default
+// location within the persist dir is returned.
+func loadFilesDir(persistDir string) string {
+	var p persistence
+	err := persist.LoadJSON(settingsMetadata, &p, filepath.Join(persistDir, PersistFilename))
+	if err != nil || p.FilesDir == "" {
+		return filepath.Join(persistDir, modules.FileSystemRoot)
+	}
+	return p.FilesDir
+}
+
+// RelocateFilesDir moves the renter's filesystem to newPath. All access to the
+// filesystem, including uploads, downloads and repairs, is blocked until the
+// relocation is complete. newPath must either not exist or be an empty
+// directory.
+func (r *Renter) RelocateFilesDir(newPath string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := r.managedCheckFilesDirRelocation(newPath); err != nil {
+		return err
+	}
+	oldPath := r.staticFileSystem.Root()
+	err := r.staticFileSystem.Relocate(newPath, func(newRoot string) error {
+		id := r.mu.Lock()
+		defer r.mu.Unlock(id)
+		r.persist.FilesDir = newRoot
+		err := r.saveSync()
+		if err != nil {
+			r.persist.FilesDir = ""
+		}
+		return err
+	})
+	if err != nil {
+		return errors.AddContext(err, "failed to relocate filesystem")
+	}
+	r.log.Printf("Relocated filesystem from %v to %v", oldPath, newPath)
+	return nil
+}
+
+// RelocateFilesDirDryRun checks whether the renter's filesystem can be moved to
+// newPath without moving it. It checks that newPath is a valid location, that
+// it is writable and that its disk has enough free space for the filesystem.
+func (r *Renter) RelocateFilesDirDryRun(newPath string) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	return r.managedCheckFilesDirRelocation(newPath)
+}
+
+// managedCheckFilesDirRelocation checks that the renter's filesystem can be
+// moved to newPath.
+func (r *Renter) managedCheckFilesDirRelocation(newPath string) error {
+	if !filepath.IsAbs(newPath) {
+		return errRelocateRelativePath
+	}
+	newPath = filepath.Clean(newPath)
+	root := r.staticFileSystem.Root()
+	if rel, err := filepath.Rel(root, newPath); err == nil && !strings.HasPrefix(rel, "..") {
+		return errRelocateIntoFilesDir
+	}
+
+	// The new location needs to be empty. If it doesn't exist yet, its parent
+	// needs to exist.
+	dir := newPath
+	fis, err := ioutil.ReadDir(newPath)
+	if os.IsNotExist(err) {
+		dir = filepath.Dir(newPath)
+		if _, err := os.Stat(dir); err != nil {
+			return errors.AddContext(err, "parent of the new location of the filesystem is not accessible")
+		}
+	} else if err != nil {
+		return errors.AddContext(err, "new location of the filesystem is not accessible")
+	} else if len(fis) > 0 {
+		return errRelocateNotEmpty
+	}
+
+	// Check that we can write to the new location.
+	f, err := ioutil.TempFile(dir, ".relocate")
+	if err != nil {
+		return errors.AddContext(err, "new location of the filesystem is not writable")
+	}
+	if err := errors.Compose(f.Close(), os.Remove(f.Name())); err != nil {
+		return errors.AddContext(err, "new location of the filesystem is not writable")
+	}
+
+	// Check that the filesystem fits onto the disk of the new location.
+	size, err := dirSize(root)
+	if err != nil {
+		return errors.AddContext(err, "failed to compute size of the filesystem")
+	}
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return errors.AddContext(err, "failed to get free space of the new location")
+	}
+	if free < size {
+		return errors.AddContext(errRelocateNoSpace, fmt.Sprintf("need %v bytes but only %v are available", size, free))
+	}
+	return nil
+}
+
+// dirSize returns the total size of the files in the directory tree at path.
+func dirSize(path string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,112 @@
+package renter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestRelocateFilesDir tests moving the renter's filesystem to a new location.
+func TestRelocateFilesDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file in a nested dir and keep it open.
+	siaPath, err := modules.NewSiaPath("dir/sub/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+
+	// Invalid locations should be rejected by the dry run.
+	oldRoot := rt.renter.staticFileSystem.Root()
+	newRoot := filepath.Join(rt.dir, "relocated")
+	if err := rt.renter.RelocateFilesDirDryRun("relocated"); err != errRelocateRelativePath {
+		t.Fatal("expected errRelocateRelativePath but got", err)
+	}
+	if err := rt.renter.RelocateFilesDirDryRun(filepath.Join(oldRoot, "relocated")); err != errRelocateIntoFilesDir {
+		t.Fatal("expected errRelocateIntoFilesDir but got", err)
+	}
+	if err := rt.renter.RelocateFilesDirDryRun(filepath.Join(rt.dir, "missing", "relocated")); err == nil {
+		t.Fatal("expected error for missing parent")
+	}
+	if err := os.MkdirAll(newRoot, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RelocateFilesDirDryRun(newRoot); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(newRoot, "foo"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RelocateFilesDirDryRun(newRoot); err != errRelocateNotEmpty {
+		t.Fatal("expected errRelocateNotEmpty but got", err)
+	}
+	if err := os.Remove(filepath.Join(newRoot, "foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relocate the filesystem.
+	if err := rt.renter.RelocateFilesDir(newRoot); err != nil {
+		t.Fatal(err)
+	}
+	if root := rt.renter.staticFileSystem.Root(); root != newRoot {
+		t.Fatalf("expected root %v but was %v", newRoot, root)
+	}
+	if _, err := os.Stat(oldRoot); !os.IsNotExist(err) {
+		t.Fatal("old filesystem wasn't removed", err)
+	}
+
+	// The open file should have been moved and still be writable.
+	if expected := siaPath.SiaFileSysPath(newRoot); entry.SiaFilePath() != expected {
+		t.Fatalf("expected path %v but was %v", expected, entry.SiaFilePath())
+	}
+	if err := entry.SetScrubResult(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.File(siaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new location should survive a restart.
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rt.renter, err = newRenterWithDependency(rt.gateway, rt.cs, rt.wallet, rt.tpool, filepath.Join(rt.dir, modules.RenterDir), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root := rt.renter.staticFileSystem.Root(); root != newRoot {
+		t.Fatalf("expected root %v after restart but was %v", newRoot, root)
+	}
+	fi, err := rt.renter.File(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.LastScrubTime.IsZero() {
+		t.Fatal("metadata written after the relocation was lost")
+	}
+}
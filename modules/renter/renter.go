@@ -29,16 +29,19 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/threadgroup"
 	"gitlab.com/NebulousLabs/writeaheadlog"
 
 	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/contractor"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/hostdb"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
 	"gitlab.com/NebulousLabs/Sia/persist"
 	siasync "gitlab.com/NebulousLabs/Sia/sync"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -142,6 +145,14 @@ type hostContractor interface {
 	// with a bool indicating if it exists.
 	ContractUtility(types.SiaPublicKey) (modules.ContractUtility, bool)
 
+	// OnContractArchived registers a callback which is called with every
+	// contract that is archived because it expired.
+	OnContractArchived(func(modules.RenterContract))
+
+	// OnContractUtilityChanged registers a callback which is called with every
+	// contract whose GoodForRenew utility changed.
+	OnContractUtilityChanged(func(modules.RenterContract))
+
 	// ContractStatus returns the status of the given contract within the
 	// watchdog.
 	ContractStatus(fcID types.FileContractID) (modules.ContractWatchStatus, bool)
@@ -175,6 +186,10 @@ type hostContractor interface {
 	// Session creates a Session from the specified contract ID.
 	Session(types.SiaPublicKey, <-chan struct{}) (contractor.Session, error)
 
+	// ContractEndHeights returns the end heights of the active contracts in
+	// ascending order.
+	ContractEndHeights() []types.BlockHeight
+
 	// RecoverableContracts returns the contracts that the contractor deems
 	// recoverable. That means they are not expired yet and also not part of the
 	// active contracts. Usually this should return an empty slice unless the host
@@ -185,6 +200,10 @@ type hostContractor interface {
 	// contracts is in progress and if it is, the current progress of the scan.
 	RecoveryScanStatus() (bool, types.BlockHeight)
 
+	// RecoveryStatus returns information about the progress of the contract
+	// recovery.
+	RecoveryStatus() modules.ContractRecoveryStatus
+
 	// RefreshedContract checks if the contract was previously refreshed
 	RefreshedContract(fcid types.FileContractID) bool
 
@@ -251,8 +270,87 @@ type Renter struct {
 	// A bubble is the process of updating a directory's metadata and then
 	// moving on to its parent directory so that any changes in metadata are
 	// properly reflected throughout the filesystem.
-	bubbleUpdates   map[string]bubbleStatus
-	bubbleUpdatesMu sync.Mutex
+	//
+	// bubbleStartTimes tracks the time at which the active bubble of a
+	// directory was started.
+	//
+	// bubbleLastRuns tracks the time at which the last bubble of a directory
+	// completed together with the modification time of the directory it was
+	// based on. bubbleLastRunsPruned is the time at which bubbleLastRuns was
+	// last pruned. bubbleDelayed contains the directories which have a
+	// debounced bubble scheduled.
+	//
+	// bubbleErrors contains the error of the last bubble of every directory
+	// which failed to bubble.
+	//
+	// bubbleQueue contains the directories which are waiting for one of the
+	// bubble workers and bubbleQueueHeap orders them by their priority.
+	// bubbleQueueChan is used to wake up the workers.
+	//
+	// lastRootBubbleTime is the time at which a bubble last successfully
+	// updated the root directory.
+	//
+	// diskWriteErrors contains the paths of the files and directories whose
+	// metadata couldn't be persisted by their last bubble.
+	bubbleUpdates        map[string]bubbleStatus
+	bubbleStartTimes     map[string]time.Time
+	bubbleLastRuns       map[string]bubbleLastRun
+	bubbleLastRunsPruned time.Time
+	bubbleDelayed        map[string]struct{}
+	bubbleErrors         map[string]modules.DirBubbleError
+	bubbleQueue          map[string]modules.SiaPath
+	bubbleQueueHeap      bubbleQueueHeap
+	bubbleQueueChan      chan struct{}
+	lastRootBubbleTime   time.Time
+	diskWriteErrors      map[string]struct{}
+	bubbleUpdatesMu      sync.Mutex
+
+	// nextMetadataWrite is the earliest time at which the health scan may
+	// persist the next siafile metadata. It is used to limit the metadata
+	// writes to the rate set with SetMetadataWriteRate.
+	nextMetadataWrite   time.Time
+	nextMetadataWriteMu sync.Mutex
+
+	// nextRepair is the earliest time at which the repair loop may start
+	// repairing the next chunk. It is used to limit the bandwidth used by
+	// repairs to the limit set with SetRepairBandwidthLimit.
+	nextRepair   time.Time
+	nextRepairMu sync.Mutex
+
+	// healthSubscribers are the channels of the subscribers which receive a
+	// HealthEvent whenever a directory crosses the repair threshold.
+	healthSubscribers   map[chan modules.HealthEvent]struct{}
+	healthSubscribersMu sync.Mutex
+
+	// uploadProgressCallbacks are the callbacks registered with
+	// OnUploadProgress. They are keyed by the UID of the file to be robust
+	// against renames.
+	uploadProgressCallbacks   map[siafile.SiafileUID][]func(completed, total uint64)
+	uploadProgressCallbacksMu sync.Mutex
+
+	// uploadRates contain the recent upload progress of files which are
+	// being uploaded. They are used to estimate the remaining upload time.
+	uploadRates       map[siafile.SiafileUID]*uploadRate
+	uploadRatesPruned time.Time
+	uploadRatesMu     sync.Mutex
+
+	// dedupChunks maps the dedup key of fully uploaded chunks to their
+	// pieces. It is only populated if chunk deduplication is enabled and is
+	// not persisted. dedupChunkKeys contains the keys in the order they were
+	// added to evict the oldest chunks once maxDedupChunks is reached.
+	dedupChunks    map[crypto.Hash][][]siafile.Piece
+	dedupChunkKeys []crypto.Hash
+	dedupChunksMu  sync.Mutex
+
+	// contractIndex maps the files of the renter to the public keys of the
+	// hosts which store their pieces. It is used to bubble the affected
+	// directories when the contract set changes and is not persisted.
+	contractIndex   map[modules.SiaPath]map[string]struct{}
+	contractIndexMu sync.Mutex
+
+	// activeUploadsChanged indicates whether the active uploads changed since
+	// they were last saved. It is protected by mu.
+	activeUploadsChanged bool
 
 	// Utilities.
 	cs                modules.ConsensusSet
@@ -547,6 +645,51 @@ func (r *Renter) managedRenterContractsAndUtilities(entrys []*filesystem.FileNod
 	return offline, goodForRenew, contracts
 }
 
+// hostUptimeRatio returns the fraction of time that a host has been observed
+// to be online according to its scan history. Hosts without enough scan
+// history to make a judgement are assumed to be fully online.
+func hostUptimeRatio(entry modules.HostDBEntry) float64 {
+	if len(entry.ScanHistory) == 0 {
+		return 1
+	}
+	uptime := entry.HistoricUptime
+	downtime := entry.HistoricDowntime
+	recentTime := entry.ScanHistory[0].Timestamp
+	recentSuccess := entry.ScanHistory[0].Success
+	for _, scan := range entry.ScanHistory[1:] {
+		// Ignore unsorted scan entries.
+		if recentTime.After(scan.Timestamp) {
+			continue
+		}
+		if recentSuccess {
+			uptime += scan.Timestamp.Sub(recentTime)
+		} else {
+			downtime += scan.Timestamp.Sub(recentTime)
+		}
+		recentTime = scan.Timestamp
+		recentSuccess = scan.Success
+	}
+	if uptime+downtime <= 0 {
+		return 1
+	}
+	return float64(uptime) / float64(uptime+downtime)
+}
+
+// managedHostUptimeMap returns a map of host pubkeys to the uptime ratio of
+// the corresponding host. Hosts that are unknown to the hostdb are left out of
+// the map.
+func (r *Renter) managedHostUptimeMap(pks []types.SiaPublicKey) map[string]float64 {
+	uptime := make(map[string]float64)
+	for _, pk := range pks {
+		entry, ok, err := r.hostDB.Host(pk)
+		if err != nil || !ok {
+			continue
+		}
+		uptime[pk.String()] = hostUptimeRatio(entry)
+	}
+	return uptime
+}
+
 // setBandwidthLimits will change the bandwidth limits of the renter based on
 // the persist values for the bandwidth.
 func (r *Renter) setBandwidthLimits(downloadSpeed int64, uploadSpeed int64) error {
@@ -577,10 +720,14 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 		return err
 	}
 	defer r.tg.Done()
-	// Early input validation.
+	// Early input validation. A repair threshold of 0 resets it to the
+	// default.
 	if s.MaxDownloadSpeed < 0 || s.MaxUploadSpeed < 0 {
 		return errors.New("bandwidth limits cannot be negative")
 	}
+	if s.RepairThreshold != 0 && (s.RepairThreshold < MinRepairThreshold || s.RepairThreshold > MaxRepairThreshold) {
+		return ErrInvalidRepairThreshold
+	}
 
 	// Set allowance.
 	err := r.hostContractor.SetAllowance(s.Allowance)
@@ -600,6 +747,8 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	id := r.mu.Lock()
 	r.persist.MaxDownloadSpeed = s.MaxDownloadSpeed
 	r.persist.MaxUploadSpeed = s.MaxUploadSpeed
+	r.persist.ChunkDeduplication = s.ChunkDeduplication
+	r.persist.RepairThreshold = s.RepairThreshold
 	err = r.saveSync()
 	r.mu.Unlock(id)
 	if err != nil {
@@ -641,7 +790,10 @@ func (r *Renter) SetFileTrackingPath(siaPath modules.SiaPath, newPath string) er
 	}
 
 	// Set the new path on disk.
-	return entry.SetLocalPath(newPath)
+	if err := entry.SetLocalPath(newPath); err != nil {
+		return err
+	}
+	return entry.SetLocalModTime(fi.ModTime())
 }
 
 // ActiveHosts returns an array of hostDB's active hosts
@@ -758,6 +910,12 @@ func (r *Renter) RecoveryScanStatus() (bool, types.BlockHeight) {
 	return r.hostContractor.RecoveryScanStatus()
 }
 
+// RecoveryStatus returns information about the progress of the contract
+// recovery.
+func (r *Renter) RecoveryStatus() modules.ContractRecoveryStatus {
+	return r.hostContractor.RecoveryStatus()
+}
+
 // OldContracts returns an array of host contractor's oldContracts
 func (r *Renter) OldContracts() []modules.RenterContract {
 	return r.hostContractor.OldContracts()
@@ -768,6 +926,12 @@ func (r *Renter) PeriodSpending() (modules.ContractorSpending, error) {
 	return r.hostContractor.PeriodSpending()
 }
 
+// ContractEndHeights returns the end heights of the host contractor's active
+// contracts in ascending order.
+func (r *Renter) ContractEndHeights() []types.BlockHeight {
+	return r.hostContractor.ContractEndHeights()
+}
+
 // RecoverableContracts returns the host contractor's recoverable contracts.
 func (r *Renter) RecoverableContracts() []modules.RecoverableContract {
 	return r.hostContractor.RecoverableContracts()
@@ -797,9 +961,12 @@ func (r *Renter) Settings() (modules.RenterSettings, error) {
 		MaxDownloadSpeed: download,
 		MaxUploadSpeed:   upload,
 		UploadsStatus: modules.UploadsStatus{
-			Paused:       paused,
-			PauseEndTime: endTime,
+			Paused:        paused,
+			PauseEndTime:  endTime,
+			RepairsPaused: r.uploadHeap.managedPausedIndefinitely(),
 		},
+		ChunkDeduplication: r.managedChunkDeduplication(),
+		RepairThreshold:    r.managedRepairThreshold(),
 	}, nil
 }
 
@@ -881,8 +1048,21 @@ func renterBlockingStartup(g modules.Gateway, cs modules.ConsensusSet, tpool mod
 			heapDirectories: make(map[modules.SiaPath]*directory),
 		},
 
-		bubbleUpdates:   make(map[string]bubbleStatus),
-		downloadHistory: make(map[modules.DownloadID]*download),
+		bubbleUpdates:    make(map[string]bubbleStatus),
+		bubbleStartTimes: make(map[string]time.Time),
+		bubbleLastRuns:   make(map[string]bubbleLastRun),
+		bubbleDelayed:    make(map[string]struct{}),
+		bubbleErrors:     make(map[string]modules.DirBubbleError),
+		diskWriteErrors:  make(map[string]struct{}),
+		bubbleQueue:      make(map[string]modules.SiaPath),
+		bubbleQueueChan:  make(chan struct{}, 1),
+		downloadHistory:  make(map[modules.DownloadID]*download),
+
+		healthSubscribers:       make(map[chan modules.HealthEvent]struct{}),
+		uploadProgressCallbacks: make(map[siafile.SiafileUID][]func(completed, total uint64)),
+		uploadRates:             make(map[siafile.SiafileUID]*uploadRate),
+		dedupChunks:             make(map[crypto.Hash][][]siafile.Piece),
+		contractIndex:           make(map[modules.SiaPath]map[string]struct{}),
 
 		cs:             cs,
 		deps:           deps,
@@ -900,10 +1080,23 @@ func renterBlockingStartup(g modules.Gateway, cs modules.ConsensusSet, tpool mod
 	r.staticFuseManager = newFuseManager(r)
 	r.stuckStack = callNewStuckStack()
 
+	// Bubble the directories of the affected files whenever the contract set
+	// changes.
+	hc.OnContractArchived(r.callContractChanged)
+	hc.OnContractUtilityChanged(r.callContractChanged)
+
 	// Load all saved data.
 	if err := r.managedInitPersist(); err != nil {
 		return nil, err
 	}
+	// Restore the paused state of the repairs and the repair signal throttle
+	// interval.
+	id := r.mu.RLock()
+	repairsPaused := r.persist.RepairsPaused
+	signalThrottleInterval := r.persist.RepairSignalThrottleInterval
+	r.mu.RUnlock(id)
+	r.uploadHeap.managedSetPausedIndefinitely(repairsPaused)
+	r.uploadHeap.managedSetSignalThrottleInterval(signalThrottleInterval)
 	// After persist is initialized, push the root directory onto the directory
 	// heap for the repair process.
 	r.managedPushUnexploredDirectory(modules.RootSiaPath())
@@ -912,13 +1105,22 @@ func renterBlockingStartup(g modules.Gateway, cs modules.ConsensusSet, tpool mod
 
 	// Spin up background threads which are not depending on the renter being
 	// up-to-date with consensus.
+	for i := 0; i < numBubbleWorkers; i++ {
+		go r.threadedBubbleWorker()
+	}
+	go r.threadedPersistActiveUploads()
 	if !r.deps.Disrupt("DisableRepairAndHealthLoops") {
 		go r.threadedUpdateRenterHealth()
+		go r.threadedRecalculateSizes()
+		go r.threadedPurgeTrash()
+		go r.threadedScrubLoop()
 	}
 	// Unsubscribe on shutdown.
 	err := r.tg.OnStop(func() error {
 		cs.Unsubscribe(r)
-		return nil
+		r.managedCloseHealthSubscribers()
+		r.uploadHeap.managedStopSignalThrottles()
+		return r.managedPersistActiveUploads()
 	})
 	if err != nil {
 		return nil, err
@@ -945,6 +1147,8 @@ func renterAsyncStartup(r *Renter, cs modules.ConsensusSet) error {
 	// consensus set.
 	// Spin up the workers for the work pool.
 	go r.threadedDownloadLoop()
+	// Requeue the uploads which were interrupted by the last shutdown.
+	r.managedRequeueActiveUploads()
 	if !r.deps.Disrupt("DisableRepairAndHealthLoops") {
 		go r.threadedUploadAndRepair()
 		go r.threadedStuckFileLoop()
@@ -1,6 +1,7 @@
 package renter
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -82,13 +83,14 @@ func (r *Renter) managedAddRandomStuckChunks(hosts map[string]struct{}) ([]modul
 func (r *Renter) managedAddStuckChunksFromStuckStack(hosts map[string]struct{}) ([]modules.SiaPath, error) {
 	var dirSiaPaths []modules.SiaPath
 	offline, goodForRenew, _ := r.managedContractUtilityMaps()
+	ranking := r.managedHostThroughputRanking()
 	numStuckChunks, _ := r.uploadHeap.managedNumStuckChunks()
 	for r.stuckStack.managedLen() > 0 && numStuckChunks < maxStuckChunksInHeap {
 		// Pop the first file SiaPath
 		siaPath := r.stuckStack.managedPop()
 
 		// Add stuck chunks to uploadHeap
-		err := r.managedAddStuckChunksToHeap(siaPath, hosts, offline, goodForRenew)
+		err := r.managedAddStuckChunksToHeap(siaPath, hosts, offline, goodForRenew, ranking)
 		if err != nil && err != errNoStuckChunks {
 			return dirSiaPaths, errors.AddContext(err, "unable to add stuck chunks to heap")
 		}
@@ -110,7 +112,7 @@ func (r *Renter) managedAddStuckChunksFromStuckStack(hosts map[string]struct{})
 
 // managedAddStuckChunksToHeap tries to add as many stuck chunks from a siafile
 // to the upload heap as possible
-func (r *Renter) managedAddStuckChunksToHeap(siaPath modules.SiaPath, hosts map[string]struct{}, offline, goodForRenew map[string]bool) error {
+func (r *Renter) managedAddStuckChunksToHeap(siaPath modules.SiaPath, hosts map[string]struct{}, offline, goodForRenew map[string]bool, ranking *hostThroughputRanking) error {
 	// Open File
 	sf, err := r.staticFileSystem.OpenSiaFile(siaPath)
 	if err != nil {
@@ -125,7 +127,7 @@ func (r *Renter) managedAddStuckChunksToHeap(siaPath modules.SiaPath, hosts map[
 
 	// Build unfinished stuck chunks
 	var allErrors error
-	unfinishedStuckChunks := r.managedBuildUnfinishedChunks(sf, hosts, targetStuckChunks, offline, goodForRenew)
+	unfinishedStuckChunks := r.managedBuildUnfinishedChunks(sf, hosts, targetStuckChunks, offline, goodForRenew, ranking)
 	defer func() {
 		// Close out remaining file entries
 		for _, chunk := range unfinishedStuckChunks {
@@ -160,6 +162,17 @@ func (r *Renter) managedAddStuckChunksToHeap(siaPath modules.SiaPath, hosts map[
 	return allErrors
 }
 
+// OldestHealthCheckTime returns the lowest level directory with the oldest
+// LastHealthCheckTime together with that time. It can be used to monitor
+// whether the health loop is falling behind.
+func (r *Renter) OldestHealthCheckTime() (modules.SiaPath, time.Time, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.SiaPath{}, time.Time{}, err
+	}
+	defer r.tg.Done()
+	return r.managedOldestHealthCheckTime()
+}
+
 // managedOldestHealthCheckTime finds the lowest level directory with the oldest
 // LastHealthCheckTime
 func (r *Renter) managedOldestHealthCheckTime() (modules.SiaPath, time.Time, error) {
@@ -285,8 +298,8 @@ func (r *Renter) managedStuckDirectory() (modules.SiaPath, error) {
 				return siaPath, nil
 			}
 
-			// Skip directories with no stuck chunks
-			if directories[i].AggregateNumStuckChunks == uint64(0) {
+			// Skip directories with no stuck chunks and the trash
+			if directories[i].AggregateNumStuckChunks == uint64(0) || isTrashPath(directories[i].SiaPath) {
 				continue
 			}
 
@@ -400,6 +413,10 @@ func (r *Renter) managedSubDirectories(siaPath modules.SiaPath) ([]modules.SiaPa
 			if err != nil {
 				return nil, err
 			}
+			// Trashed files are not repaired.
+			if isTrashPath(subDir) {
+				continue
+			}
 			folders = append(folders, subDir)
 		}
 	}
@@ -501,7 +518,7 @@ func (r *Renter) threadedStuckFileLoop() {
 		// efficient this code should be removed and we should call bubble when
 		// we clean up the upload chunk after a successful repair.
 		for _, dirSiaPath := range dirSiaPaths {
-			err = r.managedBubbleMetadata(dirSiaPath)
+			err = r.managedBubbleMetadata(context.Background(), dirSiaPath)
 			if err != nil {
 				r.repairLog.Printf("Error propagating updated health of %s: %v", dirSiaPath.String(), err)
 				select {
@@ -565,7 +582,7 @@ func (r *Renter) threadedUpdateRenterHealth() {
 			}
 		}
 		r.log.Debug("Health Loop calling bubble on '", siaPath.String(), "'")
-		err = r.managedBubbleMetadata(siaPath)
+		err = r.managedBubbleMetadata(context.Background(), siaPath)
 		if err != nil {
 			r.log.Println("Error calling managedBubbleMetadata on `", siaPath.String(), "`:", err)
 			select {
@@ -1,9 +1,13 @@
 package renter
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -18,6 +22,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
 	"gitlab.com/NebulousLabs/Sia/persist"
 	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // equalBubbledMetadata is a helper that checks for equality in the siadir
@@ -97,7 +102,7 @@ func TestBubbleHealth(t *testing.T) {
 	defer rt.Close()
 
 	// Check to make sure bubble doesn't error on an empty directory
-	err = rt.renter.managedBubbleMetadata(modules.RootSiaPath())
+	err = rt.renter.managedBubbleMetadata(context.Background(), modules.RootSiaPath())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -195,7 +200,7 @@ func TestBubbleHealth(t *testing.T) {
 	// Note: this tests the edge case of bubbling an empty directory and
 	// directories with no files but do have sub directories since bubble will
 	// execute on all the parent directories
-	rt.renter.managedBubbleMetadata(siaPath)
+	rt.renter.managedBubbleMetadata(context.Background(), siaPath)
 	build.Retry(100, 100*time.Millisecond, func() error {
 		// Get Root Directory Health
 		metadata, err := rt.renter.managedDirectoryMetadata(modules.RootSiaPath())
@@ -256,7 +261,7 @@ func TestBubbleHealth(t *testing.T) {
 	// Now when we bubble the health and check for the worst health we should still see
 	// that the health is the health of subDir1/subDir1 which was set to 1 again
 	// and the stuck health will be the health of the stuck file
-	rt.renter.managedBubbleMetadata(siaPath)
+	rt.renter.managedBubbleMetadata(context.Background(), siaPath)
 	build.Retry(100, 100*time.Millisecond, func() error {
 		// Get Root Directory Health
 		metadata, err := rt.renter.managedDirectoryMetadata(modules.RootSiaPath())
@@ -284,7 +289,7 @@ func TestBubbleHealth(t *testing.T) {
 
 	// Now if we bubble the health and check for the worst health we should see
 	// that the health is the health of the file
-	rt.renter.managedBubbleMetadata(siaPath)
+	rt.renter.managedBubbleMetadata(context.Background(), siaPath)
 	expectedHealth := siadir.Metadata{
 		Health:      2,
 		StuckHealth: 0,
@@ -327,7 +332,7 @@ func TestBubbleHealth(t *testing.T) {
 	if err := rt.openAndUpdateDir(subDir1_2_1, expectedHealth); err != nil {
 		t.Fatal(err)
 	}
-	rt.renter.managedBubbleMetadata(siaPath)
+	rt.renter.managedBubbleMetadata(context.Background(), siaPath)
 	build.Retry(100, 100*time.Millisecond, func() error {
 		// Get Root Directory Health
 		health, err := rt.renter.managedDirectoryMetadata(modules.RootSiaPath())
@@ -345,6 +350,824 @@ func TestBubbleHealth(t *testing.T) {
 	}
 }
 
+// TestBubbleDebounce verifies that asynchronous bubbles of the same directory
+// are debounced and coalesced.
+func TestBubbleDebounce(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// A directory that was never bubbled shouldn't be delayed.
+	siaPath := modules.RandomSiaPath()
+	delay, scheduled := rt.renter.managedDebounceBubble(siaPath)
+	if delay != 0 || scheduled {
+		t.Fatal("bubble shouldn't be debounced", delay, scheduled)
+	}
+
+	// Complete a bubble. The next bubble should be delayed.
+	if !rt.renter.managedPrepareBubble(siaPath) {
+		t.Fatal("bubble wasn't prepared")
+	}
+	rt.renter.managedCompleteBubbleUpdate(siaPath)
+	delay, scheduled = rt.renter.managedDebounceBubble(siaPath)
+	if delay <= 0 || delay > bubbleDebounceInterval || scheduled {
+		t.Fatal("bubble should be delayed", delay, scheduled)
+	}
+
+	// Any other bubble within the window should be coalesced.
+	delay, scheduled = rt.renter.managedDebounceBubble(siaPath)
+	if delay != 0 || !scheduled {
+		t.Fatal("bubble should be coalesced", delay, scheduled)
+	}
+
+	// Once the window has passed and the delayed bubble was executed, bubbles
+	// shouldn't be delayed anymore.
+	rt.renter.bubbleUpdatesMu.Lock()
+	delete(rt.renter.bubbleDelayed, siaPath.String())
+	rt.renter.bubbleUpdatesMu.Unlock()
+	time.Sleep(bubbleDebounceInterval)
+	delay, scheduled = rt.renter.managedDebounceBubble(siaPath)
+	if delay != 0 || scheduled {
+		t.Fatal("bubble shouldn't be debounced", delay, scheduled)
+	}
+}
+
+// TestBubbleSkipUnchanged verifies that bubbles of directories which weren't
+// modified since their last bubble are skipped and that the last runs are
+// pruned.
+func TestBubbleSkipUnchanged(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a directory with a subdirectory and backdate both of them.
+	siaPath := modules.RandomSiaPath()
+	subDir, err := siaPath.Join("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateDir(subDir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	paths := []string{
+		r.staticFileSystem.DirPath(siaPath),
+		r.staticFileSystem.DirPath(subDir),
+		subDir.SiaDirMetadataSysPath(r.staticFileSystem.Root()),
+	}
+	for _, path := range paths {
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A directory which was never bubbled can't be skipped.
+	if r.managedBubbleUnchanged(siaPath) {
+		t.Fatal("directory without bubble shouldn't be skipped")
+	}
+
+	// After a bubble the directory is unchanged.
+	if err := r.managedBubbleMetadata(context.Background(), siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if !r.managedBubbleUnchanged(siaPath) {
+		t.Fatal("unchanged directory should be skipped")
+	}
+
+	// Forgetting the last run forces the next bubble.
+	r.managedForgetBubbleRun(siaPath)
+	if r.managedBubbleUnchanged(siaPath) {
+		t.Fatal("forgotten directory shouldn't be skipped")
+	}
+
+	// A modification of the subdirectory's metadata is detected.
+	if err := r.managedBubbleMetadata(context.Background(), siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if !r.managedBubbleUnchanged(siaPath) {
+		t.Fatal("unchanged directory should be skipped")
+	}
+	recentTime := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(paths[2], recentTime, recentTime); err != nil {
+		t.Fatal(err)
+	}
+	if r.managedBubbleUnchanged(siaPath) {
+		t.Fatal("modified directory shouldn't be skipped")
+	}
+
+	// Last runs older than bubbleLastRunRetention are pruned.
+	oldPath := modules.RandomSiaPath()
+	r.bubbleUpdatesMu.Lock()
+	r.bubbleLastRuns[oldPath.String()] = bubbleLastRun{time: time.Now().Add(-bubbleLastRunRetention)}
+	r.bubbleLastRunsPruned = time.Time{}
+	r.bubbleUpdatesMu.Unlock()
+	if !r.managedPrepareBubble(siaPath) {
+		t.Fatal("bubble wasn't prepared")
+	}
+	r.managedCompleteBubbleUpdate(siaPath)
+	r.bubbleUpdatesMu.Lock()
+	_, exists := r.bubbleLastRuns[oldPath.String()]
+	_, recent := r.bubbleLastRuns[siaPath.String()]
+	r.bubbleUpdatesMu.Unlock()
+	if exists || !recent {
+		t.Fatal("last runs weren't pruned correctly", exists, recent)
+	}
+}
+
+// TestBubbleBackoff verifies that asynchronous bubbles of a directory which
+// keeps failing to bubble are delayed with an exponential backoff which is
+// reset by a successful bubble.
+func TestBubbleBackoff(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Check the backoff itself.
+	if backoff := bubbleBackoff(0); backoff != 0 {
+		t.Fatal("expected no backoff without failures but got", backoff)
+	}
+	if backoff := bubbleBackoff(1); backoff != bubbleBackoffBase {
+		t.Fatalf("expected backoff %v but got %v", bubbleBackoffBase, backoff)
+	}
+	if backoff := bubbleBackoff(3); backoff != 4*bubbleBackoffBase {
+		t.Fatalf("expected backoff %v but got %v", 4*bubbleBackoffBase, backoff)
+	}
+	if backoff := bubbleBackoff(math.MaxUint64); backoff != bubbleBackoffMax {
+		t.Fatalf("expected backoff %v but got %v", bubbleBackoffMax, backoff)
+	}
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Fail a few bubbles. The next bubble should be delayed by the backoff.
+	siaPath := modules.RandomSiaPath()
+	for i := 0; i < 3; i++ {
+		rt.renter.managedRecordBubbleResult(siaPath, errors.New("bubble failed"))
+	}
+	delay, scheduled := rt.renter.managedDebounceBubble(siaPath)
+	if delay <= 2*bubbleBackoffBase || delay > 4*bubbleBackoffBase || scheduled {
+		t.Fatal("bubble should be backed off", delay, scheduled)
+	}
+
+	// A successful bubble resets the backoff.
+	rt.renter.bubbleUpdatesMu.Lock()
+	delete(rt.renter.bubbleDelayed, siaPath.String())
+	rt.renter.bubbleUpdatesMu.Unlock()
+	rt.renter.managedRecordBubbleResult(siaPath, nil)
+	delay, scheduled = rt.renter.managedDebounceBubble(siaPath)
+	if delay != 0 || scheduled {
+		t.Fatal("bubble shouldn't be backed off", delay, scheduled)
+	}
+}
+
+// TestBubbleQueueStats verifies that BubbleQueueStats reports the number of
+// directories in every state of the bubble queue.
+func TestBubbleQueueStats(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// checkStats compares the stats of the renter to the expected ones.
+	checkStats := func(expected modules.BubbleQueueStats) {
+		t.Helper()
+		if stats := rt.renter.BubbleQueueStats(); stats != expected {
+			t.Fatalf("expected stats %v but got %v", expected, stats)
+		}
+	}
+	checkStats(modules.BubbleQueueStats{})
+
+	// Start bubbles for two directories.
+	siaPath1, siaPath2 := modules.RandomSiaPath(), modules.RandomSiaPath()
+	if !rt.renter.managedPrepareBubble(siaPath1) || !rt.renter.managedPrepareBubble(siaPath2) {
+		t.Fatal("bubbles weren't prepared")
+	}
+	checkStats(modules.BubbleQueueStats{Active: 2})
+
+	// Another bubble of the first directory should become pending.
+	if rt.renter.managedPrepareBubble(siaPath1) {
+		t.Fatal("bubble shouldn't have been prepared")
+	}
+	checkStats(modules.BubbleQueueStats{Active: 1, Pending: 1})
+
+	// Completing the second bubble and bubbling it again right away should
+	// delay the bubble.
+	rt.renter.managedCompleteBubbleUpdate(siaPath2)
+	if delay, _ := rt.renter.managedDebounceBubble(siaPath2); delay == 0 {
+		t.Fatal("bubble should be delayed")
+	}
+	checkStats(modules.BubbleQueueStats{Pending: 1, Delayed: 1})
+}
+
+// TestDirBubbleErrors verifies that failed bubbles are recorded and cleared
+// again once the directory bubbles successfully.
+func TestDirBubbleErrors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Bubble a directory that doesn't exist twice. Both bubbles should fail.
+	siaPath := modules.RandomSiaPath()
+	for i := 0; i < 2; i++ {
+		if err := rt.renter.managedBubbleMetadata(context.Background(), siaPath); err == nil {
+			t.Fatal("bubble of missing directory should fail")
+		}
+	}
+	errs := rt.renter.DirBubbleErrors()
+	if len(errs) != 1 {
+		t.Fatal("expected 1 bubble error but got", len(errs))
+	}
+	if !errs[0].SiaPath.Equals(siaPath) || errs[0].NumFailures != 2 || errs[0].Error == "" || errs[0].Time.IsZero() {
+		t.Fatal("unexpected bubble error", errs[0])
+	}
+
+	// Create the directory. The next bubble should clear the error.
+	if err := rt.renter.CreateDir(siaPath, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedBubbleMetadata(context.Background(), siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if errs := rt.renter.DirBubbleErrors(); len(errs) != 0 {
+		t.Fatal("bubble error wasn't cleared", errs)
+	}
+}
+
+// TestDirBubbleErrorsPersist verifies that the bubble errors are persisted
+// across restarts and that only the most recent errors are kept.
+func TestDirBubbleErrorsPersist(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Fill up the bubble errors with old errors.
+	oldest := modules.RandomSiaPath()
+	rt.renter.bubbleUpdatesMu.Lock()
+	for i := 0; i < maxBubbleErrors; i++ {
+		siaPath := modules.RandomSiaPath()
+		if i == 0 {
+			siaPath = oldest
+		}
+		rt.renter.bubbleErrors[siaPath.String()] = modules.DirBubbleError{
+			SiaPath:     siaPath,
+			Error:       "old error",
+			Time:        time.Now().Add(time.Duration(i-maxBubbleErrors) * time.Second),
+			NumFailures: 1,
+		}
+	}
+	rt.renter.bubbleUpdatesMu.Unlock()
+
+	// Recording another error should drop the oldest one.
+	siaPath := modules.RandomSiaPath()
+	rt.renter.managedRecordBubbleResult(siaPath, errors.New("new error"))
+	errs := rt.renter.DirBubbleErrors()
+	if len(errs) != maxBubbleErrors {
+		t.Fatalf("expected %v bubble errors but got %v", maxBubbleErrors, len(errs))
+	}
+	for _, bubbleErr := range errs {
+		if bubbleErr.SiaPath.Equals(oldest) {
+			t.Fatal("oldest bubble error wasn't dropped")
+		}
+	}
+
+	// Restart the renter. The errors should be restored.
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var errChan <-chan error
+	rt.renter, errChan = New(rt.gateway, rt.cs, rt.wallet, rt.tpool, filepath.Join(rt.dir, modules.RenterDir))
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	errs = rt.renter.DirBubbleErrors()
+	if len(errs) != maxBubbleErrors {
+		t.Fatalf("expected %v bubble errors but got %v", maxBubbleErrors, len(errs))
+	}
+	var found bool
+	for _, bubbleErr := range errs {
+		if bubbleErr.SiaPath.Equals(siaPath) {
+			found = bubbleErr.Error == "new error" && bubbleErr.NumFailures == 1
+		}
+	}
+	if !found {
+		t.Fatal("new bubble error wasn't restored")
+	}
+}
+
+// TestLastRootBubbleTime tests that the time of the last successful bubble
+// of the root directory is tracked.
+func TestLastRootBubbleTime(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Bubble the root. The time should be updated.
+	before := rt.renter.LastRootBubbleTime()
+	start := time.Now()
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if err := rt.renter.managedBubbleMetadata(context.Background(), modules.RootSiaPath()); err != nil {
+			return err
+		}
+		if last := rt.renter.LastRootBubbleTime(); !last.After(before) || last.Before(start) {
+			return fmt.Errorf("LastRootBubbleTime wasn't updated: %v", last)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestBubbleMetadataCanceled tests that a bubble can be canceled through its
+// context without modifying the directory's metadata or recording a
+// failure.
+func TestBubbleMetadataCanceled(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create test renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file in a new directory.
+	dir := modules.RandomSiaPath()
+	siaPath, err := dir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bubble the directory with a canceled context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rt.renter.managedBubbleMetadata(ctx, dir); !errors.Contains(err, context.Canceled) {
+		t.Fatal("expected bubble to be canceled but got", err)
+	}
+	if errs := rt.renter.DirBubbleErrors(); len(errs) != 0 {
+		t.Fatal("canceled bubble shouldn't be recorded as a failure", errs)
+	}
+	md, err := rt.renter.managedDirectoryMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.NumFiles != 0 {
+		t.Fatal("metadata shouldn't have been updated", md.NumFiles)
+	}
+
+	// Bubble again without canceling the context.
+	if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	md, err = rt.renter.managedDirectoryMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.NumFiles != 1 {
+		t.Fatal("expected 1 file but got", md.NumFiles)
+	}
+}
+
+// TestAggregateRepairSize verifies that the repair size of files is bubbled
+// up through nested directories.
+func TestAggregateRepairSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create the following directory tree. None of the pieces are uploaded.
+	//
+	// dir/fileA
+	// dir/subDir/fileB
+	dir := modules.RandomSiaPath()
+	subDir, err := dir.Join("subDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileA, err := dir.Join("fileA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileB, err := subDir.Join("fileB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	var fileRepairSize uint64
+	for _, siaPath := range []modules.SiaPath{fileA, fileB} {
+		err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeTwofish), 100, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileRepairSize = uint64(rsc.NumPieces()) * sf.PieceSize()
+		sf.Close()
+	}
+
+	// Bubble the tree.
+	if err := rt.renter.managedBubbleMetadata(context.Background(), subDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check the repair sizes. dir's RepairSize only includes fileA while the
+	// aggregate includes both files.
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		subDirMD, err := rt.renter.managedDirectoryMetadata(subDir)
+		if err != nil {
+			return err
+		}
+		if subDirMD.RepairSize != fileRepairSize || subDirMD.AggregateRepairSize != fileRepairSize {
+			return fmt.Errorf("wrong repair size of subDir: %v %v", subDirMD.RepairSize, subDirMD.AggregateRepairSize)
+		}
+		dirMD, err := rt.renter.managedDirectoryMetadata(dir)
+		if err != nil {
+			return err
+		}
+		if dirMD.RepairSize != fileRepairSize || dirMD.AggregateRepairSize != 2*fileRepairSize {
+			return fmt.Errorf("wrong repair size of dir: %v %v", dirMD.RepairSize, dirMD.AggregateRepairSize)
+		}
+		rootMD, err := rt.renter.managedDirectoryMetadata(modules.RootSiaPath())
+		if err != nil {
+			return err
+		}
+		if rootMD.AggregateRepairSize != 2*fileRepairSize {
+			return fmt.Errorf("wrong aggregate repair size of root: %v", rootMD.AggregateRepairSize)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRefreshFileMetadata tests that RefreshFileMetadata updates the metadata
+// of a file and bubbles its parent directory.
+func TestRefreshFileMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Refreshing a file that doesn't exist should fail.
+	if _, err := rt.renter.RefreshFileMetadata(modules.RandomSiaPath()); err == nil {
+		t.Fatal("expected refreshing a missing file to fail")
+	}
+
+	// Create a file in a directory.
+	dir := modules.RandomSiaPath()
+	siaPath, err := dir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Refresh the file. The returned metadata should match the file.
+	start := time.Now()
+	md, err := rt.renter.RefreshFileMetadata(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	if md.LastHealthCheckTime.Before(start) {
+		t.Fatal("LastHealthCheckTime wasn't updated", md.LastHealthCheckTime)
+	}
+	if md.Health != sf.Metadata().CachedHealth || md.Size != sf.Size() || md.UID != sf.UID() {
+		t.Fatal("returned metadata doesn't match the file", md)
+	}
+	// The file uses 1-of-2 erasure coding.
+	if md.TargetRedundancy != 2 {
+		t.Fatal("wrong target redundancy", md.TargetRedundancy)
+	}
+
+	// The parent directory should be bubbled.
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		dirMD, err := rt.renter.managedDirectoryMetadata(dir)
+		if err != nil {
+			return err
+		}
+		if dirMD.NumFiles != 1 || dirMD.Health != md.Health {
+			return fmt.Errorf("directory wasn't bubbled: %v files, health %v", dirMD.NumFiles, dirMD.Health)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNumStuckChunks verifies that the number of stuck chunks of the files and
+// sub directories of a directory are counted exactly once.
+func TestNumStuckChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create the following directory tree with the number of stuck chunks in
+	// brackets.
+	//
+	// dir/fileA (2 out of 3 chunks)
+	// dir/fileB (1 out of 1 chunks)
+	// dir/subDir/fileC (1 out of 2 chunks)
+	dir := modules.RandomSiaPath()
+	subDir, err := dir.Join("subDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir(subDir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	newFile := func(dir modules.SiaPath, name string, numChunks uint64, stuckChunks ...uint64) {
+		siaPath, err := dir.Join(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), numChunks*modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, chunkIndex := range stuckChunks {
+			if err := f.SetStuck(chunkIndex, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	newFile(dir, "fileA", 3, 0, 2)
+	newFile(dir, "fileB", 1, 0)
+	newFile(subDir, "fileC", 2, 1)
+
+	// Bubble the sub directory and calculate the metadata of the directory.
+	if err := rt.renter.managedBubbleMetadata(context.Background(), subDir); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := rt.renter.managedCalculateDirectoryMetadata(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.NumStuckChunks != 3 {
+		t.Fatal("wrong number of stuck chunks", metadata.NumStuckChunks)
+	}
+	if metadata.AggregateNumStuckChunks != 4 {
+		t.Fatal("wrong aggregate number of stuck chunks", metadata.AggregateNumStuckChunks)
+	}
+}
+
+// TestEmptyDirModTime tests that the ModTime of an empty directory doesn't
+// change when the directory is bubbled and that it is updated when the last
+// file of the directory is deleted.
+func TestEmptyDirModTime(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create an empty directory.
+	dir := modules.RandomSiaPath()
+	if err := rt.renter.CreateDir(dir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	md, err := rt.renter.managedLoadDirMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime, aggregateModTime := md.ModTime, md.AggregateModTime
+	if modTime.IsZero() || aggregateModTime.IsZero() {
+		t.Fatal("new directory should have a ModTime")
+	}
+
+	// Bubble the directory a few times. The ModTime should stay the creation
+	// time.
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+			t.Fatal(err)
+		}
+		md, err := rt.renter.managedLoadDirMetadata(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !md.ModTime.Equal(modTime) || !md.AggregateModTime.Equal(aggregateModTime) {
+			t.Fatalf("ModTime changed from %v %v to %v %v", modTime, aggregateModTime, md.ModTime, md.AggregateModTime)
+		}
+	}
+
+	// Add a file to the directory and delete it again. The ModTime should be
+	// the time of the deletion rather than the ModTime of the deleted file.
+	siaPath, err := dir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	deleteTime := time.Now()
+	if err := rt.renter.staticFileSystem.DeleteFile(siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	md, err = rt.renter.managedLoadDirMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.ModTime.Before(deleteTime) || md.AggregateModTime.Before(deleteTime) {
+		t.Fatalf("ModTime %v %v is before the deletion at %v", md.ModTime, md.AggregateModTime, deleteTime)
+	}
+
+	// Bubbling the empty directory again shouldn't change the ModTime.
+	modTime, aggregateModTime = md.ModTime, md.AggregateModTime
+	time.Sleep(10 * time.Millisecond)
+	if err := rt.renter.managedBubbleMetadata(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	md, err = rt.renter.managedLoadDirMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.ModTime.Equal(modTime) || !md.AggregateModTime.Equal(aggregateModTime) {
+		t.Fatalf("ModTime changed from %v %v to %v %v", modTime, aggregateModTime, md.ModTime, md.AggregateModTime)
+	}
+}
+
+// TestDirLastHealthCheckTime tests that the LastHealthCheckTimes calculated
+// for a directory reflect its oldest file and child.
+func TestDirLastHealthCheckTime(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// An empty directory counts as checked just now.
+	dir := modules.RandomSiaPath()
+	if err := rt.renter.CreateDir(dir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	metadata, err := rt.renter.managedCalculateDirectoryMetadata(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.LastHealthCheckTime.Before(start) || metadata.AggregateLastHealthCheckTime.Before(start) {
+		t.Fatal("empty directory should have a current LastHealthCheckTime", metadata.LastHealthCheckTime, metadata.AggregateLastHealthCheckTime)
+	}
+
+	// Populate the directory with a fresh and a stale sub directory and a
+	// file.
+	freshCheckTime := time.Now()
+	staleCheckTime := freshCheckTime.AddDate(0, 0, -1)
+	for name, checkTime := range map[string]time.Time{"fresh": freshCheckTime, "stale": staleCheckTime} {
+		subDir, err := dir.Join(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rt.renter.CreateDir(subDir, modules.DefaultDirPerm); err != nil {
+			t.Fatal(err)
+		}
+		err = rt.openAndUpdateDir(subDir, siadir.Metadata{
+			AggregateLastHealthCheckTime: checkTime,
+			LastHealthCheckTime:          checkTime,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	siaPath, err := dir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The aggregate reflects the stale sub directory while the directory's own
+	// LastHealthCheckTime only reflects the freshly checked file.
+	start = time.Now()
+	metadata, err = rt.renter.managedCalculateDirectoryMetadata(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.AggregateLastHealthCheckTime.Equal(staleCheckTime) {
+		t.Fatalf("expected AggregateLastHealthCheckTime %v but got %v", staleCheckTime, metadata.AggregateLastHealthCheckTime)
+	}
+	if metadata.LastHealthCheckTime.Before(start) {
+		t.Fatal("LastHealthCheckTime should reflect the file", metadata.LastHealthCheckTime)
+	}
+}
+
 // TestOldestHealthCheckTime probes managedOldestHealthCheckTime to verify that
 // the directory with the oldest LastHealthCheckTime is returned
 func TestOldestHealthCheckTime(t *testing.T) {
@@ -403,7 +1226,7 @@ func TestOldestHealthCheckTime(t *testing.T) {
 
 	// Bubble the health of SubDir1 so that the oldest LastHealthCheckTime of
 	// SubDir1/SubDir2 gets bubbled up
-	rt.renter.managedBubbleMetadata(subDir1)
+	rt.renter.managedBubbleMetadata(context.Background(), subDir1)
 
 	// Find the oldest directory, should be SubDir1/SubDir2
 	build.Retry(100, 100*time.Millisecond, func() error {
@@ -414,8 +1237,141 @@ func TestOldestHealthCheckTime(t *testing.T) {
 		if dir.Equals(subDir1_2) {
 			return fmt.Errorf("Expected to find %v but found %v", subDir1_2.String(), dir.String())
 		}
-		if !lastCheck.Equal(oldestCheckTime) {
-			return fmt.Errorf("Expected to find time of %v but found %v", oldestCheckTime, lastCheck)
+		if !lastCheck.Equal(oldestCheckTime) {
+			return fmt.Errorf("Expected to find time of %v but found %v", oldestCheckTime, lastCheck)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOldestHealthCheckTimeExported verifies that the exported
+// OldestHealthCheckTime method returns the directory with the oldest
+// LastHealthCheckTime.
+func TestOldestHealthCheckTimeExported(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create test renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a directory with an old LastHealthCheckTime.
+	subDir, err := modules.NewSiaPath("SubDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir(subDir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	oldestCheckTime := time.Now().AddDate(0, 0, -1)
+	err = rt.openAndUpdateDir(subDir, siadir.Metadata{
+		Health:                       1,
+		LastHealthCheckTime:          oldestCheckTime,
+		AggregateLastHealthCheckTime: oldestCheckTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedBubbleMetadata(context.Background(), modules.RootSiaPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The exported method should return the same directory and time as the
+	// internal one.
+	dir, lastCheck, err := rt.renter.managedOldestHealthCheckTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportedDir, exportedLastCheck, err := rt.renter.OldestHealthCheckTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dir.Equals(exportedDir) || !lastCheck.Equal(exportedLastCheck) {
+		t.Fatalf("expected %v %v but got %v %v", dir, lastCheck, exportedDir, exportedLastCheck)
+	}
+}
+
+// TestNumFiles verifies that the number of files and aggregate number of files
+// is accurately reported
+func TestNumFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a test directory with sub folders
+	//
+	// root/ file
+	// root/SubDir1/
+	// root/SubDir1/SubDir2/ file
+
+	// Create test renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create directory tree
+	subDir1, err := modules.NewSiaPath("SubDir1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subDir2, err := modules.NewSiaPath("SubDir2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir(subDir1, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	subDir1_2, err := subDir1.Join(subDir2.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.CreateDir(subDir1_2, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	// Add files
+	rsc, _ := siafile.NewRSCode(1, 1)
+	up := modules.FileUploadParams{
+		Source:      "",
+		SiaPath:     modules.RandomSiaPath(),
+		ErasureCode: rsc,
+	}
+	err = rt.renter.staticFileSystem.NewSiaFile(up.SiaPath, up.Source, up.ErasureCode, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, up.DisablePartialChunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up.SiaPath, err = subDir1_2.Join(hex.EncodeToString(fastrand.Bytes(8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.staticFileSystem.NewSiaFile(up.SiaPath, up.Source, up.ErasureCode, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, up.DisablePartialChunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Call bubble on lowest lever and confirm top level reports accurate number
+	// of files and aggregate number of files
+	rt.renter.managedBubbleMetadata(context.Background(), subDir1_2)
+	build.Retry(100, 100*time.Millisecond, func() error {
+		dirInfo, err := rt.renter.staticFileSystem.DirInfo(modules.RootSiaPath())
+		if err != nil {
+			return err
+		}
+		if dirInfo.NumFiles != 1 {
+			return fmt.Errorf("NumFiles incorrect, got %v expected %v", dirInfo.NumFiles, 1)
+		}
+		if dirInfo.AggregateNumFiles != 2 {
+			return fmt.Errorf("AggregateNumFiles incorrect, got %v expected %v", dirInfo.AggregateNumFiles, 2)
 		}
 		return nil
 	})
@@ -424,9 +1380,9 @@ func TestOldestHealthCheckTime(t *testing.T) {
 	}
 }
 
-// TestNumFiles verifies that the number of files and aggregate number of files
-// is accurately reported
-func TestNumFiles(t *testing.T) {
+// TestNumUnfinishedFiles verifies that the number of unfinished files and
+// files without a local source are bubbled up correctly.
+func TestNumUnfinishedFiles(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
@@ -464,7 +1420,9 @@ func TestNumFiles(t *testing.T) {
 	if err := rt.renter.CreateDir(subDir1_2, modules.DefaultDirPerm); err != nil {
 		t.Fatal(err)
 	}
-	// Add files
+	// Add files. The file in the root has no local path at all while the
+	// file in SubDir2 is uploaded from a local file which is deleted
+	// afterwards.
 	rsc, _ := siafile.NewRSCode(1, 1)
 	up := modules.FileUploadParams{
 		Source:      "",
@@ -475,28 +1433,42 @@ func TestNumFiles(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	up.Source = filepath.Join(rt.dir, "source")
+	if err := ioutil.WriteFile(up.Source, fastrand.Bytes(100), 0600); err != nil {
+		t.Fatal(err)
+	}
 	up.SiaPath, err = subDir1_2.Join(hex.EncodeToString(fastrand.Bytes(8)))
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = rt.renter.staticFileSystem.NewSiaFile(up.SiaPath, up.Source, up.ErasureCode, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, up.DisablePartialChunk)
-	if err != nil {
+	if _, err := rt.renter.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(up.Source); err != nil {
 		t.Fatal(err)
 	}
 
-	// Call bubble on lowest lever and confirm top level reports accurate number
-	// of files and aggregate number of files
-	rt.renter.managedBubbleMetadata(subDir1_2)
-	build.Retry(100, 100*time.Millisecond, func() error {
+	// Call bubble on lowest level and confirm top level reports accurate number
+	// of unfinished files and files missing their local source
+	rt.renter.managedBubbleMetadata(context.Background(), subDir1_2)
+	err = build.Retry(100, 100*time.Millisecond, func() error {
 		dirInfo, err := rt.renter.staticFileSystem.DirInfo(modules.RootSiaPath())
 		if err != nil {
 			return err
 		}
-		if dirInfo.NumFiles != 1 {
-			return fmt.Errorf("NumFiles incorrect, got %v expected %v", dirInfo.NumFiles, 1)
+		// None of the files were uploaded so they should all be unfinished.
+		if dirInfo.NumUnfinishedFiles != 1 {
+			return fmt.Errorf("NumUnfinishedFiles incorrect, got %v expected %v", dirInfo.NumUnfinishedFiles, 1)
 		}
-		if dirInfo.AggregateNumFiles != 2 {
-			return fmt.Errorf("AggregateNumFiles incorrect, got %v expected %v", dirInfo.AggregateNumFiles, 2)
+		if dirInfo.AggregateNumUnfinishedFiles != 2 {
+			return fmt.Errorf("AggregateNumUnfinishedFiles incorrect, got %v expected %v", dirInfo.AggregateNumUnfinishedFiles, 2)
+		}
+		// Only the file whose local source was deleted is missing it.
+		if dirInfo.NumFilesMissingLocal != 0 {
+			return fmt.Errorf("NumFilesMissingLocal incorrect, got %v expected %v", dirInfo.NumFilesMissingLocal, 0)
+		}
+		if dirInfo.AggregateNumFilesMissingLocal != 1 {
+			return fmt.Errorf("AggregateNumFilesMissingLocal incorrect, got %v expected %v", dirInfo.AggregateNumFilesMissingLocal, 1)
 		}
 		return nil
 	})
@@ -567,7 +1539,7 @@ func TestDirectorySize(t *testing.T) {
 	}
 
 	// Call bubble on lowest lever and confirm top level reports accurate size
-	rt.renter.managedBubbleMetadata(subDir1_2)
+	rt.renter.managedBubbleMetadata(context.Background(), subDir1_2)
 	build.Retry(100, 100*time.Millisecond, func() error {
 		dirInfo, err := rt.renter.staticFileSystem.DirInfo(modules.RootSiaPath())
 		if err != nil {
@@ -650,7 +1622,7 @@ func TestDirectoryModTime(t *testing.T) {
 
 	// Call bubble on lowest lever and confirm top level reports accurate last
 	// update time
-	rt.renter.managedBubbleMetadata(subDir1_2)
+	rt.renter.managedBubbleMetadata(context.Background(), subDir1_2)
 	build.Retry(100, 100*time.Millisecond, func() error {
 		dirInfo, err := rt.renter.staticFileSystem.DirInfo(modules.RootSiaPath())
 		if err != nil {
@@ -766,7 +1738,7 @@ func TestRandomStuckDirectory(t *testing.T) {
 	// but the repair loop could have marked the rest as stuck so we just want
 	// to ensure that the root directory reflects at least the 3 we marked as
 	// stuck
-	rt.renter.managedBubbleMetadata(subDir1_2)
+	rt.renter.managedBubbleMetadata(context.Background(), subDir1_2)
 	err = build.Retry(100, 100*time.Millisecond, func() error {
 		// Get Root Directory Metadata
 		metadata, err := rt.renter.managedDirectoryMetadata(modules.RootSiaPath())
@@ -875,7 +1847,7 @@ func TestRandomStuckFile(t *testing.T) {
 
 	// Since we disabled the health loop for this test, call it manually to
 	// update the directory metadata
-	err = rt.renter.managedBubbleMetadata(modules.UserSiaPath())
+	err = rt.renter.managedBubbleMetadata(context.Background(), modules.UserSiaPath())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -883,7 +1855,7 @@ func TestRandomStuckFile(t *testing.T) {
 	build.Retry(100, 100*time.Millisecond, func() error {
 		i++
 		if i%10 == 0 {
-			err = rt.renter.managedBubbleMetadata(modules.RootSiaPath())
+			err = rt.renter.managedBubbleMetadata(context.Background(), modules.RootSiaPath())
 			if err != nil {
 				return err
 			}
@@ -940,7 +1912,7 @@ func TestRandomStuckFile(t *testing.T) {
 	}
 	// Since we disabled the health loop for this test, call it manually to
 	// update the directory metadata
-	err = rt.renter.managedBubbleMetadata(dir)
+	err = rt.renter.managedBubbleMetadata(context.Background(), dir)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -948,7 +1920,7 @@ func TestRandomStuckFile(t *testing.T) {
 	build.Retry(100, 100*time.Millisecond, func() error {
 		i++
 		if i%10 == 0 {
-			err = rt.renter.managedBubbleMetadata(dir)
+			err = rt.renter.managedBubbleMetadata(context.Background(), dir)
 			if err != nil {
 				return err
 			}
@@ -1056,7 +2028,8 @@ func TestCalculateFileMetadata(t *testing.T) {
 	modTime := sf.ModTime()
 
 	// Check calculated metadata
-	fileMetadata, err := rt.renter.managedCalculateAndUpdateFileMetadata(up.SiaPath)
+	offline, goodForRenew, contracts := rt.renter.managedContractUtilityMaps()
+	fileMetadata, err := rt.renter.managedCalculateAndUpdateFileMetadata(up.SiaPath, offline, goodForRenew, make(map[string]float64), contracts)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1087,6 +2060,106 @@ func TestCalculateFileMetadata(t *testing.T) {
 	}
 }
 
+// TestCalculateFileMetadataCached checks that managedCalculateFileMetadata
+// reuses the cached health of a file only as long as neither the file nor the
+// utilities of its hosts changed.
+func TestCalculateFileMetadataCached(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create renter
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file with a single piece on a good host.
+	rsc, _ := siafile.NewRSCode(1, 1)
+	siaPath := modules.RandomSiaPath()
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	hostKey := types.SiaPublicKey{Key: fastrand.Bytes(32)}
+	if err := sf.AddPiece(hostKey, 0, 0, crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	offline := map[string]bool{hostKey.String(): false}
+	goodForRenew := map[string]bool{hostKey.String(): true}
+	uptime := make(map[string]float64)
+	contracts := make(map[string]modules.RenterContract)
+	utilityHash := hostUtilityHash(sf.HostPublicKeys(), offline, goodForRenew, uptime)
+
+	// The first calculation can't use the cache.
+	if _, cached := sf.CachedHealthMetadata(utilityHash); cached {
+		t.Fatal("health shouldn't be cached yet")
+	}
+	md, err := rt.renter.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, cached := sf.CachedHealthMetadata(utilityHash); !cached {
+		t.Fatal("health should be cached")
+	}
+
+	// Calculating again should return the same values.
+	md2, err := rt.renter.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Health != md2.Health || md.StuckHealth != md2.StuckHealth || md.Redundancy != md2.Redundancy || md.EffectiveRedundancy != md2.EffectiveRedundancy {
+		t.Fatal("cached metadata doesn't match", md, md2)
+	}
+
+	// If the host goes offline, the health needs to be recalculated.
+	offline[hostKey.String()] = true
+	if _, cached := sf.CachedHealthMetadata(hostUtilityHash(sf.HostPublicKeys(), offline, goodForRenew, uptime)); cached {
+		t.Fatal("health shouldn't be cached for changed utilities")
+	}
+	md2, err = rt.renter.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md2.Redundancy >= md.Redundancy {
+		t.Fatalf("redundancy should have dropped: %v >= %v", md2.Redundancy, md.Redundancy)
+	}
+
+	// Marking a chunk as stuck invalidates the cache.
+	offline[hostKey.String()] = false
+	if _, err := rt.renter.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.SetStuck(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, cached := sf.CachedHealthMetadata(utilityHash); cached {
+		t.Fatal("health shouldn't be cached after marking a chunk as stuck")
+	}
+	md2, err = rt.renter.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md2.NumStuckChunks != 1 || md2.StuckHealth == 0 {
+		t.Fatal("stuck chunk wasn't taken into account", md2)
+	}
+
+	// Adding a piece invalidates the cache.
+	if err := sf.AddPiece(hostKey, 0, 1, crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, cached := sf.CachedHealthMetadata(utilityHash); cached {
+		t.Fatal("health shouldn't be cached after adding a piece")
+	}
+}
+
 // TestCreateMissingSiaDir confirms that the repair code creates a siadir file
 // if one is not found
 func TestCreateMissingSiaDir(t *testing.T) {
@@ -1181,7 +2254,7 @@ func TestAddStuckChunksToHeap(t *testing.T) {
 	}
 
 	// call managedAddStuckChunksToHeap, no chunks should be added
-	err = rt.renter.managedAddStuckChunksToHeap(up.SiaPath, hosts, offline, goodForRenew)
+	err = rt.renter.managedAddStuckChunksToHeap(up.SiaPath, hosts, offline, goodForRenew, nil)
 	if err != errNoStuckChunks {
 		t.Fatal(err)
 	}
@@ -1195,7 +2268,7 @@ func TestAddStuckChunksToHeap(t *testing.T) {
 	}
 
 	// call managedAddStuckChunksToHeap, chunk should be added to heap
-	err = rt.renter.managedAddStuckChunksToHeap(up.SiaPath, hosts, offline, goodForRenew)
+	err = rt.renter.managedAddStuckChunksToHeap(up.SiaPath, hosts, offline, goodForRenew, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1263,3 +2336,322 @@ func TestRandomStuckFileRegression(t *testing.T) {
 		t.Fatalf("Stuck siapath should have been the one file in the directory, expected %v got %v", siaPath, stuckSiaPath)
 	}
 }
+
+// TestCalculateFileMetadataDiskWriteError tests that the metadata of a file is
+// still returned if it can't be written to disk and that the renter reports
+// the failed write.
+func TestCalculateFileMetadataDiskWriteError(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file in a subdirectory and keep it open to keep it in memory.
+	rsc, _ := siafile.NewRSCode(1, 1)
+	siaPath, err := modules.NewSiaPath("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+
+	// Create another file in the root directory.
+	otherSiaPath := modules.RandomSiaPath()
+	err = rt.renter.staticFileSystem.NewSiaFile(otherSiaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, goodForRenew, uptime, contracts := rt.renter.managedFileMetadataMaps()
+	if _, err := rt.renter.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts); err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.DiskWriteError() {
+		t.Fatal("renter shouldn't report a disk write error")
+	}
+
+	// Replace the directory on disk with a regular file to make writing the
+	// siafile fail.
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirPath := rt.renter.staticFileSystem.DirPath(dirSiaPath)
+	if err := os.Rename(dirPath, dirPath+"_moved"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata should still be returned and the error reported.
+	md, err := rt.renter.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.UID != sf.UID() || md.Size != 100 {
+		t.Fatal("wrong metadata returned", md)
+	}
+	if !rt.renter.DiskWriteError() {
+		t.Fatal("renter should report a disk write error")
+	}
+
+	// A successful write of another file shouldn't clear the error.
+	if _, err := rt.renter.managedCalculateAndUpdateFileMetadata(otherSiaPath, offline, goodForRenew, uptime, contracts); err != nil {
+		t.Fatal(err)
+	}
+	if !rt.renter.DiskWriteError() {
+		t.Fatal("renter should still report a disk write error")
+	}
+
+	// Restore the directory. The next successful write of the file should
+	// clear the error.
+	if err := os.Remove(dirPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(dirPath+"_moved", dirPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.managedCalculateAndUpdateFileMetadata(siaPath, offline, goodForRenew, uptime, contracts); err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.DiskWriteError() {
+		t.Fatal("renter shouldn't report a disk write error")
+	}
+}
+
+// TestMetadataWriteRate tests that managedWaitForMetadataWrite limits the
+// metadata writes to the rate set with SetMetadataWriteRate.
+func TestMetadataWriteRate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// By default the writes aren't limited.
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := rt.renter.managedWaitForMetadataWrite(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("unlimited writes were delayed", time.Since(start))
+	}
+
+	// With a rate of 10 writes per second, 11 writes take at least a second.
+	if err := rt.renter.SetMetadataWriteRate(10); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	for i := 0; i < 11; i++ {
+		if err := rt.renter.managedWaitForMetadataWrite(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatal("writes weren't limited", elapsed)
+	}
+
+	// Removing the limit again should take effect immediately.
+	if err := rt.renter.SetMetadataWriteRate(0); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	if err := rt.renter.managedWaitForMetadataWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("unlimited write was delayed", time.Since(start))
+	}
+}
+
+// TestBubbleFileWorkers tests that the number of threads used to calculate the
+// metadata of the siafiles within a directory can be configured.
+func TestBubbleFileWorkers(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// The default is used initially.
+	if numWorkers := rt.renter.managedBubbleFileWorkers(); numWorkers != defaultBubbleFileWorkers {
+		t.Fatalf("expected %v workers but got %v", defaultBubbleFileWorkers, numWorkers)
+	}
+
+	// Set a different number of workers.
+	if err := rt.renter.SetBubbleFileWorkers(2); err != nil {
+		t.Fatal(err)
+	}
+	if numWorkers := rt.renter.managedBubbleFileWorkers(); numWorkers != 2 {
+		t.Fatalf("expected %v workers but got %v", 2, numWorkers)
+	}
+
+	// Bubbling still works with the new number of workers.
+	if err := rt.renter.managedBubbleMetadata(context.Background(), modules.RootSiaPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Too many workers are rejected.
+	if err := rt.renter.SetBubbleFileWorkers(maxBubbleFileWorkers + 1); err == nil {
+		t.Fatal("expected error for too many workers")
+	}
+
+	// 0 resets the number of workers to the default.
+	if err := rt.renter.SetBubbleFileWorkers(0); err != nil {
+		t.Fatal(err)
+	}
+	if numWorkers := rt.renter.managedBubbleFileWorkers(); numWorkers != defaultBubbleFileWorkers {
+		t.Fatalf("expected %v workers but got %v", defaultBubbleFileWorkers, numWorkers)
+	}
+}
+
+// TestRepairHealth tests that the repair loop sees files on flaky hosts as less
+// healthy, only considers cold files once they reach the cold repair threshold
+// and boosts files approaching their upload deadline.
+func TestRepairHealth(t *testing.T) {
+	deadline := time.Now().Add(uploadDeadlineWindow / 2)
+	tests := []struct {
+		md       siafile.BubbledMetadata
+		expected float64
+	}{
+		{siafile.BubbledMetadata{Health: 0.5}, 0.5},
+		{siafile.BubbledMetadata{Health: 0.5, Cold: true}, 0},
+		{siafile.BubbledMetadata{Health: ColdRepairThreshold, Cold: true}, ColdRepairThreshold},
+		{siafile.BubbledMetadata{Health: 1.5, Cold: true}, 1.5},
+		{siafile.BubbledMetadata{Health: 0, EffectiveRedundancy: 2, TargetRedundancy: 3}, 0},
+		{siafile.BubbledMetadata{Health: 0.25, EffectiveRedundancy: 2.5, TargetRedundancy: 3}, 0.25},
+		{siafile.BubbledMetadata{Health: 0.25, EffectiveRedundancy: 2, TargetRedundancy: 3}, 0.5},
+		{siafile.BubbledMetadata{Health: 0.25, EffectiveRedundancy: 2, TargetRedundancy: 3, Cold: true}, 0},
+		{siafile.BubbledMetadata{Health: 0.1, UploadDeadline: deadline}, 1},
+		{siafile.BubbledMetadata{Health: 0.1, UploadDeadline: deadline, Cold: true}, 1},
+		{siafile.BubbledMetadata{Health: 1.5, UploadDeadline: deadline}, 1.5},
+		{siafile.BubbledMetadata{Health: 0, UploadDeadline: deadline}, 0},
+		{siafile.BubbledMetadata{Health: 0.1, UploadDeadline: time.Now().Add(-time.Second)}, 0.1},
+	}
+	for _, test := range tests {
+		if health := repairHealth(test.md); health != test.expected {
+			t.Fatalf("%v: expected %v but got %v", test.md, test.expected, health)
+		}
+	}
+}
+
+// TestUploadDeadlineAlert tests that an alert is registered for files which
+// didn't reach their target redundancy before their upload deadline.
+func TestUploadDeadlineAlert(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	now := time.Now()
+	tests := []struct {
+		md       siafile.BubbledMetadata
+		expected bool
+	}{
+		{siafile.BubbledMetadata{Redundancy: 0.5, TargetRedundancy: 2}, false},
+		{siafile.BubbledMetadata{Redundancy: 0.5, TargetRedundancy: 2, UploadDeadline: now.Add(time.Hour)}, false},
+		{siafile.BubbledMetadata{Redundancy: 0.5, TargetRedundancy: 2, UploadDeadline: now}, true},
+		{siafile.BubbledMetadata{Redundancy: 2, TargetRedundancy: 2, UploadDeadline: now.Add(-time.Hour)}, false},
+	}
+	for _, test := range tests {
+		if missed := missedUploadDeadline(test.md, now); missed != test.expected {
+			t.Fatalf("%v: expected %v but got %v", test.md, test.expected, missed)
+		}
+	}
+
+	// Create a file without hosts whose deadline already passed.
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rsc, _ := siafile.NewRSCode(1, 1)
+	siaPath := modules.RandomSiaPath()
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = errors.Compose(sf.SetUploadDeadline(now.Add(-time.Minute)), sf.Close())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bubble should register the alert.
+	hasAlert := func() bool {
+		for _, alert := range rt.renter.Alerts() {
+			if alert.Msg == AlertMSGSiafileUploadDeadline {
+				return true
+			}
+		}
+		return false
+	}
+	rt.renter.managedBubbleMetadata(context.Background(), modules.RootSiaPath())
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if !hasAlert() {
+			return errors.New("upload deadline alert wasn't registered")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFileRepairThreshold tests that cold files use a higher repair threshold
+// than regular files.
+func TestFileRepairThreshold(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.SetRepairThreshold(MaxRepairThreshold); err != nil {
+		t.Fatal(err)
+	}
+	if threshold := rt.renter.managedFileRepairThreshold(false); threshold != MaxRepairThreshold {
+		t.Fatal("wrong threshold for regular files", threshold)
+	}
+	if threshold := rt.renter.managedFileRepairThreshold(true); threshold != ColdRepairThreshold {
+		t.Fatal("wrong threshold for cold files", threshold)
+	}
+}
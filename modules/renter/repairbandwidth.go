@@ -0,0 +1,99 @@
+package renter
+
+// repairbandwidth.go limits the bandwidth used by the repair loop. Once a
+// chunk which restores the redundancy of already uploaded data is dispatched,
+// the repair loop reserves the time it takes to upload the chunk's missing
+// pieces at the configured limit and the next repair waits for that time to
+// pass. Chunks of new uploads and streams aren't limited.
+
+import (
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// SetRepairBandwidthLimit sets the maximum number of bytes uploaded by repairs
+// per repairBandwidthInterval. This prevents repairs from saturating the
+// renter's connection. A limit of 0 removes the limit.
+func (r *Renter) SetRepairBandwidthLimit(bytesPerInterval uint64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.RepairBandwidthLimit = bytesPerInterval
+	return r.saveSync()
+}
+
+// repairBandwidth returns the number of bytes uploaded by repairing the chunk.
+// Chunks which aren't repairs don't count towards the repair bandwidth.
+func repairBandwidth(uuc *unfinishedUploadChunk) uint64 {
+	if uuc.priority || !uuc.repair || uuc.piecesCompleted >= uuc.piecesNeeded {
+		return 0
+	}
+	return uint64(uuc.piecesNeeded-uuc.piecesCompleted) * modules.SectorSize
+}
+
+// repairBandwidthDelay returns the time it takes to upload bytes at a rate of
+// limit bytes per repairBandwidthInterval.
+func repairBandwidthDelay(bytes, limit uint64) time.Duration {
+	return time.Duration(float64(repairBandwidthInterval) * float64(bytes) / float64(limit))
+}
+
+// managedRepairBandwidthLimit returns the repair bandwidth limit which applies
+// to the chunk and the number of bytes the chunk's repair uploads. A limit of
+// 0 means that the chunk isn't limited.
+func (r *Renter) managedRepairBandwidthLimit(uuc *unfinishedUploadChunk) (limit, bandwidth uint64) {
+	bandwidth = repairBandwidth(uuc)
+	if bandwidth == 0 {
+		return 0, 0
+	}
+	id := r.mu.RLock()
+	limit = r.persist.RepairBandwidthLimit
+	r.mu.RUnlock(id)
+	return limit, bandwidth
+}
+
+// managedWaitForRepairBandwidth blocks until the repair loop is allowed to
+// repair the chunk according to the configured repair bandwidth limit.
+func (r *Renter) managedWaitForRepairBandwidth(uuc *unfinishedUploadChunk) error {
+	if limit, _ := r.managedRepairBandwidthLimit(uuc); limit == 0 {
+		return nil
+	}
+	r.nextRepairMu.Lock()
+	wait := time.Until(r.nextRepair)
+	r.nextRepairMu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-r.tg.StopChan():
+		return errors.New("repair interrupted by stop call")
+	}
+}
+
+// managedReserveRepairBandwidth reserves the time it takes to repair the chunk
+// after it was dispatched. The reservations never reach further than one
+// repairBandwidthInterval into the future, which prevents a burst of repairs
+// from delaying the repair loop indefinitely.
+func (r *Renter) managedReserveRepairBandwidth(uuc *unfinishedUploadChunk) {
+	limit, bandwidth := r.managedRepairBandwidthLimit(uuc)
+	if limit == 0 {
+		return
+	}
+	r.nextRepairMu.Lock()
+	defer r.nextRepairMu.Unlock()
+	now := time.Now()
+	if r.nextRepair.Before(now) {
+		r.nextRepair = now
+	}
+	r.nextRepair = r.nextRepair.Add(repairBandwidthDelay(bandwidth, limit))
+	if max := now.Add(repairBandwidthInterval); r.nextRepair.After(max) {
+		r.nextRepair = max
+	}
+}
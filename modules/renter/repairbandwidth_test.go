@@ -0,0 +1,122 @@
+package renter
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// TestRepairBandwidth tests which chunks count towards the repair bandwidth.
+func TestRepairBandwidth(t *testing.T) {
+	tests := []struct {
+		uuc       *unfinishedUploadChunk
+		bandwidth uint64
+	}{
+		// New uploads aren't repairs.
+		{&unfinishedUploadChunk{piecesNeeded: 3}, 0},
+		// Neither are streams.
+		{&unfinishedUploadChunk{piecesNeeded: 3, piecesCompleted: 1, priority: true, repair: true}, 0},
+		// Complete chunks don't need any bandwidth.
+		{&unfinishedUploadChunk{piecesNeeded: 3, piecesCompleted: 3, repair: true}, 0},
+		// Repairs upload the missing pieces.
+		{&unfinishedUploadChunk{piecesNeeded: 3, piecesCompleted: 1, repair: true}, 2 * modules.SectorSize},
+		// Even if none of the pieces are available anymore.
+		{&unfinishedUploadChunk{piecesNeeded: 3, repair: true}, 3 * modules.SectorSize},
+	}
+	for i, test := range tests {
+		if bandwidth := repairBandwidth(test.uuc); bandwidth != test.bandwidth {
+			t.Errorf("%v: expected %v but got %v", i, test.bandwidth, bandwidth)
+		}
+	}
+	if delay := repairBandwidthDelay(modules.SectorSize, 4*modules.SectorSize); delay != repairBandwidthInterval/4 {
+		t.Fatal("wrong delay", delay)
+	}
+}
+
+// TestWaitForRepairBandwidth tests that the repair loop is slowed down to the
+// repair bandwidth limit.
+func TestWaitForRepairBandwidth(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Without a limit repairs aren't delayed.
+	repair := &unfinishedUploadChunk{piecesNeeded: 3, piecesCompleted: 2, repair: true}
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := r.managedWaitForRepairBandwidth(repair); err != nil {
+			t.Fatal(err)
+		}
+		r.managedReserveRepairBandwidth(repair)
+	}
+	if time.Since(start) > repairBandwidthInterval/4 {
+		t.Fatal("repairs were delayed without a limit")
+	}
+
+	// Limit the repairs to 4 chunks per interval.
+	if err := r.SetRepairBandwidthLimit(4 * modules.SectorSize); err != nil {
+		t.Fatal(err)
+	}
+	id := r.mu.RLock()
+	limit := r.persist.RepairBandwidthLimit
+	r.mu.RUnlock(id)
+	if limit != 4*modules.SectorSize {
+		t.Fatal("limit wasn't set", limit)
+	}
+
+	// Chunks which aren't dispatched don't reserve any bandwidth.
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		if err := r.managedWaitForRepairBandwidth(repair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) > repairBandwidthInterval/4 {
+		t.Fatal("repairs were delayed without being dispatched")
+	}
+
+	// The first chunk is repaired right away while the following ones have to
+	// wait.
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if err := r.managedWaitForRepairBandwidth(repair); err != nil {
+			t.Fatal(err)
+		}
+		r.managedReserveRepairBandwidth(repair)
+	}
+	if elapsed := time.Since(start); elapsed < repairBandwidthInterval/2 {
+		t.Fatal("repairs weren't delayed", elapsed)
+	}
+
+	// Reservations never reach further than one interval into the future.
+	for i := 0; i < 100; i++ {
+		r.managedReserveRepairBandwidth(repair)
+	}
+	r.nextRepairMu.Lock()
+	wait := time.Until(r.nextRepair)
+	r.nextRepairMu.Unlock()
+	if wait > repairBandwidthInterval {
+		t.Fatal("reservations weren't clamped", wait)
+	}
+
+	// New uploads aren't limited.
+	start = time.Now()
+	upload := &unfinishedUploadChunk{piecesNeeded: 3}
+	for i := 0; i < 10; i++ {
+		if err := r.managedWaitForRepairBandwidth(upload); err != nil {
+			t.Fatal(err)
+		}
+		r.managedReserveRepairBandwidth(upload)
+	}
+	if time.Since(start) > repairBandwidthInterval/4 {
+		t.Fatal("uploads were delayed")
+	}
+}
@@ -0,0 +1,115 @@
+package renter
+
+// safedelete.go implements the checks for whether the local source of a file
+// can be deleted. A common workflow is to upload a file and to reclaim the
+// space of the local copy once the upload is done. Since the redundancy of a
+// file only reflects the state of its hosts at a given time, the user can
+// configure a safe redundancy which needs to be reached before the local source
+// is considered safe to delete. Optionally the health loop deletes local
+// sources automatically once their file reached that redundancy.
+
+import (
+	"os"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+)
+
+// errSafeRedundancyTooLow is returned by SetSafeRedundancy if the redundancy
+// wouldn't allow for recovering the file without its local source.
+var errSafeRedundancyTooLow = errors.New("safe redundancy must be at least 1")
+
+// SetSafeRedundancy sets the redundancy a file needs to reach before its local
+// source is considered safe to delete. If autoDelete is true, local sources are
+// deleted automatically once their file reached that redundancy.
+func (r *Renter) SetSafeRedundancy(redundancy float64, autoDelete bool) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if redundancy < 1 {
+		return errSafeRedundancyTooLow
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.SafeRedundancy = redundancy
+	r.persist.AutoDeleteSources = autoDelete
+	return r.saveSync()
+}
+
+// managedSafeRedundancy returns the safe redundancy and whether local sources
+// are deleted automatically once it is reached.
+func (r *Renter) managedSafeRedundancy() (float64, bool) {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	redundancy := r.persist.SafeRedundancy
+	if redundancy == 0 {
+		redundancy = defaultSafeRedundancy
+	}
+	return redundancy, r.persist.AutoDeleteSources
+}
+
+// SafeToDeleteSource returns whether the file at siaPath reached the safe
+// redundancy at which its local source can be deleted, together with the
+// current redundancy of the file.
+func (r *Renter) SafeToDeleteSource(siaPath modules.SiaPath) (bool, float64, error) {
+	if err := r.tg.Add(); err != nil {
+		return false, 0, err
+	}
+	defer r.tg.Done()
+	sf, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return false, 0, err
+	}
+	defer sf.Close()
+	offline, goodForRenew, _ := r.managedContractUtilityMaps()
+	redundancy, _, err := sf.Redundancy(offline, goodForRenew)
+	if err != nil {
+		return false, 0, errors.AddContext(err, "failed to compute redundancy")
+	}
+	safeRedundancy, _ := r.managedSafeRedundancy()
+	return redundancy >= safeRedundancy, redundancy, nil
+}
+
+// managedMaybeDeleteSource deletes the local source of sf if the automatic
+// deletion of local sources is enabled and the file reached the safe
+// redundancy. The source is only deleted if its size and modification time
+// still match the ones recorded at upload, since a modified source isn't a
+// copy of the uploaded data anymore. It returns whether the local source was
+// deleted.
+func (r *Renter) managedMaybeDeleteSource(siaPath modules.SiaPath, sf *filesystem.FileNode, redundancy float64) bool {
+	safeRedundancy, autoDelete := r.managedSafeRedundancy()
+	if !autoDelete || redundancy < safeRedundancy {
+		return false
+	}
+	localPath := sf.LocalPath()
+	if localPath == "" {
+		return false
+	}
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			r.log.Println("WARN: failed to stat local source:", err)
+		}
+		return false
+	}
+	if uint64(fi.Size()) != sf.LogicalSize() || !fi.ModTime().Equal(sf.LocalModTime()) {
+		r.log.Debugf("Not deleting local source %v of %v since it changed after the upload", localPath, siaPath)
+		return false
+	}
+	if err := os.Remove(localPath); err != nil {
+		if !os.IsNotExist(err) {
+			r.log.Println("WARN: failed to delete local source:", err)
+		}
+		return false
+	}
+	r.log.Printf("Deleted local source %v of %v at a redundancy of %.2f", localPath, siaPath, redundancy)
+
+	// The file can't be repaired from the local source anymore.
+	if err := sf.SetLocalPath(""); err != nil {
+		r.log.Println("WARN: failed to clear the local path of the file:", err)
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package renter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestSafeToDeleteSource tests the safe redundancy setting and the automatic
+// deletion of local sources.
+func TestSafeToDeleteSource(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file with a local source.
+	source := filepath.Join(rt.dir, "source")
+	if err := ioutil.WriteFile(source, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, source, rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 4, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without any hosts the file isn't safe.
+	safe, _, err := rt.renter.SafeToDeleteSource(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if safe {
+		t.Fatal("file without hosts shouldn't be safe to delete")
+	}
+	if _, _, err := rt.renter.SafeToDeleteSource(modules.RandomSiaPath()); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+
+	// The safe redundancy needs to allow for recovering the file.
+	if err := rt.renter.SetSafeRedundancy(0.5, true); err != errSafeRedundancyTooLow {
+		t.Fatal("expected errSafeRedundancyTooLow but got", err)
+	}
+	if redundancy, autoDelete := rt.renter.managedSafeRedundancy(); redundancy != defaultSafeRedundancy || autoDelete {
+		t.Fatal("wrong default settings", redundancy, autoDelete)
+	}
+
+	// Without the automatic deletion the source is kept.
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.managedMaybeDeleteSource(siaPath, sf, 3) {
+		t.Fatal("source shouldn't be deleted if the automatic deletion is disabled")
+	}
+
+	// Enable the automatic deletion. The source is only deleted once the
+	// safe redundancy is reached.
+	if err := rt.renter.SetSafeRedundancy(2.5, true); err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.managedMaybeDeleteSource(siaPath, sf, 2) {
+		t.Fatal("source shouldn't be deleted below the safe redundancy")
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source is kept if it doesn't match the modification time recorded
+	// at upload.
+	if rt.renter.managedMaybeDeleteSource(siaPath, sf, 2.5) {
+		t.Fatal("source shouldn't be deleted if it changed after the upload")
+	}
+	fi, err := os.Stat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.SetLocalModTime(fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source is kept if its size changed.
+	if err := ioutil.WriteFile(source, []byte("more data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(source, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.managedMaybeDeleteSource(siaPath, sf, 2.5) {
+		t.Fatal("source shouldn't be deleted if its size changed")
+	}
+
+	// Restore the source. It should be deleted at the safe redundancy and the
+	// local path of the file should be cleared.
+	if err := ioutil.WriteFile(source, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(source, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if !rt.renter.managedMaybeDeleteSource(siaPath, sf, 2.5) {
+		t.Fatal("source should be deleted at the safe redundancy")
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Fatal("source wasn't deleted", err)
+	}
+	if sf.LocalPath() != "" {
+		t.Fatal("local path wasn't cleared", sf.LocalPath())
+	}
+
+	if err := sf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The settings should persist.
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rt.renter, err = newRenterWithDependency(rt.gateway, rt.cs, rt.wallet, rt.tpool, filepath.Join(rt.dir, modules.RenterDir), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redundancy, autoDelete := rt.renter.managedSafeRedundancy(); redundancy != 2.5 || !autoDelete {
+		t.Fatal("settings weren't persisted", redundancy, autoDelete)
+	}
+}
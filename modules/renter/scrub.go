@@ -0,0 +1,194 @@
+package renter
+
+// scrub.go implements the periodic scrubbing of files. While the health of a
+// file only reflects whether its hosts are online, a scrub downloads every
+// piece of a random chunk of the file from the host storing it and checks the
+// data against the Merkle root stored in the siafile. This detects hosts which
+// return corrupt data before the user needs the file. Scrubbing is enabled per
+// directory by setting a scrub interval which also applies to all of its
+// subdirectories that don't set their own interval. The result is recorded in
+// the LastScrubTime, ScrubFailed and ScrubFailedHosts fields of the siafile
+// and bubbled up as NumFilesScrubFailed. Pieces which can't be downloaded,
+// e.g. because the host is offline, don't count as failures.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/proto"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// threadedScrubLoop periodically walks the directory tree and scrubs the files
+// which are due for a scrub.
+func (r *Renter) threadedScrubLoop() {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+	for {
+		select {
+		case <-r.tg.StopChan():
+			return
+		case <-time.After(scrubCheckInterval):
+		}
+		if err := r.managedScrubDir(modules.RootSiaPath(), 0); err != nil {
+			r.log.Println("WARN: failed to scrub files:", err)
+		}
+	}
+}
+
+// managedScrubDir scrubs the files of a directory and its subdirectories which
+// weren't scrubbed within their scrub interval. inherited is the scrub interval
+// of the nearest ancestor which sets one. The directory is bubbled if any of
+// its files were scrubbed.
+func (r *Renter) managedScrubDir(siaPath modules.SiaPath, inherited time.Duration) error {
+	select {
+	case <-r.tg.StopChan():
+		return errors.New("renter shut down before the scrub finished")
+	default:
+	}
+	md, err := r.managedLoadDirMetadata(siaPath)
+	if err != nil {
+		return errors.AddContext(err, fmt.Sprintf("failed to load metadata of %v", siaPath))
+	}
+	interval := inherited
+	if md.ScrubInterval > 0 {
+		interval = md.ScrubInterval
+	}
+	fis, err := ioutil.ReadDir(siaPath.SiaDirSysPath(r.staticFileSystem.Root()))
+	if err != nil {
+		return errors.AddContext(err, fmt.Sprintf("failed to read directory %v", siaPath))
+	}
+	scrubbed := false
+	for _, fi := range fis {
+		ext := filepath.Ext(fi.Name())
+		if !fi.IsDir() && ext != modules.SiaFileExtension {
+			continue
+		}
+		childSiaPath, err := siaPath.Join(strings.TrimSuffix(fi.Name(), modules.SiaFileExtension))
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			// Files in the trash aren't scrubbed.
+			if isTrashPath(childSiaPath) {
+				continue
+			}
+			if err := r.managedScrubDir(childSiaPath, interval); err != nil {
+				return err
+			}
+			continue
+		}
+		if interval == 0 {
+			continue
+		}
+		ok, err := r.managedMaybeScrubFile(childSiaPath, interval)
+		if err != nil {
+			r.log.Printf("WARN: failed to scrub %v: %v", childSiaPath, err)
+		}
+		scrubbed = scrubbed || ok
+	}
+	if scrubbed {
+		r.managedQueueBubble(siaPath)
+	}
+	return nil
+}
+
+// managedMaybeScrubFile scrubs the file if it wasn't scrubbed within interval.
+// It returns whether the result of a scrub was recorded.
+func (r *Renter) managedMaybeScrubFile(siaPath modules.SiaPath, interval time.Duration) (bool, error) {
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return false, err
+	}
+	defer entry.Close()
+	if time.Since(entry.LastScrubTime()) < interval {
+		return false, nil
+	}
+	numChunks := verifiableChunks(entry)
+	if numChunks == 0 {
+		return false, nil
+	}
+	chunkIndex := fastrand.Uint64n(numChunks)
+	failedHosts, checked, err := r.managedScrubChunk(entry, chunkIndex)
+	if err != nil {
+		return false, errors.AddContext(err, fmt.Sprintf("failed to scrub chunk %v", chunkIndex))
+	}
+	// Only record the scrub if any of the pieces could be checked.
+	if checked == 0 {
+		r.repairLog.Printf("Scrub of chunk %v of %s couldn't be completed, no pieces could be downloaded", chunkIndex, siaPath)
+		return false, nil
+	}
+	if len(failedHosts) > 0 {
+		r.repairLog.Printf("Scrub of chunk %v of %s failed, hosts %v returned bad data", chunkIndex, siaPath, failedHosts)
+	}
+	if err := entry.SetScrubResult(failedHosts); err != nil {
+		return false, errors.AddContext(err, "failed to record scrub result")
+	}
+	return true, nil
+}
+
+// managedScrubChunk downloads every piece of the chunk from the host storing
+// it and checks it against the Merkle root stored in the siafile. It returns
+// the hosts which returned bad data and the number of pieces which were
+// checked. Pieces which can't be downloaded are skipped.
+func (r *Renter) managedScrubChunk(entry *filesystem.FileNode, chunkIndex uint64) ([]types.SiaPublicKey, int, error) {
+	pieces, err := entry.Pieces(chunkIndex)
+	if err != nil {
+		return nil, 0, errors.AddContext(err, "failed to get pieces of chunk")
+	}
+	var failedHosts []types.SiaPublicKey
+	var checked int
+	for _, pieceSet := range pieces {
+		for _, piece := range pieceSet {
+			select {
+			case <-r.tg.StopChan():
+				return nil, 0, errors.New("renter shut down before the scrub finished")
+			default:
+			}
+			bad, err := r.managedScrubPiece(piece.HostPubKey, piece.MerkleRoot)
+			if err != nil {
+				r.repairLog.Debugf("Unable to scrub piece on host %v: %v", piece.HostPubKey, err)
+				continue
+			}
+			checked++
+			if bad {
+				failedHosts = append(failedHosts, piece.HostPubKey)
+			}
+		}
+	}
+	return failedHosts, checked, nil
+}
+
+// managedScrubPiece downloads the sector with the given root from the host and
+// returns whether the host returned data which doesn't match the root.
+func (r *Renter) managedScrubPiece(hostKey types.SiaPublicKey, root crypto.Hash) (bool, error) {
+	if _, err := r.staticWorkerPool.callWorker(hostKey); err != nil {
+		return false, err
+	}
+	d, err := r.hostContractor.Downloader(hostKey, r.tg.StopChan())
+	if err != nil {
+		return false, errors.AddContext(err, "failed to create downloader")
+	}
+	defer d.Close()
+	if err := checkDownloadGouging(r.hostContractor.Allowance(), d.HostSettings()); err != nil {
+		return false, err
+	}
+	data, err := d.Download(root, 0, uint32(modules.SectorSize))
+	if errors.Contains(err, proto.ErrBadSectorData) {
+		return true, nil
+	} else if err != nil {
+		return false, errors.AddContext(err, "failed to download sector")
+	}
+	return crypto.MerkleRoot(data) != root, nil
+}
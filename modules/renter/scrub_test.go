@@ -0,0 +1,142 @@
+package renter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestScrubDir tests that only the files of directories with a scrub interval
+// are scrubbed and that failed scrubs are bubbled.
+func TestScrubDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file in the root dir and one in a nested dir.
+	dir, err := modules.NewSiaPath("scrubbed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subDir, err := dir.Join("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateDir(subDir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	rootFile := modules.RandomSiaPath()
+	subFile, err := subDir.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	for _, siaPath := range []modules.SiaPath{rootFile, subFile} {
+		err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Negative intervals are invalid.
+	if err := r.SetDirScrubInterval(dir, -time.Second); err != errInvalidScrubInterval {
+		t.Fatal("expected errInvalidScrubInterval but got", err)
+	}
+
+	// Without an interval nothing is scrubbed.
+	if err := r.managedScrubDir(modules.RootSiaPath(), 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range []modules.SiaPath{rootFile, subFile} {
+		fi, err := r.File(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.LastScrubTime.IsZero() {
+			t.Fatal("file was scrubbed without an interval", siaPath)
+		}
+	}
+
+	// Set an interval on the parent of the nested dir. The renter has no
+	// workers so none of the pieces can be downloaded and the scrub shouldn't
+	// be recorded.
+	if err := r.SetDirScrubInterval(dir, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedScrubDir(modules.RootSiaPath(), 0); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := r.File(subFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.ScrubFailed || !fi.LastScrubTime.IsZero() {
+		t.Fatal("scrub without downloaded pieces was recorded", fi.ScrubFailed, fi.LastScrubTime)
+	}
+
+	// Record a failed scrub of the nested file.
+	entry, err := r.staticFileSystem.OpenSiaFile(subFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)}
+	if err := entry.SetScrubResult([]types.SiaPublicKey{host}); err != nil {
+		t.Fatal(err)
+	}
+	failedHosts := entry.ScrubFailedHosts()
+	if err := entry.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(failedHosts) != 1 || !failedHosts[0].Equals(host) {
+		t.Fatal("failed host wasn't recorded", failedHosts)
+	}
+	fi, err = r.File(subFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ScrubFailed || fi.LastScrubTime.IsZero() {
+		t.Fatal("scrub result not recorded", fi.ScrubFailed, fi.LastScrubTime)
+	}
+
+	// The failed scrub should be counted by the bubble.
+	r.managedBubbleMetadata(context.Background(), subDir)
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		di, err := r.staticFileSystem.DirInfo(modules.RootSiaPath())
+		if err != nil {
+			return err
+		}
+		if di.NumFilesScrubFailed != 0 || di.AggregateNumFilesScrubFailed != 1 {
+			return fmt.Errorf("wrong number of failed scrubs %v %v", di.NumFilesScrubFailed, di.AggregateNumFilesScrubFailed)
+		}
+		di, err = r.staticFileSystem.DirInfo(dir)
+		if err != nil {
+			return err
+		}
+		if di.ScrubInterval != time.Hour {
+			return fmt.Errorf("wrong scrub interval %v", di.ScrubInterval)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+package siadir
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// hostSketchPrecision is the number of bits of a host's hash which select
+	// the register of a HostSketch. A precision of 10 results in 1024
+	// registers and a standard error of about 3%.
+	hostSketchPrecision = 10
+
+	// hostSketchRegisters is the number of registers of a HostSketch.
+	hostSketchRegisters = 1 << hostSketchPrecision
+)
+
+// HostSketch is a HyperLogLog sketch of a set of hosts. It estimates the number
+// of distinct hosts added to it using a fixed amount of memory and two
+// sketches can be merged to estimate the size of the union of their sets.
+// This allows for bubbling the number of unique hosts up the directory tree
+// without keeping track of the exact host sets. A nil HostSketch is a valid
+// empty sketch for merging and counting.
+type HostSketch []byte
+
+// NewHostSketch creates an empty HostSketch.
+func NewHostSketch() HostSketch {
+	return make(HostSketch, hostSketchRegisters)
+}
+
+// Add adds a host to the sketch.
+func (hs HostSketch) Add(spk types.SiaPublicKey) {
+	h := crypto.HashObject(spk)
+	x := binary.LittleEndian.Uint64(h[:8])
+	index := x >> (64 - hostSketchPrecision)
+	// Set the lowest bit to bound the number of leading zeros.
+	rho := byte(bits.LeadingZeros64(x<<hostSketchPrecision|1) + 1)
+	if rho > hs[index] {
+		hs[index] = rho
+	}
+}
+
+// Merge adds all the hosts of other to the sketch. Sketches with the wrong
+// number of registers, e.g. from metadata persisted before the sketch was
+// introduced, are ignored.
+func (hs HostSketch) Merge(other HostSketch) {
+	if len(other) != len(hs) {
+		return
+	}
+	for i, rho := range other {
+		if rho > hs[i] {
+			hs[i] = rho
+		}
+	}
+}
+
+// Count returns the estimated number of distinct hosts added to the sketch.
+func (hs HostSketch) Count() uint64 {
+	if len(hs) != hostSketchRegisters {
+		return 0
+	}
+	m := float64(hostSketchRegisters)
+	var sum float64
+	var zeros int
+	for _, rho := range hs {
+		sum += math.Pow(2, -float64(rho))
+		if rho == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Use linear counting for small cardinalities where HyperLogLog is
+	// biased.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
@@ -0,0 +1,79 @@
+package siadir
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// randomHosts returns n random host keys.
+func randomHosts(n int) []types.SiaPublicKey {
+	hosts := make([]types.SiaPublicKey, n)
+	for i := range hosts {
+		hosts[i] = types.SiaPublicKey{
+			Algorithm: types.SignatureEd25519,
+			Key:       fastrand.Bytes(32),
+		}
+	}
+	return hosts
+}
+
+// checkEstimate checks that the estimate is within 15% of the expected count.
+func checkEstimate(t *testing.T, estimate uint64, expected int) {
+	t.Helper()
+	if math.Abs(float64(estimate)-float64(expected)) > 0.15*float64(expected) {
+		t.Fatalf("estimate %v is too far off from %v", estimate, expected)
+	}
+}
+
+// TestHostSketch tests estimating the number of unique hosts using a
+// HostSketch.
+func TestHostSketch(t *testing.T) {
+	// Empty and nil sketches count 0 hosts.
+	if n := NewHostSketch().Count(); n != 0 {
+		t.Fatal("empty sketch counted", n)
+	}
+	var nilSketch HostSketch
+	if n := nilSketch.Count(); n != 0 {
+		t.Fatal("nil sketch counted", n)
+	}
+
+	// Adding the same hosts multiple times doesn't change the estimate.
+	hosts := randomHosts(50)
+	hs := NewHostSketch()
+	for i := 0; i < 3; i++ {
+		for _, host := range hosts {
+			hs.Add(host)
+		}
+	}
+	checkEstimate(t, hs.Count(), len(hosts))
+
+	// Check the estimate of a large number of hosts.
+	hosts = randomHosts(5000)
+	hs = NewHostSketch()
+	for _, host := range hosts {
+		hs.Add(host)
+	}
+	checkEstimate(t, hs.Count(), len(hosts))
+
+	// Merging two sketches with overlapping hosts estimates the union.
+	hs1, hs2 := NewHostSketch(), NewHostSketch()
+	for _, host := range hosts[:3000] {
+		hs1.Add(host)
+	}
+	for _, host := range hosts[2000:] {
+		hs2.Add(host)
+	}
+	hs1.Merge(hs2)
+	checkEstimate(t, hs1.Count(), len(hosts))
+
+	// Merging a nil sketch is a no-op.
+	before := hs1.Count()
+	hs1.Merge(nil)
+	if hs1.Count() != before {
+		t.Fatal("merging nil sketch changed the estimate")
+	}
+}
@@ -0,0 +1,181 @@
+package siadir
+
+import (
+	"math"
+	"os"
+	"time"
+)
+
+// JSONMetadata is the JSON representation of a siadir's Metadata for external
+// consumers. Its field names are stable and independent of the on-disk format
+// of the .siadir file, which may change between versions.
+//
+// The minimum redundancies of a directory which hasn't been bubbled since
+// containing a siafile are math.MaxFloat64. Since that value is meaningless to
+// consumers, it is serialized as null instead. A value of -1 indicates an empty
+// directory.
+//
+// AggregateHostSketch is only used to bubble the number of unique hosts and is
+// not part of the JSON representation. AggregateNumUniqueHosts is exported
+// instead.
+type JSONMetadata struct {
+	AggregateHealth               float64   `json:"aggregatehealth"`
+	AggregateLastHealthCheckTime  time.Time `json:"aggregatelasthealthchecktime"`
+	AggregateMinRedundancy        *float64  `json:"aggregateminredundancy"`
+	AggregateModTime              time.Time `json:"aggregatemodtime"`
+	AggregateNumFiles             uint64    `json:"aggregatenumfiles"`
+	AggregateNumFilesMissingLocal uint64    `json:"aggregatenumfilesmissinglocal"`
+	AggregateNumFilesScrubFailed  uint64    `json:"aggregatenumfilesscrubfailed"`
+	AggregateNumOrphanedFiles     uint64    `json:"aggregatenumorphanedfiles"`
+	AggregateNumStuckChunks       uint64    `json:"aggregatenumstuckchunks"`
+	AggregateNumSubDirs           uint64    `json:"aggregatenumsubdirs"`
+	AggregateNumTaggedFiles       uint64    `json:"aggregatenumtaggedfiles"`
+	AggregateNumUniqueHosts       uint64    `json:"aggregatenumuniquehosts"`
+	AggregateNumUnfinishedFiles   uint64    `json:"aggregatenumunfinishedfiles"`
+	AggregateRepairHealth         float64   `json:"aggregaterepairhealth"`
+	AggregateRepairSize           uint64    `json:"aggregaterepairsize"`
+	AggregateSize                 uint64    `json:"aggregatesize"`
+	AggregateStuckHealth          float64   `json:"aggregatestuckhealth"`
+
+	DefaultDataPieces    int         `json:"defaultdatapieces"`
+	DefaultParityPieces  int         `json:"defaultparitypieces"`
+	Health               float64     `json:"health"`
+	LastHealthCheckTime  time.Time   `json:"lasthealthchecktime"`
+	MinRedundancy        *float64    `json:"minredundancy"`
+	MinRedundancyTarget  float64     `json:"minredundancytarget"`
+	Mode                 os.FileMode `json:"mode"`
+	ModTime              time.Time   `json:"modtime"`
+	NumFiles             uint64      `json:"numfiles"`
+	NumFilesMissingLocal uint64      `json:"numfilesmissinglocal"`
+	NumFilesScrubFailed  uint64      `json:"numfilesscrubfailed"`
+	NumOrphanedFiles     uint64      `json:"numorphanedfiles"`
+	NumStuckChunks       uint64      `json:"numstuckchunks"`
+	NumSubDirs           uint64      `json:"numsubdirs"`
+	NumTaggedFiles       uint64      `json:"numtaggedfiles"`
+	NumUniqueHosts       uint64      `json:"numuniquehosts"`
+	NumUnfinishedFiles   uint64      `json:"numunfinishedfiles"`
+	RepairHealth         float64     `json:"repairhealth"`
+	RepairSize           uint64      `json:"repairsize"`
+	ScrubInterval        int64       `json:"scrubinterval"` // nanoseconds
+	Size                 uint64      `json:"size"`
+	StuckHealth          float64     `json:"stuckhealth"`
+
+	Version string `json:"version"`
+}
+
+// JSON returns the JSON representation of the metadata.
+func (md Metadata) JSON() JSONMetadata {
+	return JSONMetadata{
+		AggregateHealth:               md.AggregateHealth,
+		AggregateLastHealthCheckTime:  md.AggregateLastHealthCheckTime,
+		AggregateMinRedundancy:        jsonRedundancy(md.AggregateMinRedundancy),
+		AggregateModTime:              md.AggregateModTime,
+		AggregateNumFiles:             md.AggregateNumFiles,
+		AggregateNumFilesMissingLocal: md.AggregateNumFilesMissingLocal,
+		AggregateNumFilesScrubFailed:  md.AggregateNumFilesScrubFailed,
+		AggregateNumOrphanedFiles:     md.AggregateNumOrphanedFiles,
+		AggregateNumStuckChunks:       md.AggregateNumStuckChunks,
+		AggregateNumSubDirs:           md.AggregateNumSubDirs,
+		AggregateNumTaggedFiles:       md.AggregateNumTaggedFiles,
+		AggregateNumUniqueHosts:       md.AggregateNumUniqueHosts,
+		AggregateNumUnfinishedFiles:   md.AggregateNumUnfinishedFiles,
+		AggregateRepairHealth:         md.AggregateRepairHealth,
+		AggregateRepairSize:           md.AggregateRepairSize,
+		AggregateSize:                 md.AggregateSize,
+		AggregateStuckHealth:          md.AggregateStuckHealth,
+
+		DefaultDataPieces:    md.DefaultDataPieces,
+		DefaultParityPieces:  md.DefaultParityPieces,
+		Health:               md.Health,
+		LastHealthCheckTime:  md.LastHealthCheckTime,
+		MinRedundancy:        jsonRedundancy(md.MinRedundancy),
+		MinRedundancyTarget:  md.MinRedundancyTarget,
+		Mode:                 md.Mode,
+		ModTime:              md.ModTime,
+		NumFiles:             md.NumFiles,
+		NumFilesMissingLocal: md.NumFilesMissingLocal,
+		NumFilesScrubFailed:  md.NumFilesScrubFailed,
+		NumOrphanedFiles:     md.NumOrphanedFiles,
+		NumStuckChunks:       md.NumStuckChunks,
+		NumSubDirs:           md.NumSubDirs,
+		NumTaggedFiles:       md.NumTaggedFiles,
+		NumUniqueHosts:       md.NumUniqueHosts,
+		NumUnfinishedFiles:   md.NumUnfinishedFiles,
+		RepairHealth:         md.RepairHealth,
+		RepairSize:           md.RepairSize,
+		ScrubInterval:        int64(md.ScrubInterval),
+		Size:                 md.Size,
+		StuckHealth:          md.StuckHealth,
+
+		Version: md.Version,
+	}
+}
+
+// Metadata converts the JSON representation back to a Metadata. A null
+// minimum redundancy is converted back to math.MaxFloat64 and the host sketch
+// is empty.
+func (jm JSONMetadata) Metadata() Metadata {
+	return Metadata{
+		AggregateHealth:               jm.AggregateHealth,
+		AggregateHostSketch:           NewHostSketch(),
+		AggregateLastHealthCheckTime:  jm.AggregateLastHealthCheckTime,
+		AggregateMinRedundancy:        metadataRedundancy(jm.AggregateMinRedundancy),
+		AggregateModTime:              jm.AggregateModTime,
+		AggregateNumFiles:             jm.AggregateNumFiles,
+		AggregateNumFilesMissingLocal: jm.AggregateNumFilesMissingLocal,
+		AggregateNumFilesScrubFailed:  jm.AggregateNumFilesScrubFailed,
+		AggregateNumOrphanedFiles:     jm.AggregateNumOrphanedFiles,
+		AggregateNumStuckChunks:       jm.AggregateNumStuckChunks,
+		AggregateNumSubDirs:           jm.AggregateNumSubDirs,
+		AggregateNumTaggedFiles:       jm.AggregateNumTaggedFiles,
+		AggregateNumUniqueHosts:       jm.AggregateNumUniqueHosts,
+		AggregateNumUnfinishedFiles:   jm.AggregateNumUnfinishedFiles,
+		AggregateRepairHealth:         jm.AggregateRepairHealth,
+		AggregateRepairSize:           jm.AggregateRepairSize,
+		AggregateSize:                 jm.AggregateSize,
+		AggregateStuckHealth:          jm.AggregateStuckHealth,
+
+		DefaultDataPieces:    jm.DefaultDataPieces,
+		DefaultParityPieces:  jm.DefaultParityPieces,
+		Health:               jm.Health,
+		LastHealthCheckTime:  jm.LastHealthCheckTime,
+		MinRedundancy:        metadataRedundancy(jm.MinRedundancy),
+		MinRedundancyTarget:  jm.MinRedundancyTarget,
+		Mode:                 jm.Mode,
+		ModTime:              jm.ModTime,
+		NumFiles:             jm.NumFiles,
+		NumFilesMissingLocal: jm.NumFilesMissingLocal,
+		NumFilesScrubFailed:  jm.NumFilesScrubFailed,
+		NumOrphanedFiles:     jm.NumOrphanedFiles,
+		NumStuckChunks:       jm.NumStuckChunks,
+		NumSubDirs:           jm.NumSubDirs,
+		NumTaggedFiles:       jm.NumTaggedFiles,
+		NumUniqueHosts:       jm.NumUniqueHosts,
+		NumUnfinishedFiles:   jm.NumUnfinishedFiles,
+		RepairHealth:         jm.RepairHealth,
+		RepairSize:           jm.RepairSize,
+		ScrubInterval:        time.Duration(jm.ScrubInterval),
+		Size:                 jm.Size,
+		StuckHealth:          jm.StuckHealth,
+
+		Version: jm.Version,
+	}
+}
+
+// jsonRedundancy converts a minimum redundancy of the metadata to its JSON
+// representation.
+func jsonRedundancy(redundancy float64) *float64 {
+	if redundancy == math.MaxFloat64 {
+		return nil
+	}
+	return &redundancy
+}
+
+// metadataRedundancy converts a minimum redundancy of the JSON representation
+// to its metadata value.
+func metadataRedundancy(redundancy *float64) float64 {
+	if redundancy == nil {
+		return math.MaxFloat64
+	}
+	return *redundancy
+}
@@ -130,12 +130,21 @@ func (sd *SiaDir) UpdateMetadata(metadata Metadata) error {
 	sd.mu.Lock()
 	defer sd.mu.Unlock()
 	sd.metadata.AggregateHealth = metadata.AggregateHealth
+	sd.metadata.AggregateHostSketch = metadata.AggregateHostSketch
 	sd.metadata.AggregateLastHealthCheckTime = metadata.AggregateLastHealthCheckTime
 	sd.metadata.AggregateMinRedundancy = metadata.AggregateMinRedundancy
 	sd.metadata.AggregateModTime = metadata.AggregateModTime
 	sd.metadata.AggregateNumFiles = metadata.AggregateNumFiles
+	sd.metadata.AggregateNumFilesMissingLocal = metadata.AggregateNumFilesMissingLocal
+	sd.metadata.AggregateNumFilesScrubFailed = metadata.AggregateNumFilesScrubFailed
+	sd.metadata.AggregateNumOrphanedFiles = metadata.AggregateNumOrphanedFiles
 	sd.metadata.AggregateNumStuckChunks = metadata.AggregateNumStuckChunks
 	sd.metadata.AggregateNumSubDirs = metadata.AggregateNumSubDirs
+	sd.metadata.AggregateNumTaggedFiles = metadata.AggregateNumTaggedFiles
+	sd.metadata.AggregateNumUniqueHosts = metadata.AggregateNumUniqueHosts
+	sd.metadata.AggregateNumUnfinishedFiles = metadata.AggregateNumUnfinishedFiles
+	sd.metadata.AggregateRepairHealth = metadata.AggregateRepairHealth
+	sd.metadata.AggregateRepairSize = metadata.AggregateRepairSize
 	sd.metadata.AggregateSize = metadata.AggregateSize
 	sd.metadata.AggregateStuckHealth = metadata.AggregateStuckHealth
 
@@ -144,13 +153,48 @@ func (sd *SiaDir) UpdateMetadata(metadata Metadata) error {
 	sd.metadata.MinRedundancy = metadata.MinRedundancy
 	sd.metadata.ModTime = metadata.ModTime
 	sd.metadata.NumFiles = metadata.NumFiles
+	sd.metadata.NumFilesMissingLocal = metadata.NumFilesMissingLocal
+	sd.metadata.NumFilesScrubFailed = metadata.NumFilesScrubFailed
+	sd.metadata.NumOrphanedFiles = metadata.NumOrphanedFiles
 	sd.metadata.NumStuckChunks = metadata.NumStuckChunks
 	sd.metadata.NumSubDirs = metadata.NumSubDirs
+	sd.metadata.NumTaggedFiles = metadata.NumTaggedFiles
+	sd.metadata.NumUniqueHosts = metadata.NumUniqueHosts
+	sd.metadata.NumUnfinishedFiles = metadata.NumUnfinishedFiles
+	sd.metadata.RepairHealth = metadata.RepairHealth
+	sd.metadata.RepairSize = metadata.RepairSize
 	sd.metadata.Size = metadata.Size
 	sd.metadata.StuckHealth = metadata.StuckHealth
 	return sd.saveDir()
 }
 
+// SetMinRedundancyTarget sets the MinRedundancyTarget of the SiaDir and saves
+// it to disk.
+func (sd *SiaDir) SetMinRedundancyTarget(target float64) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.metadata.MinRedundancyTarget = target
+	return sd.saveDir()
+}
+
+// SetDefaultRedundancy sets the DefaultDataPieces and DefaultParityPieces of
+// the SiaDir and saves them to disk.
+func (sd *SiaDir) SetDefaultRedundancy(dataPieces, parityPieces int) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.metadata.DefaultDataPieces = dataPieces
+	sd.metadata.DefaultParityPieces = parityPieces
+	return sd.saveDir()
+}
+
+// SetScrubInterval sets the ScrubInterval of the SiaDir and saves it to disk.
+func (sd *SiaDir) SetScrubInterval(interval time.Duration) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.metadata.ScrubInterval = interval
+	return sd.saveDir()
+}
+
 // createDirMetadata makes sure there is a metadata file in the directory and
 // creates one as needed
 func createDirMetadata(path string, mode os.FileMode) (Metadata, writeaheadlog.Update, error) {
@@ -1,17 +1,22 @@
 package siadir
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"gitlab.com/NebulousLabs/fastrand"
 	"gitlab.com/NebulousLabs/writeaheadlog"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // equalMetadatas is a helper that compares two siaDirMetadatas. If using this
@@ -22,6 +27,9 @@ func equalMetadatas(md, md2 Metadata) error {
 	if md.AggregateHealth != md2.AggregateHealth {
 		return fmt.Errorf("AggregateHealths not equal, %v and %v", md.AggregateHealth, md2.AggregateHealth)
 	}
+	if !bytes.Equal(md.AggregateHostSketch, md2.AggregateHostSketch) {
+		return fmt.Errorf("AggregateHostSketches not equal, %v and %v", md.AggregateHostSketch, md2.AggregateHostSketch)
+	}
 	if md.AggregateLastHealthCheckTime != md2.AggregateLastHealthCheckTime {
 		return fmt.Errorf("AggregateLastHealthCheckTimes not equal, %v and %v", md.AggregateLastHealthCheckTime, md2.AggregateLastHealthCheckTime)
 	}
@@ -34,12 +42,30 @@ func equalMetadatas(md, md2 Metadata) error {
 	if md.AggregateNumFiles != md2.AggregateNumFiles {
 		return fmt.Errorf("AggregateNumFiles not equal, %v and %v", md.AggregateNumFiles, md2.AggregateNumFiles)
 	}
+	if md.AggregateNumFilesMissingLocal != md2.AggregateNumFilesMissingLocal {
+		return fmt.Errorf("AggregateNumFilesMissingLocal not equal, %v and %v", md.AggregateNumFilesMissingLocal, md2.AggregateNumFilesMissingLocal)
+	}
+	if md.AggregateNumTaggedFiles != md2.AggregateNumTaggedFiles {
+		return fmt.Errorf("AggregateNumTaggedFiles not equal, %v and %v", md.AggregateNumTaggedFiles, md2.AggregateNumTaggedFiles)
+	}
+	if md.AggregateNumOrphanedFiles != md2.AggregateNumOrphanedFiles {
+		return fmt.Errorf("AggregateNumOrphanedFiles not equal, %v and %v", md.AggregateNumOrphanedFiles, md2.AggregateNumOrphanedFiles)
+	}
 	if md.AggregateNumStuckChunks != md2.AggregateNumStuckChunks {
 		return fmt.Errorf("AggregateNumStuckChunks not equal, %v and %v", md.AggregateNumStuckChunks, md2.AggregateNumStuckChunks)
 	}
 	if md.AggregateNumSubDirs != md2.AggregateNumSubDirs {
 		return fmt.Errorf("AggregateNumSubDirs not equal, %v and %v", md.AggregateNumSubDirs, md2.AggregateNumSubDirs)
 	}
+	if md.AggregateNumUniqueHosts != md2.AggregateNumUniqueHosts {
+		return fmt.Errorf("AggregateNumUniqueHosts not equal, %v and %v", md.AggregateNumUniqueHosts, md2.AggregateNumUniqueHosts)
+	}
+	if md.AggregateNumUnfinishedFiles != md2.AggregateNumUnfinishedFiles {
+		return fmt.Errorf("AggregateNumUnfinishedFiles not equal, %v and %v", md.AggregateNumUnfinishedFiles, md2.AggregateNumUnfinishedFiles)
+	}
+	if md.AggregateRepairHealth != md2.AggregateRepairHealth {
+		return fmt.Errorf("AggregateRepairHealths not equal, %v and %v", md.AggregateRepairHealth, md2.AggregateRepairHealth)
+	}
 	if md.AggregateSize != md2.AggregateSize {
 		return fmt.Errorf("AggregateSizes not equal, %v and %v", md.AggregateSize, md2.AggregateSize)
 	}
@@ -63,12 +89,30 @@ func equalMetadatas(md, md2 Metadata) error {
 	if md.NumFiles != md2.NumFiles {
 		return fmt.Errorf("NumFiles not equal, %v and %v", md.NumFiles, md2.NumFiles)
 	}
+	if md.NumFilesMissingLocal != md2.NumFilesMissingLocal {
+		return fmt.Errorf("NumFilesMissingLocal not equal, %v and %v", md.NumFilesMissingLocal, md2.NumFilesMissingLocal)
+	}
+	if md.NumTaggedFiles != md2.NumTaggedFiles {
+		return fmt.Errorf("NumTaggedFiles not equal, %v and %v", md.NumTaggedFiles, md2.NumTaggedFiles)
+	}
+	if md.NumOrphanedFiles != md2.NumOrphanedFiles {
+		return fmt.Errorf("NumOrphanedFiles not equal, %v and %v", md.NumOrphanedFiles, md2.NumOrphanedFiles)
+	}
 	if md.NumStuckChunks != md2.NumStuckChunks {
 		return fmt.Errorf("NumStuckChunks not equal, %v and %v", md.NumStuckChunks, md2.NumStuckChunks)
 	}
 	if md.NumSubDirs != md2.NumSubDirs {
 		return fmt.Errorf("NumSubDirs not equal, %v and %v", md.NumSubDirs, md2.NumSubDirs)
 	}
+	if md.NumUniqueHosts != md2.NumUniqueHosts {
+		return fmt.Errorf("NumUniqueHosts not equal, %v and %v", md.NumUniqueHosts, md2.NumUniqueHosts)
+	}
+	if md.NumUnfinishedFiles != md2.NumUnfinishedFiles {
+		return fmt.Errorf("NumUnfinishedFiles not equal, %v and %v", md.NumUnfinishedFiles, md2.NumUnfinishedFiles)
+	}
+	if md.RepairHealth != md2.RepairHealth {
+		return fmt.Errorf("RepairHealths not equal, %v and %v", md.RepairHealth, md2.RepairHealth)
+	}
 	if md.Size != md2.Size {
 		return fmt.Errorf("Sizes not equal, %v and %v", md.Size, md2.Size)
 	}
@@ -342,3 +386,71 @@ func TestManagedCreateAndApplyTransactions(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestMetadataJSON tests the JSON representation of the metadata.
+func TestMetadataJSON(t *testing.T) {
+	// Every field of the metadata but the host sketch needs to be part of the
+	// JSON representation.
+	mdType, jmType := reflect.TypeOf(Metadata{}), reflect.TypeOf(JSONMetadata{})
+	for i := 0; i < mdType.NumField(); i++ {
+		name := mdType.Field(i).Name
+		if name == "AggregateHostSketch" {
+			continue
+		}
+		field, exists := jmType.FieldByName(name)
+		if !exists {
+			t.Fatalf("field %v is missing from JSONMetadata", name)
+		}
+		if field.Tag.Get("json") != mdType.Field(i).Tag.Get("json") {
+			t.Fatalf("json tag of field %v doesn't match", name)
+		}
+	}
+
+	// Create metadata with an unset min redundancy.
+	checkTime := time.Unix(1500000000, 0).UTC()
+	md := Metadata{
+		AggregateHealth:              1,
+		AggregateHostSketch:          NewHostSketch(),
+		AggregateLastHealthCheckTime: checkTime,
+		AggregateMinRedundancy:       math.MaxFloat64,
+		AggregateModTime:             checkTime,
+		AggregateNumFiles:            3,
+		LastHealthCheckTime:          checkTime,
+		MinRedundancy:                1.5,
+		Mode:                         modules.DefaultDirPerm,
+		ModTime:                      checkTime,
+		ScrubInterval:                time.Hour,
+		Version:                      "1.0",
+	}
+	md.AggregateHostSketch.Add(types.SiaPublicKey{Key: []byte{1}})
+	data, err := json.Marshal(md.JSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if v, exists := fields["aggregateminredundancy"]; !exists || v != nil {
+		t.Fatal("unset min redundancy should be null", v)
+	}
+	if v := fields["minredundancy"]; v != 1.5 {
+		t.Fatal("wrong min redundancy", v)
+	}
+	if v := fields["scrubinterval"]; v != float64(time.Hour) {
+		t.Fatal("wrong scrub interval", v)
+	}
+	if _, exists := fields["aggregatehostsketch"]; exists {
+		t.Fatal("host sketch shouldn't be exported")
+	}
+
+	// The metadata survives the round trip apart from the host sketch.
+	var jm JSONMetadata
+	if err := json.Unmarshal(data, &jm); err != nil {
+		t.Fatal(err)
+	}
+	md.AggregateHostSketch = NewHostSketch()
+	if md2 := jm.Metadata(); !reflect.DeepEqual(md, md2) {
+		t.Fatalf("metadata doesn't match after round trip:\n%v\n%v", md, md2)
+	}
+}
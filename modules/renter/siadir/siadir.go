@@ -34,7 +34,13 @@ type (
 		// sub tree. The definition of aggregate and siadir specific values is
 		// otherwise the same.
 		//
-		// Health is the health of the most in need siafile that is not stuck
+		// DefaultDataPieces and DefaultParityPieces are the erasure coding
+		// settings used for uploads into the siadir and its subdirectories
+		// which don't specify their own erasure code. The settings of the
+		// nearest ancestor take precedence. A value of 0 means that no default
+		// is set. They are not updated by bubbling.
+		//
+		// Health is the health of the most in need siafile that is not stuck.
 		//
 		// LastHealthCheckTime is the oldest LastHealthCheckTime of any of the
 		// siafiles in the siadir and is the last time the health was calculated
@@ -43,16 +49,55 @@ type (
 		// MinRedundancy is the minimum redundancy of any of the siafiles in the
 		// siadir
 		//
+		// MinRedundancyTarget is the redundancy which the AggregateMinRedundancy
+		// of the siadir is expected to stay above. A value of 0 means that no
+		// target is set. It is not updated by bubbling.
+		//
 		// ModTime is the last time any of the siafiles in the siadir was
 		// updated
 		//
 		// NumFiles is the total number of siafiles in a siadir
 		//
+		// NumFilesMissingLocal is the number of siafiles in a siadir whose
+		// local source file doesn't exist anymore
+		//
+		// NumFilesScrubFailed is the number of siafiles in a siadir whose last
+		// scrub failed
+		//
+		// NumOrphanedFiles is the number of files in a siadir which are
+		// neither siafiles nor any other file created by the renter
+		//
 		// NumStuckChunks is the sum of all the Stuck Chunks of any of the
 		// siafiles in the siadir
 		//
 		// NumSubDirs is the number of sub-siadirs in a siadir
 		//
+		// NumTaggedFiles is the number of siafiles in a siadir with at least
+		// one tag
+		//
+		// NumUniqueHosts is the approximate number of distinct hosts storing
+		// pieces of the siafiles in a siadir. It is estimated using a
+		// HostSketch and has a standard error of about 3%. The
+		// AggregateHostSketch is persisted to bubble the aggregate value up
+		// by merging the sketches of the sub directories.
+		//
+		// NumUnfinishedFiles is the number of siafiles in a siadir which
+		// haven't reached a redundancy of 1 yet
+		//
+		// RepairHealth is the health of the most in need siafile as seen by
+		// the repair loop. It is used to decide which directories to repair
+		// and is not reported to users. Cold siafiles are only considered once
+		// their health reaches the cold repair threshold.
+		//
+		// RepairSize is the number of bytes which need to be uploaded to
+		// restore the full redundancy of the siafiles in the siadir
+		//
+		// ScrubInterval is the interval at which the siafiles in the siadir and
+		// its subdirectories are scrubbed. A siadir's own interval takes
+		// precedence over the interval of its nearest ancestor which sets
+		// one. A value of 0 means that no interval is set. It is not updated
+		// by bubbling.
+		//
 		// Size is the total amount of data stored in the siafiles of the siadir
 		//
 		// StuckHealth is the health of the most in need siafile in the siadir,
@@ -61,28 +106,49 @@ type (
 		// The following fields are aggregate values of the siadir. These values are
 		// the totals of the siadir and any sub siadirs, or are calculated based on
 		// all the values in the subtree
-		AggregateHealth              float64   `json:"aggregatehealth"`
-		AggregateLastHealthCheckTime time.Time `json:"aggregatelasthealthchecktime"`
-		AggregateMinRedundancy       float64   `json:"aggregateminredundancy"`
-		AggregateModTime             time.Time `json:"aggregatemodtime"`
-		AggregateNumFiles            uint64    `json:"aggregatenumfiles"`
-		AggregateNumStuckChunks      uint64    `json:"aggregatenumstuckchunks"`
-		AggregateNumSubDirs          uint64    `json:"aggregatenumsubdirs"`
-		AggregateSize                uint64    `json:"aggregatesize"`
-		AggregateStuckHealth         float64   `json:"aggregatestuckhealth"`
+		AggregateHealth               float64    `json:"aggregatehealth"`
+		AggregateHostSketch           HostSketch `json:"aggregatehostsketch"`
+		AggregateLastHealthCheckTime  time.Time  `json:"aggregatelasthealthchecktime"`
+		AggregateMinRedundancy        float64    `json:"aggregateminredundancy"`
+		AggregateModTime              time.Time  `json:"aggregatemodtime"`
+		AggregateNumFiles             uint64     `json:"aggregatenumfiles"`
+		AggregateNumFilesMissingLocal uint64     `json:"aggregatenumfilesmissinglocal"`
+		AggregateNumFilesScrubFailed  uint64     `json:"aggregatenumfilesscrubfailed"`
+		AggregateNumOrphanedFiles     uint64     `json:"aggregatenumorphanedfiles"`
+		AggregateNumStuckChunks       uint64     `json:"aggregatenumstuckchunks"`
+		AggregateNumSubDirs           uint64     `json:"aggregatenumsubdirs"`
+		AggregateNumTaggedFiles       uint64     `json:"aggregatenumtaggedfiles"`
+		AggregateNumUniqueHosts       uint64     `json:"aggregatenumuniquehosts"`
+		AggregateNumUnfinishedFiles   uint64     `json:"aggregatenumunfinishedfiles"`
+		AggregateRepairHealth         float64    `json:"aggregaterepairhealth"`
+		AggregateRepairSize           uint64     `json:"aggregaterepairsize"`
+		AggregateSize                 uint64     `json:"aggregatesize"`
+		AggregateStuckHealth          float64    `json:"aggregatestuckhealth"`
 
 		// The following fields are information specific to the siadir that is not
 		// an aggregate of the entire sub directory tree
-		Health              float64     `json:"health"`
-		LastHealthCheckTime time.Time   `json:"lasthealthchecktime"`
-		MinRedundancy       float64     `json:"minredundancy"`
-		Mode                os.FileMode `json:"mode"`
-		ModTime             time.Time   `json:"modtime"`
-		NumFiles            uint64      `json:"numfiles"`
-		NumStuckChunks      uint64      `json:"numstuckchunks"`
-		NumSubDirs          uint64      `json:"numsubdirs"`
-		Size                uint64      `json:"size"`
-		StuckHealth         float64     `json:"stuckhealth"`
+		DefaultDataPieces    int           `json:"defaultdatapieces"`
+		DefaultParityPieces  int           `json:"defaultparitypieces"`
+		Health               float64       `json:"health"`
+		LastHealthCheckTime  time.Time     `json:"lasthealthchecktime"`
+		MinRedundancy        float64       `json:"minredundancy"`
+		MinRedundancyTarget  float64       `json:"minredundancytarget"`
+		Mode                 os.FileMode   `json:"mode"`
+		ModTime              time.Time     `json:"modtime"`
+		NumFiles             uint64        `json:"numfiles"`
+		NumFilesMissingLocal uint64        `json:"numfilesmissinglocal"`
+		NumFilesScrubFailed  uint64        `json:"numfilesscrubfailed"`
+		NumOrphanedFiles     uint64        `json:"numorphanedfiles"`
+		NumStuckChunks       uint64        `json:"numstuckchunks"`
+		NumSubDirs           uint64        `json:"numsubdirs"`
+		NumTaggedFiles       uint64        `json:"numtaggedfiles"`
+		NumUniqueHosts       uint64        `json:"numuniquehosts"`
+		NumUnfinishedFiles   uint64        `json:"numunfinishedfiles"`
+		RepairHealth         float64       `json:"repairhealth"`
+		RepairSize           uint64        `json:"repairsize"`
+		ScrubInterval        time.Duration `json:"scrubinterval"`
+		Size                 uint64        `json:"size"`
+		StuckHealth          float64       `json:"stuckhealth"`
 
 		// Version is the used version of the header file.
 		Version string `json:"version"`
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
 	"gitlab.com/NebulousLabs/errors"
 )
 
@@ -225,12 +226,20 @@ func TestUpdateMetadata(t *testing.T) {
 	metadataUpdate := md
 	// Aggregate fields
 	metadataUpdate.AggregateHealth = 7
+	metadataUpdate.AggregateHostSketch = NewHostSketch()
+	metadataUpdate.AggregateHostSketch.Add(types.SiaPublicKey{Key: []byte{1}})
 	metadataUpdate.AggregateLastHealthCheckTime = checkTime
 	metadataUpdate.AggregateMinRedundancy = 2.2
 	metadataUpdate.AggregateModTime = checkTime
 	metadataUpdate.AggregateNumFiles = 11
+	metadataUpdate.AggregateNumFilesMissingLocal = 4
+	metadataUpdate.AggregateNumOrphanedFiles = 3
+	metadataUpdate.AggregateNumTaggedFiles = 6
 	metadataUpdate.AggregateNumStuckChunks = 15
 	metadataUpdate.AggregateNumSubDirs = 5
+	metadataUpdate.AggregateNumUniqueHosts = 8
+	metadataUpdate.AggregateNumUnfinishedFiles = 3
+	metadataUpdate.AggregateRepairHealth = 6
 	metadataUpdate.AggregateSize = 2432
 	metadataUpdate.AggregateStuckHealth = 5
 	// SiaDir fields
@@ -239,8 +248,14 @@ func TestUpdateMetadata(t *testing.T) {
 	metadataUpdate.MinRedundancy = 2
 	metadataUpdate.ModTime = checkTime
 	metadataUpdate.NumFiles = 5
+	metadataUpdate.NumFilesMissingLocal = 1
+	metadataUpdate.NumOrphanedFiles = 2
+	metadataUpdate.NumTaggedFiles = 5
 	metadataUpdate.NumStuckChunks = 6
 	metadataUpdate.NumSubDirs = 4
+	metadataUpdate.NumUniqueHosts = 7
+	metadataUpdate.NumUnfinishedFiles = 2
+	metadataUpdate.RepairHealth = 3
 	metadataUpdate.Size = 223
 	metadataUpdate.StuckHealth = 2
 
@@ -57,6 +57,10 @@ var (
 	// for files where every 64 bytes of an encoded piece can be decoded
 	// separately.
 	ecReedSolomonSubShards64 = modules.ErasureCoderType{0, 0, 0, 2}
+
+	// ecReedSolomon16 is the marshaled type of the reed solomon coder over
+	// GF(2^16).
+	ecReedSolomon16 = modules.ErasureCoderType{0, 0, 0, 3}
 )
 
 // marshaledChunkSize is a helper method that returns the size of a chunk on
@@ -142,12 +142,19 @@ func unmarshalChunk(numPieces uint32, raw []byte) (chunk chunk, err error) {
 func unmarshalErasureCoder(ecType [4]byte, ecParams [8]byte) (modules.ErasureCoder, error) {
 	dataPieces := int(binary.LittleEndian.Uint32(ecParams[:4]))
 	parityPieces := int(binary.LittleEndian.Uint32(ecParams[4:]))
-	// Create correct erasure coder.
+	return NewErasureCoder(ecType, dataPieces, parityPieces)
+}
+
+// NewErasureCoder creates an erasure coder of the provided type with the
+// provided number of data and parity pieces.
+func NewErasureCoder(ecType modules.ErasureCoderType, dataPieces, parityPieces int) (modules.ErasureCoder, error) {
 	switch ecType {
 	case ecReedSolomon:
 		return NewRSCode(dataPieces, parityPieces)
 	case ecReedSolomonSubShards64:
 		return NewRSSubCode(dataPieces, parityPieces, 64)
+	case ecReedSolomon16:
+		return NewRS16Code(dataPieces, parityPieces)
 	default:
 		return nil, errors.New("unknown erasure code type")
 	}
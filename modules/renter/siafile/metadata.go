@@ -75,9 +75,17 @@ type (
 		// visible to the user and is updated within the 'Redundancy' method which is
 		// periodically called by the repair code.
 		//
+		// CachedEffectiveRedundancy is the redundancy of the file weighted by
+		// the uptime of the hosts storing its pieces. It is updated within the
+		// 'EffectiveRedundancy' method which is called by the health loop.
+		//
 		// CachedHealth is the health of the file on the network and is also
 		// periodically updated by the health check loop whenever 'Health' is called.
 		//
+		// CachedRepairSize is the number of bytes which need to be uploaded to
+		// restore the full redundancy of the file. It is updated within the
+		// 'RepairSize' method which is called by the health loop.
+		//
 		// CachedStuckHealth is the health of the stuck chunks of the file. It is
 		// updated by the health check loop. CachedExpiration is the lowest height at
 		// which any of the file's contracts will expire. Also updated periodically by
@@ -90,13 +98,30 @@ type (
 		// CachedUploadProgress is the upload progress of the file and is updated
 		// every time a piece is added to the siafile.
 		//
-		CachedRedundancy     float64           `json:"cachedredundancy"`
-		CachedUserRedundancy float64           `json:"cacheduserredundancy"`
-		CachedHealth         float64           `json:"cachedhealth"`
-		CachedStuckHealth    float64           `json:"cachedstuckhealth"`
-		CachedExpiration     types.BlockHeight `json:"cachedexpiration"`
-		CachedUploadedBytes  uint64            `json:"cacheduploadedbytes"`
-		CachedUploadProgress float64           `json:"cacheduploadprogress"`
+		// CachedHealthModTime and CachedHealthUtilityHash are the ModTime of the
+		// file and the hash of the utilities of its hosts at the time the cached
+		// health and redundancy values were last calculated by the health loop.
+		// They are used to tell whether the cached values are still up-to-date.
+		// Marking chunks as stuck or updating the cached values with Health,
+		// Redundancy, EffectiveRedundancy, RepairSize or PieceHostPublicKeys
+		// resets CachedHealthUtilityHash.
+		//
+		CachedRedundancy          float64           `json:"cachedredundancy"`
+		CachedUserRedundancy      float64           `json:"cacheduserredundancy"`
+		CachedEffectiveRedundancy float64           `json:"cachedeffectiveredundancy"`
+		CachedHealth              float64           `json:"cachedhealth"`
+		CachedRepairSize          uint64            `json:"cachedrepairsize"`
+		CachedStuckHealth         float64           `json:"cachedstuckhealth"`
+		CachedExpiration          types.BlockHeight `json:"cachedexpiration"`
+		CachedUploadedBytes       uint64            `json:"cacheduploadedbytes"`
+		CachedUploadProgress      float64           `json:"cacheduploadprogress"`
+		CachedHealthModTime       time.Time         `json:"cachedhealthmodtime"`
+		CachedHealthUtilityHash   crypto.Hash       `json:"cachedhealthutilityhash"`
+
+		// CachedPieceHosts are the hosts which store pieces of the file. It is
+		// updated within the 'PieceHostPublicKeys' method which is called by the
+		// health loop.
+		CachedPieceHosts []types.SiaPublicKey `json:"cachedpiecehosts"`
 
 		// Repair loop fields
 		//
@@ -122,6 +147,63 @@ type (
 		Redundancy          float64   `json:"redundancy"`
 		StuckHealth         float64   `json:"stuckhealth"`
 
+		// UploadPriority is the user defined priority of the file's chunks in
+		// the upload heap. Chunks of files with a higher priority are uploaded
+		// first.
+		UploadPriority int `json:"uploadpriority"`
+
+		// UploadDeadline is the time by which the file should have reached
+		// its target redundancy. A zero value means that there is no
+		// deadline.
+		UploadDeadline time.Time `json:"uploaddeadline"`
+
+		// ChunkUploadRetries is the number of failed piece uploads of the
+		// chunks of the file which were retried either on the same or on a
+		// different host. The retries of a chunk are reset once it is fully
+		// uploaded, which means that only chunks which keep failing are
+		// contained in the map.
+		ChunkUploadRetries map[uint64]uint64 `json:"chunkuploadretries"`
+
+		// PreferredHosts are the hosts the repair loop should prefer when
+		// uploading pieces of the file.
+		PreferredHosts []types.SiaPublicKey `json:"preferredhosts"`
+
+		// LastVerifiedTime is the time at which a chunk of the file was last
+		// downloaded and verified after a repair. VerificationFailed indicates
+		// whether that verification failed.
+		LastVerifiedTime   time.Time `json:"lastverifiedtime"`
+		VerificationFailed bool      `json:"verificationfailed"`
+
+		// LastScrubTime is the time at which a chunk of the file was last
+		// downloaded and verified by the scrub loop. ScrubFailed indicates
+		// whether that scrub failed and ScrubFailedHosts contains the hosts
+		// which returned pieces that didn't match their Merkle roots.
+		LastScrubTime    time.Time            `json:"lastscrubtime"`
+		ScrubFailed      bool                 `json:"scrubfailed"`
+		ScrubFailedHosts []types.SiaPublicKey `json:"scrubfailedhosts"`
+
+		// Tags are arbitrary key-value pairs attached to the file by the user.
+		Tags map[string]string `json:"tags"`
+
+		// Compression is the codec the file was compressed with before it was
+		// erasure coded. LogicalSize is the size of the file before
+		// compression while FileSize is the size of the compressed data.
+		Compression modules.CompressionCodec `json:"compression"`
+		LogicalSize int64                    `json:"logicalsize"`
+
+		// Cold indicates that the file is archival. Cold files are only
+		// repaired once their health drops below the cold repair threshold.
+		Cold bool `json:"cold"`
+
+		// ReadOnly indicates that the file can't be deleted or renamed. It
+		// doesn't prevent the file from being repaired.
+		ReadOnly bool `json:"readonly"`
+
+		// LocalModTime is the modification time of the local file at the time
+		// it was uploaded. Together with the size of the file it is used to
+		// tell whether the local file changed since.
+		LocalModTime time.Time `json:"localmodtime"`
+
 		// File ownership/permission fields.
 		Mode    os.FileMode `json:"mode"`    // unix filemode of the sia file - uint32
 		UserID  int         `json:"userid"`  // id of the user who owns the file
@@ -159,22 +241,34 @@ type (
 
 	// BubbledMetadata is the metadata of a siafile that gets bubbled
 	BubbledMetadata struct {
+		Cold                bool
+		EffectiveRedundancy float64
 		Health              float64
+		Hosts               []types.SiaPublicKey
 		LastHealthCheckTime time.Time
+		LocalFileMissing    bool
 		ModTime             time.Time
 		NumStuckChunks      uint64
 		Redundancy          float64
+		RepairSize          uint64
+		ScrubFailed         bool
 		Size                uint64
 		StuckHealth         float64
+		Tagged              bool
+		TargetRedundancy    float64
 		UID                 SiafileUID
+		UploadDeadline      time.Time
 	}
 
 	// CachedHealthMetadata is a healper struct that contains the siafile health
 	// metadata fields that are cached
 	CachedHealthMetadata struct {
-		Health      float64
-		Redundancy  float64
-		StuckHealth float64
+		EffectiveRedundancy float64
+		Health              float64
+		PieceHosts          []types.SiaPublicKey
+		Redundancy          float64
+		RepairSize          uint64
+		StuckHealth         float64
 	}
 )
 
@@ -226,6 +320,22 @@ func (sf *SiaFile) LastHealthCheckTime() time.Time {
 	return sf.staticMetadata.LastHealthCheckTime
 }
 
+// LastScrubTime returns the time at which a chunk of the file was last
+// scrubbed.
+func (sf *SiaFile) LastScrubTime() time.Time {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.LastScrubTime
+}
+
+// LastVerifiedTime returns the time at which a chunk of the file was last
+// verified.
+func (sf *SiaFile) LastVerifiedTime() time.Time {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.LastVerifiedTime
+}
+
 // LocalPath returns the path of the local data of the file.
 func (sf *SiaFile) LocalPath() string {
 	sf.mu.RLock()
@@ -255,6 +365,32 @@ func (sf *SiaFile) Metadata() Metadata {
 	return md
 }
 
+// Compression returns the codec the SiaFile was compressed with.
+func (sf *SiaFile) Compression() modules.CompressionCodec {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.Compression
+}
+
+// LocalModTime returns the modification time of the local file at the time
+// it was uploaded.
+func (sf *SiaFile) LocalModTime() time.Time {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.LocalModTime
+}
+
+// LogicalSize returns the size of the file before it was compressed. For
+// uncompressed files this is the same as Size.
+func (sf *SiaFile) LogicalSize() uint64 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	if sf.staticMetadata.Compression == modules.CompressionNone {
+		return uint64(sf.staticMetadata.FileSize)
+	}
+	return uint64(sf.staticMetadata.LogicalSize)
+}
+
 // Mode returns the FileMode of the SiaFile.
 func (sf *SiaFile) Mode() os.FileMode {
 	sf.mu.RLock()
@@ -262,6 +398,95 @@ func (sf *SiaFile) Mode() os.FileMode {
 	return sf.staticMetadata.Mode
 }
 
+// PreferredHosts returns the preferred hosts of the SiaFile.
+func (sf *SiaFile) PreferredHosts() []types.SiaPublicKey {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return append([]types.SiaPublicKey(nil), sf.staticMetadata.PreferredHosts...)
+}
+
+// ScrubFailed returns whether the last scrub of the SiaFile failed.
+func (sf *SiaFile) ScrubFailed() bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.ScrubFailed
+}
+
+// ScrubFailedHosts returns the hosts which failed the last scrub of the
+// SiaFile.
+func (sf *SiaFile) ScrubFailedHosts() []types.SiaPublicKey {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return append([]types.SiaPublicKey(nil), sf.staticMetadata.ScrubFailedHosts...)
+}
+
+// VerificationFailed returns whether the last verification of the SiaFile
+// failed.
+func (sf *SiaFile) VerificationFailed() bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.VerificationFailed
+}
+
+// Cold returns whether the SiaFile is cold.
+func (sf *SiaFile) Cold() bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.Cold
+}
+
+// ReadOnly returns whether the SiaFile is read-only.
+func (sf *SiaFile) ReadOnly() bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.ReadOnly
+}
+
+// Tags returns a copy of the tags of the SiaFile.
+func (sf *SiaFile) Tags() map[string]string {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	tags := make(map[string]string, len(sf.staticMetadata.Tags))
+	for k, v := range sf.staticMetadata.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// UploadPriority returns the upload priority of the SiaFile.
+func (sf *SiaFile) UploadPriority() int {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.UploadPriority
+}
+
+// UploadDeadline returns the upload deadline of the SiaFile.
+func (sf *SiaFile) UploadDeadline() time.Time {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.UploadDeadline
+}
+
+// UploadRetries returns the number of retried piece uploads of the chunks of
+// the SiaFile which weren't fully uploaded since.
+func (sf *SiaFile) UploadRetries() uint64 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	var retries uint64
+	for _, r := range sf.staticMetadata.ChunkUploadRetries {
+		retries += r
+	}
+	return retries
+}
+
+// ChunkUploadRetries returns the number of retried piece uploads of a chunk
+// since it was last fully uploaded.
+func (sf *SiaFile) ChunkUploadRetries(chunkIndex uint64) uint64 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.ChunkUploadRetries[chunkIndex]
+}
+
 // ModTime returns the ModTime timestamp of the file.
 func (sf *SiaFile) ModTime() time.Time {
 	sf.mu.RLock()
@@ -295,18 +520,52 @@ func (sf *SiaFile) Rename(newSiaFilePath string) error {
 // the file is atomic across all operating systems, we create a wal transaction
 // that moves over all the chunks one-by-one and deletes the src file.
 func (sf *SiaFile) rename(newSiaFilePath string) error {
-	if sf.deleted {
-		return errors.New("can't rename deleted siafile")
-	}
 	// Check if file exists at new location.
 	if _, err := os.Stat(newSiaFilePath); err == nil {
 		return ErrPathOverload
 	}
+	updates, err := sf.renameUpdates(newSiaFilePath)
+	if err != nil {
+		return err
+	}
+	return createAndApplyTransaction(sf.wal, updates...)
+}
+
+// Replace replaces the siafile old with sf. sf is moved to the location of old
+// and old is deleted. Both happen within a single wal transaction which makes
+// the replacement atomic.
+func (sf *SiaFile) Replace(old *SiaFile) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	if old.deleted {
+		return errors.AddContext(ErrDeleted, "can't replace deleted siafile")
+	}
+	updates := []writeaheadlog.Update{old.createDeleteUpdate()}
+	renameUpdates, err := sf.renameUpdates(old.siaFilePath)
+	if err != nil {
+		return err
+	}
+	err = createAndApplyTransaction(sf.wal, append(updates, renameUpdates...)...)
+	if err != nil {
+		return err
+	}
+	old.deleted = true
+	return nil
+}
+
+// renameUpdates changes the path of the file in memory and returns the updates
+// which move the file on disk.
+func (sf *SiaFile) renameUpdates(newSiaFilePath string) ([]writeaheadlog.Update, error) {
+	if sf.deleted {
+		return nil, errors.New("can't rename deleted siafile")
+	}
 	// Create path to renamed location.
 	dir, _ := filepath.Split(newSiaFilePath)
 	err := os.MkdirAll(dir, 0700)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// Create the delete update before changing the path to the new one.
 	updates := []writeaheadlog.Update{sf.createDeleteUpdate()}
@@ -320,7 +579,7 @@ func (sf *SiaFile) rename(newSiaFilePath string) error {
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// Rename file in memory.
 	sf.siaFilePath = newSiaFilePath
@@ -329,15 +588,14 @@ func (sf *SiaFile) rename(newSiaFilePath string) error {
 	// Write the header to the new location.
 	headerUpdate, err := sf.saveHeaderUpdates()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	updates = append(updates, headerUpdate...)
 	// Write the chunks to the new location.
 	for _, chunk := range chunks {
 		updates = append(updates, sf.saveChunkUpdate(chunk))
 	}
-	// Apply updates.
-	return createAndApplyTransaction(sf.wal, updates...)
+	return updates, nil
 }
 
 // SetMode sets the filemode of the sia file.
@@ -355,6 +613,195 @@ func (sf *SiaFile) SetMode(mode os.FileMode) error {
 	return sf.createAndApplyTransaction(updates...)
 }
 
+// SetPreferredHosts sets the preferred hosts of the sia file.
+func (sf *SiaFile) SetPreferredHosts(hosts []types.SiaPublicKey) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.PreferredHosts = append([]types.SiaPublicKey(nil), hosts...)
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetVerificationResult records the result of a verification of the file.
+func (sf *SiaFile) SetVerificationResult(failed bool) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.LastVerifiedTime = time.Now()
+	sf.staticMetadata.VerificationFailed = failed
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetScrubResult records the result of a scrub of the file. The scrub failed
+// if any hosts returned pieces which didn't match their Merkle roots.
+func (sf *SiaFile) SetScrubResult(failedHosts []types.SiaPublicKey) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.LastScrubTime = time.Now()
+	sf.staticMetadata.ScrubFailed = len(failedHosts) > 0
+	sf.staticMetadata.ScrubFailedHosts = append([]types.SiaPublicKey(nil), failedHosts...)
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetCold marks the sia file as cold or hot.
+func (sf *SiaFile) SetCold(cold bool) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.Cold = cold
+	sf.staticMetadata.ChangeTime = time.Now()
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetReadOnly marks the sia file as read-only or writable.
+func (sf *SiaFile) SetReadOnly(readOnly bool) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.ReadOnly = readOnly
+	sf.staticMetadata.ChangeTime = time.Now()
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetTags replaces the tags of the sia file.
+func (sf *SiaFile) SetTags(tags map[string]string) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.Tags = nil
+	if len(tags) > 0 {
+		sf.staticMetadata.Tags = make(map[string]string, len(tags))
+		for k, v := range tags {
+			sf.staticMetadata.Tags[k] = v
+		}
+	}
+	sf.staticMetadata.ChangeTime = time.Now()
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetUploadPriority sets the upload priority of the sia file.
+func (sf *SiaFile) SetUploadPriority(priority int) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.UploadPriority = priority
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// SetUploadDeadline sets the upload deadline of the sia file.
+func (sf *SiaFile) SetUploadDeadline(deadline time.Time) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.UploadDeadline = deadline
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// UpdateChunkUploadRetries adds retries to the number of retried piece
+// uploads of a chunk. If the chunk was fully uploaded, its retries are reset
+// instead.
+func (sf *SiaFile) UpdateChunkUploadRetries(chunkIndex, retries uint64, fullyUploaded bool) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	_, exists := sf.staticMetadata.ChunkUploadRetries[chunkIndex]
+	if fullyUploaded && !exists || !fullyUploaded && retries == 0 {
+		return nil // nothing to do
+	}
+	// Copy the map since copies of the metadata returned by Metadata share
+	// it.
+	chunkRetries := make(map[uint64]uint64, len(sf.staticMetadata.ChunkUploadRetries)+1)
+	for index, r := range sf.staticMetadata.ChunkUploadRetries {
+		chunkRetries[index] = r
+	}
+	if fullyUploaded {
+		delete(chunkRetries, chunkIndex)
+	} else {
+		chunkRetries[chunkIndex] += retries
+	}
+	sf.staticMetadata.ChunkUploadRetries = chunkRetries
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
+// CachedHealthMetadata returns the cached health metadata of the file. The
+// returned bool is 'false' if the cached values might be outdated. That's the
+// case if pieces were added to the file, the stuck status of its chunks
+// changed or if utilityHash doesn't match the hash of the host utilities the
+// values were calculated with. Files with partial chunks are never considered
+// up-to-date since their health depends on the partials siafile.
+func (sf *SiaFile) CachedHealthMetadata(utilityHash crypto.Hash) (CachedHealthMetadata, bool) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	md := sf.staticMetadata
+	if sf.deleted || md.HasPartialChunk || md.CachedHealthUtilityHash != utilityHash || !md.CachedHealthModTime.Equal(md.ModTime) {
+		return CachedHealthMetadata{}, false
+	}
+	return CachedHealthMetadata{
+		EffectiveRedundancy: md.CachedEffectiveRedundancy,
+		Health:              md.CachedHealth,
+		PieceHosts:          md.CachedPieceHosts,
+		Redundancy:          md.CachedRedundancy,
+		RepairSize:          md.CachedRepairSize,
+		StuckHealth:         md.CachedStuckHealth,
+	}, true
+}
+
+// SetCachedHealthUtilityHash marks the cached health metadata as up-to-date
+// for the current content of the file and the provided hash of the host
+// utilities. Like SetLastHealthCheckTime it doesn't write to disk.
+func (sf *SiaFile) SetCachedHealthUtilityHash(utilityHash crypto.Hash) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.CachedHealthModTime = sf.staticMetadata.ModTime
+	sf.staticMetadata.CachedHealthUtilityHash = utilityHash
+}
+
 // SetLastHealthCheckTime sets the LastHealthCheckTime in memory to the current
 // time but does not update and write to disk.
 //
@@ -381,6 +828,21 @@ func (sf *SiaFile) SetLocalPath(path string) error {
 	return sf.createAndApplyTransaction(updates...)
 }
 
+// SetLocalModTime sets the modification time of the local file of the sia
+// file.
+func (sf *SiaFile) SetLocalModTime(modTime time.Time) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.staticMetadata.LocalModTime = modTime
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
 // Size returns the file's size.
 func (sf *SiaFile) Size() uint64 {
 	sf.mu.RLock()
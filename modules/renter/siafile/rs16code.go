@@ -0,0 +1,365 @@
+package siafile
+
+// rs16code.go implements a Reed-Solomon erasure coder which operates on 16 bit
+// symbols. The coders in rscode.go use GF(2^8) arithmetic which limits the
+// total number of pieces to 256. RS16Code supports much wider stripes at the
+// cost of encoding speed since the arithmetic isn't accelerated by assembly.
+//
+// The code is systematic. The first MinPieces pieces contain the original data
+// and the parity pieces are created from a Cauchy matrix which guarantees that
+// any MinPieces pieces can be used to recover the data.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// gf16Polynomial is the primitive polynomial x^16+x^12+x^3+x+1 used to
+	// construct GF(2^16).
+	gf16Polynomial = 0x1100B
+
+	// gf16Order is the number of non-zero elements of GF(2^16).
+	gf16Order = 1<<16 - 1
+
+	// rs16MaxPieces is the maximum number of pieces supported by RS16Code.
+	// The field would support up to 2^16 pieces but the limit keeps the size
+	// of a marshaled chunk reasonable.
+	rs16MaxPieces = 1 << 12
+)
+
+var (
+	// errRS16OddPieceSize is returned if a piece of a RS16Code doesn't
+	// contain a whole number of 16 bit symbols.
+	errRS16OddPieceSize = errors.New("piece size must be a multiple of 2")
+
+	// errRS16TooFewPieces is returned if not enough pieces are available to
+	// recover the data.
+	errRS16TooFewPieces = errors.New("too few pieces to recover the data")
+
+	// gf16Exp and gf16Log are the exponent and logarithm tables of GF(2^16).
+	// gf16Exp is twice the size of the field to avoid a modulo when
+	// multiplying.
+	gf16Exp [2 * gf16Order]uint16
+	gf16Log [1 << 16]int
+)
+
+// init builds the exponent and logarithm tables of GF(2^16).
+func init() {
+	x := 1
+	for i := 0; i < gf16Order; i++ {
+		gf16Exp[i] = uint16(x)
+		gf16Exp[i+gf16Order] = uint16(x)
+		gf16Log[x] = i
+		x <<= 1
+		if x&(1<<16) != 0 {
+			x ^= gf16Polynomial
+		}
+	}
+}
+
+// gf16Mul multiplies two elements of GF(2^16).
+func gf16Mul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf16Exp[gf16Log[a]+gf16Log[b]]
+}
+
+// gf16Inv returns the multiplicative inverse of a non-zero element of
+// GF(2^16).
+func gf16Inv(a uint16) uint16 {
+	return gf16Exp[gf16Order-gf16Log[a]]
+}
+
+// gf16MulAdd multiplies every symbol of in with c and adds the result to out.
+func gf16MulAdd(c uint16, in, out []byte) {
+	if c == 0 {
+		return
+	}
+	logC := gf16Log[c]
+	for i := 0; i+1 < len(in); i += 2 {
+		s := binary.LittleEndian.Uint16(in[i:])
+		if s == 0 {
+			continue
+		}
+		p := gf16Exp[logC+gf16Log[s]]
+		binary.LittleEndian.PutUint16(out[i:], binary.LittleEndian.Uint16(out[i:])^p)
+	}
+}
+
+// gf16Invert inverts the square matrix m using Gauss-Jordan elimination.
+func gf16Invert(m [][]uint16) ([][]uint16, error) {
+	n := len(m)
+	// Create a working copy of m and the identity matrix.
+	work := make([][]uint16, n)
+	inv := make([][]uint16, n)
+	for i := range m {
+		work[i] = append([]uint16(nil), m[i]...)
+		inv[i] = make([]uint16, n)
+		inv[i][i] = 1
+	}
+	for col := 0; col < n; col++ {
+		// Find a pivot.
+		pivot := -1
+		for row := col; row < n; row++ {
+			if work[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot == -1 {
+			return nil, errors.New("matrix is singular")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		// Scale the pivot row to make the pivot 1.
+		scale := gf16Inv(work[col][col])
+		for j := 0; j < n; j++ {
+			work[col][j] = gf16Mul(work[col][j], scale)
+			inv[col][j] = gf16Mul(inv[col][j], scale)
+		}
+		// Eliminate the column from all other rows.
+		for row := 0; row < n; row++ {
+			f := work[row][col]
+			if row == col || f == 0 {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				work[row][j] ^= gf16Mul(f, work[col][j])
+				inv[row][j] ^= gf16Mul(f, inv[col][j])
+			}
+		}
+	}
+	return inv, nil
+}
+
+// RS16Code is a Reed-Solomon encoder/decoder over GF(2^16). It implements the
+// modules.ErasureCoder interface.
+type RS16Code struct {
+	// parityMatrix contains one row per parity piece. Each row holds the
+	// coefficients of the data pieces.
+	parityMatrix [][]uint16
+
+	numPieces  int
+	dataPieces int
+}
+
+// NumPieces returns the number of pieces returned by Encode.
+func (rs *RS16Code) NumPieces() int { return rs.numPieces }
+
+// MinPieces return the minimum number of pieces that must be present to
+// recover the original data.
+func (rs *RS16Code) MinPieces() int { return rs.dataPieces }
+
+// Encode splits data into equal-length pieces, some containing the original
+// data and some containing parity data.
+func (rs *RS16Code) Encode(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("not enough data to fill the pieces")
+	}
+	// Compute the piece size and round it up to a whole number of symbols.
+	pieceSize := (len(data) + rs.dataPieces - 1) / rs.dataPieces
+	pieceSize += pieceSize % 2
+	pieces := make([][]byte, rs.dataPieces)
+	for i := range pieces {
+		pieces[i] = make([]byte, pieceSize)
+		if off := i * pieceSize; off < len(data) {
+			copy(pieces[i], data[off:])
+		}
+	}
+	return rs.EncodeShards(pieces)
+}
+
+// EncodeShards creates the parity shards for an already sharded input.
+func (rs *RS16Code) EncodeShards(pieces [][]byte) ([][]byte, error) {
+	// Check that the caller provided the minimum amount of pieces.
+	if len(pieces) < rs.MinPieces() {
+		return nil, fmt.Errorf("invalid number of pieces given %v < %v", len(pieces), rs.MinPieces())
+	}
+	// Since all the pieces should have the same length, get the pieceSize from
+	// the first one.
+	pieceSize := len(pieces[0])
+	if pieceSize%2 != 0 {
+		return nil, errRS16OddPieceSize
+	}
+	for _, piece := range pieces[:rs.dataPieces] {
+		if len(piece) != pieceSize {
+			return nil, errors.New("pieces must have the same size")
+		}
+	}
+	// Add the parity shards to pieces.
+	for len(pieces) < rs.NumPieces() {
+		pieces = append(pieces, make([]byte, pieceSize))
+	}
+	for i, row := range rs.parityMatrix {
+		parity := pieces[rs.dataPieces+i]
+		for j := range parity {
+			parity[j] = 0
+		}
+		for j, c := range row {
+			gf16MulAdd(c, pieces[j], parity)
+		}
+	}
+	return pieces, nil
+}
+
+// Identifier returns an identifier for an erasure coder which can be used to
+// identify erasure coders of the same type, dataPieces and parityPieces.
+func (rs *RS16Code) Identifier() modules.ErasureCoderIdentifier {
+	t := rs.Type()
+	dataPieces := rs.MinPieces()
+	parityPieces := rs.NumPieces() - dataPieces
+	id := fmt.Sprintf("%v+%v+%v", binary.BigEndian.Uint32(t[:]), dataPieces, parityPieces)
+	return modules.ErasureCoderIdentifier(id)
+}
+
+// Reconstruct recovers the full set of encoded shards from the provided pieces,
+// of which at least MinPieces must be non-nil.
+func (rs *RS16Code) Reconstruct(pieces [][]byte) error {
+	if err := rs.reconstructData(pieces); err != nil {
+		return err
+	}
+	// Recompute the missing parity pieces.
+	pieceSize := len(pieces[0])
+	for i, row := range rs.parityMatrix {
+		if pieces[rs.dataPieces+i] != nil {
+			continue
+		}
+		parity := make([]byte, pieceSize)
+		for j, c := range row {
+			gf16MulAdd(c, pieces[j], parity)
+		}
+		pieces[rs.dataPieces+i] = parity
+	}
+	return nil
+}
+
+// Recover recovers the original data from pieces and writes it to w.
+// pieces should be identical to the slice returned by Encode (length and
+// order must be preserved), but with missing elements set to nil.
+func (rs *RS16Code) Recover(pieces [][]byte, n uint64, w io.Writer) error {
+	if err := rs.reconstructData(pieces); err != nil {
+		return err
+	}
+	// Write the data pieces to w.
+	for _, piece := range pieces[:rs.dataPieces] {
+		if n == 0 {
+			return nil
+		}
+		if uint64(len(piece)) > n {
+			piece = piece[:n]
+		}
+		if _, err := w.Write(piece); err != nil {
+			return err
+		}
+		n -= uint64(len(piece))
+	}
+	if n > 0 {
+		return errors.New("not enough data in the pieces to recover n bytes")
+	}
+	return nil
+}
+
+// SupportsPartialEncoding returns false for the GF(2^16) reed-solomon encoder.
+func (rs *RS16Code) SupportsPartialEncoding() bool {
+	return false
+}
+
+// Type returns the erasure coders type identifier.
+func (rs *RS16Code) Type() modules.ErasureCoderType {
+	return ecReedSolomon16
+}
+
+// reconstructData recovers the missing data pieces from the provided pieces.
+func (rs *RS16Code) reconstructData(pieces [][]byte) error {
+	if len(pieces) != rs.numPieces {
+		return fmt.Errorf("expected %v pieces but got %v", rs.numPieces, len(pieces))
+	}
+	// Collect the indices of the first MinPieces available pieces and check
+	// their sizes.
+	pieceSize := -1
+	var available []int
+	for i, piece := range pieces {
+		if piece == nil {
+			continue
+		}
+		if pieceSize == -1 {
+			pieceSize = len(piece)
+		} else if len(piece) != pieceSize {
+			return errors.New("pieces must have the same size")
+		}
+		if len(available) < rs.dataPieces {
+			available = append(available, i)
+		}
+	}
+	if len(available) < rs.dataPieces {
+		return errRS16TooFewPieces
+	}
+	if pieceSize%2 != 0 {
+		return errRS16OddPieceSize
+	}
+	// If all the data pieces are available there is nothing to do.
+	if available[len(available)-1] < rs.dataPieces {
+		return nil
+	}
+	// Build the matrix which maps the data pieces to the available pieces
+	// and invert it.
+	m := make([][]uint16, rs.dataPieces)
+	for i, index := range available {
+		if index < rs.dataPieces {
+			m[i] = make([]uint16, rs.dataPieces)
+			m[i][index] = 1
+		} else {
+			m[i] = rs.parityMatrix[index-rs.dataPieces]
+		}
+	}
+	inv, err := gf16Invert(m)
+	if err != nil {
+		return errors.AddContext(err, "failed to invert decoding matrix")
+	}
+	// Recompute the missing data pieces.
+	for i := 0; i < rs.dataPieces; i++ {
+		if pieces[i] != nil {
+			continue
+		}
+		piece := make([]byte, pieceSize)
+		for j, c := range inv[i] {
+			gf16MulAdd(c, pieces[available[j]], piece)
+		}
+		pieces[i] = piece
+	}
+	return nil
+}
+
+// NewRS16Code creates a new Reed-Solomon encoder/decoder over GF(2^16) using
+// the supplied parameters.
+func NewRS16Code(nData, nParity int) (modules.ErasureCoder, error) {
+	if nData <= 0 || nParity <= 0 {
+		return nil, errors.New("data and parity pieces must be positive")
+	}
+	if nData+nParity > rs16MaxPieces {
+		return nil, fmt.Errorf("too many pieces: %v > %v", nData+nParity, rs16MaxPieces)
+	}
+	// Create the Cauchy matrix 1/(x_i + y_j) with x_i = nData+i and y_j = j.
+	// All the x_i and y_j are distinct which guarantees that every square
+	// submatrix is invertible.
+	parityMatrix := make([][]uint16, nParity)
+	for i := range parityMatrix {
+		parityMatrix[i] = make([]uint16, nData)
+		for j := range parityMatrix[i] {
+			parityMatrix[i][j] = gf16Inv(uint16(nData+i) ^ uint16(j))
+		}
+	}
+	return &RS16Code{
+		parityMatrix: parityMatrix,
+		numPieces:    nData + nParity,
+		dataPieces:   nData,
+	}, nil
+}
@@ -0,0 +1,167 @@
+package siafile
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestRS16Encode tests the RS16Code type.
+func TestRS16Encode(t *testing.T) {
+	badParams := []struct {
+		data, parity int
+	}{
+		{-1, -1},
+		{-1, 0},
+		{0, -1},
+		{0, 0},
+		{0, 1},
+		{1, 0},
+		{rs16MaxPieces, 1},
+	}
+	for _, ps := range badParams {
+		if _, err := NewRS16Code(ps.data, ps.parity); err == nil {
+			t.Error("expected bad parameter error, got nil")
+		}
+	}
+
+	// Use more pieces than supported by the GF(2^8) coder.
+	rsc, err := NewRS16Code(100, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(777)
+	pieces, err := rsc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rsc.Encode(nil); err == nil {
+		t.Fatal("expected nil data error, got nil")
+	}
+
+	// Drop all but MinPieces random pieces and recover the data.
+	for _, i := range fastrand.Perm(len(pieces))[:rsc.NumPieces()-rsc.MinPieces()] {
+		pieces[i] = nil
+	}
+	buf := new(bytes.Buffer)
+	if err := rsc.Recover(pieces, 777, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Fatal("recovered data does not match original")
+	}
+	if err := rsc.Recover(make([][]byte, rsc.NumPieces()), 777, buf); err == nil {
+		t.Fatal("expected nil pieces error, got nil")
+	}
+}
+
+// TestRS16CompareRS compares the RS16Code against the GF(2^8) RSCode for small
+// numbers of pieces.
+func TestRS16CompareRS(t *testing.T) {
+	params := []struct {
+		data, parity int
+	}{
+		{1, 1},
+		{1, 4},
+		{10, 20},
+		{30, 30},
+	}
+	for _, ps := range params {
+		rs, err := NewRSCode(ps.data, ps.parity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs16, err := NewRS16Code(ps.data, ps.parity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Use an even piece size to get pieces of the same size from both
+		// coders.
+		data := fastrand.Bytes(ps.data * 2 * (fastrand.Intn(100) + 1))
+		pieces, err := rs.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pieces16, err := rs16.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pieces) != len(pieces16) {
+			t.Fatal("number of pieces doesn't match", len(pieces), len(pieces16))
+		}
+		// Both codes are systematic so the data pieces need to match.
+		for i := 0; i < ps.data; i++ {
+			if !bytes.Equal(pieces[i], pieces16[i]) {
+				t.Fatal("data pieces don't match", i)
+			}
+		}
+
+		// Drop the data pieces and reconstruct them from the parity pieces.
+		for i := 0; i < ps.data; i++ {
+			pieces[i] = nil
+			pieces16[i] = nil
+		}
+		if err := rs.Reconstruct(pieces); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs16.Reconstruct(pieces16); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < ps.data; i++ {
+			if !bytes.Equal(pieces[i], pieces16[i]) {
+				t.Fatal("reconstructed data pieces don't match", i)
+			}
+		}
+
+		// Drop parity pieces and recover the data from both coders.
+		for i := ps.data; i < ps.data+ps.parity/2; i++ {
+			pieces[i] = nil
+			pieces16[i] = nil
+		}
+		buf, buf16 := new(bytes.Buffer), new(bytes.Buffer)
+		if err := rs.Recover(pieces, uint64(len(data)), buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs16.Recover(pieces16, uint64(len(data)), buf16); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), buf16.Bytes()) || !bytes.Equal(data, buf16.Bytes()) {
+			t.Fatal("recovered data doesn't match")
+		}
+	}
+}
+
+// TestRS16Marshal tests that the RS16Code survives being marshaled and
+// unmarshaled.
+func TestRS16Marshal(t *testing.T) {
+	ec, err := NewRS16Code(30, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecType, ecParams := marshalErasureCoder(ec)
+	ec2, err := unmarshalErasureCoder(ecType, ecParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ec.Identifier() != ec2.Identifier() {
+		t.Fatal("identifiers don't match", ec.Identifier(), ec2.Identifier())
+	}
+	if ec.Identifier() != "3+30+60" {
+		t.Fatal("wrong identifier", ec.Identifier())
+	}
+}
+
+func BenchmarkRS16Encode(b *testing.B) {
+	rsc, err := NewRS16Code(80, 20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := fastrand.Bytes(1 << 20)
+
+	b.SetBytes(1 << 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rsc.Encode(data)
+	}
+}
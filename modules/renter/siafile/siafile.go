@@ -173,6 +173,18 @@ func (c *chunk) numPieces() (numPieces int) {
 
 // New create a new SiaFile.
 func New(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules.ErasureCoder, masterKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode, partialsSiaFile *SiaFile, disablePartialUpload bool) (*SiaFile, error) {
+	return newSiaFile(siaFilePath, source, wal, erasureCode, masterKey, fileSize, modules.CompressionNone, 0, fileMode, partialsSiaFile, disablePartialUpload)
+}
+
+// NewCompressed creates a new SiaFile for data which was compressed using
+// codec before it was erasure coded. fileSize is the size of the compressed
+// data and logicalSize the size of the data before compression.
+func NewCompressed(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules.ErasureCoder, masterKey crypto.CipherKey, fileSize, logicalSize uint64, codec modules.CompressionCodec, fileMode os.FileMode, partialsSiaFile *SiaFile, disablePartialUpload bool) (*SiaFile, error) {
+	return newSiaFile(siaFilePath, source, wal, erasureCode, masterKey, fileSize, codec, logicalSize, fileMode, partialsSiaFile, disablePartialUpload)
+}
+
+// newSiaFile creates a new SiaFile and saves it to disk.
+func newSiaFile(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules.ErasureCoder, masterKey crypto.CipherKey, fileSize uint64, codec modules.CompressionCodec, logicalSize uint64, fileMode os.FileMode, partialsSiaFile *SiaFile, disablePartialUpload bool) (*SiaFile, error) {
 	// TODO remove this
 	disablePartialUpload = true
 
@@ -184,6 +196,7 @@ func New(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules
 			AccessTime:              currentTime,
 			ChunkOffset:             defaultReservedMDPages * pageSize,
 			ChangeTime:              currentTime,
+			Compression:             codec,
 			CreateTime:              currentTime,
 			CachedHealth:            zeroHealth,
 			CachedStuckHealth:       0,
@@ -193,6 +206,7 @@ func New(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules
 			DisablePartialChunk:     disablePartialUpload,
 			FileSize:                int64(fileSize),
 			LocalPath:               source,
+			LogicalSize:             int64(logicalSize),
 			StaticMasterKey:         masterKey.Key(),
 			StaticMasterKeyType:     masterKey.Type(),
 			Mode:                    fileMode,
@@ -228,6 +242,7 @@ func New(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules
 		file.staticMetadata.CachedStuckHealth = 0
 		file.staticMetadata.CachedRedundancy = float64(erasureCode.NumPieces()) / float64(erasureCode.MinPieces())
 		file.staticMetadata.CachedUserRedundancy = file.staticMetadata.CachedRedundancy
+		file.staticMetadata.CachedEffectiveRedundancy = file.staticMetadata.CachedRedundancy
 		file.staticMetadata.CachedUploadProgress = 100
 	}
 	// Save file.
@@ -576,10 +591,12 @@ func (sf *SiaFile) Health(offline map[string]bool, goodForRenew map[string]bool)
 
 	sf.mu.Lock()
 	defer sf.mu.Unlock()
-	// Update the cache.
+	// Update the cache. The values are no longer known to match the cached
+	// utility hash.
 	defer func() {
 		sf.staticMetadata.CachedHealth = h
 		sf.staticMetadata.CachedStuckHealth = sh
+		sf.staticMetadata.CachedHealthUtilityHash = crypto.Hash{}
 	}()
 
 	// Check if siafile is deleted
@@ -666,6 +683,45 @@ func (sf *SiaFile) HostPublicKeys() (spks []types.SiaPublicKey) {
 	return keys
 }
 
+// PieceHostPublicKeys returns the public keys of the hosts which store at
+// least one piece of the file. Unlike HostPublicKeys it doesn't include hosts
+// which don't store any pieces anymore. The pieces of combined chunks are
+// stored in the partials siafile and are not considered.
+//
+// NOTE: Like Health, the cached value will be set but not saved to disk.
+func (sf *SiaFile) PieceHostPublicKeys() (keys []types.SiaPublicKey, err error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// Update the cache. The value is no longer known to match the cached
+	// utility hash.
+	defer func() {
+		if err == nil {
+			sf.staticMetadata.CachedPieceHosts = keys
+			sf.staticMetadata.CachedHealthUtilityHash = crypto.Hash{}
+		}
+	}()
+	offsets := make(map[uint32]struct{})
+	err = sf.iterateChunksReadonly(func(chunk chunk) error {
+		if _, ok := sf.isIncludedPartialChunk(uint64(chunk.Index)); ok {
+			return nil
+		}
+		for _, pieceSet := range chunk.Pieces {
+			for _, piece := range pieceSet {
+				offsets[piece.HostTableOffset] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys = make([]types.SiaPublicKey, 0, len(offsets))
+	for offset := range offsets {
+		keys = append(keys, sf.hostKey(offset).PublicKey)
+	}
+	return keys, nil
+}
+
 // IsIncludedPartialChunk returns 'true' if the provided index points to a
 // partial chunk which has been added to the partials sia file already.
 func (sf *SiaFile) IsIncludedPartialChunk(chunkIndex uint64) bool {
@@ -737,10 +793,12 @@ func (sf *SiaFile) Pieces(chunkIndex uint64) ([][]Piece, error) {
 func (sf *SiaFile) Redundancy(offlineMap map[string]bool, goodForRenewMap map[string]bool) (r, ur float64, err error) {
 	sf.mu.Lock()
 	defer sf.mu.Unlock()
-	// Update the cache.
+	// Update the cache. The values are no longer known to match the cached
+	// utility hash.
 	defer func() {
 		sf.staticMetadata.CachedRedundancy = r
 		sf.staticMetadata.CachedUserRedundancy = ur
+		sf.staticMetadata.CachedHealthUtilityHash = crypto.Hash{}
 	}()
 	if sf.staticMetadata.FileSize == 0 {
 		// TODO change this once tiny files are supported.
@@ -809,6 +867,83 @@ func (sf *SiaFile) Redundancy(offlineMap map[string]bool, goodForRenewMap map[st
 	return
 }
 
+// EffectiveRedundancy returns the redundancy of the least redundant chunk,
+// weighting every piece by the historic uptime of the most reliable
+// goodForRenew host storing it. uptimeMap maps a host's public key to a value
+// between 0 and 1. Hosts that are missing from the map are assumed to have
+// perfect uptime. The result is therefore never greater than the redundancy
+// used by the repair code. -1 is returned if the file has size 0.
+func (sf *SiaFile) EffectiveRedundancy(offlineMap map[string]bool, goodForRenewMap map[string]bool, uptimeMap map[string]float64) (r float64, err error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// Update the cache. The value is no longer known to match the cached
+	// utility hash.
+	defer func() {
+		sf.staticMetadata.CachedEffectiveRedundancy = r
+		sf.staticMetadata.CachedHealthUtilityHash = crypto.Hash{}
+	}()
+	ec := sf.staticMetadata.staticErasureCode
+	if sf.staticMetadata.FileSize == 0 {
+		if sf.numChunks != 1 {
+			// should never happen
+			return -1, nil
+		}
+		return float64(ec.NumPieces()) / float64(ec.MinPieces()), nil
+	}
+
+	minRedundancy := math.MaxFloat64
+	err = sf.iterateChunksReadonly(func(chunk chunk) error {
+		// An incomplete partial chunk still lives on disk and is not
+		// supposed to be uploaded yet.
+		if sf.isIncompletePartialChunk(uint64(chunk.Index)) {
+			return nil
+		}
+		redundancy := sf.effectivePieces(chunk, offlineMap, goodForRenewMap, uptimeMap) / float64(ec.MinPieces())
+		if redundancy < minRedundancy {
+			minRedundancy = redundancy
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if minRedundancy == math.MaxFloat64 {
+		// Only incomplete partial chunks were found.
+		minRedundancy = float64(ec.NumPieces()) / float64(ec.MinPieces())
+	}
+	return minRedundancy, nil
+}
+
+// RepairSize returns the number of bytes which need to be uploaded to restore
+// the full redundancy of the file. Every piece which isn't stored on a
+// goodForRenew host counts towards the repair size. Incomplete partial chunks
+// aren't counted since they are not supposed to be uploaded yet.
+func (sf *SiaFile) RepairSize(offlineMap map[string]bool, goodForRenewMap map[string]bool) (size uint64, err error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// Update the cache. The value is no longer known to match the cached
+	// utility hash.
+	defer func() {
+		sf.staticMetadata.CachedRepairSize = size
+		sf.staticMetadata.CachedHealthUtilityHash = crypto.Hash{}
+	}()
+	numPieces := uint64(sf.staticMetadata.staticErasureCode.NumPieces())
+	err = sf.iterateChunksReadonly(func(chunk chunk) error {
+		if sf.isIncompletePartialChunk(uint64(chunk.Index)) {
+			return nil
+		}
+		numPiecesGood, _ := sf.goodPieces(chunk, offlineMap, goodForRenewMap)
+		if numPiecesGood < numPieces {
+			size += (numPieces - numPiecesGood) * sf.staticMetadata.StaticPieceSize
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 // SetAllStuck sets the Stuck field of all chunks to stuck.
 func (sf *SiaFile) SetAllStuck(stuck bool) (err error) {
 	sf.mu.Lock()
@@ -829,13 +964,15 @@ func (sf *SiaFile) SetAllStuck(stuck bool) (err error) {
 	if errIter != nil {
 		return errIter
 	}
-	// Update NumStuckChunks in siafile metadata
+	// Update NumStuckChunks in siafile metadata and invalidate the cached
+	// health.
 	nsc := sf.staticMetadata.NumStuckChunks
 	defer func() {
 		if err != nil {
 			sf.staticMetadata.NumStuckChunks = nsc
 		}
 	}()
+	sf.staticMetadata.CachedHealthUtilityHash = crypto.Hash{}
 	if stuck && sf.staticMetadata.HasPartialChunk && len(sf.staticMetadata.PartialChunks) == 0 {
 		sf.staticMetadata.NumStuckChunks = uint64(sf.numChunks) - 1 // partial chunk can't be stuck in this state
 	} else if stuck {
@@ -1116,6 +1253,51 @@ func (sf *SiaFile) goodPieces(chunk chunk, offlineMap map[string]bool, goodForRe
 	return numPiecesGoodForRenew, numPiecesGoodForUpload
 }
 
+// EffectivePieces returns the number of unique pieces of a chunk that are
+// stored on goodForRenew hosts, with every piece weighted by the uptime of the
+// most reliable host storing it.
+func (sf *SiaFile) EffectivePieces(chunkIndex int, offlineMap map[string]bool, goodForRenewMap map[string]bool, uptimeMap map[string]float64) float64 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	chunk, err := sf.chunk(chunkIndex)
+	if err != nil {
+		build.Critical("failed to retrieve chunk for effectivePieces: ", err)
+		return 0
+	}
+	return sf.effectivePieces(chunk, offlineMap, goodForRenewMap, uptimeMap)
+}
+
+// effectivePieces loops over the pieces of a chunk and sums up the uptime of
+// the most reliable online and goodForRenew host of every piece.
+func (sf *SiaFile) effectivePieces(chunk chunk, offlineMap map[string]bool, goodForRenewMap map[string]bool, uptimeMap map[string]float64) float64 {
+	// Handle partial chunk.
+	if cci, ok := sf.isIncludedPartialChunk(uint64(chunk.Index)); ok {
+		return sf.partialsSiaFile.EffectivePieces(int(cci.Index), offlineMap, goodForRenewMap, uptimeMap)
+	}
+	if sf.isIncompletePartialChunk(uint64(chunk.Index)) {
+		return 0
+	}
+
+	var effectivePieces float64
+	for _, pieceSet := range chunk.Pieces {
+		bestUptime := float64(0)
+		for _, piece := range pieceSet {
+			pk := sf.hostKey(piece.HostTableOffset).PublicKey.String()
+			offline, exists := offlineMap[pk]
+			if !exists || offline || !goodForRenewMap[pk] {
+				continue
+			}
+			uptime, known := uptimeMap[pk]
+			if !known {
+				uptime = 1
+			}
+			bestUptime = math.Max(bestUptime, math.Min(math.Max(uptime, 0), 1))
+		}
+		effectivePieces += bestUptime
+	}
+	return effectivePieces
+}
+
 // UploadProgressAndBytes is the exported wrapped for uploadProgressAndBytes.
 func (sf *SiaFile) UploadProgressAndBytes() (float64, uint64, error) {
 	sf.mu.Lock()
@@ -1234,8 +1416,10 @@ func (sf *SiaFile) setStuck(index uint64, stuck bool) (err error) {
 			chunk.Stuck = s
 		}
 	}()
-	// Update chunk and NumStuckChunks in siafile metadata
+	// Update chunk and NumStuckChunks in siafile metadata. The cached health
+	// is no longer up-to-date.
 	chunk.Stuck = stuck
+	sf.staticMetadata.CachedHealthUtilityHash = crypto.Hash{}
 	if stuck {
 		sf.staticMetadata.NumStuckChunks++
 	} else {
@@ -292,6 +292,136 @@ func TestFileRedundancy(t *testing.T) {
 	}
 }
 
+// TestFileEffectiveRedundancy tests that the effective redundancy of a file is
+// lower than the raw redundancy if one of the hosts has a bad uptime.
+func TestFileEffectiveRedundancy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create 2 hosts which are online and goodForRenew.
+	offline := make(map[string]bool)
+	goodForRenew := make(map[string]bool)
+	uptime := make(map[string]float64)
+	for i := 0; i < 2; i++ {
+		pk := types.SiaPublicKey{Key: []byte{byte(i)}}
+		offline[pk.String()] = false
+		goodForRenew[pk.String()] = true
+		uptime[pk.String()] = 1
+	}
+
+	// Create a file and upload both pieces of every chunk.
+	rsc, _ := NewRSCode(1, 1)
+	siaFilePath, _, source, _, sk, fileSize, numChunks, fileMode := newTestFileParamsWithRC(1, false, rsc)
+	f, _, _ := customTestFileAndWAL(siaFilePath, source, rsc, sk, fileSize, numChunks, fileMode)
+	for i := uint64(0); i < f.NumChunks(); i++ {
+		for j := 0; j < 2; j++ {
+			err := f.AddPiece(types.SiaPublicKey{Key: []byte{byte(j)}}, i, uint64(j), crypto.Hash{})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// With perfect uptime the effective redundancy should match the raw
+	// redundancy.
+	r, _, err := f.Redundancy(offline, goodForRenew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	er, err := f.EffectiveRedundancy(offline, goodForRenew, uptime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 2 || er != r {
+		t.Fatalf("expected redundancy and effective redundancy to be 2 but was %v and %v", r, er)
+	}
+
+	// Make the second host flaky. The effective redundancy should drop while
+	// the raw redundancy stays the same.
+	uptime[types.SiaPublicKey{Key: []byte{byte(1)}}.String()] = 0.5
+	r, _, err = f.Redundancy(offline, goodForRenew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	er, err = f.EffectiveRedundancy(offline, goodForRenew, uptime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 2 {
+		t.Fatal("expected redundancy to be 2 but was", r)
+	}
+	if er != 1.5 {
+		t.Fatal("expected effective redundancy to be 1.5 but was", er)
+	}
+	if f.staticMetadata.CachedEffectiveRedundancy != er {
+		t.Fatal("cached effective redundancy wasn't updated", f.staticMetadata.CachedEffectiveRedundancy, er)
+	}
+}
+
+// TestFileRepairSize tests that the repair size of a file counts every piece
+// which isn't stored on a goodForRenew host.
+func TestFileRepairSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create 2 hosts which are online and goodForRenew.
+	offline := make(map[string]bool)
+	goodForRenew := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		pk := types.SiaPublicKey{Key: []byte{byte(i)}}
+		offline[pk.String()] = false
+		goodForRenew[pk.String()] = true
+	}
+
+	// Create a file and upload the first piece of every chunk.
+	rsc, _ := NewRSCode(1, 1)
+	siaFilePath, _, source, _, sk, fileSize, numChunks, fileMode := newTestFileParamsWithRC(2, false, rsc)
+	f, _, _ := customTestFileAndWAL(siaFilePath, source, rsc, sk, fileSize, numChunks, fileMode)
+	for i := uint64(0); i < f.NumChunks(); i++ {
+		err := f.AddPiece(types.SiaPublicKey{Key: []byte{0}}, i, 0, crypto.Hash{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pieceSize := f.PieceSize()
+	repairSize, err := f.RepairSize(offline, goodForRenew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := f.NumChunks() * pieceSize; repairSize != expected {
+		t.Fatalf("expected repair size %v but was %v", expected, repairSize)
+	}
+
+	// Upload the second piece of the first chunk.
+	if err := f.AddPiece(types.SiaPublicKey{Key: []byte{1}}, 0, 1, crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	repairSize, err = f.RepairSize(offline, goodForRenew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (f.NumChunks() - 1) * pieceSize; repairSize != expected {
+		t.Fatalf("expected repair size %v but was %v", expected, repairSize)
+	}
+
+	// Take the first host offline. Its pieces need to be repaired as well.
+	offline[types.SiaPublicKey{Key: []byte{0}}.String()] = true
+	repairSize, err = f.RepairSize(offline, goodForRenew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (2*f.NumChunks() - 1) * pieceSize; repairSize != expected {
+		t.Fatalf("expected repair size %v but was %v", expected, repairSize)
+	}
+	if f.staticMetadata.CachedRepairSize != repairSize {
+		t.Fatal("cached repair size wasn't updated", f.staticMetadata.CachedRepairSize, repairSize)
+	}
+}
+
 // TestFileHealth tests that the health of the file is correctly calculated.
 //
 // Health is equal to (targetParityPieces - actualParityPieces)/targetParityPieces
@@ -656,6 +786,87 @@ func TestPruneHosts(t *testing.T) {
 	}
 }
 
+// TestPieceHostPublicKeys tests that PieceHostPublicKeys only returns the
+// hosts which store pieces of the file.
+func TestPieceHostPublicKeys(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	siaFilePath, _, source, rc, sk, fileSize, numChunks, fileMode := newTestFileParams(1, false)
+	sf, _, _ := customTestFileAndWAL(siaFilePath, source, rc, sk, fileSize, numChunks, fileMode)
+
+	// Add pieces for 2 hosts and a third host without pieces to the table.
+	used := []types.SiaPublicKey{{Key: []byte{1}}, {Key: []byte{2}}}
+	for i, spk := range used {
+		if err := sf.AddPiece(spk, 0, uint64(i), crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sf.pubKeyTable = append(sf.pubKeyTable, HostPublicKey{PublicKey: types.SiaPublicKey{Key: []byte{3}}, Used: true})
+	if len(sf.HostPublicKeys()) != 3 {
+		t.Fatal("expected 3 hosts in the table but got", len(sf.HostPublicKeys()))
+	}
+
+	// Only the hosts with pieces should be returned.
+	keys, err := sf.PieceHostPublicKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != len(used) {
+		t.Fatalf("expected %v hosts but got %v", len(used), len(keys))
+	}
+	for _, key := range keys {
+		if !key.Equals(used[0]) && !key.Equals(used[1]) {
+			t.Fatal("unexpected host", key)
+		}
+	}
+}
+
+// TestChunkUploadRetries tests that the upload retries are tracked per chunk
+// and reset once a chunk is fully uploaded.
+func TestChunkUploadRetries(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	siaFilePath, _, source, rc, sk, fileSize, numChunks, fileMode := newTestFileParams(2, false)
+	sf, _, _ := customTestFileAndWAL(siaFilePath, source, rc, sk, fileSize, numChunks, fileMode)
+
+	// Add retries to both chunks.
+	if err := sf.UpdateChunkUploadRetries(0, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.UpdateChunkUploadRetries(1, 3, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.UpdateChunkUploadRetries(1, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if sf.ChunkUploadRetries(0) != 2 || sf.ChunkUploadRetries(1) != 4 || sf.UploadRetries() != 6 {
+		t.Fatal("wrong retries", sf.ChunkUploadRetries(0), sf.ChunkUploadRetries(1), sf.UploadRetries())
+	}
+
+	// Once a chunk is fully uploaded its retries are reset.
+	if err := sf.UpdateChunkUploadRetries(1, 5, true); err != nil {
+		t.Fatal(err)
+	}
+	if sf.ChunkUploadRetries(1) != 0 || sf.UploadRetries() != 2 {
+		t.Fatal("retries weren't reset", sf.ChunkUploadRetries(1), sf.UploadRetries())
+	}
+
+	// The retries should be persisted.
+	sf, err := LoadSiaFile(sf.siaFilePath, sf.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.ChunkUploadRetries(0) != 2 || sf.UploadRetries() != 2 {
+		t.Fatal("retries weren't persisted", sf.ChunkUploadRetries(0), sf.UploadRetries())
+	}
+}
+
 // TestNumPieces tests the chunk's numPieces method.
 func TestNumPieces(t *testing.T) {
 	// create a random chunk.
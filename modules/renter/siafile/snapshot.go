@@ -15,6 +15,7 @@ type (
 	// representation of a siafile which only exists in memory.
 	Snapshot struct {
 		staticChunks          []Chunk
+		staticCompression     modules.CompressionCodec
 		staticFileSize        int64
 		staticPieceSize       uint64
 		staticErasureCode     modules.ErasureCoder
@@ -140,6 +141,11 @@ func (s *Snapshot) IsIncompletePartialChunk(chunkIndex uint64) bool {
 	return s.staticPartialChunks[idx].Status < CombinedChunkStatusCompleted
 }
 
+// Compression returns the codec the file was compressed with.
+func (s *Snapshot) Compression() modules.CompressionCodec {
+	return s.staticCompression
+}
+
 // LocalPath returns the localPath used to repair the file.
 func (s *Snapshot) LocalPath() string {
 	return s.staticLocalPath
@@ -271,6 +277,7 @@ func (sf *SiaFile) Snapshot(sp modules.SiaPath) (*Snapshot, error) {
 	hasPartial := sf.staticMetadata.HasPartialChunk
 	pcs := sf.staticMetadata.PartialChunks
 	localPath := sf.staticMetadata.LocalPath
+	compression := sf.staticMetadata.Compression
 	sf.mu.RUnlock()
 	//////////////////////////////////////////////////////////////////////////////
 	// RLock ends here.
@@ -278,6 +285,7 @@ func (sf *SiaFile) Snapshot(sp modules.SiaPath) (*Snapshot, error) {
 
 	return &Snapshot{
 		staticChunks:          chunks,
+		staticCompression:     compression,
 		staticPartialChunks:   pcs,
 		staticHasPartialChunk: hasPartial,
 		staticFileSize:        fileSize,
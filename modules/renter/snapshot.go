@@ -560,6 +560,11 @@ func (r *Renter) threadedSynchronizeSnapshots() {
 				if err != nil {
 					return errors.AddContext(err, "failed to get entry for snapshot")
 				}
+				// Read-only siafiles can't be deleted after the upload.
+				if entry.ReadOnly() {
+					entry.Close()
+					return errors.AddContext(ErrFileReadOnly, "unable to upload snapshot")
+				}
 				// Read the siafile from disk.
 				sr, err := entry.SnapshotReader()
 				if err != nil {
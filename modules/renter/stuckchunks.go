@@ -0,0 +1,143 @@
+package renter
+
+// stuckchunks.go implements the listing of the renter's stuck chunks. Next to
+// the location of every stuck chunk, the renter reports why the chunk is
+// stuck. The reason is derived from the same contract utility maps that are
+// used for the health calculation, so that it reflects what the repair loop
+// sees when it tries to repair the chunk.
+
+import (
+	"os"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+)
+
+// StuckChunks returns all the stuck chunks of the renter together with the
+// reason they are stuck. Every file is checked, not only the files the cached
+// metadata reports stuck chunks for, since that metadata is only updated by
+// the next bubble.
+func (r *Renter) StuckChunks() ([]modules.StuckChunkInfo, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	files, _, err := r.staticFileSystem.CachedList(modules.RootSiaPath(), true)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to list files")
+	}
+	offline, goodForRenew, contracts := r.managedContractUtilityMaps()
+	var stuckChunks []modules.StuckChunkInfo
+	for _, fi := range files {
+		if isTrashPath(fi.SiaPath) {
+			continue
+		}
+		sf, err := r.staticFileSystem.OpenSiaFile(fi.SiaPath)
+		if errors.Contains(err, filesystem.ErrNotExist) {
+			// The file was deleted since it was listed.
+			continue
+		}
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to open file")
+		}
+		chunks, err := fileStuckChunks(fi.SiaPath, sf, offline, goodForRenew, contracts)
+		err = errors.Compose(err, sf.Close())
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to get stuck chunks of "+fi.SiaPath.String())
+		}
+		stuckChunks = append(stuckChunks, chunks...)
+	}
+	return stuckChunks, nil
+}
+
+// fileStuckChunks returns the stuck chunks of a single file.
+func fileStuckChunks(siaPath modules.SiaPath, sf *filesystem.FileNode, offline, goodForRenew map[string]bool, contracts map[string]modules.RenterContract) ([]modules.StuckChunkInfo, error) {
+	_, err := os.Stat(sf.LocalPath())
+	localFileMissing := os.IsNotExist(err)
+	ec := sf.ErasureCode()
+
+	var stuckChunks []modules.StuckChunkInfo
+	for chunkIndex := uint64(0); chunkIndex < sf.NumChunks(); chunkIndex++ {
+		stuck, err := sf.StuckChunkByIndex(chunkIndex)
+		if err != nil {
+			return nil, err
+		}
+		if !stuck {
+			continue
+		}
+		pieces, err := sf.Pieces(chunkIndex)
+		if err != nil {
+			return nil, err
+		}
+		stuckChunks = append(stuckChunks, modules.StuckChunkInfo{
+			SiaPath:    siaPath,
+			ChunkIndex: chunkIndex,
+			Reason:     stuckChunkReason(pieces, ec.MinPieces(), ec.NumPieces(), localFileMissing, offline, goodForRenew, contracts),
+		})
+	}
+	return stuckChunks, nil
+}
+
+// stuckChunkReason determines why a chunk with the provided pieces is stuck.
+// Pieces only count towards the chunk's redundancy if their host is online and
+// good for renew, which mirrors the health calculation. A chunk that can't be
+// recovered since its local source is missing is reported as such before
+// checking whether there are enough hosts to upload the missing pieces to.
+func stuckChunkReason(pieces [][]siafile.Piece, minPieces, numPieces int, localFileMissing bool, offline, goodForRenew map[string]bool, contracts map[string]modules.RenterContract) modules.StuckChunkReason {
+	usedHosts := make(map[string]struct{})
+	var goodPieces, offlineHosts, goodHosts int
+	for _, pieceSet := range pieces {
+		pieceIsGood := false
+		for _, piece := range pieceSet {
+			hpk := piece.HostPubKey.String()
+			if _, used := usedHosts[hpk]; !used {
+				usedHosts[hpk] = struct{}{}
+				if offline[hpk] {
+					offlineHosts++
+				} else if goodForRenew[hpk] {
+					goodHosts++
+				}
+			}
+			gfr, exists := goodForRenew[hpk]
+			off, exists2 := offline[hpk]
+			if exists && exists2 && gfr && !off {
+				pieceIsGood = true
+			}
+		}
+		if pieceIsGood {
+			goodPieces++
+		}
+	}
+
+	// Without a local source the chunk can only be repaired if enough pieces
+	// are stored on good hosts.
+	if localFileMissing && goodPieces < minPieces {
+		switch {
+		case len(usedHosts) > 0 && offlineHosts == len(usedHosts):
+			return modules.StuckReasonAllPiecesOffline
+		case len(usedHosts) > 0 && goodHosts == 0:
+			return modules.StuckReasonNoGoodHosts
+		default:
+			return modules.StuckReasonInsufficientPieces
+		}
+	}
+
+	// Check if there are enough hosts to upload the missing pieces to. Hosts
+	// that already store a piece of the chunk are not used again.
+	var availableHosts int
+	for hpk, contract := range contracts {
+		if _, used := usedHosts[hpk]; used {
+			continue
+		}
+		if contract.Utility.GoodForUpload && !offline[hpk] {
+			availableHosts++
+		}
+	}
+	if availableHosts < numPieces-goodPieces {
+		return modules.StuckReasonNotEnoughHosts
+	}
+	return modules.StuckReasonRepairFailed
+}
@@ -0,0 +1,114 @@
+package renter
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestStuckChunkReason probes stuckChunkReason.
+func TestStuckChunkReason(t *testing.T) {
+	// Create 4 hosts. Host 0 and 1 are good, host 2 is offline and host 3 is
+	// online but not good for renew.
+	hosts := make([]types.SiaPublicKey, 4)
+	offline := make(map[string]bool)
+	goodForRenew := make(map[string]bool)
+	contracts := make(map[string]modules.RenterContract)
+	for i := range hosts {
+		hosts[i] = types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)}
+		hpk := hosts[i].String()
+		offline[hpk] = i == 2
+		goodForRenew[hpk] = i < 2
+		contracts[hpk] = modules.RenterContract{
+			HostPublicKey: hosts[i],
+			Utility:       modules.ContractUtility{GoodForUpload: i < 2, GoodForRenew: i < 2},
+		}
+	}
+	piece := func(host int) []siafile.Piece {
+		return []siafile.Piece{{HostPubKey: hosts[host]}}
+	}
+
+	tests := []struct {
+		name             string
+		pieces           [][]siafile.Piece
+		localFileMissing bool
+		reason           modules.StuckChunkReason
+	}{
+		{"all offline", [][]siafile.Piece{piece(2), nil, nil}, true, modules.StuckReasonAllPiecesOffline},
+		{"no good hosts", [][]siafile.Piece{piece(2), piece(3), nil}, true, modules.StuckReasonNoGoodHosts},
+		{"no pieces", [][]siafile.Piece{nil, nil, nil}, true, modules.StuckReasonInsufficientPieces},
+		{"not enough hosts", [][]siafile.Piece{piece(2), piece(3), nil}, false, modules.StuckReasonNotEnoughHosts},
+		{"used hosts", [][]siafile.Piece{piece(0), nil, nil}, false, modules.StuckReasonNotEnoughHosts},
+		{"repair failed", [][]siafile.Piece{piece(0), piece(0), piece(1)}, false, modules.StuckReasonRepairFailed},
+		{"recoverable without source", [][]siafile.Piece{piece(0), nil, nil}, true, modules.StuckReasonNotEnoughHosts},
+	}
+	for _, test := range tests {
+		// The tests use a 1-of-3 erasure code. Since there are only 2 good
+		// hosts, a chunk needs at least 1 good piece to have enough hosts.
+		reason := stuckChunkReason(test.pieces, 1, 3, test.localFileMissing, offline, goodForRenew, contracts)
+		if reason != test.reason {
+			t.Errorf("%v: expected reason '%v' but got '%v'", test.name, test.reason, reason)
+		}
+	}
+}
+
+// TestStuckChunks tests listing the stuck chunks of the renter.
+func TestStuckChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file with 2 chunks and a file without stuck chunks.
+	rsc, _ := siafile.NewRSCode(1, 1)
+	stuckPath := modules.RandomSiaPath()
+	okPath := modules.RandomSiaPath()
+	for _, siaPath := range []modules.SiaPath{stuckPath, okPath} {
+		err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 2*modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(stuckPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.NumChunks() != 2 {
+		t.Fatal("expected 2 chunks but got", sf.NumChunks())
+	}
+	if err := sf.SetStuck(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the stuck chunk is returned. Since the file has no local source and
+	// no pieces, it can't be recovered.
+	chunks, err := rt.renter.StuckChunks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 1 {
+		t.Fatal("expected 1 stuck chunk but got", len(chunks))
+	}
+	if !chunks[0].SiaPath.Equals(stuckPath) || chunks[0].ChunkIndex != 1 {
+		t.Fatal("wrong stuck chunk", chunks[0])
+	}
+	if chunks[0].Reason != modules.StuckReasonInsufficientPieces {
+		t.Fatal("wrong reason", chunks[0].Reason)
+	}
+}
@@ -0,0 +1,247 @@
+package renter
+
+// trash.go implements the renter's trash. If the trash is enabled, deleted
+// files are moved to a directory named after the time of the deletion within
+// the hidden trash directory instead of being deleted. From there they can be
+// restored until the retention is over, after which they are permanently
+// removed by a background thread.
+//
+// Trashed files still count towards the size of the filesystem but are not
+// considered by the repair and stuck loops and are hidden from the listings of
+// the renter. The trash directory is reserved, users can't upload files to it
+// or create and rename files and directories into it.
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errNotInTrash is returned by RestoreFromTrash if the trash doesn't
+	// contain a file with the given siapath.
+	errNotInTrash = errors.New("file not found in trash")
+
+	// errNegativeTrashRetention is returned by SetTrashRetention if the
+	// retention is negative.
+	errNegativeTrashRetention = errors.New("trash retention can't be negative")
+
+	// errTrashPath is returned if a user tries to create a file or directory
+	// within the trash.
+	errTrashPath = errors.New("the trash directory is reserved")
+)
+
+// isTrashPath returns whether the siapath points to the trash directory or a
+// file or directory within it.
+func isTrashPath(siaPath modules.SiaPath) bool {
+	return siaPath.Path == modules.TrashRoot || strings.HasPrefix(siaPath.Path, modules.TrashRoot+"/")
+}
+
+// checkTrashPath returns errTrashPath if siaPath is within the trash.
+func checkTrashPath(siaPath modules.SiaPath) error {
+	if isTrashPath(siaPath) {
+		return errTrashPath
+	}
+	return nil
+}
+
+// filterTrash removes the files within the trash from fis.
+func filterTrash(fis []modules.FileInfo) []modules.FileInfo {
+	filtered := fis[:0]
+	for _, fi := range fis {
+		if !isTrashPath(fi.SiaPath) {
+			filtered = append(filtered, fi)
+		}
+	}
+	return filtered
+}
+
+// filterTrashDirs removes the trash and the directories within it from dis.
+func filterTrashDirs(dis []modules.DirectoryInfo) []modules.DirectoryInfo {
+	filtered := dis[:0]
+	for _, di := range dis {
+		if !isTrashPath(di.SiaPath) {
+			filtered = append(filtered, di)
+		}
+	}
+	return filtered
+}
+
+// RestoreFromTrash moves the most recently deleted version of the file at
+// siaPath from the trash back to its original location.
+func (r *Renter) RestoreFromTrash(siaPath modules.SiaPath) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	timestamps, err := r.managedTrashTimestamps()
+	if err != nil {
+		return err
+	}
+	// Check the most recent deletions first.
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] > timestamps[j]
+	})
+	for _, ts := range timestamps {
+		trashPath, err := trashSiaPath(ts, siaPath)
+		if err != nil {
+			return err
+		}
+		exists, err := r.staticFileSystem.FileExists(trashPath)
+		if err != nil {
+			return errors.AddContext(err, "failed to check trash for file")
+		}
+		if !exists {
+			continue
+		}
+		return r.RenameFile(trashPath, siaPath)
+	}
+	return errNotInTrash
+}
+
+// SetTrashRetention sets the duration a deleted file is kept in the trash. A
+// retention of 0 disables the trash. Files which were already moved to the
+// trash are removed once they exceed the new retention.
+func (r *Renter) SetTrashRetention(retention time.Duration) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if retention < 0 {
+		return errNegativeTrashRetention
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.TrashRetention = retention
+	return r.saveSync()
+}
+
+// managedTrashRetention returns the duration a deleted file is kept in the
+// trash.
+func (r *Renter) managedTrashRetention() time.Duration {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	return r.persist.TrashRetention
+}
+
+// managedMoveToTrash moves the file at siaPath into the trash.
+func (r *Renter) managedMoveToTrash(siaPath modules.SiaPath) error {
+	trashPath, err := trashSiaPath(time.Now().UnixNano(), siaPath)
+	if err != nil {
+		return err
+	}
+	return r.managedRenameFile(siaPath, trashPath)
+}
+
+// managedMoveDirToTrash moves the directory at siaPath and all of its files
+// into the trash.
+func (r *Renter) managedMoveDirToTrash(siaPath modules.SiaPath) error {
+	trashPath, err := trashSiaPath(time.Now().UnixNano(), siaPath)
+	if err != nil {
+		return err
+	}
+	return r.managedRenameDir(siaPath, trashPath)
+}
+
+// managedTrashTimestamps returns the timestamps of the deletions in the trash.
+func (r *Renter) managedTrashTimestamps() ([]int64, error) {
+	fis, err := r.staticFileSystem.ReadDir(modules.TrashSiaPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to read trash")
+	}
+	var timestamps []int64
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		ts, err := strconv.ParseInt(fi.Name(), 10, 64)
+		if err != nil {
+			r.log.Printf("WARN: unexpected directory %v in trash", fi.Name())
+			continue
+		}
+		timestamps = append(timestamps, ts)
+	}
+	return timestamps, nil
+}
+
+// managedPurgeTrash permanently removes the files from the trash which were
+// deleted longer than the trash retention ago.
+func (r *Renter) managedPurgeTrash() error {
+	timestamps, err := r.managedTrashTimestamps()
+	if err != nil {
+		return err
+	}
+	retention := r.managedTrashRetention()
+	var purged bool
+	for _, ts := range timestamps {
+		if time.Since(time.Unix(0, ts)) < retention {
+			continue
+		}
+		dir, err := modules.TrashSiaPath().Join(strconv.FormatInt(ts, 10))
+		if err != nil {
+			return err
+		}
+		// Purge the files one by one to also remove their staging copies and
+		// the rest of their state. Then remove the remaining directories. A
+		// file which can't be purged, e.g. because it is read-only, is still
+		// removed with its directory and doesn't stop the other files from
+		// being purged.
+		fis, _, err := r.staticFileSystem.CachedList(dir, true)
+		if err != nil {
+			return errors.AddContext(err, fmt.Sprintf("failed to list %v in trash", dir))
+		}
+		for _, fi := range fis {
+			if err := r.managedPurgeFile(fi.SiaPath); err != nil {
+				r.log.Printf("WARN: failed to purge %v from trash: %v", fi.SiaPath, err)
+			}
+		}
+		if err := r.staticFileSystem.DeleteDir(dir); err != nil {
+			return errors.AddContext(err, fmt.Sprintf("failed to purge %v from trash", dir))
+		}
+		r.managedRemoveActiveUploadsDir(dir)
+		purged = true
+	}
+	if purged {
+		go r.callThreadedBubbleMetadata(modules.TrashSiaPath())
+	}
+	return nil
+}
+
+// threadedPurgeTrash periodically removes the files from the trash which
+// exceeded the trash retention.
+func (r *Renter) threadedPurgeTrash() {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+	for {
+		select {
+		case <-r.tg.StopChan():
+			return
+		case <-time.After(trashPurgeInterval):
+		}
+		if err := r.managedPurgeTrash(); err != nil {
+			r.log.Println("WARN: failed to purge trash:", err)
+		}
+	}
+}
+
+// trashSiaPath returns the siapath of a file in the trash that was deleted at
+// the time ts.
+func trashSiaPath(ts int64, siaPath modules.SiaPath) (modules.SiaPath, error) {
+	dir, err := modules.TrashSiaPath().Join(strconv.FormatInt(ts, 10))
+	if err != nil {
+		return modules.SiaPath{}, err
+	}
+	return dir.Join(siaPath.String())
+}
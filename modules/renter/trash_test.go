@@ -0,0 +1,344 @@
+package renter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestTrash tests moving deleted files to the trash, restoring them and
+// purging the trash.
+func TestTrash(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file.
+	siaPath, err := modules.NewSiaPath("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileSize := uint64(100)
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), fileSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Negative retentions are invalid.
+	if err := r.SetTrashRetention(-time.Second); !errors.Contains(err, errNegativeTrashRetention) {
+		t.Fatal("expected errNegativeTrashRetention but got", err)
+	}
+
+	// Enable the trash and delete the file.
+	if err := r.SetTrashRetention(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteFile(siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := r.staticFileSystem.FileExists(siaPath); err != nil || exists {
+		t.Fatal("file should have been moved", exists, err)
+	}
+
+	// The trashed file should count towards the size of the root but not
+	// towards the number of files.
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if stats := r.BubbleQueueStats(); stats != (modules.BubbleQueueStats{}) {
+			return fmt.Errorf("bubbles still queued: %v", stats)
+		}
+		md, err := r.managedDirectoryMetadata(modules.RootSiaPath())
+		if err != nil {
+			return err
+		}
+		if md.AggregateSize != fileSize || md.AggregateNumFiles != 0 {
+			return fmt.Errorf("wrong root metadata: size %v, files %v", md.AggregateSize, md.AggregateNumFiles)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subDirs, err := r.managedSubDirectories(modules.RootSiaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subDir := range subDirs {
+		if isTrashPath(subDir) {
+			t.Fatal("trash shouldn't be returned as sub directory")
+		}
+	}
+
+	// The trash should be hidden from the listings.
+	fis, err := r.FileList(modules.RootSiaPath(), true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 0 {
+		t.Fatal("trashed file shouldn't be listed", fis)
+	}
+	if fis, err := r.FilesByHealth(0, 100); err != nil || len(fis) != 0 {
+		t.Fatal("trashed file shouldn't be listed", fis, err)
+	}
+	dis, err := r.DirList(modules.RootSiaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, di := range dis {
+		if isTrashPath(di.SiaPath) {
+			t.Fatal("trash shouldn't be listed")
+		}
+	}
+
+	// The trash is reserved.
+	trashDir, err := modules.TrashSiaPath().Join("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateDir(trashDir, modules.DefaultDirPerm); !errors.Contains(err, errTrashPath) {
+		t.Fatal("expected errTrashPath but got", err)
+	}
+	if err := r.RenameDir(modules.SiaPath{Path: "dir"}, trashDir); !errors.Contains(err, errTrashPath) {
+		t.Fatal("expected errTrashPath but got", err)
+	}
+
+	// Restore the file.
+	if err := r.RestoreFromTrash(siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := r.staticFileSystem.FileExists(siaPath); err != nil || !exists {
+		t.Fatal("file should have been restored", exists, err)
+	}
+	if err := r.RestoreFromTrash(siaPath); !errors.Contains(err, errNotInTrash) {
+		t.Fatal("expected errNotInTrash but got", err)
+	}
+
+	// Delete the file again and purge the trash with a retention that is
+	// exceeded right away.
+	if err := r.DeleteFile(siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetTrashRetention(time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedPurgeTrash(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RestoreFromTrash(siaPath); !errors.Contains(err, errNotInTrash) {
+		t.Fatal("expected errNotInTrash but got", err)
+	}
+
+	// With the trash disabled files are deleted right away.
+	if err := r.SetTrashRetention(0); err != nil {
+		t.Fatal(err)
+	}
+	err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), fileSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteFile(siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RestoreFromTrash(siaPath); !errors.Contains(err, errNotInTrash) {
+		t.Fatal("expected errNotInTrash but got", err)
+	}
+}
+
+// TestTrashDir tests that deleted directories are moved to the trash.
+func TestTrashDir(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file in a directory and delete the directory with the trash
+	// enabled.
+	siaPath, err := modules.NewSiaPath("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetTrashRetention(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteDir(modules.SiaPath{Path: "dir"}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := r.staticFileSystem.FileExists(siaPath); err != nil || exists {
+		t.Fatal("file should have been moved", exists, err)
+	}
+
+	// The file should be restorable from the trash.
+	if err := r.RestoreFromTrash(siaPath); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := r.staticFileSystem.FileExists(siaPath); err != nil || !exists {
+		t.Fatal("file should have been restored", exists, err)
+	}
+}
+
+// TestPurgeTrashCleanup tests that purging the trash removes the compressed
+// staging copies and the contract index entries of the purged files.
+func TestPurgeTrashCleanup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a compressed file with a staging copy.
+	siaPath, err := modules.NewSiaPath("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = r.staticFileSystem.NewCompressedSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 50, 100, modules.CompressionGzip, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedPath := r.compressedUploadPath(entry.UID(), modules.CompressionGzip)
+	entry.Close()
+	if err := os.MkdirAll(filepath.Dir(compressedPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(compressedPath, fastrand.Bytes(50), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r.managedAddToContractIndex(siaPath, types.SiaPublicKey{Key: fastrand.Bytes(32)})
+
+	// Move the directory to the trash and purge it.
+	if err := r.SetTrashRetention(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteDir(modules.SiaPath{Path: "dir"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(compressedPath); err != nil {
+		t.Fatal("staging copy of trashed file should still exist", err)
+	}
+	if err := r.SetTrashRetention(time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedPurgeTrash(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(compressedPath); !os.IsNotExist(err) {
+		t.Fatal("staging copy wasn't removed", err)
+	}
+	r.contractIndexMu.Lock()
+	numEntries := len(r.contractIndex)
+	r.contractIndexMu.Unlock()
+	if numEntries != 0 {
+		t.Fatal("contract index entry wasn't removed", numEntries)
+	}
+	if timestamps, err := r.managedTrashTimestamps(); err != nil || len(timestamps) != 0 {
+		t.Fatal("trash wasn't purged", timestamps, err)
+	}
+}
+
+// TestPurgeTrashReadOnly tests that files in the trash can't be made read-only
+// and that read-only files in the trash don't prevent it from being purged.
+func TestPurgeTrashReadOnly(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a directory with two files and move it to the trash.
+	rsc, _ := siafile.NewRSCode(1, 1)
+	for _, name := range []string{"dir/file1", "dir/file2"} {
+		siaPath, err := modules.NewSiaPath(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.SetTrashRetention(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteDir(modules.SiaPath{Path: "dir"}); err != nil {
+		t.Fatal(err)
+	}
+	fis, _, err := r.staticFileSystem.CachedList(modules.TrashSiaPath(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 2 {
+		t.Fatal("expected 2 files in the trash but got", len(fis))
+	}
+
+	// Trashed files can't be made read-only.
+	if err := r.SetReadOnly(fis[0].SiaPath, true); !errors.Contains(err, errTrashPath) {
+		t.Fatal("expected errTrashPath but got", err)
+	}
+
+	// Mark the first file read-only anyway. Purging the trash should still
+	// remove both files.
+	entry, err := r.staticFileSystem.OpenSiaFile(fis[0].SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = entry.SetReadOnly(true)
+	entry.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetTrashRetention(time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedPurgeTrash(); err != nil {
+		t.Fatal(err)
+	}
+	if timestamps, err := r.managedTrashTimestamps(); err != nil || len(timestamps) != 0 {
+		t.Fatal("trash wasn't purged", timestamps, err)
+	}
+}
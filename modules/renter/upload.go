@@ -11,6 +11,8 @@ package renter
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"gitlab.com/NebulousLabs/errors"
 
@@ -19,79 +21,432 @@ import (
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 var (
-	// errUploadDirectory is returned if the user tries to upload a directory.
-	errUploadDirectory = errors.New("cannot upload directory")
+	// ErrInvalidCipherKey is returned if the cipher key provided for an upload
+	// is invalid.
+	ErrInvalidCipherKey = errors.New("invalid cipher key")
+
+	// ErrInsufficientContracts is returned if the renter doesn't have enough
+	// contracts to upload a file with the requested redundancy.
+	ErrInsufficientContracts = errors.New("not enough contracts to upload file")
+
+	// ErrInvalidErasureCoder is returned if the erasure coder of an upload
+	// can't be used to create a file.
+	ErrInvalidErasureCoder = errors.New("invalid erasure coder")
+
+	// ErrUploadDirectory is returned if the user tries to upload a directory.
+	ErrUploadDirectory = errors.New("cannot upload directory")
+
+	// ErrSiaPathTooDeep is returned if the siapath of an upload is nested in
+	// more than maxSiaPathDepth directories.
+	ErrSiaPathTooDeep = errors.New("siapath is nested too deeply")
+
+	// ErrSiaPathTooLong is returned if the on-disk path of an upload's
+	// siafile would exceed the limits of the filesystem.
+	ErrSiaPathTooLong = errors.New("siapath is too long")
+
+	// errUploadNotDirectory is returned if the user tries to upload a file
+	// using UploadDirectory.
+	errUploadNotDirectory = errors.New("source is not a directory")
+
+	// errInvalidRedundancy is returned if the user tries to set a default
+	// redundancy with less than 1 data or parity piece.
+	errInvalidRedundancy = errors.New("data and parity pieces must both be at least 1")
 )
 
-// Upload instructs the renter to start tracking a file. The renter will
-// automatically upload and repair tracked files using a background loop.
-func (r *Renter) Upload(up modules.FileUploadParams) error {
+// validateSiaPathLimits checks that the siapath of an upload and the resulting
+// on-disk path of its siafile, sysPath, don't exceed the depth and length
+// limits.
+func validateSiaPathLimits(siaPath modules.SiaPath, sysPath string) error {
+	elements := strings.Split(siaPath.String(), "/")
+	if depth := len(elements) - 1; depth > maxSiaPathDepth {
+		return errors.AddContext(ErrSiaPathTooDeep, fmt.Sprintf("depth %v exceeds the maximum of %v", depth, maxSiaPathDepth))
+	}
+	for i, elem := range elements {
+		length := len(elem)
+		if i == len(elements)-1 {
+			length += len(modules.SiaFileExtension)
+		}
+		if length > maxSiaPathElementLength {
+			return errors.AddContext(ErrSiaPathTooLong, fmt.Sprintf("element '%v' exceeds the maximum length of %v", elem, maxSiaPathElementLength))
+		}
+	}
+	if len(sysPath) > maxSiaFileSysPathLength {
+		return errors.AddContext(ErrSiaPathTooLong, fmt.Sprintf("on-disk path length %v exceeds the maximum of %v", len(sysPath), maxSiaFileSysPathLength))
+	}
+	return nil
+}
+
+// validateErasureCoder checks that ec can be used to upload a file. A coder
+// without data pieces results in empty chunks and a coder without parity
+// pieces can't be repaired.
+func validateErasureCoder(ec modules.ErasureCoder) error {
+	minPieces, numPieces := ec.MinPieces(), ec.NumPieces()
+	if minPieces <= 0 {
+		return errors.Extend(fmt.Errorf("erasure coder has %v min pieces", minPieces), ErrInvalidErasureCoder)
+	}
+	if numPieces <= minPieces {
+		return errors.Extend(fmt.Errorf("erasure coder has %v pieces but needs more than its %v min pieces", numPieces, minPieces), ErrInvalidErasureCoder)
+	}
+	return nil
+}
+
+// managedDefaultErasureCode returns the erasure coder used for uploads to
+// siaPath that don't specify their own erasure code. The default of the
+// nearest ancestor directory takes precedence over the renter's default.
+func (r *Renter) managedDefaultErasureCode(siaPath modules.SiaPath) (modules.ErasureCoder, error) {
+	dataPieces, parityPieces, err := r.managedDirDefaultRedundancy(siaPath)
+	if err != nil {
+		return nil, errors.AddContext(err, "unable to get default redundancy of parent directories")
+	}
+	if dataPieces == 0 || parityPieces == 0 {
+		id := r.mu.RLock()
+		dataPieces, parityPieces = r.persist.DefaultDataPieces, r.persist.DefaultParityPieces
+		r.mu.RUnlock(id)
+	}
+	if dataPieces == 0 || parityPieces == 0 {
+		dataPieces, parityPieces = DefaultDataPieces, DefaultParityPieces
+	}
+	return siafile.NewRSSubCode(dataPieces, parityPieces, crypto.SegmentSize)
+}
+
+// managedDirDefaultRedundancy walks up the directory tree starting at the
+// parent of siaPath and returns the default redundancy of the first directory
+// which has one set. Directories which don't exist yet are skipped. If none of
+// the directories has a default, 0 is returned for both values.
+func (r *Renter) managedDirDefaultRedundancy(siaPath modules.SiaPath) (int, int, error) {
+	dir := siaPath
+	for !dir.IsRoot() {
+		var err error
+		dir, err = dir.Dir()
+		if err != nil {
+			return 0, 0, err
+		}
+		md, err := r.managedLoadDirMetadata(dir)
+		if errors.Contains(err, filesystem.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, 0, errors.AddContext(err, fmt.Sprintf("unable to load metadata of %v", dir))
+		}
+		if md.DefaultDataPieces > 0 && md.DefaultParityPieces > 0 {
+			return md.DefaultDataPieces, md.DefaultParityPieces, nil
+		}
+	}
+	return 0, 0, nil
+}
+
+// uploadCipherKey returns the key used to encrypt an upload. If key is nil, a
+// new key of the default type is generated. Otherwise the key is validated and
+// used verbatim.
+func uploadCipherKey(key crypto.CipherKey) (crypto.CipherKey, error) {
+	if key == nil {
+		return crypto.GenerateSiaKey(crypto.TypeDefaultRenter), nil
+	}
+	if !crypto.IsValidCipherType(key.Type()) {
+		return nil, errors.Extend(crypto.ErrInvalidCipherType, ErrInvalidCipherKey)
+	}
+	// Make sure that the key matches its type by recreating it.
+	if _, err := crypto.NewSiaKey(key.Type(), key.Key()); err != nil {
+		return nil, errors.Extend(err, ErrInvalidCipherKey)
+	}
+	return key, nil
+}
+
+// checkUploadContracts checks that numContracts are enough to upload a file
+// with the provided erasure code. We need at least data + parity/2 contracts.
+// NumPieces is equal to data+parity, and min pieces is equal to data.
+// Therefore (NumPieces+MinPieces)/2 = (data+data+parity)/2 = data+parity/2. If
+// allowLowRedundancy is set, MinPieces contracts are sufficient and
+// lowRedundancy indicates whether the upload won't reach the full redundancy
+// right away.
+func checkUploadContracts(numContracts int, ec modules.ErasureCoder, allowLowRedundancy bool) (lowRedundancy bool, err error) {
+	requiredContracts := (ec.NumPieces() + ec.MinPieces()) / 2
+	if numContracts >= requiredContracts {
+		return false, nil
+	}
+	if allowLowRedundancy && numContracts >= ec.MinPieces() {
+		return true, nil
+	}
+	if allowLowRedundancy {
+		requiredContracts = ec.MinPieces()
+	}
+	return false, errors.Compose(ErrInsufficientContracts, fmt.Errorf("got %v, needed %v", numContracts, requiredContracts))
+}
+
+// managedCheckUploadContracts checks that the renter has enough contracts to
+// upload the file at siaPath and logs a warning if the upload is allowed with
+// a lower redundancy.
+func (r *Renter) managedCheckUploadContracts(siaPath modules.SiaPath, ec modules.ErasureCoder, allowLowRedundancy bool) error {
+	numContracts := len(r.hostContractor.Contracts())
+	lowRedundancy, err := checkUploadContracts(numContracts, ec, allowLowRedundancy)
+	if err != nil {
+		return err
+	}
+	if lowRedundancy {
+		r.log.Printf("WARN: uploading %v with only %v contracts, the file won't reach its full redundancy until more contracts are formed", siaPath, numContracts)
+	}
+	return nil
+}
+
+// managedCheckDefaultRedundancy checks whether dataPieces and parityPieces
+// are valid default erasure coding settings and whether the renter has enough
+// contracts to upload with them.
+func (r *Renter) managedCheckDefaultRedundancy(dataPieces, parityPieces int) error {
+	if dataPieces < 1 || parityPieces < 1 {
+		return errInvalidRedundancy
+	}
+	// Make sure the renter has enough contracts to upload with the new
+	// settings. This is the same requirement that Upload enforces.
+	if build.Release != "testing" {
+		numContracts := len(r.hostContractor.Contracts())
+		requiredContracts := dataPieces + parityPieces/2
+		if numContracts < requiredContracts {
+			return fmt.Errorf("not enough contracts for %v data and %v parity pieces: got %v, needed %v", dataPieces, parityPieces, numContracts, requiredContracts)
+		}
+	}
+	return nil
+}
+
+// SetDefaultRedundancy sets the number of data and parity pieces used for all
+// future uploads that don't specify an erasure code. The setting is persisted.
+func (r *Renter) SetDefaultRedundancy(dataPieces, parityPieces int) error {
 	if err := r.tg.Add(); err != nil {
 		return err
 	}
 	defer r.tg.Done()
+	if err := r.managedCheckDefaultRedundancy(dataPieces, parityPieces); err != nil {
+		return err
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.DefaultDataPieces = dataPieces
+	r.persist.DefaultParityPieces = parityPieces
+	return r.saveSync()
+}
+
+// managedUploadEstimate computes the number of chunks and sectors required to
+// upload a file of size fileSize using up and the cipher type ct and estimates
+// the cost of storing the file for a period using the hosts the renter has
+// contracts with.
+func (r *Renter) managedUploadEstimate(up modules.FileUploadParams, ct crypto.CipherType, fileSize uint64) modules.UploadEstimate {
+	ec := up.ErasureCode
+	chunkSize := (modules.SectorSize - ct.Overhead()) * uint64(ec.MinPieces())
+	numChunks := fileSize / chunkSize
+	if fileSize%chunkSize != 0 {
+		numChunks++
+	}
+	numSectors := numChunks * uint64(ec.NumPieces())
+
+	// Average the prices of the hosts we have contracts with.
+	contracts := r.hostContractor.Contracts()
+	var storagePrice, uploadPrice types.Currency
+	var numHosts uint64
+	for _, c := range contracts {
+		host, ok, err := r.hostDB.Host(c.HostPublicKey)
+		if err != nil || !ok {
+			continue
+		}
+		storagePrice = storagePrice.Add(host.StoragePrice)
+		uploadPrice = uploadPrice.Add(host.UploadBandwidthPrice)
+		numHosts++
+	}
+	estimate := modules.UploadEstimate{
+		NumChunks:    numChunks,
+		NumSectors:   numSectors,
+		NumContracts: ec.NumPieces(),
+	}
+	if len(contracts) < estimate.NumContracts {
+		estimate.NumContracts = len(contracts)
+	}
+	if numHosts > 0 {
+		period := uint64(r.hostContractor.Allowance().Period)
+		uploadedBytes := numSectors * modules.SectorSize
+		estimate.StorageCost = storagePrice.Mul64(uploadedBytes).Mul64(period).Div64(numHosts)
+		estimate.UploadCost = uploadPrice.Mul64(uploadedBytes).Div64(numHosts)
+	}
+	return estimate
+}
+
+// Upload instructs the renter to start tracking a file. The renter will
+// automatically upload and repair tracked files using a background loop. If
+// up.DryRun is set, the upload is only validated and the returned estimate can
+// be used to decide whether to start the upload for real.
+func (r *Renter) Upload(up modules.FileUploadParams) (modules.UploadEstimate, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.UploadEstimate{}, err
+	}
+	defer r.tg.Done()
+
+	// Check the siapath.
+	if err := up.SiaPath.Validate(false); err != nil {
+		return modules.UploadEstimate{}, err
+	}
+	if err := checkTrashPath(up.SiaPath); err != nil {
+		return modules.UploadEstimate{}, err
+	}
+	if err := validateSiaPathLimits(up.SiaPath, r.staticFileSystem.FilePath(up.SiaPath)); err != nil {
+		return modules.UploadEstimate{}, err
+	}
+
+	// Check the cipher key.
+	sk, err := uploadCipherKey(up.CipherKey)
+	if err != nil {
+		return modules.UploadEstimate{}, err
+	}
+
+	// Check the compression codec.
+	if err := validateCompression(up.Compression); err != nil {
+		return modules.UploadEstimate{}, err
+	}
 
 	// Check if the file is a directory.
 	sourceInfo, err := os.Stat(up.Source)
 	if err != nil {
-		return errors.AddContext(err, "unable to stat input file")
+		return modules.UploadEstimate{}, errors.AddContext(err, "unable to stat input file")
 	}
 	if sourceInfo.IsDir() {
-		return errUploadDirectory
+		return modules.UploadEstimate{}, ErrUploadDirectory
 	}
 
 	// Check for read access.
 	file, err := os.Open(up.Source)
 	if err != nil {
-		return errors.AddContext(err, "unable to open the source file")
+		return modules.UploadEstimate{}, errors.AddContext(err, "unable to open the source file")
 	}
 	file.Close()
 
-	// Delete existing file if overwrite flag is set. Ignore ErrUnknownPath.
-	if up.Force {
-		if err := r.DeleteFile(up.SiaPath); err != nil && err != filesystem.ErrNotExist {
-			return errors.AddContext(err, "unable to delete existing file")
+	// Fill in any missing upload params with sensible defaults. This happens
+	// before an existing file is overwritten to not delete it for an upload
+	// which is rejected anyway.
+	if up.ErasureCode == nil {
+		up.ErasureCode, err = r.managedDefaultErasureCode(up.SiaPath)
+		if err != nil {
+			return modules.UploadEstimate{}, errors.AddContext(err, "unable to create default erasure code")
 		}
 	}
+	if err := validateErasureCoder(up.ErasureCode); err != nil {
+		return modules.UploadEstimate{}, err
+	}
 
-	// Fill in any missing upload params with sensible defaults.
-	if up.ErasureCode == nil {
-		up.ErasureCode, _ = siafile.NewRSSubCode(DefaultDataPieces, DefaultParityPieces, crypto.SegmentSize)
+	// Check that we have contracts to upload to.
+	if build.Release != "testing" {
+		if err := r.managedCheckUploadContracts(up.SiaPath, up.ErasureCode, up.AllowLowRedundancy); err != nil {
+			return modules.UploadEstimate{}, err
+		}
 	}
 
-	// Check that we have contracts to upload to. We need at least data +
-	// parity/2 contracts. NumPieces is equal to data+parity, and min pieces is
-	// equal to parity. Therefore (NumPieces+MinPieces)/2 = (data+data+parity)/2
-	// = data+parity/2.
-	numContracts := len(r.hostContractor.Contracts())
-	requiredContracts := (up.ErasureCode.NumPieces() + up.ErasureCode.MinPieces()) / 2
-	if numContracts < requiredContracts && build.Release != "testing" {
-		return fmt.Errorf("not enough contracts to upload file: got %v, needed %v", numContracts, (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2)
+	// Check for an existing file if the overwrite flag isn't set. With the
+	// overwrite flag the existing file is deleted right before the new one is
+	// created.
+	if !up.Force {
+		exists, err := r.staticFileSystem.FileExists(up.SiaPath)
+		if err != nil {
+			return modules.UploadEstimate{}, errors.AddContext(err, "unable to check for existing file")
+		}
+		if exists {
+			return modules.UploadEstimate{}, filesystem.ErrExists
+		}
 	}
 
 	// Create the directory path on disk. Renter directory is already present so
 	// only files not in top level directory need to have directories created
 	dirSiaPath, err := up.SiaPath.Dir()
 	if err != nil {
-		return err
+		return modules.UploadEstimate{}, err
+	}
+
+	// Compress the source if requested. The compressed copy is removed again
+	// if the upload fails before it was moved to its staging location. A dry
+	// run only needs the size of the compressed data.
+	fileSize := uint64(sourceInfo.Size())
+	compressed := up.Compression != modules.CompressionNone && fileSize > 0
+	var compressedPath string
+	if compressed && up.DryRun {
+		fileSize, err = compressedSize(up.Source, up.Compression)
+		if err != nil {
+			return modules.UploadEstimate{}, errors.AddContext(err, "unable to compress the source file")
+		}
+	} else if compressed {
+		compressedPath, fileSize, err = r.managedCompressUploadSource(up.Source, up.Compression)
+		if err != nil {
+			return modules.UploadEstimate{}, errors.AddContext(err, "unable to compress the source file")
+		}
+		defer func() {
+			if err := os.Remove(compressedPath); err != nil && !os.IsNotExist(err) {
+				r.log.Println("WARN: failed to remove compressed copy of upload:", err)
+			}
+		}()
+	}
+
+	estimate := r.managedUploadEstimate(up, sk.Type(), fileSize)
+	if up.DryRun {
+		return estimate, nil
+	}
+
+	// Delete existing file if overwrite flag is set. Ignore ErrUnknownPath.
+	// This happens after all other checks and the compression of the source
+	// to not delete the file for an upload which fails anyway.
+	if up.Force {
+		if err := r.DeleteFile(up.SiaPath); err != nil && err != filesystem.ErrNotExist {
+			return modules.UploadEstimate{}, errors.AddContext(err, "unable to delete existing file")
+		}
 	}
 
 	// Create the Siafile and add to renter
-	err = r.staticFileSystem.NewSiaFile(up.SiaPath, up.Source, up.ErasureCode, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), uint64(sourceInfo.Size()), sourceInfo.Mode(), up.DisablePartialChunk)
+	if compressed {
+		err = r.staticFileSystem.NewCompressedSiaFile(up.SiaPath, up.Source, up.ErasureCode, sk, fileSize, uint64(sourceInfo.Size()), up.Compression, sourceInfo.Mode(), up.DisablePartialChunk)
+	} else {
+		err = r.staticFileSystem.NewSiaFile(up.SiaPath, up.Source, up.ErasureCode, sk, fileSize, sourceInfo.Mode(), up.DisablePartialChunk)
+	}
 	if err != nil {
-		return errors.AddContext(err, "could not create a new sia file")
+		return modules.UploadEstimate{}, errors.AddContext(err, "could not create a new sia file")
 	}
 	entry, err := r.staticFileSystem.OpenSiaFile(up.SiaPath)
 	if err != nil {
-		return errors.AddContext(err, "could not open the new sia file")
+		err = errors.AddContext(err, "could not open the new sia file")
+		return modules.UploadEstimate{}, errors.Compose(err, r.managedRemoveFailedUpload(up.SiaPath, nil))
+	}
+	if compressed {
+		if err := os.Rename(compressedPath, r.compressedUploadPath(entry.UID(), up.Compression)); err != nil {
+			err = errors.AddContext(err, "could not move the compressed file")
+			return modules.UploadEstimate{}, errors.Compose(err, r.managedRemoveFailedUpload(up.SiaPath, entry))
+		}
+	}
+	if err := entry.SetLocalModTime(sourceInfo.ModTime()); err != nil {
+		err = errors.AddContext(err, "could not set the modification time of the source")
+		return modules.UploadEstimate{}, errors.Compose(err, r.managedRemoveFailedUpload(up.SiaPath, entry))
+	}
+	if up.Priority != 0 {
+		if err := entry.SetUploadPriority(up.Priority); err != nil {
+			err = errors.AddContext(err, "could not set the upload priority")
+			return modules.UploadEstimate{}, errors.Compose(err, r.managedRemoveFailedUpload(up.SiaPath, entry))
+		}
+	}
+	if !up.Deadline.IsZero() {
+		if err := entry.SetUploadDeadline(up.Deadline); err != nil {
+			err = errors.AddContext(err, "could not set the upload deadline")
+			return modules.UploadEstimate{}, errors.Compose(err, r.managedRemoveFailedUpload(up.SiaPath, entry))
+		}
+	}
+	if len(up.PreferredHosts) > 0 {
+		if err := entry.SetPreferredHosts(up.PreferredHosts); err != nil {
+			err = errors.AddContext(err, "could not set the preferred hosts")
+			return modules.UploadEstimate{}, errors.Compose(err, r.managedRemoveFailedUpload(up.SiaPath, entry))
+		}
+	}
+	if up.ReadOnly {
+		if err := entry.SetReadOnly(true); err != nil {
+			err = errors.AddContext(err, "could not set the read-only status")
+			return modules.UploadEstimate{}, errors.Compose(err, r.managedRemoveFailedUpload(up.SiaPath, entry))
+		}
 	}
 
 	// No need to upload zero-byte files.
 	if sourceInfo.Size() == 0 {
-		return nil
+		return estimate, nil
 	}
 
 	// Bubble the health of the SiaFile directory to ensure the health is
@@ -104,12 +459,173 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	// having the worst possible health which is accurate since the file hasn't
 	// been uploaded yet
 	nilMap := make(map[string]bool)
+	offline, goodForRenew := nilMap, nilMap
+
+	// Reuse the pieces of already uploaded chunks with the same content. If
+	// any chunks were deduplicated, the real utility maps are needed for the
+	// deduplicated chunks to be considered healthy.
+	if r.managedChunkDeduplication() {
+		n, err := r.managedDeduplicateChunks(entry, r.chunkDataPath(entry))
+		if err != nil {
+			r.log.Println("WARN: chunk deduplication failed:", err)
+		}
+		if n > 0 {
+			offline, goodForRenew, _ = r.managedContractUtilityMaps()
+		}
+	}
+
+	// Remember the upload in case the renter shuts down before it finishes.
+	r.managedAddActiveUpload(up.SiaPath)
+
+	// Record the initial progress to compute the upload rate from.
+	sampleOffline, sampleGoodForRenew, _ := r.managedContractUtilityMaps()
+	completed, total := uploadedBytes(entry, sampleOffline, sampleGoodForRenew)
+	r.managedAddUploadSample(entry.UID(), completed, total)
+
 	// Send the upload to the repair loop.
 	hosts := r.managedRefreshHostsAndWorkers()
-	r.callBuildAndPushChunks([]*filesystem.FileNode{entry}, hosts, targetUnstuckChunks, nilMap, nilMap)
+	r.callBuildAndPushChunks([]*filesystem.FileNode{entry}, hosts, targetUnstuckChunks, offline, goodForRenew, nil)
 	select {
 	case r.uploadHeap.newUploads <- struct{}{}:
 	default:
 	}
+	return estimate, nil
+}
+
+// managedRemoveFailedUpload closes the entry of a new siafile which couldn't
+// be fully set up and removes the file together with its compressed staging
+// copy. Otherwise the half-configured file would block a retry and be picked
+// up by the repair loop. The file is deleted from the filesystem directly to
+// skip the trash and the read-only check.
+func (r *Renter) managedRemoveFailedUpload(siaPath modules.SiaPath, entry *filesystem.FileNode) error {
+	if entry != nil {
+		if codec := entry.Compression(); codec != modules.CompressionNone {
+			if err := os.Remove(r.compressedUploadPath(entry.UID(), codec)); err != nil && !os.IsNotExist(err) {
+				r.log.Println("WARN: failed to remove compressed copy of failed upload:", err)
+			}
+		}
+		entry.Close()
+	}
+	return errors.AddContext(r.staticFileSystem.ForceDeleteFile(siaPath), "unable to remove the new sia file")
+}
+
+// CancelUpload stops the upload or repair of the file at siaPath. All of the
+// file's chunks are removed from the upload heap and chunks which are
+// currently being uploaded are canceled. If deleteFile is set, the SiaFile is
+// deleted afterwards. Otherwise the file is kept and the repair loop will
+// continue uploading it the next time it finds the file.
+func (r *Renter) CancelUpload(siaPath modules.SiaPath, deleteFile bool) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+
+	// Get the UID of the file to identify its chunks.
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return errors.AddContext(err, "unable to open file")
+	}
+	uid, readOnly := entry.UID(), entry.ReadOnly()
+	entry.Close()
+	if deleteFile && readOnly {
+		return ErrFileReadOnly
+	}
+
+	// Remove the chunks from the heap and wait for the workers to stop
+	// working on the canceled ones.
+	canceled := r.uploadHeap.managedRemoveFile(uid)
+	for _, uc := range canceled {
+		uc.cancelWG.Wait()
+	}
+	r.managedRemoveActiveUpload(siaPath.String())
+	r.managedRemoveUploadProgress(uid)
+	if !deleteFile {
+		return nil
+	}
+	return errors.AddContext(r.managedDeleteFile(siaPath), "unable to delete canceled file")
+}
+
+// SetUploadPriority sets the upload priority of the file at siaPath. Chunks of
+// files with a higher priority are uploaded before chunks of files with a
+// lower priority. The priority of the file's chunks which are already in the
+// upload heap is updated as well.
+func (r *Renter) SetUploadPriority(siaPath modules.SiaPath, priority int) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return errors.AddContext(err, "unable to open file")
+	}
+	defer entry.Close()
+	if err := entry.SetUploadPriority(priority); err != nil {
+		return errors.AddContext(err, "unable to set upload priority")
+	}
+	r.uploadHeap.managedSetUploadPriority(entry.UID(), priority)
 	return nil
 }
+
+// UploadDirectory walks the directory specified by up.Source recursively and
+// uploads every file within it, mirroring the local directory tree under
+// up.SiaPath. Symlinks and files that can't be uploaded are logged and skipped
+// instead of aborting the whole walk. extensionCodes can be used to override
+// the erasure code of up for files with specific extensions, e.g. ".mp4".
+func (r *Renter) UploadDirectory(up modules.FileUploadParams, extensionCodes map[string]modules.ErasureCoder) (uint64, error) {
+	if err := r.tg.Add(); err != nil {
+		return 0, err
+	}
+	defer r.tg.Done()
+
+	// Check that the source is a directory.
+	sourceInfo, err := os.Stat(up.Source)
+	if err != nil {
+		return 0, errors.AddContext(err, "unable to stat input directory")
+	}
+	if !sourceInfo.IsDir() {
+		return 0, errUploadNotDirectory
+	}
+
+	var queued uint64
+	err = filepath.Walk(up.Source, func(path string, info os.FileInfo, err error) error {
+		// Skip anything we can't access.
+		if err != nil {
+			r.log.Printf("WARN: skipping %v during directory upload: %v", path, err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Only upload regular files. Directories are created on demand.
+		if info.Mode()&os.ModeSymlink != 0 {
+			r.log.Println("WARN: skipping symlink during directory upload:", path)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		// Mirror the local path within the siapath.
+		relPath, err := filepath.Rel(up.Source, path)
+		if err != nil {
+			return errors.AddContext(err, "unable to get relative path")
+		}
+		siaPath, err := up.SiaPath.Join(filepath.ToSlash(relPath))
+		if err != nil {
+			r.log.Printf("WARN: skipping %v during directory upload: %v", path, err)
+			return nil
+		}
+		fileUp := up
+		fileUp.Source = path
+		fileUp.SiaPath = siaPath
+		if ec, ok := extensionCodes[strings.ToLower(filepath.Ext(path))]; ok {
+			fileUp.ErasureCode = ec
+		}
+		if _, err := r.Upload(fileUp); err != nil {
+			r.log.Printf("WARN: skipping %v during directory upload: %v", path, err)
+			return nil
+		}
+		queued++
+		return nil
+	})
+	return queued, err
+}
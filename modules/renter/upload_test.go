@@ -1,11 +1,19 @@
 package renter
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
 )
 
@@ -36,11 +44,546 @@ func TestRenterUploadDirectory(t *testing.T) {
 		SiaPath:     modules.RandomSiaPath(),
 		ErasureCode: ec,
 	}
-	err = rt.renter.Upload(params)
+	_, err = rt.renter.Upload(params)
 	if err == nil {
 		t.Fatal("expected Upload to fail with empty directory as source")
 	}
-	if err != errUploadDirectory {
-		t.Fatal("expected errUploadDirectory, got", err)
+	if err != ErrUploadDirectory {
+		t.Fatal("expected ErrUploadDirectory, got", err)
+	}
+}
+
+// TestRenterUploadSourceNotFound verifies that the renter returns a not exist
+// error if the source of an upload doesn't exist.
+func TestRenterUploadSourceNotFound(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	params := modules.FileUploadParams{
+		Source:  filepath.Join(rt.dir, "missing"),
+		SiaPath: modules.RandomSiaPath(),
+	}
+	_, err = rt.renter.Upload(params)
+	if !errors.IsOSNotExist(err) {
+		t.Fatal("expected os.ErrNotExist, got", err)
+	}
+}
+
+// TestRenterUploadDirectoryRecursive verifies that UploadDirectory uploads all
+// the files within a directory tree while skipping symlinks.
+func TestRenterUploadDirectoryRecursive(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a local directory tree with 3 files and a symlink.
+	testUploadPath, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testUploadPath)
+	if err := os.MkdirAll(filepath.Join(testUploadPath, "sub", "subsub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"a.txt", filepath.Join("sub", "b.txt"), filepath.Join("sub", "subsub", "c.mp4")}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(testUploadPath, f), fastrand.Bytes(100), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(testUploadPath, "a.txt"), filepath.Join(testUploadPath, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload the directory using a different erasure code for .mp4 files.
+	ec, err := siafile.NewRSCode(DefaultDataPieces, DefaultParityPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp4EC, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	params := modules.FileUploadParams{
+		Source:      testUploadPath,
+		SiaPath:     siaPath,
+		ErasureCode: ec,
+	}
+	queued, err := rt.renter.UploadDirectory(params, map[string]modules.ErasureCoder{".mp4": mp4EC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued != uint64(len(files)) {
+		t.Fatalf("expected %v files to be queued but got %v", len(files), queued)
+	}
+
+	// Check that the files exist with the right erasure code.
+	for _, f := range files {
+		fileSiaPath, err := siaPath.Join(filepath.ToSlash(f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sf, err := rt.renter.staticFileSystem.OpenSiaFile(fileSiaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedEC := ec
+		if filepath.Ext(f) == ".mp4" {
+			expectedEC = mp4EC
+		}
+		if sf.ErasureCode().Identifier() != expectedEC.Identifier() {
+			t.Error("wrong erasure code for", f)
+		}
+		sf.Close()
+	}
+	// The symlink should have been skipped.
+	linkSiaPath, err := siaPath.Join("link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.staticFileSystem.OpenSiaFile(linkSiaPath); err == nil {
+		t.Fatal("symlink shouldn't have been uploaded")
+	}
+
+	// Uploading a file should fail.
+	params.Source = filepath.Join(testUploadPath, "a.txt")
+	if _, err := rt.renter.UploadDirectory(params, nil); err != errUploadNotDirectory {
+		t.Fatal("expected errUploadNotDirectory but got", err)
+	}
+}
+
+// TestRenterDefaultRedundancy tests setting and persisting the default
+// redundancy of the renter.
+func TestRenterDefaultRedundancy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Without a custom setting the built-in defaults are used.
+	ec, err := rt.renter.managedDefaultErasureCode(modules.RandomSiaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ec.MinPieces() != DefaultDataPieces || ec.NumPieces() != DefaultDataPieces+DefaultParityPieces {
+		t.Fatal("unexpected default erasure code", ec.MinPieces(), ec.NumPieces())
+	}
+
+	// Invalid values should be rejected.
+	if err := rt.renter.SetDefaultRedundancy(0, 1); err != errInvalidRedundancy {
+		t.Fatal("expected errInvalidRedundancy but got", err)
+	}
+	if err := rt.renter.SetDefaultRedundancy(1, 0); err != errInvalidRedundancy {
+		t.Fatal("expected errInvalidRedundancy but got", err)
+	}
+
+	// Set the redundancy and restart the renter. The setting should be
+	// persisted. The number of contracts isn't checked in testing builds.
+	if err := rt.renter.SetDefaultRedundancy(2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var errChan <-chan error
+	rt.renter, errChan = New(rt.gateway, rt.cs, rt.wallet, rt.tpool, filepath.Join(rt.dir, modules.RenterDir))
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	ec, err = rt.renter.managedDefaultErasureCode(modules.RandomSiaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ec.MinPieces() != 2 || ec.NumPieces() != 5 {
+		t.Fatal("default redundancy wasn't persisted", ec.MinPieces(), ec.NumPieces())
+	}
+}
+
+// TestRenterUploadDryRun tests that a dry run upload returns an estimate
+// without creating the file.
+func TestRenterUploadDryRun(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a local file which fits into 2 chunks.
+	ec, err := siafile.NewRSCode(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(rt.dir, "file")
+	if err := ioutil.WriteFile(source, fastrand.Bytes(int(modules.SectorSize)+1), 0600); err != nil {
+		t.Fatal(err)
+	}
+	params := modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     modules.RandomSiaPath(),
+		ErasureCode: ec,
+		DryRun:      true,
+	}
+	estimate, err := rt.renter.Upload(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.NumChunks != 2 || estimate.NumSectors != 6 {
+		t.Fatalf("wrong estimate: %v chunks and %v sectors", estimate.NumChunks, estimate.NumSectors)
+	}
+	// The file shouldn't exist.
+	exists, err := rt.renter.staticFileSystem.FileExists(params.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("dry run created the file")
+	}
+
+	// Upload the file for real. The estimate should be the same.
+	params.DryRun = false
+	realEstimate, err := rt.renter.Upload(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if realEstimate.NumChunks != estimate.NumChunks || realEstimate.NumSectors != estimate.NumSectors {
+		t.Fatal("estimates don't match", realEstimate, estimate)
+	}
+
+	// Another dry run should detect the conflict unless forced.
+	params.DryRun = true
+	if _, err := rt.renter.Upload(params); !errors.Contains(err, filesystem.ErrExists) {
+		t.Fatal("expected ErrExists but got", err)
+	}
+	params.Force = true
+	if _, err := rt.renter.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.File(params.SiaPath); err != nil {
+		t.Fatal("forced dry run shouldn't delete the file", err)
+	}
+
+	// The estimate should account for the overhead of the provided cipher
+	// key. A full sector doesn't fit into a single chunk with twofish.
+	if err := ioutil.WriteFile(source, fastrand.Bytes(int(modules.SectorSize)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	params.SiaPath = modules.RandomSiaPath()
+	params.Force = false
+	params.CipherKey = crypto.GenerateSiaKey(crypto.TypeThreefish)
+	if estimate, err := rt.renter.Upload(params); err != nil || estimate.NumChunks != 1 {
+		t.Fatal("wrong estimate for threefish", estimate.NumChunks, err)
+	}
+	params.CipherKey = crypto.GenerateSiaKey(crypto.TypeTwofish)
+	if estimate, err := rt.renter.Upload(params); err != nil || estimate.NumChunks != 2 {
+		t.Fatal("wrong estimate for twofish", estimate.NumChunks, err)
+	}
+}
+
+// invalidCipherKey is a crypto.CipherKey with an unknown type.
+type invalidCipherKey struct {
+	crypto.CipherKey
+}
+
+// Type returns an unknown cipher type.
+func (invalidCipherKey) Type() crypto.CipherType {
+	return crypto.CipherType{0, 0, 0, 0, 0, 0, 0, 255}
+}
+
+// TestRenterUploadCipherKey tests that a cipher key provided by the caller is
+// used for the uploaded file and that invalid keys are rejected.
+func TestRenterUploadCipherKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a local file.
+	source := filepath.Join(rt.dir, "file")
+	if err := ioutil.WriteFile(source, fastrand.Bytes(100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key := crypto.GenerateSiaKey(crypto.TypeTwofish)
+	params := modules.FileUploadParams{
+		Source:    source,
+		SiaPath:   modules.RandomSiaPath(),
+		CipherKey: invalidCipherKey{key},
+	}
+
+	// An invalid key should be rejected.
+	if _, err := rt.renter.Upload(params); !errors.Contains(err, ErrInvalidCipherKey) {
+		t.Fatal("expected ErrInvalidCipherKey but got", err)
+	}
+
+	// A valid key should be used verbatim.
+	params.CipherKey = key
+	if _, err := rt.renter.Upload(params); err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(params.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	mk := sf.MasterKey()
+	if mk.Type() != key.Type() || !bytes.Equal(mk.Key(), key.Key()) {
+		t.Fatal("file doesn't use the provided key")
+	}
+}
+
+// TestCheckUploadContracts tests the required number of contracts for an
+// upload with and without AllowLowRedundancy.
+func TestCheckUploadContracts(t *testing.T) {
+	// 10-of-30 requires 20 contracts for the full redundancy and 10 to make
+	// any progress.
+	rsc, err := siafile.NewRSCode(10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		numContracts       int
+		allowLowRedundancy bool
+		lowRedundancy      bool
+		err                bool
+	}{
+		{20, false, false, false},
+		{19, false, false, true},
+		{20, true, false, false},
+		{19, true, true, false},
+		{10, true, true, false},
+		{9, true, false, true},
+	}
+	for _, test := range tests {
+		lowRedundancy, err := checkUploadContracts(test.numContracts, rsc, test.allowLowRedundancy)
+		if test.err != (err != nil) {
+			t.Fatalf("%v: unexpected error %v", test, err)
+		}
+		if err != nil && !errors.Contains(err, ErrInsufficientContracts) {
+			t.Fatalf("%v: wrong error %v", test, err)
+		}
+		if lowRedundancy != test.lowRedundancy {
+			t.Fatalf("%v: expected lowRedundancy %v but was %v", test, test.lowRedundancy, lowRedundancy)
+		}
+	}
+}
+
+// degenerateErasureCoder is an erasure coder which reports arbitrary piece
+// counts.
+type degenerateErasureCoder struct {
+	modules.ErasureCoder
+	minPieces int
+	numPieces int
+}
+
+// MinPieces returns the configured number of min pieces.
+func (ec degenerateErasureCoder) MinPieces() int { return ec.minPieces }
+
+// NumPieces returns the configured number of pieces.
+func (ec degenerateErasureCoder) NumPieces() int { return ec.numPieces }
+
+// TestValidateErasureCoder tests that degenerate erasure coders are rejected
+// by validateErasureCoder and Upload.
+func TestValidateErasureCoder(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rsc, err := siafile.NewRSCode(10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateErasureCoder(rsc); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []degenerateErasureCoder{
+		{rsc, 0, 0},
+		{rsc, 0, 10},
+		{rsc, -1, 10},
+		{rsc, 10, 10},
+		{rsc, 10, 5},
+	}
+	for _, ec := range invalid {
+		if err := validateErasureCoder(ec); !errors.Contains(err, ErrInvalidErasureCoder) {
+			t.Fatalf("%v-of-%v: expected %v but got %v", ec.minPieces, ec.numPieces, ErrInvalidErasureCoder, err)
+		}
+	}
+
+	// Upload and UploadStreamFromReader should reject the coders before
+	// creating a file.
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	source := filepath.Join(rt.dir, "source")
+	if err := ioutil.WriteFile(source, fastrand.Bytes(100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, ec := range invalid {
+		up := modules.FileUploadParams{
+			Source:      source,
+			SiaPath:     modules.RandomSiaPath(),
+			ErasureCode: ec,
+		}
+		if _, err := rt.renter.Upload(up); !errors.Contains(err, ErrInvalidErasureCoder) {
+			t.Fatalf("%v-of-%v: expected %v but got %v", ec.minPieces, ec.numPieces, ErrInvalidErasureCoder, err)
+		}
+		up.Source = ""
+		if err := rt.renter.UploadStreamFromReader(up, bytes.NewReader(fastrand.Bytes(100))); !errors.Contains(err, ErrInvalidErasureCoder) {
+			t.Fatalf("%v-of-%v: expected %v but got %v", ec.minPieces, ec.numPieces, ErrInvalidErasureCoder, err)
+		}
+		exists, err := rt.renter.staticFileSystem.FileExists(up.SiaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Fatal("file was created for invalid erasure coder")
+		}
+	}
+
+	// A forced upload with an invalid coder should leave an existing file in
+	// place.
+	up := modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     modules.RandomSiaPath(),
+		ErasureCode: rsc,
+	}
+	if _, err := rt.renter.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+	up.Force = true
+	for _, ec := range invalid {
+		up.ErasureCode = ec
+		if _, err := rt.renter.Upload(up); !errors.Contains(err, ErrInvalidErasureCoder) {
+			t.Fatalf("%v-of-%v: expected %v but got %v", ec.minPieces, ec.numPieces, ErrInvalidErasureCoder, err)
+		}
+		if err := rt.renter.UploadStreamFromReader(up, bytes.NewReader(fastrand.Bytes(100))); !errors.Contains(err, ErrInvalidErasureCoder) {
+			t.Fatalf("%v-of-%v: expected %v but got %v", ec.minPieces, ec.numPieces, ErrInvalidErasureCoder, err)
+		}
+		if _, err := rt.renter.File(up.SiaPath); err != nil {
+			t.Fatal("existing file was deleted:", err)
+		}
+	}
+}
+
+// TestValidateSiaPathLimits tests the depth and length limits of upload
+// siapaths.
+func TestValidateSiaPathLimits(t *testing.T) {
+	siaPath := func(elements ...string) modules.SiaPath {
+		sp, err := modules.NewSiaPath(strings.Join(elements, "/"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sp
+	}
+	repeat := func(elem string, n int) []string {
+		elements := make([]string, n)
+		for i := range elements {
+			elements[i] = elem
+		}
+		return elements
+	}
+	longestFileName := strings.Repeat("a", maxSiaPathElementLength-len(modules.SiaFileExtension))
+	longestDirName := strings.Repeat("a", maxSiaPathElementLength)
+	tests := []struct {
+		siaPath modules.SiaPath
+		sysPath string
+		err     error
+	}{
+		{siaPath("a", "b"), "", nil},
+		{siaPath(repeat("a", maxSiaPathDepth+1)...), "", nil},
+		{siaPath(repeat("a", maxSiaPathDepth+2)...), "", ErrSiaPathTooDeep},
+		{siaPath(longestDirName, longestFileName), "", nil},
+		{siaPath(longestDirName + "a"), "", ErrSiaPathTooLong},
+		{siaPath(longestFileName + "a"), "", ErrSiaPathTooLong},
+		{siaPath(longestDirName+"a", "b"), "", ErrSiaPathTooLong},
+		{siaPath("a"), strings.Repeat("a", maxSiaFileSysPathLength), nil},
+		{siaPath("a"), strings.Repeat("a", maxSiaFileSysPathLength+1), ErrSiaPathTooLong},
+	}
+	for i, test := range tests {
+		err := validateSiaPathLimits(test.siaPath, test.sysPath)
+		if test.err == nil && err != nil {
+			t.Fatalf("%v: unexpected error %v", i, err)
+		}
+		if test.err != nil && !errors.Contains(err, test.err) {
+			t.Fatalf("%v: expected %v but got %v", i, test.err, err)
+		}
+	}
+}
+
+// TestRenterUploadDeepSiaPath tests uploading files with deeply nested
+// siapaths close to the depth limit.
+func TestRenterUploadDeepSiaPath(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	source := filepath.Join(rt.dir, "file")
+	if err := ioutil.WriteFile(source, fastrand.Bytes(100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	elements := make([]string, maxSiaPathDepth+1)
+	for i := range elements {
+		elements[i] = "d"
+	}
+
+	// A siapath at the depth limit should be uploaded.
+	siaPath, err := modules.NewSiaPath(strings.Join(elements, "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.Upload(modules.FileUploadParams{Source: source, SiaPath: siaPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A siapath exceeding the limit should be rejected before the siafile is
+	// created.
+	siaPath, err = modules.NewSiaPath(strings.Join(append(elements, "d"), "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.renter.Upload(modules.FileUploadParams{Source: source, SiaPath: siaPath})
+	if !errors.Contains(err, ErrSiaPathTooDeep) {
+		t.Fatal("expected ErrSiaPathTooDeep but got", err)
+	}
+	exists, err := rt.renter.staticFileSystem.FileExists(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("siafile shouldn't have been created")
 	}
 }
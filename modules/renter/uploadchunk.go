@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
 
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
@@ -37,18 +39,31 @@ type unfinishedUploadChunk struct {
 	health                 float64
 	index                  uint64
 	length                 uint64
-	memoryNeeded           uint64 // memory needed in bytes
-	memoryReleased         uint64 // memory that has been returned of memoryNeeded
-	minimumPieces          int    // number of pieces required to recover the file.
-	offset                 int64  // Offset of the chunk within the file.
-	piecesNeeded           int    // number of pieces to achieve a 100% complete upload
-	stuck                  bool   // indicates if the chunk was marked as stuck during last repair
-	stuckRepair            bool   // indicates if the chunk was identified for repair by the stuck loop
-	priority               bool   // indicates if the chunks is supposed to be repaired asap
+	memoryNeeded           uint64    // memory needed in bytes
+	memoryReleased         uint64    // memory that has been returned of memoryNeeded
+	minimumPieces          int       // number of pieces required to recover the file.
+	offset                 int64     // Offset of the chunk within the file.
+	piecesNeeded           int       // number of pieces to achieve a 100% complete upload
+	stuck                  bool      // indicates if the chunk was marked as stuck during last repair
+	stuckRepair            bool      // indicates if the chunk was identified for repair by the stuck loop
+	repair                 bool      // indicates if pieces of the chunk were uploaded before
+	priority               bool      // indicates if the chunks is supposed to be repaired asap
+	uploadPriority         int       // the user defined upload priority of the chunk's file
+	uploadDeadline         time.Time // the upload deadline of the chunk's file, zero if there is none
+	approachingDeadline    bool      // indicates if the upload deadline is within the uploadDeadlineWindow
+	hostReselections       int       // number of times a failed piece was handed to a different host
+	uploadRetries          uint64    // number of failed piece uploads which were retried
+
+	// staticRetryPolicy is the policy used to retry failed piece uploads of
+	// the chunk. It is set when the chunk is built.
+	staticRetryPolicy modules.UploadRetryPolicy
 
 	// Cache the siapath of the underlying file.
 	staticSiaPath string
 
+	// staticCreationTime is the time at which the chunk was built.
+	staticCreationTime time.Time
+
 	// The logical data is the data that is presented to the user when the user
 	// requests the chunk. The physical data is all of the pieces that get
 	// stored across the network.
@@ -59,6 +74,11 @@ type unfinishedUploadChunk struct {
 	// available it will be tried before the repair path or remote repair.
 	sourceReader io.ReadCloser
 
+	// dedupKey is the key under which the chunk is added to the renter's
+	// dedup index once it is uploaded. It is only set if chunk deduplication
+	// is enabled.
+	dedupKey crypto.Hash
+
 	// Worker synchronization fields. The mutex only protects these fields.
 	//
 	// When a worker passes over a piece for upload to go on standby:
@@ -341,6 +361,9 @@ func (r *Renter) threadedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 		}
 		return
 	}
+	// Remember the dedup key of the chunk before the pieces are encrypted.
+	chunk.dedupKey = r.managedDedupKeyFromPieces(chunk)
+
 	// Loop through the pieces and encrypt any that are needed, while dropping
 	// any pieces that are not needed.
 	for i := 0; i < len(chunk.pieceUsage); i++ {
@@ -433,8 +456,9 @@ func (r *Renter) managedCleanUpUploadChunk(uc *unfinishedUploadChunk) {
 	// yet been released.
 	chunkComplete := uc.chunkComplete()
 	released := uc.released
+	fullyRepaired := uc.piecesCompleted >= uc.piecesNeeded
 	if chunkComplete && !released {
-		if uc.piecesCompleted >= uc.piecesNeeded {
+		if fullyRepaired {
 			r.repairLog.Printf("Completed repair for chunk %v of %s, %v pieces were completed out of %v", uc.index, uc.staticSiaPath, uc.piecesCompleted, uc.piecesNeeded)
 		} else {
 			r.repairLog.Printf("Repair of chunk %v of %s was unsuccessful, %v pieces were completed out of %v", uc.index, uc.staticSiaPath, uc.piecesCompleted, uc.piecesNeeded)
@@ -443,6 +467,7 @@ func (r *Renter) managedCleanUpUploadChunk(uc *unfinishedUploadChunk) {
 	}
 	uc.memoryReleased += uint64(memoryReleased)
 	totalMemoryReleased := uc.memoryReleased
+	uploadRetries := uc.uploadRetries
 	uc.mu.Unlock()
 
 	// If there are pieces available, add the standby workers to collect them.
@@ -455,13 +480,36 @@ func (r *Renter) managedCleanUpUploadChunk(uc *unfinishedUploadChunk) {
 	}
 	// If required, remove the chunk from the set of repairing chunks.
 	if chunkComplete && !released {
-		r.managedUpdateUploadChunkStuckStatus(uc)
+		// Canceled chunks didn't fail so their stuck status shouldn't change.
+		uc.cancelMU.Lock()
+		canceled := uc.canceled
+		uc.cancelMU.Unlock()
+		if !canceled {
+			r.managedUpdateUploadChunkStuckStatus(uc)
+		}
+		// Let the registered callbacks know about the progress.
+		r.managedNotifyUploadProgress(uc.fileEntry)
+		// Stop tracking the upload once the file is fully uploaded.
+		r.managedUpdateActiveUpload(uc.fileEntry)
+		// Remove the staging file of compressed uploads once they are done.
+		r.managedRemoveCompressedUpload(uc.fileEntry)
+		// Make the chunk available for deduplication.
+		r.managedAddDedupChunk(uc.fileEntry, uc.index, uc.dedupKey)
+		// Record the retried piece uploads of the chunk in the file or reset
+		// them if the chunk was fully uploaded.
+		if err := uc.fileEntry.UpdateChunkUploadRetries(uc.index, uploadRetries, fullyRepaired); err != nil && !errors.Contains(err, siafile.ErrDeleted) {
+			r.log.Printf("WARN: could not record upload retries of chunk %v: %v", uc.id, err)
+		}
+		// Remove the chunk from the repairingChunks map. Once the last chunk
+		// of the file in the heap is back to full redundancy, the file is
+		// verified.
+		if r.uploadHeap.managedMarkRepairDoneLast(uc.id) && !canceled && fullyRepaired {
+			r.managedMaybeVerifyFile(uc.fileEntry)
+		}
 		// Close the file entry unless disrupted.
 		if !r.deps.Disrupt("disableCloseUploadEntry") {
 			uc.fileEntry.Close()
 		}
-		// Remove the chunk from the repairingChunks map
-		r.uploadHeap.managedMarkRepairDone(uc.id)
 		// Signal garbage collector to free memory before returning it to the manager.
 		uc.logicalChunkData = nil
 		uc.physicalChunkData = nil
@@ -510,7 +558,7 @@ func (r *Renter) managedUpdateUploadChunkStuckStatus(uc *unfinishedUploadChunk)
 	uc.mu.Unlock()
 
 	// Determine if repair was successful.
-	successfulRepair := float64(piecesNeeded-piecesCompleted)/float64(piecesNeeded-minimumPieces) < RepairThreshold
+	successfulRepair := float64(piecesNeeded-piecesCompleted)/float64(piecesNeeded-minimumPieces) < r.managedRepairThreshold()
 
 	// Check if renter is shutting down
 	var renterError bool
@@ -0,0 +1,170 @@
+package renter
+
+// uploadeta.go estimates the remaining time of uploads. Whenever a chunk of a
+// file finishes uploading, the number of uploaded bytes is recorded, at most
+// once per uploadSampleInterval. The upload rate of the file is computed from
+// the most recent of these samples and used to estimate when the file reaches
+// its target redundancy. The rates of files which didn't make any progress
+// for uploadRateExpiry are removed.
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+)
+
+const (
+	// uploadRateWindow is the number of samples the upload rate of a file is
+	// computed from.
+	uploadRateWindow = 10
+)
+
+var (
+	// errUploadStalled is returned by EstimatedUploadCompletion if the upload
+	// isn't making any progress.
+	errUploadStalled = errors.New("upload is not making progress")
+
+	// errUploadRateUnknown is returned by EstimatedUploadCompletion if not
+	// enough progress was recorded yet to compute the upload rate.
+	errUploadRateUnknown = errors.New("not enough upload progress to estimate the upload rate")
+)
+
+type (
+	// uploadRate contains the most recent upload progress samples of a file.
+	uploadRate struct {
+		samples []uploadSample
+	}
+
+	// uploadSample is the number of uploaded bytes of a file at a certain
+	// time.
+	uploadSample struct {
+		bytes     uint64
+		timestamp time.Time
+	}
+)
+
+// EstimatedUploadCompletion estimates the remaining time until the file at
+// siaPath reaches its target redundancy based on its recent upload rate. An
+// error is returned if the upload is stalled or the rate is not known yet.
+func (r *Renter) EstimatedUploadCompletion(siaPath modules.SiaPath) (time.Duration, error) {
+	if err := r.tg.Add(); err != nil {
+		return 0, err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return 0, err
+	}
+	defer entry.Close()
+	offline, goodForRenew, _ := r.managedContractUtilityMaps()
+	return r.managedEstimateUploadCompletion(entry, offline, goodForRenew)
+}
+
+// managedEstimateUploadCompletion estimates the remaining time until a file
+// reaches its target redundancy using the provided utility maps to compute its
+// progress.
+func (r *Renter) managedEstimateUploadCompletion(entry *filesystem.FileNode, offline, goodForRenew map[string]bool) (time.Duration, error) {
+	completed, total := uploadedBytes(entry, offline, goodForRenew)
+	if completed >= total {
+		return 0, nil
+	}
+
+	// Without enough workers the file can't reach its target redundancy.
+	r.staticWorkerPool.mu.RLock()
+	numWorkers := len(r.staticWorkerPool.workers)
+	r.staticWorkerPool.mu.RUnlock()
+	if numWorkers < entry.ErasureCode().NumPieces() {
+		return 0, errors.AddContext(errUploadStalled, fmt.Sprintf("only %v of %v required workers available", numWorkers, entry.ErasureCode().NumPieces()))
+	}
+
+	r.uploadRatesMu.Lock()
+	rate, exists := r.uploadRates[entry.UID()]
+	var samples []uploadSample
+	if exists {
+		samples = append(samples, rate.samples...)
+	}
+	r.uploadRatesMu.Unlock()
+	return estimateUploadCompletion(samples, total-completed, time.Now())
+}
+
+// estimateUploadCompletion estimates the time it takes to upload the
+// remaining bytes given the recent upload samples of a file.
+func estimateUploadCompletion(samples []uploadSample, remaining uint64, now time.Time) (time.Duration, error) {
+	if len(samples) < 2 {
+		return 0, errUploadRateUnknown
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	if now.Sub(last.timestamp) > uploadStallTimeout {
+		return 0, errors.AddContext(errUploadStalled, fmt.Sprintf("no progress since %v", last.timestamp))
+	}
+	elapsed := last.timestamp.Sub(first.timestamp)
+	if last.bytes <= first.bytes || elapsed <= 0 {
+		return 0, errUploadStalled
+	}
+	bytesPerSecond := float64(last.bytes-first.bytes) / elapsed.Seconds()
+	return time.Duration(float64(remaining) / bytesPerSecond * float64(time.Second)), nil
+}
+
+// managedUploadSampleDue returns whether the last upload sample of a file is
+// older than uploadSampleInterval.
+func (r *Renter) managedUploadSampleDue(uid siafile.SiafileUID) bool {
+	r.uploadRatesMu.Lock()
+	defer r.uploadRatesMu.Unlock()
+	rate, exists := r.uploadRates[uid]
+	if !exists || len(rate.samples) == 0 {
+		return true
+	}
+	return time.Since(rate.samples[len(rate.samples)-1].timestamp) >= uploadSampleInterval
+}
+
+// managedAddUploadSample records the upload progress of a file. The upload
+// rate is removed once the file is fully uploaded.
+func (r *Renter) managedAddUploadSample(uid siafile.SiafileUID, completed, total uint64) {
+	r.uploadRatesMu.Lock()
+	defer r.uploadRatesMu.Unlock()
+	r.pruneUploadRates()
+	if completed >= total {
+		delete(r.uploadRates, uid)
+		return
+	}
+	rate, exists := r.uploadRates[uid]
+	if !exists {
+		rate = new(uploadRate)
+		r.uploadRates[uid] = rate
+	}
+	rate.samples = append(rate.samples, uploadSample{
+		bytes:     completed,
+		timestamp: time.Now(),
+	})
+	if len(rate.samples) > uploadRateWindow {
+		rate.samples = rate.samples[len(rate.samples)-uploadRateWindow:]
+	}
+}
+
+// pruneUploadRates removes the upload rates of files which didn't make any
+// progress for uploadRateExpiry, e.g. because their upload was interrupted
+// before it finished. The rates are pruned at most once per uploadRateExpiry.
+// The caller needs to hold the uploadRatesMu.
+func (r *Renter) pruneUploadRates() {
+	if time.Since(r.uploadRatesPruned) < uploadRateExpiry {
+		return
+	}
+	r.uploadRatesPruned = time.Now()
+	for uid, rate := range r.uploadRates {
+		if len(rate.samples) == 0 || time.Since(rate.samples[len(rate.samples)-1].timestamp) >= uploadRateExpiry {
+			delete(r.uploadRates, uid)
+		}
+	}
+}
+
+// managedRemoveUploadRate removes the upload rate of a file.
+func (r *Renter) managedRemoveUploadRate(uid siafile.SiafileUID) {
+	r.uploadRatesMu.Lock()
+	delete(r.uploadRates, uid)
+	r.uploadRatesMu.Unlock()
+}
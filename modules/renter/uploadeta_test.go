@@ -0,0 +1,183 @@
+package renter
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestEstimateUploadCompletion tests estimating the remaining upload time
+// from upload samples.
+func TestEstimateUploadCompletion(t *testing.T) {
+	now := time.Now()
+	sample := func(bytes uint64, ago time.Duration) uploadSample {
+		return uploadSample{bytes: bytes, timestamp: now.Add(-ago)}
+	}
+
+	// Not enough samples.
+	if _, err := estimateUploadCompletion(nil, 100, now); err != errUploadRateUnknown {
+		t.Fatal("expected errUploadRateUnknown but got", err)
+	}
+	if _, err := estimateUploadCompletion([]uploadSample{sample(0, 0)}, 100, now); err != errUploadRateUnknown {
+		t.Fatal("expected errUploadRateUnknown but got", err)
+	}
+
+	// 100 bytes in 2 seconds with 300 bytes remaining should take 6 seconds.
+	samples := []uploadSample{sample(0, 3*time.Second), sample(50, 2*time.Second), sample(100, time.Second)}
+	eta, err := estimateUploadCompletion(samples, 300, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eta != 6*time.Second {
+		t.Fatal("wrong estimate", eta)
+	}
+
+	// No progress between the samples.
+	samples = []uploadSample{sample(100, 2*time.Second), sample(100, time.Second)}
+	if _, err := estimateUploadCompletion(samples, 300, now); !errors.Contains(err, errUploadStalled) {
+		t.Fatal("expected errUploadStalled but got", err)
+	}
+
+	// No progress since the last sample for too long.
+	samples = []uploadSample{sample(0, 2*uploadStallTimeout), sample(100, 2*uploadStallTimeout-time.Second)}
+	if _, err := estimateUploadCompletion(samples, 300, now); !errors.Contains(err, errUploadStalled) {
+		t.Fatal("expected errUploadStalled but got", err)
+	}
+}
+
+// TestEstimatedUploadCompletion tests that the upload progress of a file is
+// recorded and used to estimate its remaining upload time.
+func TestEstimatedUploadCompletion(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file with a single chunk of 3 pieces.
+	rsc, _ := siafile.NewRSCode(1, 2)
+	siaPath := modules.RandomSiaPath()
+	err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+
+	// Without workers the upload can't make progress.
+	if _, err := r.EstimatedUploadCompletion(siaPath); !errors.Contains(err, errUploadStalled) {
+		t.Fatal("expected errUploadStalled but got", err)
+	}
+	addWorker := func(name string) {
+		r.staticWorkerPool.mu.Lock()
+		r.staticWorkerPool.workers[name] = &worker{
+			killChan: make(chan struct{}),
+			wakeChan: make(chan struct{}, 1),
+		}
+		r.staticWorkerPool.mu.Unlock()
+	}
+
+	// With fewer workers than pieces the file can't reach its target
+	// redundancy either.
+	addWorker("worker1")
+	if _, err := r.EstimatedUploadCompletion(siaPath); !errors.Contains(err, errUploadStalled) {
+		t.Fatal("expected errUploadStalled but got", err)
+	}
+	addWorker("worker2")
+	addWorker("worker3")
+
+	// Upload the first two pieces. Afterwards the rate is known.
+	offline, goodForRenew := make(map[string]bool), make(map[string]bool)
+	addPiece := func(pieceIndex uint64) {
+		hpk := types.SiaPublicKey{Key: fastrand.Bytes(32)}
+		offline[hpk.String()] = false
+		goodForRenew[hpk.String()] = true
+		if err := sf.AddPiece(hpk, 0, pieceIndex, crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+		r.managedReportUploadProgress(sf, offline, goodForRenew)
+	}
+	for i := uint64(0); i < 2; i++ {
+		addPiece(i)
+		if i == 0 {
+			if _, err := r.managedEstimateUploadCompletion(sf, offline, goodForRenew); err != errUploadRateUnknown {
+				t.Fatal("expected errUploadRateUnknown but got", err)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	eta, err := r.managedEstimateUploadCompletion(sf, offline, goodForRenew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eta <= 0 || eta > time.Second {
+		t.Fatal("unexpected estimate", eta)
+	}
+
+	// Once the file is fully uploaded, the estimate is 0 and the rate is
+	// removed.
+	addPiece(2)
+	if eta, err := r.managedEstimateUploadCompletion(sf, offline, goodForRenew); err != nil || eta != 0 {
+		t.Fatal("expected estimate of 0", eta, err)
+	}
+	r.uploadRatesMu.Lock()
+	numRates := len(r.uploadRates)
+	r.uploadRatesMu.Unlock()
+	if numRates != 0 {
+		t.Fatal("expected upload rate to be removed")
+	}
+}
+
+// TestUploadSamples tests that upload samples are throttled and that the
+// upload rates of files which stopped making progress are pruned.
+func TestUploadSamples(t *testing.T) {
+	r := &Renter{
+		uploadRates: make(map[siafile.SiafileUID]*uploadRate),
+	}
+	uid, staleUID := siafile.SiafileUID("file"), siafile.SiafileUID("stale")
+
+	// A sample is due for a file without samples but not right after a
+	// sample was taken.
+	if !r.managedUploadSampleDue(uid) {
+		t.Fatal("sample should be due without samples")
+	}
+	r.managedAddUploadSample(uid, 1, 10)
+	if r.managedUploadSampleDue(uid) {
+		t.Fatal("sample shouldn't be due right after a sample")
+	}
+	time.Sleep(uploadSampleInterval)
+	if !r.managedUploadSampleDue(uid) {
+		t.Fatal("sample should be due after the interval")
+	}
+
+	// Add a rate which didn't make progress for too long. It should be
+	// pruned with the next sample.
+	r.uploadRates[staleUID] = &uploadRate{
+		samples: []uploadSample{{bytes: 1, timestamp: time.Now().Add(-uploadRateExpiry)}},
+	}
+	r.uploadRatesPruned = time.Time{}
+	r.managedAddUploadSample(uid, 2, 10)
+	if _, exists := r.uploadRates[staleUID]; exists {
+		t.Fatal("stale upload rate wasn't pruned")
+	}
+	if _, exists := r.uploadRates[uid]; !exists {
+		t.Fatal("active upload rate was pruned")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
@@ -47,6 +48,10 @@ var (
 		Dev:      1 * time.Minute,
 		Testing:  100 * time.Millisecond,
 	}).(time.Duration)
+
+	// ErrInvalidRepairThreshold is returned by SetRepairThreshold if the
+	// threshold is out of bounds.
+	ErrInvalidRepairThreshold = fmt.Errorf("repair threshold must be between %v and %v", MinRepairThreshold, MaxRepairThreshold)
 )
 
 // uploadChunkHeap is a bunch of priority-sorted chunks that need to be either
@@ -62,14 +67,21 @@ func (uch uploadChunkHeap) Less(i, j int) bool {
 	//      than all other chunks. An example would be if the upload of a single
 	//      chunk is a blocking task.
 	//
-	//  2) File Recently Successful Chunks
+	//  2) Approaching Deadline Chunks
+	//    - Chunks of files whose upload deadline is within the
+	//      uploadDeadlineWindow, earlier deadlines first
+	//
+	//  3) Upload Priority
+	//    - Chunks of files with a higher user defined upload priority
+	//
+	//  4) File Recently Successful Chunks
 	//    - These are stuck chunks that are from a file that recently had a
 	//      successful repair
 	//
-	//  3) Stuck Chunks
+	//  5) Stuck Chunks
 	//    - These are chunks added by the stuck loop
 	//
-	//  4) Worst Health Chunk
+	//  6) Worst Health Chunk
 	//    - The base priority of chunks in the heap is by the worst health
 
 	// Check for Priority chunks
@@ -83,6 +95,32 @@ func (uch uploadChunkHeap) Less(i, j int) bool {
 		return false
 	}
 
+	// Check for Approaching Deadline Chunks
+	//
+	// If only chunk i is approaching its deadline, return true to prioritize
+	// it.
+	if uch[i].approachingDeadline && !uch[j].approachingDeadline {
+		return true
+	}
+	// If only chunk j is approaching its deadline, return false to prioritize
+	// it.
+	if !uch[i].approachingDeadline && uch[j].approachingDeadline {
+		return false
+	}
+	// If both chunks are approaching their deadlines, prioritize the chunk
+	// with the earlier one.
+	if uch[i].approachingDeadline && !uch[i].uploadDeadline.Equal(uch[j].uploadDeadline) {
+		return uch[i].uploadDeadline.Before(uch[j].uploadDeadline)
+	}
+
+	// Check for the upload priority
+	//
+	// If the chunks have different upload priorities, prioritize the chunk
+	// with the higher one.
+	if uch[i].uploadPriority != uch[j].uploadPriority {
+		return uch[i].uploadPriority > uch[j].uploadPriority
+	}
+
 	// Check for File Recently Successful Chunks
 	//
 	// If only chunk i's file was recently successful, return true to prioritize
@@ -151,15 +189,105 @@ type uploadHeap struct {
 	stuckChunkFound   chan struct{}
 	stuckChunkSuccess chan struct{}
 
-	// External control channels
-	pauseChan     chan struct{}
-	pauseDuration time.Duration
-	pauseStart    time.Time
-	pauseTimer    *time.Timer
+	// repairNeededThrottle and stuckChunkFoundThrottle throttle the
+	// repairNeeded and stuckChunkFound signals sent by bubbles to one signal
+	// per signalThrottleInterval. Once signalThrottlesStopped is set, no more
+	// delayed signals are scheduled.
+	repairNeededThrottle    signalThrottle
+	stuckChunkFoundThrottle signalThrottle
+	signalThrottleInterval  time.Duration
+	signalThrottlesStopped  bool
+
+	// External control channels. If pausedIndefinitely is set, the heap stays
+	// paused until managedSetPausedIndefinitely is called again and timed
+	// pauses are ignored.
+	pauseChan          chan struct{}
+	pauseDuration      time.Duration
+	pauseStart         time.Time
+	pauseTimer         *time.Timer
+	pausedIndefinitely bool
 
 	mu sync.Mutex
 }
 
+// signalThrottle limits the rate at which a signal is sent on a channel. timer
+// is the timer of the delayed signal if one is scheduled.
+type signalThrottle struct {
+	lastSignal time.Time
+	timer      *time.Timer
+}
+
+// managedThrottledSignal sends a signal on c unless a signal was already sent
+// within the last signalThrottleInterval. In that case the signal is delayed
+// until the interval has passed. Multiple signals within the same interval are
+// coalesced into a single delayed signal.
+func (uh *uploadHeap) managedThrottledSignal(c chan struct{}, st *signalThrottle) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	if st.timer != nil || uh.signalThrottlesStopped {
+		return
+	}
+	interval := uh.signalThrottleInterval
+	if interval == 0 {
+		interval = defaultRepairSignalThrottleInterval
+	}
+	sinceLastSignal := time.Since(st.lastSignal)
+	if sinceLastSignal >= interval {
+		st.lastSignal = time.Now()
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+		return
+	}
+	st.timer = time.AfterFunc(interval-sinceLastSignal, func() {
+		uh.mu.Lock()
+		defer uh.mu.Unlock()
+		st.timer = nil
+		if uh.signalThrottlesStopped {
+			return
+		}
+		st.lastSignal = time.Now()
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// managedSetSignalThrottleInterval sets the interval of the repairNeeded and
+// stuckChunkFound signal throttles. An interval of 0 means that
+// defaultRepairSignalThrottleInterval is used.
+func (uh *uploadHeap) managedSetSignalThrottleInterval(interval time.Duration) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	uh.signalThrottleInterval = interval
+}
+
+// managedStopSignalThrottles stops the timers of the delayed signals and
+// prevents new ones from being scheduled.
+func (uh *uploadHeap) managedStopSignalThrottles() {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	uh.signalThrottlesStopped = true
+	for _, st := range []*signalThrottle{&uh.repairNeededThrottle, &uh.stuckChunkFoundThrottle} {
+		if st.timer != nil {
+			st.timer.Stop()
+			st.timer = nil
+		}
+	}
+}
+
+// managedSignalRepairNeeded sends a throttled signal to the repair loop.
+func (uh *uploadHeap) managedSignalRepairNeeded() {
+	uh.managedThrottledSignal(uh.repairNeeded, &uh.repairNeededThrottle)
+}
+
+// managedSignalStuckChunkFound sends a throttled signal to the stuck loop.
+func (uh *uploadHeap) managedSignalStuckChunkFound() {
+	uh.managedThrottledSignal(uh.stuckChunkFound, &uh.stuckChunkFoundThrottle)
+}
+
 // managedExists checks if a chunk currently exists in the upload heap. A chunk
 // exists in the upload heap if it exists in any of the heap's tracking maps
 func (uh *uploadHeap) managedExists(id uploadChunkID) bool {
@@ -171,6 +299,24 @@ func (uh *uploadHeap) managedExists(id uploadChunkID) bool {
 	return existsUnstuckHeap || existsRepairing || existsStuckHeap
 }
 
+// managedChunks returns all the chunks that are currently either in the heap or
+// being repaired.
+func (uh *uploadHeap) managedChunks() []*unfinishedUploadChunk {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	chunks := make([]*unfinishedUploadChunk, 0, len(uh.repairingChunks)+len(uh.stuckHeapChunks)+len(uh.unstuckHeapChunks))
+	for _, uc := range uh.repairingChunks {
+		chunks = append(chunks, uc)
+	}
+	for _, uc := range uh.stuckHeapChunks {
+		chunks = append(chunks, uc)
+	}
+	for _, uc := range uh.unstuckHeapChunks {
+		chunks = append(chunks, uc)
+	}
+	return chunks
+}
+
 // managedIsPaused returns the boolean indicating whether or not the user
 // has paused the repairs and uploads
 func (uh *uploadHeap) managedIsPaused() bool {
@@ -219,6 +365,28 @@ func (uh *uploadHeap) managedMarkRepairDone(id uploadChunkID) {
 	delete(uh.repairingChunks, id)
 }
 
+// managedMarkRepairDoneLast is like managedMarkRepairDone but also returns
+// whether the chunk was the last chunk of its file in the heap. Removing the
+// chunk and checking for other chunks of the file happen atomically to make
+// sure that only one of the file's chunks is the last one.
+func (uh *uploadHeap) managedMarkRepairDoneLast(id uploadChunkID) bool {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	_, ok := uh.repairingChunks[id]
+	if !ok {
+		build.Critical("Chunk is not in the repair map, this means it was removed prematurely or was never added")
+	}
+	delete(uh.repairingChunks, id)
+	for _, chunks := range []map[uploadChunkID]*unfinishedUploadChunk{uh.repairingChunks, uh.unstuckHeapChunks, uh.stuckHeapChunks} {
+		for chunkID := range chunks {
+			if chunkID.fileUID == id.fileUID {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // managedNumStuckChunks returns total number of stuck chunks in the heap and
 // the number of stuck chunks that were added at random as opposed to being
 // added due to a recently successful file repair
@@ -239,18 +407,37 @@ func (uh *uploadHeap) managedNumStuckChunks() (total int, random int) {
 func (uh *uploadHeap) managedPause(duration time.Duration) {
 	uh.mu.Lock()
 	defer uh.mu.Unlock()
+	if uh.pausedIndefinitely {
+		return
+	}
 	uh.pauseDuration = duration
 	uh.pauseStart = time.Now()
 	select {
 	case <-uh.pauseChan:
 		// Repairs and Uploads are not currently paused so pause them
-		uh.pauseChan = make(chan struct{})
+		pauseChan := make(chan struct{})
+		uh.pauseChan = pauseChan
 		uh.pauseTimer = time.AfterFunc(duration, func() {
 			uh.mu.Lock()
-			close(uh.pauseChan)
+			defer uh.mu.Unlock()
+			if uh.pausedIndefinitely {
+				// The timed pause was replaced by an indefinite one.
+				return
+			}
+			if uh.pauseChan != pauseChan {
+				// The pause this timer belongs to already ended and a new
+				// one was started.
+				return
+			}
+			select {
+			case <-pauseChan:
+				// The pause already ended.
+				return
+			default:
+			}
+			close(pauseChan)
 			uh.pauseDuration = 0
 			uh.pauseStart = time.Time{}
-			uh.mu.Unlock()
 		})
 	default:
 		// Repairs and Uploads are paused so reset the timer duration
@@ -330,6 +517,55 @@ func (uh *uploadHeap) managedPop() (uc *unfinishedUploadChunk) {
 	return uc
 }
 
+// managedRemoveFile removes all the chunks of the file with the given uid from
+// the heap. Chunks of the file which are currently being repaired are canceled
+// and returned so the caller can wait for the workers to finish them.
+func (uh *uploadHeap) managedRemoveFile(uid siafile.SiafileUID) []*unfinishedUploadChunk {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+
+	// Remove the chunks from the heap while keeping the chunks of other files.
+	remaining := make(uploadChunkHeap, 0, len(uh.heap))
+	for _, uc := range uh.heap {
+		if uc.id.fileUID != uid {
+			remaining = append(remaining, uc)
+			continue
+		}
+		delete(uh.unstuckHeapChunks, uc.id)
+		delete(uh.stuckHeapChunks, uc.id)
+		uc.fileEntry.Close()
+	}
+	uh.heap = remaining
+	heap.Init(&uh.heap)
+
+	// Cancel the chunks that are being repaired. They are removed from the
+	// repairingChunks once the workers are done with them.
+	var canceled []*unfinishedUploadChunk
+	for _, uc := range uh.repairingChunks {
+		if uc.id.fileUID != uid {
+			continue
+		}
+		uc.cancelMU.Lock()
+		uc.canceled = true
+		uc.cancelMU.Unlock()
+		canceled = append(canceled, uc)
+	}
+	return canceled
+}
+
+// managedSetUploadPriority updates the upload priority of all the chunks of
+// the file with the given uid which are currently in the heap.
+func (uh *uploadHeap) managedSetUploadPriority(uid siafile.SiafileUID, priority int) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	for _, uc := range uh.heap {
+		if uc.id.fileUID == uid {
+			uc.uploadPriority = priority
+		}
+	}
+	heap.Init(&uh.heap)
+}
+
 // managedReset will reset the slice and maps within the heap to free up memory.
 func (uh *uploadHeap) managedReset() error {
 	uh.mu.Lock()
@@ -339,10 +575,14 @@ func (uh *uploadHeap) managedReset() error {
 	return uh.heap.reset()
 }
 
-// managedResume will close the pauseChan and stop the pauseTimer
+// managedResume will close the pauseChan and stop the pauseTimer. Indefinite
+// pauses are not affected.
 func (uh *uploadHeap) managedResume() {
 	uh.mu.Lock()
 	defer uh.mu.Unlock()
+	if uh.pausedIndefinitely {
+		return
+	}
 	select {
 	case <-uh.pauseChan:
 		// uploadHeap isn't paused, nothing to do
@@ -350,17 +590,45 @@ func (uh *uploadHeap) managedResume() {
 	default:
 	}
 
-	// Stop the timer and reset the duration
-	stopped := uh.pauseTimer.Stop()
+	// Stop the timer, reset the duration and close the channel. If the timer
+	// already fired, its callback will notice that the channel was closed.
+	uh.pauseTimer.Stop()
 	uh.pauseDuration = 0
 	uh.pauseStart = time.Time{}
+	close(uh.pauseChan)
+}
 
-	// We only want to close the channel if we were able to stop the timer,
-	// otherwise the channel is already closed because the timer reached its
-	// duration
-	if stopped {
+// managedSetPausedIndefinitely pauses the heap until it is called again with
+// paused set to false. An indefinite pause replaces a timed pause.
+func (uh *uploadHeap) managedSetPausedIndefinitely(paused bool) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	if paused == uh.pausedIndefinitely {
+		return
+	}
+	uh.pausedIndefinitely = paused
+	if !paused {
 		close(uh.pauseChan)
+		return
 	}
+	select {
+	case <-uh.pauseChan:
+		// The heap is not paused so pause it.
+		uh.pauseChan = make(chan struct{})
+	default:
+		// The heap is paused for a duration. Stop the timer. If it already
+		// fired, its callback will notice the indefinite pause.
+		uh.pauseTimer.Stop()
+	}
+	uh.pauseDuration = 0
+	uh.pauseStart = time.Time{}
+}
+
+// managedPausedIndefinitely returns whether the heap is paused indefinitely.
+func (uh *uploadHeap) managedPausedIndefinitely() bool {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	return uh.pausedIndefinitely
 }
 
 // PauseRepairsAndUploads pauses the renter's repairs and uploads for a time
@@ -374,7 +642,8 @@ func (r *Renter) PauseRepairsAndUploads(duration time.Duration) error {
 	return nil
 }
 
-// ResumeRepairsAndUploads resumes the renter's repairs and uploads
+// ResumeRepairsAndUploads resumes the renter's repairs and uploads. Repairs
+// paused by PauseRepairs stay paused.
 func (r *Renter) ResumeRepairsAndUploads() error {
 	if err := r.tg.Add(); err != nil {
 		return err
@@ -384,8 +653,120 @@ func (r *Renter) ResumeRepairsAndUploads() error {
 	return nil
 }
 
+// PauseRepairs pauses the processing of the upload heap by the repair loop
+// until ResumeRepairs is called. Unlike PauseRepairsAndUploads the pause
+// doesn't expire and survives restarts. Bubbling continues while the repairs
+// are paused to keep the health of the files up to date.
+func (r *Renter) PauseRepairs() error {
+	return r.managedSetRepairsPaused(true)
+}
+
+// ResumeRepairs resumes the repairs paused by PauseRepairs.
+func (r *Renter) ResumeRepairs() error {
+	return r.managedSetRepairsPaused(false)
+}
+
+// managedSetRepairsPaused persists the paused state of the repairs and applies
+// it to the upload heap.
+func (r *Renter) managedSetRepairsPaused(paused bool) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	id := r.mu.Lock()
+	r.persist.RepairsPaused = paused
+	err := r.saveSync()
+	if err != nil {
+		r.persist.RepairsPaused = !paused
+	}
+	r.mu.Unlock(id)
+	if err != nil {
+		return errors.AddContext(err, "failed to persist paused state of repairs")
+	}
+	r.uploadHeap.managedSetPausedIndefinitely(paused)
+	return nil
+}
+
+// SetRepairThreshold sets the health at which the renter starts repairing a
+// file. The threshold is persisted and takes effect with the next bubble.
+func (r *Renter) SetRepairThreshold(threshold float64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if threshold < MinRepairThreshold || threshold > MaxRepairThreshold {
+		return ErrInvalidRepairThreshold
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.RepairThreshold = threshold
+	return r.saveSync()
+}
+
+// SetRepairSignalThrottleInterval sets the minimum amount of time between two
+// signals sent to the repair or stuck loop by bubbles of the root directory.
+// The interval is persisted. An interval of 0 resets it to the default.
+func (r *Renter) SetRepairSignalThrottleInterval(interval time.Duration) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if interval < 0 {
+		return errors.New("repair signal throttle interval can't be negative")
+	}
+	id := r.mu.Lock()
+	r.persist.RepairSignalThrottleInterval = interval
+	err := r.saveSync()
+	r.mu.Unlock(id)
+	if err != nil {
+		return errors.AddContext(err, "failed to persist repair signal throttle interval")
+	}
+	r.uploadHeap.managedSetSignalThrottleInterval(interval)
+	return nil
+}
+
+// managedRepairThreshold returns the health at which the renter starts
+// repairing a file.
+func (r *Renter) managedRepairThreshold() float64 {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	if r.persist.RepairThreshold == 0 {
+		return RepairThreshold
+	}
+	return r.persist.RepairThreshold
+}
+
+// managedFileRepairThreshold returns the health at which the renter starts
+// repairing a file, taking into account whether the file is cold.
+func (r *Renter) managedFileRepairThreshold(cold bool) float64 {
+	threshold := r.managedRepairThreshold()
+	if cold && threshold < ColdRepairThreshold {
+		threshold = ColdRepairThreshold
+	}
+	return threshold
+}
+
+// approachingUploadDeadline returns whether a file with the given upload
+// deadline should be prioritized by the repair loop. That's the case if the
+// deadline is within the uploadDeadlineWindow. Once the deadline passed the
+// file is no longer prioritized and an alert is registered instead.
+func approachingUploadDeadline(deadline, now time.Time) bool {
+	return !deadline.IsZero() && now.Before(deadline) && deadline.Sub(now) < uploadDeadlineWindow
+}
+
+// healthNeedsRepair returns whether a file or chunk with the given health
+// needs to be repaired. Usually that's the case if its health reached the
+// repair threshold but files approaching their upload deadline are repaired as
+// soon as any redundancy is missing.
+func healthNeedsRepair(health, repairThreshold float64, approachingDeadline bool) bool {
+	if approachingDeadline {
+		return health > 0
+	}
+	return health >= repairThreshold
+}
+
 // managedBuildUnfinishedChunk will pull out a single unfinished chunk of a file.
-func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIndex uint64, hosts map[string]struct{}, hostPublicKeys map[string]types.SiaPublicKey, priority bool, offline, goodForRenew map[string]bool) (*unfinishedUploadChunk, error) {
+func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIndex uint64, hosts map[string]struct{}, hostPublicKeys map[string]types.SiaPublicKey, priority bool, offline, goodForRenew map[string]bool, uptime map[string]float64, ranking *hostThroughputRanking) (*unfinishedUploadChunk, error) {
 	// Copy entry
 	entryCopy := entry.Copy()
 	stuck, err := entry.StuckChunkByIndex(chunkIndex)
@@ -401,12 +782,17 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 			index:   chunkIndex,
 		},
 
-		index:    chunkIndex,
-		length:   entry.ChunkSize(),
-		offset:   int64(chunkIndex * entry.ChunkSize()),
-		priority: priority,
+		index:          chunkIndex,
+		length:         entry.ChunkSize(),
+		offset:         int64(chunkIndex * entry.ChunkSize()),
+		priority:       priority,
+		uploadPriority: entry.UploadPriority(),
+		uploadDeadline: entry.UploadDeadline(),
+
+		staticRetryPolicy: r.managedUploadRetryPolicy(),
 
-		staticSiaPath: entryCopy.SiaFilePath(),
+		staticSiaPath:      entryCopy.SiaFilePath(),
+		staticCreationTime: time.Now(),
 
 		// memoryNeeded has to also include the logical data, and also
 		// include the overhead for encryption.
@@ -427,6 +813,7 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 		pieceUsage:  make([]bool, entry.ErasureCode().NumPieces()),
 		unusedHosts: make(map[string]struct{}, len(hosts)),
 	}
+	uuc.approachingDeadline = approachingUploadDeadline(uuc.uploadDeadline, uuc.staticCreationTime)
 
 	// Every chunk can have a different set of unused hosts.
 	for host := range hosts {
@@ -436,6 +823,9 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 	// Iterate through the pieces of all chunks of the file and mark which
 	// hosts are already in use for a particular chunk. As you delete hosts
 	// from the 'unusedHosts' map, also increment the 'piecesCompleted' value.
+	// The best uptime of the hosts storing a piece is tracked to calculate
+	// the effective health of the chunk.
+	pieceUptimes := make([]float64, entry.ErasureCode().NumPieces())
 	pieces, err := entry.Pieces(chunkIndex)
 	if err != nil {
 		r.log.Println("failed to get pieces for building incomplete chunks", err)
@@ -445,6 +835,11 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 		return nil, errors.AddContext(err, "error trying to get the pieces for the chunk")
 	}
 	for pieceIndex, pieceSet := range pieces {
+		// Pieces on hosts which aren't usable anymore still indicate that
+		// the chunk was uploaded before.
+		if len(pieceSet) > 0 {
+			uuc.repair = true
+		}
 		for _, piece := range pieceSet {
 			hpk := piece.HostPubKey.String()
 			goodForRenew, exists2 := goodForRenew[hpk]
@@ -455,6 +850,11 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 				// in the lookup maps.
 				continue
 			}
+			pieceUptime, known := uptime[hpk]
+			if !known {
+				pieceUptime = 1
+			}
+			pieceUptimes[pieceIndex] = math.Max(pieceUptimes[pieceIndex], pieceUptime)
 
 			// Mark the chunk set based on the pieces in this contract.
 			_, exists = uuc.unusedHosts[piece.HostPubKey.String()]
@@ -475,12 +875,54 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 			}
 		}
 	}
+	// Restrict the hosts the missing pieces are uploaded to if the file has
+	// preferred hosts.
+	r.managedApplyPreferredHosts(uuc, entry.PreferredHosts())
+
+	// Move repairs away from hosts with poor recent throughput. New uploads
+	// keep all hosts to finish as fast as possible.
+	if uuc.repair {
+		ranking.removeSlowHosts(uuc.unusedHosts, uuc.piecesNeeded-uuc.piecesCompleted)
+	}
+
 	// Now that we have calculated the completed pieces for the chunk we can
-	// calculate the health of the chunk to avoid a call to ChunkHealth
+	// calculate the health of the chunk to avoid a call to ChunkHealth. Chunks
+	// whose pieces are stored on flaky hosts are repaired earlier.
 	uuc.health = 1 - (float64(uuc.piecesCompleted-uuc.minimumPieces) / float64(uuc.piecesNeeded-uuc.minimumPieces))
+	var effectivePieces float64
+	for pieceIndex, used := range uuc.pieceUsage {
+		if used {
+			effectivePieces += pieceUptimes[pieceIndex]
+		}
+	}
+	minPieces := float64(uuc.minimumPieces)
+	uuc.health = effectiveHealth(uuc.health, effectivePieces/minPieces, float64(uuc.piecesNeeded)/minPieces)
 	return uuc, nil
 }
 
+// managedApplyPreferredHosts removes all hosts which are not preferred from the
+// chunk's unused hosts. If the unused preferred hosts can't store all of the
+// chunk's missing pieces, the unused hosts are left untouched. This is only
+// logged at debug level since it happens for every chunk of the file whenever
+// the upload heap is built.
+func (r *Renter) managedApplyPreferredHosts(uuc *unfinishedUploadChunk, preferred []types.SiaPublicKey) {
+	if len(preferred) == 0 {
+		return
+	}
+	preferredHosts := make(map[string]struct{}, len(preferred))
+	for _, pk := range preferred {
+		if _, unused := uuc.unusedHosts[pk.String()]; unused {
+			preferredHosts[pk.String()] = struct{}{}
+		}
+	}
+	missingPieces := uuc.piecesNeeded - uuc.piecesCompleted
+	if len(preferredHosts) < missingPieces {
+		r.log.Debugf("preferred hosts of %v can only store %v of the %v missing pieces of chunk %v, falling back to other hosts", uuc.staticSiaPath, len(preferredHosts), missingPieces, uuc.index)
+		return
+	}
+	uuc.unusedHosts = preferredHosts
+}
+
 // managedBuildUnfinishedChunks will pull all of the unfinished chunks out of a
 // file.
 //
@@ -490,7 +932,7 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 // they are done and so cannot share a SiaFileSetEntry as the first chunk to
 // finish would then close the Entry and consequentially impact the remaining
 // chunks.
-func (r *Renter) managedBuildUnfinishedChunks(entry *filesystem.FileNode, hosts map[string]struct{}, target repairTarget, offline, goodForRenew map[string]bool) []*unfinishedUploadChunk {
+func (r *Renter) managedBuildUnfinishedChunks(entry *filesystem.FileNode, hosts map[string]struct{}, target repairTarget, offline, goodForRenew map[string]bool, ranking *hostThroughputRanking) []*unfinishedUploadChunk {
 	// If we don't have enough workers for the file, don't repair it right now.
 	minPieces := entry.ErasureCode().MinPieces()
 	r.staticWorkerPool.mu.RLock()
@@ -541,6 +983,7 @@ func (r *Renter) managedBuildUnfinishedChunks(entry *filesystem.FileNode, hosts
 	for _, pk := range entry.HostPublicKeys() {
 		pks[string(pk.Key)] = pk
 	}
+	uptime := r.managedHostUptimeMap(entry.HostPublicKeys())
 
 	// Assemble the set of chunks.
 	newUnfinishedChunks := make([]*unfinishedUploadChunk, 0, len(chunkIndexes))
@@ -551,7 +994,7 @@ func (r *Renter) managedBuildUnfinishedChunks(entry *filesystem.FileNode, hosts
 		}
 
 		// Create unfinishedUploadChunk
-		chunk, err := r.managedBuildUnfinishedChunk(entry, uint64(index), hosts, pks, false, offline, goodForRenew)
+		chunk, err := r.managedBuildUnfinishedChunk(entry, uint64(index), hosts, pks, false, offline, goodForRenew, uptime, ranking)
 		if err != nil {
 			r.log.Debugln("Error when building an unfinished chunk:", err)
 			continue
@@ -561,6 +1004,8 @@ func (r *Renter) managedBuildUnfinishedChunks(entry *filesystem.FileNode, hosts
 
 	// Iterate through the set of newUnfinishedChunks and remove any that are
 	// completed or are not downloadable.
+	repairThreshold := r.managedFileRepairThreshold(entry.Cold())
+	approachingDeadline := approachingUploadDeadline(entry.UploadDeadline(), time.Now())
 	incompleteChunks := newUnfinishedChunks[:0]
 	for _, chunk := range newUnfinishedChunks {
 		// Check the chunk status. A chunk is repairable if it can be fully
@@ -575,10 +1020,10 @@ func (r *Renter) managedBuildUnfinishedChunks(entry *filesystem.FileNode, hosts
 		// accessed without error. If there is an error accessing the file then
 		// it is likely that we can not read the file in which case it can not
 		// be used for repair.
-		_, err := os.Stat(chunk.fileEntry.LocalPath())
+		_, err := os.Stat(r.chunkDataPath(chunk.fileEntry))
 		onDisk := err == nil
-		repairable := chunk.health <= 1 || onDisk
-		needsRepair := chunk.health >= RepairThreshold
+		repairable := chunk.piecesCompleted >= chunk.minimumPieces || onDisk
+		needsRepair := healthNeedsRepair(chunk.health, repairThreshold, approachingDeadline)
 
 		// Add chunk to list of incompleteChunks if it is incomplete and
 		// repairable or if we are targeting stuck chunks
@@ -656,7 +1101,7 @@ func (r *Renter) managedAddChunksToHeap(hosts map[string]struct{}) (map[modules.
 		dir.mu.Unlock()
 
 		// If the directory that was just popped is healthy then return
-		if dirHealth < RepairThreshold {
+		if dirHealth < r.managedRepairThreshold() {
 			r.repairLog.Debugln("no more chunks added to the upload heap because directory popped is healthy")
 			return siaPaths, nil
 		}
@@ -696,11 +1141,12 @@ func (r *Renter) managedBuildAndPushRandomChunk(siaPath modules.SiaPath, hosts m
 		return err
 	}
 
-	// Build offline and goodForRenew maps
+	// Build offline and goodForRenew maps and rank the hosts
 	offline, goodForRenew, _ := r.managedContractUtilityMaps()
+	ranking := r.managedHostThroughputRanking()
 
 	// Build the unfinished stuck chunks from the file
-	unfinishedUploadChunks := r.managedBuildUnfinishedChunks(file, hosts, target, offline, goodForRenew)
+	unfinishedUploadChunks := r.managedBuildUnfinishedChunks(file, hosts, target, offline, goodForRenew, ranking)
 
 	// Sanity check that there are stuck chunks
 	if len(unfinishedUploadChunks) == 0 {
@@ -731,7 +1177,7 @@ func (r *Renter) managedBuildAndPushRandomChunk(siaPath modules.SiaPath, hosts m
 //
 // NOTE: the files submitted to this function should all be from the same
 // directory
-func (r *Renter) callBuildAndPushChunks(files []*filesystem.FileNode, hosts map[string]struct{}, target repairTarget, offline, goodForRenew map[string]bool) {
+func (r *Renter) callBuildAndPushChunks(files []*filesystem.FileNode, hosts map[string]struct{}, target repairTarget, offline, goodForRenew map[string]bool, ranking *hostThroughputRanking) {
 	// Sanity check that at least one file was provided
 	if len(files) == 0 {
 		build.Critical("callBuildAndPushChunks called without providing any files")
@@ -754,7 +1200,7 @@ func (r *Renter) callBuildAndPushChunks(files []*filesystem.FileNode, hosts map[
 
 		// Build unfinished chunks from file and add them to the temp heap if
 		// they are a worse health than the directory heap
-		unfinishedUploadChunks := r.managedBuildUnfinishedChunks(file, hosts, target, offline, goodForRenew)
+		unfinishedUploadChunks := r.managedBuildUnfinishedChunks(file, hosts, target, offline, goodForRenew, ranking)
 		for i := 0; i < len(unfinishedUploadChunks); i++ {
 			chunk := unfinishedUploadChunks[i]
 			// Check to see the chunk is already in the upload heap
@@ -852,7 +1298,7 @@ func (r *Renter) callBuildAndPushChunks(files []*filesystem.FileNode, hosts map[
 	}
 
 	// Check if we should add the directory back to the directory heap
-	if worstIgnoredHealth < RepairThreshold {
+	if worstIgnoredHealth < r.managedRepairThreshold() {
 		return
 	}
 
@@ -901,6 +1347,8 @@ func (r *Renter) managedBuildChunkHeap(dirSiaPath modules.SiaPath, hosts map[str
 	}
 	// Build files from fileinfos
 	var files []*filesystem.FileNode
+	repairThreshold := r.managedRepairThreshold()
+	coldRepairThreshold := r.managedFileRepairThreshold(true)
 	for _, fi := range fileinfos {
 		// skip sub directories and non siafiles
 		ext := filepath.Ext(fi.Name())
@@ -937,7 +1385,14 @@ func (r *Renter) managedBuildChunkHeap(dirSiaPath modules.SiaPath, hosts map[str
 		// information updated by bubble this cached health is accurate enough
 		// to use in order to determine if a file has any chunks that need
 		// repair
-		ignore := file.NumChunks() == file.NumStuckChunks() || file.Metadata().CachedHealth < RepairThreshold
+		fileRepairThreshold := repairThreshold
+		if file.Cold() {
+			fileRepairThreshold = coldRepairThreshold
+		}
+		md := file.Metadata()
+		ec := file.ErasureCode()
+		health := effectiveHealth(md.CachedHealth, md.CachedEffectiveRedundancy, float64(ec.NumPieces())/float64(ec.MinPieces()))
+		ignore := file.NumChunks() == file.NumStuckChunks() || !healthNeedsRepair(health, fileRepairThreshold, approachingUploadDeadline(md.UploadDeadline, time.Now()))
 		if target == targetUnstuckChunks && ignore {
 			file.Close()
 			continue
@@ -985,15 +1440,16 @@ func (r *Renter) managedBuildChunkHeap(dirSiaPath modules.SiaPath, hosts map[str
 
 	// Build the unfinished upload chunks and add them to the upload heap
 	offline, goodForRenew, _ := r.managedContractUtilityMaps()
+	ranking := r.managedHostThroughputRanking()
 	switch target {
 	case targetBackupChunks:
 		r.log.Debugln("Attempting to add backup chunks to heap")
-		r.callBuildAndPushChunks(files, hosts, target, offline, goodForRenew)
+		r.callBuildAndPushChunks(files, hosts, target, offline, goodForRenew, ranking)
 	case targetStuckChunks:
 		r.log.Println("stuck repair target used incorrectly")
 	case targetUnstuckChunks:
 		r.log.Debugln("Attempting to add chunks to heap")
-		r.callBuildAndPushChunks(files, hosts, target, offline, goodForRenew)
+		r.callBuildAndPushChunks(files, hosts, target, offline, goodForRenew, ranking)
 	default:
 		r.log.Println("WARN: repair target not recognized", target)
 	}
@@ -1058,7 +1514,7 @@ func (r *Renter) managedRepairLoop(hosts map[string]struct{}) error {
 	// heap size. We want to process all of the chunks if the rest of the
 	// directory heap is in good health and there are no more chunks that could
 	// be added to the heap.
-	smallRepair := r.directoryHeap.managedPeekHealth() < RepairThreshold
+	smallRepair := r.directoryHeap.managedPeekHealth() < r.managedRepairThreshold()
 
 	// Limit the amount of time spent in each iteration of the repair loop so
 	// that changes to the directory heap take effect sooner rather than later.
@@ -1135,6 +1591,13 @@ func (r *Renter) managedRepairLoop(hosts map[string]struct{}) error {
 			continue
 		}
 
+		// Wait until the repair bandwidth limit allows repairing the chunk.
+		if err := r.managedWaitForRepairBandwidth(nextChunk); err != nil {
+			nextChunk.fileEntry.Close()
+			r.uploadHeap.managedMarkRepairDone(nextChunk.id)
+			return err
+		}
+
 		// Perform the work. managedPrepareNextChunk will block until
 		// enough memory is available to perform the work, slowing this
 		// thread down to using only the resources that are available.
@@ -1150,6 +1613,8 @@ func (r *Renter) managedRepairLoop(hosts map[string]struct{}) error {
 			r.uploadHeap.managedMarkRepairDone(nextChunk.id)
 			continue
 		}
+		// Only dispatched repairs count towards the repair bandwidth.
+		r.managedReserveRepairBandwidth(nextChunk)
 	}
 	return nil
 }
@@ -1258,7 +1723,7 @@ func (r *Renter) threadedUploadAndRepair() {
 		// Check if there is work to do. If the filesystem is healthy and the
 		// heap is empty, there is no work to do and the thread should block
 		// until there is work to do.
-		if r.uploadHeap.managedLen() == 0 && r.directoryHeap.managedPeekHealth() < RepairThreshold {
+		if r.uploadHeap.managedLen() == 0 && r.directoryHeap.managedPeekHealth() < r.managedRepairThreshold() {
 			// TODO: This has a tiny window where it might be dumping out chunks
 			// that need health, if the upload call is appending to the
 			// directory heap because there is a new upload.
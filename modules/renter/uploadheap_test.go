@@ -1,9 +1,16 @@
 package renter
 
 import (
+	"container/heap"
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
@@ -11,6 +18,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
 	"gitlab.com/NebulousLabs/Sia/persist"
 	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
 )
 
 // TestBuildUnfinishedChunks probes buildUnfinishedChunks to make sure that the
@@ -73,7 +81,7 @@ func TestBuildUnfinishedChunks(t *testing.T) {
 
 	// Call managedBuildUnfinishedChunks as not stuck loop, all un stuck chunks
 	// should be returned
-	uucs := rt.renter.managedBuildUnfinishedChunks(f, hosts, targetUnstuckChunks, offline, goodForRenew)
+	uucs := rt.renter.managedBuildUnfinishedChunks(f, hosts, targetUnstuckChunks, offline, goodForRenew, nil)
 	if len(uucs) != int(f.NumChunks())-1 {
 		t.Fatalf("Incorrect number of chunks returned, expected %v got %v", int(f.NumChunks())-1, len(uucs))
 	}
@@ -85,7 +93,7 @@ func TestBuildUnfinishedChunks(t *testing.T) {
 
 	// Call managedBuildUnfinishedChunks as stuck loop, all stuck chunks should
 	// be returned
-	uucs = rt.renter.managedBuildUnfinishedChunks(f, hosts, targetStuckChunks, offline, goodForRenew)
+	uucs = rt.renter.managedBuildUnfinishedChunks(f, hosts, targetStuckChunks, offline, goodForRenew, nil)
 	if len(uucs) != 1 {
 		t.Fatalf("Incorrect number of chunks returned, expected 1 got %v", len(uucs))
 	}
@@ -103,7 +111,7 @@ func TestBuildUnfinishedChunks(t *testing.T) {
 
 	// Call managedBuildUnfinishedChunks as not stuck loop, since the file is
 	// now not repairable it should return no chunks
-	uucs = rt.renter.managedBuildUnfinishedChunks(f, hosts, targetUnstuckChunks, offline, goodForRenew)
+	uucs = rt.renter.managedBuildUnfinishedChunks(f, hosts, targetUnstuckChunks, offline, goodForRenew, nil)
 	if len(uucs) != 0 {
 		t.Fatalf("Incorrect number of chunks returned, expected 0 got %v", len(uucs))
 	}
@@ -112,7 +120,7 @@ func TestBuildUnfinishedChunks(t *testing.T) {
 	// returned because they should have been marked as stuck by the previous
 	// call and stuck chunks should still be returned if the file is not
 	// repairable
-	uucs = rt.renter.managedBuildUnfinishedChunks(f, hosts, targetStuckChunks, offline, goodForRenew)
+	uucs = rt.renter.managedBuildUnfinishedChunks(f, hosts, targetStuckChunks, offline, goodForRenew, nil)
 	if len(uucs) != int(f.NumChunks()) {
 		t.Fatalf("Incorrect number of chunks returned, expected %v got %v", f.NumChunks(), len(uucs))
 	}
@@ -355,7 +363,7 @@ func TestAddChunksToHeap(t *testing.T) {
 
 	// Call bubbled to ensure directory metadata is updated
 	for _, siaPath := range dirSiaPaths {
-		err := rt.renter.managedBubbleMetadata(siaPath)
+		err := rt.renter.managedBubbleMetadata(context.Background(), siaPath)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -459,7 +467,7 @@ func TestAddDirectoryBackToHeap(t *testing.T) {
 	rt.renter.directoryHeap.managedReset()
 
 	// Add chunks from file to uploadHeap
-	rt.renter.callBuildAndPushChunks([]*filesystem.FileNode{f}, hosts, targetUnstuckChunks, offline, goodForRenew)
+	rt.renter.callBuildAndPushChunks([]*filesystem.FileNode{f}, hosts, targetUnstuckChunks, offline, goodForRenew, nil)
 
 	// Upload heap should now have NumChunks chunks and directory heap should still be empty
 	if rt.renter.uploadHeap.managedLen() != int(f.NumChunks()) {
@@ -495,7 +503,7 @@ func TestAddDirectoryBackToHeap(t *testing.T) {
 	uploadHeapLen := rt.renter.uploadHeap.managedLen()
 
 	// Try and add chunks to upload heap again
-	rt.renter.callBuildAndPushChunks([]*filesystem.FileNode{f}, hosts, targetUnstuckChunks, offline, goodForRenew)
+	rt.renter.callBuildAndPushChunks([]*filesystem.FileNode{f}, hosts, targetUnstuckChunks, offline, goodForRenew, nil)
 
 	// No chunks should have been added to the upload heap
 	if rt.renter.uploadHeap.managedLen() != uploadHeapLen {
@@ -652,3 +660,870 @@ func TestUploadHeapPauseChan(t *testing.T) {
 	uh.managedResume()
 	uh.managedResume()
 }
+
+// TestUploadHeapPausedIndefinitely tests that indefinite pauses replace timed
+// pauses and are unaffected by them.
+func TestUploadHeapPausedIndefinitely(t *testing.T) {
+	uh := uploadHeap{
+		pauseChan: make(chan struct{}),
+	}
+	close(uh.pauseChan)
+
+	// Replace a short timed pause by an indefinite one. The timer shouldn't
+	// resume the heap.
+	uh.managedPause(10 * time.Millisecond)
+	uh.managedSetPausedIndefinitely(true)
+	time.Sleep(50 * time.Millisecond)
+	if !uh.managedIsPaused() || !uh.managedPausedIndefinitely() {
+		t.Fatal("heap should be paused indefinitely")
+	}
+	if paused, endTime := uh.managedPauseStatus(); !paused || !endTime.IsZero() {
+		t.Fatal("wrong pause status", paused, endTime)
+	}
+
+	// Timed pauses and resumes are ignored.
+	uh.managedPause(10 * time.Millisecond)
+	uh.managedResume()
+	time.Sleep(50 * time.Millisecond)
+	if !uh.managedIsPaused() {
+		t.Fatal("heap should still be paused")
+	}
+
+	// Resuming twice shouldn't panic.
+	uh.managedSetPausedIndefinitely(false)
+	uh.managedSetPausedIndefinitely(false)
+	if uh.managedIsPaused() || uh.managedPausedIndefinitely() {
+		t.Fatal("heap should be resumed")
+	}
+}
+
+// TestUploadHeapPauseStaleTimer tests that the timer of a pause that already
+// ended neither closes the pauseChan twice nor ends a newer pause.
+func TestUploadHeapPauseStaleTimer(t *testing.T) {
+	uh := uploadHeap{
+		pauseChan: make(chan struct{}),
+	}
+	close(uh.pauseChan)
+
+	// Start a timed pause and replace it by an indefinite one which is ended
+	// again.
+	uh.managedPause(time.Hour)
+	staleTimer := uh.pauseTimer
+	uh.managedSetPausedIndefinitely(true)
+	uh.managedSetPausedIndefinitely(false)
+
+	// Fire the timer of the old pause. This shouldn't panic.
+	staleTimer.Reset(0)
+	time.Sleep(50 * time.Millisecond)
+	if uh.managedIsPaused() {
+		t.Fatal("heap shouldn't be paused")
+	}
+
+	// Start a new pause and fire the old timer again. The new pause shouldn't
+	// end.
+	uh.managedPause(time.Hour)
+	staleTimer.Reset(0)
+	time.Sleep(50 * time.Millisecond)
+	if !uh.managedIsPaused() {
+		t.Fatal("new pause was ended by the timer of the old pause")
+	}
+	uh.managedResume()
+	if uh.managedIsPaused() {
+		t.Fatal("heap should be resumed")
+	}
+}
+
+// TestPauseRepairs tests that the paused state of the repairs is reported and
+// persisted.
+func TestPauseRepairs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.PauseRepairs(); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := rt.renter.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settings.UploadsStatus.Paused || !settings.UploadsStatus.RepairsPaused {
+		t.Fatal("repairs should be paused", settings.UploadsStatus)
+	}
+
+	// The repairs should still be paused after a restart.
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rt.renter, err = newRenterWithDependency(rt.gateway, rt.cs, rt.wallet, rt.tpool, filepath.Join(rt.dir, modules.RenterDir), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rt.renter.uploadHeap.managedIsPaused() || !rt.renter.uploadHeap.managedPausedIndefinitely() {
+		t.Fatal("repairs should be paused after restart")
+	}
+
+	// Resume the repairs.
+	if err := rt.renter.ResumeRepairs(); err != nil {
+		t.Fatal(err)
+	}
+	settings, err = rt.renter.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.UploadsStatus.Paused || settings.UploadsStatus.RepairsPaused {
+		t.Fatal("repairs should be resumed", settings.UploadsStatus)
+	}
+}
+
+// TestCancelUpload tests that canceling an upload removes the file's chunks
+// from the upload heap without affecting the chunks of other files.
+func TestCancelUpload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create Renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create two files. The first one consists of 2 chunks and the second one
+	// of a single chunk.
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFile := func(size uint64) (modules.SiaPath, *filesystem.FileNode) {
+		siaPath := modules.RandomSiaPath()
+		err := rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), size, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return siaPath, sf
+	}
+	pathA, sfA := newFile(2 * modules.SectorSize)
+	defer sfA.Close()
+	_, sfB := newFile(modules.SectorSize)
+	defer sfB.Close()
+
+	nilMap := make(map[string]bool)
+	push := func(sf *filesystem.FileNode, index uint64) {
+		chunk, err := rt.renter.managedBuildUnfinishedChunk(sf, index, make(map[string]struct{}), make(map[string]types.SiaPublicKey), false, nilMap, nilMap, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rt.renter.uploadHeap.managedPush(chunk) {
+			t.Fatal("chunk wasn't pushed")
+		}
+	}
+
+	// Push the first chunk of file A and pop it to simulate a repair. Then
+	// push the remaining chunks.
+	push(sfA, 0)
+	repairing := rt.renter.uploadHeap.managedPop()
+	if repairing == nil {
+		t.Fatal("no chunk was popped")
+	}
+	push(sfA, 1)
+	push(sfB, 0)
+
+	// Cancel the upload of file A.
+	if err := rt.renter.CancelUpload(pathA, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the chunk of file B should be left in the heap.
+	if l := rt.renter.uploadHeap.managedLen(); l != 1 {
+		t.Fatal("expected 1 chunk in the heap but got", l)
+	}
+	uc := rt.renter.uploadHeap.managedPop()
+	if uc.id.fileUID != sfB.UID() {
+		t.Fatal("wrong chunk left in the heap")
+	}
+	// The repairing chunk should be canceled.
+	repairing.cancelMU.Lock()
+	canceled := repairing.canceled
+	repairing.cancelMU.Unlock()
+	if !canceled {
+		t.Fatal("repairing chunk wasn't canceled")
+	}
+	// File A should be deleted.
+	if _, err := rt.renter.File(pathA); err == nil {
+		t.Fatal("file wasn't deleted")
+	}
+}
+
+// TestUploadHeapUploadPriority tests that chunks of files with a higher upload
+// priority are popped first and that the priority of files can be changed
+// while their chunks are in the heap.
+func TestUploadHeapUploadPriority(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Check the ordering of the heap first. Chunks with a higher upload
+	// priority come first and the health is used as a tie breaker.
+	var uch uploadChunkHeap
+	heap.Push(&uch, &unfinishedUploadChunk{id: uploadChunkID{index: 1}, health: 0.9})
+	heap.Push(&uch, &unfinishedUploadChunk{id: uploadChunkID{index: 2}, health: 0.5, uploadPriority: 1})
+	heap.Push(&uch, &unfinishedUploadChunk{id: uploadChunkID{index: 3}, health: 0.7, uploadPriority: 1})
+	for _, expected := range []uint64{3, 2, 1} {
+		if uc := heap.Pop(&uch).(*unfinishedUploadChunk); uc.id.index != expected {
+			t.Fatalf("expected chunk %v but got %v", expected, uc.id.index)
+		}
+	}
+
+	// Create Renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create two files and push their chunks.
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nilMap := make(map[string]bool)
+	var paths []modules.SiaPath
+	var uids []siafile.SiafileUID
+	for i := 0; i < 2; i++ {
+		siaPath := modules.RandomSiaPath()
+		err := rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := rt.renter.managedBuildUnfinishedChunk(sf, 0, make(map[string]struct{}), make(map[string]types.SiaPublicKey), false, nilMap, nilMap, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rt.renter.uploadHeap.managedPush(chunk) {
+			t.Fatal("chunk wasn't pushed")
+		}
+		paths = append(paths, siaPath)
+		uids = append(uids, sf.UID())
+		sf.Close()
+	}
+
+	// Prioritize both files in turn. The prioritized file's chunk should be
+	// at the top of the heap.
+	for i := range paths {
+		if err := rt.renter.SetUploadPriority(paths[i], i+1); err != nil {
+			t.Fatal(err)
+		}
+		rt.renter.uploadHeap.mu.Lock()
+		top := rt.renter.uploadHeap.heap[0]
+		rt.renter.uploadHeap.mu.Unlock()
+		if top.id.fileUID != uids[i] {
+			t.Fatal("prioritized chunk isn't at the top of the heap")
+		}
+		// The priority should be persisted in the file.
+		sf, err := rt.renter.staticFileSystem.OpenSiaFile(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sf.UploadPriority() != i+1 {
+			t.Fatal("wrong upload priority", sf.UploadPriority())
+		}
+		sf.Close()
+	}
+}
+
+// TestUploadHeapUploadDeadline tests that chunks of files approaching their
+// upload deadline are popped first and that the deadline is picked up when
+// building chunks.
+func TestUploadHeapUploadDeadline(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Check the ordering of the heap first. Chunks approaching their deadline
+	// come before chunks with a higher upload priority and earlier deadlines
+	// come first.
+	now := time.Now()
+	var uch uploadChunkHeap
+	heap.Push(&uch, &unfinishedUploadChunk{id: uploadChunkID{index: 1}, health: 0.9, uploadPriority: 1})
+	heap.Push(&uch, &unfinishedUploadChunk{id: uploadChunkID{index: 2}, health: 0.5, uploadDeadline: now.Add(time.Second), approachingDeadline: true})
+	heap.Push(&uch, &unfinishedUploadChunk{id: uploadChunkID{index: 3}, health: 0.5, uploadDeadline: now, approachingDeadline: true})
+	heap.Push(&uch, &unfinishedUploadChunk{id: uploadChunkID{index: 4}, health: 0.9})
+	for _, expected := range []uint64{3, 2, 1, 4} {
+		if uc := heap.Pop(&uch).(*unfinishedUploadChunk); uc.id.index != expected {
+			t.Fatalf("expected chunk %v but got %v", expected, uc.id.index)
+		}
+	}
+
+	// Only deadlines within the window are approaching.
+	if approachingUploadDeadline(time.Time{}, now) {
+		t.Fatal("missing deadline shouldn't be approaching")
+	}
+	if approachingUploadDeadline(now.Add(2*uploadDeadlineWindow), now) {
+		t.Fatal("deadline outside of the window shouldn't be approaching")
+	}
+	if !approachingUploadDeadline(now.Add(uploadDeadlineWindow/2), now) {
+		t.Fatal("deadline within the window should be approaching")
+	}
+	if approachingUploadDeadline(now.Add(-time.Second), now) {
+		t.Fatal("passed deadline shouldn't be approaching")
+	}
+
+	// Files approaching their deadline are repaired as soon as any redundancy
+	// is missing.
+	if healthNeedsRepair(0.1, RepairThreshold, false) || !healthNeedsRepair(0.1, RepairThreshold, true) {
+		t.Fatal("wrong repair decision for missing redundancy")
+	}
+	if healthNeedsRepair(0, RepairThreshold, true) {
+		t.Fatal("healthy file shouldn't need repair")
+	}
+	if !healthNeedsRepair(RepairThreshold, RepairThreshold, false) {
+		t.Fatal("file at the repair threshold should need repair")
+	}
+
+	// Create Renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file with a deadline and build its chunk.
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	deadline := now.Add(uploadDeadlineWindow / 2)
+	if err := sf.SetUploadDeadline(deadline); err != nil {
+		t.Fatal(err)
+	}
+	nilMap := make(map[string]bool)
+	chunk, err := rt.renter.managedBuildUnfinishedChunk(sf, 0, make(map[string]struct{}), make(map[string]types.SiaPublicKey), false, nilMap, nilMap, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chunk.uploadDeadline.Equal(deadline) || !chunk.approachingDeadline {
+		t.Fatal("chunk doesn't approach its deadline", chunk.uploadDeadline, chunk.approachingDeadline)
+	}
+	fi, err := rt.renter.File(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.UploadDeadline.Equal(deadline) {
+		t.Fatal("wrong upload deadline", fi.UploadDeadline)
+	}
+}
+
+// TestBuildUnfinishedChunkPreferredHosts tests that the unused hosts of a
+// chunk are restricted to the file's preferred hosts if they can store all the
+// missing pieces.
+func TestBuildUnfinishedChunkPreferredHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create Renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file with 3 pieces per chunk.
+	ec, err := siafile.NewRSCode(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+
+	// Create 5 hosts.
+	var pks []types.SiaPublicKey
+	hosts := make(map[string]struct{})
+	for i := 0; i < 5; i++ {
+		pk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(crypto.PublicKeySize)}
+		pks = append(pks, pk)
+		hosts[pk.String()] = struct{}{}
+	}
+	nilMap := make(map[string]bool)
+
+	// Without preferred hosts all hosts should be used.
+	chunk, err := rt.renter.managedBuildUnfinishedChunk(sf, 0, hosts, make(map[string]types.SiaPublicKey), false, nilMap, nilMap, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunk.unusedHosts) != len(hosts) {
+		t.Fatalf("expected %v unused hosts but got %v", len(hosts), len(chunk.unusedHosts))
+	}
+
+	// Prefer 3 hosts. That's enough for all the pieces.
+	if err := sf.SetPreferredHosts(pks[:3]); err != nil {
+		t.Fatal(err)
+	}
+	chunk, err = rt.renter.managedBuildUnfinishedChunk(sf, 0, hosts, make(map[string]types.SiaPublicKey), false, nilMap, nilMap, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunk.unusedHosts) != 3 {
+		t.Fatalf("expected %v unused hosts but got %v", 3, len(chunk.unusedHosts))
+	}
+	for _, pk := range pks[:3] {
+		if _, exists := chunk.unusedHosts[pk.String()]; !exists {
+			t.Fatal("preferred host is not an unused host")
+		}
+	}
+
+	// Prefer 2 hosts. That's not enough so the renter should fall back to all
+	// hosts.
+	if err := sf.SetPreferredHosts(pks[:2]); err != nil {
+		t.Fatal(err)
+	}
+	chunk, err = rt.renter.managedBuildUnfinishedChunk(sf, 0, hosts, make(map[string]types.SiaPublicKey), false, nilMap, nilMap, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunk.unusedHosts) != len(hosts) {
+		t.Fatalf("expected %v unused hosts but got %v", len(hosts), len(chunk.unusedHosts))
+	}
+
+	// The preferred hosts should be persisted.
+	sf2, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf2.Close()
+	if preferred := sf2.PreferredHosts(); len(preferred) != 2 || preferred[0].String() != pks[0].String() || preferred[1].String() != pks[1].String() {
+		t.Fatal("wrong preferred hosts", preferred)
+	}
+}
+
+// TestBuildUnfinishedChunkEffectiveHealth tests that the health of a chunk
+// which is missing pieces accounts for the uptime of its hosts.
+func TestBuildUnfinishedChunkEffectiveHealth(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file with 4 pieces per chunk of which 2 are required.
+	ec, err := siafile.NewRSCode(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+
+	// Upload 3 of the pieces to good hosts with an uptime of 50%.
+	hosts := make(map[string]struct{})
+	offline := make(map[string]bool)
+	goodForRenew := make(map[string]bool)
+	uptime := make(map[string]float64)
+	var pks []types.SiaPublicKey
+	for i := 0; i < 4; i++ {
+		pk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(crypto.PublicKeySize)}
+		pks = append(pks, pk)
+		hosts[pk.String()] = struct{}{}
+		offline[pk.String()] = false
+		goodForRenew[pk.String()] = true
+		uptime[pk.String()] = 0.5
+	}
+	for i := 0; i < 3; i++ {
+		if err := sf.AddPiece(pks[i], 0, uint64(i), crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// With perfect uptime, the chunk has a health of 0.5.
+	chunk, err := rt.renter.managedBuildUnfinishedChunk(sf, 0, hosts, make(map[string]types.SiaPublicKey), false, offline, goodForRenew, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.health != 0.5 {
+		t.Fatal("wrong health", chunk.health)
+	}
+	// The 1.5 effective pieces on the flaky hosts result in a worse health.
+	chunk, err = rt.renter.managedBuildUnfinishedChunk(sf, 0, hosts, make(map[string]types.SiaPublicKey), false, offline, goodForRenew, uptime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.health != 1.25 {
+		t.Fatal("wrong effective health", chunk.health)
+	}
+
+	// Once all the pieces are uploaded there is nothing to repair and the
+	// uptime is ignored.
+	if err := sf.AddPiece(pks[3], 0, 3, crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	chunk, err = rt.renter.managedBuildUnfinishedChunk(sf, 0, hosts, make(map[string]types.SiaPublicKey), false, offline, goodForRenew, uptime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.health != 0 {
+		t.Fatal("complete chunk should be healthy", chunk.health)
+	}
+}
+
+// TestUploadHeapThrottledSignals tests that the repairNeeded and
+// stuckChunkFound signals sent by bubbles are throttled and that no delayed
+// signals are sent after the throttles were stopped.
+func TestUploadHeapThrottledSignals(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	interval := 200 * time.Millisecond
+	uh := uploadHeap{
+		repairNeeded:    make(chan struct{}, 1),
+		stuckChunkFound: make(chan struct{}, 1),
+	}
+	uh.managedSetSignalThrottleInterval(interval)
+	signals := []struct {
+		signal func()
+		c      chan struct{}
+	}{
+		{uh.managedSignalRepairNeeded, uh.repairNeeded},
+		{uh.managedSignalStuckChunkFound, uh.stuckChunkFound},
+	}
+	for _, s := range signals {
+		// The first signal should be sent right away.
+		start := time.Now()
+		s.signal()
+		select {
+		case <-s.c:
+		default:
+			t.Fatal("first signal wasn't sent")
+		}
+
+		// Signals within the interval should be coalesced into a single
+		// delayed signal.
+		s.signal()
+		s.signal()
+		select {
+		case <-s.c:
+			t.Fatal("signal wasn't throttled")
+		default:
+		}
+		select {
+		case <-s.c:
+		case <-time.After(2 * interval):
+			t.Fatal("delayed signal wasn't sent")
+		}
+		if time.Since(start) < interval {
+			t.Fatal("delayed signal was sent too early")
+		}
+		select {
+		case <-s.c:
+			t.Fatal("signals weren't coalesced")
+		case <-time.After(interval):
+		}
+	}
+
+	// Schedule a delayed signal and stop the throttles. The delayed signal
+	// shouldn't be sent and no new signals should be scheduled.
+	uh.managedSignalRepairNeeded()
+	<-uh.repairNeeded
+	uh.managedSignalRepairNeeded()
+	uh.managedStopSignalThrottles()
+	uh.managedSignalStuckChunkFound()
+	select {
+	case <-uh.repairNeeded:
+		t.Fatal("delayed signal was sent after stopping the throttles")
+	case <-uh.stuckChunkFound:
+		t.Fatal("signal was sent after stopping the throttles")
+	case <-time.After(2 * interval):
+	}
+}
+
+// TestSetRepairSignalThrottleInterval tests that the repair signal throttle
+// interval can be set and that it is persisted.
+func TestSetRepairSignalThrottleInterval(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create Renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Negative intervals should be rejected.
+	if err := r.SetRepairSignalThrottleInterval(-time.Second); err == nil {
+		t.Fatal("expected negative interval to be rejected")
+	}
+
+	// Set a valid interval. It should be applied to the upload heap.
+	if err := r.SetRepairSignalThrottleInterval(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	r.uploadHeap.mu.Lock()
+	interval := r.uploadHeap.signalThrottleInterval
+	r.uploadHeap.mu.Unlock()
+	if interval != time.Hour {
+		t.Fatal("interval wasn't applied to the upload heap", interval)
+	}
+
+	// The interval should be persisted.
+	if err := r.managedLoadSettings(); err != nil {
+		t.Fatal(err)
+	}
+	id := r.mu.RLock()
+	interval = r.persist.RepairSignalThrottleInterval
+	r.mu.RUnlock(id)
+	if interval != time.Hour {
+		t.Fatal("interval wasn't persisted", interval)
+	}
+}
+
+// TestSetRepairThreshold tests that the repair threshold can be set within its
+// bounds and that it is persisted.
+func TestSetRepairThreshold(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create Renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// The default should be used initially.
+	if threshold := rt.renter.managedRepairThreshold(); threshold != RepairThreshold {
+		t.Fatalf("expected threshold %v but got %v", RepairThreshold, threshold)
+	}
+
+	// Thresholds out of bounds should be rejected.
+	for _, threshold := range []float64{0, MinRepairThreshold / 2, MaxRepairThreshold * 2, -1} {
+		if err := rt.renter.SetRepairThreshold(threshold); !errors.Contains(err, ErrInvalidRepairThreshold) {
+			t.Fatalf("expected ErrInvalidRepairThreshold for %v but got %v", threshold, err)
+		}
+	}
+
+	// Set a valid threshold.
+	if err := rt.renter.SetRepairThreshold(0.5); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := rt.renter.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.RepairThreshold != 0.5 {
+		t.Fatal("wrong threshold in settings", settings.RepairThreshold)
+	}
+
+	// The threshold should be persisted.
+	if err := rt.renter.managedLoadSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if threshold := rt.renter.managedRepairThreshold(); threshold != 0.5 {
+		t.Fatal("threshold wasn't persisted", threshold)
+	}
+
+	// SetSettings should reject an invalid threshold without applying any of
+	// the other settings.
+	settings.RepairThreshold = MaxRepairThreshold * 2
+	settings.MaxDownloadSpeed = 1e6
+	if err := rt.renter.SetSettings(settings); !errors.Contains(err, ErrInvalidRepairThreshold) {
+		t.Fatal("expected ErrInvalidRepairThreshold but got", err)
+	}
+	settings, err = rt.renter.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.MaxDownloadSpeed != 0 || settings.RepairThreshold != 0.5 {
+		t.Fatal("settings were applied despite the invalid threshold", settings.MaxDownloadSpeed, settings.RepairThreshold)
+	}
+
+	// SetSettings should apply a valid threshold.
+	settings.RepairThreshold = 0.25
+	if err := rt.renter.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if threshold := rt.renter.managedRepairThreshold(); threshold != 0.25 {
+		t.Fatal("threshold wasn't set by SetSettings", threshold)
+	}
+}
+
+// TestCanceledChunkDropped tests that a worker drops a canceled chunk from its
+// queue, which releases the chunk from the repairing chunks without changing
+// its stuck status.
+func TestCanceledChunkDropped(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create Renter
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file with a single stuck chunk.
+	ec, err := siafile.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), modules.SectorSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	if err := sf.SetStuck(0, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Push the chunk and pop it to simulate a repair.
+	nilMap := make(map[string]bool)
+	chunk, err := rt.renter.managedBuildUnfinishedChunk(sf, 0, make(map[string]struct{}), make(map[string]types.SiaPublicKey), true, nilMap, nilMap, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rt.renter.uploadHeap.managedPush(chunk) {
+		t.Fatal("chunk wasn't pushed")
+	}
+	if rt.renter.uploadHeap.managedPop() != chunk {
+		t.Fatal("wrong chunk was popped")
+	}
+
+	// Prepare the chunk as if it was distributed to a single worker. All the
+	// pieces are completed, so a chunk which wasn't canceled would be marked
+	// as unstuck once it is released.
+	chunk.memoryNeeded = uint64(len(chunk.pieceUsage)) * modules.SectorSize
+	if !rt.renter.memoryManager.Request(chunk.memoryNeeded, memoryPriorityHigh) {
+		t.Fatal("memory wasn't granted")
+	}
+	chunk.physicalChunkData = make([][]byte, len(chunk.pieceUsage))
+	chunk.piecesCompleted = chunk.piecesNeeded
+	chunk.workersRemaining = 1
+	chunk.canceled = true
+
+	// The worker should drop the chunk.
+	w := &worker{
+		renter:            rt.renter,
+		unprocessedChunks: []*unfinishedUploadChunk{chunk},
+	}
+	if !w.managedPerformUploadChunkJob() {
+		t.Fatal("worker didn't perform a job")
+	}
+	if len(w.unprocessedChunks) != 0 {
+		t.Fatal("canceled chunk wasn't removed from the queue")
+	}
+	if rt.renter.uploadHeap.managedExists(chunk.id) {
+		t.Fatal("canceled chunk wasn't released")
+	}
+
+	// The chunk should still be stuck.
+	sf2, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf2.Close()
+	stuck, err := sf2.StuckChunkByIndex(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stuck {
+		t.Fatal("stuck status of canceled chunk was changed")
+	}
+}
+
+// TestMarkRepairDoneLast tests that managedMarkRepairDoneLast only reports the
+// last chunk of a file in the heap.
+func TestMarkRepairDoneLast(t *testing.T) {
+	uh := uploadHeap{
+		repairingChunks:   make(map[uploadChunkID]*unfinishedUploadChunk),
+		stuckHeapChunks:   make(map[uploadChunkID]*unfinishedUploadChunk),
+		unstuckHeapChunks: make(map[uploadChunkID]*unfinishedUploadChunk),
+	}
+	var uid, otherUID siafile.SiafileUID = "file", "other"
+	chunk0 := uploadChunkID{fileUID: uid, index: 0}
+	chunk1 := uploadChunkID{fileUID: uid, index: 1}
+	chunk2 := uploadChunkID{fileUID: uid, index: 2}
+	otherChunk := uploadChunkID{fileUID: otherUID, index: 0}
+	uh.repairingChunks[chunk0] = &unfinishedUploadChunk{}
+	uh.repairingChunks[chunk1] = &unfinishedUploadChunk{}
+	uh.repairingChunks[otherChunk] = &unfinishedUploadChunk{}
+	uh.unstuckHeapChunks[chunk2] = &unfinishedUploadChunk{}
+
+	if uh.managedMarkRepairDoneLast(chunk0) {
+		t.Fatal("chunk 0 isn't the last chunk of the file")
+	}
+	if uh.managedMarkRepairDoneLast(chunk1) {
+		t.Fatal("chunk 1 isn't the last chunk of the file while chunk 2 is in the heap")
+	}
+	delete(uh.unstuckHeapChunks, chunk2)
+	uh.repairingChunks[chunk2] = &unfinishedUploadChunk{}
+	if !uh.managedMarkRepairDoneLast(chunk2) {
+		t.Fatal("chunk 2 is the last chunk of the file")
+	}
+	if !uh.managedMarkRepairDoneLast(otherChunk) {
+		t.Fatal("the chunk of the other file is its last chunk")
+	}
+}
@@ -0,0 +1,105 @@
+package renter
+
+// uploadprogress.go allows callers to observe the upload of a file without
+// polling its health. The registered callbacks are called by the upload code
+// whenever a chunk of the file finishes uploading.
+
+import (
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+)
+
+// OnUploadProgress registers a callback which is called with the number of
+// uploaded and the number of desired bytes of a file whenever one of its
+// chunks finishes uploading. Both values include redundancy and only pieces on
+// hosts which are online and good for renew count towards the uploaded bytes.
+// The callback is removed once the file reaches its target redundancy or its
+// upload is canceled or it is deleted. It is called from the upload code and
+// therefore shouldn't block.
+func (r *Renter) OnUploadProgress(siaPath modules.SiaPath, fn func(completed, total uint64)) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	uid := entry.UID()
+	r.uploadProgressCallbacksMu.Lock()
+	r.uploadProgressCallbacks[uid] = append(r.uploadProgressCallbacks[uid], fn)
+	r.uploadProgressCallbacksMu.Unlock()
+	return nil
+}
+
+// managedNotifyUploadProgress calls the upload progress callbacks registered
+// for a file and records the progress for the upload rate of the file.
+// Computing the progress requires going over all the chunks of the file. If no
+// callbacks are registered, the progress is only needed for the upload rate
+// and therefore computed at most once per uploadSampleInterval.
+func (r *Renter) managedNotifyUploadProgress(entry *filesystem.FileNode) {
+	uid := entry.UID()
+	r.uploadProgressCallbacksMu.Lock()
+	_, hasCallbacks := r.uploadProgressCallbacks[uid]
+	r.uploadProgressCallbacksMu.Unlock()
+	if !hasCallbacks && !entry.Deleted() && !r.managedUploadSampleDue(uid) {
+		return
+	}
+	offline, goodForRenew, _ := r.managedContractUtilityMaps()
+	r.managedReportUploadProgress(entry, offline, goodForRenew)
+}
+
+// managedReportUploadProgress computes the upload progress of a file using
+// the provided utility maps and reports it to the callbacks and the upload
+// rate of the file.
+func (r *Renter) managedReportUploadProgress(entry *filesystem.FileNode, offline, goodForRenew map[string]bool) {
+	uid := entry.UID()
+	// Remove the callbacks and the upload rate of deleted files.
+	if entry.Deleted() {
+		r.managedRemoveUploadProgress(uid)
+		return
+	}
+
+	// Get the number of uploaded bytes towards the target redundancy.
+	completed, total := uploadedBytes(entry, offline, goodForRenew)
+	r.managedAddUploadSample(uid, completed, total)
+
+	r.uploadProgressCallbacksMu.Lock()
+	callbacks, exists := r.uploadProgressCallbacks[uid]
+	// Remove the callbacks once the file is fully uploaded. They are called
+	// one last time.
+	if exists && completed >= total {
+		delete(r.uploadProgressCallbacks, uid)
+	}
+	r.uploadProgressCallbacksMu.Unlock()
+
+	// Call the callbacks without holding the lock.
+	for _, fn := range callbacks {
+		fn(completed, total)
+	}
+}
+
+// managedRemoveUploadProgress removes the upload progress callbacks and the
+// upload rate of a file whose upload won't make any more progress.
+func (r *Renter) managedRemoveUploadProgress(uid siafile.SiafileUID) {
+	r.uploadProgressCallbacksMu.Lock()
+	delete(r.uploadProgressCallbacks, uid)
+	r.uploadProgressCallbacksMu.Unlock()
+	r.managedRemoveUploadRate(uid)
+}
+
+// uploadedBytes returns the number of bytes of a file which count towards its
+// target redundancy and the number of bytes required for the file to reach
+// it. For every chunk, a piece counts only once and only if it is stored on a
+// host which is online and good for renew.
+func uploadedBytes(entry *filesystem.FileNode, offline, goodForRenew map[string]bool) (completed, total uint64) {
+	numChunks := entry.NumChunks()
+	for chunkIndex := uint64(0); chunkIndex < numChunks; chunkIndex++ {
+		numGoodPieces, _ := entry.GoodPieces(int(chunkIndex), offline, goodForRenew)
+		completed += numGoodPieces * modules.SectorSize
+	}
+	total = numChunks * modules.SectorSize * uint64(entry.ErasureCode().NumPieces())
+	return completed, total
+}
@@ -0,0 +1,144 @@
+package renter
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestUploadProgress tests that the upload progress callbacks are called with
+// the right values and removed once a file is fully uploaded, canceled or
+// deleted.
+func TestUploadProgress(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Registering a callback for a file that doesn't exist should fail.
+	if err := r.OnUploadProgress(modules.RandomSiaPath(), func(_, _ uint64) {}); err == nil {
+		t.Fatal("expected registering a callback for a missing file to fail")
+	}
+
+	// Create a file with a single chunk of 2 pieces.
+	rsc, _ := siafile.NewRSCode(1, 1)
+	siaPath := modules.RandomSiaPath()
+	err = r.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+
+	// Register a callback.
+	type progress struct{ completed, total uint64 }
+	var calls []progress
+	err = r.OnUploadProgress(siaPath, func(completed, total uint64) {
+		calls = append(calls, progress{completed, total})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload the pieces one by one. Only pieces on good hosts count and
+	// every piece counts only once.
+	total := 2 * modules.SectorSize
+	offline, goodForRenew := make(map[string]bool), make(map[string]bool)
+	for i := uint64(0); i < 2; i++ {
+		hpk := types.SiaPublicKey{Key: fastrand.Bytes(32)}
+		offline[hpk.String()] = false
+		goodForRenew[hpk.String()] = true
+		if err := sf.AddPiece(hpk, 0, i, crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+		// Upload the same piece to a bad host.
+		badHost := types.SiaPublicKey{Key: fastrand.Bytes(32)}
+		offline[badHost.String()] = false
+		goodForRenew[badHost.String()] = false
+		if err := sf.AddPiece(badHost, 0, i, crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+		// Upload the other piece to a bad host.
+		if err := sf.AddPiece(badHost, 0, 1-i, crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+		r.managedReportUploadProgress(sf, offline, goodForRenew)
+		if len(calls) != int(i+1) {
+			t.Fatalf("expected %v calls but got %v", i+1, len(calls))
+		}
+		if p := calls[i]; p.completed != (i+1)*modules.SectorSize || p.total != total {
+			t.Fatal("wrong progress", p)
+		}
+	}
+
+	// The file is fully uploaded. The callback shouldn't be called anymore.
+	r.managedReportUploadProgress(sf, offline, goodForRenew)
+	if len(calls) != 2 {
+		t.Fatal("callback was called after the file was fully uploaded")
+	}
+
+	// Canceling the upload of a file should remove its callbacks.
+	siaPath3 := modules.RandomSiaPath()
+	err = r.staticFileSystem.NewSiaFile(siaPath3, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.OnUploadProgress(siaPath3, func(completed, total uint64) {
+		t.Error("callback of canceled upload was called")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CancelUpload(siaPath3, false); err != nil {
+		t.Fatal(err)
+	}
+	r.uploadProgressCallbacksMu.Lock()
+	numCallbacks := len(r.uploadProgressCallbacks)
+	r.uploadProgressCallbacksMu.Unlock()
+	if numCallbacks != 0 {
+		t.Fatal("expected all callbacks to be removed but got", numCallbacks)
+	}
+
+	// Create another file and delete it after registering a callback.
+	siaPath2 := modules.RandomSiaPath()
+	err = r.staticFileSystem.NewSiaFile(siaPath2, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf2, err := r.staticFileSystem.OpenSiaFile(siaPath2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf2.Close()
+	err = r.OnUploadProgress(siaPath2, func(completed, total uint64) {
+		t.Error("callback of deleted file was called")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteFile(siaPath2); err != nil {
+		t.Fatal(err)
+	}
+	r.uploadProgressCallbacksMu.Lock()
+	numCallbacks = len(r.uploadProgressCallbacks)
+	r.uploadProgressCallbacksMu.Unlock()
+	if numCallbacks != 0 {
+		t.Fatal("expected all callbacks to be removed but got", numCallbacks)
+	}
+}
@@ -0,0 +1,122 @@
+package renter
+
+// uploadretry.go implements the retry policy for failed piece uploads. By
+// default a piece which failed to upload to a host is handed to a different
+// host right away. The retry policy allows for retrying the piece on the same
+// host first, which is useful if failures are mostly transient, and for giving
+// up on a chunk after too many hosts failed to store its pieces, which makes
+// sure persistently failing chunks are marked as stuck instead of cycling
+// through all the renter's hosts.
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+// errInvalidUploadRetryPolicy is returned by SetUploadRetryPolicy if one of
+// the fields of the policy is negative.
+var errInvalidUploadRetryPolicy = errors.New("upload retry policy can't contain negative values")
+
+// SetUploadRetryPolicy sets the policy used to retry failed piece uploads. The
+// policy applies to chunks which are added to the upload heap afterwards.
+func (r *Renter) SetUploadRetryPolicy(policy modules.UploadRetryPolicy) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if policy.MaxAttemptsPerHost < 0 || policy.Backoff < 0 || policy.MaxHostReselections < 0 {
+		return errInvalidUploadRetryPolicy
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.UploadRetryPolicy = policy
+	return r.saveSync()
+}
+
+// UploadRetryPolicy returns the policy used to retry failed piece uploads.
+func (r *Renter) UploadRetryPolicy() modules.UploadRetryPolicy {
+	if err := r.tg.Add(); err != nil {
+		return modules.UploadRetryPolicy{}
+	}
+	defer r.tg.Done()
+	return r.managedUploadRetryPolicy()
+}
+
+// managedUploadRetryPolicy returns the policy used to retry failed piece
+// uploads.
+func (r *Renter) managedUploadRetryPolicy() modules.UploadRetryPolicy {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	return r.persist.UploadRetryPolicy
+}
+
+// managedUploadPiece uploads a piece of the chunk to the worker's host. Failed
+// uploads are retried on the same host according to the chunk's retry policy.
+// The backoff between attempts doubles with every attempt but never exceeds
+// maxUploadRetryBackoff.
+func (w *worker) managedUploadPiece(uc *unfinishedUploadChunk, pieceIndex uint64) (crypto.Hash, error) {
+	policy := uc.staticRetryPolicy
+	backoff := policy.Backoff
+	if backoff > maxUploadRetryBackoff {
+		backoff = maxUploadRetryBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		root, err := w.managedTryUploadPiece(uc, pieceIndex)
+		// Don't retry if the renter is offline since it's not the host's
+		// fault.
+		if err == nil || attempt >= policy.MaxAttemptsPerHost || !w.renter.g.Online() {
+			return root, err
+		}
+		w.renter.log.Debugf("Retrying upload of piece %v of chunk %v to %v after %v: %v", pieceIndex, uc.id, w.staticHostPubKey, backoff, err)
+		uc.mu.Lock()
+		uc.uploadRetries++
+		uc.mu.Unlock()
+		select {
+		case <-time.After(backoff):
+		case <-w.renter.tg.StopChan():
+			return crypto.Hash{}, errors.Compose(err, errors.New("renter shut down before the upload was retried"))
+		}
+		backoff *= 2
+		if backoff > maxUploadRetryBackoff {
+			backoff = maxUploadRetryBackoff
+		}
+	}
+}
+
+// managedTryUploadPiece performs a single attempt at uploading a piece of the
+// chunk to the worker's host.
+func (w *worker) managedTryUploadPiece(uc *unfinishedUploadChunk, pieceIndex uint64) (crypto.Hash, error) {
+	// Open an editing connection to the host.
+	e, err := w.renter.hostContractor.Editor(w.staticHostPubKey, w.renter.tg.StopChan())
+	if err != nil {
+		return crypto.Hash{}, fmt.Errorf("Worker failed to acquire an editor: %v", err)
+	}
+	defer e.Close()
+
+	// Before performing the upload, check for price gouging.
+	allowance := w.renter.hostContractor.Allowance()
+	hostSettings := e.HostSettings()
+	err = checkUploadGouging(allowance, hostSettings)
+	if err != nil {
+		return crypto.Hash{}, errors.AddContext(err, "worker uploader is not being used because price gouging was detected")
+	}
+
+	// Perform the upload, and update the failure stats based on the success of
+	// the upload attempt.
+	start := time.Now()
+	root, err := e.Upload(uc.physicalChunkData[pieceIndex])
+	if err != nil {
+		return crypto.Hash{}, fmt.Errorf("Worker failed to upload via the editor: %v", err)
+	}
+	w.mu.Lock()
+	w.uploadConsecutiveFailures = 0
+	w.uploadRecentLatency = time.Since(start)
+	w.recordUploadThroughput(uint64(len(uc.physicalChunkData[pieceIndex])), w.uploadRecentLatency, time.Now())
+	w.mu.Unlock()
+	return root, nil
+}
@@ -0,0 +1,127 @@
+package renter
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestUploadRetryPolicy tests setting and persisting the upload retry policy.
+func TestUploadRetryPolicy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Negative values are invalid.
+	invalid := []modules.UploadRetryPolicy{
+		{MaxAttemptsPerHost: -1},
+		{Backoff: -time.Second},
+		{MaxHostReselections: -1},
+	}
+	for _, policy := range invalid {
+		if err := rt.renter.SetUploadRetryPolicy(policy); err != errInvalidUploadRetryPolicy {
+			t.Fatalf("%v: expected errInvalidUploadRetryPolicy but got %v", policy, err)
+		}
+	}
+
+	// Set a valid policy and make sure it persists.
+	policy := modules.UploadRetryPolicy{
+		MaxAttemptsPerHost:  3,
+		Backoff:             time.Second,
+		MaxHostReselections: 5,
+	}
+	if err := rt.renter.SetUploadRetryPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rt.renter, err = newRenterWithDependency(rt.gateway, rt.cs, rt.wallet, rt.tpool, filepath.Join(rt.dir, modules.RenterDir), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := rt.renter.UploadRetryPolicy(); p != policy {
+		t.Fatal("policy wasn't persisted", p)
+	}
+}
+
+// TestUploadPieceRetries tests that failed piece uploads are retried on the
+// same host and that a chunk stops handing failed pieces to other hosts once
+// it runs out of host reselections.
+func TestUploadPieceRetries(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// The renter doesn't have any contracts, so every upload fails.
+	w := &worker{
+		renter:           rt.renter,
+		staticHostPubKey: types.SiaPublicKey{Key: []byte("host")},
+	}
+	uc := &unfinishedUploadChunk{
+		physicalChunkData: make([][]byte, 2),
+		pieceUsage:        []bool{true, true},
+		piecesNeeded:      2,
+		piecesRegistered:  2,
+		unusedHosts:       map[string]struct{}{"other": {}},
+		workersRemaining:  5,
+		staticRetryPolicy: modules.UploadRetryPolicy{
+			MaxAttemptsPerHost:  3,
+			Backoff:             10 * time.Millisecond,
+			MaxHostReselections: 1,
+		},
+	}
+
+	// The upload should be attempted 3 times on the same host with a backoff
+	// of 10ms and 20ms in between.
+	start := time.Now()
+	if _, err := w.managedUploadPiece(uc, 0); err == nil {
+		t.Fatal("upload without contract should fail")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatal("retries didn't back off", elapsed)
+	}
+	if uc.uploadRetries != 2 {
+		t.Fatal("wrong number of retries", uc.uploadRetries)
+	}
+
+	// The first failure hands the piece to a different host.
+	w.managedUploadFailed(uc, 0, errInvalidUploadRetryPolicy)
+	if uc.uploadRetries != 3 || len(uc.unusedHosts) != 1 || uc.pieceUsage[0] {
+		t.Fatal("piece wasn't handed to a different host", uc.uploadRetries, uc.unusedHosts, uc.pieceUsage)
+	}
+
+	// The second failure exceeds the reselections.
+	w.managedUploadFailed(uc, 1, errInvalidUploadRetryPolicy)
+	if uc.uploadRetries != 3 || len(uc.unusedHosts) != 0 {
+		t.Fatal("chunk should have run out of reselections", uc.uploadRetries, uc.unusedHosts)
+	}
+
+	// The backoff is capped.
+	uc.staticRetryPolicy.Backoff = time.Hour
+	start = time.Now()
+	if _, err := w.managedUploadPiece(uc, 0); err == nil {
+		t.Fatal("upload without contract should fail")
+	}
+	if elapsed := time.Since(start); elapsed < 2*maxUploadRetryBackoff || elapsed > time.Minute {
+		t.Fatal("backoff wasn't capped", elapsed)
+	}
+}
@@ -8,10 +8,8 @@ import (
 	"gitlab.com/NebulousLabs/errors"
 
 	"gitlab.com/NebulousLabs/Sia/build"
-	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
-	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
@@ -87,9 +85,23 @@ func (r *Renter) UploadStreamFromReader(up modules.FileUploadParams, reader io.R
 		return err
 	}
 	defer r.tg.Done()
+	if err := checkTrashPath(up.SiaPath); err != nil {
+		return err
+	}
 	return r.managedUploadStreamFromReader(up, reader, false)
 }
 
+// UploadStream uploads the data read from reader to siaPath without staging
+// it on disk first. The SiaFile is grown chunk by chunk as data arrives, so the
+// total size doesn't need to be known upfront. If ec is nil, the renter's
+// default erasure code is used.
+func (r *Renter) UploadStream(siaPath modules.SiaPath, reader io.Reader, ec modules.ErasureCoder) error {
+	return r.UploadStreamFromReader(modules.FileUploadParams{
+		SiaPath:     siaPath,
+		ErasureCode: ec,
+	}, reader)
+}
+
 // managedInitUploadStream verifies the upload parameters and prepares an empty
 // SiaFile for the upload.
 func (r *Renter) managedInitUploadStream(up modules.FileUploadParams, backup bool) (*filesystem.FileNode, error) {
@@ -97,7 +109,7 @@ func (r *Renter) managedInitUploadStream(up modules.FileUploadParams, backup boo
 	// Check if ec was set. If not use defaults.
 	var err error
 	if ec == nil && !repair {
-		up.ErasureCode, err = siafile.NewRSSubCode(DefaultDataPieces, DefaultParityPieces, 64)
+		up.ErasureCode, err = r.managedDefaultErasureCode(up.SiaPath)
 		if err != nil {
 			return nil, err
 		}
@@ -105,18 +117,27 @@ func (r *Renter) managedInitUploadStream(up modules.FileUploadParams, backup boo
 	} else if ec != nil && repair {
 		return nil, errors.New("can't provide erasure code settings when doing repairs")
 	}
+	if !repair {
+		if err := validateErasureCoder(ec); err != nil {
+			return nil, err
+		}
+	}
+	if up.Compression != modules.CompressionNone {
+		return nil, errCompressedStream
+	}
+	if up.CipherKey != nil && repair {
+		return nil, errors.New("can't provide a cipher key when doing repairs")
+	}
+	sk, err := uploadCipherKey(up.CipherKey)
+	if err != nil {
+		return nil, err
+	}
 
 	// Make sure that force and repair aren't both set.
 	if force && repair {
 		return nil, errors.New("'force' and 'repair' can't both be set")
 	}
 
-	// Delete existing file if overwrite flag is set. Ignore ErrUnknownPath.
-	if force {
-		if err := r.DeleteFile(siaPath); err != nil && err != filesystem.ErrNotExist {
-			return nil, err
-		}
-	}
 	// If repair is set open the existing file.
 	if repair {
 		entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
@@ -125,22 +146,46 @@ func (r *Renter) managedInitUploadStream(up modules.FileUploadParams, backup boo
 		}
 		return entry, nil
 	}
-	// Check that we have contracts to upload to. We need at least data +
-	// parity/2 contracts. NumPieces is equal to data+parity, and min pieces is
-	// equal to parity. Therefore (NumPieces+MinPieces)/2 = (data+data+parity)/2
-	// = data+parity/2.
-	numContracts := len(r.hostContractor.Contracts())
-	requiredContracts := (ec.NumPieces() + ec.MinPieces()) / 2
-	if numContracts < requiredContracts && build.Release != "testing" {
-		return nil, fmt.Errorf("not enough contracts to upload file: got %v, needed %v", numContracts, (ec.NumPieces()+ec.MinPieces())/2)
+	// Check the limits of the siapath.
+	if err := validateSiaPathLimits(siaPath, r.staticFileSystem.FilePath(siaPath)); err != nil {
+		return nil, err
+	}
+	// Check that we have contracts to upload to.
+	if build.Release != "testing" {
+		if err := r.managedCheckUploadContracts(siaPath, ec, up.AllowLowRedundancy); err != nil {
+			return nil, err
+		}
+	}
+	// Delete existing file if overwrite flag is set. Ignore ErrUnknownPath.
+	// This happens after all the checks to not delete the file for an upload
+	// which is rejected anyway.
+	if force {
+		if err := r.DeleteFile(siaPath); err != nil && err != filesystem.ErrNotExist {
+			return nil, err
+		}
 	}
 	// Create the Siafile and add to renter
-	sk := crypto.GenerateSiaKey(crypto.TypeDefaultRenter)
 	err = r.staticFileSystem.NewSiaFile(siaPath, up.Source, up.ErasureCode, sk, 0, defaultFilePerm, up.DisablePartialChunk)
 	if err != nil {
 		return nil, err
 	}
-	return r.staticFileSystem.OpenSiaFile(siaPath)
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(up.PreferredHosts) > 0 {
+		if err := entry.SetPreferredHosts(up.PreferredHosts); err != nil {
+			err = errors.AddContext(err, "could not set the preferred hosts")
+			return nil, errors.Compose(err, r.managedRemoveFailedUpload(siaPath, entry))
+		}
+	}
+	if up.ReadOnly {
+		if err := entry.SetReadOnly(true); err != nil {
+			err = errors.AddContext(err, "could not set the read-only status")
+			return nil, errors.Compose(err, r.managedRemoveFailedUpload(siaPath, entry))
+		}
+	}
+	return entry, nil
 }
 
 // managedUploadStreamFromReader reads from the provided reader until io.EOF is
@@ -194,7 +239,7 @@ func (r *Renter) managedUploadStreamFromReader(up modules.FileUploadParams, read
 
 		// Start the chunk upload.
 		offline, goodForRenew, _ := r.managedContractUtilityMaps()
-		uuc, err := r.managedBuildUnfinishedChunk(entry, chunkIndex, hosts, pks, true, offline, goodForRenew)
+		uuc, err := r.managedBuildUnfinishedChunk(entry, chunkIndex, hosts, pks, true, offline, goodForRenew, nil, nil)
 		if err != nil {
 			return errors.AddContext(err, "unable to fetch chunk for stream")
 		}
@@ -235,6 +280,8 @@ func (r *Renter) managedUploadStreamFromReader(up modules.FileUploadParams, read
 			return errors.New("interrupted by shutdown")
 		case <-ss.signalChan:
 		}
+		// Record the progress of the stream for its upload rate.
+		r.managedNotifyUploadProgress(entry)
 
 		// If an io.EOF error occurred or less than chunkSize was read, we are
 		// done. Otherwise we report the error.
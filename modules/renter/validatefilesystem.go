@@ -0,0 +1,208 @@
+package renter
+
+// validatefilesystem.go implements a consistency check of the renter's
+// filesystem. It detects directories without valid siadir metadata, siafiles
+// which aren't connected to the root by a chain of valid metadata, siafiles
+// which track a local file that no longer exists and directories whose
+// aggregate size doesn't match their content. This helps to recover from
+// partial disk corruption.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siadir"
+)
+
+// RepairFilesystem validates the filesystem like ValidateFilesystem and
+// repairs the inconsistencies it can. Missing siadir metadata is created,
+// dangling local paths of siafiles are dropped and directories with a size
+// mismatch are bubbled. Unreadable metadata is only reported.
+func (r *Renter) RepairFilesystem() ([]modules.Inconsistency, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	var inconsistencies []modules.Inconsistency
+	_, err := r.managedValidateDir(modules.RootSiaPath(), true, true, true, &inconsistencies)
+	return inconsistencies, err
+}
+
+// ValidateFilesystem walks the renter's filesystem and returns the
+// inconsistencies it finds.
+func (r *Renter) ValidateFilesystem() ([]modules.Inconsistency, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	var inconsistencies []modules.Inconsistency
+	_, err := r.managedValidateDir(modules.RootSiaPath(), true, true, false, &inconsistencies)
+	return inconsistencies, err
+}
+
+// managedValidateDir validates a directory and its subtree and returns the
+// total size of the siafiles within it. validChain and repairedChain indicate
+// whether all the parents of the directory had valid metadata before and after
+// repairing them.
+func (r *Renter) managedValidateDir(siaPath modules.SiaPath, validChain, repairedChain, repair bool, inconsistencies *[]modules.Inconsistency) (uint64, error) {
+	select {
+	case <-r.tg.StopChan():
+		return 0, errors.New("renter shut down before the filesystem validation finished")
+	default:
+	}
+	root := r.staticFileSystem.Root()
+
+	// Check the metadata of the directory.
+	md, validMetadata, repairedMetadata, err := r.managedValidateDirMetadata(siaPath, repair, inconsistencies)
+	if err != nil {
+		return 0, err
+	}
+	validChain = validChain && validMetadata
+	repairedChain = repairedChain && repairedMetadata
+
+	// Validate the content of the directory.
+	fis, err := ioutil.ReadDir(siaPath.SiaDirSysPath(root))
+	if err != nil {
+		return 0, errors.AddContext(err, fmt.Sprintf("failed to read directory %v", siaPath))
+	}
+	var size uint64
+	for _, fi := range fis {
+		ext := filepath.Ext(fi.Name())
+		if !fi.IsDir() && ext != modules.SiaFileExtension {
+			continue
+		}
+		childSiaPath, err := siaPath.Join(strings.TrimSuffix(fi.Name(), modules.SiaFileExtension))
+		if err != nil {
+			return 0, err
+		}
+		if fi.IsDir() {
+			childSize, err := r.managedValidateDir(childSiaPath, validChain, repairedChain, repair, inconsistencies)
+			if err != nil {
+				return 0, err
+			}
+			size += childSize
+			continue
+		}
+		if !validChain {
+			*inconsistencies = append(*inconsistencies, modules.Inconsistency{
+				SiaPath:     childSiaPath,
+				Type:        modules.InconsistencyOrphanedFile,
+				Description: "a parent directory of the file has no valid metadata",
+				Repaired:    repairedChain,
+			})
+		}
+		sf, err := r.staticFileSystem.OpenSiaFile(childSiaPath)
+		if err != nil {
+			r.log.Printf("WARN: failed to open %v during filesystem validation: %v", childSiaPath, err)
+			continue
+		}
+		size += sf.Size()
+		r.managedValidateLocalPath(sf, childSiaPath, repair, inconsistencies)
+		sf.Close()
+	}
+
+	// Check the aggregate size of the directory.
+	if repairedMetadata && md.AggregateSize != size {
+		*inconsistencies = append(*inconsistencies, modules.Inconsistency{
+			SiaPath:     siaPath,
+			Type:        modules.InconsistencySizeMismatch,
+			Description: fmt.Sprintf("aggregate size %v doesn't match the size %v of the files within the directory", md.AggregateSize, size),
+			Repaired:    repair,
+		})
+		if repair {
+			go r.callThreadedBubbleMetadata(siaPath)
+		}
+	}
+	return size, nil
+}
+
+// managedValidateLocalPath checks that the local file tracked by a siafile
+// still exists. If it doesn't, the siafile can't be repaired from disk and the
+// local path is dropped when repairing. The file might only be temporarily
+// unavailable, so the repair description tells the user how to restore it.
+func (r *Renter) managedValidateLocalPath(sf *filesystem.FileNode, siaPath modules.SiaPath, repair bool, inconsistencies *[]modules.Inconsistency) {
+	localPath := sf.LocalPath()
+	if localPath == "" {
+		return
+	}
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		return
+	}
+	inconsistency := modules.Inconsistency{
+		SiaPath:     siaPath,
+		Type:        modules.InconsistencyMissingTrackedFile,
+		Description: fmt.Sprintf("the tracked local file %v doesn't exist", localPath),
+	}
+	if repair {
+		err := sf.SetLocalPath("")
+		if err != nil {
+			r.log.Printf("WARN: failed to drop the local path of %v: %v", siaPath, err)
+		}
+		inconsistency.Repaired = err == nil
+		if inconsistency.Repaired {
+			inconsistency.Description += "; the local path was dropped, use SetFileTrackingPath to restore it if the file is only temporarily unavailable, e.g. on an unmounted drive"
+		}
+	}
+	*inconsistencies = append(*inconsistencies, inconsistency)
+}
+
+// managedValidateDirMetadata checks that the metadata of a directory exists
+// and can be loaded. It returns the metadata and whether it was valid before
+// and after a potential repair.
+func (r *Renter) managedValidateDirMetadata(siaPath modules.SiaPath, repair bool, inconsistencies *[]modules.Inconsistency) (md siadir.Metadata, valid, repaired bool, err error) {
+	_, err = os.Stat(siaPath.SiaDirMetadataSysPath(r.staticFileSystem.Root()))
+	if err != nil && !os.IsNotExist(err) {
+		return siadir.Metadata{}, false, false, errors.AddContext(err, fmt.Sprintf("failed to stat metadata of %v", siaPath))
+	}
+	valid = err == nil
+	if !valid {
+		inconsistency := modules.Inconsistency{
+			SiaPath:     siaPath,
+			Type:        modules.InconsistencyMissingDirMetadata,
+			Description: "the directory has no siadir metadata",
+		}
+		if repair {
+			err = r.staticFileSystem.NewSiaDir(siaPath, modules.DefaultDirPerm)
+			if err != nil {
+				r.log.Printf("WARN: failed to create missing metadata of %v: %v", siaPath, err)
+			}
+			inconsistency.Repaired = err == nil
+		if inconsistency.Repaired {
+			inconsistency.Description += "; the local path was dropped, use SetFileTrackingPath to restore it if the file is only temporarily unavailable, e.g. on an unmounted drive"
+		}
+		}
+		*inconsistencies = append(*inconsistencies, inconsistency)
+		if !inconsistency.Repaired {
+			return siadir.Metadata{}, false, false, nil
+		}
+	}
+
+	// Load the metadata.
+	md, err = r.managedLoadDirMetadata(siaPath)
+	if err != nil {
+		*inconsistencies = append(*inconsistencies, modules.Inconsistency{
+			SiaPath:     siaPath,
+			Type:        modules.InconsistencyUnreadableDirMetadata,
+			Description: err.Error(),
+		})
+		return siadir.Metadata{}, false, false, nil
+	}
+	return md, valid, true, nil
+}
+
+// managedLoadDirMetadata loads the metadata of a directory.
+func (r *Renter) managedLoadDirMetadata(siaPath modules.SiaPath) (siadir.Metadata, error) {
+	dir, err := r.staticFileSystem.OpenSiaDir(siaPath)
+	if err != nil {
+		return siadir.Metadata{}, err
+	}
+	defer dir.Close()
+	return dir.Metadata()
+}
@@ -0,0 +1,195 @@
+package renter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+)
+
+// TestValidateFilesystem tests that ValidateFilesystem detects missing siadir
+// metadata and orphaned files and that RepairFilesystem fixes them.
+func TestValidateFilesystem(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file in a nested directory.
+	dirSiaPath, err := modules.NewSiaPath("a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileSiaPath, err := dirSiaPath.Join("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = r.staticFileSystem.NewSiaFile(fileSiaPath, "", rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bubble the tree. Afterwards the filesystem should be consistent.
+	if err := r.managedBubbleMetadata(context.Background(), dirSiaPath); err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		inconsistencies, err := r.ValidateFilesystem()
+		if err != nil {
+			return err
+		}
+		if len(inconsistencies) != 0 {
+			return fmt.Errorf("expected no inconsistencies but got %v", inconsistencies)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the metadata of the parent directory.
+	parentSiaPath, err := dirSiaPath.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(parentSiaPath.SiaDirMetadataSysPath(r.staticFileSystem.Root())); err != nil {
+		t.Fatal(err)
+	}
+
+	// Validate the filesystem. The missing metadata and the orphaned file
+	// should be reported.
+	inconsistencies, err := r.ValidateFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inconsistencies) != 2 {
+		t.Fatal("expected 2 inconsistencies but got", inconsistencies)
+	}
+	missing, orphaned := inconsistencies[0], inconsistencies[1]
+	if missing.Type != modules.InconsistencyMissingDirMetadata || !missing.SiaPath.Equals(parentSiaPath) || missing.Repaired {
+		t.Fatal("wrong inconsistency", missing)
+	}
+	if orphaned.Type != modules.InconsistencyOrphanedFile || !orphaned.SiaPath.Equals(fileSiaPath) || orphaned.Repaired {
+		t.Fatal("wrong inconsistency", orphaned)
+	}
+
+	// Repair the filesystem. The same inconsistencies should be reported as
+	// repaired together with the size mismatch of the recreated metadata.
+	inconsistencies, err = r.RepairFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inconsistencies) != 3 {
+		t.Fatal("expected 3 inconsistencies but got", inconsistencies)
+	}
+	for _, inconsistency := range inconsistencies {
+		if !inconsistency.Repaired {
+			t.Fatal("inconsistency wasn't repaired", inconsistency)
+		}
+	}
+	if mismatch := inconsistencies[2]; mismatch.Type != modules.InconsistencySizeMismatch || !mismatch.SiaPath.Equals(parentSiaPath) {
+		t.Fatal("wrong inconsistency", mismatch)
+	}
+
+	// Once the bubble finished the filesystem should be consistent again.
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		inconsistencies, err := r.ValidateFilesystem()
+		if err != nil {
+			return err
+		}
+		if len(inconsistencies) != 0 {
+			return fmt.Errorf("expected no inconsistencies but got %v", inconsistencies)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestValidateFilesystemTrackedFile tests that ValidateFilesystem detects
+// siafiles whose tracked local file doesn't exist anymore and that
+// RepairFilesystem drops their local path.
+func TestValidateFilesystemTrackedFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Create a file which tracks a local file that doesn't exist.
+	siaPath := modules.RandomSiaPath()
+	localPath := filepath.Join(rt.dir, "missing")
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = r.staticFileSystem.NewSiaFile(siaPath, localPath, rsc, crypto.GenerateSiaKey(crypto.RandomCipherType()), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.managedBubbleMetadata(context.Background(), modules.RootSiaPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	// checkInconsistency checks that the missing tracked file is the only
+	// inconsistency reported.
+	checkInconsistency := func(inconsistencies []modules.Inconsistency, repaired bool) {
+		t.Helper()
+		if len(inconsistencies) != 1 {
+			t.Fatal("expected 1 inconsistency but got", inconsistencies)
+		}
+		i := inconsistencies[0]
+		if i.Type != modules.InconsistencyMissingTrackedFile || !i.SiaPath.Equals(siaPath) || i.Repaired != repaired {
+			t.Fatal("wrong inconsistency", i)
+		}
+	}
+	inconsistencies, err := r.ValidateFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInconsistency(inconsistencies, false)
+
+	// Repair the filesystem. The local path should be dropped.
+	inconsistencies, err = r.RepairFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInconsistency(inconsistencies, true)
+	if !strings.Contains(inconsistencies[0].Description, "SetFileTrackingPath") {
+		t.Fatal("repair description doesn't explain how to restore the local path", inconsistencies[0].Description)
+	}
+	fi, err := r.File(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.LocalPath != "" {
+		t.Fatal("local path wasn't dropped", fi.LocalPath)
+	}
+	inconsistencies, err = r.ValidateFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inconsistencies) != 0 {
+		t.Fatal("expected no inconsistencies but got", inconsistencies)
+	}
+}
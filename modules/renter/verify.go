@@ -0,0 +1,198 @@
+package renter
+
+// verify.go implements the optional verification of files after a repair.
+// Whenever the last chunk of a file in the upload heap reaches full redundancy,
+// the renter picks the file for verification with the probability set by
+// SetVerificationSampleRate. A random
+// chunk of the file is then downloaded from the hosts, erasure coded and
+// encrypted again and the Merkle roots of the resulting pieces are compared to
+// the roots stored in the siafile. This catches hosts which pass the health
+// checks but return garbage. The result is recorded in the LastVerifiedTime and
+// VerificationFailed fields of the siafile.
+
+import (
+	"bytes"
+	"fmt"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+)
+
+var (
+	// ErrInvalidVerificationSampleRate is returned by
+	// SetVerificationSampleRate if the rate is not between 0 and 1.
+	ErrInvalidVerificationSampleRate = errors.New("verification sample rate must be between 0 and 1")
+
+	// errVerificationMismatch is returned if the Merkle root of a verified
+	// piece doesn't match the root stored in the siafile.
+	errVerificationMismatch = errors.New("merkle root of verified piece doesn't match")
+)
+
+// SetVerificationSampleRate sets the probability with which a file is verified
+// after it was repaired. A rate of 0 disables the verification.
+func (r *Renter) SetVerificationSampleRate(rate float64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if rate < 0 || rate > 1 {
+		return ErrInvalidVerificationSampleRate
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.VerificationSampleRate = rate
+	return r.saveSync()
+}
+
+// managedVerificationSampleRate returns the probability with which a file is
+// verified after it was repaired.
+func (r *Renter) managedVerificationSampleRate() float64 {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	return r.persist.VerificationSampleRate
+}
+
+// managedMaybeVerifyFile starts a verification of the file with the
+// probability returned by managedVerificationSampleRate.
+func (r *Renter) managedMaybeVerifyFile(entry *filesystem.FileNode) {
+	rate := r.managedVerificationSampleRate()
+	if rate == 0 || float64(fastrand.Intn(1e6)) >= rate*1e6 {
+		return
+	}
+	go r.threadedVerifyFile(entry.Copy())
+}
+
+// threadedVerifyFile verifies a random chunk of the file and records the
+// result in the siafile. The entry is closed when the verification is done.
+func (r *Renter) threadedVerifyFile(entry *filesystem.FileNode) {
+	defer entry.Close()
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	numChunks := verifiableChunks(entry)
+	if numChunks == 0 {
+		return
+	}
+	siaPath := r.staticFileSystem.FileSiaPath(entry)
+	chunkIndex := fastrand.Uint64n(numChunks)
+	err := r.managedVerifyChunk(entry, siaPath, chunkIndex)
+
+	// Don't record verifications which were interrupted by a shutdown.
+	select {
+	case <-r.tg.StopChan():
+		return
+	default:
+	}
+	// Only a mismatch of the Merkle roots means that the verification
+	// failed. Other errors, e.g. a failed download, don't say anything about
+	// the data stored by the hosts.
+	if err != nil && !errors.Contains(err, errVerificationMismatch) {
+		r.repairLog.Printf("Verification of chunk %v of %s couldn't be completed: %v", chunkIndex, siaPath, err)
+		return
+	}
+	if err != nil {
+		r.repairLog.Printf("Verification of chunk %v of %s failed: %v", chunkIndex, siaPath, err)
+	}
+	if err := entry.SetVerificationResult(err != nil); err != nil {
+		r.log.Printf("WARN: failed to record verification result of %v: %v", siaPath, err)
+	}
+}
+
+// verifiableChunks returns the number of chunks of the file which can be
+// verified. A partial chunk at the end of the file is stored in a combined
+// chunk and can't be verified on its own.
+func verifiableChunks(entry *filesystem.FileNode) uint64 {
+	numChunks := entry.NumChunks()
+	if entry.HasPartialChunk() && numChunks > 0 {
+		numChunks--
+	}
+	return numChunks
+}
+
+// managedVerifyChunk downloads the chunk with the given index from the hosts
+// and verifies its pieces using verifyChunkRoots.
+func (r *Renter) managedVerifyChunk(entry *filesystem.FileNode, siaPath modules.SiaPath, chunkIndex uint64) error {
+	offset := chunkIndex * entry.ChunkSize()
+	length := entry.ChunkSize()
+	if offset+length > entry.Size() {
+		length = entry.Size() - offset
+	}
+	snap, err := entry.Snapshot(siaPath)
+	if err != nil {
+		return errors.AddContext(err, "failed to create snapshot")
+	}
+	// Download the chunk without falling back to the local copy of the file.
+	var buf bytes.Buffer
+	d, err := r.managedNewDownload(downloadParams{
+		destination:       newDownloadDestinationWriter(&buf),
+		destinationType:   "verification buffer",
+		disableLocalFetch: true,
+		file:              snap,
+
+		latencyTarget: 200e3, // No need to rush latency on verification downloads.
+		length:        length,
+		needsMemory:   true,
+		offset:        offset,
+		overdrive:     0, // No need to rush the latency on verification downloads.
+		priority:      0, // Verification downloads are completely de-prioritized.
+	})
+	if err != nil {
+		return errors.AddContext(err, "failed to create download")
+	}
+	if err := d.Start(); err != nil {
+		return errors.AddContext(err, "failed to start download")
+	}
+	select {
+	case <-d.completeChan:
+	case <-r.tg.StopChan():
+		return errors.New("verification download interrupted by stop call")
+	}
+	if d.Err() != nil {
+		return errors.AddContext(d.Err(), "failed to download chunk")
+	}
+	return verifyChunkRoots(entry, chunkIndex, buf.Bytes())
+}
+
+// verifyChunkRoots erasure codes and encrypts the logical data of a chunk the
+// same way it was uploaded and compares the Merkle roots of the resulting
+// pieces to the roots stored in the siafile. Ciphers with an overhead pad the
+// pieces with random data which makes it impossible to recompute the roots,
+// so the pieces of files using them are not compared.
+func verifyChunkRoots(entry *filesystem.FileNode, chunkIndex uint64, data []byte) error {
+	key := entry.MasterKey()
+	if key.Type().Overhead() != 0 {
+		return nil
+	}
+	ec := entry.ErasureCode()
+	dataPieces, _, err := readDataPieces(bytes.NewReader(data), ec, entry.PieceSize())
+	if err != nil {
+		return err
+	}
+	shards, err := ec.EncodeShards(dataPieces)
+	if err != nil {
+		return errors.AddContext(err, "failed to encode chunk")
+	}
+	pieces, err := entry.Pieces(chunkIndex)
+	if err != nil {
+		return errors.AddContext(err, "failed to get pieces of chunk")
+	}
+	for pieceIndex, shard := range shards {
+		if pieceIndex >= len(pieces) || len(pieces[pieceIndex]) == 0 {
+			continue
+		}
+		encrypted := key.Derive(chunkIndex, uint64(pieceIndex)).EncryptBytes(shard)
+		root := crypto.MerkleRoot(encrypted)
+		for _, piece := range pieces[pieceIndex] {
+			if piece.MerkleRoot != root {
+				return errors.AddContext(errVerificationMismatch, fmt.Sprintf("piece %v stored on host %v", pieceIndex, piece.HostPubKey))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestSetVerificationSampleRate tests setting the verification sample rate.
+func TestSetVerificationSampleRate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Rates outside of [0, 1] are invalid.
+	for _, rate := range []float64{-0.1, 1.1} {
+		if err := rt.renter.SetVerificationSampleRate(rate); !errors.Contains(err, ErrInvalidVerificationSampleRate) {
+			t.Fatalf("expected %v for rate %v but got %v", ErrInvalidVerificationSampleRate, rate, err)
+		}
+	}
+	if err := rt.renter.SetVerificationSampleRate(0.5); err != nil {
+		t.Fatal(err)
+	}
+	if rate := rt.renter.managedVerificationSampleRate(); rate != 0.5 {
+		t.Fatal("wrong sample rate", rate)
+	}
+}
+
+// TestVerifyChunkRoots tests that verifyChunkRoots detects chunks whose
+// pieces don't match the Merkle roots in the siafile.
+func TestVerifyChunkRoots(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Create a file consisting of a single full chunk.
+	siaPath := modules.RandomSiaPath()
+	rsc, _ := siafile.NewRSCode(2, 1)
+	key := crypto.GenerateSiaKey(crypto.TypeThreefish)
+	chunkSize := modules.SectorSize * uint64(rsc.MinPieces())
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, key, chunkSize, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+
+	// Upload the pieces of some random data to the file.
+	data := fastrand.Bytes(int(chunkSize))
+	dataPieces, _, err := readDataPieces(bytes.NewReader(data), rsc, entry.PieceSize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards, err := rsc.EncodeShards(dataPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, shard := range shards {
+		hpk := types.SiaPublicKey{Key: fastrand.Bytes(32)}
+		root := crypto.MerkleRoot(key.Derive(0, uint64(i)).EncryptBytes(shard))
+		if err := entry.AddPiece(hpk, 0, uint64(i), root); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The original data should pass the verification.
+	if err := verifyChunkRoots(entry, 0, data); err != nil {
+		t.Fatal(err)
+	}
+	// Corrupted data shouldn't.
+	data[fastrand.Intn(len(data))]++
+	if err := verifyChunkRoots(entry, 0, data); !errors.Contains(err, errVerificationMismatch) {
+		t.Fatalf("expected %v but got %v", errVerificationMismatch, err)
+	}
+}
+
+// TestVerifyFileDownloadFailure tests that a file whose chunk can't be
+// downloaded isn't flagged as failing the verification since the download
+// failure doesn't say anything about the data stored by the hosts.
+func TestVerifyFileDownloadFailure(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTesterWithDependency(t.Name(), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	siaPath := modules.RandomSiaPath()
+	rsc, _ := siafile.NewRSCode(1, 1)
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), 100, persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+
+	// The renter has no workers so the download should fail without
+	// recording a result.
+	rt.renter.threadedVerifyFile(entry.Copy())
+	if entry.VerificationFailed() {
+		t.Fatal("failed download shouldn't fail the verification")
+	}
+	if !entry.LastVerifiedTime().IsZero() {
+		t.Fatal("LastVerifiedTime shouldn't be set")
+	}
+	fi, err := rt.renter.File(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.VerificationFailed || !fi.LastVerifiedTime.IsZero() {
+		t.Fatal("unexpected verification result reported by FileInfo", fi.VerificationFailed, fi.LastVerifiedTime)
+	}
+}
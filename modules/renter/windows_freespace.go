@@ -0,0 +1,27 @@
+// +build windows
+
+package renter
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// getDiskFreeSpaceEx is the kernel32 function used to query the free space of
+// a disk.
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// freeDiskSpace returns the number of bytes available to the current user on
+// the disk containing path.
+func freeDiskSpace(path string) (uint64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	ret, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&free)), 0, 0)
+	if ret == 0 {
+		return 0, err
+	}
+	return free, nil
+}
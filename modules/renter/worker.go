@@ -70,6 +70,8 @@ type worker struct {
 	uploadConsecutiveFailures int                      // How many times in a row uploading has failed.
 	uploadRecentFailure       time.Time                // How recent was the last failure?
 	uploadRecentFailureErr    error                    // What was the reason for the last failure?
+	uploadRecentLatency       time.Duration            // How long did the last successful upload take?
+	uploadThroughputSamples   []throughputSample       // Recent successful uploads for measuring throughput.
 	uploadTerminated          bool                     // Have we stopped uploading?
 
 	// Utilities.
@@ -151,10 +151,12 @@ func (w *worker) managedPerformUploadChunkJob() bool {
 	w.unprocessedChunks = w.unprocessedChunks[1:]
 	w.mu.Unlock()
 
-	// Make sure the chunk wasn't canceled.
+	// Make sure the chunk wasn't canceled. Canceled chunks are dropped to
+	// make sure they are eventually removed from the repairingChunks.
 	nextChunk.cancelMU.Lock()
 	if nextChunk.canceled {
 		nextChunk.cancelMU.Unlock()
+		w.managedDropChunk(nextChunk)
 		return true
 	}
 	// Add this worker to the chunk's cancelWG for the duration of this method.
@@ -169,39 +171,14 @@ func (w *worker) managedPerformUploadChunkJob() bool {
 		return true
 	}
 
-	// Open an editing connection to the host.
-	e, err := w.renter.hostContractor.Editor(w.staticHostPubKey, w.renter.tg.StopChan())
+	// Upload the piece, retrying on the same host according to the chunk's
+	// retry policy.
+	root, err := w.managedUploadPiece(uc, pieceIndex)
 	if err != nil {
-		failureErr := fmt.Errorf("Worker failed to acquire an editor: %v", err)
-		w.renter.log.Debugln(failureErr)
-		w.managedUploadFailed(uc, pieceIndex, failureErr)
+		w.renter.log.Debugln(err)
+		w.managedUploadFailed(uc, pieceIndex, err)
 		return true
 	}
-	defer e.Close()
-
-	// Before performing the upload, check for price gouging.
-	allowance := w.renter.hostContractor.Allowance()
-	hostSettings := e.HostSettings()
-	err = checkUploadGouging(allowance, hostSettings)
-	if err != nil {
-		failureErr := errors.AddContext(err, "worker uploader is not being used because price gouging was detected")
-		w.renter.log.Debugln(failureErr)
-		w.managedUploadFailed(uc, pieceIndex, failureErr)
-		return true
-	}
-
-	// Perform the upload, and update the failure stats based on the success of
-	// the upload attempt.
-	root, err := e.Upload(uc.physicalChunkData[pieceIndex])
-	if err != nil {
-		failureErr := fmt.Errorf("Worker failed to upload via the editor: %v", err)
-		w.renter.log.Debugln(failureErr)
-		w.managedUploadFailed(uc, pieceIndex, failureErr)
-		return true
-	}
-	w.mu.Lock()
-	w.uploadConsecutiveFailures = 0
-	w.mu.Unlock()
 
 	// Add piece to renterFile
 	err = uc.fileEntry.AddPiece(w.staticHostPubKey, uc.index, pieceIndex, root)
@@ -211,6 +188,7 @@ func (w *worker) managedPerformUploadChunkJob() bool {
 		w.managedUploadFailed(uc, pieceIndex, failureErr)
 		return true
 	}
+	w.renter.managedAddToContractIndex(w.renter.staticFileSystem.FileSiaPath(uc.fileEntry), w.staticHostPubKey)
 
 	id := w.renter.mu.Lock()
 	w.renter.mu.Unlock(id)
@@ -310,10 +288,19 @@ func (w *worker) managedUploadFailed(uc *unfinishedUploadChunk, pieceIndex uint6
 		w.renter.log.Debugf("Worker upload failed. Worker: %v, Consecutive Failures: %v, Chunk: %v", w.staticHostPubKey, failures, uc.id)
 	}
 
-	// Unregister the piece from the chunk and hunt for a replacement.
+	// Unregister the piece from the chunk and hunt for a replacement. If the
+	// chunk ran out of host reselections, no other host may pick up the piece
+	// and the repair of the chunk is given up.
 	uc.mu.Lock()
 	uc.piecesRegistered--
 	uc.pieceUsage[pieceIndex] = false
+	uc.hostReselections++
+	maxReselections := uc.staticRetryPolicy.MaxHostReselections
+	if maxReselections > 0 && uc.hostReselections > maxReselections {
+		uc.unusedHosts = make(map[string]struct{})
+	} else {
+		uc.uploadRetries++
+	}
 	uc.mu.Unlock()
 
 	// Notify the standby workers of the chunk
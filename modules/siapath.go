@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"unicode"
 
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/fastrand"
@@ -105,6 +106,15 @@ func SnapshotsSiaPath() SiaPath {
 	return sp
 }
 
+// TrashSiaPath returns a siapath to /.trash
+func TrashSiaPath() SiaPath {
+	sp, err := RootSiaPath().Join(TrashRoot)
+	if err != nil {
+		build.Critical(err)
+	}
+	return sp
+}
+
 // CombinedSiaFilePath returns the SiaPath to a hidden siafile which is used to
 // store chunks that contain pieces of multiple siafiles.
 func CombinedSiaFilePath(ec ErasureCoder) SiaPath {
@@ -263,6 +273,8 @@ func (sp *SiaPath) FromSysPath(siaFilePath, dir string) (err error) {
 
 // Validate checks that a Siapath is a legal filename. ../ is disallowed to
 // prevent directory traversal, and paths must not begin with / or be empty.
+// Control characters are not allowed and the path must not escape the
+// directory it is joined with once it is converted to a system path.
 func (sp SiaPath) Validate(isRoot bool) error {
 	if sp.Path == "" && !isRoot {
 		return ErrEmptySiaPath
@@ -296,5 +308,20 @@ func (sp SiaPath) Validate(isRoot bool) error {
 		}
 		prevElem = pathElem
 	}
+	for _, r := range sp.Path {
+		if unicode.IsControl(r) {
+			return errors.New("siapath cannot contain control characters")
+		}
+	}
+	// Make sure that the system path doesn't escape its parent directory. This
+	// catches traversal using OS specific separators which are not covered by
+	// the checks above.
+	sysPath := filepath.Clean(filepath.FromSlash(sp.Path))
+	if sysPath == ".." || strings.HasPrefix(sysPath, ".."+string(filepath.Separator)) {
+		return errors.New("siapath cannot escape its root directory")
+	}
+	if filepath.IsAbs(sysPath) || filepath.VolumeName(sysPath) != "" {
+		return errors.New("siapath cannot be an absolute path")
+	}
 	return nil
 }
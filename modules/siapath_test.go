@@ -1,6 +1,9 @@
 package modules
 
 import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"gitlab.com/NebulousLabs/errors"
@@ -60,6 +63,12 @@ func TestSiapathValidate(t *testing.T) {
 		{"../", false},
 		{"./", false},
 		{".", false},
+		{"null\x00byte", false},
+		{"new\nline", false},
+		{"control/\x7fchar", false},
+		{"unicode/ÄÖÜ", true},
+		{"valid/siapath/..", false},
+		{"valid/../../escape", false},
 	}
 	for _, pathtest := range pathtests {
 		siaPath := SiaPath{
@@ -75,6 +84,57 @@ func TestSiapathValidate(t *testing.T) {
 	}
 }
 
+// TestSiapathTraversal verifies that siapaths which would escape the root
+// directory are rejected and that the system paths of valid siapaths are
+// within the root directory.
+func TestSiapathTraversal(t *testing.T) {
+	root := filepath.Join("root", "files")
+	inputs := []string{
+		"..",
+		"../escape",
+		"a/../../escape",
+		"a/b/../../..",
+		"\\..\\escape",
+		"a\\..\\..\\escape",
+		"..\x00/escape",
+		"\x00../escape",
+		"valid/path",
+		"valid..path/..",
+	}
+	for _, in := range inputs {
+		// Check both the constructor and unmarshaling since unmarshaling
+		// allows for the root siapath.
+		var unmarshaled SiaPath
+		b, err := json.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unmarshalErr := json.Unmarshal(b, &unmarshaled)
+		sp, err := NewSiaPath(in)
+		for _, check := range []struct {
+			sp  SiaPath
+			err error
+		}{{sp, err}, {unmarshaled, unmarshalErr}} {
+			if check.err != nil {
+				continue
+			}
+			for _, sysPath := range []string{
+				check.sp.SiaDirSysPath(root),
+				check.sp.SiaDirMetadataSysPath(root),
+				check.sp.SiaFileSysPath(root),
+			} {
+				rel, err := filepath.Rel(root, sysPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					t.Fatalf("siapath %q escapes root dir: %v", in, sysPath)
+				}
+			}
+		}
+	}
+}
+
 // TestSiapath tests that the NewSiaPath, LoadString, and Join methods function correctly
 func TestSiapath(t *testing.T) {
 	var pathtests = []struct {
@@ -57,6 +57,12 @@ func (a *AllowanceRequestPost) WithRenewWindow(renewWindow types.BlockHeight) *A
 	return a
 }
 
+// WithRenewJitter adds the renew jitter field to the request.
+func (a *AllowanceRequestPost) WithRenewJitter(renewJitter types.BlockHeight) *AllowanceRequestPost {
+	a.values.Set("renewjitter", fmt.Sprint(renewJitter))
+	return a
+}
+
 // WithExpectedStorage adds the expected storage field to the request.
 func (a *AllowanceRequestPost) WithExpectedStorage(expectedStorage uint64) *AllowanceRequestPost {
 	a.values.Set("expectedstorage", fmt.Sprint(expectedStorage))
@@ -431,6 +437,7 @@ func (c *Client) RenterPostAllowance(allowance modules.Allowance) error {
 	a = a.WithHosts(allowance.Hosts)
 	a = a.WithPeriod(allowance.Period)
 	a = a.WithRenewWindow(allowance.RenewWindow)
+	a = a.WithRenewJitter(allowance.RenewJitter)
 	a = a.WithExpectedStorage(allowance.ExpectedStorage)
 	a = a.WithExpectedUpload(allowance.ExpectedUpload)
 	a = a.WithExpectedDownload(allowance.ExpectedDownload)
@@ -549,6 +556,19 @@ func (c *Client) RenterUploadForcePost(path string, siaPath modules.SiaPath, dat
 	return
 }
 
+// RenterUploadDryRunPost uses the /renter/upload endpoint to validate the
+// upload of a file without uploading it.
+func (c *Client) RenterUploadDryRunPost(path string, siaPath modules.SiaPath, dataPieces, parityPieces uint64) (estimate modules.UploadEstimate, err error) {
+	sp := escapeSiaPath(siaPath)
+	values := url.Values{}
+	values.Set("source", path)
+	values.Set("datapieces", strconv.FormatUint(dataPieces, 10))
+	values.Set("paritypieces", strconv.FormatUint(parityPieces, 10))
+	values.Set("dryrun", "true")
+	err = c.post(fmt.Sprintf("/renter/upload/%s", sp), values.Encode(), &estimate)
+	return
+}
+
 // RenterUploadDefaultPost uses the /renter/upload endpoint with default
 // redundancy settings to upload a file.
 func (c *Client) RenterUploadDefaultPost(path string, siaPath modules.SiaPath) (err error) {
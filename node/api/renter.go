@@ -21,6 +21,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/contractor"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/proto"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/siafile"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -257,6 +258,21 @@ func rebaseInputSiaPath(siaPath modules.SiaPath) (modules.SiaPath, error) {
 	return modules.UserSiaPath().Join(siaPath.String())
 }
 
+// uploadErrorStatus returns the http status code matching an error returned by
+// one of the renter's upload methods.
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.IsOSNotExist(err), errors.Contains(err, renter.ErrUploadDirectory), errors.Contains(err, renter.ErrUnknownCompression):
+		return http.StatusBadRequest
+	case errors.Contains(err, filesystem.ErrExists), errors.Contains(err, siafile.ErrPathOverload), errors.Contains(err, renter.ErrFileReadOnly):
+		return http.StatusConflict
+	case errors.Contains(err, renter.ErrInsufficientContracts):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // trimSiaDirFolder is a helper method to trim /home/siafiles off of the
 // siapaths of the dirinfos since the user expects a path relative to
 // /home/siafiles and not relative to root.
@@ -635,6 +651,14 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 		settings.Allowance.RenewWindow = types.BlockHeight(renewWindow)
 		renewWindowSet = true
 	}
+	if rj := req.FormValue("renewjitter"); rj != "" {
+		var renewJitter types.BlockHeight
+		if _, err := fmt.Sscan(rj, &renewJitter); err != nil {
+			WriteError(w, Error{"unable to parse renewjitter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.Allowance.RenewJitter = renewJitter
+	}
 	if es := req.FormValue("expectedstorage"); es != "" {
 		var expectedStorage uint64
 		if _, err := fmt.Sscan(es, &expectedStorage); err != nil {
@@ -854,7 +878,28 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 		settings.IPViolationCheck = ipviolationcheck
 	}
 
-	// Set the settings in the renter.
+	// Scan the chunkdeduplication flag.
+	if cd := req.FormValue("chunkdeduplication"); cd != "" {
+		var chunkDeduplication bool
+		if _, err := fmt.Sscan(cd, &chunkDeduplication); err != nil {
+			WriteError(w, Error{"unable to parse chunkdeduplication: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.ChunkDeduplication = chunkDeduplication
+	}
+
+	// Scan the repairthreshold.
+	if rt := req.FormValue("repairthreshold"); rt != "" {
+		var repairThreshold float64
+		if _, err := fmt.Sscan(rt, &repairThreshold); err != nil {
+			WriteError(w, Error{"unable to parse repairthreshold: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.RepairThreshold = repairThreshold
+	}
+
+	// Set the settings in the renter. The settings are validated before any
+	// of them are applied.
 	err = api.renter.SetSettings(settings)
 	if err != nil {
 		WriteError(w, Error{"unable to set renter settings: " + err.Error()}, http.StatusBadRequest)
@@ -1722,6 +1767,43 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 			return
 		}
 	}
+	// Check whether the upload should only be validated.
+	dryRun := false
+	if d := req.FormValue("dryrun"); d != "" {
+		dryRun, err = strconv.ParseBool(d)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'dryrun' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	// Check whether the upload may start with a lower redundancy.
+	allowLowRedundancy := false
+	if a := req.FormValue("allowlowredundancy"); a != "" {
+		allowLowRedundancy, err = strconv.ParseBool(a)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'allowlowredundancy' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	// Parse the upload deadline.
+	var deadline time.Time
+	if d := req.FormValue("deadline"); d != "" {
+		deadlineInt, err := strconv.ParseInt(d, 10, 64)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'deadline' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		deadline = time.Unix(deadlineInt, 0)
+	}
+	// Check whether the file should be read-only.
+	readOnly := false
+	if ro := req.FormValue("readonly"); ro != "" {
+		readOnly, err = strconv.ParseBool(ro)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'readonly' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
 	// Parse the erasure coder.
 	ec, err := parseErasureCodingParameters(req.FormValue("datapieces"), req.FormValue("paritypieces"))
 	if err != nil {
@@ -1740,15 +1822,24 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
 	}
-	err = api.renter.Upload(modules.FileUploadParams{
+	estimate, err := api.renter.Upload(modules.FileUploadParams{
 		Source:              source,
 		SiaPath:             siaPath,
 		ErasureCode:         ec,
 		Force:               force,
 		DisablePartialChunk: true, // TODO: remove this
+		DryRun:              dryRun,
+		AllowLowRedundancy:  allowLowRedundancy,
+		Compression:         modules.CompressionCodec(req.FormValue("compression")),
+		Deadline:            deadline,
+		ReadOnly:            readOnly,
 	})
 	if err != nil {
-		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
+		WriteError(w, Error{"upload failed: " + err.Error()}, uploadErrorStatus(err))
+		return
+	}
+	if dryRun {
+		WriteJSON(w, estimate)
 		return
 	}
 	WriteSuccess(w)
@@ -1876,7 +1967,7 @@ func (api *API) renterUploadStreamHandler(w http.ResponseWriter, req *http.Reque
 	}
 	err = api.renter.UploadStreamFromReader(up, req.Body)
 	if err != nil {
-		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
+		WriteError(w, Error{"upload failed: " + err.Error()}, uploadErrorStatus(err))
 		return
 	}
 	WriteSuccess(w)